@@ -0,0 +1,184 @@
+package ackhandler
+
+import "github.com/romain-jacotin/quic/protocol"
+import "errors"
+import "time"
+
+const (
+	// ACK_DELAYED_TIMEOUT is the maximum delay before acknowledging a retransmittable packet
+	ACK_DELAYED_TIMEOUT = 25 * time.Millisecond
+	// ACK_RETRANSMITTABLE_THRESHOLD is the number of retransmittable packets received that triggers an ACK
+	ACK_RETRANSMITTABLE_THRESHOLD = 2
+	// ACK_MAX_TRACKED_RANGES is the maximum number of ranges of received packets, the oldest ranges are dropped above it
+	ACK_MAX_TRACKED_RANGES = 256
+	// REPLAY_WINDOW_SIZE is the number of sequence numbers up to the largest received whose reception is remembered,
+	// the older packets are duplicates
+	REPLAY_WINDOW_SIZE = 2048
+)
+
+// ErrDuplicatePacket is returned by ReceivedPacket for a packet already received, below the STOP_WAITING threshold,
+// or older than the REPLAY_WINDOW_SIZE.
+var ErrDuplicatePacket = errors.New("ReceivedPacketTracker.ReceivedPacket : duplicate packet")
+
+// ReceivedPacketTracker records the sequence numbers of the received packets, and decides when to send an ACK frame.
+//
+// An ACK is sent every ACK_RETRANSMITTABLE_THRESHOLD retransmittable packets, ACK_DELAYED_TIMEOUT after the first
+// unacknowledged retransmittable packet, or immediately when a retransmittable packet reveals a gap.
+// Packets that are not retransmittable (ACK only) never trigger an ACK.
+//
+// A bitmap of the REPLAY_WINDOW_SIZE sequence numbers up to the largest received detects the duplicates, the unpacker
+// drops them with IsDuplicate before opening them: a replayed packet changes neither the streams nor the ACK frames.
+type ReceivedPacketTracker struct {
+	// ranges of received packets, sorted in descending order
+	ranges              []protocol.AckRange
+	largestObserved     protocol.QuicPacketSequenceNumber
+	largestObservedTime time.Time
+	ignoreBelow         protocol.QuicPacketSequenceNumber
+	// window has the bit seqnum % REPLAY_WINDOW_SIZE set for the packets received up to largestObserved
+	window          [REPLAY_WINDOW_SIZE / 64]uint64
+	retransmittable int
+	ackQueued       bool
+	ackAlarm        time.Time
+}
+
+// NewReceivedPacketTracker returns an empty ReceivedPacketTracker.
+func NewReceivedPacketTracker() *ReceivedPacketTracker {
+	return new(ReceivedPacketTracker)
+}
+
+// ReceivedPacket records the packet received at rcvTime.
+func (this *ReceivedPacketTracker) ReceivedPacket(seqnum protocol.QuicPacketSequenceNumber, rcvTime time.Time, retransmittable bool) error {
+	if this.IsDuplicate(seqnum) {
+		return ErrDuplicatePacket
+	}
+	gap := len(this.ranges) > 0 && seqnum != this.largestObserved+1
+	if !this.insert(seqnum) {
+		return ErrDuplicatePacket
+	}
+	this.markReceived(seqnum)
+	if seqnum > this.largestObserved {
+		this.largestObserved = seqnum
+		this.largestObservedTime = rcvTime
+	}
+
+	if !retransmittable {
+		return nil
+	}
+	this.retransmittable++
+	switch {
+	case gap, this.retransmittable >= ACK_RETRANSMITTABLE_THRESHOLD:
+		this.ackQueued = true
+	case this.ackAlarm.IsZero():
+		this.ackAlarm = rcvTime.Add(ACK_DELAYED_TIMEOUT)
+	}
+	return nil
+}
+
+// IsDuplicate returns true if the packet has already been received, is below the STOP_WAITING threshold,
+// or is older than the REPLAY_WINDOW_SIZE.
+func (this *ReceivedPacketTracker) IsDuplicate(seqnum protocol.QuicPacketSequenceNumber) bool {
+	switch {
+	case seqnum == 0 || seqnum < this.ignoreBelow:
+		return true
+	case seqnum > this.largestObserved:
+		return false
+	case this.largestObserved-seqnum >= REPLAY_WINDOW_SIZE:
+		return true
+	}
+	i := seqnum % REPLAY_WINDOW_SIZE
+	return this.window[i/64]&(1<<(i%64)) != 0
+}
+
+// markReceived sets the bit of the sequence number in the window, a new largest sequence number clears the bits of the
+// sequence numbers it skips.
+func (this *ReceivedPacketTracker) markReceived(seqnum protocol.QuicPacketSequenceNumber) {
+	switch {
+	case seqnum <= this.largestObserved:
+	case seqnum-this.largestObserved >= REPLAY_WINDOW_SIZE:
+		this.window = [REPLAY_WINDOW_SIZE / 64]uint64{}
+	default:
+		for n := this.largestObserved + 1; n < seqnum; n++ {
+			i := n % REPLAY_WINDOW_SIZE
+			this.window[i/64] &^= 1 << (i % 64)
+		}
+	}
+	i := seqnum % REPLAY_WINDOW_SIZE
+	this.window[i/64] |= 1 << (i % 64)
+}
+
+// insert adds the sequence number in the ranges, and returns false if it is already there.
+func (this *ReceivedPacketTracker) insert(seqnum protocol.QuicPacketSequenceNumber) bool {
+	i := 0
+	for i < len(this.ranges) && this.ranges[i].Smallest > seqnum {
+		i++
+	}
+	if i < len(this.ranges) && this.ranges[i].Largest >= seqnum {
+		return false
+	}
+	above := i > 0 && this.ranges[i-1].Smallest == seqnum+1
+	below := i < len(this.ranges) && this.ranges[i].Largest+1 == seqnum
+	switch {
+	case above && below:
+		this.ranges[i-1].Smallest = this.ranges[i].Smallest
+		this.ranges = append(this.ranges[:i], this.ranges[i+1:]...)
+	case above:
+		this.ranges[i-1].Smallest = seqnum
+	case below:
+		this.ranges[i].Largest = seqnum
+	default:
+		this.ranges = append(this.ranges, protocol.AckRange{})
+		copy(this.ranges[i+1:], this.ranges[i:])
+		this.ranges[i] = protocol.AckRange{Smallest: seqnum, Largest: seqnum}
+		// Bounded memory: drop the oldest ranges
+		if len(this.ranges) > ACK_MAX_TRACKED_RANGES {
+			this.ranges = this.ranges[:ACK_MAX_TRACKED_RANGES]
+			this.ignoreBelow = this.ranges[ACK_MAX_TRACKED_RANGES-1].Smallest
+		}
+	}
+	return true
+}
+
+// IgnoreBelow forgets the packets below the least unacked sequence number of a STOP_WAITING frame of the peer.
+func (this *ReceivedPacketTracker) IgnoreBelow(leastUnacked protocol.QuicPacketSequenceNumber) {
+	if leastUnacked <= this.ignoreBelow {
+		return
+	}
+	this.ignoreBelow = leastUnacked
+	i := 0
+	for i < len(this.ranges) && this.ranges[i].Smallest >= leastUnacked {
+		i++
+	}
+	if i < len(this.ranges) && this.ranges[i].Largest >= leastUnacked {
+		this.ranges[i].Smallest = leastUnacked
+		i++
+	}
+	this.ranges = this.ranges[:i]
+}
+
+// GetAlarmTimeout returns the time of the delayed ACK, or the zero time if there is no delayed ACK.
+func (this *ReceivedPacketTracker) GetAlarmTimeout() time.Time {
+	return this.ackAlarm
+}
+
+// ShouldSendAck returns true if an ACK frame must be sent now.
+func (this *ReceivedPacketTracker) ShouldSendAck(now time.Time) bool {
+	return this.ackQueued || (!this.ackAlarm.IsZero() && !now.Before(this.ackAlarm))
+}
+
+// BuildAckFrame returns the ACK frame of the received packets, or nil if no packet has been received.
+//
+// The ACK sending state is reset: the next ACK is triggered by the next retransmittable packets.
+func (this *ReceivedPacketTracker) BuildAckFrame(now time.Time) *protocol.AckFrame {
+	if len(this.ranges) == 0 {
+		return nil
+	}
+	this.ackQueued = false
+	this.ackAlarm = time.Time{}
+	this.retransmittable = 0
+	ranges := make([]protocol.AckRange, len(this.ranges))
+	copy(ranges, this.ranges)
+	return &protocol.AckFrame{
+		LargestAcked: this.ranges[0].Largest,
+		AckDelay:     now.Sub(this.largestObservedTime),
+		Ranges:       ranges}
+}
@@ -0,0 +1,164 @@
+package ackhandler
+
+import "github.com/romain-jacotin/quic/protocol"
+import "testing"
+import "reflect"
+import "time"
+
+var tests_receivedpackettracker = []struct {
+	received []protocol.QuicPacketSequenceNumber
+	ranges   []protocol.AckRange
+}{
+	{[]protocol.QuicPacketSequenceNumber{1, 2, 3}, []protocol.AckRange{{Smallest: 1, Largest: 3}}},
+	{[]protocol.QuicPacketSequenceNumber{3, 2, 1}, []protocol.AckRange{{Smallest: 1, Largest: 3}}},
+	{[]protocol.QuicPacketSequenceNumber{1, 3, 5}, []protocol.AckRange{{Smallest: 5, Largest: 5}, {Smallest: 3, Largest: 3}, {Smallest: 1, Largest: 1}}},
+	{[]protocol.QuicPacketSequenceNumber{1, 3, 5, 4}, []protocol.AckRange{{Smallest: 3, Largest: 5}, {Smallest: 1, Largest: 1}}},
+	{[]protocol.QuicPacketSequenceNumber{1, 3, 5, 4, 2}, []protocol.AckRange{{Smallest: 1, Largest: 5}}},
+	{[]protocol.QuicPacketSequenceNumber{10, 1, 7, 8, 2}, []protocol.AckRange{{Smallest: 10, Largest: 10}, {Smallest: 7, Largest: 8}, {Smallest: 1, Largest: 2}}},
+}
+
+func Test_ReceivedPacketTracker_Ranges(t *testing.T) {
+	now := time.Now()
+	for i, v := range tests_receivedpackettracker {
+		tracker := NewReceivedPacketTracker()
+		for _, seqnum := range v.received {
+			if err := tracker.ReceivedPacket(seqnum, now, true); err != nil {
+				t.Errorf("ReceivedPacketTracker.ReceivedPacket : unexpected error %v in test n°%v", err, i)
+			}
+		}
+		for _, seqnum := range v.received {
+			if err := tracker.ReceivedPacket(seqnum, now, true); err != ErrDuplicatePacket {
+				t.Errorf("ReceivedPacketTracker.ReceivedPacket : ErrDuplicatePacket expected for %v in test n°%v", seqnum, i)
+			}
+		}
+		f := tracker.BuildAckFrame(now)
+		if f.LargestAcked != v.ranges[0].Largest || !reflect.DeepEqual(f.Ranges, v.ranges) {
+			t.Errorf("ReceivedPacketTracker.BuildAckFrame : invalid ranges %v in test n°%v", f.Ranges, i)
+		}
+	}
+}
+
+func Test_ReceivedPacketTracker_AckPolicy(t *testing.T) {
+	now := time.Now()
+	tracker := NewReceivedPacketTracker()
+	if tracker.BuildAckFrame(now) != nil {
+		t.Error("ReceivedPacketTracker.BuildAckFrame : no ACK frame expected without received packet")
+	}
+
+	// Non retransmittable packets never trigger an ACK
+	tracker.ReceivedPacket(1, now, false)
+	tracker.ReceivedPacket(2, now, false)
+	if tracker.ShouldSendAck(now.Add(time.Second)) {
+		t.Error("ReceivedPacketTracker.ShouldSendAck : ACK only packets must not be acknowledged")
+	}
+
+	// Delayed ACK after one retransmittable packet
+	tracker.ReceivedPacket(3, now, true)
+	if tracker.ShouldSendAck(now) || tracker.GetAlarmTimeout() != now.Add(ACK_DELAYED_TIMEOUT) {
+		t.Error("ReceivedPacketTracker.ShouldSendAck : delayed ACK expected")
+	}
+	if !tracker.ShouldSendAck(now.Add(ACK_DELAYED_TIMEOUT)) {
+		t.Error("ReceivedPacketTracker.ShouldSendAck : ACK expected at the delayed ACK timeout")
+	}
+
+	// Immediate ACK after two retransmittable packets
+	tracker.ReceivedPacket(4, now, true)
+	if !tracker.ShouldSendAck(now) {
+		t.Error("ReceivedPacketTracker.ShouldSendAck : ACK expected after two retransmittable packets")
+	}
+	f := tracker.BuildAckFrame(now.Add(5 * time.Millisecond))
+	if f.AckDelay != 5*time.Millisecond || tracker.ShouldSendAck(now.Add(time.Second)) || !tracker.GetAlarmTimeout().IsZero() {
+		t.Errorf("ReceivedPacketTracker.BuildAckFrame : ACK state must be reset, delay %v", f.AckDelay)
+	}
+
+	// Immediate ACK on a gap
+	tracker.ReceivedPacket(6, now, true)
+	if !tracker.ShouldSendAck(now) {
+		t.Error("ReceivedPacketTracker.ShouldSendAck : ACK expected on a gap")
+	}
+}
+
+func Test_ReceivedPacketTracker_IgnoreBelow(t *testing.T) {
+	now := time.Now()
+	tracker := NewReceivedPacketTracker()
+	for _, seqnum := range []protocol.QuicPacketSequenceNumber{1, 2, 4, 5, 6, 9} {
+		tracker.ReceivedPacket(seqnum, now, true)
+	}
+	tracker.IgnoreBelow(5)
+	if f := tracker.BuildAckFrame(now); !reflect.DeepEqual(f.Ranges, []protocol.AckRange{{Smallest: 9, Largest: 9}, {Smallest: 5, Largest: 6}}) {
+		t.Errorf("ReceivedPacketTracker.IgnoreBelow : invalid ranges %v", f.Ranges)
+	}
+	if err := tracker.ReceivedPacket(3, now, true); err != ErrDuplicatePacket {
+		t.Errorf("ReceivedPacketTracker.ReceivedPacket : ErrDuplicatePacket expected below STOP_WAITING instead of %v", err)
+	}
+	tracker.IgnoreBelow(2)
+	if f := tracker.BuildAckFrame(now); len(f.Ranges) != 2 {
+		t.Errorf("ReceivedPacketTracker.IgnoreBelow : ranges must not grow back %v", f.Ranges)
+	}
+}
+
+func Test_ReceivedPacketTracker_BoundedRanges(t *testing.T) {
+	now := time.Now()
+	tracker := NewReceivedPacketTracker()
+	// Pathologically gappy sequence numbers
+	for i := 1; i <= 10*ACK_MAX_TRACKED_RANGES; i++ {
+		tracker.ReceivedPacket(protocol.QuicPacketSequenceNumber(2*i), now, true)
+	}
+	f := tracker.BuildAckFrame(now)
+	if len(f.Ranges) != ACK_MAX_TRACKED_RANGES || f.LargestAcked != 20*ACK_MAX_TRACKED_RANGES {
+		t.Errorf("ReceivedPacketTracker : %v ranges instead of %v", len(f.Ranges), ACK_MAX_TRACKED_RANGES)
+	}
+	if f.Ranges[ACK_MAX_TRACKED_RANGES-1].Smallest != 2*9*ACK_MAX_TRACKED_RANGES+2 {
+		t.Errorf("ReceivedPacketTracker : the oldest ranges must be dropped, smallest %v", f.Ranges[ACK_MAX_TRACKED_RANGES-1].Smallest)
+	}
+	if err := tracker.ReceivedPacket(3, now, true); err != ErrDuplicatePacket {
+		t.Errorf("ReceivedPacketTracker.ReceivedPacket : dropped packets must be ignored instead of %v", err)
+	}
+	b := make([]byte, f.GetSerializedSize())
+	if _, err := f.Write(b); err != nil {
+		t.Errorf("AckFrame.Write : unexpected error %v", err)
+	}
+}
+
+var tests_replaywindow = []struct {
+	received  []protocol.QuicPacketSequenceNumber
+	seqnum    protocol.QuicPacketSequenceNumber
+	duplicate bool
+}{
+	{[]protocol.QuicPacketSequenceNumber{1, 2, 3}, 2, true},
+	{[]protocol.QuicPacketSequenceNumber{1, 2, 3}, 4, false},
+	{[]protocol.QuicPacketSequenceNumber{1, 3}, 2, false},
+	{[]protocol.QuicPacketSequenceNumber{1, 3000}, 1, true},
+	{[]protocol.QuicPacketSequenceNumber{1, 3000}, 3000 - REPLAY_WINDOW_SIZE, true},
+	{[]protocol.QuicPacketSequenceNumber{1, 3000}, 3000 - REPLAY_WINDOW_SIZE + 1, false},
+	{[]protocol.QuicPacketSequenceNumber{5, 4 + REPLAY_WINDOW_SIZE}, 5, true},
+	{[]protocol.QuicPacketSequenceNumber{5, 4 + REPLAY_WINDOW_SIZE}, 6, false},
+	{[]protocol.QuicPacketSequenceNumber{5, 5 + REPLAY_WINDOW_SIZE}, 5, true},
+	{[]protocol.QuicPacketSequenceNumber{5, 5 + REPLAY_WINDOW_SIZE}, 6, false},
+	{[]protocol.QuicPacketSequenceNumber{2, 2 + REPLAY_WINDOW_SIZE, 3 + REPLAY_WINDOW_SIZE}, 3 + REPLAY_WINDOW_SIZE, true},
+	{[]protocol.QuicPacketSequenceNumber{2, 2 + REPLAY_WINDOW_SIZE, 3 + REPLAY_WINDOW_SIZE}, 4 + REPLAY_WINDOW_SIZE, false},
+}
+
+func Test_ReceivedPacketTracker_ReplayWindow(t *testing.T) {
+	now := time.Now()
+	for i, v := range tests_replaywindow {
+		tracker := NewReceivedPacketTracker()
+		for _, seqnum := range v.received {
+			if err := tracker.ReceivedPacket(seqnum, now, true); err != nil {
+				t.Errorf("ReceivedPacketTracker.ReceivedPacket : unexpected error %v in test n°%v", err, i)
+			}
+		}
+		if tracker.IsDuplicate(v.seqnum) != v.duplicate {
+			t.Errorf("ReceivedPacketTracker.IsDuplicate : %v expected for %v in test n°%v", v.duplicate, v.seqnum, i)
+		}
+		f := tracker.BuildAckFrame(now)
+		err := tracker.ReceivedPacket(v.seqnum, now, true)
+		if (err == ErrDuplicatePacket) != v.duplicate {
+			t.Errorf("ReceivedPacketTracker.ReceivedPacket : duplicate %v expected instead of %v for %v in test n°%v", v.duplicate, err, v.seqnum, i)
+		}
+		// A duplicate doesn't change the ranges of the next ACK frame
+		if g := tracker.BuildAckFrame(now); v.duplicate && !reflect.DeepEqual(f.Ranges, g.Ranges) {
+			t.Errorf("ReceivedPacketTracker.BuildAckFrame : ranges %v expected instead of %v in test n°%v", f.Ranges, g.Ranges, i)
+		}
+	}
+}
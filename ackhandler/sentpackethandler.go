@@ -0,0 +1,432 @@
+package ackhandler
+
+import "github.com/romain-jacotin/quic/congestion"
+import "github.com/romain-jacotin/quic/protocol"
+import "errors"
+import "time"
+
+const (
+	// LOSS_REORDERING_THRESHOLD is the number of newer packets acknowledged that declares a packet lost (fast retransmit)
+	LOSS_REORDERING_THRESHOLD = 3
+	// LOSS_TIME_THRESHOLD_NUM / LOSS_TIME_THRESHOLD_DEN is the fraction of the largest of the latest and smoothed RTT
+	// after which a packet is declared lost if a newer packet is acknowledged
+	LOSS_TIME_THRESHOLD_NUM = 9
+	LOSS_TIME_THRESHOLD_DEN = 8
+	// LOSS_DEFAULT_RTT is the RTT used by the time threshold and the tail loss probe before the first RTT sample
+	LOSS_DEFAULT_RTT = 100 * time.Millisecond
+	// RTO_DEFAULT is the retransmission timeout before the first RTT sample
+	RTO_DEFAULT = 500 * time.Millisecond
+	// RTO_MIN and RTO_MAX bound the retransmission timeout, RTO_MAX includes the exponential backoff
+	RTO_MIN = 200 * time.Millisecond
+	RTO_MAX = 60 * time.Second
+	// TLP_MAX_PROBES is the number of tail loss probes sent before the retransmission timeout
+	TLP_MAX_PROBES = 2
+	// TLP_MIN_DELAY is the minimum delay of a tail loss probe
+	TLP_MIN_DELAY = 10 * time.Millisecond
+)
+
+// ErrAckForUnsentPacket is returned by ReceivedAck when the peer acknowledges a packet that has not been sent.
+var ErrAckForUnsentPacket = errors.New("SentPacketHandler.ReceivedAck : ACK for a packet not sent")
+
+// SentPacket is a packet recorded by the SentPacketHandler until it is acknowledged or lost.
+type SentPacket struct {
+	SequenceNumber  protocol.QuicPacketSequenceNumber
+	Frames          []protocol.Frame
+	Length          int
+	SentTime        time.Time
+	EncryptionLevel protocol.EncryptionLevel
+	Retransmittable bool
+	// MTUProbe is a padded PING packet larger than the packets of the connection: its loss means that the path MTU
+	// is smaller, it is neither a congestion signal nor retransmitted
+	MTUProbe bool
+}
+
+// SentPacketHandler records the sent packets, processes the ACK frames of the peer and detects the lost packets.
+//
+// The retransmittable frames of the lost packets are queued for retransmission in a new packet.
+type SentPacketHandler struct {
+	// packets not acknowledged nor lost, in increasing sequence number order
+	packets         []*SentPacket
+	largestSent     protocol.QuicPacketSequenceNumber
+	largestAcked    protocol.QuicPacketSequenceNumber
+	bytesInFlight   int
+	rttStats        *congestion.RTTStats
+	sendAlgorithm   congestion.SendAlgorithm
+	lossTime        time.Time
+	retransmissions []protocol.Frame
+	// tail loss probes and retransmission timeouts since the last ACK of a new packet
+	tlpCount int
+	rtoCount int
+	// packets allowed beyond the congestion window by the alarm, and the frames of the pending tail loss probe
+	probePackets int
+	probe        *SentPacket
+	// onLost is called with the packets declared lost, if set
+	onLost func(p *SentPacket)
+}
+
+// NewSentPacketHandler returns an empty SentPacketHandler that updates the RTT statistics, shared with the congestion control.
+func NewSentPacketHandler(rttStats *congestion.RTTStats) *SentPacketHandler {
+	if rttStats == nil {
+		rttStats = congestion.NewRTTStats()
+	}
+	return &SentPacketHandler{rttStats: rttStats}
+}
+
+// OnCongestionExperienced reacts to a packet received with the Congestion Experienced ECN mark: the congestion control
+// reduces its window like on a loss, without retransmission.
+func (this *SentPacketHandler) OnCongestionExperienced() {
+	if this.sendAlgorithm != nil {
+		this.sendAlgorithm.OnCongestionExperienced()
+	}
+}
+
+// GetCongestionWindow returns the congestion window in bytes, 0 without congestion control.
+func (this *SentPacketHandler) GetCongestionWindow() int {
+	if this.sendAlgorithm == nil {
+		return 0
+	}
+	return this.sendAlgorithm.GetCongestionWindow()
+}
+
+// SetLossCallback calls f with each packet declared lost by the loss detection or the retransmission timeout.
+func (this *SentPacketHandler) SetLossCallback(f func(p *SentPacket)) {
+	this.onLost = f
+}
+
+// SetSendAlgorithm sets the congestion control of the connection, fed with the sent, acknowledged and lost packets.
+func (this *SentPacketHandler) SetSendAlgorithm(sendAlgorithm congestion.SendAlgorithm) {
+	this.sendAlgorithm = sendAlgorithm
+}
+
+// TimeUntilSend returns the delay before the congestion control allows the next packet, 0 without congestion control.
+//
+// The probe packets of the tail loss probe and of the retransmission timeout are sent regardless of the congestion control.
+func (this *SentPacketHandler) TimeUntilSend(now time.Time) time.Duration {
+	if this.sendAlgorithm == nil || this.probePackets > 0 {
+		return 0
+	}
+	return this.sendAlgorithm.TimeUntilSend(now, this.bytesInFlight)
+}
+
+// SentPacket records a sent packet, the sequence numbers must be increasing.
+func (this *SentPacketHandler) SentPacket(packet *SentPacket) error {
+	if packet.SequenceNumber <= this.largestSent {
+		return errors.New("SentPacketHandler.SentPacket : sequence numbers must be increasing")
+	}
+	this.largestSent = packet.SequenceNumber
+	this.packets = append(this.packets, packet)
+	if this.sendAlgorithm != nil {
+		this.sendAlgorithm.OnPacketSent(packet.SentTime, this.bytesInFlight, packet.SequenceNumber, packet.Length, packet.Retransmittable)
+	}
+	if packet.Retransmittable {
+		this.bytesInFlight += packet.Length
+		if this.probePackets > 0 {
+			this.probePackets--
+		}
+	}
+	return nil
+}
+
+// ReceivedAck processes an ACK frame received at rcvTime, and returns the packets it newly acknowledges.
+//
+// ACK frames can arrive out of order, and can acknowledge packets already declared lost: these are ignored.
+func (this *SentPacketHandler) ReceivedAck(f *protocol.AckFrame, rcvTime time.Time) ([]*SentPacket, error) {
+	var acked []*SentPacket
+
+	if f.LargestAcked > this.largestSent {
+		return nil, ErrAckForUnsentPacket
+	}
+	priorInFlight := this.bytesInFlight
+	remaining := this.packets[:0]
+	for _, p := range this.packets {
+		if f.AcksPacket(p.SequenceNumber) {
+			acked = append(acked, p)
+			if p.Retransmittable {
+				this.bytesInFlight -= p.Length
+			}
+			if p == this.probe {
+				// Late ACK: the tail loss probe is useless
+				this.probe = nil
+			}
+			// RTT sample from the largest acknowledged packet only
+			if p.SequenceNumber == f.LargestAcked && f.LargestAcked > this.largestAcked {
+				this.rttStats.UpdateRTT(rcvTime.Sub(p.SentTime), f.AckDelay)
+			}
+		} else {
+			remaining = append(remaining, p)
+		}
+	}
+	for i := len(remaining); i < len(this.packets); i++ {
+		this.packets[i] = nil
+	}
+	this.packets = remaining
+	if f.LargestAcked > this.largestAcked {
+		this.largestAcked = f.LargestAcked
+	}
+	if len(acked) > 0 {
+		this.tlpCount = 0
+		this.rtoCount = 0
+	}
+	// Losses first: the packets acknowledged in the same ACK frame don't grow the reduced window
+	this.detectLosses(rcvTime)
+	if this.sendAlgorithm != nil {
+		for _, p := range acked {
+			if p.Retransmittable {
+				this.sendAlgorithm.OnPacketAcked(p.SequenceNumber, p.Length, priorInFlight, rcvTime)
+			}
+		}
+	}
+	return acked, nil
+}
+
+// detectLosses declares lost the packets LOSS_REORDERING_THRESHOLD packets below the largest acknowledged packet,
+// or sent more than LOSS_TIME_THRESHOLD of the RTT before now, and arms the loss timer of the other packets below it.
+func (this *SentPacketHandler) detectLosses(now time.Time) {
+	rtt := this.rttStats.LatestRTT()
+	if srtt := this.rttStats.SmoothedRTT(); srtt > rtt {
+		rtt = srtt
+	}
+	if rtt == 0 {
+		rtt = LOSS_DEFAULT_RTT
+	}
+	delay := rtt * LOSS_TIME_THRESHOLD_NUM / LOSS_TIME_THRESHOLD_DEN
+	this.lossTime = time.Time{}
+	remaining := this.packets[:0]
+	for _, p := range this.packets {
+		if p.SequenceNumber > this.largestAcked {
+			remaining = append(remaining, p)
+			continue
+		}
+		if this.largestAcked-p.SequenceNumber >= LOSS_REORDERING_THRESHOLD || now.Sub(p.SentTime) > delay {
+			this.lost(p)
+			continue
+		}
+		if t := p.SentTime.Add(delay); this.lossTime.IsZero() || t.Before(this.lossTime) {
+			this.lossTime = t
+		}
+		remaining = append(remaining, p)
+	}
+	for i := len(remaining); i < len(this.packets); i++ {
+		this.packets[i] = nil
+	}
+	this.packets = remaining
+}
+
+// lost queues the retransmittable frames of the lost packet, the loss of an MTU probe is hidden from the congestion control.
+func (this *SentPacketHandler) lost(p *SentPacket) {
+	if this.onLost != nil {
+		this.onLost(p)
+	}
+	if !p.Retransmittable {
+		return
+	}
+	if this.sendAlgorithm != nil && !p.MTUProbe {
+		this.sendAlgorithm.OnPacketLost(p.SequenceNumber, p.Length, this.bytesInFlight)
+	}
+	this.bytesInFlight -= p.Length
+	this.queueRetransmission(p)
+}
+
+// queueRetransmission queues the retransmittable frames of the packet.
+func (this *SentPacketHandler) queueRetransmission(p *SentPacket) {
+	if p == this.probe {
+		this.probe = nil
+	}
+	if p.MTUProbe {
+		return
+	}
+	for _, f := range p.Frames {
+		if protocol.IsRetransmittable([]protocol.Frame{f}) {
+			this.retransmissions = append(this.retransmissions, f)
+		}
+	}
+}
+
+// GetLossTimeout returns the time when OnLossTimeout must be called, or the zero time if no packet waits for the time threshold.
+func (this *SentPacketHandler) GetLossTimeout() time.Time {
+	return this.lossTime
+}
+
+// OnLossTimeout declares lost the packets that have reached the time threshold.
+func (this *SentPacketHandler) OnLossTimeout(now time.Time) {
+	this.detectLosses(now)
+}
+
+// GetAlarmTimeout returns the time when OnAlarm must be called, or the zero time if no retransmittable packet is in flight.
+//
+// The single alarm of the connection is the loss timer if a packet waits for the time threshold, then TLP_MAX_PROBES tail loss probes,
+// then the retransmission timeout with exponential backoff, all from the send time of the last retransmittable packet.
+func (this *SentPacketHandler) GetAlarmTimeout() time.Time {
+	if !this.lossTime.IsZero() {
+		return this.lossTime
+	}
+	last := this.lastRetransmittablePacket()
+	if last == nil {
+		return time.Time{}
+	}
+	if this.tlpCount < TLP_MAX_PROBES {
+		return last.SentTime.Add(this.getTLPDelay())
+	}
+	return last.SentTime.Add(this.GetRetransmissionTimeout())
+}
+
+// OnAlarm declares lost the packets of the time threshold, or sends a tail loss probe, or retransmits on retransmission timeout.
+func (this *SentPacketHandler) OnAlarm(now time.Time) {
+	switch {
+	case !this.lossTime.IsZero():
+		this.detectLosses(now)
+	case this.lastRetransmittablePacket() == nil:
+	case this.tlpCount < TLP_MAX_PROBES:
+		// Tail loss probe: the last packet is sent again to trigger an ACK, it stays in flight
+		this.tlpCount++
+		this.probePackets = 1
+		this.probe = this.lastRetransmittablePacket()
+	default:
+		// Retransmission timeout: the two oldest retransmittable packets are lost
+		this.rtoCount++
+		this.probePackets = 2
+		this.probe = nil
+		remaining := this.packets[:0]
+		n := 0
+		for _, p := range this.packets {
+			if p.Retransmittable && n < 2 {
+				if this.onLost != nil {
+					this.onLost(p)
+				}
+				this.bytesInFlight -= p.Length
+				this.queueRetransmission(p)
+				n++
+				continue
+			}
+			remaining = append(remaining, p)
+		}
+		for i := len(remaining); i < len(this.packets); i++ {
+			this.packets[i] = nil
+		}
+		this.packets = remaining
+		if this.sendAlgorithm != nil {
+			this.sendAlgorithm.OnRetransmissionTimeout(n > 0)
+		}
+	}
+}
+
+// RetransmitPackets queues the retransmittable frames of the packets in flight at the encryption level, as the peer can't open them:
+// the initial keys of a 0-RTT flight were rejected. They are no longer in flight, without loss signal to the congestion control.
+func (this *SentPacketHandler) RetransmitPackets(level protocol.EncryptionLevel) {
+	remaining := this.packets[:0]
+	for _, p := range this.packets {
+		if p.EncryptionLevel != level {
+			remaining = append(remaining, p)
+			continue
+		}
+		if p.Retransmittable {
+			this.bytesInFlight -= p.Length
+			this.queueRetransmission(p)
+		}
+	}
+	for i := len(remaining); i < len(this.packets); i++ {
+		this.packets[i] = nil
+	}
+	this.packets = remaining
+}
+
+// GetRetransmissionTimeout returns the retransmission timeout: smoothed RTT + 4 * mean deviation, at least RTO_MIN,
+// doubled at each consecutive timeout up to RTO_MAX.
+func (this *SentPacketHandler) GetRetransmissionTimeout() time.Duration {
+	rto := RTO_DEFAULT
+	if srtt := this.rttStats.SmoothedRTT(); srtt > 0 {
+		rto = srtt + 4*this.rttStats.MeanDeviation()
+	}
+	if rto < RTO_MIN {
+		rto = RTO_MIN
+	}
+	for i := 0; i < this.rtoCount && rto < RTO_MAX; i++ {
+		rto <<= 1
+	}
+	if rto > RTO_MAX {
+		rto = RTO_MAX
+	}
+	return rto
+}
+
+// getTLPDelay returns the delay of a tail loss probe: twice the smoothed RTT, and the delayed ACK timeout of the peer is added
+// when a single packet is in flight.
+func (this *SentPacketHandler) getTLPDelay() time.Duration {
+	srtt := this.rttStats.SmoothedRTT()
+	if srtt == 0 {
+		srtt = LOSS_DEFAULT_RTT
+	}
+	delay := 2 * srtt
+	if this.bytesInFlight == this.lastRetransmittablePacket().Length {
+		if d := srtt*3/2 + ACK_DELAYED_TIMEOUT; d > delay {
+			delay = d
+		}
+	}
+	if delay < TLP_MIN_DELAY {
+		delay = TLP_MIN_DELAY
+	}
+	return delay
+}
+
+// lastRetransmittablePacket returns the newest retransmittable packet in flight, or nil.
+func (this *SentPacketHandler) lastRetransmittablePacket() *SentPacket {
+	for i := len(this.packets) - 1; i >= 0; i-- {
+		if this.packets[i].Retransmittable {
+			return this.packets[i]
+		}
+	}
+	return nil
+}
+
+// DequeueRetransmissions returns the frames of the lost packets and of the pending tail loss probe, that the packer must send again.
+func (this *SentPacketHandler) DequeueRetransmissions() []protocol.Frame {
+	frames := this.retransmissions
+	this.retransmissions = nil
+	if this.probe != nil {
+		for _, f := range this.probe.Frames {
+			if protocol.IsRetransmittable([]protocol.Frame{f}) {
+				frames = append(frames, f)
+			}
+		}
+		this.probe = nil
+	}
+	return frames
+}
+
+// IsInFlight returns true if the packet is neither acknowledged nor lost.
+func (this *SentPacketHandler) IsInFlight(seqnum protocol.QuicPacketSequenceNumber) bool {
+	for _, p := range this.packets {
+		if p.SequenceNumber == seqnum {
+			return true
+		}
+	}
+	return false
+}
+
+// BytesInFlight returns the number of bytes of the retransmittable packets not acknowledged nor lost.
+func (this *SentPacketHandler) BytesInFlight() int {
+	return this.bytesInFlight
+}
+
+// GetLargestAcked returns the largest sequence number acknowledged by the peer, used to truncate the sequence numbers.
+func (this *SentPacketHandler) GetLargestAcked() protocol.QuicPacketSequenceNumber {
+	return this.largestAcked
+}
+
+// GetRTTStats returns the RTT statistics updated by the ACK frames.
+func (this *SentPacketHandler) GetRTTStats() *congestion.RTTStats {
+	return this.rttStats
+}
+
+// GetLeastUnacked returns the smallest sequence number not acknowledged nor lost.
+func (this *SentPacketHandler) GetLeastUnacked() protocol.QuicPacketSequenceNumber {
+	if len(this.packets) > 0 {
+		return this.packets[0].SequenceNumber
+	}
+	return this.largestSent + 1
+}
+
+// GetStopWaitingFrame returns the STOP_WAITING frame to send in the packet with the sequence number and its size.
+func (this *SentPacketHandler) GetStopWaitingFrame(seqnum protocol.QuicPacketSequenceNumber, seqnumSize int) *protocol.StopWaitingFrame {
+	return protocol.NewStopWaitingFrame(this.GetLeastUnacked(), seqnum, seqnumSize)
+}
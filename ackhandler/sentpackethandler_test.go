@@ -0,0 +1,314 @@
+package ackhandler
+
+import "github.com/romain-jacotin/quic/congestion"
+import "github.com/romain-jacotin/quic/protocol"
+import "testing"
+import "time"
+
+// sendTestPackets records the retransmittable packets from the first to the last sequence number, each with a STREAM frame.
+func sendTestPackets(handler *SentPacketHandler, first, last protocol.QuicPacketSequenceNumber, sent time.Time) {
+	for seqnum := first; seqnum <= last; seqnum++ {
+		handler.SentPacket(&SentPacket{
+			SequenceNumber:  seqnum,
+			Frames:          []protocol.Frame{&protocol.StreamFrame{StreamID: 5, Offset: protocol.QuicByteOffset(seqnum)}},
+			Length:          100,
+			SentTime:        sent,
+			Retransmittable: true})
+	}
+}
+
+// ackFrame returns an ACK frame of the ranges given as smallest and largest pairs, in descending order.
+func ackFrame(ranges ...protocol.QuicPacketSequenceNumber) *protocol.AckFrame {
+	f := &protocol.AckFrame{LargestAcked: ranges[1]}
+	for i := 0; i < len(ranges); i += 2 {
+		f.Ranges = append(f.Ranges, protocol.AckRange{Smallest: ranges[i], Largest: ranges[i+1]})
+	}
+	return f
+}
+
+func Test_SentPacketHandler_OutOfOrderAcks(t *testing.T) {
+	now := time.Now()
+	handler := NewSentPacketHandler(nil)
+	sendTestPackets(handler, 1, 6, now)
+	if handler.BytesInFlight() != 600 {
+		t.Errorf("SentPacketHandler.BytesInFlight : 600 expected instead of %v", handler.BytesInFlight())
+	}
+	acked, err := handler.ReceivedAck(ackFrame(1, 4), now.Add(50*time.Millisecond))
+	if err != nil || len(acked) != 4 || handler.BytesInFlight() != 200 || handler.GetRTTStats().LatestRTT() != 50*time.Millisecond {
+		t.Errorf("SentPacketHandler.ReceivedAck : 4 packets acked expected instead of %v (%v)", len(acked), err)
+	}
+	// Older ACK received after a newer one
+	acked, err = handler.ReceivedAck(ackFrame(1, 2), now.Add(80*time.Millisecond))
+	if err != nil || len(acked) != 0 || handler.BytesInFlight() != 200 || handler.GetRTTStats().LatestRTT() != 50*time.Millisecond {
+		t.Errorf("SentPacketHandler.ReceivedAck : reordered ACK must not change the state, %v acked (%v)", len(acked), err)
+	}
+	if handler.GetLargestAcked() != 4 || handler.GetLeastUnacked() != 5 {
+		t.Errorf("SentPacketHandler : invalid largest acked %v or least unacked %v", handler.GetLargestAcked(), handler.GetLeastUnacked())
+	}
+	if _, err = handler.ReceivedAck(ackFrame(7, 7), now); err != ErrAckForUnsentPacket {
+		t.Errorf("SentPacketHandler.ReceivedAck : ErrAckForUnsentPacket expected instead of %v", err)
+	}
+	if err = handler.SentPacket(&SentPacket{SequenceNumber: 6}); err == nil {
+		t.Error("SentPacketHandler.SentPacket : decreasing sequence number must be rejected")
+	}
+}
+
+func Test_SentPacketHandler_Losses(t *testing.T) {
+	var lost []protocol.QuicPacketSequenceNumber
+
+	now := time.Now()
+	handler := NewSentPacketHandler(nil)
+	handler.SetLossCallback(func(p *SentPacket) { lost = append(lost, p.SequenceNumber) })
+	sendTestPackets(handler, 1, 5, now)
+	handler.SentPacket(&SentPacket{SequenceNumber: 6, Frames: []protocol.Frame{&protocol.AckFrame{LargestAcked: 1}}, Length: 30, SentTime: now})
+
+	// Fast retransmit: 1 and 2 are 3 packets below 5, 3 and 4 wait for the time threshold
+	acked, err := handler.ReceivedAck(ackFrame(5, 5), now.Add(10*time.Millisecond))
+	if err != nil || len(acked) != 1 || handler.BytesInFlight() != 200 {
+		t.Fatalf("SentPacketHandler.ReceivedAck : invalid acked packets %v, bytes in flight %v (%v)", len(acked), handler.BytesInFlight(), err)
+	}
+	frames := handler.DequeueRetransmissions()
+	if len(frames) != 2 || frames[0].(*protocol.StreamFrame).Offset != 1 || frames[1].(*protocol.StreamFrame).Offset != 2 {
+		t.Errorf("SentPacketHandler.DequeueRetransmissions : frames of packets 1 and 2 expected instead of %v", frames)
+	}
+	if len(handler.DequeueRetransmissions()) != 0 {
+		t.Error("SentPacketHandler.DequeueRetransmissions : queue must be empty")
+	}
+	if handler.GetLossTimeout() != now.Add(10*time.Millisecond*9/8) {
+		t.Errorf("SentPacketHandler.GetLossTimeout : invalid loss timeout %v", handler.GetLossTimeout().Sub(now))
+	}
+
+	// Time threshold
+	handler.OnLossTimeout(now.Add(20 * time.Millisecond))
+	if frames = handler.DequeueRetransmissions(); len(frames) != 2 || handler.BytesInFlight() != 0 || !handler.GetLossTimeout().IsZero() {
+		t.Errorf("SentPacketHandler.OnLossTimeout : frames of packets 3 and 4 expected instead of %v", frames)
+	}
+
+	// ACK covering packets already declared lost, and the non retransmittable packet 6
+	acked, err = handler.ReceivedAck(ackFrame(1, 6), now.Add(30*time.Millisecond))
+	if err != nil || len(acked) != 1 || acked[0].SequenceNumber != 6 || handler.BytesInFlight() != 0 || len(handler.DequeueRetransmissions()) != 0 {
+		t.Errorf("SentPacketHandler.ReceivedAck : only packet 6 expected, %v acked (%v)", len(acked), err)
+	}
+	if len(lost) != 4 || lost[0] != 1 || lost[3] != 4 {
+		t.Errorf("SentPacketHandler.SetLossCallback : packets 1 to 4 lost expected instead of %v", lost)
+	}
+}
+
+func Test_SentPacketHandler_Truncation(t *testing.T) {
+	now := time.Now()
+	handler := NewSentPacketHandler(nil)
+	sendTestPackets(handler, 1, 300, now)
+
+	// Without ACK, the sequence number 301 needs 2 bytes
+	if size, _ := protocol.TruncateSequenceNumber(301, handler.GetLargestAcked()); size != 2 {
+		t.Errorf("TruncateSequenceNumber : 2 bytes expected instead of %v", size)
+	}
+	handler.ReceivedAck(ackFrame(290, 300), now.Add(10*time.Millisecond))
+	size, truncated := protocol.TruncateSequenceNumber(301, handler.GetLargestAcked())
+	if size != 1 || protocol.InferSequenceNumber(truncated, size, 300) != 301 {
+		t.Errorf("TruncateSequenceNumber : 1 byte expected instead of %v", size)
+	}
+
+	// STOP_WAITING of the packet 301: all the packets below 290 are lost, nothing is unacked
+	sw := handler.GetStopWaitingFrame(301, size)
+	if sw.LeastUnackedDelta != 0 || sw.GetLeastUnacked(301) != 301 {
+		t.Errorf("SentPacketHandler.GetStopWaitingFrame : invalid least unacked %v", sw.GetLeastUnacked(301))
+	}
+	sendTestPackets(handler, 301, 302, now)
+	if sw = handler.GetStopWaitingFrame(303, size); sw.GetLeastUnacked(303) != 301 {
+		t.Errorf("SentPacketHandler.GetStopWaitingFrame : invalid least unacked %v", sw.GetLeastUnacked(303))
+	}
+}
+
+func Test_SentPacketHandler_SendAlgorithm(t *testing.T) {
+	now := time.Now()
+	handler := NewSentPacketHandler(nil)
+	sender := congestion.NewCubicSender(handler.GetRTTStats(), 4, congestion.MAX_CONGESTION_WINDOW)
+	handler.SetSendAlgorithm(sender)
+
+	var seqnum protocol.QuicPacketSequenceNumber
+	for handler.TimeUntilSend(now) == 0 {
+		seqnum++
+		handler.SentPacket(&SentPacket{SequenceNumber: seqnum, Length: congestion.MAX_SEGMENT_SIZE, SentTime: now, Retransmittable: true})
+	}
+	if seqnum != 4 {
+		t.Errorf("SentPacketHandler.TimeUntilSend : 4 packets expected in the initial window instead of %v", seqnum)
+	}
+	// Packet 1 lost by the reordering threshold, packets 2 to 4 acknowledged
+	if _, err := handler.ReceivedAck(ackFrame(2, 4), now.Add(100*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	window := float64(4 * congestion.MAX_SEGMENT_SIZE)
+	if !sender.InRecovery() || sender.GetCongestionWindow() != int(congestion.CUBIC_BETA*window) || handler.TimeUntilSend(now) != 0 {
+		t.Errorf("SentPacketHandler.ReceivedAck : loss expected in the congestion control, window %v", sender.GetCongestionWindow())
+	}
+}
+
+func Test_SentPacketHandler_MTUProbe(t *testing.T) {
+	now := time.Now()
+	handler := NewSentPacketHandler(nil)
+	sender := congestion.NewCubicSender(handler.GetRTTStats(), 10, congestion.MAX_CONGESTION_WINDOW)
+	handler.SetSendAlgorithm(sender)
+	handler.SentPacket(&SentPacket{SequenceNumber: 1, Frames: []protocol.Frame{&protocol.PingFrame{}, &protocol.PaddingFrame{Size: 100}},
+		Length: 1500, SentTime: now, Retransmittable: true, MTUProbe: true})
+	sendTestPackets(handler, 2, 5, now)
+	if !handler.IsInFlight(1) || handler.BytesInFlight() != 1900 {
+		t.Errorf("SentPacketHandler.SentPacket : the MTU probe must be in flight, %v bytes in flight", handler.BytesInFlight())
+	}
+
+	// The MTU probe is lost by the reordering threshold: no loss for the congestion control, nothing to retransmit
+	window := sender.GetCongestionWindow()
+	if _, err := handler.ReceivedAck(ackFrame(2, 5), now.Add(10*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if handler.IsInFlight(1) || handler.BytesInFlight() != 0 {
+		t.Errorf("SentPacketHandler.ReceivedAck : the MTU probe must be lost, %v bytes in flight", handler.BytesInFlight())
+	}
+	if sender.InRecovery() || sender.GetCongestionWindow() < window {
+		t.Errorf("SentPacketHandler.ReceivedAck : the loss of the MTU probe must not reduce the congestion window %v", sender.GetCongestionWindow())
+	}
+	if frames := handler.DequeueRetransmissions(); len(frames) != 0 {
+		t.Errorf("SentPacketHandler.DequeueRetransmissions : the MTU probe must not be retransmitted, %v frames", len(frames))
+	}
+}
+
+func Test_SentPacketHandler_RetransmissionTimeout(t *testing.T) {
+	now := time.Now()
+	handler := NewSentPacketHandler(nil)
+	sender := congestion.NewCubicSender(handler.GetRTTStats(), 10, congestion.MAX_CONGESTION_WINDOW)
+	handler.SetSendAlgorithm(sender)
+	sendTestPackets(handler, 1, 3, now)
+
+	// Two tail loss probes without RTT sample: 2 * LOSS_DEFAULT_RTT after the last packet, the probe is the last packet
+	for i, seqnum := range []protocol.QuicPacketSequenceNumber{4, 5} {
+		alarm := handler.GetAlarmTimeout()
+		if alarm != now.Add(200*time.Millisecond) {
+			t.Fatalf("SentPacketHandler.GetAlarmTimeout : tail loss probe expected at 200ms instead of %v in test n°%v", alarm.Sub(now), i)
+		}
+		handler.OnAlarm(alarm)
+		frames := handler.DequeueRetransmissions()
+		if len(frames) != 1 || frames[0].(*protocol.StreamFrame).Offset != protocol.QuicByteOffset(seqnum-1) || handler.BytesInFlight() != int(seqnum-1)*100 {
+			t.Errorf("SentPacketHandler.OnAlarm : frames of the last packet expected instead of %v in test n°%v", frames, i)
+		}
+		now = alarm
+		sendTestPackets(handler, seqnum, seqnum, now)
+	}
+
+	// Back to back retransmission timeouts with exponential backoff: the two oldest packets are retransmitted
+	for i, rto := range []time.Duration{RTO_DEFAULT, 2 * RTO_DEFAULT, 4 * RTO_DEFAULT} {
+		alarm := handler.GetAlarmTimeout()
+		if alarm != now.Add(rto) {
+			t.Fatalf("SentPacketHandler.GetAlarmTimeout : retransmission timeout expected after %v instead of %v in test n°%v", rto, alarm.Sub(now), i)
+		}
+		inFlight := handler.BytesInFlight()
+		handler.OnAlarm(alarm)
+		frames := handler.DequeueRetransmissions()
+		if len(frames) != 2 || frames[0].(*protocol.StreamFrame).Offset != protocol.QuicByteOffset(2*i+1) || handler.BytesInFlight() != inFlight-200 {
+			t.Errorf("SentPacketHandler.OnAlarm : frames of the two oldest packets expected instead of %v in test n°%v", frames, i)
+		}
+		if sender.GetCongestionWindow() != congestion.MIN_CONGESTION_WINDOW*congestion.MAX_SEGMENT_SIZE {
+			t.Errorf("SentPacketHandler.OnAlarm : congestion window %v must collapse on retransmission timeout in test n°%v", sender.GetCongestionWindow(), i)
+		}
+		// The two probe packets are sent regardless of the congestion window
+		now = alarm
+		for j := 0; j < 2; j++ {
+			if handler.TimeUntilSend(now) != 0 {
+				t.Errorf("SentPacketHandler.TimeUntilSend : probe packet %v must be sent in test n°%v", j, i)
+			}
+			sendTestPackets(handler, handler.largestSent+1, handler.largestSent+1, now)
+		}
+	}
+
+	// The backoff is bounded
+	handler.rtoCount = 20
+	if handler.GetRetransmissionTimeout() != RTO_MAX {
+		t.Errorf("SentPacketHandler.GetRetransmissionTimeout : %v instead of RTO_MAX", handler.GetRetransmissionTimeout())
+	}
+
+	// An ACK of a new packet resets the backoff and the tail loss probes
+	handler.ReceivedAck(ackFrame(handler.largestSent, handler.largestSent), now.Add(100*time.Millisecond))
+	if handler.rtoCount != 0 || handler.tlpCount != 0 {
+		t.Errorf("SentPacketHandler.ReceivedAck : %v retransmission timeouts and %v tail loss probes instead of 0", handler.rtoCount, handler.tlpCount)
+	}
+}
+
+var tests_retransmissiontimeout = []struct {
+	rtt time.Duration
+	rto time.Duration
+	tlp time.Duration // single packet in flight
+}{
+	{0, RTO_DEFAULT, 200 * time.Millisecond},
+	{100 * time.Millisecond, 300 * time.Millisecond, 200 * time.Millisecond},
+	{10 * time.Millisecond, RTO_MIN, 40 * time.Millisecond},
+	{20 * time.Millisecond, RTO_MIN, 55 * time.Millisecond},
+}
+
+func Test_SentPacketHandler_AlarmDelays(t *testing.T) {
+	for i, v := range tests_retransmissiontimeout {
+		now := time.Now()
+		handler := NewSentPacketHandler(nil)
+		if v.rtt > 0 {
+			handler.GetRTTStats().UpdateRTT(v.rtt, 0)
+		}
+		if rto := handler.GetRetransmissionTimeout(); rto != v.rto {
+			t.Errorf("SentPacketHandler.GetRetransmissionTimeout : %v instead of %v in test n°%v", rto, v.rto, i)
+		}
+		sendTestPackets(handler, 1, 1, now)
+		if alarm := handler.GetAlarmTimeout(); alarm != now.Add(v.tlp) {
+			t.Errorf("SentPacketHandler.GetAlarmTimeout : tail loss probe after %v instead of %v in test n°%v", alarm.Sub(now), v.tlp, i)
+		}
+	}
+}
+
+func Test_SentPacketHandler_TailLossProbeCanceled(t *testing.T) {
+	now := time.Now()
+	handler := NewSentPacketHandler(nil)
+	sendTestPackets(handler, 1, 2, now)
+
+	// Late ACK before the alarm: nothing in flight, no alarm
+	alarm := handler.GetAlarmTimeout()
+	handler.ReceivedAck(ackFrame(1, 2), alarm.Add(-time.Millisecond))
+	if !handler.GetAlarmTimeout().IsZero() {
+		t.Errorf("SentPacketHandler.GetAlarmTimeout : no alarm expected instead of %v", handler.GetAlarmTimeout())
+	}
+
+	// Late ACK after the alarm: the probe of the acknowledged packet is canceled
+	now = alarm
+	sendTestPackets(handler, 3, 4, now)
+	alarm = handler.GetAlarmTimeout()
+	handler.OnAlarm(alarm)
+	if handler.tlpCount != 1 || handler.TimeUntilSend(alarm) != 0 {
+		t.Fatal("SentPacketHandler.OnAlarm : tail loss probe expected")
+	}
+	handler.ReceivedAck(ackFrame(4, 4), alarm.Add(time.Millisecond))
+	if frames := handler.DequeueRetransmissions(); len(frames) != 0 {
+		t.Errorf("SentPacketHandler.DequeueRetransmissions : tail loss probe must be canceled by the ACK, %v frames", len(frames))
+	}
+	if handler.tlpCount != 0 || handler.GetAlarmTimeout().IsZero() {
+		t.Error("SentPacketHandler.ReceivedAck : the ACK must rearm the alarm with a new tail loss probe")
+	}
+}
+
+func Test_SentPacketHandler_RetransmitPackets(t *testing.T) {
+	now := time.Now()
+	handler := NewSentPacketHandler(nil)
+	sendTestPackets(handler, 1, 2, now)
+	handler.SentPacket(&SentPacket{SequenceNumber: 3, Frames: []protocol.Frame{&protocol.StreamFrame{StreamID: 5, Offset: 3}},
+		Length: 100, SentTime: now, EncryptionLevel: protocol.ENCRYPTION_INITIAL, Retransmittable: true})
+	handler.SentPacket(&SentPacket{SequenceNumber: 4, Frames: []protocol.Frame{&protocol.AckFrame{LargestAcked: 1}},
+		Length: 30, SentTime: now, EncryptionLevel: protocol.ENCRYPTION_INITIAL})
+	sendTestPackets(handler, 5, 5, now)
+
+	// The packets of the rejected initial keys are retransmitted at once, the others stay in flight
+	handler.RetransmitPackets(protocol.ENCRYPTION_INITIAL)
+	frames := handler.DequeueRetransmissions()
+	if len(frames) != 1 || frames[0].(*protocol.StreamFrame).Offset != 3 {
+		t.Errorf("SentPacketHandler.RetransmitPackets : frame of packet 3 expected instead of %v", frames)
+	}
+	if handler.BytesInFlight() != 300 || handler.GetLeastUnacked() != 1 {
+		t.Errorf("SentPacketHandler.RetransmitPackets : 300 bytes in flight expected instead of %v", handler.BytesInFlight())
+	}
+	if acked, err := handler.ReceivedAck(ackFrame(1, 5), now.Add(10*time.Millisecond)); err != nil || len(acked) != 3 {
+		t.Errorf("SentPacketHandler.ReceivedAck : packets 1, 2 and 5 expected instead of %v (%v)", len(acked), err)
+	}
+}
@@ -0,0 +1,65 @@
+// Package adapters publishes the Metrics of a quic.Listener with expvar and in the Prometheus text format,
+// so that the quic package doesn't depend on the monitoring libraries.
+//
+// A Prometheus client Collector can also read the Metrics: Each gives the name, the help, the kind and the label of each value.
+package adapters
+
+import "github.com/romain-jacotin/quic"
+import "bufio"
+import "expvar"
+import "fmt"
+import "io"
+import "net/http"
+import "strconv"
+import "strings"
+
+// PROMETHEUS_CONTENT_TYPE is the content type of the Prometheus text format written by WritePrometheus.
+const PROMETHEUS_CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// Expvar returns the expvar.Var of the metrics, a JSON object of their current values by name, with the label value
+// in braces: expvar.Publish("quic", adapters.Expvar(listener.Metrics())) publishes them on /debug/vars.
+func Expvar(metrics quic.Metrics) expvar.Var {
+	return expvar.Func(func() interface{} {
+		values := make(map[string]float64)
+		metrics.Each(func(m quic.Metric) {
+			values[metricName(m)] = m.Value
+		})
+		return values
+	})
+}
+
+// WritePrometheus writes the current values of the metrics in the Prometheus text format.
+func WritePrometheus(w io.Writer, metrics quic.Metrics) error {
+	bw := bufio.NewWriter(w)
+	last := ""
+	metrics.Each(func(m quic.Metric) {
+		// The HELP and TYPE lines once per name, before its first value
+		if m.Name != last {
+			kind := "counter"
+			if m.Kind == quic.METRIC_GAUGE {
+				kind = "gauge"
+			}
+			fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", m.Name, m.Help, m.Name, kind)
+			last = m.Name
+		}
+		fmt.Fprintf(bw, "%s %s\n", metricName(m), strconv.FormatFloat(m.Value, 'g', -1, 64))
+	})
+	return bw.Flush()
+}
+
+// PrometheusHandler returns the http.Handler of the metrics for a Prometheus server: http.Handle("/metrics", adapters.PrometheusHandler(listener.Metrics())).
+func PrometheusHandler(metrics quic.Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", PROMETHEUS_CONTENT_TYPE)
+		WritePrometheus(w, metrics)
+	})
+}
+
+// metricName returns the name of the metric, followed by its label in braces if it has one.
+func metricName(m quic.Metric) string {
+	if m.LabelName == "" {
+		return m.Name
+	}
+	value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(m.LabelValue)
+	return fmt.Sprintf("%s{%s=\"%s\"}", m.Name, m.LabelName, value)
+}
@@ -0,0 +1,60 @@
+package adapters_test
+
+import "github.com/romain-jacotin/quic"
+import "github.com/romain-jacotin/quic/adapters"
+import "expvar"
+import "log"
+import "net"
+import "net/http"
+import "os"
+
+// staticMetrics are the metrics of a Listener that has accepted 3 sessions and failed 1 handshake.
+type staticMetrics []quic.Metric
+
+func (this staticMetrics) Each(f func(m quic.Metric)) {
+	for _, m := range this {
+		f(m)
+	}
+}
+
+var exampleMetrics = staticMetrics{
+	{Name: "quic_listener_active_connections", Help: "Sessions of the Listener not closed yet.", Kind: quic.METRIC_GAUGE, Value: 3},
+	{Name: "quic_listener_handshake_failures_total", Help: "Handshakes failed, by error code.", Kind: quic.METRIC_COUNTER,
+		LabelName: "reason", LabelValue: "QUIC_HANDSHAKE_TIMEOUT", Value: 1},
+	{Name: "quic_listener_bytes_sent_total", Help: "Bytes of the packets sent.", Kind: quic.METRIC_COUNTER, Value: 123456},
+}
+
+// The metrics of a Listener on /debug/vars with expvar, and on /metrics for a Prometheus server.
+func Example() {
+	pc, err := net.ListenPacket("udp", "localhost:4433")
+	if err != nil {
+		log.Fatal(err)
+	}
+	l, err := quic.Listen(pc, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	expvar.Publish("quic", adapters.Expvar(l.Metrics()))
+	http.Handle("/metrics", adapters.PrometheusHandler(l.Metrics()))
+	go http.ListenAndServe("localhost:8080", nil)
+}
+
+func ExampleWritePrometheus() {
+	adapters.WritePrometheus(os.Stdout, exampleMetrics)
+	// Output:
+	// # HELP quic_listener_active_connections Sessions of the Listener not closed yet.
+	// # TYPE quic_listener_active_connections gauge
+	// quic_listener_active_connections 3
+	// # HELP quic_listener_handshake_failures_total Handshakes failed, by error code.
+	// # TYPE quic_listener_handshake_failures_total counter
+	// quic_listener_handshake_failures_total{reason="QUIC_HANDSHAKE_TIMEOUT"} 1
+	// # HELP quic_listener_bytes_sent_total Bytes of the packets sent.
+	// # TYPE quic_listener_bytes_sent_total counter
+	// quic_listener_bytes_sent_total 123456
+}
+
+func ExampleExpvar() {
+	os.Stdout.WriteString(adapters.Expvar(exampleMetrics).String() + "\n")
+	// Output:
+	// {"quic_listener_active_connections":3,"quic_listener_bytes_sent_total":123456,"quic_listener_handshake_failures_total{reason=\"QUIC_HANDSHAKE_TIMEOUT\"}":1}
+}
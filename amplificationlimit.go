@@ -0,0 +1,40 @@
+package quic
+
+// amplificationLimit keeps a server from being a reflector of the packets of an attacker that spoofs the address of its victim:
+// until the address of the client is validated, the server sends at most AMPLIFICATION_FACTOR times the bytes received from there.
+//
+// It is owned by the run goroutine, then by the linger goroutine of the closed session.
+type amplificationLimit struct {
+	validated bool
+	received  int
+	sent      int
+}
+
+// newAmplificationLimit returns the limit of an unvalidated address, or no limit if validated is true.
+func newAmplificationLimit(validated bool) *amplificationLimit {
+	return &amplificationLimit{validated: validated}
+}
+
+// Validate removes the limit once the address of the client is validated.
+func (this *amplificationLimit) Validate() {
+	this.validated = true
+}
+
+// OnReceived counts a datagram received from the address, decryptable or not.
+func (this *amplificationLimit) OnReceived(size int) {
+	if !this.validated {
+		this.received += size
+	}
+}
+
+// OnSent counts a datagram sent to the address.
+func (this *amplificationLimit) OnSent(size int) {
+	if !this.validated {
+		this.sent += size
+	}
+}
+
+// CanSend returns true if a datagram of the size can be sent to the address.
+func (this *amplificationLimit) CanSend(size int) bool {
+	return this.validated || this.sent+size <= AMPLIFICATION_FACTOR*this.received
+}
@@ -0,0 +1,36 @@
+package quic
+
+import "testing"
+
+func Test_AmplificationLimit(t *testing.T) {
+	// Nothing is sent before a datagram is received
+	limit := newAmplificationLimit(false)
+	if limit.CanSend(1) {
+		t.Errorf("amplificationLimit.CanSend : no datagram expected before a datagram is received")
+	}
+
+	// Three times the bytes received
+	limit.OnReceived(1000)
+	if !limit.CanSend(3000) || limit.CanSend(3001) {
+		t.Errorf("amplificationLimit.CanSend : 3000 bytes expected for 1000 bytes received")
+	}
+	limit.OnSent(MAX_PACKET_SIZE)
+	limit.OnSent(MAX_PACKET_SIZE)
+	if limit.CanSend(MAX_PACKET_SIZE) || !limit.CanSend(3000-2*MAX_PACKET_SIZE) {
+		t.Errorf("amplificationLimit.CanSend : %v bytes expected after two packets", 3000-2*MAX_PACKET_SIZE)
+	}
+	limit.OnReceived(500)
+	if !limit.CanSend(MAX_PACKET_SIZE) {
+		t.Errorf("amplificationLimit.CanSend : a new datagram received must allow a packet")
+	}
+
+	// No limit once the address is validated
+	limit.Validate()
+	limit.OnSent(1 << 20)
+	if !limit.CanSend(1 << 20) {
+		t.Errorf("amplificationLimit.Validate : no limit expected once the address is validated")
+	}
+	if limit = newAmplificationLimit(true); !limit.CanSend(1 << 20) {
+		t.Errorf("amplificationLimit.CanSend : no limit expected for a validated address")
+	}
+}
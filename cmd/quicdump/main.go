@@ -0,0 +1,189 @@
+// Command quicdump prints the QUIC packets of a pcap file, or of hexadecimal lines, with protocol.DecodePacketForDebug.
+//
+// Usage:
+//
+//	quicdump [-keylog file] [-port n] [file]
+//
+// The input is the file, or the standard input, read as a pcap file if it starts with a pcap magic number, and else as
+// one datagram per line in hexadecimal: the empty lines and the lines starting with # are ignored. The UDP datagrams of the
+// pcap file are decoded if their source or destination port is the port (0 for all ports).
+//
+// The key log file is written by a client or a server with the KeyLogWriter of its quic.Config: the frames of the packets
+// are listed if the keys of their connection are found in it.
+package main
+
+import "github.com/romain-jacotin/quic/crypto"
+import "github.com/romain-jacotin/quic/protocol"
+import "bufio"
+import "bytes"
+import "encoding/hex"
+import "flag"
+import "fmt"
+import "io"
+import "os"
+import "strconv"
+import "strings"
+
+func main() {
+	keyLog := flag.String("keylog", "", "key log file of the connections")
+	port := flag.Int("port", 0, "UDP port of the QUIC packets in the pcap file, 0 for all ports")
+	flag.Parse()
+
+	keys := newDumpKeys()
+	if *keyLog != "" {
+		f, err := os.Open(*keyLog)
+		if err != nil {
+			fatal(err)
+		}
+		err = keys.readKeyLog(f)
+		f.Close()
+		if err != nil {
+			fatal(err)
+		}
+	}
+	in := io.Reader(os.Stdin)
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	r := bufio.NewReader(in)
+	magic, _ := r.Peek(4)
+	var err error
+	if isPcap(magic) {
+		err = readPcap(r, uint16(*port), func(info string, b []byte) { dump(os.Stdout, info, b, keys) })
+	} else {
+		err = readHexLines(r, func(info string, b []byte) { dump(os.Stdout, info, b, keys) })
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "quicdump:", err)
+	os.Exit(1)
+}
+
+// dump writes the decoded packet after its information line, and the error if the packet is not fully decoded.
+func dump(w io.Writer, info string, b []byte, keys *dumpKeys) {
+	s, err := protocol.DecodePacketForDebug(b, keys.lookup(b))
+	fmt.Fprintf(w, "%s\n%s", info, s)
+	if err != nil {
+		fmt.Fprintf(w, "  error: %v\n", err)
+	}
+	fmt.Fprintln(w)
+}
+
+// dumpKeys are the keys of the key log by connection ID, with the null AEAD of the unencrypted packets.
+type dumpKeys struct {
+	connections map[protocol.QuicConnectionID]*protocol.DebugKeys
+	// all are the keys of all the connections, for the packets without connection ID
+	all *protocol.DebugKeys
+}
+
+func newDumpKeys() *dumpKeys {
+	null := protocol.DebugOpener{Label: "unencrypted", Opener: crypto.NewAEAD_NullFNV1A128()}
+	return &dumpKeys{
+		connections: make(map[protocol.QuicConnectionID]*protocol.DebugKeys),
+		all:         &protocol.DebugKeys{Openers: []protocol.DebugOpener{null}}}
+}
+
+// lookup returns the keys of the connection of the packet, or the keys of all the connections if its connection ID is
+// omitted or unknown.
+func (this *dumpKeys) lookup(b []byte) *protocol.DebugKeys {
+	header, _, err := protocol.ParsePublicHeader(b)
+	if err != nil || header.IsConnectionIDOmitted() {
+		return this.all
+	}
+	if keys, ok := this.connections[header.GetConnectionID()]; ok {
+		return keys
+	}
+	return this.all
+}
+
+// readKeyLog reads the lines QUIC_<CLIENT|SERVER>_<INITIAL|FORWARD_SECURE> <connection ID> <key> <IV> of a key log,
+// the other lines are ignored. The AEAD is AES-128-GCM for a 16-byte key and ChaCha20-Poly1305 for a 32-byte key.
+func (this *dumpKeys) readKeyLog(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 || !strings.HasPrefix(fields[0], "QUIC_") {
+			continue
+		}
+		label := strings.ToLower(strings.Replace(strings.TrimPrefix(fields[0], "QUIC_"), "_", " ", 1))
+		label = strings.Replace(label, "forward_secure", "forward-secure", 1)
+		connID, err := strconv.ParseUint(fields[1], 16, 64)
+		if err != nil {
+			return fmt.Errorf("key log line %v : invalid connection ID %v", n, fields[1])
+		}
+		key, err1 := hex.DecodeString(fields[2])
+		iv, err2 := hex.DecodeString(fields[3])
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("key log line %v : invalid key or IV", n)
+		}
+		tag := protocol.TagAESG
+		if len(key) == 32 {
+			tag = protocol.TagCC20
+		}
+		factory, err := crypto.LookupAEAD(uint32(tag))
+		if err != nil {
+			return err
+		}
+		aead, err := factory(key, iv)
+		if err != nil {
+			return fmt.Errorf("key log line %v : %v", n, err)
+		}
+		openers := []protocol.DebugOpener{{Label: label, Opener: aead}}
+		// The initial keys of the server logged by the client are not diversified yet
+		if fields[0] == "QUIC_SERVER_INITIAL" {
+			d, err := crypto.NewDiversifiableAEAD(factory, key, iv)
+			if err != nil {
+				return fmt.Errorf("key log line %v : %v", n, err)
+			}
+			openers = append(openers, protocol.DebugOpener{Label: label + " diversified", Opener: d})
+		}
+		keys, ok := this.connections[protocol.QuicConnectionID(connID)]
+		if !ok {
+			keys = &protocol.DebugKeys{Openers: this.all.Openers[:1:1]}
+			this.connections[protocol.QuicConnectionID(connID)] = keys
+		}
+		keys.Openers = append(keys.Openers, openers...)
+		this.all.Openers = append(this.all.Openers, openers...)
+	}
+	return scanner.Err()
+}
+
+// readHexLines calls f with the datagram of each hexadecimal line, the spaces are ignored.
+func readHexLines(r io.Reader, f func(info string, b []byte)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.Join(strings.Fields(scanner.Text()), "")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		b, err := hex.DecodeString(line)
+		if err != nil {
+			return fmt.Errorf("line %v : %v", n, err)
+		}
+		f(fmt.Sprintf("line %v", n), b)
+	}
+	return scanner.Err()
+}
+
+// isPcap returns true if the data starts with the magic number of a pcap file, in microseconds or nanoseconds.
+func isPcap(b []byte) bool {
+	if len(b) < 4 {
+		return false
+	}
+	for _, magic := range [][]byte{{0xd4, 0xc3, 0xb2, 0xa1}, {0xa1, 0xb2, 0xc3, 0xd4}, {0x4d, 0x3c, 0xb2, 0xa1}, {0xa1, 0xb2, 0x3c, 0x4d}} {
+		if bytes.Equal(b[:4], magic) {
+			return true
+		}
+	}
+	return false
+}
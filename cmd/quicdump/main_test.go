@@ -0,0 +1,87 @@
+package main
+
+import "github.com/romain-jacotin/quic/crypto"
+import "github.com/romain-jacotin/quic/protocol"
+import "bytes"
+import "encoding/binary"
+import "fmt"
+import "strings"
+import "testing"
+
+// testPacket returns a packet of the connection with a PING frame, protected with AES-128-GCM-12.
+func testPacket(t *testing.T, key, iv []byte) []byte {
+	aead, err := crypto.NewAEAD_AES128GCM12(key, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packer := protocol.NewPacketPacker(0x0102030405060708, 8, 1350)
+	packer.QueueControlFrame(&protocol.PingFrame{})
+	p, err := packer.PackPacket(aead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.Data
+}
+
+// testPcap returns a pcap file of one Ethernet frame with the UDP datagram from 10.0.0.1:4433 to 10.0.0.2:5555.
+func testPcap(payload []byte) []byte {
+	udp := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(udp[0:], 4433)
+	binary.BigEndian.PutUint16(udp[2:], 5555)
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(payload)))
+	udp = append(udp, payload...)
+	ip := []byte{0x45, 0, 0, 0, 0, 0, 0x40, 0, 64, 17, 0, 0, 10, 0, 0, 1, 10, 0, 0, 2}
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(udp)))
+	frame := append(append(make([]byte, 12), 0x08, 0x00), append(ip, udp...)...)
+
+	b := []byte{0xd4, 0xc3, 0xb2, 0xa1, 2, 0, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0, 0, LINKTYPE_ETHERNET, 0, 0, 0}
+	record := make([]byte, 16)
+	binary.LittleEndian.PutUint32(record[0:], 1500000000)
+	binary.LittleEndian.PutUint32(record[4:], 250000)
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(record[12:], uint32(len(frame)))
+	return append(append(b, record...), frame...)
+}
+
+func Test_QuicDump(t *testing.T) {
+	key, iv := bytes.Repeat([]byte{0x11}, 16), []byte{1, 2, 3, 4}
+	packet := testPacket(t, key, iv)
+	keys := newDumpKeys()
+	keyLog := fmt.Sprintf("# comment\nQUIC_CLIENT_FORWARD_SECURE 0102030405060708 %x %x\n", key, iv)
+	if err := keys.readKeyLog(strings.NewReader(keyLog)); err != nil {
+		t.Fatalf("readKeyLog : unexpected error %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := readHexLines(strings.NewReader(fmt.Sprintf("# packet\n\n%x\n", packet)), func(info string, b []byte) { dump(&out, info, b, keys) }); err != nil {
+		t.Fatalf("readHexLines : unexpected error %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "line 3\n") || !strings.Contains(out.String(), "opened with the client forward-secure keys") ||
+		!strings.Contains(out.String(), "    PING\n") {
+		t.Errorf("dump : invalid output of the hexadecimal line\n%v", out.String())
+	}
+
+	out.Reset()
+	pcap := testPcap(packet)
+	if !isPcap(pcap) || isPcap([]byte("0c08")) {
+		t.Error("isPcap : invalid detection of the pcap magic number")
+	}
+	if err := readPcap(bytes.NewReader(pcap), 4433, func(info string, b []byte) { dump(&out, info, b, keys) }); err != nil {
+		t.Fatalf("readPcap : unexpected error %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "#1 02:40:00.250000 10.0.0.1:4433 > 10.0.0.2:5555\n") || !strings.Contains(out.String(), "    PING\n") {
+		t.Errorf("dump : invalid output of the pcap file\n%v", out.String())
+	}
+
+	// Without the keys of the connection the payload is not decrypted
+	out.Reset()
+	readPcap(bytes.NewReader(pcap), 0, func(info string, b []byte) { dump(&out, info, b, newDumpKeys()) })
+	if !strings.Contains(out.String(), "not decrypted") || !strings.Contains(out.String(), "error: ") {
+		t.Errorf("dump : undecrypted payload expected\n%v", out.String())
+	}
+	out.Reset()
+	readPcap(bytes.NewReader(pcap), 443, func(info string, b []byte) { dump(&out, info, b, keys) })
+	if out.Len() != 0 {
+		t.Errorf("readPcap : datagrams of the port 443 only expected\n%v", out.String())
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import "encoding/binary"
+import "errors"
+import "fmt"
+import "io"
+import "net"
+import "time"
+
+// The link types of the pcap files read by readPcap.
+const (
+	LINKTYPE_NULL      = 0
+	LINKTYPE_ETHERNET  = 1
+	LINKTYPE_RAW       = 101
+	LINKTYPE_LINUX_SLL = 113
+	LINKTYPE_IPV4      = 228
+	LINKTYPE_IPV6      = 229
+)
+
+// errNotUDP is returned by parseUDP for the frames that are not an UDP datagram.
+var errNotUDP = errors.New("parseUDP : not an UDP datagram")
+
+// readPcap calls f with the UDP payload of each IPv4 or IPv6 packet of the pcap file from or to the port, 0 for all ports.
+// The other packets, and the IP fragments, are ignored.
+func readPcap(r io.Reader, port uint16, f func(info string, b []byte)) error {
+	var header [24]byte
+	var order binary.ByteOrder = binary.LittleEndian
+
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	if header[0] == 0xa1 {
+		order = binary.BigEndian
+	}
+	nanoseconds := order.Uint32(header[:]) == 0xa1b23c4d
+	linkType := order.Uint32(header[20:]) & 0x0fffffff
+
+	var record [16]byte
+	for n := 1; ; n++ {
+		if _, err := io.ReadFull(r, record[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		size := order.Uint32(record[8:])
+		if size > 1<<18 {
+			return fmt.Errorf("pcap record %v : invalid size %v", n, size)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		fraction := time.Duration(order.Uint32(record[4:]))
+		if !nanoseconds {
+			fraction *= time.Microsecond
+		}
+		ts := time.Unix(int64(order.Uint32(record[:])), int64(fraction)).UTC()
+
+		src, dst, payload, err := parseUDP(data, linkType)
+		if err != nil || (port != 0 && src.Port != int(port) && dst.Port != int(port)) {
+			continue
+		}
+		f(fmt.Sprintf("#%v %v %v > %v", n, ts.Format("15:04:05.000000"), src, dst), payload)
+	}
+}
+
+// parseUDP returns the addresses and the payload of the UDP datagram of the link layer frame.
+func parseUDP(b []byte, linkType uint32) (src, dst *net.UDPAddr, payload []byte, err error) {
+	// The link layer header
+	switch linkType {
+	case LINKTYPE_NULL:
+		if len(b) < 4 {
+			return nil, nil, nil, errNotUDP
+		}
+		b = b[4:]
+	case LINKTYPE_ETHERNET:
+		if len(b) < 14 {
+			return nil, nil, nil, errNotUDP
+		}
+		etherType, offset := binary.BigEndian.Uint16(b[12:]), 14
+		// 802.1Q VLAN tag
+		if etherType == 0x8100 && len(b) >= 18 {
+			etherType, offset = binary.BigEndian.Uint16(b[16:]), 18
+		}
+		if etherType != 0x0800 && etherType != 0x86dd {
+			return nil, nil, nil, errNotUDP
+		}
+		b = b[offset:]
+	case LINKTYPE_LINUX_SLL:
+		if len(b) < 16 {
+			return nil, nil, nil, errNotUDP
+		}
+		b = b[16:]
+	case LINKTYPE_RAW, LINKTYPE_IPV4, LINKTYPE_IPV6:
+	default:
+		return nil, nil, nil, fmt.Errorf("parseUDP : unsupported link type %v", linkType)
+	}
+
+	// The IP header
+	if len(b) < 1 {
+		return nil, nil, nil, errNotUDP
+	}
+	var srcIP, dstIP net.IP
+	switch b[0] >> 4 {
+	case 4:
+		ihl := int(b[0]&0x0f) * 4
+		// The fragments but the first one have no UDP header, the first one is incomplete
+		if len(b) < 20 || ihl < 20 || len(b) < ihl || b[9] != 17 || binary.BigEndian.Uint16(b[6:])&0x3fff != 0 {
+			return nil, nil, nil, errNotUDP
+		}
+		srcIP, dstIP = net.IP(b[12:16]), net.IP(b[16:20])
+		b = b[ihl:]
+	case 6:
+		if len(b) < 40 || b[6] != 17 {
+			return nil, nil, nil, errNotUDP
+		}
+		srcIP, dstIP = net.IP(b[8:24]), net.IP(b[24:40])
+		b = b[40:]
+	default:
+		return nil, nil, nil, errNotUDP
+	}
+
+	// The UDP header, the length gives the end of the payload before the padding of the link layer
+	if len(b) < 8 {
+		return nil, nil, nil, errNotUDP
+	}
+	length := int(binary.BigEndian.Uint16(b[4:]))
+	if length < 8 || length > len(b) {
+		return nil, nil, nil, errNotUDP
+	}
+	src = &net.UDPAddr{IP: srcIP, Port: int(binary.BigEndian.Uint16(b[0:]))}
+	dst = &net.UDPAddr{IP: dstIP, Port: int(binary.BigEndian.Uint16(b[2:]))}
+	return src, dst, b[8:length], nil
+}
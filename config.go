@@ -0,0 +1,294 @@
+package quic
+
+import "github.com/romain-jacotin/quic/congestion"
+import "github.com/romain-jacotin/quic/flowcontrol"
+import "github.com/romain-jacotin/quic/handshake"
+import "github.com/romain-jacotin/quic/protocol"
+import "github.com/romain-jacotin/quic/stream"
+import "crypto/x509"
+import "fmt"
+import "io"
+import "time"
+
+const (
+	// DEFAULT_SERVER_CONFIG_LIFETIME is the lifetime of the server config generated by Listen
+	DEFAULT_SERVER_CONFIG_LIFETIME = 7 * 24 * time.Hour
+	// DEFAULT_IDLE_TIMEOUT is the idle timeout proposed in the handshake (ICSL)
+	DEFAULT_IDLE_TIMEOUT = 30 * time.Second
+	// MIN_IDLE_TIMEOUT is the smallest idle timeout of a Config, the handshake sends it in seconds
+	MIN_IDLE_TIMEOUT = time.Second
+	// DEFAULT_HANDSHAKE_TIMEOUT is the time given to a session to establish its forward-secure keys
+	DEFAULT_HANDSHAKE_TIMEOUT = 10 * time.Second
+	// DEFAULT_MAX_PENDING_SESSIONS is the maximum number of sessions of a Listener in handshake at the same time
+	DEFAULT_MAX_PENDING_SESSIONS = 256
+	// MIN_PUBLIC_RESET_SECRET_SIZE is the smallest size of the secret of the public resets
+	MIN_PUBLIC_RESET_SECRET_SIZE = 16
+	// DEFAULT_PUBLIC_RESET_INTERVAL is the minimum interval between the public resets sent to a source address
+	DEFAULT_PUBLIC_RESET_INTERVAL = 100 * time.Millisecond
+	// DEFAULT_MAX_PUBLIC_RESETS_PER_SECOND is the maximum number of public resets sent by a Listener per second
+	DEFAULT_MAX_PUBLIC_RESETS_PER_SECOND = 100
+)
+
+// ErrInvalidConfig is returned by Config.Validate, and by Dial and Listen, for an invalid field of the Config.
+type ErrInvalidConfig struct {
+	Field  string
+	Reason string
+}
+
+func (this ErrInvalidConfig) Error() string {
+	return fmt.Sprintf("Config.Validate : invalid %s (%s)", this.Field, this.Reason)
+}
+
+// Config configures the sessions of Dial and Listen, a nil Config or a zero field selects the default value.
+type Config struct {
+	// Versions are the QUIC versions supported, the client proposes the first one: SupportedVersions by default
+	Versions []protocol.QuicVersion
+	// ReturnAtZeroRTT makes Dial return once the initial keys are established, before the forward-secure keys
+	ReturnAtZeroRTT bool
+	// AllowZeroRTT lets the client send stream data with the initial keys, in the flight of the full CHLO: this 0-RTT data
+	// can be replayed by an attacker and is not forward secure. By default the stream data waits for the forward-secure keys
+	AllowZeroRTT bool
+	// SessionCache keeps the server configs of the clients by hostname: the next Dial to a server sends the full CHLO at once
+	SessionCache handshake.ClientSessionCache
+	// ServerName is the hostname of the server sent in the CHLO and verified in its certificate by the client of NewSession,
+	// Dial takes it from its address and DialPacketConn from its hostname
+	ServerName string
+	// RootCAs are the certificate authorities verifying the certificate chain of the server, the system ones by default
+	RootCAs *x509.CertPool
+	// InsecureSkipVerify makes the client trust the certificate chain and the proof of any server, for the benchmarks and
+	// the tests: it is UNSAFE, an attacker can impersonate the server. It requires AllowInsecure
+	InsecureSkipVerify bool
+	// ForceNullEncryption keeps the packets protected by the NullAEAD once the keys are derived, for the benchmarks and the tests:
+	// it is UNSAFE, the packets are only protected by an FNV-1a hash and readable by anyone. Both endpoints must set it,
+	// the packets of the other one can't be opened. It requires AllowInsecure
+	ForceNullEncryption bool
+	// AllowInsecure allows InsecureSkipVerify and ForceNullEncryption, that Validate rejects otherwise so that they
+	// aren't enabled by accident in production
+	AllowInsecure bool
+	// ServerConfig gives the server configs of Listen, a *handshake.ServerConfig or a rotating *handshake.ServerConfigManager:
+	// a new server config is generated by default
+	ServerConfig handshake.ServerConfigs
+	// IdleTimeout is the idle timeout proposed to the peer, the session is closed after the smallest one without activity
+	IdleTimeout time.Duration
+	// HandshakeTimeout is the time given to a session to establish its forward-secure keys from its start, the session is
+	// closed with QUIC_HANDSHAKE_TIMEOUT after it and Dial returns an Error matching ErrHandshakeTimeout. DEFAULT_HANDSHAKE_TIMEOUT by default
+	HandshakeTimeout time.Duration
+	// NextProtos are the application protocols proposed by the client, or supported by the server in its order of preference:
+	// the server selects one in the handshake, see Session.NegotiatedProtocol, and fails the handshake with
+	// ErrNoApplicationProtocol if it supports none of those of the client
+	NextProtos []string
+	// MaxStreams is the maximum number of concurrent streams the peer can open, proposed in the handshake:
+	// the smallest one of both endpoints limits the streams of each one. DEFAULT_MAX_STREAMS by default
+	MaxStreams int
+	// MaxIncomingStreams is the maximum number of streams of the peer open at once, those waiting for AcceptStream included:
+	// the peer learns it in the handshake, the MSPC proposed is the smallest of MaxStreams and MaxIncomingStreams, and
+	// a stream beyond it closes the connection with QUIC_TOO_MANY_OPEN_STREAMS. Google QUIC has a single MSPC, it also
+	// limits the streams of the session. The streams reset by the peer before AcceptStream keep their slot until AcceptStream
+	// drains the queue below half of the limit. MaxStreams by default
+	MaxIncomingStreams int
+	// StreamFlowControlWindow is the initial receive window of the streams proposed in the handshake (SFCW), at most
+	// the ConnectionFlowControlWindow. The receive windows grow with the bandwidth-delay product up to MAX_STREAM_RECEIVE_WINDOW
+	StreamFlowControlWindow protocol.QuicByteOffset
+	// ConnectionFlowControlWindow is the initial receive window of the connection proposed in the handshake (CFCW),
+	// up to MAX_CONNECTION_RECEIVE_WINDOW
+	ConnectionFlowControlWindow protocol.QuicByteOffset
+	// StreamSendBufferSize is the size of the send buffer of the streams, stream.DEFAULT_SEND_BUFFER_SIZE by default:
+	// Write blocks while the buffer is full, TryWrite returns stream.ErrWouldBlock
+	StreamSendBufferSize int
+	// CongestionControl is the congestion control algorithm of the packets sent, congestion.CONGESTION_CUBIC by default
+	CongestionControl congestion.CongestionControlAlgorithm
+	// StreamScheduler returns the StreamScheduler of the data streams of a new session, NewWeightedScheduler by default:
+	// NewStrictPriorityScheduler and NewFIFOScheduler are the alternatives
+	StreamScheduler func() StreamScheduler
+	// AEADs are the AEADs of the packet protection in the order of preference of the client, the first one supported by
+	// the server is selected: handshake.SupportedAEADs by default
+	AEADs []protocol.MessageTag
+	// KeepAlive sends a PING frame at half the idle timeout, so that the session and the NAT bindings stay open
+	KeepAlive bool
+	// AllowMigration follows the peer to a new address, once a PING sent there is acknowledged: the congestion control
+	// and the RTT estimation start again on the new path. By default the packets are sent to the first address of the peer
+	AllowMigration bool
+	// TruncateConnectionID proposes to omit the 8 bytes of the Connection ID in the packets of both endpoints, it is omitted
+	// if both propose it. The packets without Connection ID are routed by the address of the peer, so the session can't migrate:
+	// the client proposes it on the UDP socket of Dial, DialPacketConn rejects it as the PacketConn can be shared,
+	// and the Listener for a single session per address of client
+	TruncateConnectionID bool
+	// DisableMTUDiscovery keeps the packets at MAX_PACKET_SIZE. By default padded PING packets probe larger sizes
+	// up to MTU_DISCOVERY_MAX_SIZE once the handshake is complete, and the packets grow to the largest size acknowledged
+	DisableMTUDiscovery bool
+	// DisableECN sends the packets without the ECT(0) mark of Explicit Congestion Notification. By default the routers
+	// can mark the packets Congestion Experienced instead of dropping them, the congestion control reduces its window
+	// on the marks received: Google QUIC has no ECN feedback in its ACK frames
+	DisableECN bool
+	// Clock gives the time to the timers of the sessions, protocol.RealClock by default. The sessions sharing a PacketConn
+	// take the time of their received packets from the Clock of the first Dial or Listen on the PacketConn
+	Clock protocol.Clock
+	// Tracer returns the Tracer of the events of a new session, the session is not traced if it returns nil.
+	// NewJSONTracer writes the events in the qlog format
+	Tracer func(connID protocol.QuicConnectionID, perspective protocol.Perspective) Tracer
+	// PublicResetSecret derives the nonce proofs of the public resets that Listen sends to the packets of the unknown connections,
+	// at least MIN_PUBLIC_RESET_SECRET_SIZE bytes: with the same secret after a restart, the server resets the connections of
+	// the previous process and their clients can dial again at once. A random secret by default
+	PublicResetSecret []byte
+	// PublicResetInterval is the minimum interval between the public resets sent to a source address, DEFAULT_PUBLIC_RESET_INTERVAL by default
+	PublicResetInterval time.Duration
+	// MaxPublicResetsPerSecond is the maximum number of public resets sent by the Listener per second,
+	// DEFAULT_MAX_PUBLIC_RESETS_PER_SECOND by default
+	MaxPublicResetsPerSecond int
+	// MaxPendingSessions is the maximum number of sessions of the Listener in handshake at the same time, the CHLOs of the
+	// new connections are dropped above it. DEFAULT_MAX_PENDING_SESSIONS by default
+	MaxPendingSessions int
+	// KeyLogWriter receives the packet protection keys of the sessions as soon as the handshake derives them, to decrypt
+	// the captured packets: one line per key, "QUIC_<CLIENT|SERVER>_<INITIAL|FORWARD_SECURE> <connection ID> <key> <IV>"
+	// in hexadecimal. It breaks the security of the sessions, and its write errors are ignored
+	KeyLogWriter io.Writer
+}
+
+// Validate returns an ErrInvalidConfig for the first invalid field of the config, the zero fields select their default value.
+func (this *Config) Validate() error {
+	c := populateDefaults(this)
+	for _, v := range c.Versions {
+		if !containsVersion(protocol.SupportedVersions(), v) {
+			return ErrInvalidConfig{Field: "Versions", Reason: fmt.Sprintf("unsupported version %v", v)}
+		}
+	}
+	if c.InsecureSkipVerify && !c.AllowInsecure {
+		return ErrInvalidConfig{Field: "InsecureSkipVerify", Reason: "unsafe without AllowInsecure"}
+	}
+	if c.ForceNullEncryption && !c.AllowInsecure {
+		return ErrInvalidConfig{Field: "ForceNullEncryption", Reason: "unsafe without AllowInsecure"}
+	}
+	if c.IdleTimeout < MIN_IDLE_TIMEOUT {
+		return ErrInvalidConfig{Field: "IdleTimeout", Reason: fmt.Sprintf("%v below %v", c.IdleTimeout, MIN_IDLE_TIMEOUT)}
+	}
+	if c.HandshakeTimeout < 0 {
+		return ErrInvalidConfig{Field: "HandshakeTimeout", Reason: "negative"}
+	}
+	if c.MaxStreams < 0 {
+		return ErrInvalidConfig{Field: "MaxStreams", Reason: "negative"}
+	}
+	if c.MaxIncomingStreams < 0 {
+		return ErrInvalidConfig{Field: "MaxIncomingStreams", Reason: "negative"}
+	}
+	for _, window := range []struct {
+		field string
+		value protocol.QuicByteOffset
+		max   protocol.QuicByteOffset
+	}{
+		{"StreamFlowControlWindow", c.StreamFlowControlWindow, flowcontrol.MAX_STREAM_RECEIVE_WINDOW},
+		{"ConnectionFlowControlWindow", c.ConnectionFlowControlWindow, flowcontrol.MAX_CONNECTION_RECEIVE_WINDOW},
+	} {
+		// The peer rejects a window below MIN_FLOW_CONTROL_WINDOW
+		if window.value < handshake.MIN_FLOW_CONTROL_WINDOW || window.value > window.max {
+			return ErrInvalidConfig{Field: window.field, Reason: fmt.Sprintf("%d out of [%d, %d]", window.value, handshake.MIN_FLOW_CONTROL_WINDOW, window.max)}
+		}
+	}
+	if c.StreamFlowControlWindow > c.ConnectionFlowControlWindow {
+		return ErrInvalidConfig{Field: "StreamFlowControlWindow", Reason: "larger than the ConnectionFlowControlWindow"}
+	}
+	if c.StreamSendBufferSize < 0 {
+		return ErrInvalidConfig{Field: "StreamSendBufferSize", Reason: "negative"}
+	}
+	switch c.CongestionControl {
+	case congestion.CONGESTION_CUBIC, congestion.CONGESTION_BBR:
+	default:
+		return ErrInvalidConfig{Field: "CongestionControl", Reason: fmt.Sprintf("unknown algorithm %d", c.CongestionControl)}
+	}
+	for _, t := range c.AEADs {
+		if !containsTag(handshake.SupportedAEADs(), t) {
+			return ErrInvalidConfig{Field: "AEADs", Reason: fmt.Sprintf("unsupported AEAD 0x%08x", uint32(t))}
+		}
+	}
+	if c.PublicResetSecret != nil && len(c.PublicResetSecret) < MIN_PUBLIC_RESET_SECRET_SIZE {
+		return ErrInvalidConfig{Field: "PublicResetSecret", Reason: fmt.Sprintf("shorter than %d bytes", MIN_PUBLIC_RESET_SECRET_SIZE)}
+	}
+	if c.PublicResetInterval < 0 {
+		return ErrInvalidConfig{Field: "PublicResetInterval", Reason: "negative"}
+	}
+	if c.MaxPublicResetsPerSecond < 0 {
+		return ErrInvalidConfig{Field: "MaxPublicResetsPerSecond", Reason: "negative"}
+	}
+	if c.MaxPendingSessions < 0 {
+		return ErrInvalidConfig{Field: "MaxPendingSessions", Reason: "negative"}
+	}
+	return nil
+}
+
+// populateDefaults returns a copy of the config with the default values.
+func populateDefaults(config *Config) *Config {
+	c := new(Config)
+	if config != nil {
+		*c = *config
+	}
+	if len(c.Versions) == 0 {
+		c.Versions = protocol.SupportedVersions()
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = DEFAULT_IDLE_TIMEOUT
+	}
+	if c.HandshakeTimeout == 0 {
+		c.HandshakeTimeout = DEFAULT_HANDSHAKE_TIMEOUT
+	}
+	if c.MaxStreams == 0 {
+		c.MaxStreams = DEFAULT_MAX_STREAMS
+	}
+	if c.MaxIncomingStreams == 0 {
+		c.MaxIncomingStreams = c.MaxStreams
+	}
+	if c.StreamFlowControlWindow == 0 {
+		c.StreamFlowControlWindow = flowcontrol.INITIAL_STREAM_WINDOW
+	}
+	if c.ConnectionFlowControlWindow == 0 {
+		c.ConnectionFlowControlWindow = flowcontrol.INITIAL_CONNECTION_WINDOW
+	}
+	if c.StreamSendBufferSize == 0 {
+		c.StreamSendBufferSize = stream.DEFAULT_SEND_BUFFER_SIZE
+	}
+	if c.StreamScheduler == nil {
+		c.StreamScheduler = NewWeightedScheduler
+	}
+	if len(c.AEADs) == 0 {
+		c.AEADs = handshake.SupportedAEADs()
+	}
+	if c.PublicResetInterval == 0 {
+		c.PublicResetInterval = DEFAULT_PUBLIC_RESET_INTERVAL
+	}
+	if c.MaxPublicResetsPerSecond == 0 {
+		c.MaxPublicResetsPerSecond = DEFAULT_MAX_PUBLIC_RESETS_PER_SECOND
+	}
+	if c.MaxPendingSessions == 0 {
+		c.MaxPendingSessions = DEFAULT_MAX_PENDING_SESSIONS
+	}
+	if c.Clock == nil {
+		c.Clock = protocol.RealClock
+	}
+	return c
+}
+
+// maxIncomingStreams returns the MSPC proposed to the peer, the smallest of MaxStreams and MaxIncomingStreams.
+func (this *Config) maxIncomingStreams() int {
+	if this.MaxIncomingStreams < this.MaxStreams {
+		return this.MaxIncomingStreams
+	}
+	return this.MaxStreams
+}
+
+// containsVersion returns true if the version is in the list.
+func containsVersion(versions []protocol.QuicVersion, version protocol.QuicVersion) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// containsTag returns true if the tag is in the list.
+func containsTag(tags []protocol.MessageTag, tag protocol.MessageTag) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
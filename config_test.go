@@ -0,0 +1,87 @@
+package quic
+
+import "github.com/romain-jacotin/quic/congestion"
+import "github.com/romain-jacotin/quic/handshake"
+import "github.com/romain-jacotin/quic/protocol"
+import "errors"
+import "testing"
+import "time"
+
+var tests_configs = []struct {
+	config *Config
+	field  string
+}{
+	{nil, ""},
+	{&Config{}, ""},
+	{&Config{Versions: []protocol.QuicVersion{protocol.QUIC_VERSION_39}, IdleTimeout: time.Second, MaxStreams: 1,
+		StreamFlowControlWindow: 1 << 20, ConnectionFlowControlWindow: 1 << 20, CongestionControl: congestion.CONGESTION_BBR,
+		AEADs: []protocol.MessageTag{protocol.TagCC20}}, ""},
+	{&Config{Versions: []protocol.QuicVersion{protocol.QUIC_VERSION_39, protocol.QuicVersion(0x51303939)}}, "Versions"},
+	{&Config{InsecureSkipVerify: true}, "InsecureSkipVerify"},
+	{&Config{ForceNullEncryption: true}, "ForceNullEncryption"},
+	{&Config{InsecureSkipVerify: true, ForceNullEncryption: true, AllowInsecure: true}, ""},
+	{&Config{IdleTimeout: 999 * time.Millisecond}, "IdleTimeout"},
+	{&Config{IdleTimeout: -time.Second}, "IdleTimeout"},
+	{&Config{HandshakeTimeout: -time.Second}, "HandshakeTimeout"},
+	{&Config{MaxStreams: -1}, "MaxStreams"},
+	{&Config{MaxIncomingStreams: -1}, "MaxIncomingStreams"},
+	{&Config{StreamFlowControlWindow: handshake.MIN_FLOW_CONTROL_WINDOW - 1}, "StreamFlowControlWindow"},
+	{&Config{StreamFlowControlWindow: 32 << 20, ConnectionFlowControlWindow: 24 << 20}, "StreamFlowControlWindow"},
+	{&Config{ConnectionFlowControlWindow: 1024}, "ConnectionFlowControlWindow"},
+	{&Config{ConnectionFlowControlWindow: 32 << 20}, "ConnectionFlowControlWindow"},
+	{&Config{StreamFlowControlWindow: 1 << 20}, "StreamFlowControlWindow"},
+	{&Config{StreamFlowControlWindow: 1 << 20, ConnectionFlowControlWindow: 1<<20 - 1}, "StreamFlowControlWindow"},
+	{&Config{StreamSendBufferSize: -1}, "StreamSendBufferSize"},
+	{&Config{CongestionControl: congestion.CongestionControlAlgorithm(2)}, "CongestionControl"},
+	{&Config{AEADs: []protocol.MessageTag{protocol.TagAESG, protocol.TagNULL}}, "AEADs"},
+	{&Config{PublicResetSecret: make([]byte, MIN_PUBLIC_RESET_SECRET_SIZE), PublicResetInterval: time.Second, MaxPublicResetsPerSecond: 1}, ""},
+	{&Config{PublicResetSecret: make([]byte, MIN_PUBLIC_RESET_SECRET_SIZE-1)}, "PublicResetSecret"},
+	{&Config{PublicResetInterval: -time.Second}, "PublicResetInterval"},
+	{&Config{MaxPublicResetsPerSecond: -1}, "MaxPublicResetsPerSecond"},
+	{&Config{MaxPendingSessions: -1}, "MaxPendingSessions"},
+}
+
+func Test_Config_Validate(t *testing.T) {
+	for i, v := range tests_configs {
+		err := v.config.Validate()
+		var cerr ErrInvalidConfig
+		switch {
+		case v.field == "" && err != nil:
+			t.Errorf("Config.Validate : unexpected error %v in test n°%v", err, i)
+		case v.field != "" && (!errors.As(err, &cerr) || cerr.Field != v.field):
+			t.Errorf("Config.Validate : invalid %v expected instead of %v in test n°%v", v.field, err, i)
+		}
+	}
+
+	// Dial and Listen reject an invalid config before any packet is sent
+	pc := listenUDP(t)
+	defer pc.Close()
+	config := &Config{IdleTimeout: time.Millisecond}
+	var cerr ErrInvalidConfig
+	if _, err := Listen(pc, config); !errors.As(err, &cerr) {
+		t.Errorf("Listen : ErrInvalidConfig expected instead of %v", err)
+	}
+	if _, err := Listen(pc, &Config{ForceNullEncryption: true}); !errors.As(err, &cerr) || cerr.Field != "ForceNullEncryption" {
+		t.Errorf("Listen : invalid ForceNullEncryption expected instead of %v", err)
+	}
+	if _, err := DialPacketConn(pc, pc.LocalAddr(), "localhost", config); !errors.As(err, &cerr) {
+		t.Errorf("DialPacketConn : ErrInvalidConfig expected instead of %v", err)
+	}
+	if _, err := Dial("127.0.0.1:443", config); !errors.As(err, &cerr) {
+		t.Errorf("Dial : ErrInvalidConfig expected instead of %v", err)
+	}
+}
+
+func Test_Config_PopulateDefaults(t *testing.T) {
+	c := populateDefaults(nil)
+	if len(c.Versions) == 0 || c.IdleTimeout != DEFAULT_IDLE_TIMEOUT || c.HandshakeTimeout != DEFAULT_HANDSHAKE_TIMEOUT || c.MaxStreams != DEFAULT_MAX_STREAMS || c.MaxIncomingStreams != DEFAULT_MAX_STREAMS || c.StreamFlowControlWindow == 0 ||
+		c.ConnectionFlowControlWindow == 0 || c.StreamSendBufferSize == 0 || c.CongestionControl != congestion.CONGESTION_CUBIC ||
+		c.StreamScheduler == nil || len(c.AEADs) == 0 || c.MaxPendingSessions != DEFAULT_MAX_PENDING_SESSIONS || c.Clock == nil {
+		t.Errorf("populateDefaults : unexpected default values %+v", c)
+	}
+	// The config of the caller is not modified
+	config := &Config{IdleTimeout: time.Minute}
+	if c = populateDefaults(config); c == config || c.IdleTimeout != time.Minute || config.Versions != nil {
+		t.Errorf("populateDefaults : copy of the config expected")
+	}
+}
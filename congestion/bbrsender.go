@@ -0,0 +1,341 @@
+package congestion
+
+import "github.com/romain-jacotin/quic/protocol"
+import "time"
+
+const (
+	// BBR_HIGH_GAIN is the pacing and congestion window gain of the startup mode (2/ln(2))
+	BBR_HIGH_GAIN = 2.885
+	// BBR_CWND_GAIN is the congestion window gain over the bandwidth-delay product in probe bandwidth mode
+	BBR_CWND_GAIN = 2.0
+	// BBR_BANDWIDTH_WINDOW is the number of rounds of the max bandwidth filter
+	BBR_BANDWIDTH_WINDOW = 10
+	// BBR_MIN_RTT_EXPIRY is the age of the min RTT that triggers the probe RTT mode
+	BBR_MIN_RTT_EXPIRY = 10 * time.Second
+	// BBR_PROBE_RTT_TIME is the minimum duration of the probe RTT mode
+	BBR_PROBE_RTT_TIME = 200 * time.Millisecond
+	// BBR_MIN_CONGESTION_WINDOW is the minimum congestion window in packets, and the window of the probe RTT mode
+	BBR_MIN_CONGESTION_WINDOW = 4
+	// BBR_STARTUP_GROWTH_TARGET is the bandwidth growth per round below which the pipe is full
+	BBR_STARTUP_GROWTH_TARGET = 1.25
+	// BBR_STARTUP_FULL_BANDWIDTH_ROUNDS is the number of rounds without bandwidth growth that ends the startup mode
+	BBR_STARTUP_FULL_BANDWIDTH_ROUNDS = 3
+)
+
+// BBRMode is the state of the BBR state machine.
+type BBRMode int
+
+const (
+	BBR_STARTUP BBRMode = iota
+	BBR_DRAIN
+	BBR_PROBE_BW
+	BBR_PROBE_RTT
+)
+
+// bbrPacingGainCycle is the pacing gain cycle of the probe bandwidth mode, one phase per min RTT
+var bbrPacingGainCycle = []float64{1.25, 0.75, 1, 1, 1, 1, 1, 1}
+
+// bbrPacketState is the delivery state of the connection when a packet is sent, for the bandwidth sample of its acknowledgement.
+type bbrPacketState struct {
+	delivered     int64
+	deliveredTime time.Time
+}
+
+// bbrBandwidthSample is a bandwidth sample of the max filter.
+type bbrBandwidthSample struct {
+	round     int64
+	bandwidth int64
+}
+
+// BBRSender is a simplified BBR v1 congestion control: the congestion window and the pacing rate are computed from the
+// max bandwidth of the last rounds, sampled from the acknowledgement rate, and the min RTT.
+//
+// The state machine starts with an exponential startup until the bandwidth stops growing, drains the queue created by the startup,
+// then cycles the pacing gain to probe for more bandwidth, and periodically reduces the window to probe for a lower min RTT.
+type BBRSender struct {
+	rttStats *RTTStats
+	mode     BBRMode
+
+	// Bandwidth sampling and rounds
+	packets            map[protocol.QuicPacketSequenceNumber]bbrPacketState
+	delivered          int64
+	deliveredTime      time.Time
+	round              int64
+	nextRoundDelivered int64
+	bandwidthSamples   []bbrBandwidthSample
+
+	// Min RTT
+	minRTT          time.Duration
+	minRTTTimestamp time.Time
+
+	// Startup exit
+	fullBandwidth       int64
+	fullBandwidthRounds int
+	filledPipe          bool
+
+	// Probe bandwidth and probe RTT
+	cycleIndex        int
+	cycleStart        time.Time
+	probeRTTDoneTime  time.Time
+	probeRTTRoundDone bool
+	probeRTTRound     int64
+
+	pacingGain          float64
+	cwndGain            float64
+	congestionWindow    int
+	initialWindow       int
+	maxCongestionWindow int
+	nextSendTime        time.Time
+}
+
+var _ SendAlgorithm = (*BBRSender)(nil)
+
+// NewBBRSender returns a BBRSender in startup mode with the initial and maximum congestion windows in packets.
+func NewBBRSender(rttStats *RTTStats, initialWindow, maxWindow int) *BBRSender {
+	return &BBRSender{
+		rttStats:            rttStats,
+		mode:                BBR_STARTUP,
+		packets:             make(map[protocol.QuicPacketSequenceNumber]bbrPacketState),
+		pacingGain:          BBR_HIGH_GAIN,
+		cwndGain:            BBR_HIGH_GAIN,
+		congestionWindow:    initialWindow * MAX_SEGMENT_SIZE,
+		initialWindow:       initialWindow * MAX_SEGMENT_SIZE,
+		maxCongestionWindow: maxWindow * MAX_SEGMENT_SIZE}
+}
+
+// OnPacketSent records the delivery state for the bandwidth sample, and schedules the next packet at the pacing rate.
+func (this *BBRSender) OnPacketSent(sentTime time.Time, bytesInFlight int, seqnum protocol.QuicPacketSequenceNumber, bytes int, retransmittable bool) {
+	if !retransmittable {
+		return
+	}
+	if bytesInFlight == 0 || this.deliveredTime.IsZero() {
+		// Nothing in flight: the sample interval starts now
+		this.deliveredTime = sentTime
+	}
+	this.packets[seqnum] = bbrPacketState{delivered: this.delivered, deliveredTime: this.deliveredTime}
+	if this.nextSendTime.Before(sentTime) {
+		this.nextSendTime = sentTime
+	}
+	if rate := this.PacingRate(); rate > 0 {
+		this.nextSendTime = this.nextSendTime.Add(time.Duration(int64(bytes) * int64(time.Second) / rate))
+	}
+}
+
+// OnPacketAcked samples the bandwidth and the min RTT, and updates the state machine and the congestion window.
+func (this *BBRSender) OnPacketAcked(seqnum protocol.QuicPacketSequenceNumber, ackedBytes int, priorInFlight int, eventTime time.Time) {
+	state, ok := this.packets[seqnum]
+	if !ok {
+		return
+	}
+	delete(this.packets, seqnum)
+	this.delivered += int64(ackedBytes)
+	this.deliveredTime = eventTime
+
+	// Round trip counting: a round ends when a packet sent after the start of the round is acknowledged
+	newRound := false
+	if state.delivered >= this.nextRoundDelivered {
+		this.nextRoundDelivered = this.delivered
+		this.round++
+		newRound = true
+	}
+	if interval := eventTime.Sub(state.deliveredTime); interval > 0 {
+		this.updateBandwidth((this.delivered - state.delivered) * int64(time.Second) / int64(interval))
+	}
+	minRTTExpired := this.updateMinRTT(eventTime)
+	inFlight := priorInFlight - ackedBytes
+
+	switch this.mode {
+	case BBR_STARTUP:
+		if newRound {
+			this.checkFullBandwidth()
+		}
+		if this.filledPipe {
+			this.setMode(BBR_DRAIN, eventTime)
+		}
+	case BBR_DRAIN:
+		if inFlight <= this.bdp(1) {
+			this.setMode(BBR_PROBE_BW, eventTime)
+		}
+	case BBR_PROBE_BW:
+		if eventTime.Sub(this.cycleStart) > this.minRTT {
+			this.cycleIndex = (this.cycleIndex + 1) % len(bbrPacingGainCycle)
+			this.cycleStart = eventTime
+			this.pacingGain = bbrPacingGainCycle[this.cycleIndex]
+		}
+	case BBR_PROBE_RTT:
+		if this.probeRTTDoneTime.IsZero() && inFlight <= BBR_MIN_CONGESTION_WINDOW*MAX_SEGMENT_SIZE {
+			this.probeRTTDoneTime = eventTime.Add(BBR_PROBE_RTT_TIME)
+			this.probeRTTRound = this.round
+		} else if !this.probeRTTDoneTime.IsZero() && this.round > this.probeRTTRound && eventTime.After(this.probeRTTDoneTime) {
+			this.minRTTTimestamp = eventTime
+			if this.filledPipe {
+				this.setMode(BBR_PROBE_BW, eventTime)
+			} else {
+				this.setMode(BBR_STARTUP, eventTime)
+			}
+		}
+	}
+	if minRTTExpired && this.mode != BBR_PROBE_RTT {
+		this.setMode(BBR_PROBE_RTT, eventTime)
+	}
+	this.updateCongestionWindow(ackedBytes)
+}
+
+// OnPacketLost forgets the delivery state of the lost packet, BBR v1 doesn't reduce its window on loss.
+func (this *BBRSender) OnPacketLost(seqnum protocol.QuicPacketSequenceNumber, lostBytes int, priorInFlight int) {
+	delete(this.packets, seqnum)
+}
+
+// OnCongestionExperienced does nothing, BBR v1 doesn't react to ECN.
+func (this *BBRSender) OnCongestionExperienced() {
+}
+
+// OnRetransmissionTimeout collapses the congestion window to the minimum window, it grows back to the bandwidth-delay product.
+func (this *BBRSender) OnRetransmissionTimeout(packetsRetransmitted bool) {
+	if packetsRetransmitted {
+		this.congestionWindow = BBR_MIN_CONGESTION_WINDOW * MAX_SEGMENT_SIZE
+	}
+}
+
+// TimeUntilSend returns INFINITE_DURATION if the congestion window is full, or the delay until the pacing rate allows the next packet.
+func (this *BBRSender) TimeUntilSend(now time.Time, bytesInFlight int) time.Duration {
+	if bytesInFlight >= this.congestionWindow {
+		return INFINITE_DURATION
+	}
+	if this.nextSendTime.After(now.Add(PACING_GRANULARITY)) {
+		return this.nextSendTime.Sub(now)
+	}
+	return 0
+}
+
+// GetCongestionWindow returns the congestion window in bytes.
+func (this *BBRSender) GetCongestionWindow() int {
+	return this.congestionWindow
+}
+
+// InSlowStart returns true in startup mode.
+func (this *BBRSender) InSlowStart() bool {
+	return this.mode == BBR_STARTUP
+}
+
+// GetMode returns the state of the BBR state machine.
+func (this *BBRSender) GetMode() BBRMode {
+	return this.mode
+}
+
+// BandwidthEstimate returns the max bandwidth of the last rounds in bytes per second, 0 before the first sample.
+func (this *BBRSender) BandwidthEstimate() int64 {
+	if len(this.bandwidthSamples) == 0 {
+		return 0
+	}
+	return this.bandwidthSamples[0].bandwidth
+}
+
+// GetMinRTT returns the min RTT of the last BBR_MIN_RTT_EXPIRY.
+func (this *BBRSender) GetMinRTT() time.Duration {
+	return this.minRTT
+}
+
+// PacingRate returns the pacing rate in bytes per second: the bandwidth estimate with the pacing gain of the mode,
+// or the initial congestion window per smoothed RTT before the first bandwidth sample. 0 means no pacing.
+func (this *BBRSender) PacingRate() int64 {
+	if bw := this.BandwidthEstimate(); bw > 0 {
+		return int64(this.pacingGain * float64(bw))
+	}
+	if srtt := this.rttStats.SmoothedRTT(); srtt > 0 {
+		return int64(this.pacingGain * float64(this.initialWindow) / srtt.Seconds())
+	}
+	return 0
+}
+
+// updateBandwidth adds a sample to the max filter of the last BBR_BANDWIDTH_WINDOW rounds.
+func (this *BBRSender) updateBandwidth(bandwidth int64) {
+	samples := this.bandwidthSamples
+	for len(samples) > 0 && samples[0].round+BBR_BANDWIDTH_WINDOW <= this.round {
+		samples = samples[1:]
+	}
+	// Monotonic queue: the older samples below the new one can't be the max anymore
+	for len(samples) > 0 && samples[len(samples)-1].bandwidth <= bandwidth {
+		samples = samples[:len(samples)-1]
+	}
+	this.bandwidthSamples = append(samples, bbrBandwidthSample{round: this.round, bandwidth: bandwidth})
+}
+
+// updateMinRTT tracks the min RTT of the latest RTT samples, and returns true if it has expired.
+func (this *BBRSender) updateMinRTT(now time.Time) bool {
+	expired := !this.minRTTTimestamp.IsZero() && now.Sub(this.minRTTTimestamp) > BBR_MIN_RTT_EXPIRY
+	if rtt := this.rttStats.LatestRTT(); rtt > 0 && (this.minRTT == 0 || rtt <= this.minRTT || expired) {
+		this.minRTT = rtt
+		this.minRTTTimestamp = now
+	}
+	return expired
+}
+
+// checkFullBandwidth detects the end of the startup when the bandwidth didn't grow by BBR_STARTUP_GROWTH_TARGET for some rounds.
+func (this *BBRSender) checkFullBandwidth() {
+	bw := this.BandwidthEstimate()
+	if float64(bw) >= float64(this.fullBandwidth)*BBR_STARTUP_GROWTH_TARGET {
+		this.fullBandwidth = bw
+		this.fullBandwidthRounds = 0
+		return
+	}
+	this.fullBandwidthRounds++
+	if this.fullBandwidthRounds >= BBR_STARTUP_FULL_BANDWIDTH_ROUNDS {
+		this.filledPipe = true
+	}
+}
+
+// setMode changes the state of the state machine and its gains.
+func (this *BBRSender) setMode(mode BBRMode, now time.Time) {
+	this.mode = mode
+	switch mode {
+	case BBR_STARTUP:
+		this.pacingGain = BBR_HIGH_GAIN
+		this.cwndGain = BBR_HIGH_GAIN
+	case BBR_DRAIN:
+		this.pacingGain = 1 / BBR_HIGH_GAIN
+		this.cwndGain = BBR_HIGH_GAIN
+	case BBR_PROBE_BW:
+		this.cycleIndex = 0
+		this.cycleStart = now
+		this.pacingGain = bbrPacingGainCycle[0]
+		this.cwndGain = BBR_CWND_GAIN
+	case BBR_PROBE_RTT:
+		this.pacingGain = 1
+		this.cwndGain = 1
+		this.probeRTTDoneTime = time.Time{}
+	}
+}
+
+// bdp returns the bandwidth-delay product in bytes with the gain, or the initial congestion window without estimation.
+func (this *BBRSender) bdp(gain float64) int {
+	bw := this.BandwidthEstimate()
+	if bw == 0 || this.minRTT == 0 {
+		return this.initialWindow
+	}
+	return int(gain * float64(bw) * this.minRTT.Seconds())
+}
+
+// updateCongestionWindow grows the congestion window toward the bandwidth-delay product with the gain of the mode.
+func (this *BBRSender) updateCongestionWindow(ackedBytes int) {
+	target := this.bdp(this.cwndGain)
+	switch {
+	case this.mode == BBR_PROBE_RTT:
+		target = BBR_MIN_CONGESTION_WINDOW * MAX_SEGMENT_SIZE
+		if this.congestionWindow > target {
+			this.congestionWindow = target
+		}
+		return
+	case this.filledPipe:
+		if this.congestionWindow += ackedBytes; this.congestionWindow > target {
+			this.congestionWindow = target
+		}
+	case this.congestionWindow < target || this.delivered < int64(this.initialWindow):
+		this.congestionWindow += ackedBytes
+	}
+	if this.congestionWindow < BBR_MIN_CONGESTION_WINDOW*MAX_SEGMENT_SIZE {
+		this.congestionWindow = BBR_MIN_CONGESTION_WINDOW * MAX_SEGMENT_SIZE
+	} else if this.congestionWindow > this.maxCongestionWindow {
+		this.congestionWindow = this.maxCongestionWindow
+	}
+}
@@ -0,0 +1,140 @@
+package congestion
+
+import "github.com/romain-jacotin/quic/protocol"
+import "testing"
+import "time"
+
+// testLink is a fake bottleneck link: the packets are serialized at the bandwidth in a FIFO queue,
+// and acknowledged after the propagation RTT.
+type testLink struct {
+	bandwidth     int64 // bytes per second
+	rtt           time.Duration
+	lastDeparture time.Time
+	acks          []testLinkAck
+}
+
+type testLinkAck struct {
+	seqnum   protocol.QuicPacketSequenceNumber
+	sentTime time.Time
+	ackTime  time.Time
+}
+
+func (this *testLink) send(seqnum protocol.QuicPacketSequenceNumber, bytes int, now time.Time) {
+	departure := this.lastDeparture
+	if departure.Before(now) {
+		departure = now
+	}
+	departure = departure.Add(time.Duration(int64(bytes) * int64(time.Second) / this.bandwidth))
+	this.lastDeparture = departure
+	this.acks = append(this.acks, testLinkAck{seqnum: seqnum, sentTime: now, ackTime: departure.Add(this.rtt)})
+}
+
+// testBBRSim drives a sender over the link, one acknowledgement per packet.
+type testBBRSim struct {
+	sender   SendAlgorithm
+	rttStats *RTTStats
+	link     *testLink
+	now      time.Time
+	seqnum   protocol.QuicPacketSequenceNumber
+	inFlight int
+}
+
+func newTestBBRSim(bandwidth int64, rtt time.Duration) *testBBRSim {
+	rttStats := NewRTTStats()
+	return &testBBRSim{
+		sender:   NewBBRSender(rttStats, INITIAL_CONGESTION_WINDOW, MAX_CONGESTION_WINDOW),
+		rttStats: rttStats,
+		link:     &testLink{bandwidth: bandwidth, rtt: rtt},
+		now:      time.Unix(1000, 0)}
+}
+
+func (this *testBBRSim) run(duration time.Duration) {
+	end := this.now.Add(duration)
+	for {
+		next := end
+		if d := this.sender.TimeUntilSend(this.now, this.inFlight); d != INFINITE_DURATION {
+			next = this.now.Add(d)
+		}
+		if len(this.link.acks) > 0 && this.link.acks[0].ackTime.Before(next) {
+			ack := this.link.acks[0]
+			this.link.acks = this.link.acks[1:]
+			this.now = ack.ackTime
+			this.rttStats.UpdateRTT(this.now.Sub(ack.sentTime), 0)
+			this.sender.OnPacketAcked(ack.seqnum, MAX_SEGMENT_SIZE, this.inFlight, this.now)
+			this.inFlight -= MAX_SEGMENT_SIZE
+			continue
+		}
+		if !next.Before(end) {
+			this.now = end
+			return
+		}
+		this.now = next
+		this.seqnum++
+		this.sender.OnPacketSent(this.now, this.inFlight, this.seqnum, MAX_SEGMENT_SIZE, true)
+		this.inFlight += MAX_SEGMENT_SIZE
+		this.link.send(this.seqnum, MAX_SEGMENT_SIZE, this.now)
+	}
+}
+
+var tests_bbrlink = []struct {
+	bandwidth int64
+	rtt       time.Duration
+}{
+	{1250000, 50 * ms},   // 10 Mbit/s
+	{12500000, 100 * ms}, // 100 Mbit/s, high bandwidth-delay product
+	{250000, 20 * ms},    // 2 Mbit/s
+}
+
+func Test_BBRSender_Convergence(t *testing.T) {
+	for i, v := range tests_bbrlink {
+		sim := newTestBBRSim(v.bandwidth, v.rtt)
+		sim.run(5 * time.Second)
+		sender := sim.sender.(*BBRSender)
+
+		bw := sender.BandwidthEstimate()
+		if bw < v.bandwidth*9/10 || bw > v.bandwidth*11/10 {
+			t.Errorf("BBRSender.BandwidthEstimate : %v instead of %v in test n°%v", bw, v.bandwidth, i)
+		}
+		if sender.GetMode() != BBR_PROBE_BW {
+			t.Errorf("BBRSender.GetMode : probe bandwidth mode expected instead of %v in test n°%v", sender.GetMode(), i)
+		}
+		// The min RTT includes the serialization of one packet on the link
+		minRTT := v.rtt + time.Duration(MAX_SEGMENT_SIZE*int64(time.Second)/v.bandwidth)
+		if sender.GetMinRTT() < minRTT || sender.GetMinRTT() > minRTT*11/10 {
+			t.Errorf("BBRSender.GetMinRTT : %v instead of %v in test n°%v", sender.GetMinRTT(), minRTT, i)
+		}
+	}
+}
+
+func Test_BBRSender_ProbeRTT(t *testing.T) {
+	sim := newTestBBRSim(1250000, 50*ms)
+	sim.run(2 * time.Second)
+	sender := sim.sender.(*BBRSender)
+
+	// Route change: the RTT samples stay above the min RTT, which expires after BBR_MIN_RTT_EXPIRY
+	sim.link.rtt = 80 * ms
+	probed := false
+	for d := time.Duration(0); d < BBR_MIN_RTT_EXPIRY+time.Second && !probed; d += 5 * ms {
+		sim.run(5 * ms)
+		probed = sender.GetMode() == BBR_PROBE_RTT
+	}
+	if !probed {
+		t.Fatal("BBRSender.GetMode : probe RTT mode expected after the min RTT expiry")
+	}
+	if sender.GetCongestionWindow() != BBR_MIN_CONGESTION_WINDOW*MAX_SEGMENT_SIZE {
+		t.Errorf("BBRSender.GetCongestionWindow : %v instead of the minimum window in probe RTT mode", sender.GetCongestionWindow())
+	}
+
+	// Back to probe bandwidth with the new min RTT
+	sim.run(time.Second)
+	if sender.GetMode() != BBR_PROBE_BW || sender.GetMinRTT() < 80*ms || sender.GetMinRTT() > 90*ms {
+		t.Errorf("BBRSender : probe bandwidth mode expected after probe RTT, mode %v with min RTT %v", sender.GetMode(), sender.GetMinRTT())
+	}
+}
+
+func Test_NewSendAlgorithm_BBR(t *testing.T) {
+	s, err := NewSendAlgorithm(CONGESTION_BBR, NewRTTStats())
+	if _, ok := s.(*BBRSender); err != nil || !ok || !s.InSlowStart() {
+		t.Errorf("NewSendAlgorithm : BBRSender in startup mode expected (%v)", err)
+	}
+}
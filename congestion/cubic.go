@@ -0,0 +1,75 @@
+package congestion
+
+import "math"
+import "time"
+
+const (
+	// CUBIC_C is the scaling constant of the Cubic window growth function, in packets per second cubed
+	CUBIC_C = 0.4
+	// CUBIC_BETA is the multiplicative decrease factor of the congestion window after a loss
+	CUBIC_BETA = 0.7
+	// CUBIC_BETA_LAST_MAX is the additional decrease of the last maximum window when the window was still below it (fast convergence)
+	CUBIC_BETA_LAST_MAX = 0.85
+	// CUBIC_RENO_ALPHA is the additive increase of the TCP-friendly window estimation, in packets per RTT
+	CUBIC_RENO_ALPHA = 3 * (1 - CUBIC_BETA) / (1 + CUBIC_BETA)
+)
+
+// Cubic computes the congestion window in congestion avoidance with the Cubic window growth function (RFC 8312):
+//
+//	W(t) = C * (t - K)^3 + Wmax    with    K = cbrt(Wmax * (1 - beta) / C)
+//
+// where t is the time since the start of the epoch plus the min RTT, and Wmax the window before the last reduction.
+// The window is never below the TCP-friendly estimation of a Reno flow.
+type Cubic struct {
+	epoch              time.Time
+	lastMaxWindow      int
+	originPoint        int
+	timeToOrigin       float64
+	estimatedTCPWindow float64
+}
+
+// NewCubic returns a Cubic without congestion epoch.
+func NewCubic() *Cubic {
+	return new(Cubic)
+}
+
+// Reset forgets the congestion epoch and the last maximum window.
+func (this *Cubic) Reset() {
+	*this = Cubic{}
+}
+
+// CongestionWindowAfterPacketLoss returns the reduced congestion window after a loss, and ends the congestion epoch.
+func (this *Cubic) CongestionWindowAfterPacketLoss(cwnd int) int {
+	if cwnd < this.lastMaxWindow {
+		// The window didn't reach the last maximum: release bandwidth for the new flows
+		this.lastMaxWindow = int(CUBIC_BETA_LAST_MAX * float64(cwnd))
+	} else {
+		this.lastMaxWindow = cwnd
+	}
+	this.epoch = time.Time{}
+	return int(CUBIC_BETA * float64(cwnd))
+}
+
+// CongestionWindowAfterAck returns the congestion window after the acknowledgement of ackedBytes at the event time.
+func (this *Cubic) CongestionWindowAfterAck(ackedBytes int, cwnd int, minRTT time.Duration, eventTime time.Time) int {
+	if this.epoch.IsZero() {
+		this.epoch = eventTime
+		this.estimatedTCPWindow = float64(cwnd)
+		if this.lastMaxWindow <= cwnd {
+			this.timeToOrigin = 0
+			this.originPoint = cwnd
+		} else {
+			this.timeToOrigin = math.Cbrt(float64(this.lastMaxWindow-cwnd) / MAX_SEGMENT_SIZE / CUBIC_C)
+			this.originPoint = this.lastMaxWindow
+		}
+	}
+	t := (eventTime.Sub(this.epoch) + minRTT).Seconds() - this.timeToOrigin
+	target := float64(this.originPoint) + CUBIC_C*t*t*t*MAX_SEGMENT_SIZE
+
+	// TCP-friendly region: a Reno flow grows by CUBIC_RENO_ALPHA packets per RTT
+	this.estimatedTCPWindow += CUBIC_RENO_ALPHA * MAX_SEGMENT_SIZE * float64(ackedBytes) / this.estimatedTCPWindow
+	if this.estimatedTCPWindow > target {
+		return int(this.estimatedTCPWindow)
+	}
+	return int(target)
+}
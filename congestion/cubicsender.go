@@ -0,0 +1,136 @@
+package congestion
+
+import "github.com/romain-jacotin/quic/protocol"
+import "time"
+
+// CubicSender is the TCP-Cubic congestion control: slow start with hybrid slow start exit, then Cubic congestion avoidance.
+//
+// The window is reduced once per loss event: the losses of the packets sent before the last reduction are ignored.
+type CubicSender struct {
+	rttStats                 *RTTStats
+	cubic                    *Cubic
+	hybridSlowStart          HybridSlowStart
+	congestionWindow         int
+	slowStartThreshold       int
+	minCongestionWindow      int
+	maxCongestionWindow      int
+	largestSent              protocol.QuicPacketSequenceNumber
+	largestAcked             protocol.QuicPacketSequenceNumber
+	largestSentAtLastCutback protocol.QuicPacketSequenceNumber
+}
+
+var _ SendAlgorithm = (*CubicSender)(nil)
+
+// NewCubicSender returns a CubicSender with the initial and maximum congestion windows in packets.
+func NewCubicSender(rttStats *RTTStats, initialWindow, maxWindow int) *CubicSender {
+	return &CubicSender{
+		rttStats:            rttStats,
+		cubic:               NewCubic(),
+		congestionWindow:    initialWindow * MAX_SEGMENT_SIZE,
+		slowStartThreshold:  maxWindow * MAX_SEGMENT_SIZE,
+		minCongestionWindow: MIN_CONGESTION_WINDOW * MAX_SEGMENT_SIZE,
+		maxCongestionWindow: maxWindow * MAX_SEGMENT_SIZE}
+}
+
+// OnPacketSent records the largest sent packet.
+func (this *CubicSender) OnPacketSent(sentTime time.Time, bytesInFlight int, seqnum protocol.QuicPacketSequenceNumber, bytes int, retransmittable bool) {
+	if retransmittable && seqnum > this.largestSent {
+		this.largestSent = seqnum
+	}
+}
+
+// OnPacketAcked grows the congestion window, unless the connection is in recovery or not limited by the congestion window.
+func (this *CubicSender) OnPacketAcked(seqnum protocol.QuicPacketSequenceNumber, ackedBytes int, priorInFlight int, eventTime time.Time) {
+	if seqnum > this.largestAcked {
+		this.largestAcked = seqnum
+	}
+	if this.InRecovery() {
+		return
+	}
+	if this.InSlowStart() {
+		if this.hybridSlowStart.IsEndOfRound(seqnum) {
+			this.hybridSlowStart.StartReceiveRound(this.largestSent)
+		}
+		if this.hybridSlowStart.ShouldExitSlowStart(this.rttStats.LatestRTT(), this.rttStats.MinRTT(), this.congestionWindow/MAX_SEGMENT_SIZE) {
+			this.slowStartThreshold = this.congestionWindow
+		}
+	}
+	if !this.isCwndLimited(priorInFlight) {
+		return
+	}
+	if this.InSlowStart() {
+		this.congestionWindow += MAX_SEGMENT_SIZE
+	} else {
+		this.congestionWindow = this.cubic.CongestionWindowAfterAck(ackedBytes, this.congestionWindow, this.rttStats.MinRTT(), eventTime)
+	}
+	if this.congestionWindow > this.maxCongestionWindow {
+		this.congestionWindow = this.maxCongestionWindow
+	}
+}
+
+// OnPacketLost reduces the congestion window, once per loss event.
+func (this *CubicSender) OnPacketLost(seqnum protocol.QuicPacketSequenceNumber, lostBytes int, priorInFlight int) {
+	if seqnum <= this.largestSentAtLastCutback {
+		return
+	}
+	this.congestionWindow = this.cubic.CongestionWindowAfterPacketLoss(this.congestionWindow)
+	if this.congestionWindow < this.minCongestionWindow {
+		this.congestionWindow = this.minCongestionWindow
+	}
+	this.slowStartThreshold = this.congestionWindow
+	this.largestSentAtLastCutback = this.largestSent
+}
+
+// OnCongestionExperienced reduces the congestion window like a loss of the largest packet sent: once per loss event.
+func (this *CubicSender) OnCongestionExperienced() {
+	this.OnPacketLost(this.largestSent, 0, 0)
+}
+
+// OnRetransmissionTimeout collapses the congestion window to the minimum window, and restarts with slow start.
+func (this *CubicSender) OnRetransmissionTimeout(packetsRetransmitted bool) {
+	this.largestSentAtLastCutback = 0
+	if !packetsRetransmitted {
+		return
+	}
+	this.cubic.Reset()
+	this.hybridSlowStart = HybridSlowStart{}
+	this.slowStartThreshold = this.congestionWindow / 2
+	this.congestionWindow = this.minCongestionWindow
+}
+
+// TimeUntilSend returns 0 if the congestion window allows a packet, and INFINITE_DURATION otherwise.
+func (this *CubicSender) TimeUntilSend(now time.Time, bytesInFlight int) time.Duration {
+	if bytesInFlight < this.congestionWindow {
+		return 0
+	}
+	return INFINITE_DURATION
+}
+
+// GetCongestionWindow returns the congestion window in bytes.
+func (this *CubicSender) GetCongestionWindow() int {
+	return this.congestionWindow
+}
+
+// GetSlowStartThreshold returns the slow start threshold in bytes.
+func (this *CubicSender) GetSlowStartThreshold() int {
+	return this.slowStartThreshold
+}
+
+// InSlowStart returns true if the congestion window is below the slow start threshold.
+func (this *CubicSender) InSlowStart() bool {
+	return this.congestionWindow < this.slowStartThreshold
+}
+
+// InRecovery returns true until a packet sent after the last window reduction is acknowledged.
+func (this *CubicSender) InRecovery() bool {
+	return this.largestAcked <= this.largestSentAtLastCutback && this.largestSentAtLastCutback != 0
+}
+
+// isCwndLimited returns true if the bytes in flight fill the congestion window, the window doesn't grow otherwise.
+func (this *CubicSender) isCwndLimited(bytesInFlight int) bool {
+	if bytesInFlight >= this.congestionWindow {
+		return true
+	}
+	available := this.congestionWindow - bytesInFlight
+	return available <= 3*MAX_SEGMENT_SIZE || (this.InSlowStart() && bytesInFlight > this.congestionWindow/2)
+}
@@ -0,0 +1,231 @@
+package congestion
+
+import "github.com/romain-jacotin/quic/protocol"
+import "math"
+import "testing"
+import "time"
+
+// testCubicSim drives a CubicSender with synthetic rounds: the whole congestion window is sent, then acknowledged one RTT later.
+type testCubicSim struct {
+	sender      *CubicSender
+	rttStats    *RTTStats
+	now         time.Time
+	seqnum      protocol.QuicPacketSequenceNumber
+	outstanding []protocol.QuicPacketSequenceNumber
+	inFlight    int
+}
+
+func newTestCubicSim(initialWindow int) *testCubicSim {
+	rttStats := NewRTTStats()
+	return &testCubicSim{
+		sender:   NewCubicSender(rttStats, initialWindow, MAX_CONGESTION_WINDOW),
+		rttStats: rttStats,
+		now:      time.Unix(1000, 0)}
+}
+
+func (this *testCubicSim) sendWindow() {
+	for this.sender.TimeUntilSend(this.now, this.inFlight) == 0 {
+		this.seqnum++
+		this.sender.OnPacketSent(this.now, this.inFlight, this.seqnum, MAX_SEGMENT_SIZE, true)
+		this.outstanding = append(this.outstanding, this.seqnum)
+		this.inFlight += MAX_SEGMENT_SIZE
+	}
+}
+
+func (this *testCubicSim) loseFirst() {
+	this.sender.OnPacketLost(this.outstanding[0], MAX_SEGMENT_SIZE, this.inFlight)
+	this.outstanding = this.outstanding[1:]
+	this.inFlight -= MAX_SEGMENT_SIZE
+}
+
+// ackAll acknowledges the outstanding packets after the RTT, and returns the number of packets acknowledged.
+func (this *testCubicSim) ackAll(rtt time.Duration) int {
+	this.now = this.now.Add(rtt)
+	this.rttStats.UpdateRTT(rtt, 0)
+	prior := this.inFlight
+	n := len(this.outstanding)
+	for _, seqnum := range this.outstanding {
+		this.sender.OnPacketAcked(seqnum, MAX_SEGMENT_SIZE, prior, this.now)
+	}
+	this.outstanding = nil
+	this.inFlight = 0
+	return n
+}
+
+func Test_CubicSender_SlowStart(t *testing.T) {
+	sim := newTestCubicSim(10)
+	for i, w := range []int{20, 40, 80, 160} {
+		sim.sendWindow()
+		if sim.sender.TimeUntilSend(sim.now, sim.inFlight) != INFINITE_DURATION {
+			t.Errorf("CubicSender.TimeUntilSend : full congestion window must block the sender in test n°%v", i)
+		}
+		sim.ackAll(100 * ms)
+		if sim.sender.GetCongestionWindow() != w*MAX_SEGMENT_SIZE || !sim.sender.InSlowStart() {
+			t.Errorf("CubicSender.OnPacketAcked : invalid slow start congestion window %v in test n°%v", sim.sender.GetCongestionWindow()/MAX_SEGMENT_SIZE, i)
+		}
+	}
+
+	// Application limited: the window doesn't grow
+	sim.sender.OnPacketSent(sim.now, 0, sim.seqnum+1, MAX_SEGMENT_SIZE, true)
+	sim.sender.OnPacketAcked(sim.seqnum+1, MAX_SEGMENT_SIZE, MAX_SEGMENT_SIZE, sim.now)
+	if sim.sender.GetCongestionWindow() != 160*MAX_SEGMENT_SIZE {
+		t.Error("CubicSender.OnPacketAcked : the window must not grow when not limited by the congestion window")
+	}
+}
+
+func Test_CubicSender_Loss(t *testing.T) {
+	sim := newTestCubicSim(10)
+	sim.sendWindow()
+	sim.ackAll(100 * ms)
+	sim.sendWindow()
+
+	// One reduction per loss event
+	sim.loseFirst()
+	if sim.sender.GetCongestionWindow() != 14*MAX_SEGMENT_SIZE || sim.sender.GetSlowStartThreshold() != 14*MAX_SEGMENT_SIZE || sim.sender.InSlowStart() {
+		t.Errorf("CubicSender.OnPacketLost : invalid congestion window %v after loss", sim.sender.GetCongestionWindow())
+	}
+	sim.loseFirst()
+	if sim.sender.GetCongestionWindow() != 14*MAX_SEGMENT_SIZE {
+		t.Error("CubicSender.OnPacketLost : the window must be reduced once per loss event")
+	}
+
+	// No growth in recovery
+	if !sim.sender.InRecovery() {
+		t.Error("CubicSender.InRecovery : recovery expected after loss")
+	}
+	sim.ackAll(100 * ms)
+	if sim.sender.GetCongestionWindow() != 14*MAX_SEGMENT_SIZE {
+		t.Errorf("CubicSender.OnPacketAcked : invalid congestion window %v in recovery", sim.sender.GetCongestionWindow())
+	}
+
+	// A loss of a packet sent after the reduction starts a new loss event
+	sim.sendWindow()
+	sim.sender.OnPacketAcked(sim.outstanding[0], MAX_SEGMENT_SIZE, sim.inFlight, sim.now)
+	sim.outstanding = sim.outstanding[1:]
+	sim.inFlight -= MAX_SEGMENT_SIZE
+	if sim.sender.InRecovery() {
+		t.Error("CubicSender.InRecovery : recovery must end with the acknowledgement of a packet sent after the reduction")
+	}
+	w := sim.sender.GetCongestionWindow()
+	sim.loseFirst()
+	if sim.sender.GetCongestionWindow() != int(0.7*float64(w)) {
+		t.Errorf("CubicSender.OnPacketLost : invalid congestion window %v after second loss event", sim.sender.GetCongestionWindow())
+	}
+}
+
+func Test_CubicSender_CongestionExperienced(t *testing.T) {
+	sim := newTestCubicSim(10)
+	sim.sendWindow()
+	sim.ackAll(100 * ms)
+	sim.sendWindow()
+
+	// A CE mark is a loss event without lost packet
+	sim.sender.OnCongestionExperienced()
+	if sim.sender.GetCongestionWindow() != 14*MAX_SEGMENT_SIZE || sim.sender.InSlowStart() || len(sim.outstanding) != 20 {
+		t.Errorf("CubicSender.OnCongestionExperienced : invalid congestion window %v", sim.sender.GetCongestionWindow())
+	}
+	sim.sender.OnCongestionExperienced()
+	if sim.sender.GetCongestionWindow() != 14*MAX_SEGMENT_SIZE {
+		t.Error("CubicSender.OnCongestionExperienced : the window must be reduced once per loss event")
+	}
+}
+
+func Test_CubicSender_MinimumWindow(t *testing.T) {
+	sim := newTestCubicSim(10)
+	for i := 0; i < 10; i++ {
+		sim.sendWindow()
+		sim.loseFirst()
+		if sim.sender.GetCongestionWindow() < MIN_CONGESTION_WINDOW*MAX_SEGMENT_SIZE {
+			t.Errorf("CubicSender.OnPacketLost : congestion window %v below the minimum in test n°%v", sim.sender.GetCongestionWindow(), i)
+		}
+		sim.ackAll(100 * ms)
+	}
+	if sim.sender.GetCongestionWindow() > 3*MAX_SEGMENT_SIZE {
+		t.Errorf("CubicSender.OnPacketLost : congestion window %v must reach the minimum", sim.sender.GetCongestionWindow())
+	}
+}
+
+var tests_cubicwindow = []struct {
+	window int           // congestion window in packets at the loss
+	rtt    time.Duration // constant RTT
+	rounds int
+}{
+	// Cubic region: concave then convex growth around the last maximum window
+	{100, 100 * ms, 60},
+	{200, 50 * ms, 120},
+	// TCP-friendly region: the Reno estimation is above the Cubic window
+	{10, 100 * ms, 30},
+}
+
+// Test_CubicSender_Window checks the window in congestion avoidance against the reference equations:
+// W_cubic(t) = C * (t - K)^3 + Wmax and W_reno^2 = W0^2 + 2 * alpha * acked (packets).
+func Test_CubicSender_Window(t *testing.T) {
+	for i, v := range tests_cubicwindow {
+		sim := newTestCubicSim(v.window)
+		sim.sendWindow()
+		sim.loseFirst()
+		sim.ackAll(v.rtt)
+
+		wmax := float64(v.window)
+		w0 := float64(sim.sender.GetCongestionWindow()) / MAX_SEGMENT_SIZE
+		k := math.Cbrt((wmax - w0) / CUBIC_C)
+		epoch := sim.now.Add(v.rtt)
+		acked := 0.0
+		for r := 0; r < v.rounds; r++ {
+			sim.sendWindow()
+			acked += float64(sim.ackAll(v.rtt))
+
+			t0 := sim.now.Sub(epoch).Seconds() + v.rtt.Seconds() - k
+			expected := math.Max(wmax+CUBIC_C*t0*t0*t0, math.Sqrt(w0*w0+2*CUBIC_RENO_ALPHA*acked))
+			got := float64(sim.sender.GetCongestionWindow()) / MAX_SEGMENT_SIZE
+			if math.Abs(got-expected) > 1 {
+				t.Errorf("CubicSender.OnPacketAcked : congestion window %.2f instead of %.2f at round %v in test n°%v", got, expected, r, i)
+				break
+			}
+		}
+	}
+}
+
+func Test_CubicSender_HybridSlowStart(t *testing.T) {
+	// Constant RTT: no exit
+	sim := newTestCubicSim(16)
+	for i := 0; i < 3; i++ {
+		sim.sendWindow()
+		sim.ackAll(100 * ms)
+	}
+	if !sim.sender.InSlowStart() {
+		t.Error("HybridSlowStart.ShouldExitSlowStart : no exit expected with a constant RTT")
+	}
+
+	// RTT increase above min RTT + min RTT / 8: exit after 8 samples of the round, without loss
+	sim = newTestCubicSim(16)
+	sim.sendWindow()
+	sim.ackAll(100 * ms)
+	sim.sendWindow()
+	sim.ackAll(120 * ms)
+	if sim.sender.InSlowStart() || sim.sender.GetSlowStartThreshold() != 39*MAX_SEGMENT_SIZE {
+		t.Errorf("HybridSlowStart.ShouldExitSlowStart : exit expected, slow start threshold %v", sim.sender.GetSlowStartThreshold()/MAX_SEGMENT_SIZE)
+	}
+
+	// Small RTT increase below the threshold
+	sim = newTestCubicSim(16)
+	sim.sendWindow()
+	sim.ackAll(100 * ms)
+	sim.sendWindow()
+	sim.ackAll(110 * ms)
+	if !sim.sender.InSlowStart() {
+		t.Error("HybridSlowStart.ShouldExitSlowStart : no exit expected below the delay threshold")
+	}
+}
+
+func Test_NewSendAlgorithm(t *testing.T) {
+	s, err := NewSendAlgorithm(CONGESTION_CUBIC, NewRTTStats())
+	if p, ok := s.(*Pacer); err != nil || !ok || s.GetCongestionWindow() != INITIAL_CONGESTION_WINDOW*MAX_SEGMENT_SIZE {
+		t.Errorf("NewSendAlgorithm : paced CubicSender expected (%v)", err)
+	} else if _, ok = p.GetSender().(*CubicSender); !ok {
+		t.Error("NewSendAlgorithm : paced CubicSender expected")
+	}
+	if _, err := NewSendAlgorithm(CongestionControlAlgorithm(-1), NewRTTStats()); err == nil {
+		t.Error("NewSendAlgorithm : unknown algorithm must be rejected")
+	}
+}
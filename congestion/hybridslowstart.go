@@ -0,0 +1,56 @@
+package congestion
+
+import "github.com/romain-jacotin/quic/protocol"
+import "time"
+
+const (
+	// HYBRID_START_LOW_WINDOW is the congestion window in packets below which the slow start never exits on delay increase
+	HYBRID_START_LOW_WINDOW = 16
+	// HYBRID_START_MIN_SAMPLES is the number of RTT samples of a round used to detect the delay increase
+	HYBRID_START_MIN_SAMPLES = 8
+	// HYBRID_START_DELAY_MIN_THRESHOLD and HYBRID_START_DELAY_MAX_THRESHOLD clamp the delay increase threshold (min RTT / 8)
+	HYBRID_START_DELAY_MIN_THRESHOLD = 4 * time.Millisecond
+	HYBRID_START_DELAY_MAX_THRESHOLD = 16 * time.Millisecond
+)
+
+// HybridSlowStart exits the slow start when the RTT of a round increases above the min RTT, before the losses (HyStart).
+type HybridSlowStart struct {
+	endOfRound    protocol.QuicPacketSequenceNumber
+	started       bool
+	sampleCount   int
+	currentMinRTT time.Duration
+}
+
+// IsEndOfRound returns true if the acknowledged packet ends the current round.
+func (this *HybridSlowStart) IsEndOfRound(ack protocol.QuicPacketSequenceNumber) bool {
+	return !this.started || this.endOfRound < ack
+}
+
+// StartReceiveRound starts a round that ends with the last sent packet.
+func (this *HybridSlowStart) StartReceiveRound(lastSent protocol.QuicPacketSequenceNumber) {
+	this.endOfRound = lastSent
+	this.started = true
+	this.sampleCount = 0
+	this.currentMinRTT = 0
+}
+
+// ShouldExitSlowStart returns true if the min of the first RTT samples of the round exceeds the min RTT by the threshold.
+func (this *HybridSlowStart) ShouldExitSlowStart(latestRTT, minRTT time.Duration, cwndPackets int) bool {
+	if this.sampleCount >= HYBRID_START_MIN_SAMPLES {
+		return false
+	}
+	this.sampleCount++
+	if this.currentMinRTT == 0 || latestRTT < this.currentMinRTT {
+		this.currentMinRTT = latestRTT
+	}
+	if this.sampleCount < HYBRID_START_MIN_SAMPLES || cwndPackets < HYBRID_START_LOW_WINDOW {
+		return false
+	}
+	threshold := minRTT / 8
+	if threshold < HYBRID_START_DELAY_MIN_THRESHOLD {
+		threshold = HYBRID_START_DELAY_MIN_THRESHOLD
+	} else if threshold > HYBRID_START_DELAY_MAX_THRESHOLD {
+		threshold = HYBRID_START_DELAY_MAX_THRESHOLD
+	}
+	return this.currentMinRTT > minRTT+threshold
+}
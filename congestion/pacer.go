@@ -0,0 +1,123 @@
+package congestion
+
+import "github.com/romain-jacotin/quic/protocol"
+import "time"
+
+const (
+	// PACING_INITIAL_BURST is the number of packets sent without pacing after a quiescence
+	PACING_INITIAL_BURST = 10
+	// PACING_GRANULARITY is the delay below which a packet is sent without waiting for the timer
+	PACING_GRANULARITY = time.Millisecond
+	// PACING_SLOW_START_GAIN is the pacing rate multiplier of the congestion window per smoothed RTT during slow start
+	PACING_SLOW_START_GAIN = 1.25
+)
+
+// Pacer spaces the packets sent by a congestion control at the rate of the congestion window per smoothed RTT,
+// to avoid the losses of a full window sent at once in the queues of the routers.
+//
+// PACING_INITIAL_BURST packets are sent without pacing when the bytes in flight drop to 0, after an application limited period.
+type Pacer struct {
+	sender                  SendAlgorithm
+	rttStats                *RTTStats
+	burstTokens             int
+	idealNextPacketSendTime time.Time
+}
+
+var _ SendAlgorithm = (*Pacer)(nil)
+
+// NewPacer returns a Pacer of the congestion control, using the RTT statistics of the connection.
+func NewPacer(sender SendAlgorithm, rttStats *RTTStats) *Pacer {
+	return &Pacer{sender: sender, rttStats: rttStats}
+}
+
+// GetSender returns the paced congestion control.
+func (this *Pacer) GetSender() SendAlgorithm {
+	return this.sender
+}
+
+// OnPacketSent schedules the ideal send time of the next packet, or consumes a burst token.
+func (this *Pacer) OnPacketSent(sentTime time.Time, bytesInFlight int, seqnum protocol.QuicPacketSequenceNumber, bytes int, retransmittable bool) {
+	this.sender.OnPacketSent(sentTime, bytesInFlight, seqnum, bytes, retransmittable)
+	if !retransmittable {
+		return
+	}
+	if bytesInFlight == 0 {
+		// Quiescence: restore the burst budget, limited by the congestion window
+		this.burstTokens = PACING_INITIAL_BURST
+		if w := this.sender.GetCongestionWindow() / MAX_SEGMENT_SIZE; w < this.burstTokens {
+			this.burstTokens = w
+		}
+	}
+	if this.burstTokens > 0 {
+		this.burstTokens--
+		this.idealNextPacketSendTime = time.Time{}
+		return
+	}
+	// A late packet restarts the schedule from its send time, the credit of the lateness is limited to the granularity
+	if this.idealNextPacketSendTime.Add(PACING_GRANULARITY).Before(sentTime) {
+		this.idealNextPacketSendTime = sentTime
+	}
+	this.idealNextPacketSendTime = this.idealNextPacketSendTime.Add(this.PacingDelay(bytes))
+}
+
+// OnPacketAcked forwards the acknowledgement to the congestion control.
+func (this *Pacer) OnPacketAcked(seqnum protocol.QuicPacketSequenceNumber, ackedBytes int, priorInFlight int, eventTime time.Time) {
+	this.sender.OnPacketAcked(seqnum, ackedBytes, priorInFlight, eventTime)
+}
+
+// OnPacketLost forwards the loss to the congestion control, and cancels the burst budget.
+func (this *Pacer) OnPacketLost(seqnum protocol.QuicPacketSequenceNumber, lostBytes int, priorInFlight int) {
+	this.sender.OnPacketLost(seqnum, lostBytes, priorInFlight)
+	this.burstTokens = 0
+}
+
+// OnCongestionExperienced forwards the mark to the congestion control, and cancels the burst budget.
+func (this *Pacer) OnCongestionExperienced() {
+	this.sender.OnCongestionExperienced()
+	this.burstTokens = 0
+}
+
+// OnRetransmissionTimeout forwards the retransmission timeout to the congestion control, and cancels the burst budget.
+func (this *Pacer) OnRetransmissionTimeout(packetsRetransmitted bool) {
+	this.sender.OnRetransmissionTimeout(packetsRetransmitted)
+	this.burstTokens = 0
+}
+
+// TimeUntilSend returns the delay of the congestion control, or the delay until the ideal send time of the next packet.
+func (this *Pacer) TimeUntilSend(now time.Time, bytesInFlight int) time.Duration {
+	if d := this.sender.TimeUntilSend(now, bytesInFlight); d != 0 {
+		return d
+	}
+	if this.burstTokens > 0 || bytesInFlight == 0 {
+		return 0
+	}
+	if this.idealNextPacketSendTime.After(now.Add(PACING_GRANULARITY)) {
+		return this.idealNextPacketSendTime.Sub(now)
+	}
+	return 0
+}
+
+// GetCongestionWindow returns the congestion window of the paced congestion control.
+func (this *Pacer) GetCongestionWindow() int {
+	return this.sender.GetCongestionWindow()
+}
+
+// InSlowStart returns true if the paced congestion control is in slow start.
+func (this *Pacer) InSlowStart() bool {
+	return this.sender.InSlowStart()
+}
+
+// PacingDelay returns the delay between two packets of the given size: the smoothed RTT divided by the congestion window in packets,
+// and by PACING_SLOW_START_GAIN during slow start. There is no pacing before the first RTT sample.
+func (this *Pacer) PacingDelay(bytes int) time.Duration {
+	srtt := this.rttStats.SmoothedRTT()
+	cwnd := this.sender.GetCongestionWindow()
+	if srtt == 0 || cwnd == 0 {
+		return 0
+	}
+	delay := float64(srtt) * float64(bytes) / float64(cwnd)
+	if this.sender.InSlowStart() {
+		delay /= PACING_SLOW_START_GAIN
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,118 @@
+package congestion
+
+import "github.com/romain-jacotin/quic/protocol"
+import "testing"
+import "time"
+
+// testPacedSender sends packets at the times allowed by the pacer with a fake clock, and returns the send times relative to the start.
+func testPacedSender(pacer *Pacer, start time.Time, seqnum *protocol.QuicPacketSequenceNumber, inFlight *int, count int) []time.Duration {
+	var times []time.Duration
+
+	now := start
+	for len(times) < count {
+		d := pacer.TimeUntilSend(now, *inFlight)
+		if d == INFINITE_DURATION {
+			break
+		}
+		now = now.Add(d)
+		*seqnum++
+		pacer.OnPacketSent(now, *inFlight, *seqnum, MAX_SEGMENT_SIZE, true)
+		*inFlight += MAX_SEGMENT_SIZE
+		times = append(times, now.Sub(start))
+	}
+	return times
+}
+
+func Test_Pacer_SlowStart(t *testing.T) {
+	rttStats := NewRTTStats()
+	rttStats.UpdateRTT(100*ms, 0)
+	pacer := NewPacer(NewCubicSender(rttStats, 20, MAX_CONGESTION_WINDOW), rttStats)
+	var seqnum protocol.QuicPacketSequenceNumber
+	inFlight := 0
+
+	// Burst of 10 packets, the next packet starts the schedule: 100ms / 20 packets / 1.25 = 4ms
+	times := testPacedSender(pacer, time.Unix(1000, 0), &seqnum, &inFlight, 100)
+	if len(times) != 20 {
+		t.Fatalf("Pacer.TimeUntilSend : 20 packets expected in the congestion window instead of %v", len(times))
+	}
+	for i, d := range times {
+		expected := time.Duration(0)
+		if i > PACING_INITIAL_BURST {
+			expected = time.Duration(i-PACING_INITIAL_BURST) * 4 * ms
+		}
+		if d != expected {
+			t.Errorf("Pacer.TimeUntilSend : packet sent at %v instead of %v in test n°%v", d, expected, i)
+		}
+	}
+}
+
+func Test_Pacer_CongestionAvoidance(t *testing.T) {
+	rttStats := NewRTTStats()
+	rttStats.UpdateRTT(100*ms, 0)
+	sender := NewCubicSender(rttStats, 20, MAX_CONGESTION_WINDOW)
+	pacer := NewPacer(sender, rttStats)
+	var seqnum protocol.QuicPacketSequenceNumber
+	inFlight := 0
+	start := time.Unix(1000, 0)
+
+	testPacedSender(pacer, start, &seqnum, &inFlight, 20)
+	// Loss: window of 14 packets, no burst, paced at 100ms / 14 packets
+	pacer.OnPacketLost(1, MAX_SEGMENT_SIZE, inFlight)
+	inFlight = 8 * MAX_SEGMENT_SIZE
+	if pacer.InSlowStart() || pacer.GetCongestionWindow() != 14*MAX_SEGMENT_SIZE {
+		t.Fatalf("Pacer.OnPacketLost : invalid congestion window %v", pacer.GetCongestionWindow())
+	}
+	rtt := 100 * ms
+	gap := time.Duration(float64(rtt) / 14)
+	// The slow start schedule ends at 40ms
+	start = start.Add(40 * ms)
+	times := testPacedSender(pacer, start, &seqnum, &inFlight, 4)
+	if len(times) != 4 || times[0] != 0 {
+		t.Fatalf("Pacer.TimeUntilSend : 4 packets expected instead of %v", times)
+	}
+	for i := 1; i < len(times); i++ {
+		if d := times[i] - times[i-1]; d != gap {
+			t.Errorf("Pacer.TimeUntilSend : gap %v instead of %v in test n°%v", d, gap, i)
+		}
+	}
+
+	// A late send loop doesn't accumulate sending credit
+	now := start.Add(times[3] + 20*ms)
+	seqnum++
+	pacer.OnPacketSent(now, inFlight, seqnum, MAX_SEGMENT_SIZE, true)
+	inFlight += MAX_SEGMENT_SIZE
+	if d := pacer.TimeUntilSend(now, inFlight); d != gap {
+		t.Errorf("Pacer.TimeUntilSend : gap %v instead of %v after a late packet", d, gap)
+	}
+}
+
+func Test_Pacer_ApplicationLimited(t *testing.T) {
+	rttStats := NewRTTStats()
+	rttStats.UpdateRTT(100*ms, 0)
+	pacer := NewPacer(NewCubicSender(rttStats, 40, MAX_CONGESTION_WINDOW), rttStats)
+	var seqnum protocol.QuicPacketSequenceNumber
+	inFlight := 0
+	start := time.Unix(1000, 0)
+
+	// The application sends 12 packets only: burst then pacing
+	times := testPacedSender(pacer, start, &seqnum, &inFlight, 12)
+	if times[PACING_INITIAL_BURST] != 0 || times[PACING_INITIAL_BURST+1] != 2*ms {
+		t.Errorf("Pacer.TimeUntilSend : invalid send times %v", times)
+	}
+
+	// All acknowledged, the application limited period restores the burst budget
+	start = start.Add(200 * ms)
+	for s := protocol.QuicPacketSequenceNumber(1); s <= seqnum; s++ {
+		pacer.OnPacketAcked(s, MAX_SEGMENT_SIZE, inFlight, start)
+	}
+	inFlight = 0
+	times = testPacedSender(pacer, start, &seqnum, &inFlight, PACING_INITIAL_BURST+2)
+	for i, d := range times {
+		if i <= PACING_INITIAL_BURST && d != 0 {
+			t.Errorf("Pacer.OnPacketSent : burst expected after the application limited period, packet sent at %v in test n°%v", d, i)
+		}
+	}
+	if times[PACING_INITIAL_BURST+1] == 0 {
+		t.Error("Pacer.TimeUntilSend : pacing expected after the burst")
+	}
+}
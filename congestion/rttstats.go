@@ -0,0 +1,105 @@
+package congestion
+
+import "sync"
+import "time"
+
+// RTTStats estimates the round-trip time of the connection from the RTT samples of the acknowledged packets.
+//
+// The smoothed RTT and the mean deviation are exponentially weighted moving averages with the standard
+// weights of 1/8 and 1/4 (RFC 6298). The loss recovery updates the estimation while the flow controllers of the streams read it,
+// so the methods are safe for concurrent use.
+type RTTStats struct {
+	mutex         sync.RWMutex
+	latestRTT     time.Duration
+	minRTT        time.Duration
+	smoothedRTT   time.Duration
+	meanDeviation time.Duration
+}
+
+// NewRTTStats returns an RTTStats without RTT sample.
+func NewRTTStats() *RTTStats {
+	return new(RTTStats)
+}
+
+// UpdateRTT updates the estimation with the RTT sample of the largest acknowledged packet and the ACK delay reported by the peer.
+//
+// The ACK delay is subtracted from the sample, unless the result would be below the min RTT.
+// Samples that are not positive are ignored.
+func (this *RTTStats) UpdateRTT(sample, ackDelay time.Duration) {
+	if sample <= 0 {
+		return
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	// The min RTT doesn't use the ACK delay, that can be wrong
+	if this.minRTT == 0 || sample < this.minRTT {
+		this.minRTT = sample
+	}
+	if sample-ackDelay >= this.minRTT {
+		sample -= ackDelay
+	}
+	this.latestRTT = sample
+
+	if this.smoothedRTT == 0 {
+		this.smoothedRTT = sample
+		this.meanDeviation = sample / 2
+		return
+	}
+	this.meanDeviation = (3*this.meanDeviation + absDuration(this.smoothedRTT-sample)) / 4
+	this.smoothedRTT = (7*this.smoothedRTT + sample) / 8
+}
+
+// ExpireSmoothedMetrics makes the smoothed RTT and the mean deviation at least as large as the latest RTT sample,
+// after a retransmission timeout has shown that the estimation is too low.
+func (this *RTTStats) ExpireSmoothedMetrics() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if d := absDuration(this.smoothedRTT - this.latestRTT); d > this.meanDeviation {
+		this.meanDeviation = d
+	}
+	if this.latestRTT > this.smoothedRTT {
+		this.smoothedRTT = this.latestRTT
+	}
+}
+
+// Reset forgets the RTT samples, when the connection moves to a new path.
+func (this *RTTStats) Reset() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.latestRTT, this.minRTT, this.smoothedRTT, this.meanDeviation = 0, 0, 0, 0
+}
+
+// LatestRTT returns the latest RTT sample, less the ACK delay.
+func (this *RTTStats) LatestRTT() time.Duration {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.latestRTT
+}
+
+// MinRTT returns the smallest RTT sample, or 0 before the first sample.
+func (this *RTTStats) MinRTT() time.Duration {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.minRTT
+}
+
+// SmoothedRTT returns the smoothed RTT, or 0 before the first sample.
+func (this *RTTStats) SmoothedRTT() time.Duration {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.smoothedRTT
+}
+
+// MeanDeviation returns the mean deviation of the RTT samples.
+func (this *RTTStats) MeanDeviation() time.Duration {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.meanDeviation
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
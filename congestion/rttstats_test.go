@@ -0,0 +1,69 @@
+package congestion
+
+import "testing"
+import "time"
+
+const ms = time.Millisecond
+
+var tests_rttstats = []struct {
+	samples       [][2]time.Duration // RTT sample and ACK delay
+	latestRTT     time.Duration
+	minRTT        time.Duration
+	smoothedRTT   time.Duration
+	meanDeviation time.Duration
+}{
+	{[][2]time.Duration{{100 * ms, 0}}, 100 * ms, 100 * ms, 100 * ms, 50 * ms},
+	{[][2]time.Duration{{100 * ms, 0}, {200 * ms, 0}}, 200 * ms, 100 * ms, 112500 * time.Microsecond, 62500 * time.Microsecond},
+	// ACK delay subtracted
+	{[][2]time.Duration{{100 * ms, 0}, {150 * ms, 30 * ms}}, 120 * ms, 100 * ms, 102500 * time.Microsecond, 42500 * time.Microsecond},
+	// ACK delay ignored: the sample would be below the min RTT
+	{[][2]time.Duration{{100 * ms, 0}, {110 * ms, 30 * ms}}, 110 * ms, 100 * ms, 101250 * time.Microsecond, 40 * ms},
+	// Min RTT tracking
+	{[][2]time.Duration{{100 * ms, 0}, {50 * ms, 0}}, 50 * ms, 50 * ms, 93750 * time.Microsecond, 50 * ms},
+	// The first sample is the min RTT, the ACK delay can't be subtracted
+	{[][2]time.Duration{{100 * ms, 10 * ms}}, 100 * ms, 100 * ms, 100 * ms, 50 * ms},
+	// Invalid samples
+	{[][2]time.Duration{{100 * ms, 0}, {0, 0}, {-10 * ms, 0}}, 100 * ms, 100 * ms, 100 * ms, 50 * ms},
+	{[][2]time.Duration{{100 * ms, 0}, {100 * ms, 0}, {100 * ms, 0}, {100 * ms, 0}}, 100 * ms, 100 * ms, 100 * ms, 21093750 * time.Nanosecond},
+}
+
+func Test_RTTStats(t *testing.T) {
+	for i, v := range tests_rttstats {
+		rtt := NewRTTStats()
+		for _, s := range v.samples {
+			rtt.UpdateRTT(s[0], s[1])
+		}
+		if rtt.LatestRTT() != v.latestRTT || rtt.MinRTT() != v.minRTT || rtt.SmoothedRTT() != v.smoothedRTT || rtt.MeanDeviation() != v.meanDeviation {
+			t.Errorf("RTTStats.UpdateRTT : invalid latest %v, min %v, smoothed %v or mean deviation %v in test n°%v",
+				rtt.LatestRTT(), rtt.MinRTT(), rtt.SmoothedRTT(), rtt.MeanDeviation(), i)
+		}
+	}
+}
+
+func Test_RTTStats_ExpireSmoothedMetrics(t *testing.T) {
+	rtt := NewRTTStats()
+	rtt.UpdateRTT(100*ms, 0)
+	rtt.UpdateRTT(200*ms, 0)
+	rtt.ExpireSmoothedMetrics()
+	if rtt.SmoothedRTT() != 200*ms || rtt.MeanDeviation() != 87500*time.Microsecond {
+		t.Errorf("RTTStats.ExpireSmoothedMetrics : invalid smoothed %v or mean deviation %v", rtt.SmoothedRTT(), rtt.MeanDeviation())
+	}
+	rtt.UpdateRTT(50*ms, 0)
+	rtt.ExpireSmoothedMetrics()
+	if rtt.SmoothedRTT() != 181250*time.Microsecond {
+		t.Errorf("RTTStats.ExpireSmoothedMetrics : smoothed RTT must not decrease, %v", rtt.SmoothedRTT())
+	}
+}
+
+func Test_RTTStats_Reset(t *testing.T) {
+	rtt := NewRTTStats()
+	rtt.UpdateRTT(100*ms, 0)
+	rtt.Reset()
+	if rtt.LatestRTT() != 0 || rtt.MinRTT() != 0 || rtt.SmoothedRTT() != 0 || rtt.MeanDeviation() != 0 {
+		t.Errorf("RTTStats.Reset : no RTT sample expected")
+	}
+	rtt.UpdateRTT(50*ms, 0)
+	if rtt.MinRTT() != 50*ms || rtt.SmoothedRTT() != 50*ms {
+		t.Errorf("RTTStats.Reset : the next sample must be the first one, min %v and smoothed %v", rtt.MinRTT(), rtt.SmoothedRTT())
+	}
+}
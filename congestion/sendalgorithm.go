@@ -0,0 +1,60 @@
+package congestion
+
+import "github.com/romain-jacotin/quic/protocol"
+import "errors"
+import "math"
+import "time"
+
+const (
+	// MAX_SEGMENT_SIZE is the packet size used by the congestion window computations
+	MAX_SEGMENT_SIZE = 1350
+	// INITIAL_CONGESTION_WINDOW is the initial congestion window in packets
+	INITIAL_CONGESTION_WINDOW = 32
+	// MAX_CONGESTION_WINDOW is the maximum congestion window in packets
+	MAX_CONGESTION_WINDOW = 2000
+	// MIN_CONGESTION_WINDOW is the minimum congestion window in packets
+	MIN_CONGESTION_WINDOW = 2
+	// INFINITE_DURATION is returned by TimeUntilSend when the congestion window is full
+	INFINITE_DURATION = time.Duration(math.MaxInt64)
+)
+
+// CongestionControlAlgorithm selects the congestion control of a connection.
+type CongestionControlAlgorithm int
+
+const (
+	CONGESTION_CUBIC CongestionControlAlgorithm = iota
+	CONGESTION_BBR
+)
+
+// SendAlgorithm is the congestion control of a connection, fed by the sent packet handler.
+type SendAlgorithm interface {
+	// OnPacketSent is called when a packet is sent, bytesInFlight doesn't include the packet
+	OnPacketSent(sentTime time.Time, bytesInFlight int, seqnum protocol.QuicPacketSequenceNumber, bytes int, retransmittable bool)
+	// OnPacketAcked is called for each packet acknowledged, priorInFlight is the bytes in flight before the ACK frame
+	OnPacketAcked(seqnum protocol.QuicPacketSequenceNumber, ackedBytes int, priorInFlight int, eventTime time.Time)
+	// OnPacketLost is called for each packet declared lost, priorInFlight is the bytes in flight before the ACK frame
+	OnPacketLost(seqnum protocol.QuicPacketSequenceNumber, lostBytes int, priorInFlight int)
+	// OnRetransmissionTimeout is called on retransmission timeout, packetsRetransmitted is false if no packet was in flight
+	OnRetransmissionTimeout(packetsRetransmitted bool)
+	// OnCongestionExperienced is called when a packet is received with the Congestion Experienced ECN mark
+	OnCongestionExperienced()
+	// TimeUntilSend returns the delay before the next packet can be sent, or INFINITE_DURATION if the congestion window is full
+	TimeUntilSend(now time.Time, bytesInFlight int) time.Duration
+	// GetCongestionWindow returns the congestion window in bytes
+	GetCongestionWindow() int
+	// InSlowStart returns true if the congestion window grows exponentially
+	InSlowStart() bool
+}
+
+// NewSendAlgorithm returns the paced congestion control algorithm of a connection, using the RTT statistics of its sent packet handler.
+//
+// BBR paces its packets at its own rate, Cubic is wrapped in a Pacer.
+func NewSendAlgorithm(algorithm CongestionControlAlgorithm, rttStats *RTTStats) (SendAlgorithm, error) {
+	switch algorithm {
+	case CONGESTION_CUBIC:
+		return NewPacer(NewCubicSender(rttStats, INITIAL_CONGESTION_WINDOW, MAX_CONGESTION_WINDOW), rttStats), nil
+	case CONGESTION_BBR:
+		return NewBBRSender(rttStats, INITIAL_CONGESTION_WINDOW, MAX_CONGESTION_WINDOW), nil
+	}
+	return nil, errors.New("NewSendAlgorithm : unknown congestion control algorithm")
+}
@@ -0,0 +1,114 @@
+package quic
+
+import "github.com/romain-jacotin/quic/protocol"
+import "context"
+import "errors"
+import "fmt"
+import "io"
+import "net"
+import "sync/atomic"
+import "time"
+
+// StreamAddr is the network address of a stream used as a net.Conn: the UDP address of the session and the Stream ID.
+type StreamAddr struct {
+	Addr     net.Addr
+	StreamID protocol.QuicStreamID
+}
+
+// Network returns "quic".
+func (this StreamAddr) Network() string {
+	return "quic"
+}
+
+// String returns the UDP address followed by the Stream ID, like "127.0.0.1:443/5".
+func (this StreamAddr) String() string {
+	return fmt.Sprintf("%v/%d", this.Addr, this.StreamID)
+}
+
+// streamConn adapts a Stream to net.Conn: Close shuts both sides of the stream down, and unblocks the pending Read and Write.
+// The errors other than io.EOF are returned as *net.OpError, net.ErrClosed after Close.
+type streamConn struct {
+	stream Stream
+	local  StreamAddr
+	remote StreamAddr
+	closed atomic.Bool
+}
+
+var _ net.Conn = (*streamConn)(nil)
+
+// newStreamConn returns the net.Conn of the stream of the session.
+func newStreamConn(s Stream, session Session) *streamConn {
+	return &streamConn{
+		stream: s,
+		local:  StreamAddr{Addr: session.LocalAddr(), StreamID: s.GetStreamID()},
+		remote: StreamAddr{Addr: session.RemoteAddr(), StreamID: s.GetStreamID()}}
+}
+
+// OpenConn opens a new stream as a net.Conn, it blocks like OpenStream.
+func (this *session) OpenConn() (net.Conn, error) {
+	s, err := this.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	return newStreamConn(s, this), nil
+}
+
+// AcceptConn returns the next stream opened by the peer as a net.Conn, it blocks like AcceptStream.
+func (this *session) AcceptConn(ctx context.Context) (net.Conn, error) {
+	s, err := this.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamConn(s, this), nil
+}
+
+func (this *streamConn) Read(b []byte) (int, error) {
+	n, err := this.stream.Read(b)
+	return n, this.opError("read", err)
+}
+
+func (this *streamConn) Write(b []byte) (int, error) {
+	n, err := this.stream.Write(b)
+	return n, this.opError("write", err)
+}
+
+// Close sends the FIN after the data written and discards the data received, the pending Write is interrupted.
+func (this *streamConn) Close() error {
+	if this.closed.Swap(true) {
+		return this.opError("close", net.ErrClosed)
+	}
+	this.stream.CloseRead()
+	this.stream.SetWriteDeadline(time.Now())
+	return this.stream.CloseWrite()
+}
+
+func (this *streamConn) LocalAddr() net.Addr {
+	return this.local
+}
+
+func (this *streamConn) RemoteAddr() net.Addr {
+	return this.remote
+}
+
+func (this *streamConn) SetDeadline(t time.Time) error {
+	return this.stream.SetDeadline(t)
+}
+
+func (this *streamConn) SetReadDeadline(t time.Time) error {
+	return this.stream.SetReadDeadline(t)
+}
+
+func (this *streamConn) SetWriteDeadline(t time.Time) error {
+	return this.stream.SetWriteDeadline(t)
+}
+
+// opError returns the error of the operation as a *net.OpError, io.EOF is returned as is.
+func (this *streamConn) opError(op string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	if this.closed.Load() && !errors.Is(err, net.ErrClosed) {
+		err = net.ErrClosed
+	}
+	return &net.OpError{Op: op, Net: "quic", Source: this.local, Addr: this.remote, Err: err}
+}
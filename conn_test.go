@@ -0,0 +1,119 @@
+package quic
+
+import "context"
+import "errors"
+import "io"
+import "io/ioutil"
+import "net"
+import "net/rpc"
+import "os"
+import "testing"
+import "time"
+
+// Arith is the net/rpc service of the tests.
+type Arith int
+
+type ArithArgs struct {
+	A, B int
+}
+
+func (this *Arith) Multiply(args *ArithArgs, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func Test_Conn_RPC(t *testing.T) {
+	client, server, closeSessions := newSimulatedSessions(t, newInstantNetwork(), nil, nil)
+	defer closeSessions()
+
+	rpcServer := rpc.NewServer()
+	rpcServer.Register(new(Arith))
+	go func() {
+		for {
+			conn, err := server.AcceptConn(context.Background())
+			if err != nil {
+				return
+			}
+			go rpcServer.ServeConn(conn)
+		}
+	}()
+
+	// net/rpc runs unmodified over the net.Conn of a stream
+	conn, err := client.OpenConn()
+	if err != nil {
+		t.Fatalf("Session.OpenConn : unexpected error %v", err)
+	}
+	rpcClient := rpc.NewClient(conn)
+	defer rpcClient.Close()
+	for i := 0; i < 10; i++ {
+		var reply int
+		if err = rpcClient.Call("Arith.Multiply", &ArithArgs{A: i, B: 7}, &reply); err != nil || reply != i*7 {
+			t.Errorf("rpc.Client.Call : %v expected instead of %v (%v) in test n°%v", i*7, reply, err, i)
+		}
+	}
+}
+
+func Test_Conn(t *testing.T) {
+	client, server, closeSessions := newSimulatedSessions(t, newInstantNetwork(), nil, nil)
+	defer closeSessions()
+
+	conn, err := client.OpenConn()
+	if err != nil {
+		t.Fatalf("Session.OpenConn : unexpected error %v", err)
+	}
+	conn.Write([]byte("hello"))
+	peer, err := server.AcceptConn(context.Background())
+	if err != nil {
+		t.Fatalf("Session.AcceptConn : unexpected error %v", err)
+	}
+
+	// The addresses are the addresses of the PacketConns with the Stream ID
+	if addr, ok := conn.LocalAddr().(StreamAddr); !ok || addr.Network() != "quic" || addr.String() != "10.0.0.1:443/5" {
+		t.Errorf("Conn.LocalAddr : 10.0.0.1:443/5 expected instead of %v", conn.LocalAddr())
+	}
+	if addr := peer.LocalAddr().String(); addr != "10.0.0.2:443/5" || peer.RemoteAddr().String() != conn.LocalAddr().String() {
+		t.Errorf("Conn.LocalAddr : 10.0.0.2:443/5 expected instead of %v", addr)
+	}
+
+	// The read deadline is a timeout error
+	buf := make([]byte, 5)
+	if _, err = io.ReadFull(peer, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("Conn.Read : \"hello\" expected instead of %q (%v)", buf, err)
+	}
+	peer.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	var nerr net.Error
+	if _, err = peer.Read(buf); !errors.As(err, &nerr) || !nerr.Timeout() || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Conn.Read : timeout expected instead of %v", err)
+	}
+	peer.SetReadDeadline(time.Time{})
+
+	// Close unblocks the pending Read, then the peer reads io.EOF
+	read := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(buf)
+		read <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err = conn.Close(); err != nil {
+		t.Errorf("Conn.Close : unexpected error %v", err)
+	}
+	select {
+	case err = <-read:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Conn.Read : net.ErrClosed expected instead of %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Conn.Close : the pending Read must return")
+	}
+	if _, err = conn.Write([]byte("x")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Conn.Write : net.ErrClosed expected instead of %v", err)
+	}
+	if err = conn.Close(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Conn.Close : net.ErrClosed expected instead of %v", err)
+	}
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if data, err := ioutil.ReadAll(peer); err != nil || len(data) != 0 {
+		t.Errorf("Conn.Read : io.EOF expected instead of %q (%v)", data, err)
+	}
+	peer.Close()
+}
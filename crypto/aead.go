@@ -1,6 +1,31 @@
 package crypto
 
 import "github.com/romain-jacotin/quic/protocol"
+import "errors"
+import "fmt"
+import "sync"
+
+// ErrAuthenticationFailed is returned by Open when the tag doesn't match the ciphertext and additional data.
+var ErrAuthenticationFailed = errors.New("AEAD.Open : message authentication failed")
+
+// ErrBadKeyLength matches with errors.Is the errors of a key, a nonce or an IV of the wrong length: a programming error,
+// unlike ErrAuthenticationFailed that any packet of an attacker can cause.
+var ErrBadKeyLength = errors.New("crypto : bad key length")
+
+// keyLengthError is the error of a key, a nonce or an IV of the wrong length, it matches ErrBadKeyLength.
+type keyLengthError string
+
+func (this keyLengthError) Error() string {
+	return string(this)
+}
+
+// Is returns true for ErrBadKeyLength.
+func (this keyLengthError) Is(target error) bool {
+	return target == ErrBadKeyLength
+}
+
+// ErrCipherClosed is returned when a cipher is used after Close has zeroed its key material.
+var ErrCipherClosed = errors.New("Cipher : cipher is closed, key material has been zeroed")
 
 type AEAD interface {
 	// Open
@@ -9,4 +34,56 @@ type AEAD interface {
 	Seal(sequencenumber protocol.QuicPacketSequenceNumber, ciphertext, aad, plaintext []byte) (bytescount int, err error)
 	// GetMacSize
 	GetMacSize() int
+	// Close zeroes the key material, the AEAD can't be used anymore
+	Close() error
+}
+
+// The packet packer and unpacker of the protocol package use the AEAD interface
+var _ protocol.PacketSealer = AEAD(nil)
+var _ protocol.PacketOpener = AEAD(nil)
+
+// AEADFactory returns an AEAD keyed with the key and the nonce prefix (iv) derived for the connection.
+type AEADFactory func(key, iv []byte) (AEAD, error)
+
+// ErrUnsupportedAEAD is returned by LookupAEAD when no AEAD is registered for the QUIC tag.
+type ErrUnsupportedAEAD struct {
+	Tag uint32
+}
+
+func (this ErrUnsupportedAEAD) Error() string {
+	return fmt.Sprintf("LookupAEAD : unsupported AEAD tag %q", []byte{byte(this.Tag), byte(this.Tag >> 8), byte(this.Tag >> 16), byte(this.Tag >> 24)})
+}
+
+var aeadRegistry = struct {
+	sync.RWMutex
+	factories map[uint32]AEADFactory
+}{factories: make(map[uint32]AEADFactory)}
+
+func init() {
+	RegisterAEAD(uint32(protocol.TagCC20), NewAEAD_ChaCha20Poly1305)
+	RegisterAEAD(uint32(protocol.TagAESG), NewAEAD_AES128GCM12)
+}
+
+// RegisterAEAD registers the AEAD factory for the QUIC tag (CC20, AESG, ...) negotiated during the handshake.
+//
+// A factory already registered for the tag is replaced, a nil factory unregisters the tag.
+func RegisterAEAD(tag uint32, factory func(key, iv []byte) (AEAD, error)) {
+	aeadRegistry.Lock()
+	if factory == nil {
+		delete(aeadRegistry.factories, tag)
+	} else {
+		aeadRegistry.factories[tag] = factory
+	}
+	aeadRegistry.Unlock()
+}
+
+// LookupAEAD returns the AEAD factory registered for the QUIC tag, or an ErrUnsupportedAEAD error.
+func LookupAEAD(tag uint32) (AEADFactory, error) {
+	aeadRegistry.RLock()
+	factory, ok := aeadRegistry.factories[tag]
+	aeadRegistry.RUnlock()
+	if !ok {
+		return nil, ErrUnsupportedAEAD{Tag: tag}
+	}
+	return factory, nil
 }
@@ -114,7 +114,7 @@ func seal(key, nonce, aad, plaintext, ciphertext, tag []byte, test *testing.T) {
 	var bc int
 
 	buffer := make([]byte, 1500)
-	aead, err := NewAEAD_AES128GCM12(key, nonce)
+	aead, err := NewAEAD_AES128GCM12(key, nonce[:4])
 	if bc, err = aead.Seal(protocol.QuicPacketSequenceNumber(binary.LittleEndian.Uint64(nonce[4:])), buffer, aad, plaintext); err != nil {
 		test.Errorf("AEAD_AES128GCM12.Seal : Error return = %v", err)
 	}
@@ -129,7 +129,7 @@ func open(key, nonce, aad, plaintext, ciphertext, tag []byte, test *testing.T) {
 
 	buffer := make([]byte, 1500)
 	ct := append(ciphertext, tag[:12]...)
-	aead, err := NewAEAD_AES128GCM12(key, nonce)
+	aead, err := NewAEAD_AES128GCM12(key, nonce[:4])
 	if bc, err = aead.Open(protocol.QuicPacketSequenceNumber(binary.LittleEndian.Uint64(nonce[4:])), buffer, aad, ct); err != nil {
 		test.Errorf("AEAD_AES128GCM12.Open : Error return = %v", err)
 	}
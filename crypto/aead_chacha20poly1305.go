@@ -1,83 +1,69 @@
 package crypto
 
 import "github.com/romain-jacotin/quic/protocol"
-import "encoding/binary"
 import "errors"
 import "fmt"
 
+// AEAD_ChaCha20Poly1305 adapts a ChaCha20Poly1305AEAD with a 12 bytes tag to the QUIC AEAD interface:
+// the 96-bit nonce is built from the 32-bit nonce prefix followed by the packet sequence number as a Little Endian uint64.
 type AEAD_ChaCha20Poly1305 struct {
-	cipher *ChaCha20Cipher
-	hasher *Poly1305
+	aead *ChaCha20Poly1305AEAD
 }
 
 // NewAEAD_ChaCha20Poly1305 is an *AEAD_ChaCha20Poly1305 factory that implements AEAD interface
 func NewAEAD_ChaCha20Poly1305(key, nonceprefix []byte) (AEAD, error) {
-	var buf [64]byte
 	var err error
+	var iv [12]byte
 
-	if len(key) < 32 {
-		return nil, errors.New("NewAEAD_ChaCha20Poly1305 : AEAD_CHACHA20_POLY1305_12 requires 256-bit key")
+	if len(key) != CHACHA20_KEYSIZE {
+		return nil, keyLengthError(fmt.Sprintf("NewAEAD_ChaCha20Poly1305 : key must be %d bytes length, got %d bytes", CHACHA20_KEYSIZE, len(key)))
 	}
-	if len(nonceprefix) < 4 {
-		return nil, errors.New("NewAEAD_ChaCha20Poly1305 : QUIC requires 32-bit nonce prefix")
+	if len(nonceprefix) != 4 {
+		return nil, keyLengthError(fmt.Sprintf("NewAEAD_ChaCha20Poly1305 : nonce prefix must be 4 bytes length, got %d bytes", len(nonceprefix)))
 	}
 
+	// The IV is the nonce prefix followed by zeros: ResetForPacket XORs the packet sequence number into its last 8 bytes
+	copy(iv[:4], nonceprefix)
 	aead := new(AEAD_ChaCha20Poly1305)
-	if aead.cipher, err = NewChaCha20Cipher(key, nonceprefix, 0); err != nil {
-		return nil, errors.New("NewAEAD_ChaCha20Poly1305 : error when calling NewChaCha20Cipher")
-	}
-	aead.cipher.GetNextKeystream(&buf)
-	if aead.hasher, err = NewPoly1305(buf[0:32]); err != nil {
-		return nil, errors.New("NewAEAD_ChaCha20Poly1305 : error when calling NewPoly1305")
+	if aead.aead, err = newChaCha20Poly1305AEAD(key, iv[:], 12); err != nil {
+		return nil, err
 	}
 	return aead, nil
 }
 
 // Open
 func (this *AEAD_ChaCha20Poly1305) Open(seqnum protocol.QuicPacketSequenceNumber, plaintext, aad, ciphertext []byte) (bytescount int, err error) {
-	// Authenticate: check the MAC
+	var out []byte
+
 	l := len(ciphertext) - 12
 	if l < 0 {
-		err = errors.New("AEAD_ChaCha20Poly1305.Open : Message Authentication Code can't be less than 12 bytes")
+		err = ErrAuthenticationFailed
 		return
 	}
 	if len(plaintext) < l {
 		err = errors.New("AEAD_ChaCha20Poly1305.Open : plaintext must same have length as ciphertext less 12 bytes at minimum")
 		return
 	}
-	low := binary.LittleEndian.Uint64(ciphertext[l:])
-	high := binary.LittleEndian.Uint32(ciphertext[l+8:])
-	testhigh, testlow := this.hasher.ComputeAeadMAC(aad, ciphertext[:l])
-	if (low != testlow) || (high != uint32(testhigh&0xffffffff)) {
-		err = fmt.Errorf("AEAD_ChaCha20Poly1305.Open : invalid Message Authentication Code verification %x:%x versus %x:%x", low, high, testlow, testhigh)
+	if out, err = this.aead.openPacket(seqnum, plaintext[:0], ciphertext, aad); err != nil {
 		return
 	}
-	// Then decrypt
-	this.cipher.SetPacketSequenceNumber(seqnum)
-	bytescount, err = this.cipher.Decrypt(plaintext, ciphertext[:l])
+	bytescount = len(out)
 	return
 }
 
 // Seal
 func (this *AEAD_ChaCha20Poly1305) Seal(seqnum protocol.QuicPacketSequenceNumber, ciphertext, aad, plaintext []byte) (bytescount int, err error) {
-	// Encrypt
+	var out []byte
+
 	l := len(plaintext)
 	if len(ciphertext) < (l + 12) {
 		err = errors.New("AEAD_ChaCha20Poly1305.Seal : ciphertext can't be less than plaintext + 12 bytes")
 		return
 	}
-	this.cipher.SetPacketSequenceNumber(seqnum)
-	if bytescount, err = this.cipher.Encrypt(ciphertext, plaintext); err != nil {
+	if out, err = this.aead.sealPacket(seqnum, ciphertext[:0], plaintext, aad); err != nil {
 		return
 	}
-	if bytescount != l {
-		err = errors.New("AEAD_ChaCha20Poly1305.Seal : truncated encryption by Chacha20Cipher.Encrypt") // Impossible normally
-	}
-	// Then MAC
-	high, low := this.hasher.ComputeAeadMAC(aad, ciphertext[:l])
-	binary.LittleEndian.PutUint64(ciphertext[l:], low)
-	binary.LittleEndian.PutUint32(ciphertext[l+8:], uint32(high))
-	bytescount += 12
+	bytescount = len(out)
 	return
 }
 
@@ -85,3 +71,8 @@ func (this *AEAD_ChaCha20Poly1305) Seal(seqnum protocol.QuicPacketSequenceNumber
 func (this *AEAD_ChaCha20Poly1305) GetMacSize() int {
 	return 12
 }
+
+// Close zeroes the key and the nonce prefix.
+func (this *AEAD_ChaCha20Poly1305) Close() error {
+	return this.aead.Close()
+}
@@ -6,6 +6,10 @@ import "encoding/binary"
 import "github.com/romain-jacotin/quic/protocol"
 
 func Test_AEAD_ChaChaPoly1305_Open(t *testing.T) {
+	forEachChaCha20Block(t, func() { testAEADChaChaPoly1305Open(t) })
+}
+
+func testAEADChaChaPoly1305Open(t *testing.T) {
 	var aead AEAD
 	var err error
 	var l int
@@ -138,7 +142,7 @@ func Test_AEAD_ChaChaPoly1305_Open(t *testing.T) {
 		0x6d, 0x20, 0x6f, 0x74, 0x68, 0x65, 0x72, 0x20, 0x74, 0x68, 0x61, 0x6e, 0x20, 0x61, 0x73, 0x20,
 		0x2f, 0xe2, 0x80, 0x9c, 0x77, 0x6f, 0x72, 0x6b, 0x20, 0x69, 0x6e, 0x20, 0x70, 0x72, 0x6f, 0x67,
 		0x72, 0x65, 0x73, 0x73, 0x2e, 0x2f, 0xe2, 0x80, 0x9d}
-	if aead, err = NewAEAD_ChaCha20Poly1305(key, noncePrefix); err != nil {
+	if aead, err = NewAEAD_ChaCha20Poly1305(key, noncePrefix[:4]); err != nil {
 		t.Error(err)
 	}
 	buffer := make([]byte, 1500)
@@ -155,6 +159,10 @@ func Test_AEAD_ChaChaPoly1305_Open(t *testing.T) {
 }
 
 func Test_AEAD_ChaChaPoly1305_Seal(t *testing.T) {
+	forEachChaCha20Block(t, func() { testAEADChaChaPoly1305Seal(t) })
+}
+
+func testAEADChaChaPoly1305Seal(t *testing.T) {
 	var aead AEAD
 	var err error
 	var l int
@@ -287,7 +295,7 @@ func Test_AEAD_ChaChaPoly1305_Seal(t *testing.T) {
 		0x6d, 0x20, 0x6f, 0x74, 0x68, 0x65, 0x72, 0x20, 0x74, 0x68, 0x61, 0x6e, 0x20, 0x61, 0x73, 0x20,
 		0x2f, 0xe2, 0x80, 0x9c, 0x77, 0x6f, 0x72, 0x6b, 0x20, 0x69, 0x6e, 0x20, 0x70, 0x72, 0x6f, 0x67,
 		0x72, 0x65, 0x73, 0x73, 0x2e, 0x2f, 0xe2, 0x80, 0x9d}
-	if aead, err = NewAEAD_ChaCha20Poly1305(key, noncePrefix); err != nil {
+	if aead, err = NewAEAD_ChaCha20Poly1305(key, noncePrefix[:4]); err != nil {
 		t.Error(err)
 	}
 	buffer := make([]byte, 1500)
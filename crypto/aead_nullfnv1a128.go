@@ -2,35 +2,36 @@ package crypto
 
 import "github.com/romain-jacotin/quic/protocol"
 import "errors"
-import "encoding/binary"
-import "fmt"
 
+// AEAD_NullFNV1A128 adapts a NullAEAD to the QUIC AEAD interface.
 type AEAD_NullFNV1A128 struct {
+	aead *NullAEAD
 }
 
 // NewAEAD_NullFNV1A128 returns a *AEAD_NullFNV1A128 that implements an AEAD interface with null encryption and FNV1A-128 hash truncated to 96-bit
 func NewAEAD_NullFNV1A128() AEAD {
-	return new(AEAD_NullFNV1A128)
+	return &AEAD_NullFNV1A128{aead: NewNullAEAD()}
 }
 
 // Open
 func (this *AEAD_NullFNV1A128) Open(sequencenumber protocol.QuicPacketSequenceNumber, plaintext, aad, ciphertext []byte) (bytescount int, err error) {
+	var out []byte
+
 	// Check the Hash
 	l := len(ciphertext) - 12
 	if l < 0 {
-		err = errors.New("AEAD_NullFNV1A128.Open : Hash can't be less than 12 bytes")
+		err = ErrAuthenticationFailed
 		return
 	}
-	low := binary.LittleEndian.Uint64(ciphertext)
-	high := binary.LittleEndian.Uint32(ciphertext[8:])
-	testhigh, testlow := ComputeAeadHashFNV1A_128(aad, ciphertext[12:])
-	if (low != testlow) || (high != uint32(testhigh&0xffffffff)) {
-		err = fmt.Errorf("AEAD_NullFNV1A128.Open : invalid Hash verification %x:%x versus %x:%x", low, high, testlow, testhigh)
+	if len(plaintext) < l {
+		err = errors.New("AEAD_NullFNV1A128.Open : plaintext must same have length as ciphertext less 12 bytes at minimum")
 		return
 	}
 	// Then Copy (without decryption)
-	copy(plaintext[:l], ciphertext[12:])
-	bytescount = l
+	if out, err = this.aead.Open(plaintext[:0], nil, ciphertext, aad); err != nil {
+		return
+	}
+	bytescount = len(out)
 	return
 }
 
@@ -41,13 +42,8 @@ func (this *AEAD_NullFNV1A128) Seal(sequencenumber protocol.QuicPacketSequenceNu
 		err = errors.New("AEAD_NullFNV1A128.Seal : ciphertext can't be less than plaintext + 12 bytes")
 		return
 	}
-	// Hash
-	high, low := ComputeAeadHashFNV1A_128(aad, plaintext)
-	binary.LittleEndian.PutUint64(ciphertext, low)
-	binary.LittleEndian.PutUint32(ciphertext[8:], uint32(high))
-	// Then Copy (without encryption)
-	copy(ciphertext[12:], plaintext)
-	bytescount = l + 12
+	// Hash then Copy (without encryption)
+	bytescount = len(this.aead.Seal(ciphertext[:0], nil, plaintext, aad))
 	return
 }
 
@@ -55,3 +51,8 @@ func (this *AEAD_NullFNV1A128) Seal(sequencenumber protocol.QuicPacketSequenceNu
 func (this *AEAD_NullFNV1A128) GetMacSize() int {
 	return 12
 }
+
+// Close does nothing as the null AEAD has no key material.
+func (this *AEAD_NullFNV1A128) Close() error {
+	return nil
+}
@@ -0,0 +1,132 @@
+package crypto
+
+import "testing"
+import "errors"
+import "github.com/romain-jacotin/quic/protocol"
+
+var tests_lookupaead = []struct {
+	tag    protocol.MessageTag
+	keylen int
+}{
+	{protocol.TagCC20, 32},
+	{protocol.TagAESG, 16},
+}
+
+func Test_LookupAEAD(t *testing.T) {
+	for _, v := range tests_lookupaead {
+		factory, err := LookupAEAD(uint32(v.tag))
+		if err != nil {
+			t.Fatalf("LookupAEAD : tag %x must be registered by default : %v", uint32(v.tag), err)
+		}
+		aead, err := factory(make([]byte, v.keylen), make([]byte, 4))
+		if err != nil {
+			t.Fatalf("LookupAEAD : factory error for tag %x : %v", uint32(v.tag), err)
+		}
+		if aead.GetMacSize() != 12 {
+			t.Errorf("LookupAEAD : invalid MAC size %d for tag %x", aead.GetMacSize(), uint32(v.tag))
+		}
+		// A wrong key length is a programming error, a packet shorter than the MAC is an authentication failure
+		if _, err = factory(make([]byte, v.keylen-1), make([]byte, 4)); !errors.Is(err, ErrBadKeyLength) {
+			t.Errorf("LookupAEAD : ErrBadKeyLength expected instead of %v for tag %x", err, uint32(v.tag))
+		}
+		if _, err = aead.Open(0, make([]byte, 16), nil, make([]byte, 11)); !errors.Is(err, ErrAuthenticationFailed) {
+			t.Errorf("AEAD.Open : ErrAuthenticationFailed expected instead of %v for tag %x", err, uint32(v.tag))
+		}
+	}
+
+	_, err := LookupAEAD(uint32(protocol.TagS20P))
+	if e, ok := err.(ErrUnsupportedAEAD); !ok || e.Tag != uint32(protocol.TagS20P) {
+		t.Errorf("LookupAEAD : ErrUnsupportedAEAD expected for unknown tag instead of %v", err)
+	} else if e.Error() != `LookupAEAD : unsupported AEAD tag "S20P"` {
+		t.Errorf("ErrUnsupportedAEAD.Error : invalid message %s", e.Error())
+	}
+}
+
+var tests_aeadlengths = []struct {
+	name   string
+	aead   func(key, noncePrefix []byte) error
+	keylen int
+}{
+	{"NewAEAD_ChaCha20Poly1305", func(key, noncePrefix []byte) error {
+		_, err := NewAEAD_ChaCha20Poly1305(key, noncePrefix)
+		return err
+	}, 32},
+	{"NewAEAD_AES128GCM12", func(key, noncePrefix []byte) error {
+		_, err := NewAEAD_AES128GCM12(key, noncePrefix)
+		return err
+	}, 16},
+	{"NewAesGcmAEAD", func(key, noncePrefix []byte) error {
+		_, err := NewAesGcmAEAD(key, noncePrefix)
+		return err
+	}, 16},
+	{"NewChaCha20Poly1305AEAD", func(key, noncePrefix []byte) error {
+		_, err := NewChaCha20Poly1305AEAD(key)
+		return err
+	}, 32},
+}
+
+func Test_AEAD_KeyLengths(t *testing.T) {
+	// Only the exact key and nonce prefix sizes are accepted: a longer derived secret is not truncated
+	for i, v := range tests_aeadlengths {
+		for _, keylen := range []int{v.keylen - 1, v.keylen, v.keylen + 1} {
+			err := v.aead(make([]byte, keylen), make([]byte, 4))
+			if keylen == v.keylen && err != nil {
+				t.Errorf("%s : unexpected error %v for a %d bytes key in test n°%v", v.name, err, keylen, i)
+			}
+			if keylen != v.keylen && !errors.Is(err, ErrBadKeyLength) {
+				t.Errorf("%s : ErrBadKeyLength expected instead of %v for a %d bytes key in test n°%v", v.name, err, keylen, i)
+			}
+		}
+		if v.name == "NewChaCha20Poly1305AEAD" {
+			continue
+		}
+		for _, l := range []int{3, 5, 12} {
+			if err := v.aead(make([]byte, v.keylen), make([]byte, l)); !errors.Is(err, ErrBadKeyLength) {
+				t.Errorf("%s : ErrBadKeyLength expected instead of %v for a %d bytes nonce prefix in test n°%v", v.name, err, l, i)
+			}
+		}
+	}
+}
+
+func Test_RegisterAEAD(t *testing.T) {
+	tag := uint32(protocol.TagNULL)
+	defer RegisterAEAD(tag, nil)
+
+	RegisterAEAD(tag, func(key, iv []byte) (AEAD, error) {
+		return NewAEAD_NullFNV1A128(), nil
+	})
+	factory, err := LookupAEAD(tag)
+	if err != nil {
+		t.Fatalf("RegisterAEAD : registered factory not found : %v", err)
+	}
+	if aead, err := factory(nil, nil); err != nil || aead.GetMacSize() != 12 {
+		t.Errorf("RegisterAEAD : invalid registered factory")
+	}
+
+	RegisterAEAD(tag, nil)
+	if _, err = LookupAEAD(tag); err == nil {
+		t.Error("RegisterAEAD : nil factory must unregister the tag")
+	}
+}
+
+func Test_AEAD_Allocs(t *testing.T) {
+	for _, v := range tests_lookupaead {
+		factory, _ := LookupAEAD(uint32(v.tag))
+		aead, err := factory(make([]byte, v.keylen), make([]byte, 4))
+		if err != nil {
+			t.Fatalf("LookupAEAD : factory error for tag %x : %v", uint32(v.tag), err)
+		}
+		plaintext := make([]byte, 1200)
+		ciphertext := make([]byte, len(plaintext)+aead.GetMacSize())
+		out := make([]byte, len(ciphertext))
+		aad := []byte("header")
+
+		// Seal and Open run for every packet: their state must not be allocated
+		if n := testing.AllocsPerRun(100, func() { aead.Seal(1, ciphertext, aad, plaintext) }); n != 0 {
+			t.Errorf("AEAD.Seal : %v allocations per packet for tag %x", n, uint32(v.tag))
+		}
+		if n := testing.AllocsPerRun(100, func() { aead.Open(1, out, aad, ciphertext) }); n != 0 {
+			t.Errorf("AEAD.Open : %v allocations per packet for tag %x", n, uint32(v.tag))
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package crypto
+
+import "github.com/romain-jacotin/quic/protocol"
+import "crypto/aes"
+import "crypto/cipher"
+import "encoding/binary"
+import "fmt"
+
+// AesGcmAEAD is the AEAD_AES_128_GCM_12 of the QUIC crypto specification: AES-128 in Galois/Counter Mode with a tag truncated to 12 bytes.
+//
+// AesGcmAEAD implements the crypto/cipher.AEAD interface on top of the standard library AES-GCM (hardware-accelerated when available).
+// The QUIC nonce of a packet is the 4 bytes nonce prefix followed by the packet sequence number as a Little Endian uint64, see PacketNonce.
+type AesGcmAEAD struct {
+	gcm         cipher.AEAD
+	noncePrefix [4]byte
+	closed      bool
+}
+
+var _ cipher.AEAD = (*AesGcmAEAD)(nil)
+
+const aesGcmTagSize = 12
+
+// NewAesGcmAEAD returns an AesGcmAEAD keyed with the 128-bit key and using the 32-bit nonce prefix.
+func NewAesGcmAEAD(key, noncePrefix []byte) (*AesGcmAEAD, error) {
+	var block cipher.Block
+	var err error
+
+	if len(key) != 16 {
+		return nil, keyLengthError(fmt.Sprintf("NewAesGcmAEAD : key must be 16 bytes length, got %d bytes", len(key)))
+	}
+	if len(noncePrefix) != 4 {
+		return nil, keyLengthError(fmt.Sprintf("NewAesGcmAEAD : nonce prefix must be 4 bytes length, got %d bytes", len(noncePrefix)))
+	}
+	aead := new(AesGcmAEAD)
+	if block, err = aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+	if aead.gcm, err = cipher.NewGCMWithTagSize(block, aesGcmTagSize); err != nil {
+		return nil, err
+	}
+	copy(aead.noncePrefix[:], noncePrefix)
+	return aead, nil
+}
+
+// PacketNonce returns the 96-bit nonce of the packet sequence number: the nonce prefix followed by the Little Endian sequence number.
+func (this *AesGcmAEAD) PacketNonce(seqnum protocol.QuicPacketSequenceNumber) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, this.noncePrefix[:])
+	binary.LittleEndian.PutUint64(nonce[4:], uint64(seqnum))
+	return nonce
+}
+
+// NonceSize returns the size of the nonce that must be passed to Seal and Open.
+func (this *AesGcmAEAD) NonceSize() int {
+	return 12
+}
+
+// Overhead returns the maximum difference between the lengths of a plaintext and its ciphertext.
+func (this *AesGcmAEAD) Overhead() int {
+	return aesGcmTagSize
+}
+
+// Close releases the AES-GCM key schedule and zeroes the nonce prefix. Open returns ErrCipherClosed and Seal panics after Close.
+//
+// The key schedule is owned by the standard library and can't be zeroed, it is only released to the garbage collector.
+func (this *AesGcmAEAD) Close() error {
+	this.gcm = nil
+	this.noncePrefix = [4]byte{}
+	this.closed = true
+	return nil
+}
+
+// Seal encrypts and authenticates plaintext with the 96-bit nonce, authenticates aad, and appends the result followed by the 12 bytes tag to dst.
+//
+// To reuse plaintext's storage for the encrypted output, use plaintext[:0] as dst. Seal panics if the nonce is not 12 bytes long.
+func (this *AesGcmAEAD) Seal(dst, nonce, plaintext, aad []byte) []byte {
+	if this.closed {
+		panic(ErrCipherClosed)
+	}
+	return this.gcm.Seal(dst, nonce, plaintext, aad)
+}
+
+// Open verifies the tag and the aad, then decrypts ciphertext with the 96-bit nonce and appends the result to dst.
+//
+// No plaintext is released if the authentication fails, ErrAuthenticationFailed is returned instead.
+// To reuse ciphertext's storage for the decrypted output, use ciphertext[:0] as dst. Open panics if the nonce is not 12 bytes long.
+func (this *AesGcmAEAD) Open(dst, nonce, ciphertext, aad []byte) ([]byte, error) {
+	if this.closed {
+		return nil, ErrCipherClosed
+	}
+	out, err := this.gcm.Open(dst, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, ErrAuthenticationFailed
+	}
+	return out, nil
+}
@@ -0,0 +1,120 @@
+package crypto
+
+import "testing"
+import "bytes"
+import "errors"
+import "crypto/cipher"
+import "encoding/binary"
+import "github.com/romain-jacotin/quic/protocol"
+
+// The known answers are the GCM test cases of testsAES128GCM12 with the tag truncated to 12 bytes, as AEAD_AES_128_GCM_12 does.
+
+func Test_AesGcmAEAD_Seal(t *testing.T) {
+	var aead cipher.AEAD
+
+	for i, v := range testsAES128GCM12 {
+		a, err := NewAesGcmAEAD(toByte(v.key), toByte(v.nonce)[:4])
+		if err != nil {
+			t.Fatal(err)
+		}
+		aead = a
+		if aead.NonceSize() != 12 || aead.Overhead() != 12 {
+			t.Errorf("AesGcmAEAD : invalid nonce size %d or overhead %d", aead.NonceSize(), aead.Overhead())
+		}
+		sealed := aead.Seal(nil, toByte(v.nonce), toByte(v.plaintext), toByte(v.aad))
+		if !bytes.Equal(sealed, append(toByte(v.ciphertext), toByte(v.tag)[:12]...)) {
+			t.Errorf("AesGcmAEAD.Seal : invalid ciphertext or tag for test vector %d : %x", i, sealed)
+		}
+	}
+}
+
+func Test_AesGcmAEAD_Open(t *testing.T) {
+	var aead cipher.AEAD
+
+	for i, v := range testsAES128GCM12 {
+		a, err := NewAesGcmAEAD(toByte(v.key), toByte(v.nonce)[:4])
+		if err != nil {
+			t.Fatal(err)
+		}
+		aead = a
+		sealed := append(toByte(v.ciphertext), toByte(v.tag)[:12]...)
+		opened, err := aead.Open(nil, toByte(v.nonce), sealed, toByte(v.aad))
+		if err != nil {
+			t.Errorf("AesGcmAEAD.Open : test vector %d : %v", i, err)
+		}
+		if !bytes.Equal(opened, toByte(v.plaintext)) {
+			t.Errorf("AesGcmAEAD.Open : invalid plaintext for test vector %d : %x", i, opened)
+		}
+
+		// Any modification of the ciphertext or the tag must be detected
+		for j := range sealed {
+			sealed[j] ^= 0x01
+			if opened, err = aead.Open(nil, toByte(v.nonce), sealed, toByte(v.aad)); !errors.Is(err, ErrAuthenticationFailed) || opened != nil {
+				t.Errorf("AesGcmAEAD.Open : modification of byte %d not detected for test vector %d", j, i)
+			}
+			sealed[j] ^= 0x01
+		}
+	}
+}
+
+func Test_AesGcmAEAD_PacketNonce(t *testing.T) {
+	for i, v := range testsAES128GCM12 {
+		nonce := toByte(v.nonce)
+		aead, err := NewAesGcmAEAD(toByte(v.key), nonce[:4])
+		if err != nil {
+			t.Fatal(err)
+		}
+		seqnum := protocol.QuicPacketSequenceNumber(binary.LittleEndian.Uint64(nonce[4:]))
+		if !bytes.Equal(aead.PacketNonce(seqnum), nonce) {
+			t.Errorf("AesGcmAEAD.PacketNonce : invalid nonce %x for test vector %d", aead.PacketNonce(seqnum), i)
+		}
+		sealed := aead.Seal(nil, aead.PacketNonce(seqnum), toByte(v.plaintext), toByte(v.aad))
+		if !bytes.Equal(sealed, append(toByte(v.ciphertext), toByte(v.tag)[:12]...)) {
+			t.Errorf("AesGcmAEAD.Seal : invalid ciphertext or tag with packet nonce for test vector %d", i)
+		}
+	}
+}
+
+// The packet vector is a forward-secure packet of the PacketPacker, a STREAM frame of stream 5 with the sequence number 42, sealed
+// by OpenSSL: the public header is the AAD, the nonce is the IV prefix followed by the sequence number in Little Endian, and the
+// 16 bytes tag of OpenSSL is truncated to 12 bytes. It is not a packet captured from a Chromium session, none is available here:
+// it checks the layout of this package against an independent GCM, not against the packets of a peer.
+var testAesGcmPacket = struct {
+	key, iv, header, plaintext, ciphertext string
+	seqnum                                 protocol.QuicPacketSequenceNumber
+}{
+	key:        "2b7e151628aed2a6abf7158809cf4f3c",
+	iv:         "c3a1f0d2",
+	header:     "0cf1725eaab0913c8d2a",
+	plaintext:  "8005474554202f696e6465782e68746d6c20485454502f312e310d0a486f73743a207777772e6578616d706c652e6f72670d0a0d0a",
+	ciphertext: "aa74b4e8bf85c8fd18d76a26362214f6beb5a7cd7a7710a9dc5d00cfdf5cb1a79d97c67972e34612ba1ba7864b69226de5b3daa385799e0fdc6fb9ca3e98f9cd68",
+	seqnum:     42,
+}
+
+func Test_AesGcmAEAD_PacketVector(t *testing.T) {
+	v := testAesGcmPacket
+	aead, err := NewAesGcmAEAD(toByte(v.key), toByte(v.iv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed := aead.Seal(nil, aead.PacketNonce(v.seqnum), toByte(v.plaintext), toByte(v.header)); !bytes.Equal(sealed, toByte(v.ciphertext)) {
+		t.Errorf("AesGcmAEAD.Seal : invalid sealed packet %x", sealed)
+	}
+
+	// The datagram is opened by the unpacker of the forward-secure keys
+	opener, err := NewAEAD_AES128GCM12(toByte(v.key), toByte(v.iv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpacker := protocol.NewPacketUnpacker(NewAEAD_NullFNV1A128())
+	unpacker.SetOpener(protocol.ENCRYPTION_FORWARD_SECURE, opener)
+	packet, err := unpacker.Unpack(append(toByte(v.header), toByte(v.ciphertext)...))
+	if err != nil {
+		t.Fatalf("PacketUnpacker.Unpack : unexpected error %v", err)
+	}
+	defer packet.Release()
+	f, ok := packet.Frames[0].(*protocol.StreamFrame)
+	if packet.SequenceNumber != v.seqnum || len(packet.Frames) != 1 || !ok || f.StreamID != 5 || string(f.Data) != "GET /index.html HTTP/1.1\r\nHost: www.example.org\r\n\r\n" {
+		t.Errorf("PacketUnpacker.Unpack : invalid packet %v %+v", packet.SequenceNumber, packet.Frames)
+	}
+}
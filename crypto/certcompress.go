@@ -0,0 +1,173 @@
+package crypto
+
+import "bytes"
+import "compress/zlib"
+import "encoding/binary"
+import "errors"
+import "io"
+
+const (
+	// CERT_ENTRY_END_OF_LIST ends the entries of a compressed certificate chain
+	CERT_ENTRY_END_OF_LIST = 0
+	// CERT_ENTRY_COMPRESSED is a certificate of the zlib data after the entries
+	CERT_ENTRY_COMPRESSED = 1
+	// CERT_ENTRY_CACHED is a certificate cached by the client, followed by its 64-bit FNV-1a hash
+	CERT_ENTRY_CACHED = 2
+	// CERT_ENTRY_COMMON is a certificate of a common certificate set, followed by the 64-bit hash of the set and the 32-bit index
+	CERT_ENTRY_COMMON = 3
+	// MAX_UNCOMPRESSED_CERT_CHAIN_SIZE is the maximum size of the zlib data of a compressed certificate chain once decompressed
+	MAX_UNCOMPRESSED_CERT_CHAIN_SIZE = 128 * 1024
+)
+
+// ErrCertDictionary is returned by DecompressChain when the zlib data names another dictionary than the certificates
+// known by both hosts: the chains of the Chromium servers are compressed with the kCommonCertSubstrings table of Chromium
+// after these certificates, and this table isn't shipped here.
+var ErrCertDictionary = errors.New("DecompressChain : zlib data compressed with an unsupported dictionary")
+
+// CertHash returns the 64-bit FNV-1a hash identifying a cached certificate in the compressed chains and in the CCRT tag.
+func CertHash(cert []byte) uint64 {
+	return ComputeHashFNV1A_64(cert)
+}
+
+// CompressChain returns the CRT value of the DER certificate chain: an entry per certificate and the end of the list,
+// then the size and the zlib data of the certificates that aren't cached by the client. The 64-bit hashes of the certificates
+// cached by the client are those of its CCRT tag.
+//
+// The zlib dictionary lacks the kCommonCertSubstrings table of Chromium (see ErrCertDictionary), so the Chromium clients
+// can decompress the chains without cached certificates only.
+func CompressChain(chain [][]byte, clientCachedHashes []uint64) []byte {
+	var b, uncompressed []byte
+
+	cached := make([]bool, len(chain))
+	for i, cert := range chain {
+		hash := CertHash(cert)
+		for _, h := range clientCachedHashes {
+			if h == hash {
+				cached[i] = true
+				break
+			}
+		}
+		if cached[i] {
+			b = append(b, CERT_ENTRY_CACHED)
+			b = binary.LittleEndian.AppendUint64(b, hash)
+			continue
+		}
+		b = append(b, CERT_ENTRY_COMPRESSED)
+		uncompressed = binary.LittleEndian.AppendUint32(uncompressed, uint32(len(cert)))
+		uncompressed = append(uncompressed, cert...)
+	}
+	b = append(b, CERT_ENTRY_END_OF_LIST)
+	if len(uncompressed) == 0 {
+		return b
+	}
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(uncompressed)))
+	buf := bytes.NewBuffer(b)
+	w, _ := zlib.NewWriterLevelDict(buf, zlib.BestCompression, zlibDictForChain(chain, cached))
+	w.Write(uncompressed)
+	w.Close()
+	return buf.Bytes()
+}
+
+// DecompressChain returns the DER certificate chain of a CRT value, the cached certificates are those of the CCRT tag by hash.
+// The certificates of the common certificate sets are not supported, so no CCS tag is ever sent to ask for them.
+func DecompressChain(b []byte, cachedCerts map[uint64][]byte) ([][]byte, error) {
+	var chain [][]byte
+	var cached []bool
+
+	for {
+		if len(b) == 0 {
+			return nil, errors.New("DecompressChain : end of the list expected")
+		}
+		entry := b[0]
+		b = b[1:]
+		if entry == CERT_ENTRY_END_OF_LIST {
+			break
+		}
+		switch entry {
+		case CERT_ENTRY_COMPRESSED:
+			chain = append(chain, nil)
+			cached = append(cached, false)
+		case CERT_ENTRY_CACHED:
+			if len(b) < 8 {
+				return nil, errors.New("DecompressChain : cached entry truncated")
+			}
+			cert, ok := cachedCerts[binary.LittleEndian.Uint64(b)]
+			if !ok {
+				return nil, errors.New("DecompressChain : unknown cached certificate")
+			}
+			chain = append(chain, cert)
+			cached = append(cached, true)
+			b = b[8:]
+		case CERT_ENTRY_COMMON:
+			return nil, errors.New("DecompressChain : common certificate sets not supported")
+		default:
+			return nil, errors.New("DecompressChain : invalid entry type")
+		}
+	}
+
+	compressed := 0
+	for _, c := range cached {
+		if !c {
+			compressed++
+		}
+	}
+	if compressed == 0 {
+		if len(b) != 0 {
+			return nil, errors.New("DecompressChain : unexpected data after the entries")
+		}
+		return chain, nil
+	}
+
+	// The size is checked before the allocation, and the zlib data can't expand beyond it
+	if len(b) < 4 {
+		return nil, errors.New("DecompressChain : uncompressed size truncated")
+	}
+	size := binary.LittleEndian.Uint32(b)
+	if size > MAX_UNCOMPRESSED_CERT_CHAIN_SIZE {
+		return nil, errors.New("DecompressChain : uncompressed size too large")
+	}
+	r, err := zlib.NewReaderDict(bytes.NewReader(b[4:]), zlibDictForChain(chain, cached))
+	if err == zlib.ErrDictionary {
+		return nil, ErrCertDictionary
+	}
+	if err != nil {
+		return nil, errors.New("DecompressChain : invalid zlib data")
+	}
+	uncompressed := make([]byte, size)
+	if _, err = io.ReadFull(r, uncompressed); err != nil {
+		return nil, errors.New("DecompressChain : zlib data shorter than the uncompressed size")
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		return nil, errors.New("DecompressChain : zlib data longer than the uncompressed size")
+	}
+
+	for i := range chain {
+		if cached[i] {
+			continue
+		}
+		if len(uncompressed) < 4 {
+			return nil, errors.New("DecompressChain : certificate length truncated")
+		}
+		l := binary.LittleEndian.Uint32(uncompressed)
+		if uint32(len(uncompressed)-4) < l {
+			return nil, errors.New("DecompressChain : certificate truncated")
+		}
+		chain[i] = uncompressed[4 : 4+l]
+		uncompressed = uncompressed[4+l:]
+	}
+	if len(uncompressed) != 0 {
+		return nil, errors.New("DecompressChain : unexpected data after the certificates")
+	}
+	return chain, nil
+}
+
+// zlibDictForChain returns the zlib dictionary of a chain: the certificates known by both hosts in the reverse order.
+func zlibDictForChain(chain [][]byte, known []bool) []byte {
+	var dict []byte
+	for i := len(chain) - 1; i >= 0; i-- {
+		if known[i] {
+			dict = append(dict, chain[i]...)
+		}
+	}
+	return dict
+}
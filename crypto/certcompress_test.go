@@ -0,0 +1,117 @@
+package crypto
+
+import "bytes"
+import "compress/zlib"
+import "encoding/binary"
+import "testing"
+
+// testCertChain is a certificate chain of three certificates sharing some DER substrings.
+var testCertChain = [][]byte{
+	append([]byte{0x30, 0x82, 0x01, 0x0a, 0x02, 0x82, 0x01, 0x01}, bytes.Repeat([]byte("leaf certificate "), 20)...),
+	append([]byte{0x30, 0x82, 0x01, 0x0a, 0x02, 0x82, 0x01, 0x01}, bytes.Repeat([]byte("intermediate certificate "), 12)...),
+	append([]byte{0x30, 0x82, 0x01, 0x0a, 0x02, 0x82, 0x01, 0x01}, bytes.Repeat([]byte("root certificate "), 15)...),
+}
+
+func Test_CertCompress(t *testing.T) {
+	cache := make(map[uint64][]byte)
+	for _, cert := range testCertChain {
+		cache[CertHash(cert)] = cert
+	}
+
+	// The cached certificates are sent as their hash, the others in the zlib data
+	var tests_compress = []struct {
+		chain  [][]byte
+		cached []int
+		size   int
+	}{
+		{testCertChain, nil, 0},
+		{testCertChain, []int{2}, 0},
+		{testCertChain, []int{1, 2}, 0},
+		{testCertChain, []int{0, 1, 2}, 3*9 + 1},
+		{testCertChain[:1], nil, 0},
+		{nil, nil, 1},
+	}
+	for i, v := range tests_compress {
+		var hashes []uint64
+		for _, c := range v.cached {
+			hashes = append(hashes, CertHash(testCertChain[c]))
+		}
+		b := CompressChain(v.chain, hashes)
+		if v.size != 0 && len(b) != v.size {
+			t.Errorf("CompressChain : %v bytes expected instead of %v in test n°%v", v.size, len(b), i)
+		}
+		chain, err := DecompressChain(b, cache)
+		if err != nil {
+			t.Fatalf("DecompressChain : unexpected error %v in test n°%v", err, i)
+		}
+		if len(chain) != len(v.chain) {
+			t.Fatalf("DecompressChain : %v certificates expected instead of %v in test n°%v", len(v.chain), len(chain), i)
+		}
+		for j := range chain {
+			if !bytes.Equal(chain[j], v.chain[j]) {
+				t.Errorf("DecompressChain : certificate %v differs in test n°%v", j, i)
+			}
+		}
+	}
+
+	// A cached certificate is needed to decompress the chain, its data is in the zlib dictionary
+	b := CompressChain(testCertChain, []uint64{CertHash(testCertChain[2])})
+	if _, err := DecompressChain(b, nil); err == nil {
+		t.Errorf("DecompressChain : error expected without the cached certificate")
+	}
+	if compressed, plain := len(b), len(testCertChain[0])+len(testCertChain[1]); compressed >= plain/4 {
+		t.Errorf("CompressChain : %v bytes are too many for %v bytes of certificates", compressed, plain)
+	}
+}
+
+func Test_CertDecompress_Errors(t *testing.T) {
+	valid := CompressChain(testCertChain, nil)
+	entries := []byte{CERT_ENTRY_COMPRESSED, CERT_ENTRY_END_OF_LIST}
+
+	// bomb is the zlib data of 1 MB of zeros announced as 16 bytes
+	var bomb bytes.Buffer
+	w := zlib.NewWriter(&bomb)
+	w.Write(make([]byte, 1<<20))
+	w.Close()
+
+	var tests_errors = [][]byte{
+		{},
+		{CERT_ENTRY_COMPRESSED},
+		{CERT_ENTRY_CACHED, 1, 2, 3},
+		{CERT_ENTRY_CACHED, 1, 2, 3, 4, 5, 6, 7, 8, CERT_ENTRY_END_OF_LIST},
+		{CERT_ENTRY_COMMON, 1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 0, 0, CERT_ENTRY_END_OF_LIST},
+		{4, CERT_ENTRY_END_OF_LIST},
+		{CERT_ENTRY_END_OF_LIST, 0},
+		append(entries, 1, 2),
+		binary.LittleEndian.AppendUint32(append([]byte(nil), entries...), MAX_UNCOMPRESSED_CERT_CHAIN_SIZE+1),
+		append(binary.LittleEndian.AppendUint32(append([]byte(nil), entries...), 16), bomb.Bytes()...),
+		append(binary.LittleEndian.AppendUint32(append([]byte(nil), entries...), 16), 0x78, 0x9c, 1, 2, 3),
+		valid[:len(valid)-1],
+		append(valid[:len(testCertChain)+1], append([]byte{0xff, 0xff, 0, 0}, valid[len(testCertChain)+5:]...)...),
+	}
+	for i, v := range tests_errors {
+		if chain, err := DecompressChain(v, nil); err == nil {
+			t.Errorf("DecompressChain : error expected instead of %v certificates in test n°%v", len(chain), i)
+		}
+	}
+}
+
+func Test_CertDecompress_Golden(t *testing.T) {
+	// The CRT values are compressed by the zlib library of C, not by CompressChain: a compressed leaf then a cached root
+	// in the dictionary, and a compressed leaf with a foreign dictionary like the kCommonCertSubstrings of Chromium
+	leaf := append([]byte{0x30, 0x82, 0x00, 0x1c}, "golden leaf of www.example.org"...)
+	root := append([]byte{0x30, 0x82, 0x00, 0x1c}, "golden root of www.example.org"...)
+	crt := toByte("010204f2ea79e19b6749002600000078f9caf70c36536260603040a8ca494d4cc3a20a00cc630c2c")
+	foreign := toByte("01002600000078f905810124536260603068629049cfcf4949cd53c8494d4c53c84f53282f2fd74bad48cc2dc849d5cb2f4a0700cc630c2c")
+
+	if h := CertHash(root); h != 0x49679be179eaf204 {
+		t.Errorf("CertHash : 0x49679be179eaf204 expected instead of %#x", h)
+	}
+	chain, err := DecompressChain(crt, map[uint64][]byte{CertHash(root): root})
+	if err != nil || len(chain) != 2 || !bytes.Equal(chain[0], leaf) || !bytes.Equal(chain[1], root) {
+		t.Errorf("DecompressChain : invalid chain %x (%v)", chain, err)
+	}
+	if _, err = DecompressChain(foreign, nil); err != ErrCertDictionary {
+		t.Errorf("DecompressChain : ErrCertDictionary expected instead of %v", err)
+	}
+}
@@ -1,17 +1,48 @@
 package crypto
 
 import "github.com/romain-jacotin/quic/protocol"
+import "crypto/cipher"
+import "encoding/binary"
 import "errors"
+import "fmt"
 
 // ChaCha20 algorithm and test vector from https://tools.ietf.org/html/rfc7539
 
 type ChaCha20Cipher struct {
-	grid   [16]uint32
-	buffer [64]byte
+	grid      [16]uint32
+	iv        [3]uint32
+	buffer    [64]byte
+	blocks    [chacha20MaxBlocks * 64]byte // keystream of the full blocks computed together
+	offset    int                          // number of keystream bytes of buffer already used, 64 when a new block is needed
+	exhausted bool                         // true when the block counter has wrapped for the current nonce
+	closed    bool                         // true when the key material has been zeroed by Close
 }
 
-// Setup initialize the ChaCha20 grid based on the key, nonce and block counter.
+var _ cipher.Stream = (*ChaCha20Cipher)(nil)
+
+// Sizes of the ChaCha20 key and nonce, NewChaCha20Cipher and SetIV require exactly these lengths.
+const (
+	CHACHA20_KEYSIZE   = 32
+	CHACHA20_NONCESIZE = 12
+)
+
+// chacha20MaxBlocks is the number of blocks of keystream computed together, the assembly block functions compute them in parallel.
+const chacha20MaxBlocks = 4
+
+// ErrKeystreamExhausted is returned by Encrypt and Decrypt when the 32-bit block counter would wrap, and so the keystream would be reused.
+var ErrKeystreamExhausted = errors.New("ChaCha20Cipher : keystream exhausted for the current nonce, block counter would wrap")
+
+// NewChaCha20Cipher initialize the ChaCha20 grid based on the key, nonce and block counter, the key must be exactly 32 bytes and the nonce exactly 12 bytes.
 func NewChaCha20Cipher(key, nonce []byte, counter uint32) (*ChaCha20Cipher, error) {
+	cc20 := new(ChaCha20Cipher)
+	if err := cc20.init(key, nonce, counter); err != nil {
+		return nil, err
+	}
+	return cc20, nil
+}
+
+// init initializes the ChaCha20 grid of a new or closed cipher, like NewChaCha20Cipher.
+func (this *ChaCha20Cipher) init(key, nonce []byte, counter uint32) error {
 	// ChaCha20 uses a 4 x 4 grid of uint32:
 	//
 	//   +------------+------------+------------+------------+
@@ -33,86 +64,248 @@ func NewChaCha20Cipher(key, nonce []byte, counter uint32) (*ChaCha20Cipher, erro
 	//
 	// Lastly, words 13, 14 and 15 are taken from an 12-byte nonce, again by reading the bytes in little-endian order, in 4-byte chunks.
 
-	if len(key) < 32 {
-		return nil, errors.New("ChaCha20.Setup: key must be 32 bytes length")
+	if len(key) != CHACHA20_KEYSIZE {
+		return keyLengthError(fmt.Sprintf("NewChaCha20Cipher : key must be %d bytes length, got %d bytes", CHACHA20_KEYSIZE, len(key)))
 	}
-	if len(nonce) < 12 {
-		return nil, errors.New("ChaCha20.Setup: nonce must be 12 bytes length")
+	if len(nonce) != CHACHA20_NONCESIZE {
+		return keyLengthError(fmt.Sprintf("NewChaCha20Cipher : nonce must be %d bytes length, got %d bytes", CHACHA20_NONCESIZE, len(nonce)))
 	}
-
-	cc20 := new(ChaCha20Cipher)
+	this.closed = false
 
 	// constants
-	cc20.grid[0] = 0x61707865
-	cc20.grid[1] = 0x3320646e
-	cc20.grid[2] = 0x79622d32
-	cc20.grid[3] = 0x6b206574
+	this.grid[0] = 0x61707865
+	this.grid[1] = 0x3320646e
+	this.grid[2] = 0x79622d32
+	this.grid[3] = 0x6b206574
 
 	// 256 bits key as 8 Little Endian uint32
 	for j := uint32(0); j < 8; j++ {
-		cc20.grid[j+4] = 0
+		this.grid[j+4] = 0
 		for i := uint32(0); i < 4; i++ {
-			cc20.grid[j+4] += uint32(key[(j<<2)+i]) << (i << 3)
+			this.grid[j+4] += uint32(key[(j<<2)+i]) << (i << 3)
 		}
 	}
 
 	// block counter
-	cc20.grid[12] = counter
+	this.grid[12] = counter
+	this.offset = 64
+
+	// nonce as 3 consecutives Little Endian uint32, the nonce is also the initial IV
+	return this.SetIV(nonce)
+}
 
-	// nonce as 3 consecutives Little Endian uint32
+// SetIV sets the 96-bit per-connection IV used by ResetForPacket, and initialize the ChaCha20 nonce with it.
+func (this *ChaCha20Cipher) SetIV(iv []byte) error {
+	if len(iv) != CHACHA20_NONCESIZE {
+		return keyLengthError(fmt.Sprintf("ChaCha20Cipher.SetIV : IV must be %d bytes length, got %d bytes", CHACHA20_NONCESIZE, len(iv)))
+	}
 	for j := uint32(0); j < 3; j++ {
-		cc20.grid[j+13] = 0
+		this.iv[j] = 0
 		for i := uint32(0); i < 4; i++ {
-			cc20.grid[j+13] += uint32(nonce[(j<<2)+i]) << (i << 3)
+			this.iv[j] += uint32(iv[(j<<2)+i]) << (i << 3)
 		}
+		this.grid[j+13] = this.iv[j]
 	}
-	return cc20, nil
+	this.offset = 64
+	this.exhausted = false
+	return nil
 }
 
-// SetPacketSequenceNumber initialize the ChaCha20 nonce based on the QUIC packet sequence number and set the block counter to 1.
-func (this *ChaCha20Cipher) SetPacketSequenceNumber(sequencenumber protocol.QuicPacketSequenceNumber) {
+// ResetForPacket starts the keystream of a QUIC packet: the nonce is set from the IV and the packet sequence number, the block
+// counter to 1, and the keystream buffered for the previous packet is zeroed. The key words of the grid are kept, so a cipher
+// is keyed once for all the packets of a key generation.
+//
+// The nonce is the 12 bytes IV with its last 8 bytes XORed with the Little Endian packet sequence number.
+func (this *ChaCha20Cipher) ResetForPacket(sequencenumber protocol.QuicPacketSequenceNumber) {
 	this.grid[12] = 1
-	this.grid[14] = uint32(sequencenumber & 0xffffffff)
-	this.grid[15] = uint32(sequencenumber >> 32)
+	this.grid[13] = this.iv[0]
+	this.grid[14] = this.iv[1] ^ uint32(sequencenumber&0xffffffff)
+	this.grid[15] = this.iv[2] ^ uint32(sequencenumber>>32)
+	this.clearKeystream()
+}
+
+// resetForNonce is ResetForPacket with the 12 bytes nonce instead of the one of the IV and of a packet sequence number.
+func (this *ChaCha20Cipher) resetForNonce(nonce []byte) {
+	this.grid[12] = 1
+	this.grid[13] = binary.LittleEndian.Uint32(nonce[0:])
+	this.grid[14] = binary.LittleEndian.Uint32(nonce[4:])
+	this.grid[15] = binary.LittleEndian.Uint32(nonce[8:])
+	this.clearKeystream()
+}
+
+// clearKeystream zeroes the keystream buffered for the previous nonce.
+func (this *ChaCha20Cipher) clearKeystream() {
+	this.buffer = [64]byte{}
+	this.blocks = [chacha20MaxBlocks * 64]byte{}
+	this.offset = 64
+	this.exhausted = false
+}
+
+// Reset restarts the keystream of the current nonce at the block counter.
+func (this *ChaCha20Cipher) Reset(counter uint32) {
+	this.grid[12] = counter
+	this.offset = 64
+	this.exhausted = false
+}
+
+// Close zeroes the grid, the IV and the keystream buffer. Encrypt and Decrypt return ErrCipherClosed after Close.
+func (this *ChaCha20Cipher) Close() error {
+	this.grid = [16]uint32{}
+	this.iv = [3]uint32{}
+	this.buffer = [64]byte{}
+	this.blocks = [chacha20MaxBlocks * 64]byte{}
+	this.offset = 64
+	this.closed = true
+	return nil
 }
 
 // Decrypt returns the numbers of decrypted bytes in the plaintext slice of the ciphertext slice and returns an error if the size of plaintext is less than ciphertext length without MAC.
+//
+// Successive calls continue the keystream where the previous call stopped, use Reset or ResetForPacket to restart it.
 func (this *ChaCha20Cipher) Decrypt(plaintext, ciphertext []byte) (bytescount int, err error) {
-	l := len(ciphertext)
-	if len(plaintext) < l {
+	if len(plaintext) < len(ciphertext) {
 		err = errors.New("ChaCha20Cipher.Decrypt : plaintext must have equal length or more than ciphertext")
 		return
 	}
-	for bytescount = 0; bytescount < l; bytescount++ {
-		i := bytescount % 64
-		if i == 0 {
-			this.GetNextKeystream(&this.buffer)
-		}
-		plaintext[bytescount] = ciphertext[bytescount] ^ this.buffer[i]
-	}
-	return
+	return this.xorKeyStream(plaintext, ciphertext)
 }
 
 // Encrypt returns in the cleartext slice the result of the encrypted plaintext slice.
+//
+// Successive calls continue the keystream where the previous call stopped, use Reset or ResetForPacket to restart it.
 func (this *ChaCha20Cipher) Encrypt(ciphertext, plaintext []byte) (bytescount int, err error) {
-	l := len(plaintext)
-	if len(ciphertext) < l {
+	if len(ciphertext) < len(plaintext) {
 		err = errors.New("ChaCha20Cipher.Encrypt : ciphertext must have equal length or more than plaintext")
 		return
 	}
-	for bytescount = 0; bytescount < l; bytescount++ {
-		i := bytescount % 64
-		if i == 0 {
-			this.GetNextKeystream(&this.buffer)
+	return this.xorKeyStream(ciphertext, plaintext)
+}
+
+// XORKeyStream XORs each byte of src with the next byte of the keystream and writes the result in dst, dst and src may be the same slice for in place processing.
+//
+// XORKeyStream implements the crypto/cipher.Stream interface, and so panics if dst is smaller than src or if the keystream is exhausted.
+func (this *ChaCha20Cipher) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("ChaCha20Cipher.XORKeyStream : dst must have equal length or more than src")
+	}
+	if _, err := this.xorKeyStream(dst, src); err != nil {
+		panic(err)
+	}
+}
+
+// xorKeyStream XORs src with the keystream into dst and returns the number of processed bytes.
+//
+// The full 64 bytes blocks are processed with 8 bytes XORs, only the leftover keystream of the previous call and the tail are processed byte after byte.
+func (this *ChaCha20Cipher) xorKeyStream(dst, src []byte) (bytescount int, err error) {
+	if this.closed {
+		err = ErrCipherClosed
+		return
+	}
+	l := len(src)
+
+	// Use the keystream bytes left by the previous call
+	for ; (this.offset < 64) && (bytescount < l); bytescount++ {
+		dst[bytescount] = src[bytescount] ^ this.buffer[this.offset]
+		this.offset++
+	}
+
+	// Full blocks, up to chacha20MaxBlocks at a time
+	for (l - bytescount) >= 64 {
+		if this.exhausted {
+			err = ErrKeystreamExhausted
+			return
+		}
+		keystream := this.nextKeystreamBlocks((l - bytescount) >> 6)
+		d := dst[bytescount : bytescount+len(keystream)]
+		s := src[bytescount : bytescount+len(keystream)]
+		for i := 0; i < len(keystream); i += 8 {
+			binary.LittleEndian.PutUint64(d[i:], binary.LittleEndian.Uint64(s[i:])^binary.LittleEndian.Uint64(keystream[i:]))
+		}
+		bytescount += len(keystream)
+	}
+
+	// Tail
+	if bytescount < l {
+		if this.exhausted {
+			err = ErrKeystreamExhausted
+			return
+		}
+		this.GetNextKeystream(&this.buffer)
+		for this.offset = 0; bytescount < l; bytescount++ {
+			dst[bytescount] = src[bytescount] ^ this.buffer[this.offset]
+			this.offset++
 		}
-		ciphertext[bytescount] = plaintext[bytescount] ^ this.buffer[i]
 	}
 	return
 }
 
 // GetNetxKeystream fills the keystream bytes array corresponding to the current state of ChaCha20 grid and increment the block counter for the next block of keystream.
+//
+// When the block counter wraps, the keystream is marked as exhausted and Encrypt and Decrypt return ErrKeystreamExhausted until a new nonce is set.
+// GetNextKeystream panics after Close rather than producing the keystream of an all zeros key.
 func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
-	var x [16]uint32
+	if this.closed {
+		panic(ErrCipherClosed)
+	}
+	ChaCha20Block(&this.grid, keystream)
+
+	// Input words 12 is a block counter.
+	if this.grid[12] == 0xffffffff {
+		this.exhausted = true
+	}
+	this.grid[12]++
+}
+
+// nextKeystreamBlocks computes the keystream of the next n blocks in the blocks buffer and returns it, with at most
+// chacha20MaxBlocks blocks and no block after the wrap of the block counter. The keystream must not be exhausted.
+func (this *ChaCha20Cipher) nextKeystreamBlocks(n int) []byte {
+	if this.closed {
+		panic(ErrCipherClosed)
+	}
+	if n > chacha20MaxBlocks {
+		n = chacha20MaxBlocks
+	}
+	counter := uint64(this.grid[12])
+	if left := 1<<32 - counter; uint64(n) > left {
+		n = int(left)
+	}
+	keystream := this.blocks[:n<<6]
+	chacha20Blocks(&this.grid, keystream)
+
+	counter += uint64(n)
+	this.exhausted = counter == 1<<32
+	this.grid[12] = uint32(counter)
+	return keystream
+}
+
+// GridSnapshot returns a copy of the current state of the ChaCha20 grid.
+func (this *ChaCha20Cipher) GridSnapshot() [16]uint32 {
+	return this.grid
+}
+
+// ChaCha20Block is the ChaCha20 block function of RFC7539 section 2.3: it fills out with the 64 bytes of keystream of the state, and doesn't modify the state.
+func ChaCha20Block(state *[16]uint32, out *[64]byte) {
+	chacha20Blocks(state, out[:])
+}
+
+// chacha20Blocks fills out, a multiple of 64 bytes up to chacha20MaxBlocks blocks, with the keystream of the consecutive
+// block counters from the one of the state, wrapping at 32 bits, and doesn't modify the state.
+//
+// It runs the assembly block function of the CPU if useChaCha20Asm, see chacha20_amd64.go and chacha20_arm64.go.
+func chacha20Blocks(state *[16]uint32, out []byte) {
+	if useChaCha20Asm {
+		chacha20BlocksAsm(state, out)
+		return
+	}
+	s := *state
+	for ; len(out) >= 64; out = out[64:] {
+		chacha20BlockGeneric(&s, (*[64]byte)(out))
+		s[12]++
+	}
+}
+
+// chacha20BlockGeneric is the block function in Go, of the purego build tag and of the CPU without an assembly one.
+func chacha20BlockGeneric(state *[16]uint32, out *[64]byte) {
 	var a, b, c, d uint32
 
 	// chacha use a 4 x 4 grid of uint32:
@@ -126,9 +319,12 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 	//   +-----+-----+-----+-----+
 	//   | x12 | x13 | x14 | x15 |
 	//   +-----+-----+-----+-----+
-	for i := range x {
-		x[i] = this.grid[i]
-	}
+	//
+	// The grid is copied in 16 local variables so that the compiler can keep them in registers during the rounds.
+	x0, x1, x2, x3 := state[0], state[1], state[2], state[3]
+	x4, x5, x6, x7 := state[4], state[5], state[6], state[7]
+	x8, x9, x10, x11 := state[8], state[9], state[10], state[11]
+	x12, x13, x14, x15 := state[12], state[13], state[14], state[15]
 
 	// ChaCha20 consists of 20 rounds, alternating between "column" rounds and "diagonal" rounds.
 	// Each round applies the "quarterround" function four times, to a different set of words each time.
@@ -147,10 +343,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		//   +-----+-----+-----+-----+
 		//
 		// x[0], x[4], x[8], x[12] = quarterround(x[0], x[4], x[8], x[12])
-		a = x[0]
-		b = x[4]
-		c = x[8]
-		d = x[12]
+		a = x0
+		b = x4
+		c = x8
+		d = x12
 		a += b
 		d ^= a
 		d = d<<16 | d>>16 // this is a bitwise left rotation
@@ -163,10 +359,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		c += d
 		b ^= c
 		b = b<<7 | b>>25 // this is a bitwise left rotation
-		x[0] = a
-		x[4] = b
-		x[8] = c
-		x[12] = d
+		x0 = a
+		x4 = b
+		x8 = c
+		x12 = d
 
 		// QUARTER-ROUND on column 2:
 		//
@@ -181,10 +377,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		//   +-----+-----+-----+-----+
 		//
 		// x[1], x[5], x[9], x[13] = quarterround(x[1], x[5], x[9], x[13])
-		a = x[1]
-		b = x[5]
-		c = x[9]
-		d = x[13]
+		a = x1
+		b = x5
+		c = x9
+		d = x13
 		a += b
 		d ^= a
 		d = d<<16 | d>>16 // this is a bitwise left rotation
@@ -197,10 +393,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		c += d
 		b ^= c
 		b = b<<7 | b>>25 // this is a bitwise left rotation
-		x[1] = a
-		x[5] = b
-		x[9] = c
-		x[13] = d
+		x1 = a
+		x5 = b
+		x9 = c
+		x13 = d
 
 		// QUARTER-ROUND on column 3:
 		//
@@ -215,10 +411,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		//   +-----+-----+-----+-----+
 		//
 		// x[2], x[6], x[10], x[14] = quarterround(x[2], x[6], x[10], x[14])
-		a = x[2]
-		b = x[6]
-		c = x[10]
-		d = x[14]
+		a = x2
+		b = x6
+		c = x10
+		d = x14
 		a += b
 		d ^= a
 		d = d<<16 | d>>16 // this is a bitwise left rotation
@@ -231,10 +427,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		c += d
 		b ^= c
 		b = b<<7 | b>>25 // this is a bitwise left rotation
-		x[2] = a
-		x[6] = b
-		x[10] = c
-		x[14] = d
+		x2 = a
+		x6 = b
+		x10 = c
+		x14 = d
 
 		// QUARTER-ROUND on column 4:
 		//
@@ -249,10 +445,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		//   +-----+-----+-----+-----+
 		//
 		// x[3], x[7], x[11], x[15] = quarterround(x[3], x[7], x[11], x[15])
-		a = x[3]
-		b = x[7]
-		c = x[11]
-		d = x[15]
+		a = x3
+		b = x7
+		c = x11
+		d = x15
 		a += b
 		d ^= a
 		d = d<<16 | d>>16 // this is a bitwise left rotation
@@ -265,10 +461,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		c += d
 		b ^= c
 		b = b<<7 | b>>25 // this is a bitwise left rotation
-		x[3] = a
-		x[7] = b
-		x[11] = c
-		x[15] = d
+		x3 = a
+		x7 = b
+		x11 = c
+		x15 = d
 
 		// QUARTER-ROUND on diagonal 1:
 		//
@@ -283,10 +479,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		//   +-----+-----+-----+-----+
 		//
 		// x[0], x[5], x[10], x[15] = quarterround(x[0], x[5], x[10], x[15])
-		a = x[0]
-		b = x[5]
-		c = x[10]
-		d = x[15]
+		a = x0
+		b = x5
+		c = x10
+		d = x15
 		a += b
 		d ^= a
 		d = d<<16 | d>>16 // this is a bitwise left rotation
@@ -299,10 +495,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		c += d
 		b ^= c
 		b = b<<7 | b>>25 // this is a bitwise left rotation
-		x[0] = a
-		x[5] = b
-		x[10] = c
-		x[15] = d
+		x0 = a
+		x5 = b
+		x10 = c
+		x15 = d
 
 		// QUARTER-ROUND on diagonal 2:
 		//
@@ -317,10 +513,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		//   +-----+-----+-----+-----+
 		//
 		// x[1], x[6], x[11], x[12] = quarterround(x[1], x[6], x[11], x[12])
-		a = x[1]
-		b = x[6]
-		c = x[11]
-		d = x[12]
+		a = x1
+		b = x6
+		c = x11
+		d = x12
 		a += b
 		d ^= a
 		d = d<<16 | d>>16 // this is a bitwise left rotation
@@ -333,10 +529,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		c += d
 		b ^= c
 		b = b<<7 | b>>25 // this is a bitwise left rotation
-		x[1] = a
-		x[6] = b
-		x[11] = c
-		x[12] = d
+		x1 = a
+		x6 = b
+		x11 = c
+		x12 = d
 
 		// QUARTER-ROUND on diagonal 3:
 		//
@@ -351,10 +547,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		//   +-----+-----+-----+-----+
 		//
 		// x[2], x[7], x[8], x[13] = quarterround(x[2], x[7], x[8], x[13])
-		a = x[2]
-		b = x[7]
-		c = x[8]
-		d = x[13]
+		a = x2
+		b = x7
+		c = x8
+		d = x13
 		a += b
 		d ^= a
 		d = d<<16 | d>>16 // this is a bitwise left rotation
@@ -367,10 +563,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		c += d
 		b ^= c
 		b = b<<7 | b>>25 // this is a bitwise left rotation
-		x[2] = a
-		x[7] = b
-		x[8] = c
-		x[13] = d
+		x2 = a
+		x7 = b
+		x8 = c
+		x13 = d
 
 		// QUARTER-ROUND on diagonal 4:
 		//
@@ -385,10 +581,10 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		//   +-----+-----+-----+-----+
 		//
 		// x[3], x[4], x[9], x[14] = quarterround(x[3], x[4], x[9], x[14])
-		a = x[3]
-		b = x[4]
-		c = x[9]
-		d = x[14]
+		a = x3
+		b = x4
+		c = x9
+		d = x14
 		a += b
 		d ^= a
 		d = d<<16 | d>>16 // this is a bitwise left rotation
@@ -401,26 +597,28 @@ func (this *ChaCha20Cipher) GetNextKeystream(keystream *[64]byte) {
 		c += d
 		b ^= c
 		b = b<<7 | b>>25 // this is a bitwise left rotation
-		x[3] = a
-		x[4] = b
-		x[9] = c
-		x[14] = d
+		x3 = a
+		x4 = b
+		x9 = c
+		x14 = d
 	}
 
 	// After 20 rounds of the above processing, the original 16 input words are added to the 16 words to form the 16 output words.
-	for i := range x {
-		x[i] += this.grid[i]
-	}
-
 	// The 64 output bytes are generated from the 16 output words by serialising them in little-endian order and concatenating the results.
-	for i := 0; i < 64; i += 4 {
-		j := x[i>>2]
-		keystream[i] = byte(j)
-		keystream[i+1] = byte(j >> 8)
-		keystream[i+2] = byte(j >> 16)
-		keystream[i+3] = byte(j >> 24)
-	}
-
-	// Input words 12 is a block counter.
-	this.grid[12]++
+	binary.LittleEndian.PutUint32(out[0:], x0+state[0])
+	binary.LittleEndian.PutUint32(out[4:], x1+state[1])
+	binary.LittleEndian.PutUint32(out[8:], x2+state[2])
+	binary.LittleEndian.PutUint32(out[12:], x3+state[3])
+	binary.LittleEndian.PutUint32(out[16:], x4+state[4])
+	binary.LittleEndian.PutUint32(out[20:], x5+state[5])
+	binary.LittleEndian.PutUint32(out[24:], x6+state[6])
+	binary.LittleEndian.PutUint32(out[28:], x7+state[7])
+	binary.LittleEndian.PutUint32(out[32:], x8+state[8])
+	binary.LittleEndian.PutUint32(out[36:], x9+state[9])
+	binary.LittleEndian.PutUint32(out[40:], x10+state[10])
+	binary.LittleEndian.PutUint32(out[44:], x11+state[11])
+	binary.LittleEndian.PutUint32(out[48:], x12+state[12])
+	binary.LittleEndian.PutUint32(out[52:], x13+state[13])
+	binary.LittleEndian.PutUint32(out[56:], x14+state[14])
+	binary.LittleEndian.PutUint32(out[60:], x15+state[15])
 }
@@ -0,0 +1,13 @@
+//go:build !purego
+
+package crypto
+
+import "golang.org/x/sys/cpu"
+
+// useChaCha20Asm selects the AVX2 block function of chacha20_amd64.s, which computes 4 blocks in parallel.
+var useChaCha20Asm = cpu.X86.HasAVX2
+
+// chacha20BlocksAsm is chacha20Blocks in AVX2.
+//
+//go:noescape
+func chacha20BlocksAsm(state *[16]uint32, out []byte)
@@ -0,0 +1,144 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// The 4 blocks are computed as two pairs of blocks, a block in each 128-bit lane of the YMM registers: Y0-Y3 are the rows
+// of the blocks 0 and 1, Y4-Y7 the rows of the blocks 2 and 3. Y12-Y15 keep the rows of the state of the blocks 0 and 1.
+
+// QUARTERROUND runs the quarter-round on the 4 columns of the rows a, b, c and d, with the temporary register t.
+#define QUARTERROUND(a, b, c, d, t) \
+	VPADDD  b, a, a; \
+	VPXOR   a, d, d; \
+	VPSHUFB Y10, d, d; \
+	VPADDD  d, c, c; \
+	VPXOR   c, b, b; \
+	VPSLLD  $12, b, t; \
+	VPSRLD  $20, b, b; \
+	VPOR    t, b, b; \
+	VPADDD  b, a, a; \
+	VPXOR   a, d, d; \
+	VPSHUFB Y11, d, d; \
+	VPADDD  d, c, c; \
+	VPXOR   c, b, b; \
+	VPSLLD  $7, b, t; \
+	VPSRLD  $25, b, b; \
+	VPOR    t, b, b
+
+// DIAGONALIZE rotates the rows b, c and d by 1, 2 and 3 words to the left: the diagonals become columns.
+#define DIAGONALIZE(b, c, d) \
+	VPSHUFD $0x39, b, b; \
+	VPSHUFD $0x4e, c, c; \
+	VPSHUFD $0x93, d, d
+
+// UNDIAGONALIZE rotates the rows b, c and d back.
+#define UNDIAGONALIZE(b, c, d) \
+	VPSHUFD $0x93, b, b; \
+	VPSHUFD $0x4e, c, c; \
+	VPSHUFD $0x39, d, d
+
+// func chacha20BlocksAsm(state *[16]uint32, out []byte)
+TEXT ·chacha20BlocksAsm(SB), NOSPLIT, $0-32
+	MOVQ state+0(FP), AX
+	MOVQ out_base+8(FP), DI
+	MOVQ out_len+16(FP), CX
+	CMPQ CX, $64
+	JB   done
+
+	VMOVDQU ·chacha20Rotl16<>(SB), Y10
+	VMOVDQU ·chacha20Rotl8<>(SB), Y11
+	VBROADCASTI128 0(AX), Y12
+	VBROADCASTI128 16(AX), Y13
+	VBROADCASTI128 32(AX), Y14
+	VBROADCASTI128 48(AX), Y15
+	VPADDD  ·chacha20Inc01<>(SB), Y15, Y15
+	VMOVDQA Y12, Y0
+	VMOVDQA Y13, Y1
+	VMOVDQA Y14, Y2
+	VMOVDQA Y15, Y3
+	VMOVDQA Y12, Y4
+	VMOVDQA Y13, Y5
+	VMOVDQA Y14, Y6
+	VPADDD  ·chacha20Inc22<>(SB), Y15, Y7
+
+	// 10 double rounds
+	MOVQ $10, DX
+
+rounds:
+	QUARTERROUND(Y0, Y1, Y2, Y3, Y8)
+	QUARTERROUND(Y4, Y5, Y6, Y7, Y9)
+	DIAGONALIZE(Y1, Y2, Y3)
+	DIAGONALIZE(Y5, Y6, Y7)
+	QUARTERROUND(Y0, Y1, Y2, Y3, Y8)
+	QUARTERROUND(Y4, Y5, Y6, Y7, Y9)
+	UNDIAGONALIZE(Y1, Y2, Y3)
+	UNDIAGONALIZE(Y5, Y6, Y7)
+	DECQ DX
+	JNZ  rounds
+
+	// Add the state to the rows
+	VPADDD Y12, Y0, Y0
+	VPADDD Y13, Y1, Y1
+	VPADDD Y14, Y2, Y2
+	VPADDD Y15, Y3, Y3
+	VPADDD Y12, Y4, Y4
+	VPADDD Y13, Y5, Y5
+	VPADDD Y14, Y6, Y6
+	VPADDD ·chacha20Inc22<>(SB), Y15, Y15
+	VPADDD Y15, Y7, Y7
+
+	// Store the blocks asked: the low lanes are the blocks 0 and 2, the high lanes the blocks 1 and 3
+	VPERM2I128 $0x20, Y1, Y0, Y8
+	VPERM2I128 $0x20, Y3, Y2, Y9
+	VMOVDQU    Y8, 0(DI)
+	VMOVDQU    Y9, 32(DI)
+	CMPQ       CX, $128
+	JB         clear
+	VPERM2I128 $0x31, Y1, Y0, Y8
+	VPERM2I128 $0x31, Y3, Y2, Y9
+	VMOVDQU    Y8, 64(DI)
+	VMOVDQU    Y9, 96(DI)
+	CMPQ       CX, $192
+	JB         clear
+	VPERM2I128 $0x20, Y5, Y4, Y8
+	VPERM2I128 $0x20, Y7, Y6, Y9
+	VMOVDQU    Y8, 128(DI)
+	VMOVDQU    Y9, 160(DI)
+	CMPQ       CX, $256
+	JB         clear
+	VPERM2I128 $0x31, Y5, Y4, Y8
+	VPERM2I128 $0x31, Y7, Y6, Y9
+	VMOVDQU    Y8, 192(DI)
+	VMOVDQU    Y9, 224(DI)
+
+clear:
+	// No key material is left in the vector registers
+	VZEROALL
+
+done:
+	RET
+
+// VPSHUFB masks of the rotations by 16 and 8 bits to the left of each word
+DATA ·chacha20Rotl16<>+0x00(SB)/8, $0x0504070601000302
+DATA ·chacha20Rotl16<>+0x08(SB)/8, $0x0d0c0f0e09080b0a
+DATA ·chacha20Rotl16<>+0x10(SB)/8, $0x0504070601000302
+DATA ·chacha20Rotl16<>+0x18(SB)/8, $0x0d0c0f0e09080b0a
+GLOBL ·chacha20Rotl16<>(SB), (NOPTR+RODATA), $32
+
+DATA ·chacha20Rotl8<>+0x00(SB)/8, $0x0605040702010003
+DATA ·chacha20Rotl8<>+0x08(SB)/8, $0x0e0d0c0f0a09080b
+DATA ·chacha20Rotl8<>+0x10(SB)/8, $0x0605040702010003
+DATA ·chacha20Rotl8<>+0x18(SB)/8, $0x0e0d0c0f0a09080b
+GLOBL ·chacha20Rotl8<>(SB), (NOPTR+RODATA), $32
+
+// Increments of the block counters: 0 and 1 for the first pair of blocks, 2 more for the second pair
+DATA ·chacha20Inc01<>+0x00(SB)/8, $0
+DATA ·chacha20Inc01<>+0x08(SB)/8, $0
+DATA ·chacha20Inc01<>+0x10(SB)/8, $1
+DATA ·chacha20Inc01<>+0x18(SB)/8, $0
+GLOBL ·chacha20Inc01<>(SB), (NOPTR+RODATA), $32
+
+DATA ·chacha20Inc22<>+0x00(SB)/8, $2
+DATA ·chacha20Inc22<>+0x08(SB)/8, $0
+DATA ·chacha20Inc22<>+0x10(SB)/8, $2
+DATA ·chacha20Inc22<>+0x18(SB)/8, $0
+GLOBL ·chacha20Inc22<>(SB), (NOPTR+RODATA), $32
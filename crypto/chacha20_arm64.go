@@ -0,0 +1,13 @@
+//go:build !purego
+
+package crypto
+
+import "golang.org/x/sys/cpu"
+
+// useChaCha20Asm selects the NEON block function of chacha20_arm64.s, which computes 4 blocks in parallel.
+var useChaCha20Asm = cpu.ARM64.HasASIMD
+
+// chacha20BlocksAsm is chacha20Blocks in NEON.
+//
+//go:noescape
+func chacha20BlocksAsm(state *[16]uint32, out []byte)
@@ -0,0 +1,147 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// The 4 blocks are computed in parallel, a row of a block in each vector register: V0-V3 are the rows of the block 0,
+// V4-V7 of the block 1, V8-V11 of the block 2 and V12-V15 of the block 3. V22-V25 keep the rows of the state, V26-V28
+// the last rows of the blocks 1 to 3.
+
+// QUARTERROUND runs the quarter-round on the 4 columns of the rows a, b, c and d, with the temporary register t.
+#define QUARTERROUND(a, b, c, d, t) \
+	VADD   b.S4, a.S4, a.S4; \
+	VEOR   a.B16, d.B16, d.B16; \
+	VREV32 d.H8, d.H8; \
+	VADD   d.S4, c.S4, c.S4; \
+	VEOR   c.B16, b.B16, t.B16; \
+	VSHL   $12, t.S4, b.S4; \
+	VSRI   $20, t.S4, b.S4; \
+	VADD   b.S4, a.S4, a.S4; \
+	VEOR   a.B16, d.B16, d.B16; \
+	VTBL   V20.B16, [d.B16], d.B16; \
+	VADD   d.S4, c.S4, c.S4; \
+	VEOR   c.B16, b.B16, t.B16; \
+	VSHL   $7, t.S4, b.S4; \
+	VSRI   $25, t.S4, b.S4
+
+// DIAGONALIZE rotates the rows b, c and d by 1, 2 and 3 words to the left: the diagonals become columns.
+#define DIAGONALIZE(b, c, d) \
+	VEXT $4, b.B16, b.B16, b.B16; \
+	VEXT $8, c.B16, c.B16, c.B16; \
+	VEXT $12, d.B16, d.B16, d.B16
+
+// UNDIAGONALIZE rotates the rows b, c and d back.
+#define UNDIAGONALIZE(b, c, d) \
+	VEXT $12, b.B16, b.B16, b.B16; \
+	VEXT $8, c.B16, c.B16, c.B16; \
+	VEXT $4, d.B16, d.B16, d.B16
+
+// ZERO clears the 4 registers.
+#define ZERO(a, b, c, d) \
+	VEOR a.B16, a.B16, a.B16; \
+	VEOR b.B16, b.B16, b.B16; \
+	VEOR c.B16, c.B16, c.B16; \
+	VEOR d.B16, d.B16, d.B16
+
+// func chacha20BlocksAsm(state *[16]uint32, out []byte)
+TEXT ·chacha20BlocksAsm(SB), NOSPLIT, $0-32
+	MOVD state+0(FP), R0
+	MOVD out_base+8(FP), R1
+	MOVD out_len+16(FP), R2
+	CMP  $64, R2
+	BLT  done
+
+	MOVD $·chacha20Consts<>(SB), R3
+	VLD1 (R3), [V20.S4, V21.S4]
+	VLD1 (R0), [V22.S4, V23.S4, V24.S4, V25.S4]
+	VADD V21.S4, V25.S4, V26.S4
+	VADD V21.S4, V26.S4, V27.S4
+	VADD V21.S4, V27.S4, V28.S4
+	VMOV V22.B16, V0.B16
+	VMOV V23.B16, V1.B16
+	VMOV V24.B16, V2.B16
+	VMOV V25.B16, V3.B16
+	VMOV V22.B16, V4.B16
+	VMOV V23.B16, V5.B16
+	VMOV V24.B16, V6.B16
+	VMOV V26.B16, V7.B16
+	VMOV V22.B16, V8.B16
+	VMOV V23.B16, V9.B16
+	VMOV V24.B16, V10.B16
+	VMOV V27.B16, V11.B16
+	VMOV V22.B16, V12.B16
+	VMOV V23.B16, V13.B16
+	VMOV V24.B16, V14.B16
+	VMOV V28.B16, V15.B16
+
+	// 10 double rounds
+	MOVD $10, R3
+
+rounds:
+	QUARTERROUND(V0, V1, V2, V3, V16)
+	QUARTERROUND(V4, V5, V6, V7, V17)
+	QUARTERROUND(V8, V9, V10, V11, V18)
+	QUARTERROUND(V12, V13, V14, V15, V19)
+	DIAGONALIZE(V1, V2, V3)
+	DIAGONALIZE(V5, V6, V7)
+	DIAGONALIZE(V9, V10, V11)
+	DIAGONALIZE(V13, V14, V15)
+	QUARTERROUND(V0, V1, V2, V3, V16)
+	QUARTERROUND(V4, V5, V6, V7, V17)
+	QUARTERROUND(V8, V9, V10, V11, V18)
+	QUARTERROUND(V12, V13, V14, V15, V19)
+	UNDIAGONALIZE(V1, V2, V3)
+	UNDIAGONALIZE(V5, V6, V7)
+	UNDIAGONALIZE(V9, V10, V11)
+	UNDIAGONALIZE(V13, V14, V15)
+	SUB  $1, R3
+	CBNZ R3, rounds
+
+	// Add the state to the rows
+	VADD V22.S4, V0.S4, V0.S4
+	VADD V23.S4, V1.S4, V1.S4
+	VADD V24.S4, V2.S4, V2.S4
+	VADD V25.S4, V3.S4, V3.S4
+	VADD V22.S4, V4.S4, V4.S4
+	VADD V23.S4, V5.S4, V5.S4
+	VADD V24.S4, V6.S4, V6.S4
+	VADD V26.S4, V7.S4, V7.S4
+	VADD V22.S4, V8.S4, V8.S4
+	VADD V23.S4, V9.S4, V9.S4
+	VADD V24.S4, V10.S4, V10.S4
+	VADD V27.S4, V11.S4, V11.S4
+	VADD V22.S4, V12.S4, V12.S4
+	VADD V23.S4, V13.S4, V13.S4
+	VADD V24.S4, V14.S4, V14.S4
+	VADD V28.S4, V15.S4, V15.S4
+
+	// Store the blocks asked
+	VST1.P [V0.B16, V1.B16, V2.B16, V3.B16], 64(R1)
+	CMP    $128, R2
+	BLT    clear
+	VST1.P [V4.B16, V5.B16, V6.B16, V7.B16], 64(R1)
+	CMP    $192, R2
+	BLT    clear
+	VST1.P [V8.B16, V9.B16, V10.B16, V11.B16], 64(R1)
+	CMP    $256, R2
+	BLT    clear
+	VST1   [V12.B16, V13.B16, V14.B16, V15.B16], (R1)
+
+clear:
+	// No key material is left in the vector registers
+	ZERO(V0, V1, V2, V3)
+	ZERO(V4, V5, V6, V7)
+	ZERO(V8, V9, V10, V11)
+	ZERO(V12, V13, V14, V15)
+	ZERO(V16, V17, V18, V19)
+	ZERO(V22, V23, V24, V25)
+	ZERO(V26, V27, V28, V21)
+
+done:
+	RET
+
+// TBL indexes of the rotation by 8 bits to the left of each word, then the increment of the block counter
+DATA ·chacha20Consts<>+0x00(SB)/8, $0x0605040702010003
+DATA ·chacha20Consts<>+0x08(SB)/8, $0x0e0d0c0f0a09080b
+DATA ·chacha20Consts<>+0x10(SB)/8, $1
+DATA ·chacha20Consts<>+0x18(SB)/8, $0
+GLOBL ·chacha20Consts<>(SB), (NOPTR+RODATA), $32
@@ -0,0 +1,10 @@
+//go:build (!amd64 && !arm64) || purego
+
+package crypto
+
+// useChaCha20Asm is false without an assembly block function for the architecture, or with the purego build tag.
+var useChaCha20Asm = false
+
+func chacha20BlocksAsm(state *[16]uint32, out []byte) {
+	panic("chacha20BlocksAsm : no assembly block function")
+}
@@ -2,8 +2,17 @@ package crypto
 
 import "testing"
 import "bytes"
+import "errors"
+import "reflect"
+import "unsafe"
+import "encoding/binary"
+import "github.com/romain-jacotin/quic/protocol"
 
 func Test_Decrypt(t *testing.T) {
+	forEachChaCha20Block(t, func() { testDecrypt(t) })
+}
+
+func testDecrypt(t *testing.T) {
 	var cipher *ChaCha20Cipher
 	var err error
 	var l int
@@ -110,6 +119,10 @@ func Test_Decrypt(t *testing.T) {
 }
 
 func Test_Encrypt(t *testing.T) {
+	forEachChaCha20Block(t, func() { testEncrypt(t) })
+}
+
+func testEncrypt(t *testing.T) {
 	var cipher *ChaCha20Cipher
 	var err error
 	var l int
@@ -216,6 +229,10 @@ func Test_Encrypt(t *testing.T) {
 }
 
 func Test_GetNextKeyStream(t *testing.T) {
+	forEachChaCha20Block(t, func() { testGetNextKeyStream(t) })
+}
+
+func testGetNextKeyStream(t *testing.T) {
 	var cipher *ChaCha20Cipher
 	var err error
 
@@ -258,3 +275,447 @@ func Test_GetNextKeyStream(t *testing.T) {
 		t.Errorf("ChaCha20Cipher.GetNextKeyStream : invalid keystream %x", *keystream)
 	}
 }
+
+func Test_ResetForPacket(t *testing.T) {
+	forEachChaCha20Block(t, func() { testResetForPacket(t) })
+}
+
+func testResetForPacket(t *testing.T) {
+	var cipher *ChaCha20Cipher
+	var err error
+	var keystream1, keystream2 [64]byte
+
+	key := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31}
+	iv1 := []byte{0, 0, 0, 0x09, 0, 0, 0, 0x4a, 0, 0, 0, 0}
+	iv2 := []byte{0, 0, 0, 0x09, 0, 0, 0, 0x4b, 0, 0, 0, 0}
+	seqnum := protocol.QuicPacketSequenceNumber(0x0102030405060708)
+
+	if cipher, err = NewChaCha20Cipher(key, make([]byte, 12), 0); err != nil {
+		t.Error(err)
+	}
+
+	// Two different IVs with the same sequence number must give different keystreams
+	if err = cipher.SetIV(iv1); err != nil {
+		t.Error(err)
+	}
+	cipher.ResetForPacket(seqnum)
+	cipher.GetNextKeystream(&keystream1)
+	if err = cipher.SetIV(iv2); err != nil {
+		t.Error(err)
+	}
+	cipher.ResetForPacket(seqnum)
+	cipher.GetNextKeystream(&keystream2)
+	if bytes.Equal(keystream1[:], keystream2[:]) {
+		t.Error("ChaCha20Cipher.ResetForPacket : same keystream with different IVs")
+	}
+
+	// The nonce is the IV with the last 8 bytes XORed with the Little Endian sequence number, and the block counter is 1
+	nonce := append([]byte{}, iv1...)
+	for i := uint(0); i < 8; i++ {
+		nonce[4+i] ^= byte(seqnum >> (i << 3))
+	}
+	if cipher, err = NewChaCha20Cipher(key, nonce, 1); err != nil {
+		t.Error(err)
+	}
+	cipher.GetNextKeystream(&keystream2)
+	if !bytes.Equal(keystream1[:], keystream2[:]) {
+		t.Errorf("ChaCha20Cipher.ResetForPacket : invalid keystream %x", keystream1)
+	}
+
+	// The same sequence number with the same IV must give the same keystream again
+	if cipher, err = NewChaCha20Cipher(key, iv1, 0); err != nil {
+		t.Error(err)
+	}
+	cipher.ResetForPacket(seqnum)
+	cipher.GetNextKeystream(&keystream2)
+	if !bytes.Equal(keystream1[:], keystream2[:]) {
+		t.Error("ChaCha20Cipher.ResetForPacket : IV of NewChaCha20Cipher is not used")
+	}
+
+	// The keystream buffered for the previous packet is zeroed, the key words are kept
+	setup := cipher.GridSnapshot()
+	buffer := make([]byte, 300)
+	if _, err = cipher.Encrypt(buffer, buffer); err != nil {
+		t.Error(err)
+	}
+	cipher.ResetForPacket(seqnum + 1)
+	if cipher.buffer != [64]byte{} || cipher.blocks != [chacha20MaxBlocks * 64]byte{} || cipher.offset != 64 {
+		t.Error("ChaCha20Cipher.ResetForPacket : buffered keystream of the previous packet must be zeroed")
+	}
+	if grid := cipher.GridSnapshot(); [12]uint32(grid[:12]) != [12]uint32(setup[:12]) || grid[12] != 1 {
+		t.Errorf("ChaCha20Cipher.ResetForPacket : key words and block counter 1 expected instead of %x", grid)
+	}
+
+	if err = cipher.SetIV(iv1[:11]); !errors.Is(err, ErrBadKeyLength) {
+		t.Error("ChaCha20Cipher.SetIV : IV of 11 bytes must be rejected")
+	}
+}
+
+func Test_KeystreamExhausted(t *testing.T) {
+	forEachChaCha20Block(t, func() { testKeystreamExhausted(t) })
+}
+
+func testKeystreamExhausted(t *testing.T) {
+	var cipher *ChaCha20Cipher
+	var err error
+	var l int
+
+	key := make([]byte, 32)
+	nonce := make([]byte, 12)
+	buffer := make([]byte, 128)
+
+	// Fast-forward the block counter: only the blocks 0xfffffffe and 0xffffffff are available
+	if cipher, err = NewChaCha20Cipher(key, nonce, 0xfffffffe); err != nil {
+		t.Error(err)
+	}
+	if l, err = cipher.Encrypt(buffer, buffer); err != nil || l != 128 {
+		t.Errorf("ChaCha20Cipher.Encrypt : unexpected error %v or length %d before the counter wraps", err, l)
+	}
+	if l, err = cipher.Encrypt(buffer, buffer[:1]); err != ErrKeystreamExhausted || l != 0 {
+		t.Errorf("ChaCha20Cipher.Encrypt : ErrKeystreamExhausted expected instead of %v with length %d", err, l)
+	}
+	if _, err = cipher.Decrypt(buffer, buffer[:1]); err != ErrKeystreamExhausted {
+		t.Errorf("ChaCha20Cipher.Decrypt : ErrKeystreamExhausted expected instead of %v", err)
+	}
+
+	// The error must be returned in the middle of an encryption too
+	if cipher, err = NewChaCha20Cipher(key, nonce, 0xffffffff); err != nil {
+		t.Error(err)
+	}
+	if l, err = cipher.Decrypt(buffer, buffer); err != ErrKeystreamExhausted || l != 64 {
+		t.Errorf("ChaCha20Cipher.Decrypt : ErrKeystreamExhausted expected after 64 bytes instead of %v with length %d", err, l)
+	}
+
+	// A new nonce gives a fresh keystream
+	cipher.ResetForPacket(1)
+	if _, err = cipher.Encrypt(buffer, buffer); err != nil {
+		t.Errorf("ChaCha20Cipher.Encrypt : unexpected error %v after a new nonce", err)
+	}
+}
+
+func Test_EncryptChunked(t *testing.T) {
+	forEachChaCha20Block(t, func() { testEncryptChunked(t) })
+}
+
+func testEncryptChunked(t *testing.T) {
+	var cipher *ChaCha20Cipher
+	var err error
+
+	// RFC7539 Appendix A.5 plaintext and ciphertext, the encryption starts at block counter 1
+	v := tests_chacha20poly1305[1]
+	plaintext := toByte(v.plaintext)
+	ciphertext := toByte(v.ciphertext)
+	if cipher, err = NewChaCha20Cipher(toByte(v.key), toByte(v.nonce), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{1, 7, 16, 63, 64, 65, 100, len(plaintext)} {
+		buffer := make([]byte, len(plaintext))
+		cipher.Reset(1)
+		for i := 0; i < len(plaintext); i += size {
+			end := i + size
+			if end > len(plaintext) {
+				end = len(plaintext)
+			}
+			if _, err = cipher.Encrypt(buffer[i:end], plaintext[i:end]); err != nil {
+				t.Error(err)
+			}
+		}
+		if !bytes.Equal(buffer, ciphertext) {
+			t.Errorf("ChaCha20Cipher.Encrypt : chunks of %d bytes differ from one-shot encryption", size)
+		}
+
+		cipher.Reset(1)
+		for i := 0; i < len(ciphertext); i += size {
+			end := i + size
+			if end > len(ciphertext) {
+				end = len(ciphertext)
+			}
+			if _, err = cipher.Decrypt(buffer[i:end], ciphertext[i:end]); err != nil {
+				t.Error(err)
+			}
+		}
+		if !bytes.Equal(buffer, plaintext) {
+			t.Errorf("ChaCha20Cipher.Decrypt : chunks of %d bytes differ from one-shot decryption", size)
+		}
+	}
+
+	// Without Reset the keystream continues
+	buffer := make([]byte, len(plaintext))
+	cipher.Reset(1)
+	cipher.Encrypt(buffer, plaintext)
+	cipher.Encrypt(buffer, plaintext)
+	if bytes.Equal(buffer, ciphertext) {
+		t.Error("ChaCha20Cipher.Encrypt : keystream reused without Reset")
+	}
+}
+
+func Test_XORKeyStream(t *testing.T) {
+	forEachChaCha20Block(t, func() { testXORKeyStream(t) })
+}
+
+func testXORKeyStream(t *testing.T) {
+	var c1, c2 *ChaCha20Cipher
+	var err error
+
+	// RFC7539 Appendix A.5 : in place encryption must match the ciphertext
+	v := tests_chacha20poly1305[1]
+	if c1, err = NewChaCha20Cipher(toByte(v.key), toByte(v.nonce), 1); err != nil {
+		t.Fatal(err)
+	}
+	buffer := toByte(v.plaintext)
+	c1.XORKeyStream(buffer, buffer)
+	if !bytes.Equal(buffer, toByte(v.ciphertext)) {
+		t.Errorf("ChaCha20Cipher.XORKeyStream : invalid in place encryption %x", buffer)
+	}
+
+	// In place output must match the out of place Encrypt
+	key := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31}
+	nonce := []byte{0, 0, 0, 0, 0, 0, 0, 0x4a, 0, 0, 0, 0}
+	for _, l := range []int{0, 1, 63, 64, 65, 1000} {
+		plaintext := make([]byte, l)
+		for i := range plaintext {
+			plaintext[i] = byte(i)
+		}
+		if c1, err = NewChaCha20Cipher(key, nonce, 1); err != nil {
+			t.Fatal(err)
+		}
+		if c2, err = NewChaCha20Cipher(key, nonce, 1); err != nil {
+			t.Fatal(err)
+		}
+		ciphertext := make([]byte, l)
+		if _, err = c1.Encrypt(ciphertext, plaintext); err != nil {
+			t.Error(err)
+		}
+		c2.XORKeyStream(plaintext, plaintext)
+		if !bytes.Equal(plaintext, ciphertext) {
+			t.Errorf("ChaCha20Cipher.XORKeyStream : in place output differs from Encrypt for length %d", l)
+		}
+	}
+}
+
+// forEachChaCha20Block runs test with the generic block function, as with the purego build tag, then with the assembly
+// block function if the CPU has one.
+func forEachChaCha20Block(t *testing.T, test func()) {
+	defer useGenericChaCha20Block()()
+
+	test()
+	if useChaCha20Asm = chacha20AsmAvailable; useChaCha20Asm {
+		failed := t.Failed()
+		test()
+		if !failed && t.Failed() {
+			t.Logf("%s : failed with the assembly block function only", t.Name())
+		}
+	}
+}
+
+// chacha20AsmAvailable is true if the CPU has an assembly block function and the purego build tag is not set.
+var chacha20AsmAvailable = useChaCha20Asm
+
+// useGenericChaCha20Block forces the generic block function, until the returned function restores the selected one.
+func useGenericChaCha20Block() func() {
+	useChaCha20Asm = false
+	return func() { useChaCha20Asm = chacha20AsmAvailable }
+}
+
+var tests_chacha20blocks = []struct {
+	counter uint32
+	blocks  int
+}{
+	{0, 1},
+	{1, 2},
+	{7, 3},
+	{1, 4},
+	{0xffffffff, 1},
+	{0xfffffffe, 4},
+	{0xfffffffd, 4},
+}
+
+func Test_ChaCha20Blocks(t *testing.T) {
+	if !chacha20AsmAvailable {
+		t.Skip("no assembly block function")
+	}
+	var state [16]uint32
+	for i := range state {
+		state[i] = uint32(i) * 0x9e3779b9
+	}
+	for i, v := range tests_chacha20blocks {
+		var generic, asm [chacha20MaxBlocks * 64]byte
+
+		state[12] = v.counter
+		setup := state
+		restore := useGenericChaCha20Block()
+		chacha20Blocks(&state, generic[:v.blocks*64])
+		restore()
+		chacha20Blocks(&state, asm[:v.blocks*64])
+		if asm != generic {
+			t.Errorf("chacha20BlocksAsm : keystream %x expected instead of %x in test n°%v", generic, asm, i)
+		}
+		if state != setup {
+			t.Errorf("chacha20BlocksAsm : state must not be modified in test n°%v", i)
+		}
+	}
+}
+
+func BenchmarkChaCha20Encrypt1350(b *testing.B) {
+	key := make([]byte, 32)
+	nonce := make([]byte, 12)
+	plaintext := make([]byte, 1350)
+	ciphertext := make([]byte, 1350)
+	cipher, err := NewChaCha20Cipher(key, nonce, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(plaintext)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cipher.ResetForPacket(protocol.QuicPacketSequenceNumber(i))
+		cipher.Encrypt(ciphertext, plaintext)
+	}
+}
+
+func Test_ChaCha20Block(t *testing.T) {
+	forEachChaCha20Block(t, func() { testChaCha20Block(t) })
+}
+
+func testChaCha20Block(t *testing.T) {
+	var cipher *ChaCha20Cipher
+	var err error
+	var out [64]byte
+
+	// RFC7539 section 2.3.2 : Test Vector for the ChaCha20 Block Function
+	key := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31}
+	nonce := []byte{0, 0, 0, 0x09, 0, 0, 0, 0x4a, 0, 0, 0, 0}
+	if cipher, err = NewChaCha20Cipher(key, nonce, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// ChaCha state with the key setup
+	setup := [16]uint32{
+		0x61707865, 0x3320646e, 0x79622d32, 0x6b206574,
+		0x03020100, 0x07060504, 0x0b0a0908, 0x0f0e0d0c,
+		0x13121110, 0x17161514, 0x1b1a1918, 0x1f1e1d1c,
+		0x00000001, 0x09000000, 0x4a000000, 0x00000000}
+	state := cipher.GridSnapshot()
+	if state != setup {
+		t.Errorf("ChaCha20Cipher.GridSnapshot : invalid state after setup %x", state)
+	}
+
+	// ChaCha state after 20 rounds, recovered from the block function output by removing the original state
+	rounds := [16]uint32{
+		0x837778ab, 0xe238d763, 0xa67ae21e, 0x5950bb2f,
+		0xc4f2d0c7, 0xfc62bb2f, 0x8fa018fc, 0x3f5ec7b7,
+		0x335271c2, 0xf29489f3, 0xeabda8fc, 0x82e46ebd,
+		0xd19c12b4, 0xb04e16de, 0x9e83d0cb, 0x4e3c50a2}
+	ChaCha20Block(&state, &out)
+	for i := range rounds {
+		if binary.LittleEndian.Uint32(out[i<<2:])-state[i] != rounds[i] {
+			t.Errorf("ChaCha20Block : invalid word %d of the state after 20 rounds", i)
+		}
+	}
+	if state != setup {
+		t.Error("ChaCha20Block : state must not be modified")
+	}
+
+	// Serialized block
+	if !bytes.Equal(out[:], []byte{
+		0x10, 0xf1, 0xe7, 0xe4, 0xd1, 0x3b, 0x59, 0x15, 0x50, 0x0f, 0xdd, 0x1f, 0xa3, 0x20, 0x71, 0xc4,
+		0xc7, 0xd1, 0xf4, 0xc7, 0x33, 0xc0, 0x68, 0x03, 0x04, 0x22, 0xaa, 0x9a, 0xc3, 0xd4, 0x6c, 0x4e,
+		0xd2, 0x82, 0x64, 0x46, 0x07, 0x9f, 0xaa, 0x09, 0x14, 0xc2, 0xd7, 0x05, 0xd9, 0x8b, 0x02, 0xa2,
+		0xb5, 0x12, 0x9c, 0xd1, 0xde, 0x16, 0x4e, 0xb9, 0xcb, 0xd0, 0x83, 0xe8, 0xa2, 0x50, 0x3c, 0x4e}) {
+		t.Errorf("ChaCha20Block : invalid serialized block %x", out)
+	}
+
+	// GetNextKeystream only increments the block counter
+	cipher.GetNextKeystream(&out)
+	setup[12]++
+	if cipher.GridSnapshot() != setup {
+		t.Errorf("ChaCha20Cipher.GetNextKeystream : invalid state %x", cipher.GridSnapshot())
+	}
+}
+
+// checkZeroArrays fails if any array field of the struct pointed by v is not zeroed.
+func checkZeroArrays(t *testing.T, name string, v interface{}) {
+	s := reflect.ValueOf(v).Elem()
+	for i := 0; i < s.NumField(); i++ {
+		if f := s.Field(i); f.Kind() == reflect.Array && !f.IsZero() {
+			t.Errorf("%s.Close : field %s is not zeroed", name, s.Type().Field(i).Name)
+		}
+	}
+}
+
+func Test_ChaCha20Cipher_Close(t *testing.T) {
+	key := toByte("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	nonce := toByte("000000090000004a00000000")
+	buffer := make([]byte, 100)
+
+	c, err := NewChaCha20Cipher(key, nonce, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Encrypt(buffer, buffer[:70]); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkZeroArrays(t, "ChaCha20Cipher", c)
+
+	// The key words must not survive in the backing array of the grid
+	grid := (*[64]byte)(unsafe.Pointer(&c.grid))
+	if !bytes.Equal(grid[:], make([]byte, 64)) {
+		t.Errorf("ChaCha20Cipher.Close : grid backing array is not zeroed %x", grid[:])
+	}
+
+	if _, err = c.Encrypt(buffer, buffer); err != ErrCipherClosed {
+		t.Errorf("ChaCha20Cipher.Encrypt : ErrCipherClosed expected instead of %v", err)
+	}
+	c.ResetForPacket(1)
+	if _, err = c.Decrypt(buffer, buffer); err != ErrCipherClosed {
+		t.Errorf("ChaCha20Cipher.Decrypt : ErrCipherClosed expected instead of %v", err)
+	}
+}
+
+var tests_chacha20lengths = []struct {
+	keylen   int
+	noncelen int
+	valid    bool
+}{
+	{31, 12, false},
+	{32, 12, true},
+	{33, 12, false},
+	{64, 12, false},
+	{32, 11, false},
+	{32, 13, false},
+	{0, 0, false},
+}
+
+func Test_NewChaCha20Cipher_Lengths(t *testing.T) {
+	for _, v := range tests_chacha20lengths {
+		c, err := NewChaCha20Cipher(make([]byte, v.keylen), make([]byte, v.noncelen), 0)
+		if v.valid && (err != nil || c == nil) {
+			t.Errorf("NewChaCha20Cipher : %d bytes key and %d bytes nonce must be accepted : %v", v.keylen, v.noncelen, err)
+		}
+		if !v.valid && (!errors.Is(err, ErrBadKeyLength) || c != nil) {
+			t.Errorf("NewChaCha20Cipher : %d bytes key and %d bytes nonce must be rejected", v.keylen, v.noncelen)
+		}
+	}
+
+	_, err := NewChaCha20Cipher(make([]byte, 33), make([]byte, 12), 0)
+	if !errors.Is(err, ErrBadKeyLength) || err.Error() != "NewChaCha20Cipher : key must be 32 bytes length, got 33 bytes" {
+		t.Errorf("NewChaCha20Cipher : invalid error message %v", err)
+	}
+
+	c, _ := NewChaCha20Cipher(make([]byte, 32), make([]byte, 12), 0)
+	for _, l := range []int{11, 13} {
+		if err = c.SetIV(make([]byte, l)); !errors.Is(err, ErrBadKeyLength) {
+			t.Errorf("ChaCha20Cipher.SetIV : %d bytes IV must be rejected", l)
+		}
+	}
+}
+
+// The generic block function, the reference of the assembly one.
+func BenchmarkChaCha20Encrypt1350Generic(b *testing.B) {
+	defer useGenericChaCha20Block()()
+	BenchmarkChaCha20Encrypt1350(b)
+}
@@ -0,0 +1,190 @@
+package crypto
+
+import "github.com/romain-jacotin/quic/protocol"
+import "crypto/cipher"
+import "fmt"
+import "sync"
+
+// ChaCha20Poly1305AEAD is the AEAD_CHACHA20_POLY1305 construction described in RFC7539 section 2.8 : http://tools.ietf.org/html/rfc7539
+//
+// The one-time Poly1305 key is generated from the ChaCha20 block zero of each nonce, and the plaintext is encrypted starting at block one.
+// The ChaCha20 grid is keyed once: a Seal or an Open only rewrites its nonce and block counter words.
+//
+// ChaCha20Poly1305AEAD implements the crypto/cipher.AEAD interface.
+type ChaCha20Poly1305AEAD struct {
+	tagSize int
+	// mutex guards the state of the packet being sealed or opened, and closed
+	mutex  sync.Mutex
+	state  chacha20Poly1305State
+	closed bool
+}
+
+var _ cipher.AEAD = (*ChaCha20Poly1305AEAD)(nil)
+
+const chacha20Poly1305NonceSize = 12
+const chacha20Poly1305TagSize = 16
+
+// NewChaCha20Poly1305AEAD returns a ChaCha20Poly1305AEAD keyed with the 256-bit key.
+func NewChaCha20Poly1305AEAD(key []byte) (*ChaCha20Poly1305AEAD, error) {
+	return newChaCha20Poly1305AEAD(key, nil, chacha20Poly1305TagSize)
+}
+
+// newChaCha20Poly1305AEAD returns a ChaCha20Poly1305AEAD that truncates the tag to tagSize bytes, as QUIC does with its 12 bytes tag.
+// The 12 bytes iv is the IV of the nonces of sealPacket and openPacket, if any.
+func newChaCha20Poly1305AEAD(key, iv []byte, tagSize int) (*ChaCha20Poly1305AEAD, error) {
+	var zero [chacha20Poly1305NonceSize]byte
+
+	if len(key) != CHACHA20_KEYSIZE {
+		return nil, keyLengthError(fmt.Sprintf("NewChaCha20Poly1305AEAD : key must be %d bytes length, got %d bytes", CHACHA20_KEYSIZE, len(key)))
+	}
+	if iv == nil {
+		iv = zero[:]
+	}
+	aead := new(ChaCha20Poly1305AEAD)
+	if err := aead.state.stream.init(key, iv, 0); err != nil {
+		return nil, err
+	}
+	aead.tagSize = tagSize
+	return aead, nil
+}
+
+// NonceSize returns the size of the nonce that must be passed to Seal and Open.
+func (this *ChaCha20Poly1305AEAD) NonceSize() int {
+	return chacha20Poly1305NonceSize
+}
+
+// Overhead returns the maximum difference between the lengths of a plaintext and its ciphertext.
+func (this *ChaCha20Poly1305AEAD) Overhead() int {
+	return this.tagSize
+}
+
+// Close zeroes the key. Open returns ErrCipherClosed and Seal panics after Close.
+func (this *ChaCha20Poly1305AEAD) Close() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.state.stream.Close()
+	this.state.hasher.Close()
+	this.closed = true
+	return nil
+}
+
+// Seal encrypts and authenticates plaintext with the 96-bit nonce, authenticates aad, and appends the result followed by the tag to dst.
+//
+// To reuse plaintext's storage for the encrypted output, use plaintext[:0] as dst. Seal panics if the nonce is not 12 bytes long.
+func (this *ChaCha20Poly1305AEAD) Seal(dst, nonce, plaintext, aad []byte) []byte {
+	if len(nonce) != chacha20Poly1305NonceSize {
+		panic("ChaCha20Poly1305AEAD.Seal : nonce must be 96-bit")
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.closed {
+		panic(ErrCipherClosed)
+	}
+	this.state.stream.resetForNonce(nonce)
+	return this.seal(dst, plaintext, aad)
+}
+
+// Open verifies the tag and the aad, then decrypts ciphertext with the 96-bit nonce and appends the result to dst.
+//
+// No plaintext is released if the authentication fails, ErrAuthenticationFailed is returned instead.
+// To reuse ciphertext's storage for the decrypted output, use ciphertext[:0] as dst. Open panics if the nonce is not 12 bytes long.
+func (this *ChaCha20Poly1305AEAD) Open(dst, nonce, ciphertext, aad []byte) ([]byte, error) {
+	if len(nonce) != chacha20Poly1305NonceSize {
+		panic("ChaCha20Poly1305AEAD.Open : nonce must be 96-bit")
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.closed {
+		return nil, ErrCipherClosed
+	}
+	this.state.stream.resetForNonce(nonce)
+	return this.open(dst, ciphertext, aad)
+}
+
+// sealPacket is Seal with the nonce of the IV and of the packet sequence number, see ChaCha20Cipher.ResetForPacket.
+func (this *ChaCha20Poly1305AEAD) sealPacket(seqnum protocol.QuicPacketSequenceNumber, dst, plaintext, aad []byte) ([]byte, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.closed {
+		return nil, ErrCipherClosed
+	}
+	this.state.stream.ResetForPacket(seqnum)
+	return this.seal(dst, plaintext, aad), nil
+}
+
+// openPacket is Open with the nonce of the IV and of the packet sequence number, see ChaCha20Cipher.ResetForPacket.
+func (this *ChaCha20Poly1305AEAD) openPacket(seqnum protocol.QuicPacketSequenceNumber, dst, ciphertext, aad []byte) ([]byte, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.closed {
+		return nil, ErrCipherClosed
+	}
+	this.state.stream.ResetForPacket(seqnum)
+	return this.open(dst, ciphertext, aad)
+}
+
+// seal is Seal once the cipher is at block one of the nonce, the mutex must be locked.
+func (this *ChaCha20Poly1305AEAD) seal(dst, plaintext, aad []byte) []byte {
+	state := &this.state
+	state.start()
+	defer state.hasher.Close()
+
+	ret, out := sliceForAppend(dst, len(plaintext)+this.tagSize)
+	state.stream.Encrypt(out, plaintext)
+	state.hasher.updateAead(aad, out[:len(plaintext)])
+	tag := state.hasher.Finish()
+	copy(out[len(plaintext):], tag[:this.tagSize])
+	return ret
+}
+
+// open is Open once the cipher is at block one of the nonce, the mutex must be locked.
+func (this *ChaCha20Poly1305AEAD) open(dst, ciphertext, aad []byte) ([]byte, error) {
+	l := len(ciphertext) - this.tagSize
+	if l < 0 {
+		return nil, ErrAuthenticationFailed
+	}
+	state := &this.state
+	state.start()
+	defer state.hasher.Close()
+
+	// Authenticate first
+	state.hasher.updateAead(aad, ciphertext[:l])
+	tag := state.hasher.Finish()
+	if !ConstantTimeEqual(tag[:this.tagSize], ciphertext[l:]) {
+		return nil, ErrAuthenticationFailed
+	}
+
+	// Then decrypt
+	ret, out := sliceForAppend(dst, l)
+	state.stream.Decrypt(out, ciphertext[:l])
+	return ret, nil
+}
+
+// chacha20Poly1305State is the keystream and the authenticator of the packet being sealed or opened.
+type chacha20Poly1305State struct {
+	stream ChaCha20Cipher
+	hasher Poly1305
+}
+
+// start keys Poly1305 with the block zero of the nonce of the cipher, and leaves the cipher at block one.
+// The one-time key must be zeroed with hasher.Close after the packet.
+func (this *chacha20Poly1305State) start() {
+	var block [64]byte
+
+	this.stream.Reset(0)
+	this.stream.GetNextKeystream(&block)
+	this.hasher.init(block[:32])
+	block = [64]byte{}
+}
+
+// sliceForAppend extends the slice in by n bytes. It returns the extended slice and the n bytes tail of it.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,296 @@
+package crypto
+
+import "testing"
+import "bytes"
+import "errors"
+import "crypto/cipher"
+
+// Test Vectors taken from RFC7539 : http://tools.ietf.org/html/rfc7539
+
+var tests_chacha20poly1305 = []struct {
+	key        string
+	nonce      string
+	aad        string
+	plaintext  string
+	ciphertext string
+	tag        string
+}{
+	{
+		// Section 2.8.2 : Example and Test Vector for AEAD_CHACHA20_POLY1305
+		"808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f",
+		"070000004041424344454647",
+		"50515253c0c1c2c3c4c5c6c7",
+		"4c616469657320616e642047656e746c656d656e206f662074686520636c617373206f66202739393a204966204920636f756c64206f6666657220796f75206f6e6c79206f6e652074697020666f7220746865206675747572652c2073756e73637265656e20776f756c642062652069742e",
+		"d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d63dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b3692ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc3ff4def08e4b7a9de576d26586cec64b6116",
+		"1ae10b594f09e26a7e902ecbd0600691"},
+	{
+		// Appendix A.5 : ChaCha20-Poly1305 AEAD Decryption
+		"1c9240a5eb55d38af333888604f6b5f0473917c1402b80099dca5cbc207075c0",
+		"000000000102030405060708",
+		"f33388860000000000004e91",
+		"496e7465726e65742d4472616674732061726520647261667420646f63756d656e74732076616c696420666f722061206d6178696d756d206f6620736978206d6f6e74687320616e64206d617920626520757064617465642c207265706c616365642c206f72206f62736f6c65746564206279206f7468657220646f63756d656e747320617420616e792074696d652e20497420697320696e617070726f70726961746520746f2075736520496e7465726e65742d447261667473206173207265666572656e6365206d6174657269616c206f7220746f2063697465207468656d206f74686572207468616e206173202fe2809c776f726b20696e2070726f67726573732e2fe2809d",
+		"64a0861575861af460f062c79be643bd5e805cfd345cf389f108670ac76c8cb24c6cfc18755d43eea09ee94e382d26b0bdb7b73c321b0100d4f03b7f355894cf332f830e710b97ce98c8a84abd0b948114ad176e008d33bd60f982b1ff37c8559797a06ef4f0ef61c186324e2b3506383606907b6a7c02b0f9f6157b53c867e4b9166c767b804d46a59b5216cde7a4e99040c5a40433225ee282a1b0a06c523eaf4534d7f83fa1155b0047718cbc546a0d072b04b3564eea1b422273f548271a0bb2316053fa76991955ebd63159434ecebb4e466dae5a1073a6727627097a1049e617d91d361094fa68f0ff77987130305beaba2eda04df997b714d6c6f2c29a6ad5cb4022b02709b",
+		"eead9d67890cbb22392336fea1851f38"},
+}
+
+func Test_ChaCha20Poly1305AEAD_Seal(t *testing.T) {
+	forEachChaCha20Block(t, func() { testChaCha20Poly1305AEADSeal(t) })
+}
+
+func testChaCha20Poly1305AEADSeal(t *testing.T) {
+	for i, v := range tests_chacha20poly1305 {
+		aead, err := NewChaCha20Poly1305AEAD(toByte(v.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed := aead.Seal(nil, toByte(v.nonce), toByte(v.plaintext), toByte(v.aad))
+		if !bytes.Equal(sealed, append(toByte(v.ciphertext), toByte(v.tag)...)) {
+			t.Errorf("ChaCha20Poly1305AEAD.Seal : invalid ciphertext or tag for test vector %d : %x", i, sealed)
+		}
+
+		// Seal in place must give the same result
+		buffer := toByte(v.plaintext)
+		sealed = aead.Seal(buffer[:0], toByte(v.nonce), buffer, toByte(v.aad))
+		if !bytes.Equal(sealed, append(toByte(v.ciphertext), toByte(v.tag)...)) {
+			t.Errorf("ChaCha20Poly1305AEAD.Seal : invalid in place encryption for test vector %d", i)
+		}
+	}
+}
+
+func Test_ChaCha20Poly1305AEAD_Open(t *testing.T) {
+	forEachChaCha20Block(t, func() { testChaCha20Poly1305AEADOpen(t) })
+}
+
+func testChaCha20Poly1305AEADOpen(t *testing.T) {
+	for i, v := range tests_chacha20poly1305 {
+		aead, err := NewChaCha20Poly1305AEAD(toByte(v.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed := append(toByte(v.ciphertext), toByte(v.tag)...)
+		opened, err := aead.Open(nil, toByte(v.nonce), sealed, toByte(v.aad))
+		if err != nil {
+			t.Errorf("ChaCha20Poly1305AEAD.Open : test vector %d : %v", i, err)
+		}
+		if !bytes.Equal(opened, toByte(v.plaintext)) {
+			t.Errorf("ChaCha20Poly1305AEAD.Open : invalid plaintext for test vector %d : %x", i, opened)
+		}
+
+		// Any modification of the ciphertext, the tag or the aad must be detected
+		for j := range sealed {
+			sealed[j] ^= 0x80
+			if opened, err = aead.Open(nil, toByte(v.nonce), sealed, toByte(v.aad)); !errors.Is(err, ErrAuthenticationFailed) || opened != nil {
+				t.Errorf("ChaCha20Poly1305AEAD.Open : modification of byte %d not detected for test vector %d", j, i)
+			}
+			sealed[j] ^= 0x80
+		}
+		aad := toByte(v.aad)
+		aad[0] ^= 1
+		if _, err = aead.Open(nil, toByte(v.nonce), sealed, aad); !errors.Is(err, ErrAuthenticationFailed) {
+			t.Errorf("ChaCha20Poly1305AEAD.Open : modification of aad not detected for test vector %d", i)
+		}
+
+		// Ciphertext shorter than the tag
+		if _, err = aead.Open(nil, toByte(v.nonce), sealed[:15], toByte(v.aad)); !errors.Is(err, ErrAuthenticationFailed) {
+			t.Errorf("ChaCha20Poly1305AEAD.Open : truncated ciphertext not detected for test vector %d", i)
+		}
+	}
+}
+
+func Fuzz_ChaCha20Poly1305AEAD(f *testing.F) {
+	for _, v := range tests_chacha20poly1305 {
+		f.Add(toByte(v.key), toByte(v.nonce), toByte(v.plaintext), toByte(v.aad))
+	}
+	f.Add(make([]byte, 32), make([]byte, 12), []byte{}, []byte{})
+
+	f.Fuzz(func(t *testing.T, key, nonce, plaintext, aad []byte) {
+		if len(key) < 32 || len(nonce) < 12 {
+			t.Skip()
+		}
+		aead, err := NewChaCha20Poly1305AEAD(key[:32])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed := aead.Seal(nil, nonce[:12], plaintext, aad)
+		if len(sealed) != len(plaintext)+16 {
+			t.Fatalf("ChaCha20Poly1305AEAD.Seal : invalid sealed length %d for plaintext length %d", len(sealed), len(plaintext))
+		}
+		opened, err := aead.Open(nil, nonce[:12], sealed, aad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(opened, plaintext) {
+			t.Fatalf("ChaCha20Poly1305AEAD.Open : round trip failure %x versus %x", opened, plaintext)
+		}
+	})
+}
+
+func Test_ChaCha20Poly1305AEAD_CipherAEAD(t *testing.T) {
+	var aead cipher.AEAD
+	var err error
+
+	for i, v := range tests_chacha20poly1305 {
+		if aead, err = NewChaCha20Poly1305AEAD(toByte(v.key)); err != nil {
+			t.Fatal(err)
+		}
+		if aead.NonceSize() != 12 {
+			t.Errorf("ChaCha20Poly1305AEAD.NonceSize : invalid nonce size %d", aead.NonceSize())
+		}
+		if aead.Overhead() != 16 {
+			t.Errorf("ChaCha20Poly1305AEAD.Overhead : invalid overhead %d", aead.Overhead())
+		}
+		sealed := aead.Seal(nil, toByte(v.nonce), toByte(v.plaintext), toByte(v.aad))
+		if !bytes.Equal(sealed, append(toByte(v.ciphertext), toByte(v.tag)...)) {
+			t.Errorf("ChaCha20Poly1305AEAD.Seal : invalid ciphertext or tag for test vector %d", i)
+		}
+		if len(sealed) != len(toByte(v.plaintext))+aead.Overhead() {
+			t.Errorf("ChaCha20Poly1305AEAD.Seal : invalid sealed length for test vector %d", i)
+		}
+
+		// Seal must append to dst
+		prefix := []byte("prefix")
+		sealed = aead.Seal(prefix, toByte(v.nonce), toByte(v.plaintext), toByte(v.aad))
+		if !bytes.Equal(sealed[:len(prefix)], prefix) || !bytes.Equal(sealed[len(prefix):], append(toByte(v.ciphertext), toByte(v.tag)...)) {
+			t.Errorf("ChaCha20Poly1305AEAD.Seal : invalid append to dst for test vector %d", i)
+		}
+
+		// Open in place
+		sealed = sealed[len(prefix):]
+		opened, err := aead.Open(sealed[:0], toByte(v.nonce), sealed, toByte(v.aad))
+		if err != nil {
+			t.Errorf("ChaCha20Poly1305AEAD.Open : test vector %d : %v", i, err)
+		}
+		if !bytes.Equal(opened, toByte(v.plaintext)) {
+			t.Errorf("ChaCha20Poly1305AEAD.Open : invalid in place decryption for test vector %d", i)
+		}
+	}
+}
+
+func Test_ChaCha20Poly1305AEAD_Close(t *testing.T) {
+	v := tests_chacha20poly1305[0]
+	aead, err := NewChaCha20Poly1305AEAD(toByte(v.key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := aead.Seal(nil, toByte(v.nonce), toByte(v.plaintext), toByte(v.aad))
+	if err = aead.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkZeroArrays(t, "ChaCha20Poly1305AEAD", &aead.state.stream)
+	checkZeroArrays(t, "ChaCha20Poly1305AEAD", &aead.state.hasher)
+
+	if _, err = aead.Open(nil, toByte(v.nonce), sealed, toByte(v.aad)); err != ErrCipherClosed {
+		t.Errorf("ChaCha20Poly1305AEAD.Open : ErrCipherClosed expected instead of %v", err)
+	}
+	defer func() {
+		if recover() != ErrCipherClosed {
+			t.Error("ChaCha20Poly1305AEAD.Seal : panic with ErrCipherClosed expected")
+		}
+	}()
+	aead.Seal(nil, toByte(v.nonce), toByte(v.plaintext), toByte(v.aad))
+}
+
+func Test_ChaCha20Poly1305AEAD_Allocs(t *testing.T) {
+	aead, err := NewChaCha20Poly1305AEAD(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, 12)
+	aad := make([]byte, 13)
+	plaintext := make([]byte, 1200)
+	sealed := make([]byte, 0, len(plaintext)+aead.Overhead())
+	opened := make([]byte, 0, len(plaintext))
+
+	// The keyed cipher state is reused by every packet
+	if n := testing.AllocsPerRun(100, func() { sealed = aead.Seal(sealed[:0], nonce, plaintext, aad) }); n != 0 {
+		t.Errorf("ChaCha20Poly1305AEAD.Seal : %v allocations per packet of 1200 bytes", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { aead.Open(opened[:0], nonce, sealed, aad) }); n != 0 {
+		t.Errorf("ChaCha20Poly1305AEAD.Open : %v allocations per packet of 1200 bytes", n)
+	}
+}
+
+func Test_ChaCha20Poly1305AEAD_Sizes(t *testing.T) {
+	forEachChaCha20Block(t, func() { testChaCha20Poly1305AEADSizes(t) })
+}
+
+func testChaCha20Poly1305AEADSizes(t *testing.T) {
+	v := tests_chacha20poly1305[0]
+	aead, err := NewChaCha20Poly1305AEAD(toByte(v.key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 1350)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	// Every size up to three blocks with the partial chunks of the aad and of the tail, and a packet
+	for _, size := range append([]int{1350}, makeRange(0, 200)...) {
+		for _, aadSize := range []int{0, 13, 16} {
+			aad := data[:aadSize]
+			sealed := aead.Seal(nil, toByte(v.nonce), data[:size], aad)
+			buffer := make([]byte, size, size+aead.Overhead())
+			copy(buffer, data)
+			if buffer = aead.Seal(buffer[:0], toByte(v.nonce), buffer, aad); !bytes.Equal(buffer, sealed) {
+				t.Fatalf("ChaCha20Poly1305AEAD.Seal : in place encryption of %d bytes and %d bytes of aad failed", size, aadSize)
+			}
+			opened, err := aead.Open(buffer[:0], toByte(v.nonce), buffer, aad)
+			if err != nil || !bytes.Equal(opened, data[:size]) {
+				t.Fatalf("ChaCha20Poly1305AEAD.Open : in place decryption of %d bytes and %d bytes of aad failed (%v)", size, aadSize, err)
+			}
+		}
+	}
+
+	// Nothing of a forged packet is decrypted
+	sealed := aead.Seal(nil, toByte(v.nonce), data, nil)
+	sealed[len(sealed)-1] ^= 1
+	out := make([]byte, len(data))
+	if _, err = aead.Open(out[:0], toByte(v.nonce), sealed, nil); !errors.Is(err, ErrAuthenticationFailed) || !bytes.Equal(out, make([]byte, len(data))) {
+		t.Errorf("ChaCha20Poly1305AEAD.Open : no plaintext expected after ErrAuthenticationFailed (%v)", err)
+	}
+}
+
+// makeRange returns the integers from min to max excluded.
+func makeRange(min, max int) []int {
+	r := make([]int, 0, max-min)
+	for i := min; i < max; i++ {
+		r = append(r, i)
+	}
+	return r
+}
+
+func BenchmarkChaCha20Poly1305Seal1350(b *testing.B) {
+	benchmarkChaCha20Poly1305(b, func(aead *ChaCha20Poly1305AEAD, out, nonce, plaintext, aad []byte) {
+		aead.Seal(out[:0], nonce, plaintext[:len(plaintext)-16], aad)
+	})
+}
+
+func BenchmarkChaCha20Poly1305Open1350(b *testing.B) {
+	benchmarkChaCha20Poly1305(b, func(aead *ChaCha20Poly1305AEAD, out, nonce, ciphertext, aad []byte) {
+		if _, err := aead.Open(out[:0], nonce, ciphertext, aad); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
+// benchmarkChaCha20Poly1305 runs f on a sealed packet of 1350 bytes, tag included, with a public header of 13 bytes as aad.
+func benchmarkChaCha20Poly1305(b *testing.B, f func(aead *ChaCha20Poly1305AEAD, out, nonce, data, aad []byte)) {
+	aead, err := NewChaCha20Poly1305AEAD(make([]byte, 32))
+	if err != nil {
+		b.Fatal(err)
+	}
+	nonce := make([]byte, 12)
+	aad := make([]byte, 13)
+	sealed := aead.Seal(nil, nonce, make([]byte, 1350-16), aad)
+	out := make([]byte, 1350)
+	b.SetBytes(int64(len(sealed)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f(aead, out, nonce, sealed, aad)
+	}
+}
+
+func BenchmarkChaCha20Poly1305Seal1350Generic(b *testing.B) {
+	defer useGenericChaCha20Block()()
+	BenchmarkChaCha20Poly1305Seal1350(b)
+}
@@ -0,0 +1,11 @@
+package crypto
+
+import "crypto/subtle"
+
+// ConstantTimeEqual returns true if a and b have the same length and content.
+//
+// The time taken depends on the length of the slices but not on their content, so it must be used to compare MACs, hashes,
+// diversification nonces and source-address tokens. Nil slices are handled as empty slices.
+func ConstantTimeEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
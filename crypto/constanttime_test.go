@@ -0,0 +1,27 @@
+package crypto
+
+import "testing"
+
+var tests_constanttime = []struct {
+	a, b  []byte
+	equal bool
+}{
+	{[]byte{1, 2, 3}, []byte{1, 2, 3}, true},
+	{[]byte{1, 2, 3}, []byte{1, 2, 4}, false},
+	{[]byte{0, 2, 3}, []byte{1, 2, 3}, false},
+	{[]byte{1, 2, 3}, []byte{1, 2}, false},
+	{[]byte{1, 2}, []byte{1, 2, 3}, false},
+	{[]byte{}, []byte{}, true},
+	{nil, nil, true},
+	{nil, []byte{}, true},
+	{nil, []byte{0}, false},
+	{[]byte{0}, nil, false},
+}
+
+func Test_ConstantTimeEqual(t *testing.T) {
+	for i, v := range tests_constanttime {
+		if ConstantTimeEqual(v.a, v.b) != v.equal {
+			t.Errorf("ConstantTimeEqual : test %d must return %v for %x and %x", i, v.equal, v.a, v.b)
+		}
+	}
+}
@@ -5,35 +5,90 @@ import "golang.org/x/crypto/curve25519"
 import "io"
 import "errors"
 
+// ErrInvalidSharedSecret is returned when the Diffie-Hellman shared secret is all zeros, that is when the peer public key is a low order point (RFC7748 section 6.1).
+var ErrInvalidSharedSecret = errors.New("ECDH : invalid all zeros Curve25519 shared secret")
+
 type c255 struct {
 	publicKey  [32]byte
 	privateKey [32]byte
 }
 
+// GenerateKeyPair returns a new Curve25519 private/public key pair using the random source.
+func GenerateKeyPair(rand io.Reader) (priv, pub [32]byte, err error) {
+	var p []byte
+
+	if _, err = io.ReadFull(rand, priv[:]); err != nil {
+		return
+	}
+	if p, err = curve25519.X25519(priv[:], curve25519.Basepoint); err != nil {
+		return
+	}
+	copy(pub[:], p)
+	return
+}
+
+// SharedSecret returns the Curve25519 Diffie-Hellman shared secret of the local private key and the peer public key.
+//
+// ErrInvalidSharedSecret is returned if the shared secret is all zeros, as advised by RFC7748.
+func SharedSecret(priv, peerPub [32]byte) (secret [32]byte, err error) {
+	var s []byte
+
+	// X25519 already rejects the all zeros output, but the check must not depend on it
+	if s, err = curve25519.X25519(priv[:], peerPub[:]); err != nil {
+		err = ErrInvalidSharedSecret
+		return
+	}
+	copy(secret[:], s)
+	if ConstantTimeEqual(secret[:], make([]byte, 32)) {
+		err = ErrInvalidSharedSecret
+	}
+	return
+}
+
 // NewECDH_Curve25519 returns an Elliptic Curve Diffie-Hellman Curve25519 KeyExchange algorithm.
 func NewECDH_Curve25519() (err error, keyexchange KeyExchange) {
 	c := new(c255)
-	_, err = io.ReadFull(rand.Reader, c.privateKey[:])
-	if err != nil {
+	if c.privateKey, c.publicKey, err = GenerateKeyPair(rand.Reader); err != nil {
 		return
 	}
-	curve25519.ScalarBaseMult(&c.publicKey, &c.privateKey)
 	return nil, c
 }
 
-// GetPublicKey generates local private/public keys pair and returns the local public key that should be sent to the remote host.
-func (this *c255) GetPublicKey() []byte {
+// NewECDH_Curve25519FromPrivateKey returns an Elliptic Curve Diffie-Hellman Curve25519 KeyExchange algorithm with the 32 bytes private key.
+func NewECDH_Curve25519FromPrivateKey(privateKey []byte) (error, KeyExchange) {
+	if len(privateKey) != 32 {
+		return errors.New("ECDH : invalid Curve25519 private key"), nil
+	}
+	c := new(c255)
+	copy(c.privateKey[:], privateKey)
+	p, err := curve25519.X25519(c.privateKey[:], curve25519.Basepoint)
+	if err != nil {
+		return err, nil
+	}
+	copy(c.publicKey[:], p)
+	return nil, c
+}
+
+// PublicKey returns the local public key that should be sent to the remote host.
+func (this *c255) PublicKey() []byte {
 	return this.publicKey[:]
 }
 
-// ComputeSharedKey computes and returns the shared key based on the local private key and the remote public key.
-func (this *c255) ComputeSharedKey(remotePublicKey []byte) (error, []byte) {
+// PrivateKey returns the local private key.
+func (this *c255) PrivateKey() []byte {
+	return this.privateKey[:]
+}
+
+// ComputeSharedSecret computes and returns the shared secret based on the local private key and the remote public key.
+func (this *c255) ComputeSharedSecret(remotePublicKey []byte) ([]byte, error) {
 	var remote [32]byte
 	if len(remotePublicKey) != 32 {
-		return errors.New("ECDH : invalid Curve25519 KeyExchange"), nil
+		return nil, errors.New("ECDH : invalid Curve25519 KeyExchange")
 	}
-	sharedKey := new([32]byte)
 	copy(remote[:], remotePublicKey)
-	curve25519.ScalarMult(sharedKey, &this.privateKey, &remote)
-	return nil, sharedKey[:]
+	secret, err := SharedSecret(this.privateKey, remote)
+	if err != nil {
+		return nil, err
+	}
+	return secret[:], nil
 }
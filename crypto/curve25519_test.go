@@ -16,16 +16,16 @@ func TestECDH_Curve25519(test *testing.T) {
 		return
 	}
 
-	pubKeyClient := keyExchangeClient.GetPublicKey()
-	pubKeyServer := keyExchangeServer.GetPublicKey()
+	pubKeyClient := keyExchangeClient.PublicKey()
+	pubKeyServer := keyExchangeServer.PublicKey()
 
-	errClient, sharedKeyClient := keyExchangeClient.ComputeSharedKey(pubKeyServer)
+	sharedKeyClient, errClient := keyExchangeClient.ComputeSharedSecret(pubKeyServer)
 	if errClient != nil {
 		test.Error("ECDH_Curve25519: can't compute shared key at client side")
 		return
 	}
 
-	errServer, sharedKeyServer := keyExchangeServer.ComputeSharedKey(pubKeyClient)
+	sharedKeyServer, errServer := keyExchangeServer.ComputeSharedSecret(pubKeyClient)
 	if errServer != nil {
 		test.Error("ECDH_Curve25519: can't compute shared key at server side")
 		return
@@ -36,3 +36,75 @@ func TestECDH_Curve25519(test *testing.T) {
 		return
 	}
 }
+
+func Test_Curve25519_RFC7748(t *testing.T) {
+	var alicePriv, alicePub, bobPriv, bobPub [32]byte
+
+	// RFC7748 section 6.1 : Curve25519 Diffie-Hellman
+	copy(alicePriv[:], toByte("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a"))
+	copy(bobPriv[:], toByte("5dab087e624a8a4b79e17f8b83800ee66f3bb1292618b6fd1c2f8b27ff88e0eb"))
+	shared := toByte("4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742")
+
+	priv, pub, err := GenerateKeyPair(bytes.NewReader(alicePriv[:]))
+	if err != nil || priv != alicePriv {
+		t.Fatalf("GenerateKeyPair : invalid private key %x or error %v", priv, err)
+	}
+	alicePub = pub
+	if !bytes.Equal(alicePub[:], toByte("8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a")) {
+		t.Errorf("GenerateKeyPair : invalid Alice public key %x", alicePub)
+	}
+	if _, bobPub, err = GenerateKeyPair(bytes.NewReader(bobPriv[:])); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bobPub[:], toByte("de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f")) {
+		t.Errorf("GenerateKeyPair : invalid Bob public key %x", bobPub)
+	}
+
+	secret, err := SharedSecret(alicePriv, bobPub)
+	if err != nil || !bytes.Equal(secret[:], shared) {
+		t.Errorf("SharedSecret : invalid Alice shared secret %x or error %v", secret, err)
+	}
+	secret, err = SharedSecret(bobPriv, alicePub)
+	if err != nil || !bytes.Equal(secret[:], shared) {
+		t.Errorf("SharedSecret : invalid Bob shared secret %x or error %v", secret, err)
+	}
+
+	// RFC7748 section 5.2 : X25519 test vector #1
+	var k, u [32]byte
+	copy(k[:], toByte("a546e36bf0527c9d3b16154b82465edd62144c0ac1fc5a18506a2244ba449ac4"))
+	copy(u[:], toByte("e6db6867583030db3594c1a424b15f7c726624ec26b3353b10a903a6d0ab1c4c"))
+	secret, err = SharedSecret(k, u)
+	if err != nil || !bytes.Equal(secret[:], toByte("c3da55379de9c6908e94ea4df28d084f32eccf03491c71f754b4075577a28552")) {
+		t.Errorf("SharedSecret : invalid X25519 output %x or error %v", secret, err)
+	}
+
+	// Not enough randomness
+	if _, _, err = GenerateKeyPair(bytes.NewReader(alicePriv[:31])); err == nil {
+		t.Error("GenerateKeyPair : error expected with a short random source")
+	}
+}
+
+func Test_Curve25519_RejectAllZero(t *testing.T) {
+	var zero, one [32]byte
+
+	priv, _, err := GenerateKeyPair(bytes.NewReader(toByte("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The points 0 and 1 are low order points that give an all zeros shared secret
+	one[0] = 1
+	for _, peer := range [][32]byte{zero, one} {
+		if _, err = SharedSecret(priv, peer); err != ErrInvalidSharedSecret {
+			t.Errorf("SharedSecret : ErrInvalidSharedSecret expected for peer public key %x instead of %v", peer, err)
+		}
+	}
+
+	err, kx := NewECDH_Curve25519()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = kx.ComputeSharedSecret(zero[:]); err != ErrInvalidSharedSecret {
+		t.Errorf("c255.ComputeSharedSecret : ErrInvalidSharedSecret expected instead of %v", err)
+	}
+}
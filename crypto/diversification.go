@@ -0,0 +1,101 @@
+package crypto
+
+import "github.com/romain-jacotin/quic/protocol"
+import "crypto/hmac"
+import "crypto/sha256"
+import "errors"
+
+// LABEL_KEY_DIVERSIFICATION is the label of the HKDF info used to diversify the initial keys of the server.
+const LABEL_KEY_DIVERSIFICATION = "QUIC key diversification"
+
+// ErrNotDiversified is returned by DiversifiableAEAD.Open before the diversification nonce is known.
+var ErrNotDiversified = errors.New("DiversifiableAEAD.Open : the keys are not diversified yet")
+
+// DiversifyKey returns the key and the IV diversified with the 32 bytes diversification nonce chosen by the server:
+//
+//	prk     = HKDF-Extract(salt = nonce, key + iv)
+//	key, iv = HKDF-Expand(prk, "QUIC key diversification", len(key) + len(iv))
+func DiversifyKey(key, iv, nonce []byte) ([]byte, []byte, error) {
+	if len(nonce) != protocol.QUIC_DIVERSIFICATION_NONCE_SIZE {
+		return nil, nil, keyLengthError("DiversifyKey : the diversification nonce must be 32 bytes")
+	}
+	extract := hmac.New(sha256.New, nonce)
+	extract.Write(key)
+	extract.Write(iv)
+	okm := hkdfExpand(extract.Sum(nil), []byte(LABEL_KEY_DIVERSIFICATION), len(key)+len(iv))
+	return okm[:len(key)], okm[len(key):], nil
+}
+
+// DiversifyServerKeys replaces the server write key and IV with their diversification by the nonce,
+// as the server does for its initial keys.
+func (this *DerivedKeys) DiversifyServerKeys(nonce []byte) error {
+	key, iv, err := DiversifyKey(this.Server.Key, this.Server.IV, nonce)
+	if err != nil {
+		return err
+	}
+	this.Server = KeyPair{Key: key, IV: iv}
+	return nil
+}
+
+// DiversifiableAEAD is the opener of the initial keys of the server on the client: the server diversifies its keys with the nonce
+// sent in the public header of its initial packets, so that no packet can be opened before the nonce is known.
+//
+// Diversify returns the AEAD of the diversified keys, the DiversifiableAEAD itself never opens or seals a packet.
+type DiversifiableAEAD struct {
+	factory AEADFactory
+	key     []byte
+	iv      []byte
+	macSize int
+}
+
+var _ AEAD = (*DiversifiableAEAD)(nil)
+var _ protocol.DiversifiableOpener = (*DiversifiableAEAD)(nil)
+
+// NewDiversifiableAEAD returns the DiversifiableAEAD of the AEAD factory with the server write key and IV not yet diversified.
+func NewDiversifiableAEAD(factory AEADFactory, key, iv []byte) (*DiversifiableAEAD, error) {
+	aead, err := factory(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	defer aead.Close()
+	return &DiversifiableAEAD{
+		factory: factory,
+		key:     append([]byte{}, key...),
+		iv:      append([]byte{}, iv...),
+		macSize: aead.GetMacSize()}, nil
+}
+
+// Diversify returns the opener of the keys diversified with the nonce.
+func (this *DiversifiableAEAD) Diversify(nonce []byte) (protocol.PacketOpener, error) {
+	key, iv, err := DiversifyKey(this.key, this.iv, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return this.factory(key, iv)
+}
+
+// Open always fails with ErrNotDiversified.
+func (this *DiversifiableAEAD) Open(sequencenumber protocol.QuicPacketSequenceNumber, plaintext, aad, ciphertext []byte) (int, error) {
+	return 0, ErrNotDiversified
+}
+
+// Seal always fails, the client never seals with the keys of the server.
+func (this *DiversifiableAEAD) Seal(sequencenumber protocol.QuicPacketSequenceNumber, ciphertext, aad, plaintext []byte) (int, error) {
+	return 0, errors.New("DiversifiableAEAD.Seal : the keys of the server can't seal")
+}
+
+// GetMacSize returns the MAC size of the AEAD.
+func (this *DiversifiableAEAD) GetMacSize() int {
+	return this.macSize
+}
+
+// Close zeroes the key material.
+func (this *DiversifiableAEAD) Close() error {
+	for i := range this.key {
+		this.key[i] = 0
+	}
+	for i := range this.iv {
+		this.iv[i] = 0
+	}
+	return nil
+}
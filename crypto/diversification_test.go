@@ -0,0 +1,99 @@
+package crypto
+
+import "github.com/romain-jacotin/quic/protocol"
+import "bytes"
+import "crypto/hmac"
+import "crypto/sha256"
+import "errors"
+import "testing"
+
+func Test_DiversifyKey(t *testing.T) {
+	key := toByte("000102030405060708090a0b0c0d0e0f")
+	iv := toByte("10111213")
+	nonce := bytes.Repeat([]byte{0x42}, protocol.QUIC_DIVERSIFICATION_NONCE_SIZE)
+
+	// A single HMAC block: T(1) = HMAC(HMAC(nonce, key + iv), label + 0x01)
+	extract := hmac.New(sha256.New, nonce)
+	extract.Write(key)
+	extract.Write(iv)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(LABEL_KEY_DIVERSIFICATION))
+	expand.Write([]byte{1})
+	okm := expand.Sum(nil)
+
+	k, i, err := DiversifyKey(key, iv, nonce)
+	if err != nil {
+		t.Fatalf("DiversifyKey : unexpected error %v", err)
+	}
+	if !bytes.Equal(k, okm[:16]) || !bytes.Equal(i, okm[16:20]) {
+		t.Errorf("DiversifyKey : invalid key %x and iv %x", k, i)
+	}
+
+	// Another nonce gives other keys, the nonce is 32 bytes
+	other := bytes.Repeat([]byte{0x43}, protocol.QUIC_DIVERSIFICATION_NONCE_SIZE)
+	if k2, _, _ := DiversifyKey(key, iv, other); bytes.Equal(k, k2) {
+		t.Error("DiversifyKey : the nonce is not used")
+	}
+	if _, _, err = DiversifyKey(key, iv, nonce[:16]); !errors.Is(err, ErrBadKeyLength) {
+		t.Error("DiversifyKey : a nonce of 16 bytes must be rejected")
+	}
+}
+
+func Test_DiversifiableAEAD(t *testing.T) {
+	key := toByte("000102030405060708090a0b0c0d0e0f")
+	iv := toByte("10111213")
+	nonce := bytes.Repeat([]byte{0x42}, protocol.QUIC_DIVERSIFICATION_NONCE_SIZE)
+	factory, err := LookupAEAD(uint32(protocol.TagAESG))
+	if err != nil {
+		t.Fatalf("LookupAEAD : unexpected error %v", err)
+	}
+
+	// The server seals with the diversified keys
+	keys := &DerivedKeys{Server: KeyPair{Key: key, IV: iv}}
+	if err = keys.DiversifyServerKeys(nonce); err != nil {
+		t.Fatalf("DerivedKeys.DiversifyServerKeys : unexpected error %v", err)
+	}
+	sealer, err := factory(keys.Server.Key, keys.Server.IV)
+	if err != nil {
+		t.Fatalf("AEADFactory : unexpected error %v", err)
+	}
+	plaintext := []byte("SHLO")
+	ciphertext := make([]byte, len(plaintext)+sealer.GetMacSize())
+	n, err := sealer.Seal(1, ciphertext, []byte("header"), plaintext)
+	if err != nil {
+		t.Fatalf("AEAD.Seal : unexpected error %v", err)
+	}
+
+	// The client opens with the keys diversified with the same nonce only
+	opener, err := NewDiversifiableAEAD(factory, key, iv)
+	if err != nil {
+		t.Fatalf("NewDiversifiableAEAD : unexpected error %v", err)
+	}
+	if opener.GetMacSize() != sealer.GetMacSize() {
+		t.Errorf("DiversifiableAEAD.GetMacSize : %v expected instead of %v", sealer.GetMacSize(), opener.GetMacSize())
+	}
+	out := make([]byte, n)
+	if _, err = opener.Open(1, out, []byte("header"), ciphertext[:n]); err != ErrNotDiversified {
+		t.Errorf("DiversifiableAEAD.Open : ErrNotDiversified expected instead of %v", err)
+	}
+	var tests_diversify = []struct {
+		nonce []byte
+		valid bool
+	}{
+		{nonce, true},
+		{bytes.Repeat([]byte{0x43}, protocol.QUIC_DIVERSIFICATION_NONCE_SIZE), false},
+	}
+	for i, v := range tests_diversify {
+		diversified, err := opener.Diversify(v.nonce)
+		if err != nil {
+			t.Fatalf("DiversifiableAEAD.Diversify : unexpected error %v in test n°%v", err, i)
+		}
+		m, err := diversified.Open(1, out, []byte("header"), ciphertext[:n])
+		if v.valid && (err != nil || !bytes.Equal(out[:m], plaintext)) {
+			t.Errorf("AEAD.Open : the packet of the server can't be opened (%v) in test n°%v", err, i)
+		}
+		if !v.valid && err == nil {
+			t.Errorf("AEAD.Open : the packet of the server must not be opened with another nonce in test n°%v", i)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package crypto
+
+import "crypto/cipher"
+import "encoding/binary"
+
+// FNV128a is an incremental FNV-1a 128-bit hasher.
+type FNV128a struct {
+	high, low uint64
+}
+
+// NewFNV128a returns a FNV128a initialized with the FNV-1a 128-bit offset basis.
+func NewFNV128a() *FNV128a {
+	h := new(FNV128a)
+	h.Reset()
+	return h
+}
+
+// Reset restores the offset basis.
+func (this *FNV128a) Reset() {
+	// offset_basis = 0x6C62272E 07BB0142 62B82175 6295C58D
+	this.high = 0x6C62272E07BB0142
+	this.low = 0x62B821756295C58D
+}
+
+// Write adds data to the running hash, it never returns an error.
+func (this *FNV128a) Write(data []byte) (int, error) {
+	this.high, this.low = IncrementalHashFNV1A_128(this.high, this.low, data)
+	return len(data), nil
+}
+
+// Sum128 returns the 128-bit hash of all the data written since the creation or the last Reset.
+func (this *FNV128a) Sum128() (high, low uint64) {
+	return this.high, this.low
+}
+
+// NullAEAD is the NULL encryption of the unencrypted phase of the QUIC handshake: the plaintext is not encrypted
+// but prefixed by the FNV-1a 128-bit hash of aad followed by plaintext, truncated to 12 bytes and written in Little Endian.
+//
+// NullAEAD implements the crypto/cipher.AEAD interface, so that the packet layer can switch to a real AEAD at handshake completion.
+// The nonce is not used and can be nil.
+type NullAEAD struct {
+}
+
+var _ cipher.AEAD = (*NullAEAD)(nil)
+
+const nullAEADHashSize = 12
+
+// NewNullAEAD returns a NullAEAD.
+func NewNullAEAD() *NullAEAD {
+	return new(NullAEAD)
+}
+
+// NonceSize returns 0, the nonce is not used.
+func (this *NullAEAD) NonceSize() int {
+	return 0
+}
+
+// Overhead returns the size of the truncated hash.
+func (this *NullAEAD) Overhead() int {
+	return nullAEADHashSize
+}
+
+// Seal appends to dst the 12 bytes hash of aad and plaintext followed by the plaintext.
+func (this *NullAEAD) Seal(dst, nonce, plaintext, aad []byte) []byte {
+	var hash [nullAEADHashSize]byte
+
+	this.computeHash(&hash, aad, plaintext)
+	ret, out := sliceForAppend(dst, nullAEADHashSize+len(plaintext))
+	// copy the plaintext first as it may overlap with the hash
+	copy(out[nullAEADHashSize:], plaintext)
+	copy(out, hash[:])
+	return ret
+}
+
+// Open verifies the 12 bytes hash of aad and the plaintext that follows, then appends the plaintext to dst.
+//
+// ErrAuthenticationFailed is returned if the hash is invalid.
+func (this *NullAEAD) Open(dst, nonce, ciphertext, aad []byte) ([]byte, error) {
+	var hash [nullAEADHashSize]byte
+
+	if len(ciphertext) < nullAEADHashSize {
+		return nil, ErrAuthenticationFailed
+	}
+	this.computeHash(&hash, aad, ciphertext[nullAEADHashSize:])
+	if !ConstantTimeEqual(hash[:], ciphertext[:nullAEADHashSize]) {
+		return nil, ErrAuthenticationFailed
+	}
+	ret, out := sliceForAppend(dst, len(ciphertext)-nullAEADHashSize)
+	copy(out, ciphertext[nullAEADHashSize:])
+	return ret, nil
+}
+
+// computeHash writes the truncated hash of aad and plaintext.
+func (this *NullAEAD) computeHash(hash *[nullAEADHashSize]byte, aad, plaintext []byte) {
+	h := NewFNV128a()
+	h.Write(aad)
+	h.Write(plaintext)
+	high, low := h.Sum128()
+	binary.LittleEndian.PutUint64(hash[:], low)
+	binary.LittleEndian.PutUint32(hash[8:], uint32(high))
+}
@@ -0,0 +1,72 @@
+package crypto
+
+import "testing"
+import "bytes"
+import "errors"
+
+func Test_FNV128a(t *testing.T) {
+	h := NewFNV128a()
+
+	// Empty string gives the offset basis
+	if high, low := h.Sum128(); high != 0x6c62272e07bb0142 || low != 0x62b821756295c58d {
+		t.Errorf("FNV128a.Sum128 : bad hash %x %x", high, low)
+	}
+
+	// "foobar" written in several chunks
+	h.Write([]byte("foo"))
+	h.Write([]byte(""))
+	h.Write([]byte("ba"))
+	h.Write([]byte("r"))
+	if high, low := h.Sum128(); high != 0x343e1662793c64bf || low != 0x6f0d3597ba446f18 {
+		t.Errorf("FNV128a.Sum128 : bad hash %x %x", high, low)
+	}
+
+	h.Reset()
+	h.Write([]byte("a"))
+	if high, low := h.Sum128(); high != 0xd228cb696f1a8caf || low != 0x78912b704e4a8964 {
+		t.Errorf("FNV128a.Sum128 : bad hash after Reset %x %x", high, low)
+	}
+}
+
+func Test_NullAEAD(t *testing.T) {
+	aead := NewNullAEAD()
+
+	// Test vector of Chromium's QUIC null encrypter
+	aad := []byte("hello world!")
+	plaintext := []byte("goodbye!")
+	expected := []byte{0xa0, 0x6f, 0x44, 0x8a, 0x44, 0xf8, 0x18, 0x3b, 0x47, 0x91, 0xb2, 0x13, 'g', 'o', 'o', 'd', 'b', 'y', 'e', '!'}
+
+	sealed := aead.Seal(nil, nil, plaintext, aad)
+	if !bytes.Equal(sealed, expected) {
+		t.Errorf("NullAEAD.Seal : invalid sealed packet %x", sealed)
+	}
+	opened, err := aead.Open(nil, nil, sealed, aad)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("NullAEAD.Open : invalid plaintext %x", opened)
+	}
+
+	// Seal in place
+	buffer := make([]byte, len(plaintext), len(plaintext)+aead.Overhead())
+	copy(buffer, plaintext)
+	if sealed = aead.Seal(buffer[:0], nil, buffer, aad); !bytes.Equal(sealed, expected) {
+		t.Errorf("NullAEAD.Seal : invalid in place sealed packet %x", sealed)
+	}
+
+	// Any modification must be detected
+	for i := range expected {
+		expected[i] ^= 0x10
+		if _, err = aead.Open(nil, nil, expected, aad); !errors.Is(err, ErrAuthenticationFailed) {
+			t.Errorf("NullAEAD.Open : modification of byte %d not detected", i)
+		}
+		expected[i] ^= 0x10
+	}
+	if _, err = aead.Open(nil, nil, expected, []byte("hello world?")); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Error("NullAEAD.Open : modification of aad not detected")
+	}
+	if _, err = aead.Open(nil, nil, expected[:11], aad); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Error("NullAEAD.Open : too short ciphertext not detected")
+	}
+}
@@ -0,0 +1,48 @@
+//go:build fuzz
+
+package crypto
+
+import "bytes"
+import "testing"
+
+// The fuzz target of the certificate chain of the REJ messages, run with:
+//
+//	go test -tags fuzz -run XXX -fuzz FuzzDecompressChain ./crypto
+//
+// The seeds are the chains of the unit tests, and the corpus of testdata/fuzz.
+
+func FuzzDecompressChain(f *testing.F) {
+	cache := make(map[uint64][]byte)
+	for _, cert := range testCertChain {
+		cache[CertHash(cert)] = cert
+	}
+	f.Add(CompressChain(testCertChain, nil))
+	f.Add(CompressChain(testCertChain, []uint64{CertHash(testCertChain[2])}))
+	f.Add(CompressChain(testCertChain, []uint64{CertHash(testCertChain[0]), CertHash(testCertChain[1]), CertHash(testCertChain[2])}))
+	f.Add(CompressChain(testCertChain[:1], nil))
+	f.Add(CompressChain(nil, nil))
+	f.Add([]byte{CERT_ENTRY_CACHED, 1, 2, 3, 4, 5, 6, 7, 8, CERT_ENTRY_END_OF_LIST})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		chain, err := DecompressChain(b, cache)
+		if err != nil {
+			return
+		}
+		// The chain decompressed is compressed and decompressed again
+		size := 0
+		for _, cert := range chain {
+			size += len(cert)
+		}
+		if size > MAX_UNCOMPRESSED_CERT_CHAIN_SIZE {
+			t.Fatalf("DecompressChain : %v bytes of certificates", size)
+		}
+		again, err := DecompressChain(CompressChain(chain, nil), nil)
+		if err != nil || len(again) != len(chain) {
+			t.Fatalf("DecompressChain : %v certificates expected instead of %v (%v)", len(chain), len(again), err)
+		}
+		for i := range chain {
+			if !bytes.Equal(again[i], chain[i]) {
+				t.Fatalf("DecompressChain : certificate %v differs", i)
+			}
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package crypto
+
+import "crypto/aes"
+import "crypto/cipher"
+import "encoding/binary"
+import "fmt"
+
+// Header protection as described in RFC9001 section 5.4 : https://www.rfc-editor.org/rfc/rfc9001#section-5.4
+//
+// A 16 bytes sample of the packet ciphertext is used to compute a 5 bytes mask: the first byte of the mask protects
+// the low bits of the first byte of the header, and the 4 next bytes protect the packet number.
+
+// HEADERPROTECTION_SAMPLESIZE is the size of the ciphertext sample used to compute the header protection mask.
+const HEADERPROTECTION_SAMPLESIZE = 16
+
+// A HeaderProtector computes the header protection mask of a packet from a sample of its ciphertext.
+type HeaderProtector interface {
+	// HeaderProtect returns the 5 bytes mask corresponding to the 16 bytes sample.
+	HeaderProtect(sample []byte) (mask [5]byte, err error)
+	// Close zeroes the header protection key
+	Close() error
+}
+
+// ChaCha20HeaderProtector is the ChaCha20-based header protection (RFC9001 section 5.4.4).
+//
+// The first 4 bytes of the sample are the Little Endian block counter and the 12 remaining bytes are the nonce, the mask is the ChaCha20 encryption of five zero bytes.
+type ChaCha20HeaderProtector struct {
+	key    [32]byte
+	closed bool
+}
+
+var _ HeaderProtector = (*ChaCha20HeaderProtector)(nil)
+
+// NewChaCha20HeaderProtector returns a ChaCha20HeaderProtector keyed with the 256-bit header protection key.
+func NewChaCha20HeaderProtector(key []byte) (*ChaCha20HeaderProtector, error) {
+	if len(key) != CHACHA20_KEYSIZE {
+		return nil, keyLengthError(fmt.Sprintf("NewChaCha20HeaderProtector : key must be %d bytes length, got %d bytes", CHACHA20_KEYSIZE, len(key)))
+	}
+	hp := new(ChaCha20HeaderProtector)
+	copy(hp.key[:], key)
+	return hp, nil
+}
+
+// HeaderProtect returns the 5 bytes mask corresponding to the 16 bytes sample.
+func (this *ChaCha20HeaderProtector) HeaderProtect(sample []byte) (mask [5]byte, err error) {
+	var stream *ChaCha20Cipher
+
+	if this.closed {
+		err = ErrCipherClosed
+		return
+	}
+	if len(sample) != HEADERPROTECTION_SAMPLESIZE {
+		err = fmt.Errorf("ChaCha20HeaderProtector.HeaderProtect : sample must be %d bytes length, got %d bytes", HEADERPROTECTION_SAMPLESIZE, len(sample))
+		return
+	}
+	if stream, err = NewChaCha20Cipher(this.key[:], sample[4:], binary.LittleEndian.Uint32(sample)); err != nil {
+		return
+	}
+	defer stream.Close()
+	_, err = stream.Encrypt(mask[:], mask[:])
+	return
+}
+
+// Close zeroes the header protection key, HeaderProtect returns ErrCipherClosed after Close.
+func (this *ChaCha20HeaderProtector) Close() error {
+	this.key = [32]byte{}
+	this.closed = true
+	return nil
+}
+
+// AesHeaderProtector is the AES-based header protection (RFC9001 section 5.4.3).
+//
+// The mask is the first 5 bytes of the AES-ECB encryption of the sample.
+type AesHeaderProtector struct {
+	block cipher.Block
+}
+
+var _ HeaderProtector = (*AesHeaderProtector)(nil)
+
+// NewAesHeaderProtector returns an AesHeaderProtector keyed with the 128-bit or 256-bit header protection key.
+func NewAesHeaderProtector(key []byte) (*AesHeaderProtector, error) {
+	if len(key) != 16 && len(key) != 32 {
+		return nil, keyLengthError(fmt.Sprintf("NewAesHeaderProtector : key must be 16 or 32 bytes length, got %d bytes", len(key)))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &AesHeaderProtector{block: block}, nil
+}
+
+// HeaderProtect returns the 5 bytes mask corresponding to the 16 bytes sample.
+func (this *AesHeaderProtector) HeaderProtect(sample []byte) (mask [5]byte, err error) {
+	var out [aes.BlockSize]byte
+
+	if this.block == nil {
+		err = ErrCipherClosed
+		return
+	}
+	if len(sample) != HEADERPROTECTION_SAMPLESIZE {
+		err = fmt.Errorf("AesHeaderProtector.HeaderProtect : sample must be %d bytes length, got %d bytes", HEADERPROTECTION_SAMPLESIZE, len(sample))
+		return
+	}
+	this.block.Encrypt(out[:], sample)
+	copy(mask[:], out[:5])
+	return
+}
+
+// Close releases the AES key schedule, HeaderProtect returns ErrCipherClosed after Close.
+//
+// The key schedule is owned by the standard library and can't be zeroed, it is only released to the garbage collector.
+func (this *AesHeaderProtector) Close() error {
+	this.block = nil
+	return nil
+}
+
+// headerMaskBits returns the bits of the first byte of the header protected by the mask: 4 bits for a long header, 5 bits for a short header.
+func headerMaskBits(firstByte byte) byte {
+	if firstByte&0x80 != 0 {
+		return 0x0f
+	}
+	return 0x1f
+}
+
+// ApplyHeaderMask protects the header: the low bits of the first byte and the pnLen bytes of the packet number at pnOffset are XORed with the mask.
+func ApplyHeaderMask(mask [5]byte, header []byte, pnOffset, pnLen int) error {
+	if pnLen < 1 || pnLen > 4 || pnOffset < 1 || len(header) < pnOffset+pnLen {
+		return fmt.Errorf("ApplyHeaderMask : invalid packet number offset %d and length %d for a %d bytes header", pnOffset, pnLen, len(header))
+	}
+	header[0] ^= mask[0] & headerMaskBits(header[0])
+	for i := 0; i < pnLen; i++ {
+		header[pnOffset+i] ^= mask[i+1]
+	}
+	return nil
+}
+
+// RemoveHeaderMask unprotects the header and returns the length of the packet number at pnOffset,
+// that is only known once the two low bits of the first byte are unmasked.
+func RemoveHeaderMask(mask [5]byte, header []byte, pnOffset int) (pnLen int, err error) {
+	if pnOffset < 1 || len(header) < pnOffset {
+		err = fmt.Errorf("RemoveHeaderMask : invalid packet number offset %d for a %d bytes header", pnOffset, len(header))
+		return
+	}
+	first := header[0] ^ (mask[0] & headerMaskBits(header[0]))
+	pnLen = int(first&0x03) + 1
+	if len(header) < pnOffset+pnLen {
+		err = fmt.Errorf("RemoveHeaderMask : %d bytes header too short for a %d bytes packet number at offset %d", len(header), pnLen, pnOffset)
+		return
+	}
+	header[0] = first
+	for i := 0; i < pnLen; i++ {
+		header[pnOffset+i] ^= mask[i+1]
+	}
+	return
+}
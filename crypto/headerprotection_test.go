@@ -0,0 +1,107 @@
+package crypto
+
+import "testing"
+import "bytes"
+
+// Test Vectors taken from RFC9001 appendix A : https://www.rfc-editor.org/rfc/rfc9001#appendix-A
+
+var tests_headerprotection = []struct {
+	chacha20  bool
+	hp        string
+	sample    string
+	mask      string
+	header    string
+	protected string
+	pnOffset  int
+	pnLen     int
+}{
+	{
+		// A.2 : Client Initial
+		false,
+		"9f50449e04a0e810283a1e9933adedd2",
+		"d1b1c98dd7689fb8ec11d242b123dc9b",
+		"437b9aec36",
+		"c300000001088394c8f03e5157080000449e00000002",
+		"c000000001088394c8f03e5157080000449e7b9aec34",
+		18, 4},
+	{
+		// A.3 : Server Initial
+		false,
+		"c206b8d9b9f0f37644430b490eeaa314",
+		"2cd0991cd25b0aac406a5816b6394100",
+		"2ec0d8356a",
+		"c1000000010008f067a5502a4262b50040750001",
+		"cf000000010008f067a5502a4262b5004075c0d9",
+		18, 2},
+	{
+		// A.5 : ChaCha20-Poly1305 Short Header Packet
+		true,
+		"25a282b9e82f06f21f488917a4fc8f1b73573685608597d0efcb076b0ab7a7a4",
+		"5e5cd55c41f69080575d7999c25a5bfb",
+		"aefefe7d03",
+		"4200bff4",
+		"4cfe4189",
+		1, 3},
+}
+
+func newTestHeaderProtector(chacha20 bool, key []byte) (HeaderProtector, error) {
+	if chacha20 {
+		return NewChaCha20HeaderProtector(key)
+	}
+	return NewAesHeaderProtector(key)
+}
+
+func Test_HeaderProtect(t *testing.T) {
+	for i, v := range tests_headerprotection {
+		hp, err := newTestHeaderProtector(v.chacha20, toByte(v.hp))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mask, err := hp.HeaderProtect(toByte(v.sample))
+		if err != nil {
+			t.Fatalf("HeaderProtector.HeaderProtect : test vector %d : %v", i, err)
+		}
+		if !bytes.Equal(mask[:], toByte(v.mask)) {
+			t.Errorf("HeaderProtector.HeaderProtect : invalid mask %x for test vector %d", mask, i)
+		}
+		if _, err = hp.HeaderProtect(toByte(v.sample)[:15]); err == nil {
+			t.Errorf("HeaderProtector.HeaderProtect : short sample must be rejected for test vector %d", i)
+		}
+
+		hp.Close()
+		if _, err = hp.HeaderProtect(toByte(v.sample)); err != ErrCipherClosed {
+			t.Errorf("HeaderProtector.HeaderProtect : ErrCipherClosed expected after Close instead of %v", err)
+		}
+	}
+}
+
+func Test_ApplyHeaderMask(t *testing.T) {
+	var mask [5]byte
+
+	for i, v := range tests_headerprotection {
+		copy(mask[:], toByte(v.mask))
+
+		header := toByte(v.header)
+		if err := ApplyHeaderMask(mask, header, v.pnOffset, v.pnLen); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(header, toByte(v.protected)) {
+			t.Errorf("ApplyHeaderMask : invalid protected header %x for test vector %d", header, i)
+		}
+
+		pnLen, err := RemoveHeaderMask(mask, header, v.pnOffset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pnLen != v.pnLen || !bytes.Equal(header, toByte(v.header)) {
+			t.Errorf("RemoveHeaderMask : invalid unprotected header %x or packet number length %d for test vector %d", header, pnLen, i)
+		}
+
+		if err = ApplyHeaderMask(mask, header, v.pnOffset, 5); err == nil {
+			t.Errorf("ApplyHeaderMask : packet number length 5 must be rejected for test vector %d", i)
+		}
+		if _, err = RemoveHeaderMask(mask, toByte(v.protected)[:v.pnOffset+v.pnLen-1], v.pnOffset); err == nil {
+			t.Errorf("RemoveHeaderMask : truncated header must be rejected for test vector %d", i)
+		}
+	}
+}
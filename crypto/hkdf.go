@@ -2,6 +2,7 @@ package crypto
 
 import "crypto/hmac"
 import "crypto/sha256"
+import "errors"
 
 // HKDF contains the resulting AEAD Key and Initialization Vector for QUIC Client and QUIC Server
 type HKDF struct {
@@ -15,15 +16,10 @@ type HKDF struct {
 //
 // An error is return and a pointer to an HKDF structure that contains the resulting Output Keying Material.
 func NewHKDF(salt, ikm, info []byte, keysize, noncesize int) (error, *HKDF) {
-	var t []byte
-	var okm []byte
-	var counter byte
-	var i int
-
-	counter = 1
 	need := 2*keysize + 2*noncesize
-	n := need / 32
-	m := need % 32
+	if need > 255*32 {
+		return errors.New("NewHKDF : can't expand more than 255 * 32 bytes of Output Keying Material"), nil
+	}
 
 	if salt == nil {
 		salt = make([]byte, 32) // SHA-256 requires 32-bytes Key
@@ -33,33 +29,81 @@ func NewHKDF(salt, ikm, info []byte, keysize, noncesize int) (error, *HKDF) {
 	extract.Write(ikm)
 	prk := extract.Sum(nil)
 
-	// We need 32 + 32 + 32 + 32 bytes of Output Keying Material
-	expand := hmac.New(sha256.New, prk)
+	// We need 2*keysize + 2*noncesize bytes of Output Keying Material
+	okm := hkdfExpand(prk, info, need)
 
-	// Fill the okm buffer
-	for i = 0; i < n; i++ {
-		expand.Reset()
-		expand.Write(t)
-		expand.Write(info)
-		expand.Write([]byte{counter})
-		t = expand.Sum(nil)
-		counter++
-		copy(okm[i*32:], t)
+	return nil, &HKDF{
+		clientWriteKey:   okm[0:keysize],
+		serverWriteKey:   okm[keysize : 2*keysize],
+		clientWriteNonce: okm[2*keysize : 2*keysize+noncesize],
+		serverWriteNonce: okm[2*keysize+noncesize : 2*keysize+2*noncesize]}
+}
+
+// Labels of the HKDF info used by DeriveKeys for the initial keys and for the forward-secure keys.
+const (
+	LABEL_INITIAL_KEYS        = "QUIC key expansion"
+	LABEL_FORWARD_SECURE_KEYS = "QUIC forward secure key expansion"
+)
+
+// KeyPair is the write key and IV of one direction of the connection.
+type KeyPair struct {
+	Key []byte
+	IV  []byte
+}
+
+// DerivedKeys is the result of DeriveKeys: the key and IV written by the client, and the key and IV written by the server.
+type DerivedKeys struct {
+	Client KeyPair
+	Server KeyPair
+}
+
+// DeriveKeys returns the client and server keys and IVs derived from the premaster secret as specified by the QUIC crypto protocol:
+//
+//	salt = clientNonce + serverNonce
+//	info = label + 0x00 + connID + handshake messages (CHLO, SCFG and the certificate when available)
+//
+// The same function is used for the initial keys (LABEL_INITIAL_KEYS) and the forward-secure keys (LABEL_FORWARD_SECURE_KEYS).
+// connID is the 8 bytes connection ID in Little Endian, and serverNonce can be nil when the server didn't send one.
+func DeriveKeys(premaster, clientNonce, serverNonce, connID []byte, label string, keyLen, ivLen int, handshake ...[]byte) (*DerivedKeys, error) {
+	salt := make([]byte, 0, len(clientNonce)+len(serverNonce))
+	salt = append(salt, clientNonce...)
+	salt = append(salt, serverNonce...)
+
+	info := make([]byte, 0, 64)
+	info = append(info, label...)
+	info = append(info, 0)
+	info = append(info, connID...)
+	for _, m := range handshake {
+		info = append(info, m...)
 	}
-	if m > 0 {
+
+	err, hkdf := NewHKDF(salt, premaster, info, keyLen, ivLen)
+	if err != nil {
+		return nil, err
+	}
+	return &DerivedKeys{
+		Client: KeyPair{Key: hkdf.clientWriteKey, IV: hkdf.clientWriteNonce},
+		Server: KeyPair{Key: hkdf.serverWriteKey, IV: hkdf.serverWriteNonce}}, nil
+}
+
+// hkdfExpand returns length bytes of Output Keying Material expanded from the pseudorandom key prk (RFC5869 section 2.3).
+func hkdfExpand(prk, info []byte, length int) []byte {
+	var t []byte
+	var counter byte
+
+	okm := make([]byte, 0, length+32)
+	expand := hmac.New(sha256.New, prk)
+
+	// Fill the okm buffer: T(n) = HMAC-Hash(PRK, T(n-1) | info | n)
+	for counter = 1; len(okm) < length; counter++ {
 		expand.Reset()
 		expand.Write(t)
 		expand.Write(info)
 		expand.Write([]byte{counter})
 		t = expand.Sum(nil)
-		copy(okm[i*32:], t[0:m])
+		okm = append(okm, t...)
 	}
-
-	return nil, &HKDF{
-		clientWriteKey:   okm[0:keysize],
-		clientWriteNonce: okm[keysize : 2*keysize],
-		serverWriteKey:   okm[2*keysize : 2*keysize+noncesize],
-		serverWriteNonce: okm[2*keysize+noncesize : 2*keysize+2*noncesize]}
+	return okm[:length]
 }
 
 // GetClientWriteKey returns the Key used by the QUIC Client for AEAD when sending packet.
@@ -0,0 +1,89 @@
+package crypto
+
+import "testing"
+import "bytes"
+
+func Test_NewHKDF(t *testing.T) {
+	// RFC5869 Test Case 1 : L = 42 = 2*16 + 2*5
+	ikm := toByte("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	salt := toByte("000102030405060708090a0b0c")
+	info := toByte("f0f1f2f3f4f5f6f7f8f9")
+	okm := toByte("3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865")
+
+	err, h := NewHKDF(salt, ikm, info, 16, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(h.GetClientWriteKey(), okm[0:16]) {
+		t.Errorf("NewHKDF : invalid client write key %x", h.GetClientWriteKey())
+	}
+	if !bytes.Equal(h.GetServerWriteKey(), okm[16:32]) {
+		t.Errorf("NewHKDF : invalid server write key %x", h.GetServerWriteKey())
+	}
+	if !bytes.Equal(h.GetClientWriteNonce(), okm[32:37]) {
+		t.Errorf("NewHKDF : invalid client write nonce %x", h.GetClientWriteNonce())
+	}
+	if !bytes.Equal(h.GetServerWriteNonce(), okm[37:42]) {
+		t.Errorf("NewHKDF : invalid server write nonce %x", h.GetServerWriteNonce())
+	}
+}
+
+// The Output Keying Material of CryptoUtils::DeriveKeys of Chromium can't be captured here: these vectors are computed by the
+// HKDF of OpenSSL 3 ("openssl kdf ... HKDF"), with the salt and the info of the QUIC crypto protocol built by hand:
+//
+//	okm = client key (16) + server key (16) + client IV (4) + server IV (4)
+var tests_derivekeys = []struct {
+	label       string
+	serverNonce string
+	okm         string
+}{
+	{LABEL_INITIAL_KEYS, "0f0e0d0c0b0a0908", "30c0db4f68e7ccd7ba98ad646a8cf3ff1f3cf46674d5ea5e8e6212ac28173235fa860c93c9fee9b6"},
+	{LABEL_INITIAL_KEYS, "", "128ca55917dbe06180793930773abb098fb1561f6a0a7ff413fbcb7160552099682491af2d609b17"},
+	{LABEL_FORWARD_SECURE_KEYS, "0f0e0d0c0b0a0908", "2f15e52be11100da8db14686012f32daa9b393ab30562b687c385069b6b8158fa9e88f8b6d3896f9"},
+	{LABEL_FORWARD_SECURE_KEYS, "", "7899d6c323b3f639d638bd512f7cf61e2c0147ae39eca2071cd6e9036ae9b5667df315dc08282d02"},
+}
+
+func Test_DeriveKeys(t *testing.T) {
+	premaster := toByte("b0c1d2e3f405162738495a6b7c8d9eaf00112233445566778899aabbccddeeff")
+	clientNonce := toByte("5ad7f2c0000000000102030405060708090a0b0c0d0e0f101112131415161718")
+	connID := toByte("efcdab8967452301")
+
+	for i, v := range tests_derivekeys {
+		keys, err := DeriveKeys(premaster, clientNonce, toByte(v.serverNonce), connID, v.label, 16, 4, []byte("CHLO"), []byte("SCFG"))
+		if err != nil {
+			t.Fatalf("DeriveKeys : unexpected error %v in test n°%v", err, i)
+		}
+		okm := toByte(v.okm)
+		if !bytes.Equal(keys.Client.Key, okm[0:16]) || !bytes.Equal(keys.Server.Key, okm[16:32]) ||
+			!bytes.Equal(keys.Client.IV, okm[32:36]) || !bytes.Equal(keys.Server.IV, okm[36:40]) {
+			t.Errorf("DeriveKeys : invalid keys for label %q in test n°%v", v.label, i)
+		}
+	}
+
+	// Handshake messages are part of the info
+	keys, _ := DeriveKeys(premaster, clientNonce, toByte(tests_derivekeys[0].serverNonce), connID, LABEL_INITIAL_KEYS, 16, 4, []byte("CHLO"))
+	if bytes.Equal(keys.Client.Key, toByte(tests_derivekeys[0].okm)[0:16]) {
+		t.Error("DeriveKeys : handshake messages are not used")
+	}
+
+	// The initial keys of the server diversified with the nonce 000102...1f, by the HKDF of OpenSSL 3 too
+	diversified, err := DeriveKeys(premaster, clientNonce, toByte(tests_derivekeys[0].serverNonce), connID, LABEL_INITIAL_KEYS, 16, 4, []byte("CHLO"), []byte("SCFG"))
+	if err != nil {
+		t.Fatalf("DeriveKeys : unexpected error %v", err)
+	}
+	nonce := make([]byte, 32)
+	for i := range nonce {
+		nonce[i] = byte(i)
+	}
+	if err = diversified.DiversifyServerKeys(nonce); err != nil {
+		t.Fatalf("DerivedKeys.DiversifyServerKeys : unexpected error %v", err)
+	}
+	okm := toByte(tests_derivekeys[0].okm)
+	if !bytes.Equal(diversified.Client.Key, okm[0:16]) || !bytes.Equal(diversified.Client.IV, okm[32:36]) {
+		t.Error("DerivedKeys.DiversifyServerKeys : the client keys must not be diversified")
+	}
+	okm = toByte("2e187b912323a356ea67f887d0a14db3607da063")
+	if !bytes.Equal(diversified.Server.Key, okm[0:16]) || !bytes.Equal(diversified.Server.IV, okm[16:20]) {
+		t.Errorf("DerivedKeys.DiversifyServerKeys : invalid server keys %x %x", diversified.Server.Key, diversified.Server.IV)
+	}
+}
@@ -1,6 +1,7 @@
 package crypto
 
 import "github.com/romain-jacotin/quic/protocol"
+import "errors"
 
 // A KeyExchange is a generic way to exchange a shared key between two hosts that own private/public key pairs.
 //
@@ -9,10 +10,12 @@ import "github.com/romain-jacotin/quic/protocol"
 //     Elliptic Curve Diffie-Hellman Curve25519: TagKEXS with value TagC255
 //     Elliptic Curve Diffie-Hellman P-256:      TagKEXS with value TagP256
 type KeyExchange interface {
-	// GetPublicKey generates local private/public keys pair and returns the local public key that should be sent to the remote host.
-	GetPublicKey() []byte
-	// ComputeSharedKey computes and returns the shared key based on the local private key and the remote public key described in input.
-	ComputeSharedKey([]byte) (error, []byte)
+	// PublicKey returns the local public key that should be sent to the remote host.
+	PublicKey() []byte
+	// ComputeSharedSecret computes and returns the shared secret based on the local private key and the remote public key described in input.
+	ComputeSharedSecret(peer []byte) ([]byte, error)
+	// PrivateKey returns the local private key, so that a long-term key pair can be stored and restored with NewKeyExchangeFromPrivateKey.
+	PrivateKey() []byte
 }
 
 // NewKeyExchange is a KeyExchange factory that returns the KeyExchange algorithm corresponding to the MessageTag given in input.
@@ -28,3 +31,15 @@ func NewKeyExchange(kexs protocol.MessageTag) (error, KeyExchange) {
 	}
 	return nil, nil
 }
+
+// NewKeyExchangeFromPrivateKey returns the KeyExchange algorithm corresponding to the MessageTag with the private key given in input,
+// and computes its public key.
+func NewKeyExchangeFromPrivateKey(kexs protocol.MessageTag, privateKey []byte) (error, KeyExchange) {
+	switch kexs {
+	case protocol.TagC255: // Elliptic Curve Diffie-Hellman Curve25519
+		return NewECDH_Curve25519FromPrivateKey(privateKey)
+	case protocol.TagP256: // Elliptic Curve Diffie-Hellman P-256
+		return NewECDH_P256FromPrivateKey(privateKey)
+	}
+	return errors.New("NewKeyExchangeFromPrivateKey : unsupported key exchange algorithm"), nil
+}
@@ -0,0 +1,35 @@
+package crypto
+
+import "github.com/romain-jacotin/quic/protocol"
+import "bytes"
+import "testing"
+
+func Test_KeyExchange_PrivateKey(t *testing.T) {
+	for i, kexs := range []protocol.MessageTag{protocol.TagC255, protocol.TagP256} {
+		err, kex := NewKeyExchange(kexs)
+		if err != nil {
+			t.Fatalf("NewKeyExchange : unexpected error %v in test n°%v", err, i)
+		}
+		_, peer := NewKeyExchange(kexs)
+
+		// The restored key pair has the same public key and computes the same shared secret
+		err, restored := NewKeyExchangeFromPrivateKey(kexs, kex.PrivateKey())
+		if err != nil {
+			t.Fatalf("NewKeyExchangeFromPrivateKey : unexpected error %v in test n°%v", err, i)
+		}
+		if !bytes.Equal(restored.PublicKey(), kex.PublicKey()) {
+			t.Errorf("NewKeyExchangeFromPrivateKey : public key %x expected instead of %x in test n°%v", kex.PublicKey(), restored.PublicKey(), i)
+		}
+		expected, _ := kex.ComputeSharedSecret(peer.PublicKey())
+		if secret, err := restored.ComputeSharedSecret(peer.PublicKey()); err != nil || !bytes.Equal(secret, expected) {
+			t.Errorf("KeyExchange.ComputeSharedSecret : shared secret %x expected instead of %x (%v) in test n°%v", expected, secret, err, i)
+		}
+
+		if err, _ = NewKeyExchangeFromPrivateKey(kexs, make([]byte, 31)); err == nil {
+			t.Errorf("NewKeyExchangeFromPrivateKey : error expected for a short private key in test n°%v", i)
+		}
+	}
+	if err, _ := NewKeyExchangeFromPrivateKey(protocol.TagAESG, make([]byte, 32)); err == nil {
+		t.Errorf("NewKeyExchangeFromPrivateKey : error expected for an unsupported algorithm")
+	}
+}
@@ -2,41 +2,89 @@ package crypto
 
 import "crypto/elliptic"
 import "crypto/rand"
-import "math/big"
+import "io"
 import "errors"
+import "math/big"
+
+// ErrInvalidP256PublicKey is returned when the peer public key is not an uncompressed X9.62 point of the P-256 curve.
+var ErrInvalidP256PublicKey = errors.New("ECDH : invalid P-256 public key")
 
-type p256 struct {
+// P256PUBLICKEYSIZE is the size of a P-256 public key in the uncompressed X9.62 form : 0x04 || X || Y
+const P256PUBLICKEYSIZE = 65
+
+// P256KeyExchange is the Elliptic Curve Diffie-Hellman P-256 KeyExchange algorithm.
+//
+// Public keys are encoded in the uncompressed X9.62 form used by the QUIC Crypto protocol, and the shared secret is the 32 bytes X coordinate of the shared point.
+type P256KeyExchange struct {
 	curve      elliptic.Curve
-	publicX    *big.Int
-	publicY    *big.Int
+	publicKey  []byte
 	privateKey []byte
 }
 
+var _ KeyExchange = (*P256KeyExchange)(nil)
+
+// NewP256KeyExchange returns a P256KeyExchange with a private/public key pair generated from the random source.
+func NewP256KeyExchange(rand io.Reader) (*P256KeyExchange, error) {
+	curve := elliptic.P256()
+	priv, x, y, err := elliptic.GenerateKey(curve, rand)
+	if err != nil {
+		return nil, err
+	}
+	return &P256KeyExchange{
+		curve:      curve,
+		publicKey:  elliptic.Marshal(curve, x, y),
+		privateKey: priv}, nil
+}
+
 // NewECDH_P256 returns an Elliptic Curve Diffie-Hellman P-256 KeyExchange algorithm.
 func NewECDH_P256() (error, KeyExchange) {
-	curve := elliptic.P256()
-	priv, x, y, err := elliptic.GenerateKey(curve, rand.Reader)
+	kx, err := NewP256KeyExchange(rand.Reader)
 	if err != nil {
 		return err, nil
 	}
-	return nil, &p256{
+	return nil, kx
+}
+
+// NewECDH_P256FromPrivateKey returns an Elliptic Curve Diffie-Hellman P-256 KeyExchange algorithm with the 32 bytes private key.
+func NewECDH_P256FromPrivateKey(privateKey []byte) (error, KeyExchange) {
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(privateKey)
+	if len(privateKey) != 32 || d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return errors.New("ECDH : invalid P-256 private key"), nil
+	}
+	x, y := curve.ScalarBaseMult(privateKey)
+	return nil, &P256KeyExchange{
 		curve:      curve,
-		publicX:    x,
-		publicY:    y,
-		privateKey: priv}
+		publicKey:  elliptic.Marshal(curve, x, y),
+		privateKey: append([]byte(nil), privateKey...)}
+}
+
+// PublicKey returns the local public key in uncompressed X9.62 form that should be sent to the remote host.
+func (this *P256KeyExchange) PublicKey() []byte {
+	return this.publicKey
 }
 
-// GetPublicKey generates local private/public keys pair and returns the local public key that should be sent to the remote host.
-func (this *p256) GetPublicKey() []byte {
-	return elliptic.Marshal(this.curve, this.publicX, this.publicY)
+// PrivateKey returns the local private key.
+func (this *P256KeyExchange) PrivateKey() []byte {
+	return this.privateKey
 }
 
-// ComputeSharedKey computes and returns the shared key based on the local private key and the remote public key.
-func (this *p256) ComputeSharedKey(remotePublicKey []byte) (error, []byte) {
+// ComputeSharedSecret computes and returns the shared secret based on the local private key and the remote public key.
+//
+// ErrInvalidP256PublicKey is returned if the remote public key is not an uncompressed X9.62 point on the curve.
+func (this *P256KeyExchange) ComputeSharedSecret(remotePublicKey []byte) ([]byte, error) {
+	if len(remotePublicKey) != P256PUBLICKEYSIZE || remotePublicKey[0] != 4 {
+		return nil, ErrInvalidP256PublicKey
+	}
+	// Unmarshal rejects the points that are not on the curve
 	remotePublicX, remotePublicY := elliptic.Unmarshal(this.curve, remotePublicKey)
-	if !this.curve.IsOnCurve(remotePublicX, remotePublicY) {
-		return errors.New("ECDH : invalid P-256 KeyExchange"), nil
+	if remotePublicX == nil {
+		return nil, ErrInvalidP256PublicKey
 	}
 	x, _ := this.curve.ScalarMult(remotePublicX, remotePublicY, this.privateKey)
-	return nil, x.Bytes()
+	if x.Sign() == 0 {
+		return nil, ErrInvalidP256PublicKey
+	}
+	// The X coordinate must keep its leading zeros
+	return x.FillBytes(make([]byte, 32)), nil
 }
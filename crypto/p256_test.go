@@ -2,6 +2,8 @@ package crypto
 
 import "testing"
 import "bytes"
+import "crypto/ecdh"
+import "crypto/rand"
 
 func TestECDH_P256(test *testing.T) {
 	errClient, keyExchangeClient := NewECDH_P256()
@@ -16,16 +18,16 @@ func TestECDH_P256(test *testing.T) {
 		return
 	}
 
-	pubKeyClient := keyExchangeClient.GetPublicKey()
-	pubKeyServer := keyExchangeServer.GetPublicKey()
+	pubKeyClient := keyExchangeClient.PublicKey()
+	pubKeyServer := keyExchangeServer.PublicKey()
 
-	errClient, sharedKeyClient := keyExchangeClient.ComputeSharedKey(pubKeyServer)
+	sharedKeyClient, errClient := keyExchangeClient.ComputeSharedSecret(pubKeyServer)
 	if errClient != nil {
 		test.Error("ECDH_P256: can't compute shared key at client side")
 		return
 	}
 
-	errServer, sharedKeyServer := keyExchangeServer.ComputeSharedKey(pubKeyClient)
+	sharedKeyServer, errServer := keyExchangeServer.ComputeSharedSecret(pubKeyClient)
 	if errServer != nil {
 		test.Error("ECDH_P256: can't compute shared key at server side")
 		return
@@ -36,3 +38,69 @@ func TestECDH_P256(test *testing.T) {
 		return
 	}
 }
+
+func Test_P256KeyExchange_InvalidPublicKey(t *testing.T) {
+	kx, err := NewP256KeyExchange(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := kx.PublicKey()
+	if len(valid) != P256PUBLICKEYSIZE || valid[0] != 4 {
+		t.Fatalf("P256KeyExchange.PublicKey : invalid uncompressed X9.62 public key %x", valid)
+	}
+
+	notOnCurve := append([]byte{}, valid...)
+	notOnCurve[P256PUBLICKEYSIZE-1] ^= 1
+	compressed := append([]byte{2 + valid[P256PUBLICKEYSIZE-1]&1}, valid[1:33]...)
+	wrongPrefix := append([]byte{}, valid...)
+	wrongPrefix[0] = 6
+
+	tests_p256invalid := []struct {
+		name string
+		key  []byte
+	}{
+		{"empty", []byte{}},
+		{"point at infinity", []byte{0}},
+		{"all zeros", make([]byte, P256PUBLICKEYSIZE)},
+		{"truncated", valid[:P256PUBLICKEYSIZE-1]},
+		{"too long", append(append([]byte{}, valid...), 0)},
+		{"compressed", compressed},
+		{"wrong prefix", wrongPrefix},
+		{"point not on curve", notOnCurve},
+	}
+	for _, v := range tests_p256invalid {
+		if secret, err := kx.ComputeSharedSecret(v.key); err != ErrInvalidP256PublicKey || secret != nil {
+			t.Errorf("P256KeyExchange.ComputeSharedSecret : ErrInvalidP256PublicKey expected for %s public key instead of %v", v.name, err)
+		}
+	}
+}
+
+func Test_P256KeyExchange_Interop(t *testing.T) {
+	// Enough iterations to get shared secrets with leading zero bytes
+	for i := 0; i < 512; i++ {
+		kx, err := NewP256KeyExchange(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peer, err := ecdh.P256().GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		secret, err := kx.ComputeSharedSecret(peer.PublicKey().Bytes())
+		if err != nil {
+			t.Fatalf("P256KeyExchange.ComputeSharedSecret : %v", err)
+		}
+		kxPublicKey, err := ecdh.P256().NewPublicKey(kx.PublicKey())
+		if err != nil {
+			t.Fatalf("P256KeyExchange.PublicKey : public key rejected by crypto/ecdh : %v", err)
+		}
+		expected, err := peer.ECDH(kxPublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(secret, expected) {
+			t.Fatalf("P256KeyExchange.ComputeSharedSecret : shared secret %x differs from crypto/ecdh %x", secret, expected)
+		}
+	}
+}
@@ -471,3 +471,56 @@ func Test_ComputeAeadMAC(t *testing.T) {
 		t.Error("ComputeAeadMAC : invalid MAC")
 	}
 }
+
+func Test_Poly1305_Update(t *testing.T) {
+	var p *Poly1305
+	var err error
+
+	// RFC7539 section 2.5.2
+	key := []byte{0x85, 0xd6, 0xbe, 0x78, 0x57, 0x55, 0x6d, 0x33, 0x7f, 0x44, 0x52, 0xfe, 0x42, 0xd5, 0x06, 0xa8,
+		0x01, 0x03, 0x80, 0x8a, 0xfb, 0x0d, 0xb2, 0xfd, 0x4a, 0xbf, 0xf6, 0xaf, 0x41, 0x49, 0xf5, 0x1b}
+	// Message = "Cryptographic Forum Research Group"
+	m := []byte("Cryptographic Forum Research Group")
+	tag := [16]byte{0xa8, 0x06, 0x1d, 0xc1, 0x30, 0x51, 0x36, 0xc6, 0xc2, 0x2b, 0x8b, 0xaf, 0x0c, 0x01, 0x27, 0xa9}
+
+	if p, err = NewPoly1305(key); err != nil {
+		t.Fatal(err)
+	}
+
+	// Feed the message in chunks of every size, none of them being a multiple of 16 bytes for most of the sizes
+	for size := 1; size <= len(m); size++ {
+		for i := 0; i < len(m); i += size {
+			end := i + size
+			if end > len(m) {
+				end = len(m)
+			}
+			p.Update(m[i:end])
+		}
+		if p.Finish() != tag {
+			t.Errorf("Poly1305.Update : invalid tag with chunks of %d bytes", size)
+		}
+	}
+
+	// Finish must reset the accumulator
+	p.Update(m)
+	p.Finish()
+	p.Update(m)
+	if p.Finish() != tag {
+		t.Error("Poly1305.Finish : accumulator is not reset")
+	}
+
+	// Reset must discard the data given to Update
+	p.Update([]byte("garbage"))
+	p.Reset()
+	p.Update(m)
+	if p.Finish() != tag {
+		t.Error("Poly1305.Reset : accumulator is not reset")
+	}
+
+	// Empty message: the tag is equal to 's'
+	p.Update(nil)
+	tag = p.Finish()
+	if !bytes.Equal(tag[:], key[16:]) {
+		t.Error("Poly1305.Finish : invalid tag for empty message")
+	}
+}
@@ -0,0 +1,108 @@
+package crypto
+
+import "crypto/cipher"
+import "encoding/binary"
+
+// HChaCha20 and XChaCha20-Poly1305 as described in draft-irtf-cfrg-xchacha : https://tools.ietf.org/html/draft-irtf-cfrg-xchacha-03
+//
+// XChaCha20-Poly1305 uses a 192-bit nonce that is long enough to be generated randomly without collision risk,
+// it is meant for address-validation tokens and session tickets, not for packet protection.
+
+// XChaCha20Poly1305AEAD is the AEAD_XChaCha20_Poly1305 construction, it implements the crypto/cipher.AEAD interface.
+type XChaCha20Poly1305AEAD struct {
+	key    [32]byte
+	closed bool
+}
+
+var _ cipher.AEAD = (*XChaCha20Poly1305AEAD)(nil)
+
+const xchacha20Poly1305NonceSize = 24
+
+// HChaCha20 derives a 256-bit subkey from the 256-bit key and the first 16 bytes of the nonce.
+//
+// The ChaCha20 grid is initialized with the 16 bytes nonce in place of the block counter and the 96-bit nonce,
+// and the subkey is made of the words 0 to 3 and 12 to 15 of the grid after 20 rounds, without the final addition of the original grid.
+func HChaCha20(key, nonce16 []byte) (subkey [32]byte) {
+	var out [64]byte
+
+	if len(key) < 32 || len(nonce16) < 16 {
+		panic("HChaCha20 : key must be 32 bytes length and nonce must be 16 bytes length")
+	}
+	c, _ := NewChaCha20Cipher(key[:32], nonce16[4:16], binary.LittleEndian.Uint32(nonce16))
+	state := c.GridSnapshot()
+
+	// ChaCha20Block adds the original grid to the grid after 20 rounds, so remove it
+	ChaCha20Block(&state, &out)
+	for i, j := range []int{0, 1, 2, 3, 12, 13, 14, 15} {
+		binary.LittleEndian.PutUint32(subkey[i<<2:], binary.LittleEndian.Uint32(out[j<<2:])-state[j])
+	}
+	return
+}
+
+// NewXChaCha20Poly1305AEAD returns a XChaCha20Poly1305AEAD keyed with the 256-bit key.
+func NewXChaCha20Poly1305AEAD(key []byte) (*XChaCha20Poly1305AEAD, error) {
+	if len(key) < 32 {
+		return nil, keyLengthError("NewXChaCha20Poly1305AEAD : key must be 256-bit")
+	}
+	aead := new(XChaCha20Poly1305AEAD)
+	copy(aead.key[:], key)
+	return aead, nil
+}
+
+// NonceSize returns the size of the nonce that must be passed to Seal and Open.
+func (this *XChaCha20Poly1305AEAD) NonceSize() int {
+	return xchacha20Poly1305NonceSize
+}
+
+// Overhead returns the maximum difference between the lengths of a plaintext and its ciphertext.
+func (this *XChaCha20Poly1305AEAD) Overhead() int {
+	return chacha20Poly1305TagSize
+}
+
+// Close zeroes the key. Open returns ErrCipherClosed and Seal panics after Close.
+func (this *XChaCha20Poly1305AEAD) Close() error {
+	this.key = [32]byte{}
+	this.closed = true
+	return nil
+}
+
+// Seal encrypts and authenticates plaintext with the 192-bit nonce, authenticates aad, and appends the result followed by the 128-bit tag to dst.
+//
+// Seal panics if the nonce is not 24 bytes long.
+func (this *XChaCha20Poly1305AEAD) Seal(dst, nonce, plaintext, aad []byte) []byte {
+	if len(nonce) != xchacha20Poly1305NonceSize {
+		panic("XChaCha20Poly1305AEAD.Seal : nonce must be 192-bit")
+	}
+	if this.closed {
+		panic(ErrCipherClosed)
+	}
+	aead, chachaNonce := this.setup(nonce)
+	defer aead.Close()
+	return aead.Seal(dst, chachaNonce[:], plaintext, aad)
+}
+
+// Open verifies the tag and the aad, then decrypts ciphertext with the 192-bit nonce and appends the result to dst.
+//
+// No plaintext is released if the authentication fails, ErrAuthenticationFailed is returned instead. Open panics if the nonce is not 24 bytes long.
+func (this *XChaCha20Poly1305AEAD) Open(dst, nonce, ciphertext, aad []byte) ([]byte, error) {
+	if len(nonce) != xchacha20Poly1305NonceSize {
+		panic("XChaCha20Poly1305AEAD.Open : nonce must be 192-bit")
+	}
+	if this.closed {
+		return nil, ErrCipherClosed
+	}
+	aead, chachaNonce := this.setup(nonce)
+	defer aead.Close()
+	return aead.Open(dst, chachaNonce[:], ciphertext, aad)
+}
+
+// setup returns the ChaCha20Poly1305AEAD keyed with the HChaCha20 subkey of the nonce, and the 96-bit nonce made of 4 zero bytes and the last 8 bytes of the nonce.
+func (this *XChaCha20Poly1305AEAD) setup(nonce []byte) (*ChaCha20Poly1305AEAD, [12]byte) {
+	var chachaNonce [12]byte
+
+	subkey := HChaCha20(this.key[:], nonce[:16])
+	aead, _ := NewChaCha20Poly1305AEAD(subkey[:])
+	subkey = [32]byte{}
+	copy(chachaNonce[4:], nonce[16:])
+	return aead, chachaNonce
+}
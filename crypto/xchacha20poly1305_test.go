@@ -0,0 +1,58 @@
+package crypto
+
+import "testing"
+import "bytes"
+import "errors"
+
+// Test Vectors taken from draft-irtf-cfrg-xchacha-03 : https://tools.ietf.org/html/draft-irtf-cfrg-xchacha-03
+
+func Test_HChaCha20(t *testing.T) {
+	forEachChaCha20Block(t, func() { testHChaCha20(t) })
+}
+
+func testHChaCha20(t *testing.T) {
+	// Section 2.2.1 : Test Vector for the HChaCha20 Block Function
+	key := toByte("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	nonce := toByte("000000090000004a0000000031415927")
+	subkey := HChaCha20(key, nonce)
+	if !bytes.Equal(subkey[:], toByte("82413b4227b27bfed30e42508a877d73a0f9e4d58a74a853c12ec41326d3ecdc")) {
+		t.Errorf("HChaCha20 : invalid subkey %x", subkey)
+	}
+}
+
+func Test_XChaCha20Poly1305AEAD(t *testing.T) {
+	forEachChaCha20Block(t, func() { testXChaCha20Poly1305AEAD(t) })
+}
+
+func testXChaCha20Poly1305AEAD(t *testing.T) {
+	// Appendix A.3.1 : AEAD_XChaCha20_Poly1305
+	key := toByte("808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f")
+	nonce := toByte("404142434445464748494a4b4c4d4e4f5051525354555657")
+	aad := toByte("50515253c0c1c2c3c4c5c6c7")
+	plaintext := []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+	ciphertext := toByte("bd6d179d3e83d43b9576579493c0e939572a1700252bfaccbed2902c21396cbb731c7f1b0b4aa6440bf3a82f4eda7e39ae64c6708c54c216cb96b72e1213b4522f8c9ba40db5d945b11b69b982c1bb9e3f3fac2bc369488f76b2383565d3fff921f9664c97637da9768812f615c68b13b52e")
+	tag := toByte("c0875924c1c7987947deafd8780acf49")
+
+	aead, err := NewXChaCha20Poly1305AEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aead.NonceSize() != 24 || aead.Overhead() != 16 {
+		t.Errorf("XChaCha20Poly1305AEAD : invalid nonce size %d or overhead %d", aead.NonceSize(), aead.Overhead())
+	}
+	sealed := aead.Seal(nil, nonce, plaintext, aad)
+	if !bytes.Equal(sealed, append(ciphertext, tag...)) {
+		t.Errorf("XChaCha20Poly1305AEAD.Seal : invalid ciphertext or tag %x", sealed)
+	}
+	opened, err := aead.Open(nil, nonce, sealed, aad)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("XChaCha20Poly1305AEAD.Open : invalid plaintext %x", opened)
+	}
+	sealed[0] ^= 1
+	if _, err = aead.Open(nil, nonce, sealed, aad); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Error("XChaCha20Poly1305AEAD.Open : modification of the ciphertext not detected")
+	}
+}
@@ -0,0 +1,275 @@
+package flowcontrol
+
+import "github.com/romain-jacotin/quic/congestion"
+import "github.com/romain-jacotin/quic/protocol"
+import "fmt"
+import "sync"
+import "time"
+
+const (
+	// INITIAL_STREAM_WINDOW and INITIAL_CONNECTION_WINDOW are the flow control windows before the handshake
+	INITIAL_STREAM_WINDOW     = 16 * 1024
+	INITIAL_CONNECTION_WINDOW = 16 * 1024
+	// MAX_STREAM_RECEIVE_WINDOW and MAX_CONNECTION_RECEIVE_WINDOW bound the auto-tuning of the receive windows
+	MAX_STREAM_RECEIVE_WINDOW     = 16 * 1024 * 1024
+	MAX_CONNECTION_RECEIVE_WINDOW = 24 * 1024 * 1024
+	// CONNECTION_WINDOW_MULTIPLIER is the minimum size of the connection receive window relative to an auto-tuned stream receive window
+	CONNECTION_WINDOW_MULTIPLIER = 1.5
+)
+
+// ErrFlowControlViolation is returned when the peer sends data beyond the offset advertised by our flow control window,
+// the connection must be closed with QUIC_FLOW_CONTROL_RECEIVED_TOO_MUCH_DATA.
+type ErrFlowControlViolation struct {
+	StreamID protocol.QuicStreamID
+	Offset   protocol.QuicByteOffset
+	Limit    protocol.QuicByteOffset
+}
+
+func (this ErrFlowControlViolation) Error() string {
+	return fmt.Sprintf("FlowController.UpdateHighestReceived : data up to offset %d beyond the flow control limit %d of stream %d", this.Offset, this.Limit, this.StreamID)
+}
+
+// ErrorCode returns the error code of the CONNECTION_CLOSE frame.
+func (this ErrFlowControlViolation) ErrorCode() protocol.QuicErrorCode {
+	return protocol.QUIC_FLOW_CONTROL_RECEIVED_TOO_MUCH_DATA
+}
+
+// FlowController is the flow control of a stream, or of the connection with the Stream ID 0, in both directions:
+//
+//   - send side: the bytes sent versus the offset advertised by the WINDOW_UPDATE frames of the peer,
+//   - receive side: the highest offset received and the bytes read versus the offset advertised by our WINDOW_UPDATE frames.
+//
+// A stream FlowController is attached to the connection FlowController: the bytes sent and received are counted at both levels,
+// and the sends are gated on both windows. The methods are safe for concurrent use by the send and receive paths.
+type FlowController struct {
+	mutex      sync.Mutex
+	streamID   protocol.QuicStreamID
+	connection *FlowController
+	rttStats   *congestion.RTTStats
+
+	// Send side
+	bytesSent     protocol.QuicByteOffset
+	sendWindow    protocol.QuicByteOffset
+	lastBlockedAt protocol.QuicByteOffset
+
+	// Receive side
+	highestReceived      protocol.QuicByteOffset
+	bytesRead            protocol.QuicByteOffset
+	receiveWindow        protocol.QuicByteOffset
+	receiveWindowSize    protocol.QuicByteOffset
+	maxReceiveWindowSize protocol.QuicByteOffset
+	lastWindowUpdateTime time.Time
+}
+
+// NewConnectionFlowController returns the connection level FlowController with our receive window and the send window of the peer.
+func NewConnectionFlowController(receiveWindow, maxReceiveWindow, sendWindow protocol.QuicByteOffset, rttStats *congestion.RTTStats) *FlowController {
+	return &FlowController{
+		rttStats:             rttStats,
+		sendWindow:           sendWindow,
+		receiveWindow:        receiveWindow,
+		receiveWindowSize:    receiveWindow,
+		maxReceiveWindowSize: maxReceiveWindow}
+}
+
+// NewStreamFlowController returns the FlowController of a stream, attached to the connection FlowController.
+func NewStreamFlowController(streamID protocol.QuicStreamID, connection *FlowController, receiveWindow, maxReceiveWindow, sendWindow protocol.QuicByteOffset, rttStats *congestion.RTTStats) *FlowController {
+	f := NewConnectionFlowController(receiveWindow, maxReceiveWindow, sendWindow, rttStats)
+	f.streamID = streamID
+	f.connection = connection
+	return f
+}
+
+// GetStreamID returns the Stream ID of the flow controller, 0 for the connection.
+func (this *FlowController) GetStreamID() protocol.QuicStreamID {
+	return this.streamID
+}
+
+// SendWindowSize returns the number of bytes that can be sent, limited by the stream and the connection windows.
+func (this *FlowController) SendWindowSize() protocol.QuicByteOffset {
+	this.mutex.Lock()
+	size := this.sendWindowSize()
+	this.mutex.Unlock()
+	if this.connection != nil {
+		if c := this.connection.SendWindowSize(); c < size {
+			size = c
+		}
+	}
+	return size
+}
+
+func (this *FlowController) sendWindowSize() protocol.QuicByteOffset {
+	if this.bytesSent >= this.sendWindow {
+		return 0
+	}
+	return this.sendWindow - this.bytesSent
+}
+
+// AddBytesSent counts the stream data sent at the stream and connection levels.
+func (this *FlowController) AddBytesSent(n protocol.QuicByteOffset) {
+	this.mutex.Lock()
+	this.bytesSent += n
+	this.mutex.Unlock()
+	if this.connection != nil {
+		this.connection.AddBytesSent(n)
+	}
+}
+
+// GetBytesSent returns the stream data sent.
+func (this *FlowController) GetBytesSent() protocol.QuicByteOffset {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.bytesSent
+}
+
+// UpdateSendWindow applies the offset of a WINDOW_UPDATE frame of the peer, and returns true if the send window grows.
+// The offset of a reordered WINDOW_UPDATE frame can be smaller than the current one, it is ignored.
+func (this *FlowController) UpdateSendWindow(offset protocol.QuicByteOffset) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if offset <= this.sendWindow {
+		return false
+	}
+	this.sendWindow = offset
+	return true
+}
+
+// GetBlockedFrame returns the BLOCKED frame to send if this level has exhausted its send window, once per send window offset.
+func (this *FlowController) GetBlockedFrame() *protocol.BlockedFrame {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.sendWindowSize() > 0 || this.lastBlockedAt == this.sendWindow {
+		return nil
+	}
+	this.lastBlockedAt = this.sendWindow
+	return &protocol.BlockedFrame{StreamID: this.streamID}
+}
+
+// UpdateHighestReceived records the end offset of the stream data received (STREAM frame or final offset of a RST_STREAM frame),
+// at the stream and connection levels. The retransmissions of data below the highest offset are not counted twice.
+func (this *FlowController) UpdateHighestReceived(offset protocol.QuicByteOffset) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if offset <= this.highestReceived {
+		return nil
+	}
+	if offset > this.receiveWindow {
+		return ErrFlowControlViolation{StreamID: this.streamID, Offset: offset, Limit: this.receiveWindow}
+	}
+	if this.connection != nil {
+		if err := this.connection.addBytesReceived(offset - this.highestReceived); err != nil {
+			return err
+		}
+	}
+	this.highestReceived = offset
+	return nil
+}
+
+// addBytesReceived counts the new bytes of a stream at the connection level.
+func (this *FlowController) addBytesReceived(n protocol.QuicByteOffset) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.highestReceived+n > this.receiveWindow {
+		return ErrFlowControlViolation{Offset: this.highestReceived + n, Limit: this.receiveWindow}
+	}
+	this.highestReceived += n
+	return nil
+}
+
+// GetHighestReceived returns the highest offset of the stream data received, or the bytes received by the connection.
+func (this *FlowController) GetHighestReceived() protocol.QuicByteOffset {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.highestReceived
+}
+
+// AddBytesRead counts the stream data consumed by the application at the stream and connection levels.
+func (this *FlowController) AddBytesRead(n protocol.QuicByteOffset) {
+	this.mutex.Lock()
+	this.bytesRead += n
+	this.mutex.Unlock()
+	if this.connection != nil {
+		this.connection.AddBytesRead(n)
+	}
+}
+
+// GetBytesRead returns the stream data consumed by the application, or by all the streams of the connection.
+func (this *FlowController) GetBytesRead() protocol.QuicByteOffset {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.bytesRead
+}
+
+// DiscardUnread counts the stream data received but not read as consumed at the stream and connection levels, when the
+// stream is reset: the connection receive window doesn't keep the data that will never be read.
+func (this *FlowController) DiscardUnread() {
+	this.mutex.Lock()
+	n := this.highestReceived - this.bytesRead
+	this.bytesRead = this.highestReceived
+	this.mutex.Unlock()
+	if n > 0 && this.connection != nil {
+		this.connection.AddBytesRead(n)
+	}
+}
+
+// GetReceiveWindow returns the offset advertised to the peer.
+func (this *FlowController) GetReceiveWindow() protocol.QuicByteOffset {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.receiveWindow
+}
+
+// GetReceiveWindowSize returns the size of the receive window, after auto-tuning.
+func (this *FlowController) GetReceiveWindowSize() protocol.QuicByteOffset {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.receiveWindowSize
+}
+
+// GetWindowUpdate returns the WINDOW_UPDATE frame to send when the application has consumed half of the receive window, or nil.
+//
+// The receive window size is doubled, up to its maximum, when two window updates are less than one smoothed RTT apart:
+// the window limits the throughput of the peer. The connection window is grown to follow an auto-tuned stream window.
+func (this *FlowController) GetWindowUpdate(now time.Time) *protocol.WindowUpdateFrame {
+	this.mutex.Lock()
+	if this.receiveWindow-this.bytesRead > this.receiveWindowSize/2 {
+		this.mutex.Unlock()
+		return nil
+	}
+	if !this.lastWindowUpdateTime.IsZero() && this.rttStats != nil {
+		if srtt := this.rttStats.SmoothedRTT(); srtt > 0 && now.Sub(this.lastWindowUpdateTime) < srtt {
+			if this.receiveWindowSize *= 2; this.receiveWindowSize > this.maxReceiveWindowSize {
+				this.receiveWindowSize = this.maxReceiveWindowSize
+			}
+		}
+	}
+	this.lastWindowUpdateTime = now
+	this.receiveWindow = this.bytesRead + this.receiveWindowSize
+	f := &protocol.WindowUpdateFrame{StreamID: this.streamID, ByteOffset: this.receiveWindow}
+	size := this.receiveWindowSize
+	this.mutex.Unlock()
+	if this.connection != nil {
+		this.connection.EnsureMinimumWindowSize(protocol.QuicByteOffset(CONNECTION_WINDOW_MULTIPLIER * float64(size)))
+	}
+	return f
+}
+
+// GetConnectionWindowUpdate returns the WINDOW_UPDATE frame of the connection FlowController of a stream, or nil: the data read
+// on the streams can consume half of the connection receive window while none of the stream windows needs an update.
+func (this *FlowController) GetConnectionWindowUpdate(now time.Time) *protocol.WindowUpdateFrame {
+	if this.connection == nil {
+		return nil
+	}
+	return this.connection.GetWindowUpdate(now)
+}
+
+// EnsureMinimumWindowSize grows the receive window size up to its maximum, the next WINDOW_UPDATE frame advertises it.
+func (this *FlowController) EnsureMinimumWindowSize(size protocol.QuicByteOffset) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if size > this.maxReceiveWindowSize {
+		size = this.maxReceiveWindowSize
+	}
+	if size > this.receiveWindowSize {
+		this.receiveWindowSize = size
+	}
+}
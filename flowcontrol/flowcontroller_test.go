@@ -0,0 +1,164 @@
+package flowcontrol
+
+import "github.com/romain-jacotin/quic/congestion"
+import "github.com/romain-jacotin/quic/protocol"
+import "sync"
+import "testing"
+import "time"
+
+func Test_FlowController_Send(t *testing.T) {
+	connection := NewConnectionFlowController(1000, 1000, 150, nil)
+	stream1 := NewStreamFlowController(5, connection, 1000, 1000, 100, nil)
+	stream2 := NewStreamFlowController(7, connection, 1000, 1000, 100, nil)
+
+	stream1.AddBytesSent(80)
+	if stream1.SendWindowSize() != 20 || stream2.SendWindowSize() != 70 || connection.SendWindowSize() != 70 {
+		t.Errorf("FlowController.SendWindowSize : invalid send windows %v, %v and %v", stream1.SendWindowSize(), stream2.SendWindowSize(), connection.SendWindowSize())
+	}
+
+	// Stream level BLOCKED frame, once per offset
+	stream1.AddBytesSent(20)
+	if f := stream1.GetBlockedFrame(); f == nil || f.StreamID != 5 || stream1.GetBlockedFrame() != nil || connection.GetBlockedFrame() != nil {
+		t.Errorf("FlowController.GetBlockedFrame : a single BLOCKED frame of stream 5 expected instead of %v", f)
+	}
+	if stream1.UpdateSendWindow(50) || stream1.SendWindowSize() != 0 {
+		t.Error("FlowController.UpdateSendWindow : reordered WINDOW_UPDATE must be ignored")
+	}
+	if !stream1.UpdateSendWindow(300) || stream1.SendWindowSize() != 50 {
+		t.Errorf("FlowController.UpdateSendWindow : send window limited by the connection expected instead of %v", stream1.SendWindowSize())
+	}
+
+	// Connection level BLOCKED frame
+	stream2.AddBytesSent(50)
+	if stream1.SendWindowSize() != 0 || stream2.SendWindowSize() != 0 || stream2.GetBlockedFrame() != nil {
+		t.Error("FlowController.SendWindowSize : sends must be gated on the connection window")
+	}
+	if f := connection.GetBlockedFrame(); f == nil || f.StreamID != 0 {
+		t.Errorf("FlowController.GetBlockedFrame : BLOCKED frame of the connection expected instead of %v", f)
+	}
+	connection.UpdateSendWindow(400)
+	if stream1.SendWindowSize() != 200 || stream2.SendWindowSize() != 50 || stream1.GetBytesSent() != 100 || connection.GetBytesSent() != 150 {
+		t.Errorf("FlowController.SendWindowSize : invalid send windows %v and %v after connection WINDOW_UPDATE", stream1.SendWindowSize(), stream2.SendWindowSize())
+	}
+}
+
+func Test_FlowController_Receive(t *testing.T) {
+	connection := NewConnectionFlowController(150, 1000, 1000, nil)
+	stream1 := NewStreamFlowController(5, connection, 100, 1000, 1000, nil)
+	stream2 := NewStreamFlowController(7, connection, 100, 1000, 1000, nil)
+
+	// Retransmissions and reordered frames are not counted twice
+	for _, offset := range []protocol.QuicByteOffset{60, 40, 60, 100} {
+		if err := stream1.UpdateHighestReceived(offset); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stream1.GetHighestReceived() != 100 || connection.GetHighestReceived() != 100 {
+		t.Errorf("FlowController.UpdateHighestReceived : invalid highest received %v and %v", stream1.GetHighestReceived(), connection.GetHighestReceived())
+	}
+
+	// Stream level violation
+	err := stream1.UpdateHighestReceived(101)
+	if e, ok := err.(ErrFlowControlViolation); !ok || e.StreamID != 5 || e.Offset != 101 || e.Limit != 100 || e.ErrorCode() != protocol.QUIC_FLOW_CONTROL_RECEIVED_TOO_MUCH_DATA {
+		t.Errorf("FlowController.UpdateHighestReceived : stream flow control violation expected instead of %v", err)
+	}
+	// Connection level violation, the stream is not updated
+	err = stream2.UpdateHighestReceived(60)
+	if e, ok := err.(ErrFlowControlViolation); !ok || e.StreamID != 0 || e.Offset != 160 || e.Limit != 150 {
+		t.Errorf("FlowController.UpdateHighestReceived : connection flow control violation expected instead of %v", err)
+	}
+	if stream2.GetHighestReceived() != 0 || connection.GetHighestReceived() != 100 {
+		t.Error("FlowController.UpdateHighestReceived : a violation must not change the state")
+	}
+
+	// WINDOW_UPDATE frames when half of the window is consumed
+	now := time.Now()
+	stream1.AddBytesRead(49)
+	if stream1.GetWindowUpdate(now) != nil {
+		t.Error("FlowController.GetWindowUpdate : no WINDOW_UPDATE expected before half of the window is consumed")
+	}
+	stream1.AddBytesRead(1)
+	if f := stream1.GetWindowUpdate(now); f == nil || f.StreamID != 5 || f.ByteOffset != 150 || stream1.GetWindowUpdate(now) != nil {
+		t.Errorf("FlowController.GetWindowUpdate : WINDOW_UPDATE of stream 5 at offset 150 expected instead of %v", f)
+	}
+	stream1.AddBytesRead(25)
+	if f := connection.GetWindowUpdate(now); f == nil || f.StreamID != 0 || f.ByteOffset != 225 {
+		t.Errorf("FlowController.GetWindowUpdate : WINDOW_UPDATE of the connection at offset 225 expected instead of %v", f)
+	}
+	if stream1.GetConnectionWindowUpdate(now) != nil || connection.GetConnectionWindowUpdate(now) != nil {
+		t.Error("FlowController.GetConnectionWindowUpdate : no WINDOW_UPDATE expected after the one of the connection")
+	}
+	if err = stream2.UpdateHighestReceived(60); err != nil {
+		t.Errorf("FlowController.UpdateHighestReceived : data allowed by the new connection window rejected : %v", err)
+	}
+
+	// The data of a reset stream is consumed at both levels
+	stream2.DiscardUnread()
+	stream2.DiscardUnread()
+	if stream2.GetBytesRead() != 60 || connection.GetBytesRead() != 135 {
+		t.Errorf("FlowController.DiscardUnread : 60 and 135 bytes read expected instead of %v and %v", stream2.GetBytesRead(), connection.GetBytesRead())
+	}
+}
+
+func Test_FlowController_AutoTuning(t *testing.T) {
+	rttStats := congestion.NewRTTStats()
+	rttStats.UpdateRTT(100*time.Millisecond, 0)
+	connection := NewConnectionFlowController(1000, 10000, 1000, rttStats)
+	stream := NewStreamFlowController(5, connection, 1000, 4000, 1000, rttStats)
+	now := time.Now()
+	read := protocol.QuicByteOffset(0)
+
+	for i, v := range []struct {
+		delay time.Duration
+		size  protocol.QuicByteOffset
+	}{
+		{0, 1000},
+		// Updates less than one RTT apart: the window limits the peer
+		{50 * time.Millisecond, 2000},
+		{50 * time.Millisecond, 4000},
+		// Bounded by the maximum window
+		{50 * time.Millisecond, 4000},
+		// Slow reader: no growth
+		{200 * time.Millisecond, 4000},
+	} {
+		now = now.Add(v.delay)
+		n := stream.GetReceiveWindow() - read - stream.GetReceiveWindowSize()/2
+		stream.UpdateHighestReceived(read + n)
+		stream.AddBytesRead(n)
+		read += n
+		f := stream.GetWindowUpdate(now)
+		if f == nil || stream.GetReceiveWindowSize() != v.size || f.ByteOffset != read+v.size {
+			t.Errorf("FlowController.GetWindowUpdate : window size %v instead of %v in test n°%v", stream.GetReceiveWindowSize(), v.size, i)
+		}
+	}
+	if connection.GetReceiveWindowSize() != 6000 {
+		t.Errorf("FlowController.EnsureMinimumWindowSize : connection window size %v instead of 1.5 times the stream window", connection.GetReceiveWindowSize())
+	}
+}
+
+func Test_FlowController_Concurrency(t *testing.T) {
+	connection := NewConnectionFlowController(1<<20, 1<<20, 1<<20, nil)
+	stream := NewStreamFlowController(5, connection, 1<<20, 1<<20, 1<<20, nil)
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			stream.AddBytesSent(10)
+			stream.SendWindowSize()
+		}
+		wg.Done()
+	}()
+	go func() {
+		for i := 1; i <= 1000; i++ {
+			stream.UpdateHighestReceived(protocol.QuicByteOffset(i * 10))
+			stream.AddBytesRead(10)
+			stream.GetWindowUpdate(time.Now())
+		}
+		wg.Done()
+	}()
+	wg.Wait()
+	if connection.GetBytesSent() != 10000 || connection.GetHighestReceived() != 10000 {
+		t.Errorf("FlowController : invalid bytes sent %v or received %v", connection.GetBytesSent(), connection.GetHighestReceived())
+	}
+}
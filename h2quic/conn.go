@@ -0,0 +1,258 @@
+package h2quic
+
+import "github.com/romain-jacotin/quic"
+import "github.com/romain-jacotin/quic/protocol"
+import "context"
+import "errors"
+import "io"
+import "net/http"
+import "sync"
+
+// ERRORCODE_CANCEL resets the data stream of a request cancelled by the client, or of a response body closed before its end.
+const ERRORCODE_CANCEL = protocol.QUIC_CONNECTION_CANCELLED
+
+// ErrConnClosed is returned by the requests and the bodies of a session whose headers stream is closed.
+var ErrConnClosed = errors.New("h2quic : headers stream closed")
+
+// conn is the headers stream of a session, shared by its requests: a goroutine reads the HEADERS frames and hands them
+// over to the state of their stream.
+type conn struct {
+	session quic.Session
+	writer  *frameWriter
+	reader  *frameReader
+
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	streams map[protocol.QuicStreamID]*streamState
+	// accepted are the data streams accepted on the server, until their request takes them
+	accepted map[protocol.QuicStreamID]quic.Stream
+	err      error
+	done     chan struct{}
+}
+
+func newConn(session quic.Session, maxHeaderBytes int) *conn {
+	h := session.HeadersStream()
+	c := &conn{
+		session:  session,
+		writer:   newFrameWriter(h),
+		reader:   newFrameReader(h, maxHeaderBytes),
+		streams:  make(map[protocol.QuicStreamID]*streamState),
+		accepted: make(map[protocol.QuicStreamID]quic.Stream),
+		done:     make(chan struct{})}
+	c.cond = sync.NewCond(&c.mutex)
+	return c
+}
+
+// close marks the conn closed with the error, once, and closes the session with it: a nil error or io.EOF is a close
+// without error, reported as ErrConnClosed.
+func (this *conn) close(err error) {
+	this.mutex.Lock()
+	if this.err != nil {
+		this.mutex.Unlock()
+		return
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	if this.err = err; err == nil {
+		this.err = ErrConnClosed
+	}
+	close(this.done)
+	this.cond.Broadcast()
+	this.mutex.Unlock()
+	this.session.Close(err)
+}
+
+// closeErr returns the error that closed the conn, or nil.
+func (this *conn) closeErr() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.err
+}
+
+// addStream returns the state of a new stream, nil if the conn is closed.
+func (this *conn) addStream(id protocol.QuicStreamID) *streamState {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.err != nil {
+		return nil
+	}
+	state := &streamState{blocks: make(chan *headersFrame, 2)}
+	this.streams[id] = state
+	return state
+}
+
+// getStream returns the state of the stream, nil if it is unknown.
+func (this *conn) getStream(id protocol.QuicStreamID) *streamState {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.streams[id]
+}
+
+// removeStream forgets the stream, its next HEADERS frames are ignored.
+func (this *conn) removeStream(id protocol.QuicStreamID) {
+	this.mutex.Lock()
+	delete(this.streams, id)
+	this.mutex.Unlock()
+}
+
+// acceptStreams accepts the data streams of the session until it is closed, the server takes them with waitStream.
+func (this *conn) acceptStreams() {
+	for {
+		stream, err := this.session.AcceptStream(context.Background())
+		if err != nil {
+			this.close(err)
+			return
+		}
+		this.mutex.Lock()
+		this.accepted[stream.GetStreamID()] = stream
+		this.cond.Broadcast()
+		this.mutex.Unlock()
+	}
+}
+
+// waitStream waits for the data stream of a request, whose HEADERS frame can arrive before or after the stream.
+func (this *conn) waitStream(id protocol.QuicStreamID) (quic.Stream, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for {
+		if stream, ok := this.accepted[id]; ok {
+			delete(this.accepted, id)
+			return stream, nil
+		}
+		if this.err != nil {
+			return nil, this.err
+		}
+		this.cond.Wait()
+	}
+}
+
+// streamState are the header blocks of a stream received on the headers stream: the headers, then the trailers if the
+// headers have no END_STREAM flag.
+type streamState struct {
+	blocks chan *headersFrame
+}
+
+// deliver hands the HEADERS frame over to the stream, it returns false if the stream has already received its headers and trailers.
+func (this *streamState) deliver(f *headersFrame) bool {
+	select {
+	case this.blocks <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+// body is the body of a request or of a response on its data stream, followed by the trailers of the stream if its
+// HEADERS frame has no END_STREAM flag.
+type body struct {
+	conn      *conn
+	stream    quic.Stream
+	state     *streamState
+	endStream bool
+	trailer   *http.Header
+	// server is true for the body of a request, false for the body of a response
+	server bool
+	// first is the result of the first read, started before the headers of the response to catch a reset of the stream
+	first chan readResult
+	buf   []byte
+	eof   bool
+	err   error
+}
+
+// readResult is the result of a read on a stream.
+type readResult struct {
+	n   int
+	err error
+}
+
+// Read reads the data of the stream, and the trailers after the FIN.
+func (this *body) Read(p []byte) (int, error) {
+	if this.err != nil {
+		return 0, this.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	var n int
+	var err error
+	if this.first != nil {
+		r := <-this.first
+		this.first = nil
+		if r.n == 0 && r.err == nil {
+			n, err = this.stream.Read(p)
+		} else {
+			n, err = copy(p, this.buf[:r.n]), r.err
+		}
+		this.buf = nil
+	} else {
+		n, err = this.stream.Read(p)
+	}
+	if err == io.EOF && !this.endStream {
+		if err = this.readTrailers(); err == nil {
+			err = io.EOF
+		}
+	}
+	if err != nil {
+		this.eof = err == io.EOF
+		this.err = err
+	}
+	return n, err
+}
+
+// readTrailers waits for the HEADERS frame of the trailers after the FIN of the stream.
+func (this *body) readTrailers() error {
+	select {
+	case f := <-this.state.blocks:
+		trailer, err := trailerFromHeaders(f.Fields)
+		if err != nil || !f.EndStream {
+			this.stream.Reset(protocol.QUIC_INVALID_HEADER_ID)
+			return ErrInvalidHeaders
+		}
+		if len(trailer) > 0 {
+			if *this.trailer == nil {
+				*this.trailer = make(http.Header)
+			}
+			for k, v := range trailer {
+				(*this.trailer)[k] = v
+			}
+		}
+		this.endStream = true
+		return nil
+	case <-this.conn.done:
+		return this.conn.closeErr()
+	}
+}
+
+// Close stops the reading of the body before its end: the server discards the rest of the body of the request, the client
+// resets the stream of the response.
+func (this *body) Close() error {
+	eof := this.eof
+	if this.err == nil {
+		this.err = http.ErrBodyReadAfterClose
+	}
+	if !this.server {
+		this.conn.removeStream(this.stream.GetStreamID())
+	}
+	switch {
+	case eof:
+	case this.server:
+		this.stream.CloseRead()
+	default:
+		this.stream.Reset(ERRORCODE_CANCEL)
+	}
+	return nil
+}
+
+// startFirstRead reads the first byte of the stream in a goroutine, the next Read returns it.
+func (this *body) startFirstRead() <-chan readResult {
+	this.buf = make([]byte, 1)
+	this.first = make(chan readResult, 1)
+	first := make(chan readResult, 1)
+	go func() {
+		n, err := this.stream.Read(this.buf)
+		this.first <- readResult{n, err}
+		first <- readResult{n, err}
+	}()
+	return first
+}
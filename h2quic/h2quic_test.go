@@ -0,0 +1,218 @@
+package h2quic
+
+import "github.com/romain-jacotin/quic"
+import "github.com/romain-jacotin/quic/handshake"
+import "github.com/romain-jacotin/quic/internal/hpack"
+import "github.com/romain-jacotin/quic/protocol"
+import "github.com/romain-jacotin/quic/stream"
+import "bytes"
+import "crypto/tls"
+import "crypto/x509"
+import "errors"
+import "io"
+import "net"
+import "net/http"
+import "os"
+import "reflect"
+import "strings"
+import "testing"
+import "time"
+
+var tests_headersframes = []struct {
+	streamID  uint32
+	endStream bool
+	fields    []hpack.HeaderField
+}{
+	{5, true, []hpack.HeaderField{{Name: ":method", Value: "GET"}, {Name: ":path", Value: "/"}}},
+	{7, false, []hpack.HeaderField{{Name: ":status", Value: "200"}, {Name: "x-large", Value: strings.Repeat("a", 3*MAX_FRAME_SIZE)}}},
+	{9, true, nil},
+}
+
+func Test_HeadersFrames(t *testing.T) {
+	var b bytes.Buffer
+	w := newFrameWriter(&b)
+	for _, v := range tests_headersframes {
+		w.WriteHeaders(protocol.QuicStreamID(v.streamID), v.fields, v.endStream)
+	}
+	// A SETTINGS frame is ignored
+	b.Write([]byte{0, 0, 0, 0x4, 0, 0, 0, 0, 0})
+	r := newFrameReader(&b, DEFAULT_MAX_HEADER_BYTES)
+	for i, v := range tests_headersframes {
+		f, err := r.ReadHeaders()
+		if err != nil || uint32(f.StreamID) != v.streamID || f.EndStream != v.endStream || len(f.Fields) != len(v.fields) ||
+			(len(v.fields) > 0 && !reflect.DeepEqual(f.Fields, v.fields)) {
+			t.Errorf("frameReader.ReadHeaders : %v expected instead of %v (%v) in test n°%v", v, f, err, i)
+		}
+	}
+	if _, err := r.ReadHeaders(); err != io.EOF {
+		t.Errorf("frameReader.ReadHeaders : io.EOF expected instead of %v", err)
+	}
+	// A CONTINUATION frame of another stream
+	b.Reset()
+	b.Write([]byte{0, 0, 1, FRAMETYPE_HEADERS, 0, 0, 0, 0, 5, 0x82, 0, 0, 1, FRAMETYPE_CONTINUATION, FLAG_END_HEADERS, 0, 0, 0, 7, 0x84})
+	if _, err := r.ReadHeaders(); err != ErrInvalidFrame {
+		t.Errorf("frameReader.ReadHeaders : ErrInvalidFrame expected instead of %v", err)
+	}
+}
+
+var tests_requestheaders = []struct {
+	method  string
+	url     string
+	header  http.Header
+	trailer http.Header
+}{
+	{"GET", "https://example.com/index.html?q=1", http.Header{"Cookie": {"a=1", "b=2"}, "Connection": {"close"}}, nil},
+	{"POST", "https://example.com:4433/upload", http.Header{"Authorization": {"secret"}}, http.Header{"X-Checksum": nil}},
+}
+
+func Test_RequestHeaders(t *testing.T) {
+	for i, v := range tests_requestheaders {
+		req, _ := http.NewRequest(v.method, v.url, nil)
+		req.Header = v.header
+		req.Trailer = v.trailer
+		r, err := requestFromHeaders(requestHeaders(req))
+		if err != nil || r.Method != v.method || r.Host != req.URL.Host || r.RequestURI != req.URL.RequestURI() ||
+			!reflect.DeepEqual(r.Trailer, v.trailer) {
+			t.Errorf("requestFromHeaders : %v expected instead of %v (%v) in test n°%v", req, r, err, i)
+			continue
+		}
+		if r.Header.Get("Connection") != "" || r.Header.Get("Cookie") != strings.Join(v.header["Cookie"], "; ") {
+			t.Errorf("requestFromHeaders : unexpected header %v in test n°%v", r.Header, i)
+		}
+	}
+	for i, fields := range [][]hpack.HeaderField{
+		{{Name: ":method", Value: "GET"}, {Name: ":scheme", Value: "https"}},
+		{{Name: ":method", Value: "GET"}, {Name: ":scheme", Value: "https"}, {Name: ":path", Value: "/"}, {Name: "Upper", Value: "x"}},
+		{{Name: ":method", Value: "GET"}, {Name: "accept", Value: "*/*"}, {Name: ":scheme", Value: "https"}, {Name: ":path", Value: "/"}},
+		{{Name: ":method", Value: "GET"}, {Name: ":scheme", Value: "https"}, {Name: ":path", Value: "/"}, {Name: ":status", Value: "200"}},
+	} {
+		if _, err := requestFromHeaders(fields); err != ErrInvalidHeaders {
+			t.Errorf("requestFromHeaders : ErrInvalidHeaders expected instead of %v in test n°%v", err, i)
+		}
+	}
+}
+
+// testServer serves the handler on a loopback UDP socket, and returns the RoundTripper and the URL of the server.
+func testServer(t *testing.T, handler http.Handler) (*RoundTripper, string, func()) {
+	cert, err := tls.LoadX509KeyPair("../testdata/cert.pem", "../testdata/cert.key")
+	if err != nil {
+		t.Fatalf("tls.LoadX509KeyPair : unexpected error %v", err)
+	}
+	sc, err := handshake.NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+	if err = sc.SetCertificate(cert); err != nil {
+		t.Fatalf("ServerConfig.SetCertificate : unexpected error %v", err)
+	}
+	ca, err := os.ReadFile("../testdata/ca.pem")
+	if err != nil {
+		t.Fatalf("os.ReadFile : unexpected error %v", err)
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket : unexpected error %v", err)
+	}
+	l, err := quic.Listen(pc, &quic.Config{ServerConfig: sc})
+	if err != nil {
+		t.Fatalf("quic.Listen : unexpected error %v", err)
+	}
+	go (&Server{Handler: handler}).Serve(l)
+	rt := &RoundTripper{Config: &quic.Config{RootCAs: x509.NewCertPool()}}
+	rt.Config.RootCAs.AppendCertsFromPEM(ca)
+	return rt, "https://localhost:" + strings.Split(pc.LocalAddr().String(), ":")[1], func() {
+		rt.Close()
+		l.Close()
+		pc.Close()
+	}
+}
+
+func Test_RoundTripper(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), 10<<20/16)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>hello</html>"))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(large)
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Request-Checksum")
+		w.Header().Set(http.TrailerPrefix+"X-Length", "")
+		n, _ := io.Copy(w, r.Body)
+		w.Header().Set("X-Request-Checksum", r.Trailer.Get("X-Checksum"))
+		w.Header().Set(http.TrailerPrefix+"X-Length", strings.Repeat("n", int(n%10)))
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	rt, url, closeServer := testServer(t, mux)
+	defer closeServer()
+	client := &http.Client{Transport: rt}
+
+	res, err := client.Get(url + "/small")
+	if err != nil {
+		t.Fatalf("RoundTripper.RoundTrip : unexpected error %v", err)
+	}
+	b, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil || string(b) != "<html>hello</html>" || res.StatusCode != http.StatusOK || res.ContentLength != int64(len(b)) ||
+		res.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("RoundTripper.RoundTrip : unexpected response %v %q (%v)", res, b, err)
+	}
+
+	res, err = client.Get(url + "/large")
+	if err != nil {
+		t.Fatalf("RoundTripper.RoundTrip : unexpected error %v", err)
+	}
+	b, err = io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil || !bytes.Equal(b, large) {
+		t.Errorf("RoundTripper.RoundTrip : response of %v bytes expected instead of %v (%v)", len(large), len(b), err)
+	}
+
+	req, _ := http.NewRequest("POST", url+"/echo", nil)
+	req.Body = &trailerBody{bytes.NewReader(large[:1<<20+7]), req, "abc"}
+	req.Trailer = http.Header{"X-Checksum": nil}
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("RoundTripper.RoundTrip : unexpected error %v", err)
+	}
+	b, err = io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil || !bytes.Equal(b, large[:1<<20+7]) {
+		t.Errorf("RoundTripper.RoundTrip : echo of %v bytes expected instead of %v (%v)", 1<<20+7, len(b), err)
+	}
+	if res.Trailer.Get("X-Request-Checksum") != "abc" || res.Trailer.Get("X-Length") != "nnn" {
+		t.Errorf("RoundTripper.RoundTrip : unexpected trailers %v", res.Trailer)
+	}
+
+	res, err = client.Get(url + "/panic")
+	var resetErr stream.StreamResetError
+	if err == nil || !errors.As(err, &resetErr) {
+		t.Errorf("RoundTripper.RoundTrip : stream.StreamResetError expected instead of %v %v", res, err)
+	}
+
+	if _, err = client.Get("http://localhost/"); err == nil || !errors.Is(err, ErrUnsupportedScheme) {
+		t.Errorf("RoundTripper.RoundTrip : ErrUnsupportedScheme expected instead of %v", err)
+	}
+}
+
+// trailerBody sets the trailer of the request once its body is read.
+type trailerBody struct {
+	io.Reader
+	req   *http.Request
+	value string
+}
+
+func (this *trailerBody) Read(p []byte) (int, error) {
+	n, err := this.Reader.Read(p)
+	if err == io.EOF {
+		this.req.Trailer.Set("X-Checksum", this.value)
+	}
+	return n, err
+}
+
+func (this *trailerBody) Close() error {
+	return nil
+}
@@ -0,0 +1,241 @@
+package h2quic
+
+import "github.com/romain-jacotin/quic/internal/hpack"
+import "errors"
+import "net/http"
+import "net/url"
+import "sort"
+import "strconv"
+import "strings"
+
+// ErrInvalidHeaders is returned for a header list that is not a valid request, response or trailers.
+var ErrInvalidHeaders = errors.New("h2quic : invalid header list")
+
+// connectionHeaders are the headers of HTTP/1 that are not sent, the other headers are sent in lowercase.
+var connectionHeaders = map[string]bool{
+	"connection":        true,
+	"content-length":    true,
+	"host":              true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"te":                true,
+	"trailer":           true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+// sensitiveHeaders are never indexed by the HPACK encoders of the proxies.
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"cookie":              true,
+	"proxy-authorization": true,
+	"set-cookie":          true,
+}
+
+// requestHeaders returns the header list of the request.
+func requestHeaders(req *http.Request) []hpack.HeaderField {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fields := []hpack.HeaderField{
+		{Name: ":method", Value: req.Method},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: host},
+		{Name: ":path", Value: req.URL.RequestURI()}}
+	if req.Method == "" {
+		fields[0].Value = http.MethodGet
+	}
+	if req.ContentLength > 0 {
+		fields = append(fields, hpack.HeaderField{Name: "content-length", Value: strconv.FormatInt(req.ContentLength, 10)})
+	}
+	return appendHeaderFields(fields, req.Header, req.Trailer)
+}
+
+// responseHeaders returns the header list of the response, the keys of the trailers declared with http.TrailerPrefix excepted.
+func responseHeaders(status int, header http.Header) []hpack.HeaderField {
+	fields := []hpack.HeaderField{{Name: ":status", Value: strconv.Itoa(status)}}
+	if cl := header.Get("Content-Length"); cl != "" {
+		fields = append(fields, hpack.HeaderField{Name: "content-length", Value: cl})
+	}
+	trailer := make(http.Header)
+	for _, v := range header["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				trailer[http.CanonicalHeaderKey(k)] = nil
+			}
+		}
+	}
+	return appendHeaderFields(fields, header, trailer)
+}
+
+// appendHeaderFields appends the fields of the header sorted by name, and the trailer field with the keys of the trailers.
+func appendHeaderFields(fields []hpack.HeaderField, header http.Header, trailer http.Header) []hpack.HeaderField {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := strings.ToLower(k)
+		if connectionHeaders[name] || strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		for _, v := range header[k] {
+			fields = append(fields, hpack.HeaderField{Name: name, Value: v, Sensitive: sensitiveHeaders[name]})
+		}
+	}
+	if len(trailer) > 0 {
+		keys = keys[:0]
+		for k := range trailer {
+			keys = append(keys, http.CanonicalHeaderKey(k))
+		}
+		sort.Strings(keys)
+		fields = append(fields, hpack.HeaderField{Name: "trailer", Value: strings.Join(keys, ", ")})
+	}
+	return fields
+}
+
+// trailerHeaders returns the header list of the trailers.
+func trailerHeaders(trailer http.Header) []hpack.HeaderField {
+	return appendHeaderFields(nil, trailer, nil)
+}
+
+// parsedHeaders are the pseudo-headers and the header of a header list, with the keys of the trailers it declares.
+type parsedHeaders struct {
+	pseudo  map[string]string
+	header  http.Header
+	trailer http.Header
+}
+
+// parseHeaders checks the header list: the pseudo-headers first and once, lowercase names, and the cookie fields
+// joined in one header.
+func parseHeaders(fields []hpack.HeaderField) (*parsedHeaders, error) {
+	p := &parsedHeaders{pseudo: make(map[string]string), header: make(http.Header)}
+	var cookies []string
+	regular := false
+	for _, f := range fields {
+		if f.Name == "" || f.Name != strings.ToLower(f.Name) {
+			return nil, ErrInvalidHeaders
+		}
+		if f.Name[0] == ':' {
+			if _, ok := p.pseudo[f.Name]; ok || regular {
+				return nil, ErrInvalidHeaders
+			}
+			p.pseudo[f.Name] = f.Value
+			continue
+		}
+		regular = true
+		switch f.Name {
+		case "cookie":
+			cookies = append(cookies, f.Value)
+		case "trailer":
+			for _, k := range strings.Split(f.Value, ",") {
+				if k = strings.TrimSpace(k); k != "" {
+					if p.trailer == nil {
+						p.trailer = make(http.Header)
+					}
+					p.trailer[http.CanonicalHeaderKey(k)] = nil
+				}
+			}
+			p.header.Add("Trailer", f.Value)
+		default:
+			p.header.Add(http.CanonicalHeaderKey(f.Name), f.Value)
+		}
+	}
+	if len(cookies) > 0 {
+		p.header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	return p, nil
+}
+
+// contentLength returns the content length of the header, or -1 if it is unknown.
+func (this *parsedHeaders) contentLength() (int64, error) {
+	cl := this.header.Get("Content-Length")
+	if cl == "" {
+		return -1, nil
+	}
+	n, err := strconv.ParseInt(cl, 10, 64)
+	if err != nil || n < 0 {
+		return 0, ErrInvalidHeaders
+	}
+	return n, nil
+}
+
+// requestFromHeaders returns the request of the header list, without body.
+func requestFromHeaders(fields []hpack.HeaderField) (*http.Request, error) {
+	p, err := parseHeaders(fields)
+	if err != nil {
+		return nil, err
+	}
+	method, path, authority := p.pseudo[":method"], p.pseudo[":path"], p.pseudo[":authority"]
+	for name := range p.pseudo {
+		switch name {
+		case ":method", ":scheme", ":path", ":authority":
+		default:
+			return nil, ErrInvalidHeaders
+		}
+	}
+	if method == "" || path == "" || p.pseudo[":scheme"] == "" {
+		return nil, ErrInvalidHeaders
+	}
+	if authority == "" {
+		authority = p.header.Get("Host")
+	}
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		return nil, ErrInvalidHeaders
+	}
+	contentLength, err := p.contentLength()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Request{
+		Method:        method,
+		URL:           u,
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		Header:        p.header,
+		Host:          authority,
+		RequestURI:    path,
+		ContentLength: contentLength,
+		Trailer:       p.trailer}, nil
+}
+
+// responseFromHeaders returns the response of the header list, without body.
+func responseFromHeaders(fields []hpack.HeaderField) (*http.Response, error) {
+	p, err := parseHeaders(fields)
+	if err != nil {
+		return nil, err
+	}
+	status, err := strconv.Atoi(p.pseudo[":status"])
+	if err != nil || len(p.pseudo) != 1 || status < 100 || status > 999 {
+		return nil, ErrInvalidHeaders
+	}
+	contentLength, err := p.contentLength()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		Header:        p.header,
+		ContentLength: contentLength,
+		Trailer:       p.trailer}, nil
+}
+
+// trailerFromHeaders returns the trailers of the header list.
+func trailerFromHeaders(fields []hpack.HeaderField) (http.Header, error) {
+	p, err := parseHeaders(fields)
+	if err != nil || len(p.pseudo) > 0 {
+		return nil, ErrInvalidHeaders
+	}
+	return p.header, nil
+}
+
+// isInformational returns true if the header list is a 1xx response, that precedes the final response.
+func isInformational(fields []hpack.HeaderField) bool {
+	return len(fields) > 0 && fields[0].Name == ":status" && len(fields[0].Value) == 3 && fields[0].Value[0] == '1'
+}
@@ -0,0 +1,175 @@
+// Package h2quic maps HTTP on a QUIC Session like Google QUIC does with SPDY: the headers of the requests and of the responses
+// are HPACK header blocks in HTTP/2 HEADERS frames on the headers stream (Stream ID 3), and each request and its response
+// take a data stream of the client for their bodies.
+//
+// The RoundTripper is the http.RoundTripper of the https URLs on the client, the Server serves an http.Handler with the
+// sessions of a quic.Listener.
+//
+// The body of a request or of a response ends with the FIN of its data stream. A HEADERS frame without the END_STREAM flag
+// is followed by the HEADERS frame of the trailers with the END_STREAM flag, empty if there is no trailer.
+package h2quic
+
+import "github.com/romain-jacotin/quic/internal/hpack"
+import "github.com/romain-jacotin/quic/protocol"
+import "encoding/binary"
+import "errors"
+import "io"
+import "sync"
+
+// The HTTP/2 frames of the headers stream (RFC 7540 section 4.1).
+const (
+	FRAME_HEADER_SIZE = 9
+	// MAX_FRAME_SIZE is the largest payload of the frames sent, the default SETTINGS_MAX_FRAME_SIZE of HTTP/2
+	MAX_FRAME_SIZE = 16384
+
+	FRAMETYPE_HEADERS      = 0x1
+	FRAMETYPE_CONTINUATION = 0x9
+
+	FLAG_END_STREAM  = 0x1
+	FLAG_END_HEADERS = 0x4
+	FLAG_PADDED      = 0x8
+	FLAG_PRIORITY    = 0x20
+)
+
+// DEFAULT_MAX_HEADER_BYTES is the maximum size of the header lists received, counted like the entries of the HPACK dynamic table.
+const DEFAULT_MAX_HEADER_BYTES = 1 << 20
+
+// ErrInvalidFrame is returned for a malformed frame of the headers stream, the session is closed.
+var ErrInvalidFrame = errors.New("h2quic : invalid frame on the headers stream")
+
+// headersFrame is a HEADERS frame with its CONTINUATION frames, and the header list of its header block.
+type headersFrame struct {
+	StreamID  protocol.QuicStreamID
+	EndStream bool
+	Fields    []hpack.HeaderField
+}
+
+// frameReader reads the HEADERS frames of the headers stream, the other frames are ignored.
+type frameReader struct {
+	r           io.Reader
+	decoder     *hpack.Decoder
+	maxBlockLen int
+}
+
+func newFrameReader(r io.Reader, maxHeaderBytes int) *frameReader {
+	return &frameReader{r: r, decoder: hpack.NewDecoder(maxHeaderBytes), maxBlockLen: maxHeaderBytes}
+}
+
+// ReadHeaders returns the next HEADERS frame, the header block is decoded once its last CONTINUATION frame is read.
+func (this *frameReader) ReadHeaders() (*headersFrame, error) {
+	var block []byte
+	var f *headersFrame
+
+	for {
+		frameType, flags, streamID, payload, err := this.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case f == nil && frameType == FRAMETYPE_HEADERS:
+			if payload, err = removePadding(flags, payload); err != nil {
+				return nil, err
+			}
+			if flags&FLAG_PRIORITY != 0 {
+				if len(payload) < 5 {
+					return nil, ErrInvalidFrame
+				}
+				payload = payload[5:]
+			}
+			f = &headersFrame{StreamID: streamID, EndStream: flags&FLAG_END_STREAM != 0}
+		case f != nil && frameType == FRAMETYPE_CONTINUATION && streamID == f.StreamID:
+		case f != nil:
+			// Only the CONTINUATION frames of the header block can follow a HEADERS frame
+			return nil, ErrInvalidFrame
+		default:
+			continue
+		}
+		if len(block)+len(payload) > this.maxBlockLen {
+			return nil, hpack.ErrHeaderListTooLarge
+		}
+		block = append(block, payload...)
+		if flags&FLAG_END_HEADERS != 0 {
+			// The header blocks are decoded in order, even if the stream is not wanted anymore
+			if f.Fields, err = this.decoder.Decode(block); err != nil {
+				return nil, err
+			}
+			return f, nil
+		}
+	}
+}
+
+// readFrame reads a frame, its payload is valid until the next call.
+func (this *frameReader) readFrame() (frameType, flags byte, streamID protocol.QuicStreamID, payload []byte, err error) {
+	var header [FRAME_HEADER_SIZE]byte
+
+	if _, err = io.ReadFull(this.r, header[:]); err != nil {
+		return
+	}
+	length := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+	if length > this.maxBlockLen {
+		err = ErrInvalidFrame
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(this.r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	return header[3], header[4], protocol.QuicStreamID(binary.BigEndian.Uint32(header[5:]) & 0x7fffffff), payload, nil
+}
+
+// removePadding removes the padding of a frame with the PADDED flag.
+func removePadding(flags byte, payload []byte) ([]byte, error) {
+	if flags&FLAG_PADDED == 0 {
+		return payload, nil
+	}
+	if len(payload) < 1 || int(payload[0]) >= len(payload) {
+		return nil, ErrInvalidFrame
+	}
+	return payload[1 : len(payload)-int(payload[0])], nil
+}
+
+// frameWriter writes the HEADERS frames on the headers stream, from any goroutine: the header blocks are encoded and
+// written in the same order.
+type frameWriter struct {
+	mutex   sync.Mutex
+	w       io.Writer
+	encoder *hpack.Encoder
+	buffer  []byte
+}
+
+func newFrameWriter(w io.Writer) *frameWriter {
+	return &frameWriter{w: w, encoder: hpack.NewEncoder()}
+}
+
+// WriteHeaders writes the header list in a HEADERS frame followed by CONTINUATION frames if needed.
+func (this *frameWriter) WriteHeaders(streamID protocol.QuicStreamID, fields []hpack.HeaderField, endStream bool) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	block := this.encoder.AppendHeaderBlock(nil, fields)
+	b := this.buffer[:0]
+	frameType := byte(FRAMETYPE_HEADERS)
+	for first := true; first || len(block) > 0; first = false {
+		n := len(block)
+		if n > MAX_FRAME_SIZE {
+			n = MAX_FRAME_SIZE
+		}
+		var flags byte
+		if first && endStream {
+			flags |= FLAG_END_STREAM
+		}
+		if n == len(block) {
+			flags |= FLAG_END_HEADERS
+		}
+		b = append(b, byte(n>>16), byte(n>>8), byte(n), frameType, flags, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(b[len(b)-4:], uint32(streamID))
+		b = append(b, block[:n]...)
+		block = block[n:]
+		frameType = FRAMETYPE_CONTINUATION
+	}
+	this.buffer = b
+	_, err := this.w.Write(b)
+	return err
+}
@@ -0,0 +1,234 @@
+package h2quic
+
+import "github.com/romain-jacotin/quic"
+import "github.com/romain-jacotin/quic/protocol"
+import "context"
+import "errors"
+import "io"
+import "net"
+import "net/http"
+import "sync"
+
+// ErrUnsupportedScheme is returned by RoundTrip for a URL whose scheme is not https.
+var ErrUnsupportedScheme = errors.New("RoundTripper.RoundTrip : only the https URLs are supported")
+
+// RoundTripper is the http.RoundTripper of the https URLs over QUIC: the requests to the same host and port share a session.
+type RoundTripper struct {
+	// Config is the config of the sessions dialed, nil for the default config
+	Config *quic.Config
+	// Dial dials the session of a host, quic.DialContext if nil
+	Dial func(ctx context.Context, addr string, config *quic.Config) (quic.Session, error)
+	// MaxHeaderBytes is the maximum size of the header lists of the responses, DEFAULT_MAX_HEADER_BYTES if 0
+	MaxHeaderBytes int
+
+	mutex sync.Mutex
+	conns map[string]*clientConn
+}
+
+// clientConn is the conn of a host and port, dialed by its first request.
+type clientConn struct {
+	dialed chan struct{}
+	conn   *conn
+	err    error
+}
+
+// RoundTrip sends the request on a new data stream and returns the response once its headers are received.
+//
+// The body of the response is read from the data stream, closing it before its end resets the stream. The context of
+// the request resets the stream when it is done before the headers of the response.
+func (this *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL == nil || req.URL.Scheme != "https" || req.URL.Host == "" {
+		closeRequestBody(req)
+		return nil, ErrUnsupportedScheme
+	}
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr = net.JoinHostPort(req.URL.Hostname(), "443")
+	}
+	ctx := req.Context()
+	c, err := this.getConn(ctx, addr)
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+	stream, err := c.session.OpenStreamSync(ctx)
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+	id := stream.GetStreamID()
+	state := c.addStream(id)
+	if state == nil {
+		closeRequestBody(req)
+		stream.Reset(ERRORCODE_CANCEL)
+		return nil, c.closeErr()
+	}
+	if err = c.writer.WriteHeaders(id, requestHeaders(req), len(req.Trailer) == 0); err != nil {
+		closeRequestBody(req)
+		c.close(err)
+		return nil, err
+	}
+	if (req.Body != nil && req.Body != http.NoBody) || len(req.Trailer) > 0 {
+		go writeRequestBody(c, stream, req)
+	} else {
+		stream.CloseWrite()
+	}
+
+	b := &body{conn: c, stream: stream, state: state}
+	first := b.startFirstRead()
+	for {
+		select {
+		case f := <-state.blocks:
+			if isInformational(f.Fields) {
+				continue
+			}
+			res, err := responseFromHeaders(f.Fields)
+			if err != nil {
+				c.removeStream(id)
+				stream.Reset(protocol.QUIC_INVALID_HEADER_ID)
+				return nil, err
+			}
+			b.endStream = f.EndStream
+			b.trailer = &res.Trailer
+			res.Body = b
+			res.Request = req
+			return res, nil
+		case r := <-first:
+			// The data of the response can arrive before its headers, but not a reset
+			if r.err != nil && r.err != io.EOF {
+				c.removeStream(id)
+				return nil, r.err
+			}
+			first = nil
+		case <-ctx.Done():
+			c.removeStream(id)
+			stream.Reset(ERRORCODE_CANCEL)
+			return nil, protocol.ContextError{Op: "RoundTripper.RoundTrip", Err: ctx.Err()}
+		case <-c.done:
+			return nil, c.closeErr()
+		}
+	}
+}
+
+// Close closes the sessions of the RoundTripper, their requests in progress fail with ErrConnClosed.
+func (this *RoundTripper) Close() error {
+	this.mutex.Lock()
+	conns := this.conns
+	this.conns = nil
+	this.mutex.Unlock()
+	for _, cc := range conns {
+		select {
+		case <-cc.dialed:
+			if cc.conn != nil {
+				cc.conn.close(nil)
+			}
+		default:
+			// The session being dialed is closed by getConn
+		}
+	}
+	return nil
+}
+
+// getConn returns the conn of the address, it dials a new session if there is none or if it is closed.
+func (this *RoundTripper) getConn(ctx context.Context, addr string) (*conn, error) {
+	this.mutex.Lock()
+	if this.conns == nil {
+		this.conns = make(map[string]*clientConn)
+	}
+	cc := this.conns[addr]
+	if cc != nil {
+		select {
+		case <-cc.dialed:
+			if cc.err != nil || cc.conn.closeErr() != nil {
+				cc = nil
+			}
+		default:
+		}
+	}
+	dial := cc == nil
+	if dial {
+		cc = &clientConn{dialed: make(chan struct{})}
+		this.conns[addr] = cc
+	}
+	this.mutex.Unlock()
+
+	if !dial {
+		select {
+		case <-cc.dialed:
+			return cc.conn, cc.err
+		case <-ctx.Done():
+			return nil, protocol.ContextError{Op: "RoundTripper.RoundTrip", Err: ctx.Err()}
+		}
+	}
+	cc.conn, cc.err = this.dial(ctx, addr)
+	this.mutex.Lock()
+	if cc.err == nil && this.conns[addr] != cc {
+		// Closed by Close during the dial
+		cc.conn.close(nil)
+		cc.conn, cc.err = nil, ErrConnClosed
+	}
+	close(cc.dialed)
+	this.mutex.Unlock()
+	return cc.conn, cc.err
+}
+
+// dial dials the session of the address, and starts the goroutine that reads its headers stream.
+func (this *RoundTripper) dial(ctx context.Context, addr string) (*conn, error) {
+	dial := this.Dial
+	if dial == nil {
+		dial = quic.DialContext
+	}
+	s, err := dial(ctx, addr, this.Config)
+	if err != nil {
+		return nil, err
+	}
+	c := newConn(s, maxHeaderBytes(this.MaxHeaderBytes))
+	go func() {
+		for {
+			f, err := c.reader.ReadHeaders()
+			if err != nil {
+				c.close(err)
+				return
+			}
+			// The HEADERS frames of an unknown stream, or after the trailers, are ignored
+			if state := c.getStream(f.StreamID); state != nil {
+				state.deliver(f)
+			}
+		}
+	}()
+	return c, nil
+}
+
+// writeRequestBody writes the body of the request on the data stream, then its trailers and the FIN.
+func writeRequestBody(c *conn, stream quic.Stream, req *http.Request) {
+	if req.Body != nil {
+		_, err := io.Copy(stream, req.Body)
+		req.Body.Close()
+		if err != nil {
+			stream.Reset(ERRORCODE_CANCEL)
+			return
+		}
+	}
+	if len(req.Trailer) > 0 {
+		if err := c.writer.WriteHeaders(stream.GetStreamID(), trailerHeaders(req.Trailer), true); err != nil {
+			c.close(err)
+			return
+		}
+	}
+	stream.CloseWrite()
+}
+
+// closeRequestBody closes the body of a request that is not sent, like the http.RoundTripper must do.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// maxHeaderBytes returns the maximum size of the header lists, DEFAULT_MAX_HEADER_BYTES if n is 0.
+func maxHeaderBytes(n int) int {
+	if n <= 0 {
+		return DEFAULT_MAX_HEADER_BYTES
+	}
+	return n
+}
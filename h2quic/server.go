@@ -0,0 +1,278 @@
+package h2quic
+
+import "github.com/romain-jacotin/quic"
+import "github.com/romain-jacotin/quic/protocol"
+import "context"
+import "fmt"
+import "log"
+import "net"
+import "net/http"
+import "runtime/debug"
+import "strconv"
+import "strings"
+
+// RESPONSE_BUFFER_SIZE is the size of the response buffered before its headers are sent: a response that fits is sent
+// with a Content-Length, and its Content-Type is sniffed from the buffer.
+const RESPONSE_BUFFER_SIZE = 4096
+
+// Server serves the requests of QUIC sessions with an http.Handler, each request in its goroutine.
+type Server struct {
+	// Handler is the handler of the requests, http.DefaultServeMux if nil
+	Handler http.Handler
+	// MaxHeaderBytes is the maximum size of the header lists of the requests, DEFAULT_MAX_HEADER_BYTES if 0
+	MaxHeaderBytes int
+	// ErrorLog logs the panics of the handler, the standard logger if nil
+	ErrorLog *log.Logger
+}
+
+// ListenAndServe listens on the UDP address and serves the requests of its sessions with the handler.
+func ListenAndServe(addr string, config *quic.Config, handler http.Handler) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+	l, err := quic.Listen(pc, config)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return (&Server{Handler: handler}).Serve(l)
+}
+
+// Serve serves the sessions accepted by the listener, it returns the error of Accept.
+func (this *Server) Serve(l quic.Listener) error {
+	for {
+		s, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go this.ServeSession(s)
+	}
+}
+
+// ServeSession serves the requests of the session, it returns when the session or its headers stream is closed.
+func (this *Server) ServeSession(s quic.Session) {
+	c := newConn(s, maxHeaderBytes(this.MaxHeaderBytes))
+	go c.acceptStreams()
+	var largest protocol.QuicStreamID
+	for {
+		f, err := c.reader.ReadHeaders()
+		if err != nil {
+			c.close(err)
+			return
+		}
+		if state := c.getStream(f.StreamID); state != nil {
+			state.deliver(f)
+			continue
+		}
+		// A new request is on a new data stream of the client, the HEADERS frames of the finished requests are ignored
+		if f.StreamID&1 == 0 || f.StreamID <= largest || f.StreamID < protocol.QuicStreamID(5) {
+			continue
+		}
+		largest = f.StreamID
+		state := c.addStream(f.StreamID)
+		if state == nil {
+			return
+		}
+		go this.serveRequest(c, f, state)
+	}
+}
+
+// serveRequest runs the handler of the request of the HEADERS frame, once its data stream is accepted.
+func (this *Server) serveRequest(c *conn, f *headersFrame, state *streamState) {
+	stream, err := c.waitStream(f.StreamID)
+	if err != nil {
+		return
+	}
+	defer c.removeStream(f.StreamID)
+	req, err := requestFromHeaders(f.Fields)
+	if err != nil {
+		stream.Reset(protocol.QUIC_INVALID_HEADER_ID)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), http.LocalAddrContextKey, c.session.LocalAddr()))
+	defer cancel()
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	req = req.WithContext(ctx)
+	req.RemoteAddr = c.session.RemoteAddr().String()
+	b := &body{conn: c, stream: stream, state: state, endStream: f.EndStream, trailer: &req.Trailer, server: true}
+	req.Body = b
+	w := &responseWriter{conn: c, stream: stream, header: make(http.Header), head: req.Method == http.MethodHead}
+
+	defer func() {
+		if err := recover(); err != nil {
+			if err != http.ErrAbortHandler {
+				this.logf("h2quic : panic serving %v : %v\n%s", req.RemoteAddr, err, debug.Stack())
+			}
+			stream.Reset(protocol.QUIC_INTERNAL_ERROR)
+		}
+	}()
+	handler := this.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	handler.ServeHTTP(w, req)
+	if err = w.finish(); err != nil {
+		stream.Reset(protocol.QUIC_INTERNAL_ERROR)
+	}
+	// The rest of the request body is discarded
+	b.Close()
+}
+
+func (this *Server) logf(format string, args ...interface{}) {
+	if this.ErrorLog != nil {
+		this.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// responseWriter is the http.ResponseWriter of a request: the headers are sent on the headers stream with the first
+// data beyond RESPONSE_BUFFER_SIZE, on Flush or when the handler returns.
+type responseWriter struct {
+	conn   *conn
+	stream quic.Stream
+	header http.Header
+	head   bool
+
+	status      int
+	wroteHeader bool
+	headersSent bool
+	// endStream is true if the headers were sent with the END_STREAM flag, without trailers
+	endStream bool
+	buf       []byte
+}
+
+// Header returns the header of the response, and of the trailers declared with the Trailer key or http.TrailerPrefix.
+func (this *responseWriter) Header() http.Header {
+	return this.header
+}
+
+// WriteHeader sets the status of the response, the informational status codes 1xx are sent at once.
+func (this *responseWriter) WriteHeader(code int) {
+	if code < 100 || code > 999 {
+		panic(fmt.Sprintf("invalid WriteHeader code %v", code))
+	}
+	if this.wroteHeader {
+		return
+	}
+	if code < 200 {
+		this.conn.writer.WriteHeaders(this.stream.GetStreamID(), responseHeaders(code, this.header), false)
+		return
+	}
+	this.wroteHeader = true
+	this.status = code
+}
+
+// Write writes the data of the body, it returns http.ErrBodyNotAllowed for a status without body.
+func (this *responseWriter) Write(p []byte) (int, error) {
+	if !this.wroteHeader {
+		this.WriteHeader(http.StatusOK)
+	}
+	if !bodyAllowed(this.status) {
+		return 0, http.ErrBodyNotAllowed
+	}
+	if this.head {
+		return len(p), nil
+	}
+	if !this.headersSent {
+		if len(this.buf)+len(p) <= RESPONSE_BUFFER_SIZE {
+			this.buf = append(this.buf, p...)
+			return len(p), nil
+		}
+		if err := this.sendHeaders(false); err != nil {
+			return 0, err
+		}
+	}
+	return this.stream.Write(p)
+}
+
+// Flush sends the headers and the data buffered.
+func (this *responseWriter) Flush() {
+	if !this.wroteHeader {
+		this.WriteHeader(http.StatusOK)
+	}
+	if !this.headersSent {
+		this.sendHeaders(false)
+	}
+}
+
+// sendHeaders sends the headers of the response, then the data buffered.
+func (this *responseWriter) sendHeaders(endStream bool) error {
+	this.headersSent = true
+	this.endStream = endStream
+	if _, ok := this.header["Content-Type"]; !ok && len(this.buf) > 0 {
+		this.header.Set("Content-Type", http.DetectContentType(this.buf))
+	}
+	if err := this.conn.writer.WriteHeaders(this.stream.GetStreamID(), responseHeaders(this.status, this.header), endStream); err != nil {
+		this.conn.close(err)
+		return err
+	}
+	if len(this.buf) > 0 {
+		_, err := this.stream.Write(this.buf)
+		this.buf = nil
+		return err
+	}
+	return nil
+}
+
+// finish sends the end of the response once the handler returns: the headers if they are not sent, the trailers, and the FIN.
+func (this *responseWriter) finish() error {
+	if !this.wroteHeader {
+		this.WriteHeader(http.StatusOK)
+	}
+	trailer := this.trailers()
+	if !this.headersSent {
+		if _, ok := this.header["Content-Length"]; !ok && bodyAllowed(this.status) && !this.head {
+			this.header.Set("Content-Length", strconv.Itoa(len(this.buf)))
+		}
+		if err := this.sendHeaders(trailer == nil); err != nil {
+			return err
+		}
+	}
+	if !this.endStream {
+		if err := this.conn.writer.WriteHeaders(this.stream.GetStreamID(), trailerHeaders(trailer), true); err != nil {
+			this.conn.close(err)
+			return err
+		}
+	}
+	return this.stream.CloseWrite()
+}
+
+// trailers returns the trailers of the response, nil if it declares none.
+func (this *responseWriter) trailers() http.Header {
+	var trailer http.Header
+	for _, v := range this.header["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			if k = http.CanonicalHeaderKey(strings.TrimSpace(k)); k != "" {
+				if trailer == nil {
+					trailer = make(http.Header)
+				}
+				if values, ok := this.header[k]; ok {
+					trailer[k] = values
+				}
+			}
+		}
+	}
+	for k, values := range this.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			if trailer == nil {
+				trailer = make(http.Header)
+			}
+			trailer[http.CanonicalHeaderKey(k[len(http.TrailerPrefix):])] = values
+		}
+	}
+	return trailer
+}
+
+// bodyAllowed returns true if a response with the status has a body.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,372 @@
+package handshake
+
+import "github.com/romain-jacotin/quic/crypto"
+import "github.com/romain-jacotin/quic/protocol"
+import "crypto/rand"
+import "encoding/binary"
+import "io"
+import "time"
+
+// MAX_CLIENT_HELLO_REJECTS is the number of REJ messages accepted by the client, the next one fails the handshake.
+const MAX_CLIENT_HELLO_REJECTS = 3
+
+// CryptoClient runs the client side of the crypto handshake on the crypto stream:
+//
+//	inchoate CHLO  ----------------->
+//	               <-----------------  REJ (SCFG, STK, SNO, CRT, PROF)
+//	full CHLO      ----------------->                                   initial keys
+//	               <-----------------  SHLO (PUBS, STK)                 forward-secure keys
+//
+// A REJ after the full CHLO, with a new source-address token or server config, is answered with a new full CHLO and new initial keys.
+// An expired server config is requested again with an inchoate CHLO.
+// With the cached state of a previous connection, the full CHLO is sent at once and the initial keys protect the 0-RTT data.
+// The session cache gives the state of the server and stores the new one after the SHLO, a REJ for an expired or unknown
+// server config removes it.
+// The certificate chain and the proof of the server config are verified before the full CHLO, without ProofVerifier they aren't.
+// The full CHLO proposes the parameters and the application protocols of the client, the SHLO returns the parameters
+// and the application protocol chosen by the server.
+type CryptoClient struct {
+	stream         io.ReadWriter
+	connID         protocol.QuicConnectionID
+	hostname       string
+	version        protocol.QuicVersion
+	initialVersion protocol.QuicVersion
+	params         NegotiatedParams
+	verifier       *ProofVerifier
+	keyHandler     KeyHandler
+	sessionCache   ClientSessionCache
+	keyLog         io.Writer
+	aeads          []protocol.MessageTag
+
+	serverConfig *ServerConfig
+	stk          []byte
+	certChain    [][]byte
+	proof        []byte
+	serverNonce  []byte
+	nonce        []byte
+	kex          crypto.KeyExchange
+	aead         protocol.MessageTag
+	chlo         []byte
+	lastCHLO     []byte
+	chlos        int
+	rejects      int
+}
+
+// NewCryptoClient returns the CryptoClient of the connection, initialVersion is the version proposed before the version negotiation.
+// The verifier checks the proofs of the server for the hostname, nil trusts any server. The zero parameters are set to their default value.
+func NewCryptoClient(stream io.ReadWriter, connID protocol.QuicConnectionID, hostname string, version, initialVersion protocol.QuicVersion,
+	params NegotiatedParams, verifier *ProofVerifier, keyHandler KeyHandler) *CryptoClient {
+	params.ApplyDefaults()
+	return &CryptoClient{
+		stream:         stream,
+		connID:         connID,
+		hostname:       hostname,
+		version:        version,
+		initialVersion: initialVersion,
+		params:         params,
+		verifier:       verifier,
+		keyHandler:     keyHandler,
+		aeads:          SupportedAEADs()}
+}
+
+// SetAEADs sets the AEADs of the client in its order of preference before Run, the first one supported by the server is selected.
+func (this *CryptoClient) SetAEADs(aeads []protocol.MessageTag) {
+	if len(aeads) > 0 {
+		this.aeads = aeads
+	}
+}
+
+// SetSessionCache sets the cache of the states of the servers before Run.
+func (this *CryptoClient) SetSessionCache(cache ClientSessionCache) {
+	this.sessionCache = cache
+}
+
+// SetKeyLogWriter sets the writer of the keys derived by the handshake before Run, in the format of writeKeyLog.
+func (this *CryptoClient) SetKeyLogWriter(w io.Writer) {
+	this.keyLog = w
+}
+
+// SetSessionState sets the state of a previous connection to the server before Run: the full CHLO is sent without inchoate CHLO
+// while the server config is unexpired. The state of the session cache is used otherwise.
+func (this *CryptoClient) SetSessionState(state *ClientSessionState) {
+	this.serverConfig = state.ServerConfig
+	this.stk = state.SourceAddressToken
+	this.certChain = state.CertificateChain
+	this.proof = state.Proof
+	this.serverNonce = state.ServerNonce
+}
+
+// GetSessionState returns the state to resume the next connection to the server, nil before the first REJ.
+func (this *CryptoClient) GetSessionState() *ClientSessionState {
+	if this.serverConfig == nil {
+		return nil
+	}
+	return &ClientSessionState{
+		ServerConfig:       this.serverConfig,
+		SourceAddressToken: this.stk,
+		CertificateChain:   this.certChain,
+		Proof:              this.proof,
+		ServerNonce:        this.serverNonce}
+}
+
+// Run runs the handshake until the forward-secure keys are installed, or returns the error that aborts the connection.
+func (this *CryptoClient) Run() error {
+	var err error
+	if this.serverConfig == nil && this.sessionCache != nil {
+		if state, ok := this.sessionCache.Get(this.hostname); ok {
+			this.SetSessionState(state)
+		}
+	}
+	if this.serverConfig != nil && time.Now().Before(this.serverConfig.expiry) {
+		err = this.sendFullCHLO()
+	} else {
+		if this.serverConfig != nil {
+			this.invalidateSessionState()
+		}
+		this.serverConfig = nil
+		err = this.sendInchoateCHLO()
+	}
+	if err != nil {
+		return err
+	}
+	for {
+		msg, err := readMessage(this.stream)
+		if err != nil {
+			return err
+		}
+		switch msg.GetMessageTag() {
+		case protocol.TagREJ:
+			if this.rejects++; this.rejects > MAX_CLIENT_HELLO_REJECTS {
+				return ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_TOO_MANY_REJECTS, Reason: "CHLO rejected too many times"}
+			}
+			if err = this.handleREJ(msg); err != nil {
+				return err
+			}
+		case protocol.TagSHLO:
+			if this.chlo == nil {
+				return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_TYPE, Reason: "SHLO before the full CHLO"}
+			}
+			return this.handleSHLO(msg)
+		default:
+			return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_TYPE, Reason: "unexpected " + tagString(msg.GetMessageTag())}
+		}
+	}
+}
+
+// newCHLO returns a CHLO with the tags common to the inchoate and full CHLO.
+func (this *CryptoClient) newCHLO() *protocol.HandshakeMessage {
+	var vers [4]byte
+
+	binary.LittleEndian.PutUint32(vers[:], uint32(this.initialVersion))
+	msg := protocol.NewHandshakeMessage(protocol.TagCHLO)
+	msg.SetTag(protocol.TagVERS, vers[:])
+	msg.SetTag(protocol.TagSNI, []byte(this.hostname))
+	msg.SetTag(protocol.TagPDMD, tagList(protocol.TagX509))
+	if this.stk != nil {
+		msg.SetTag(protocol.TagSTK, this.stk)
+	}
+	// No CCS tag: the certificates of the common certificate sets aren't supported by DecompressChain
+	if len(this.certChain) > 0 {
+		hashes := make([]byte, 0, 8*len(this.certChain))
+		for _, cert := range this.certChain {
+			hashes = binary.LittleEndian.AppendUint64(hashes, crypto.CertHash(cert))
+		}
+		msg.SetTag(protocol.TagCCRT, hashes)
+	}
+	return msg
+}
+
+// writeCHLO pads the CHLO to CLIENT_HELLO_MINIMUM_SIZE and writes it, the proof of the next REJ signs it.
+func (this *CryptoClient) writeCHLO(msg *protocol.HandshakeMessage) (b []byte, err error) {
+	if size := msg.GetSerializedSize() + 8; size < CLIENT_HELLO_MINIMUM_SIZE {
+		msg.SetTag(protocol.TagPAD, make([]byte, CLIENT_HELLO_MINIMUM_SIZE-size))
+	}
+	b, err = writeMessage(this.stream, msg)
+	this.lastCHLO = b
+	this.chlos++
+	return
+}
+
+// sendInchoateCHLO asks for the server config.
+func (this *CryptoClient) sendInchoateCHLO() error {
+	_, err := this.writeCHLO(this.newCHLO())
+	return err
+}
+
+// handleREJ reads the server config and the source-address token, sends the full CHLO and installs the initial keys.
+// The server config of a previous REJ is kept if the REJ has none, an expired one is requested again.
+func (this *CryptoClient) handleREJ(msg *protocol.HandshakeMessage) error {
+	if stk, ok := msg.GetTag(protocol.TagSTK); ok {
+		this.stk = stk
+	}
+	if crt, ok := msg.GetTag(protocol.TagCRT); ok {
+		cached := make(map[uint64][]byte, len(this.certChain))
+		for _, cert := range this.certChain {
+			cached[crypto.CertHash(cert)] = cert
+		}
+		chain, err := crypto.DecompressChain(crt, cached)
+		if err != nil {
+			return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: err.Error()}
+		}
+		this.certChain = chain
+	}
+	this.proof, _ = msg.GetTag(protocol.TagPROF)
+	this.serverNonce, _ = msg.GetTag(protocol.TagSNO)
+	if containsRejectReason(msg, REJECT_UNKNOWN_SERVER_CONFIG) {
+		this.invalidateSessionState()
+	}
+	if scfg, ok := msg.GetTag(protocol.TagSCFG); ok {
+		config, err := ParseServerConfig(scfg)
+		if err != nil {
+			return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: err.Error()}
+		}
+		this.serverConfig = config
+	}
+	if this.serverConfig == nil {
+		return ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_MESSAGE_PARAMETER_NOT_FOUND, Reason: "missing tag \"SCFG\""}
+	}
+	if !time.Now().Before(this.serverConfig.expiry) {
+		this.invalidateSessionState()
+		this.serverConfig, this.chlo = nil, nil
+		return this.sendInchoateCHLO()
+	}
+	if this.verifier != nil {
+		if this.proof == nil {
+			return ErrProofInvalid{Reason: "missing proof of the server config"}
+		}
+		if err := this.verifier.VerifyProof(this.hostname, this.certChain, this.proof, this.lastCHLO, this.serverConfig.serialized); err != nil {
+			return err
+		}
+	}
+	return this.sendFullCHLO()
+}
+
+// sendFullCHLO sends the full CHLO of the server config and installs the initial keys.
+func (this *CryptoClient) sendFullCHLO() error {
+	var err error
+	this.aead = 0
+	for _, t := range this.aeads {
+		if containsTag(this.serverConfig.aeads, t) {
+			this.aead = t
+			break
+		}
+	}
+	if this.aead == 0 {
+		return ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_MESSAGE_PARAMETER_NO_OVERLAP, Reason: "no common AEAD"}
+	}
+	kexs := selectKeyExchange(this.serverConfig.kexs)
+	_, pub := this.serverConfig.keyExchange(kexs)
+	if err, this.kex = crypto.NewKeyExchange(kexs); err != nil {
+		return err
+	}
+	premaster, err := this.kex.ComputeSharedSecret(pub)
+	if err != nil {
+		return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: err.Error()}
+	}
+
+	// Client nonce: timestamp, orbit of the server config and random bytes
+	this.nonce = make([]byte, NONCE_SIZE)
+	binary.BigEndian.PutUint32(this.nonce, uint32(time.Now().Unix()))
+	copy(this.nonce[4:], this.serverConfig.orbit)
+	if _, err = io.ReadFull(rand.Reader, this.nonce[12:]); err != nil {
+		return err
+	}
+
+	chlo := this.newCHLO()
+	chlo.SetTag(protocol.TagSCID, this.serverConfig.id)
+	chlo.SetTag(protocol.TagKEXS, tagList(kexs))
+	chlo.SetTag(protocol.TagAEAD, tagList(this.aead))
+	chlo.SetTag(protocol.TagPUBS, encodePublicValue(this.kex.PublicKey()))
+	chlo.SetTag(protocol.TagNONC, this.nonce)
+	setParams(chlo, this.params)
+	if this.serverNonce != nil {
+		chlo.SetTag(protocol.TagSNO, this.serverNonce)
+	}
+	if this.chlo, err = this.writeCHLO(chlo); err != nil {
+		return err
+	}
+	keys, err := deriveKeys(protocol.PERSPECTIVE_CLIENT, protocol.ENCRYPTION_INITIAL, this.aead, premaster, this.nonce, this.serverNonce,
+		this.connID, this.chlo, this.serverConfig.serialized, nil, this.keyLog)
+	if err != nil {
+		return err
+	}
+	this.keyHandler.OnKeys(keys)
+	return nil
+}
+
+// handleSHLO installs the forward-secure keys computed with the ephemeral public value of the server, with the negotiated parameters.
+// The SHLO can renew the source-address token.
+func (this *CryptoClient) handleSHLO(msg *protocol.HandshakeMessage) error {
+	if stk, ok := msg.GetTag(protocol.TagSTK); ok {
+		this.stk = stk
+	}
+	pubs, err := requireTag(msg, protocol.TagPUBS)
+	if err != nil {
+		return err
+	}
+	var peer NegotiatedParams
+	if err = peer.ParseFromSHLO(msg); err != nil {
+		return err
+	}
+	params := this.params.negotiate(peer)
+	if params.NegotiatedProtocol != "" && !containsProtocol(this.params.NextProtos, params.NegotiatedProtocol) {
+		return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_NEGOTIATED_VALUE, Reason: "application protocol not proposed"}
+	}
+	pub, err := decodePublicValue(pubs)
+	if err != nil {
+		return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: err.Error()}
+	}
+	premaster, err := this.kex.ComputeSharedSecret(pub)
+	if err != nil {
+		return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: err.Error()}
+	}
+	keys, err := deriveKeys(protocol.PERSPECTIVE_CLIENT, protocol.ENCRYPTION_FORWARD_SECURE, this.aead, premaster, this.nonce, this.serverNonce,
+		this.connID, this.chlo, this.serverConfig.serialized, nil, this.keyLog)
+	if err != nil {
+		return err
+	}
+	keys.Params = params
+	if this.sessionCache != nil {
+		this.sessionCache.Put(this.hostname, this.GetSessionState())
+	}
+	this.keyHandler.OnKeys(keys)
+	return nil
+}
+
+// invalidateSessionState removes the state of the server from the session cache.
+func (this *CryptoClient) invalidateSessionState() {
+	if this.sessionCache != nil {
+		this.sessionCache.Put(this.hostname, nil)
+	}
+}
+
+// containsRejectReason returns true if the reason is in the RREJ tag of the REJ.
+func containsRejectReason(rej *protocol.HandshakeMessage, reason RejectReason) bool {
+	rrej, _ := rej.GetTag(protocol.TagRREJ)
+	for ; len(rrej) >= 4; rrej = rrej[4:] {
+		if RejectReason(binary.LittleEndian.Uint32(rrej)) == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// GetServerConfig returns the server config of the last REJ, nil before.
+func (this *CryptoClient) GetServerConfig() *ServerConfig {
+	return this.serverConfig
+}
+
+// GetSourceAddressToken returns the last source-address token (STK) received from the server, nil before.
+func (this *CryptoClient) GetSourceAddressToken() []byte {
+	return this.stk
+}
+
+// GetCertificateChain returns the DER certificates of the chain (CRT) and the proof of the server config (PROF) of the last REJ.
+func (this *CryptoClient) GetCertificateChain() (chain [][]byte, proof []byte) {
+	return this.certChain, this.proof
+}
+
+// GetClientHellosSent returns the number of CHLO messages sent, a single one when the cached server config is accepted.
+func (this *CryptoClient) GetClientHellosSent() int {
+	return this.chlos
+}
@@ -0,0 +1,295 @@
+package handshake
+
+import "github.com/romain-jacotin/quic/crypto"
+import "github.com/romain-jacotin/quic/protocol"
+import "crypto/rand"
+import "encoding/binary"
+import "io"
+import "net"
+import "time"
+
+// RejectReason is a reason of a REJ message, sent in its RREJ tag.
+type RejectReason uint32
+
+const (
+	// REJECT_INCHOATE_HELLO is the reason of a CHLO without server config ID
+	REJECT_INCHOATE_HELLO RejectReason = iota + 1
+	// REJECT_UNKNOWN_SERVER_CONFIG is the reason of a CHLO with the ID of another server config
+	REJECT_UNKNOWN_SERVER_CONFIG
+	// REJECT_SOURCE_ADDRESS_TOKEN_MISSING is the reason of a CHLO without source-address token
+	REJECT_SOURCE_ADDRESS_TOKEN_MISSING
+	// REJECT_SOURCE_ADDRESS_TOKEN_INVALID is the reason of a CHLO with a source-address token that can't be opened
+	REJECT_SOURCE_ADDRESS_TOKEN_INVALID
+	// REJECT_SOURCE_ADDRESS_TOKEN_EXPIRED is the reason of a CHLO with an expired source-address token
+	REJECT_SOURCE_ADDRESS_TOKEN_EXPIRED
+	// REJECT_SOURCE_ADDRESS_TOKEN_DIFFERENT_ADDRESS is the reason of a CHLO with the source-address token of another address
+	REJECT_SOURCE_ADDRESS_TOKEN_DIFFERENT_ADDRESS
+	// REJECT_CLIENT_NONCE_INVALID is the reason of a CHLO with a client nonce of another orbit or out of the strike register window
+	REJECT_CLIENT_NONCE_INVALID
+	// REJECT_CLIENT_NONCE_NOT_UNIQUE is the reason of a replayed CHLO
+	REJECT_CLIENT_NONCE_NOT_UNIQUE
+)
+
+// CryptoServer runs the server side of the crypto handshake on the crypto stream: a CHLO that doesn't prove the address
+// of the client with a valid source-address token, or that isn't for the server config, is answered with a REJ.
+// A full CHLO installs the initial and forward-secure keys and is answered with a SHLO, a replayed full CHLO is rejected.
+//
+// The REJ carries the current server config, a new source-address token, the certificate chain and the proof of the server config.
+// A full CHLO can be for any server config known by the ServerConfigs, like the previous one during a rotation.
+// The SHLO returns the parameters negotiated from those of the CHLO and of the server, and the application protocol selected
+// among those of the client: a CHLO without any application protocol of the server fails with ErrNoApplicationProtocol.
+type CryptoServer struct {
+	stream            io.ReadWriter
+	connID            protocol.QuicConnectionID
+	clientAddr        net.Addr
+	version           protocol.QuicVersion
+	supportedVersions []protocol.QuicVersion
+	serverConfigs     ServerConfigs
+	params            NegotiatedParams
+	keyHandler        KeyHandler
+	keyLog            io.Writer
+}
+
+// NewCryptoServer returns the CryptoServer of the connection of the client address and of the version,
+// the supported versions detect the downgrades. The zero parameters are set to their default value.
+func NewCryptoServer(stream io.ReadWriter, connID protocol.QuicConnectionID, clientAddr net.Addr, version protocol.QuicVersion,
+	supportedVersions []protocol.QuicVersion, serverConfigs ServerConfigs, params NegotiatedParams, keyHandler KeyHandler) *CryptoServer {
+	params.ApplyDefaults()
+	return &CryptoServer{
+		stream:            stream,
+		connID:            connID,
+		clientAddr:        clientAddr,
+		version:           version,
+		supportedVersions: supportedVersions,
+		serverConfigs:     serverConfigs,
+		params:            params,
+		keyHandler:        keyHandler}
+}
+
+// SetKeyLogWriter sets the writer of the keys derived by the handshake before Run, in the format of writeKeyLog.
+func (this *CryptoServer) SetKeyLogWriter(w io.Writer) {
+	this.keyLog = w
+}
+
+// Run runs the handshake until the SHLO is sent, or returns the error that aborts the connection.
+func (this *CryptoServer) Run() error {
+	for {
+		msg, err := readMessage(this.stream)
+		if err != nil {
+			return err
+		}
+		if msg.GetMessageTag() != protocol.TagCHLO {
+			return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_TYPE, Reason: "unexpected " + tagString(msg.GetMessageTag())}
+		}
+		if msg.GetSerializedSize() < CLIENT_HELLO_MINIMUM_SIZE {
+			return ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_INVALID_VALUE_LENGTH, Reason: "CHLO too small"}
+		}
+		if err = this.checkVersion(msg); err != nil {
+			return err
+		}
+		config, reason := this.rejectReason(msg)
+		if reason != 0 {
+			if err = this.sendREJ(msg, reason); err != nil {
+				return err
+			}
+			continue
+		}
+		return this.handleFullCHLO(msg, config)
+	}
+}
+
+// rejectReason returns the server config of a full CHLO, or the reason to reject the CHLO: the server config, the source-address token,
+// then the client nonce are checked. The client nonce of a full CHLO is inserted in the strike register of its server config.
+func (this *CryptoServer) rejectReason(msg *protocol.HandshakeMessage) (*ServerConfig, RejectReason) {
+	now := time.Now()
+	scid, ok := msg.GetTag(protocol.TagSCID)
+	if !ok {
+		return nil, REJECT_INCHOATE_HELLO
+	}
+	config := this.serverConfigs.Lookup(scid)
+	if config == nil {
+		return nil, REJECT_UNKNOWN_SERVER_CONFIG
+	}
+	stk, ok := msg.GetTag(protocol.TagSTK)
+	if !ok {
+		return nil, REJECT_SOURCE_ADDRESS_TOKEN_MISSING
+	}
+	switch config.tokens.ValidateToken(stk, this.clientAddr, now) {
+	case nil:
+	case ErrTokenExpired:
+		return nil, REJECT_SOURCE_ADDRESS_TOKEN_EXPIRED
+	case ErrTokenAddressMismatch:
+		return nil, REJECT_SOURCE_ADDRESS_TOKEN_DIFFERENT_ADDRESS
+	default:
+		return nil, REJECT_SOURCE_ADDRESS_TOKEN_INVALID
+	}
+	nonce, ok := msg.GetTag(protocol.TagNONC)
+	if !ok {
+		return nil, REJECT_CLIENT_NONCE_INVALID
+	}
+	if reason := config.strikes.Insert(nonce, now); reason != 0 {
+		return nil, reason
+	}
+	return config, 0
+}
+
+// checkVersion rejects a CHLO whose first proposed version is supported but was not chosen: the version negotiation was forged.
+func (this *CryptoServer) checkVersion(msg *protocol.HandshakeMessage) error {
+	vers, err := requireTag(msg, protocol.TagVERS)
+	if err != nil {
+		return err
+	}
+	if len(vers) != 4 {
+		return ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_INVALID_VALUE_LENGTH, Reason: "invalid VERS"}
+	}
+	proposed := protocol.QuicVersion(binary.LittleEndian.Uint32(vers))
+	if proposed == this.version {
+		return nil
+	}
+	for _, v := range this.supportedVersions {
+		if v == proposed {
+			return ErrHandshakeFailed{Code: protocol.QUIC_VERSION_NEGOTIATION_MISMATCH, Reason: "downgrade from " + proposed.String()}
+		}
+	}
+	return nil
+}
+
+// sendREJ sends the current server config, a new source-address token, a server nonce, the certificate chain and the proof
+// of the server config for the CHLO.
+func (this *CryptoServer) sendREJ(chlo *protocol.HandshakeMessage, reason RejectReason) error {
+	config := this.serverConfigs.Current()
+	sno := make([]byte, NONCE_SIZE)
+	if _, err := io.ReadFull(rand.Reader, sno); err != nil {
+		return err
+	}
+	stk, err := config.tokens.NewToken(this.clientAddr, time.Now())
+	if err != nil {
+		return err
+	}
+	proof, err := config.signer.SignProof(chlo.Serialize(), config.serialized)
+	if err != nil {
+		return err
+	}
+	msg := protocol.NewHandshakeMessage(protocol.TagREJ)
+	msg.SetTag(protocol.TagSCFG, config.serialized)
+	msg.SetTag(protocol.TagSTK, stk)
+	msg.SetTag(protocol.TagSNO, sno)
+	msg.SetTag(protocol.TagCRT, crypto.CompressChain(config.signer.GetCertificateChain(), cachedCertHashes(chlo)))
+	msg.SetTag(protocol.TagPROF, proof)
+	rrej := make([]byte, 4)
+	binary.LittleEndian.PutUint32(rrej, uint32(reason))
+	msg.SetTag(protocol.TagRREJ, rrej)
+	_, err = writeMessage(this.stream, msg)
+	return err
+}
+
+// cachedCertHashes returns the 64-bit hashes of the certificates cached by the client (CCRT), a trailing partial hash is ignored.
+func cachedCertHashes(chlo *protocol.HandshakeMessage) []uint64 {
+	ccrt, _ := chlo.GetTag(protocol.TagCCRT)
+	hashes := make([]uint64, len(ccrt)/8)
+	for i := range hashes {
+		hashes[i] = binary.LittleEndian.Uint64(ccrt[8*i:])
+	}
+	return hashes
+}
+
+// handleFullCHLO installs the initial keys of the server config, then the forward-secure keys of a new ephemeral key pair,
+// and sends the SHLO.
+func (this *CryptoServer) handleFullCHLO(msg *protocol.HandshakeMessage, config *ServerConfig) error {
+	kexsList, err := requireTag(msg, protocol.TagKEXS)
+	if err != nil {
+		return err
+	}
+	kexs := protocol.MessageTag(0)
+	if tags := parseTagList(kexsList); len(tags) == 1 {
+		kexs = tags[0]
+	}
+	kex, _ := config.keyExchange(kexs)
+	if kex == nil {
+		return ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_MESSAGE_PARAMETER_NO_OVERLAP, Reason: "key exchange of the server config expected"}
+	}
+	aeads, err := requireTag(msg, protocol.TagAEAD)
+	if err != nil {
+		return err
+	}
+	var aead protocol.MessageTag
+	for _, t := range parseTagList(aeads) {
+		if containsTag(config.aeads, t) {
+			aead = t
+			break
+		}
+	}
+	if aead == 0 {
+		return ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_MESSAGE_PARAMETER_NO_OVERLAP, Reason: "no common AEAD"}
+	}
+	nonce, err := requireTag(msg, protocol.TagNONC)
+	if err != nil {
+		return err
+	}
+	if len(nonce) != NONCE_SIZE {
+		return ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_INVALID_VALUE_LENGTH, Reason: "invalid NONC"}
+	}
+	pubs, err := requireTag(msg, protocol.TagPUBS)
+	if err != nil {
+		return err
+	}
+	pub, err := decodePublicValue(pubs)
+	if err != nil {
+		return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: err.Error()}
+	}
+	var peer NegotiatedParams
+	if err = peer.ParseFromCHLO(msg); err != nil {
+		return err
+	}
+	params := this.params.negotiate(peer)
+	if params.NegotiatedProtocol, err = this.params.selectProtocol(peer.NextProtos); err != nil {
+		return err
+	}
+	serverNonce, _ := msg.GetTag(protocol.TagSNO)
+	chlo := msg.Serialize()
+
+	premaster, err := kex.ComputeSharedSecret(pub)
+	if err != nil {
+		return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: err.Error()}
+	}
+	diversificationNonce := make([]byte, protocol.QUIC_DIVERSIFICATION_NONCE_SIZE)
+	if _, err = io.ReadFull(rand.Reader, diversificationNonce); err != nil {
+		return err
+	}
+	keys, err := deriveKeys(protocol.PERSPECTIVE_SERVER, protocol.ENCRYPTION_INITIAL, aead, premaster, nonce, serverNonce,
+		this.connID, chlo, config.serialized, diversificationNonce, this.keyLog)
+	if err != nil {
+		return err
+	}
+	this.keyHandler.OnKeys(keys)
+
+	err, ephemeral := crypto.NewKeyExchange(kexs)
+	if err != nil {
+		return err
+	}
+	if premaster, err = ephemeral.ComputeSharedSecret(pub); err != nil {
+		return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: err.Error()}
+	}
+	if keys, err = deriveKeys(protocol.PERSPECTIVE_SERVER, protocol.ENCRYPTION_FORWARD_SECURE, aead, premaster, nonce, serverNonce,
+		this.connID, chlo, config.serialized, nil, this.keyLog); err != nil {
+		return err
+	}
+	keys.Params = params
+	this.keyHandler.OnKeys(keys)
+
+	stk, err := config.tokens.NewToken(this.clientAddr, time.Now())
+	if err != nil {
+		return err
+	}
+	shlo := protocol.NewHandshakeMessage(protocol.TagSHLO)
+	shlo.SetTag(protocol.TagPUBS, encodePublicValue(ephemeral.PublicKey()))
+	shlo.SetTag(protocol.TagSTK, stk)
+	// The negotiated values, and the flow control windows of the server
+	shloParams := this.params
+	shloParams.IdleTimeout, shloParams.MaxStreams = params.IdleTimeout, params.MaxStreams
+	shloParams.NextProtos, shloParams.NegotiatedProtocol = nil, params.NegotiatedProtocol
+	shloParams.TruncateConnectionID = params.TruncateConnectionID
+	setParams(shlo, shloParams)
+	_, err = writeMessage(this.stream, shlo)
+	return err
+}
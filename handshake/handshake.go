@@ -0,0 +1,208 @@
+// Package handshake implements the QUIC crypto handshake on the crypto stream: the client and server state machines,
+// the server config, and the derivation of the packet protection keys.
+package handshake
+
+import "github.com/romain-jacotin/quic/crypto"
+import "github.com/romain-jacotin/quic/protocol"
+import "encoding/binary"
+import "errors"
+import "fmt"
+import "io"
+
+const (
+	// CLIENT_HELLO_MINIMUM_SIZE is the size the client pads its CHLO messages to, to prevent amplification attacks
+	CLIENT_HELLO_MINIMUM_SIZE = 1024
+	// NONCE_SIZE is the size of the client and server nonces
+	NONCE_SIZE = 32
+	// AEAD_IV_SIZE is the size of the nonce prefix derived for the AEAD
+	AEAD_IV_SIZE = 4
+)
+
+// Keys are the packet protection keys of an encryption level: the sealer protects the packets sent, the opener the packets received.
+// The forward-secure keys come with the negotiated parameters.
+//
+// The initial keys of the server are diversified with a nonce: the server sends its DiversificationNonce in the public header
+// of its initial packets, and the opener of the client is a crypto.DiversifiableAEAD until it receives one.
+type Keys struct {
+	Level                protocol.EncryptionLevel
+	Sealer               crypto.AEAD
+	Opener               crypto.AEAD
+	Params               NegotiatedParams
+	DiversificationNonce []byte
+}
+
+// KeyHandler installs the keys derived by the crypto handshake, OnKeys returns once the keys are used by the connection.
+type KeyHandler interface {
+	OnKeys(keys Keys)
+}
+
+// ErrHandshakeFailed is the error of a failed crypto handshake, the connection is closed with its error code.
+type ErrHandshakeFailed struct {
+	Code   protocol.QuicErrorCode
+	Reason string
+}
+
+func (this ErrHandshakeFailed) Error() string {
+	return fmt.Sprintf("Handshake : %v (%s)", this.Code, this.Reason)
+}
+
+// ErrorCode returns the error code of the CONNECTION_CLOSE frame.
+func (this ErrHandshakeFailed) ErrorCode() protocol.QuicErrorCode {
+	return this.Code
+}
+
+// SupportedAEADs returns the AEADs of the packet protection in the default order of preference of the client.
+func SupportedAEADs() []protocol.MessageTag {
+	return []protocol.MessageTag{protocol.TagAESG, protocol.TagCC20}
+}
+
+// aeadKeySize returns the key size of the AEAD negotiated with the tag.
+func aeadKeySize(tag protocol.MessageTag) (int, error) {
+	switch tag {
+	case protocol.TagAESG:
+		return 16, nil
+	case protocol.TagCC20:
+		return 32, nil
+	}
+	return 0, ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_MESSAGE_PARAMETER_NO_OVERLAP, Reason: "unsupported AEAD"}
+}
+
+// deriveKeys derives the keys of the encryption level from the premaster secret, the sealer and the opener are chosen by perspective.
+// The initial keys of the server are diversified with the diversification nonce of the server, the client doesn't know it yet.
+// The keys are written on the key log writer when it isn't nil.
+func deriveKeys(perspective protocol.Perspective, level protocol.EncryptionLevel, aead protocol.MessageTag, premaster, clientNonce, serverNonce []byte,
+	connID protocol.QuicConnectionID, chlo, scfg []byte, diversificationNonce []byte, keyLog io.Writer) (Keys, error) {
+	var id [8]byte
+
+	keyLen, err := aeadKeySize(aead)
+	if err != nil {
+		return Keys{}, err
+	}
+	factory, err := crypto.LookupAEAD(uint32(aead))
+	if err != nil {
+		return Keys{}, err
+	}
+	label := crypto.LABEL_INITIAL_KEYS
+	if level == protocol.ENCRYPTION_FORWARD_SECURE {
+		label = crypto.LABEL_FORWARD_SECURE_KEYS
+	}
+	binary.LittleEndian.PutUint64(id[:], uint64(connID))
+	derived, err := crypto.DeriveKeys(premaster, clientNonce, serverNonce, id[:], label, keyLen, AEAD_IV_SIZE, chlo, scfg)
+	if err != nil {
+		return Keys{}, err
+	}
+	client, err := factory(derived.Client.Key, derived.Client.IV)
+	if err != nil {
+		return Keys{}, err
+	}
+	if perspective == protocol.PERSPECTIVE_CLIENT {
+		var server crypto.AEAD
+		if level == protocol.ENCRYPTION_INITIAL {
+			server, err = crypto.NewDiversifiableAEAD(factory, derived.Server.Key, derived.Server.IV)
+		} else {
+			server, err = factory(derived.Server.Key, derived.Server.IV)
+		}
+		if err != nil {
+			return Keys{}, err
+		}
+		if keyLog != nil {
+			writeKeyLog(keyLog, connID, level, derived.Client.Key, derived.Client.IV, derived.Server.Key, derived.Server.IV)
+		}
+		return Keys{Level: level, Sealer: client, Opener: server}, nil
+	}
+	keys := Keys{Level: level, Opener: client}
+	if level == protocol.ENCRYPTION_INITIAL {
+		if err = derived.DiversifyServerKeys(diversificationNonce); err != nil {
+			return Keys{}, err
+		}
+		keys.DiversificationNonce = diversificationNonce
+	}
+	if keys.Sealer, err = factory(derived.Server.Key, derived.Server.IV); err != nil {
+		return Keys{}, err
+	}
+	if keyLog != nil {
+		writeKeyLog(keyLog, connID, level, derived.Client.Key, derived.Client.IV, derived.Server.Key, derived.Server.IV)
+	}
+	return keys, nil
+}
+
+// encodePublicValue returns the PUBS value of a single public key: its 24-bit Little Endian length, then the key.
+func encodePublicValue(key []byte) []byte {
+	b := make([]byte, 3+len(key))
+	b[0] = byte(len(key))
+	b[1] = byte(len(key) >> 8)
+	b[2] = byte(len(key) >> 16)
+	copy(b[3:], key)
+	return b
+}
+
+// decodePublicValue returns the first public key of a PUBS value.
+func decodePublicValue(b []byte) ([]byte, error) {
+	if len(b) < 3 {
+		return nil, errors.New("Handshake : PUBS value too small")
+	}
+	l := int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+	if len(b) < 3+l {
+		return nil, errors.New("Handshake : PUBS value truncated")
+	}
+	return b[3 : 3+l], nil
+}
+
+// encodePublicValues returns the PUBS value of several public keys, each one after its 24-bit Little Endian length.
+func encodePublicValues(keys [][]byte) []byte {
+	var b []byte
+	for _, key := range keys {
+		b = append(b, encodePublicValue(key)...)
+	}
+	return b
+}
+
+// decodePublicValues returns all the public keys of a PUBS value.
+func decodePublicValues(b []byte) ([][]byte, error) {
+	var keys [][]byte
+	for len(b) > 0 {
+		key, err := decodePublicValue(b)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		b = b[3+len(key):]
+	}
+	return keys, nil
+}
+
+// requireTag returns the value of a mandatory tag of the message.
+func requireTag(msg *protocol.HandshakeMessage, tag protocol.MessageTag) ([]byte, error) {
+	v, ok := msg.GetTag(tag)
+	if !ok {
+		return nil, ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_MESSAGE_PARAMETER_NOT_FOUND, Reason: fmt.Sprintf("missing tag %q", tagString(tag))}
+	}
+	return v, nil
+}
+
+// tagString returns the ASCII name of the tag.
+func tagString(tag protocol.MessageTag) string {
+	return string([]byte{byte(tag), byte(tag >> 8), byte(tag >> 16), byte(tag >> 24)})
+}
+
+// readMessage reads the next whole handshake message from the crypto stream, the messages too large or with too many
+// entries abort the handshake with their error code.
+func readMessage(r io.Reader) (*protocol.HandshakeMessage, error) {
+	msg, err := protocol.ReadHandshakeMessage(r)
+	switch err {
+	case protocol.ErrHandshakeMessageTooLarge:
+		return nil, ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_INVALID_VALUE_LENGTH, Reason: err.Error()}
+	case protocol.ErrHandshakeMessageTooManyEntries:
+		return nil, ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_TOO_MANY_ENTRIES, Reason: err.Error()}
+	}
+	return msg, err
+}
+
+// writeMessage writes the serialized message on the crypto stream.
+func writeMessage(w io.Writer, msg *protocol.HandshakeMessage) ([]byte, error) {
+	b := msg.Serialize()
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
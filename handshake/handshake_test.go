@@ -0,0 +1,1018 @@
+package handshake
+
+import "github.com/romain-jacotin/quic/crypto"
+import "github.com/romain-jacotin/quic/protocol"
+import "bytes"
+import "crypto/rand"
+import "crypto/rsa"
+import "crypto/tls"
+import "crypto/x509"
+import "encoding/binary"
+import "errors"
+import "io"
+import "math/big"
+import "net"
+import "os"
+import "strings"
+import "testing"
+import "time"
+
+// testPipe is one end of a bidirectional in-memory crypto stream.
+type testPipe struct {
+	io.Reader
+	io.Writer
+}
+
+// newTestPipes returns the client and server ends of a crypto stream.
+func newTestPipes() (*testPipe, *testPipe) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	return &testPipe{Reader: cr, Writer: cw}, &testPipe{Reader: sr, Writer: sw}
+}
+
+// testClientAddr is the address of the client of the CryptoServers.
+var testClientAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4433}
+
+// testCertificate returns the certificate of localhost signed by the test CA of the testdata directory, and the pool of the test CA.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	cert, err := tls.LoadX509KeyPair("../testdata/cert.pem", "../testdata/cert.key")
+	if err != nil {
+		t.Fatalf("tls.LoadX509KeyPair : unexpected error %v", err)
+	}
+	ca, err := os.ReadFile("../testdata/ca.pem")
+	if err != nil {
+		t.Fatalf("os.ReadFile : unexpected error %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca)
+	return cert, roots
+}
+
+// testKeyHandler records the keys installed.
+type testKeyHandler struct {
+	keys []Keys
+}
+
+func (this *testKeyHandler) OnKeys(keys Keys) {
+	this.keys = append(this.keys, keys)
+}
+
+func Test_Handshake_ClientServer(t *testing.T) {
+	config, err := NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+	cert, roots := testCertificate(t)
+	if err = config.SetCertificate(cert); err != nil {
+		t.Fatalf("ServerConfig.SetCertificate : unexpected error %v", err)
+	}
+	params := NegotiatedParams{IdleTimeout: 30 * time.Second}
+	clientPipe, serverPipe := newTestPipes()
+	clientKeys, serverKeys := new(testKeyHandler), new(testKeyHandler)
+	client := NewCryptoClient(clientPipe, 0x1234, "localhost", protocol.QUIC_VERSION_39, protocol.QUIC_VERSION_39, params,
+		NewProofVerifier(roots), clientKeys)
+	server := NewCryptoServer(serverPipe, 0x1234, testClientAddr, protocol.QUIC_VERSION_39, protocol.SupportedVersions(), config, params, serverKeys)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Run()
+	}()
+	if err = client.Run(); err != nil {
+		t.Fatalf("CryptoClient.Run : unexpected error %v", err)
+	}
+	if err = <-done; err != nil {
+		t.Fatalf("CryptoServer.Run : unexpected error %v", err)
+	}
+
+	// Both sides install the initial then the forward-secure keys, the sealer of one side matches the opener of the other
+	if len(clientKeys.keys) != 2 || len(serverKeys.keys) != 2 {
+		t.Fatalf("KeyHandler.OnKeys : 2 keys expected instead of %v and %v", len(clientKeys.keys), len(serverKeys.keys))
+	}
+	for i, level := range []protocol.EncryptionLevel{protocol.ENCRYPTION_INITIAL, protocol.ENCRYPTION_FORWARD_SECURE} {
+		c, s := clientKeys.keys[i], serverKeys.keys[i]
+		if c.Level != level || s.Level != level {
+			t.Errorf("KeyHandler.OnKeys : encryption level %v expected in test n°%v", level, i)
+		}
+		// Only the initial keys of the server are diversified
+		var clientOpener protocol.PacketOpener = c.Opener
+		if d, ok := c.Opener.(protocol.DiversifiableOpener); ok != (level == protocol.ENCRYPTION_INITIAL) {
+			t.Errorf("KeyHandler.OnKeys : the opener of the client must be diversifiable at the initial level only in test n°%v", i)
+		} else if ok {
+			if len(s.DiversificationNonce) != protocol.QUIC_DIVERSIFICATION_NONCE_SIZE {
+				t.Fatalf("KeyHandler.OnKeys : diversification nonce of the server expected in test n°%v", i)
+			}
+			if clientOpener, err = d.Diversify(s.DiversificationNonce); err != nil {
+				t.Fatalf("DiversifiableOpener.Diversify : unexpected error %v in test n°%v", err, i)
+			}
+		}
+		for j, pair := range []struct {
+			sealer crypto.AEAD
+			opener protocol.PacketOpener
+		}{{c.Sealer, s.Opener}, {s.Sealer, clientOpener}} {
+			plaintext := []byte("hello")
+			ciphertext := make([]byte, len(plaintext)+pair.sealer.GetMacSize())
+			n, err := pair.sealer.Seal(42, ciphertext, []byte("aad"), plaintext)
+			if err != nil {
+				t.Fatalf("AEAD.Seal : unexpected error %v in test n°%v.%v", err, i, j)
+			}
+			out := make([]byte, len(ciphertext))
+			n, err = pair.opener.Open(42, out, []byte("aad"), ciphertext[:n])
+			if err != nil || !bytes.Equal(out[:n], plaintext) {
+				t.Errorf("AEAD.Open : the peer can't open the packet (%v) in test n°%v.%v", err, i, j)
+			}
+		}
+	}
+}
+
+func Test_Handshake_NegotiatedParams(t *testing.T) {
+	config, err := NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+
+	// The smallest idle timeout, rounded up to the second, and maximum number of streams are used,
+	// the flow control windows are those of the peer, and the client receives the nonce proof of the public resets of the server.
+	// The Connection ID is truncated if both propose it
+	var tests_params = []struct {
+		client          NegotiatedParams
+		server          NegotiatedParams
+		expectedIdle    time.Duration
+		expectedStreams uint32
+	}{
+		{NegotiatedParams{IdleTimeout: 10 * time.Second}, NegotiatedParams{IdleTimeout: 30 * time.Second}, 10 * time.Second, DEFAULT_MAX_STREAMS},
+		{NegotiatedParams{IdleTimeout: 30 * time.Second}, NegotiatedParams{IdleTimeout: 10 * time.Second}, 10 * time.Second, DEFAULT_MAX_STREAMS},
+		{NegotiatedParams{IdleTimeout: 30 * time.Second}, NegotiatedParams{IdleTimeout: 30 * time.Second}, 30 * time.Second, DEFAULT_MAX_STREAMS},
+		{NegotiatedParams{IdleTimeout: 1500 * time.Millisecond}, NegotiatedParams{IdleTimeout: 30 * time.Second}, 2 * time.Second, DEFAULT_MAX_STREAMS},
+		{NegotiatedParams{MaxStreams: 10}, NegotiatedParams{MaxStreams: 200}, DEFAULT_IDLE_TIMEOUT, 10},
+		{NegotiatedParams{MaxStreams: 200}, NegotiatedParams{MaxStreams: 10}, DEFAULT_IDLE_TIMEOUT, 10},
+		{NegotiatedParams{StreamFlowControlWindow: 32 * 1024, ConnectionFlowControlWindow: 64 * 1024},
+			NegotiatedParams{StreamFlowControlWindow: 1 << 20, ConnectionFlowControlWindow: 1 << 21}, DEFAULT_IDLE_TIMEOUT, DEFAULT_MAX_STREAMS},
+		{NegotiatedParams{}, NegotiatedParams{PublicResetNonceProof: 0x1122334455667788}, DEFAULT_IDLE_TIMEOUT, DEFAULT_MAX_STREAMS},
+		{NegotiatedParams{TruncateConnectionID: true}, NegotiatedParams{}, DEFAULT_IDLE_TIMEOUT, DEFAULT_MAX_STREAMS},
+		{NegotiatedParams{}, NegotiatedParams{TruncateConnectionID: true}, DEFAULT_IDLE_TIMEOUT, DEFAULT_MAX_STREAMS},
+		{NegotiatedParams{TruncateConnectionID: true}, NegotiatedParams{TruncateConnectionID: true}, DEFAULT_IDLE_TIMEOUT, DEFAULT_MAX_STREAMS},
+	}
+	for i, v := range tests_params {
+		clientPipe, serverPipe := newTestPipes()
+		clientKeys, serverKeys := new(testKeyHandler), new(testKeyHandler)
+		client := NewCryptoClient(clientPipe, 0x1234, "example.org", protocol.QUIC_VERSION_39, protocol.QUIC_VERSION_39,
+			v.client, nil, clientKeys)
+		server := NewCryptoServer(serverPipe, 0x1234, testClientAddr, protocol.QUIC_VERSION_39, protocol.SupportedVersions(), config,
+			v.server, serverKeys)
+		done := make(chan error, 1)
+		go func() {
+			done <- server.Run()
+		}()
+		if err = client.Run(); err != nil {
+			t.Fatalf("CryptoClient.Run : unexpected error %v in test n°%v", err, i)
+		}
+		if err = <-done; err != nil {
+			t.Fatalf("CryptoServer.Run : unexpected error %v in test n°%v", err, i)
+		}
+		clientParams, serverParams := clientKeys.keys[1].Params, serverKeys.keys[1].Params
+		for _, p := range []NegotiatedParams{clientParams, serverParams} {
+			if p.IdleTimeout != v.expectedIdle {
+				t.Errorf("CryptoSetup : idle timeout %v expected instead of %v in test n°%v", v.expectedIdle, p.IdleTimeout, i)
+			}
+			if p.MaxStreams != v.expectedStreams {
+				t.Errorf("CryptoSetup : %v streams expected instead of %v in test n°%v", v.expectedStreams, p.MaxStreams, i)
+			}
+			if truncate := v.client.TruncateConnectionID && v.server.TruncateConnectionID; p.TruncateConnectionID != truncate {
+				t.Errorf("CryptoSetup : TruncateConnectionID %v expected in test n°%v", truncate, i)
+			}
+		}
+		v.client.ApplyDefaults()
+		v.server.ApplyDefaults()
+		if clientParams.StreamFlowControlWindow != v.server.StreamFlowControlWindow ||
+			clientParams.ConnectionFlowControlWindow != v.server.ConnectionFlowControlWindow {
+			t.Errorf("CryptoClient : flow control windows of the server expected instead of %v in test n°%v", clientParams, i)
+		}
+		if serverParams.StreamFlowControlWindow != v.client.StreamFlowControlWindow ||
+			serverParams.ConnectionFlowControlWindow != v.client.ConnectionFlowControlWindow {
+			t.Errorf("CryptoServer : flow control windows of the client expected instead of %v in test n°%v", serverParams, i)
+		}
+		if clientParams.PublicResetNonceProof != v.server.PublicResetNonceProof || serverParams.PublicResetNonceProof != 0 {
+			t.Errorf("CryptoSetup : nonce proof %x of the server expected instead of %x in test n°%v", v.server.PublicResetNonceProof,
+				clientParams.PublicResetNonceProof, i)
+		}
+	}
+}
+
+func Test_Handshake_NextProtos(t *testing.T) {
+	config, err := NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+
+	// The server selects its first application protocol proposed by the client
+	var tests_protos = []struct {
+		client   []string
+		server   []string
+		expected string
+		err      error
+	}{
+		{[]string{"h2", "hq"}, []string{"hq", "h2"}, "hq", nil},
+		{[]string{"h2"}, []string{"hq", "h2"}, "h2", nil},
+		{[]string{"h2"}, nil, "", nil},
+		{nil, []string{"h2"}, "", nil},
+		{nil, nil, "", nil},
+		{[]string{"h2"}, []string{"hq"}, "", ErrNoApplicationProtocol},
+	}
+	for i, v := range tests_protos {
+		clientPipe, serverPipe := newTestPipes()
+		clientKeys, serverKeys := new(testKeyHandler), new(testKeyHandler)
+		client := NewCryptoClient(clientPipe, 0x1234, "example.org", protocol.QUIC_VERSION_39, protocol.QUIC_VERSION_39,
+			NegotiatedParams{NextProtos: v.client}, nil, clientKeys)
+		server := NewCryptoServer(serverPipe, 0x1234, testClientAddr, protocol.QUIC_VERSION_39, protocol.SupportedVersions(), config,
+			NegotiatedParams{NextProtos: v.server}, serverKeys)
+		done := make(chan error, 1)
+		go func() {
+			err := server.Run()
+			// The client waits for the SHLO
+			serverPipe.Writer.(*io.PipeWriter).CloseWithError(err)
+			done <- err
+		}()
+		clientErr := client.Run()
+		if err = <-done; err != v.err {
+			t.Errorf("CryptoServer.Run : %v expected instead of %v in test n°%v", v.err, err, i)
+		}
+		if v.err != nil {
+			if !errors.Is(clientErr, v.err) {
+				t.Errorf("CryptoClient.Run : %v expected instead of %v in test n°%v", v.err, clientErr, i)
+			}
+			continue
+		}
+		if clientErr != nil {
+			t.Fatalf("CryptoClient.Run : unexpected error %v in test n°%v", clientErr, i)
+		}
+		for _, keys := range [][]Keys{clientKeys.keys, serverKeys.keys} {
+			if p := keys[1].Params.NegotiatedProtocol; p != v.expected {
+				t.Errorf("CryptoSetup : application protocol %q expected instead of %q in test n°%v", v.expected, p, i)
+			}
+		}
+	}
+
+	// The SHLO selects a single application protocol, and each one has a non-zero length
+	msg := protocol.NewHandshakeMessage(protocol.TagSHLO)
+	setUint32(msg, protocol.TagICSL, 30)
+	setUint32(msg, protocol.TagMSPC, 100)
+	msg.SetTag(protocol.TagALPN, encodeProtocols([]string{"h2", "hq"}))
+	var params NegotiatedParams
+	if e, ok := params.ParseFromSHLO(msg).(ErrHandshakeFailed); !ok || e.Code != protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER {
+		t.Errorf("NegotiatedParams.ParseFromSHLO : QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER expected instead of %v", e)
+	}
+	msg.SetTag(protocol.TagALPN, []byte{3, 'h'})
+	if e, ok := params.ParseFromCHLO(msg).(ErrHandshakeFailed); !ok || e.Code != protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER {
+		t.Errorf("NegotiatedParams.ParseFromCHLO : QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER expected instead of %v", e)
+	}
+}
+
+func Test_CryptoClient_AEADs(t *testing.T) {
+	config, err := NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+
+	// The client selects its first AEAD supported by the server
+	var tests_aeads = []struct {
+		aeads    []protocol.MessageTag
+		expected protocol.MessageTag
+	}{
+		{nil, protocol.TagAESG},
+		{[]protocol.MessageTag{protocol.TagCC20, protocol.TagAESG}, protocol.TagCC20},
+		{[]protocol.MessageTag{protocol.TagNULL, protocol.TagAESG}, protocol.TagAESG},
+	}
+	for i, v := range tests_aeads {
+		clientPipe, serverPipe := newTestPipes()
+		client := NewCryptoClient(clientPipe, 0x1234, "example.org", protocol.QUIC_VERSION_39, protocol.QUIC_VERSION_39,
+			NegotiatedParams{}, nil, new(testKeyHandler))
+		client.SetAEADs(v.aeads)
+		server := NewCryptoServer(serverPipe, 0x1234, testClientAddr, protocol.QUIC_VERSION_39, protocol.SupportedVersions(), config,
+			NegotiatedParams{}, new(testKeyHandler))
+		go server.Run()
+		if err = client.Run(); err != nil || client.aead != v.expected {
+			t.Errorf("CryptoClient.Run : AEAD %v expected instead of %v (%v) in test n°%v", v.expected, client.aead, err, i)
+		}
+	}
+}
+
+func Test_NegotiatedParams_Parse(t *testing.T) {
+	var tests_parse = []struct {
+		tags     map[protocol.MessageTag]uint32
+		tcid     bool
+		expected protocol.QuicErrorCode
+	}{
+		{map[protocol.MessageTag]uint32{protocol.TagICSL: 30, protocol.TagMSPC: 100}, false, protocol.QUIC_NO_ERROR},
+		{map[protocol.MessageTag]uint32{protocol.TagICSL: 30, protocol.TagMSPC: 100, protocol.TagTCID: 0}, true, protocol.QUIC_NO_ERROR},
+		{map[protocol.MessageTag]uint32{protocol.TagICSL: 30, protocol.TagMSPC: 100, protocol.TagTCID: 1}, false, protocol.QUIC_NO_ERROR},
+		{map[protocol.MessageTag]uint32{protocol.TagICSL: 30, protocol.TagMSPC: 100, protocol.TagSFCW: 16 * 1024, protocol.TagCFCW: 1 << 20},
+			false, protocol.QUIC_NO_ERROR},
+		{map[protocol.MessageTag]uint32{protocol.TagMSPC: 100}, false, protocol.QUIC_CRYPTO_MESSAGE_PARAMETER_NOT_FOUND},
+		{map[protocol.MessageTag]uint32{protocol.TagICSL: 30}, false, protocol.QUIC_CRYPTO_MESSAGE_PARAMETER_NOT_FOUND},
+		{map[protocol.MessageTag]uint32{protocol.TagICSL: 0, protocol.TagMSPC: 100}, false, protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER},
+		{map[protocol.MessageTag]uint32{protocol.TagICSL: 30, protocol.TagMSPC: 0}, false, protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER},
+		{map[protocol.MessageTag]uint32{protocol.TagICSL: 30, protocol.TagMSPC: 100, protocol.TagSFCW: 16*1024 - 1},
+			false, protocol.QUIC_FLOW_CONTROL_INVALID_WINDOW},
+		{map[protocol.MessageTag]uint32{protocol.TagICSL: 30, protocol.TagMSPC: 100, protocol.TagCFCW: 1024},
+			false, protocol.QUIC_FLOW_CONTROL_INVALID_WINDOW},
+	}
+	for i, v := range tests_parse {
+		msg := protocol.NewHandshakeMessage(protocol.TagCHLO)
+		for tag, value := range v.tags {
+			setUint32(msg, tag, value)
+		}
+		var params NegotiatedParams
+		err := params.ParseFromCHLO(msg)
+		if v.expected == protocol.QUIC_NO_ERROR {
+			if err != nil {
+				t.Errorf("NegotiatedParams.ParseFromCHLO : unexpected error %v in test n°%v", err, i)
+			}
+			if params.TruncateConnectionID != v.tcid {
+				t.Errorf("NegotiatedParams.ParseFromCHLO : TruncateConnectionID %v expected in test n°%v", v.tcid, i)
+			}
+			continue
+		}
+		if e, ok := err.(ErrHandshakeFailed); !ok || e.Code != v.expected {
+			t.Errorf("NegotiatedParams.ParseFromCHLO : error %v expected instead of %v in test n°%v", v.expected, err, i)
+		}
+	}
+
+	// An ICSL of the wrong length is invalid
+	msg := protocol.NewHandshakeMessage(protocol.TagSHLO)
+	msg.SetTag(protocol.TagICSL, []byte{30})
+	setUint32(msg, protocol.TagMSPC, 100)
+	var params NegotiatedParams
+	if e, ok := params.ParseFromSHLO(msg).(ErrHandshakeFailed); !ok || e.Code != protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER {
+		t.Errorf("NegotiatedParams.ParseFromSHLO : QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER expected instead of %v", e)
+	}
+}
+
+func Test_Handshake_Errors(t *testing.T) {
+	config, err := NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+	small := protocol.NewHandshakeMessage(protocol.TagCHLO).Serialize()
+	shlo := protocol.NewHandshakeMessage(protocol.TagSHLO).Serialize()
+	downgraded := protocol.NewHandshakeMessage(protocol.TagCHLO)
+	vers := make([]byte, 4)
+	binary.LittleEndian.PutUint32(vers, uint32(protocol.QUIC_VERSION_43))
+	downgraded.SetTag(protocol.TagVERS, vers)
+	downgraded.SetTag(protocol.TagPAD, make([]byte, CLIENT_HELLO_MINIMUM_SIZE))
+	large := protocol.NewHandshakeMessage(protocol.TagCHLO)
+	large.SetTag(protocol.TagPAD, make([]byte, protocol.MAX_HANDSHAKE_MESSAGE_SIZE))
+
+	var tests_server = []struct {
+		message []byte
+		code    protocol.QuicErrorCode
+	}{
+		{shlo, protocol.QUIC_INVALID_CRYPTO_MESSAGE_TYPE},
+		{small, protocol.QUIC_CRYPTO_INVALID_VALUE_LENGTH},
+		{downgraded.Serialize(), protocol.QUIC_VERSION_NEGOTIATION_MISMATCH},
+		{large.Serialize(), protocol.QUIC_CRYPTO_INVALID_VALUE_LENGTH},
+		{[]byte{'C', 'H', 'L', 'O', 0xff, 0xff, 0x00, 0x00}, protocol.QUIC_CRYPTO_TOO_MANY_ENTRIES},
+	}
+	for i, v := range tests_server {
+		server := NewCryptoServer(&testPipe{Reader: bytes.NewReader(v.message), Writer: new(bytes.Buffer)}, 0x1234,
+			testClientAddr, protocol.QUIC_VERSION_39, protocol.SupportedVersions(), config,
+			NegotiatedParams{IdleTimeout: 30 * time.Second}, new(testKeyHandler))
+		if err, ok := server.Run().(ErrHandshakeFailed); !ok || err.ErrorCode() != v.code {
+			t.Errorf("CryptoServer.Run : error %v expected instead of %v in test n°%v", v.code, err, i)
+		}
+	}
+
+	// The client rejects a SHLO before the full CHLO
+	client := NewCryptoClient(&testPipe{Reader: bytes.NewReader(shlo), Writer: new(bytes.Buffer)}, 0x1234, "example.org",
+		protocol.QUIC_VERSION_39, protocol.QUIC_VERSION_39, NegotiatedParams{IdleTimeout: 30 * time.Second}, nil, new(testKeyHandler))
+	if err, ok := client.Run().(ErrHandshakeFailed); !ok || err.ErrorCode() != protocol.QUIC_INVALID_CRYPTO_MESSAGE_TYPE {
+		t.Errorf("CryptoClient.Run : error QUIC_INVALID_CRYPTO_MESSAGE_TYPE expected instead of %v", err)
+	}
+}
+
+func Test_CryptoClient_Rejects(t *testing.T) {
+	expired, err := NewServerConfig(-time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+	config, err := NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+
+	// The server rejects each CHLO, with the expected CHLO and its tags
+	var tests_rejects = []struct {
+		scfg []byte
+		stk  string
+		full bool
+	}{
+		// Expired server config: inchoate CHLO
+		{expired.Serialize(), "token1", false},
+		{config.Serialize(), "token2", true},
+		// Stale source-address token: full CHLO with the new token and the server config of the previous REJ
+		{nil, "token3", true},
+		// One REJ too many
+		{config.Serialize(), "token4", false},
+	}
+	clientPipe, serverPipe := newTestPipes()
+	keys := new(testKeyHandler)
+	client := NewCryptoClient(clientPipe, 0x1234, "example.org", protocol.QUIC_VERSION_39, protocol.QUIC_VERSION_39,
+		NegotiatedParams{IdleTimeout: 30 * time.Second}, nil, keys)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Run()
+	}()
+	if _, err = protocol.ReadHandshakeMessage(serverPipe); err != nil {
+		t.Fatalf("ReadHandshakeMessage : unexpected error %v", err)
+	}
+	for i, v := range tests_rejects {
+		rej := protocol.NewHandshakeMessage(protocol.TagREJ)
+		if v.scfg != nil {
+			rej.SetTag(protocol.TagSCFG, v.scfg)
+		}
+		rej.SetTag(protocol.TagSTK, []byte(v.stk))
+		rej.SetTag(protocol.TagSNO, make([]byte, NONCE_SIZE))
+		if _, err = writeMessage(serverPipe, rej); err != nil {
+			t.Fatalf("writeMessage : unexpected error %v in test n°%v", err, i)
+		}
+		if i == len(tests_rejects)-1 {
+			break
+		}
+		chlo, err := protocol.ReadHandshakeMessage(serverPipe)
+		if err != nil {
+			t.Fatalf("ReadHandshakeMessage : unexpected error %v in test n°%v", err, i)
+		}
+		scid, full := chlo.GetTag(protocol.TagSCID)
+		if stk, _ := chlo.GetTag(protocol.TagSTK); full != v.full || string(stk) != v.stk {
+			t.Errorf("CryptoClient : CHLO (full %v, STK %q) expected instead of (full %v, STK %q) in test n°%v", v.full, v.stk, full, stk, i)
+		}
+		if full && !bytes.Equal(scid, config.GetID()) {
+			t.Errorf("CryptoClient : SCID of the valid server config expected in test n°%v", i)
+		}
+	}
+	if err, ok := (<-done).(ErrHandshakeFailed); !ok || err.ErrorCode() != protocol.QUIC_CRYPTO_TOO_MANY_REJECTS {
+		t.Errorf("CryptoClient.Run : error QUIC_CRYPTO_TOO_MANY_REJECTS expected instead of %v", err)
+	}
+
+	// The initial keys are installed for each full CHLO
+	if len(keys.keys) != 2 || keys.keys[0].Level != protocol.ENCRYPTION_INITIAL || keys.keys[1].Level != protocol.ENCRYPTION_INITIAL {
+		t.Errorf("KeyHandler.OnKeys : 2 initial keys expected instead of %v", len(keys.keys))
+	}
+	if string(client.GetSourceAddressToken()) != "token3" || !bytes.Equal(client.GetServerConfig().GetID(), config.GetID()) {
+		t.Errorf("CryptoClient : last source-address token and server config expected")
+	}
+}
+
+func Test_CryptoServer_Rejects(t *testing.T) {
+	config, err := NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+	params := NegotiatedParams{IdleTimeout: 30 * time.Second}
+
+	// Records the CHLOs of a handshake: the inchoate CHLO, then the full CHLO with the source-address token of the REJ
+	clientPipe, serverPipe := newTestPipes()
+	recorded := new(bytes.Buffer)
+	clientPipe.Writer = io.MultiWriter(clientPipe.Writer, recorded)
+	client := NewCryptoClient(clientPipe, 0x1234, "example.org", protocol.QUIC_VERSION_39, protocol.QUIC_VERSION_39, params, nil, new(testKeyHandler))
+	server := NewCryptoServer(serverPipe, 0x1234, testClientAddr, protocol.QUIC_VERSION_39, protocol.SupportedVersions(), config, params, new(testKeyHandler))
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Run()
+	}()
+	if err = client.Run(); err != nil {
+		t.Fatalf("CryptoClient.Run : unexpected error %v", err)
+	}
+	if err = <-done; err != nil {
+		t.Fatalf("CryptoServer.Run : unexpected error %v", err)
+	}
+	inchoate, err := protocol.ReadHandshakeMessage(recorded)
+	if err != nil {
+		t.Fatalf("ReadHandshakeMessage : unexpected error %v", err)
+	}
+	full, err := protocol.ReadHandshakeMessage(recorded)
+	if err != nil {
+		t.Fatalf("ReadHandshakeMessage : unexpected error %v", err)
+	}
+
+	// withTag returns the full CHLO with the value of the tag changed
+	withTag := func(tag protocol.MessageTag, value []byte) []byte {
+		msg, _ := protocol.ParseHandshakeMessage(full.Serialize())
+		msg.SetTag(tag, value)
+		return msg.Serialize()
+	}
+	expiredToken, _ := config.tokens.NewToken(testClientAddr, time.Now().Add(-2*DEFAULT_SOURCE_ADDRESS_TOKEN_LIFETIME))
+	otherPortToken, _ := config.tokens.NewToken(&net.UDPAddr{IP: testClientAddr.IP, Port: 4434}, time.Now())
+
+	var tests_rejects = []struct {
+		chlo   []byte
+		reason RejectReason
+	}{
+		{inchoate.Serialize(), REJECT_INCHOATE_HELLO},
+		{full.Serialize(), REJECT_CLIENT_NONCE_NOT_UNIQUE},
+		{withTag(protocol.TagSCID, make([]byte, 16)), REJECT_UNKNOWN_SERVER_CONFIG},
+		{withTag(protocol.TagSTK, expiredToken), REJECT_SOURCE_ADDRESS_TOKEN_EXPIRED},
+		{withTag(protocol.TagSTK, otherPortToken), REJECT_SOURCE_ADDRESS_TOKEN_DIFFERENT_ADDRESS},
+		{withTag(protocol.TagSTK, make([]byte, len(expiredToken))), REJECT_SOURCE_ADDRESS_TOKEN_INVALID},
+	}
+	for i, v := range tests_rejects {
+		out := new(bytes.Buffer)
+		server := NewCryptoServer(&testPipe{Reader: bytes.NewReader(v.chlo), Writer: out}, 0x1234, testClientAddr,
+			protocol.QUIC_VERSION_39, protocol.SupportedVersions(), config, params, new(testKeyHandler))
+		if err = server.Run(); err != io.EOF {
+			t.Errorf("CryptoServer.Run : io.EOF expected instead of %v in test n°%v", err, i)
+		}
+		rej, err := protocol.ReadHandshakeMessage(out)
+		if err != nil || rej.GetMessageTag() != protocol.TagREJ {
+			t.Fatalf("CryptoServer : REJ expected (%v) in test n°%v", err, i)
+		}
+		if rrej, _ := rej.GetTag(protocol.TagRREJ); len(rrej) != 4 || RejectReason(binary.LittleEndian.Uint32(rrej)) != v.reason {
+			t.Errorf("CryptoServer : reject reason %v expected instead of %x in test n°%v", v.reason, rrej, i)
+		}
+
+		// The REJ proves the address with a new token, and the server config with the certificate chain
+		stk, _ := rej.GetTag(protocol.TagSTK)
+		if err = config.tokens.ValidateToken(stk, testClientAddr, time.Now()); err != nil {
+			t.Errorf("CryptoServer : valid source-address token expected (%v) in test n°%v", err, i)
+		}
+		crt, _ := rej.GetTag(protocol.TagCRT)
+		cert := config.signer.GetCertificateChain()[0]
+		if chain, err := crypto.DecompressChain(crt, map[uint64][]byte{crypto.CertHash(cert): cert}); err != nil || len(chain) != 1 {
+			t.Errorf("CryptoServer : certificate chain expected (%v) in test n°%v", err, i)
+		}
+		// The full CHLOs have the certificate of the first REJ in their cached certificates (CCRT): only its hash is sent
+		if v.reason != REJECT_INCHOATE_HELLO && len(crt) != 10 {
+			t.Errorf("CryptoServer : cached certificate expected instead of %v bytes in test n°%v", len(crt), i)
+		}
+		if _, ok := rej.GetTag(protocol.TagPROF); !ok {
+			t.Errorf("CryptoServer : proof of the server config expected in test n°%v", i)
+		}
+	}
+}
+
+func Test_SourceAddressTokens(t *testing.T) {
+	now := time.Now()
+	other := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: testClientAddr.Port}
+	rebound := &net.UDPAddr{IP: testClientAddr.IP, Port: 5000}
+
+	var tests_tokens = []struct {
+		allowPortChange bool
+		issued          time.Time
+		addr            net.Addr
+		err             error
+	}{
+		{false, now, testClientAddr, nil},
+		{false, now.Add(-time.Hour), testClientAddr, nil},
+		{false, now.Add(-2 * time.Hour), testClientAddr, ErrTokenExpired},
+		{false, now.Add(time.Hour), testClientAddr, ErrTokenInvalid},
+		{false, now, other, ErrTokenAddressMismatch},
+		{false, now, rebound, ErrTokenAddressMismatch},
+		{true, now, rebound, nil},
+		{true, now, other, ErrTokenAddressMismatch},
+	}
+	for i, v := range tests_tokens {
+		tokens, err := NewSourceAddressTokens(90*time.Minute, v.allowPortChange)
+		if err != nil {
+			t.Fatalf("NewSourceAddressTokens : unexpected error %v in test n°%v", err, i)
+		}
+		token, err := tokens.NewToken(testClientAddr, v.issued)
+		if err != nil {
+			t.Fatalf("SourceAddressTokens.NewToken : unexpected error %v in test n°%v", err, i)
+		}
+		if err = tokens.ValidateToken(token, v.addr, now); err != v.err {
+			t.Errorf("SourceAddressTokens.ValidateToken : error %v expected instead of %v in test n°%v", v.err, err, i)
+		}
+		// A flipped bit invalidates the token
+		token[len(token)-1] ^= 1
+		if err = tokens.ValidateToken(token, testClientAddr, now); err != ErrTokenInvalid {
+			t.Errorf("SourceAddressTokens.ValidateToken : ErrTokenInvalid expected instead of %v in test n°%v", err, i)
+		}
+	}
+}
+
+func Test_ServerConfig_Parse(t *testing.T) {
+	config, err := NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+	parsed, err := ParseServerConfig(config.Serialize())
+	if err != nil {
+		t.Fatalf("ParseServerConfig : unexpected error %v", err)
+	}
+	if !bytes.Equal(parsed.GetID(), config.GetID()) || len(parsed.publicKeys) != 2 || !bytes.Equal(parsed.publicKeys[1], config.publicKeys[1]) ||
+		!parsed.GetExpiry().Equal(config.GetExpiry()) || len(parsed.aeads) != 2 || parsed.kex != nil {
+		t.Errorf("ParseServerConfig : invalid server config %+v", parsed)
+	}
+	if _, err = ParseServerConfig(protocol.NewHandshakeMessage(protocol.TagSCFG).Serialize()); err == nil {
+		t.Errorf("ParseServerConfig : error expected for a SCFG without tags")
+	}
+}
+
+func Test_ServerConfigManager_Rotate(t *testing.T) {
+	manager, err := NewServerConfigManager(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfigManager : unexpected error %v", err)
+	}
+	first := manager.Current()
+	params := NegotiatedParams{IdleTimeout: 30 * time.Second}
+
+	// The server config rotates after the REJ: the full CHLO references the previous SCID and is accepted
+	clientPipe, serverPipe := newTestPipes()
+	recorded := new(bytes.Buffer)
+	clientPipe.Writer = io.MultiWriter(clientPipe.Writer, recorded)
+	serverPipe.Writer = &rotatingWriter{Writer: serverPipe.Writer, manager: manager}
+	keys := new(testKeyHandler)
+	client := NewCryptoClient(clientPipe, 0x1234, "example.org", protocol.QUIC_VERSION_39, protocol.QUIC_VERSION_39, params, nil, new(testKeyHandler))
+	server := NewCryptoServer(serverPipe, 0x1234, testClientAddr, protocol.QUIC_VERSION_39, protocol.SupportedVersions(), manager, params, keys)
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Run()
+	}()
+	if err = client.Run(); err != nil {
+		t.Fatalf("CryptoClient.Run : unexpected error %v", err)
+	}
+	if err = <-done; err != nil {
+		t.Fatalf("CryptoServer.Run : unexpected error %v", err)
+	}
+	if bytes.Equal(manager.Current().GetID(), first.GetID()) || manager.Lookup(first.GetID()) != first {
+		t.Fatalf("ServerConfigManager.Rotate : new current server config and previous server config expected")
+	}
+	if !bytes.Equal(client.GetServerConfig().GetID(), first.GetID()) || len(keys.keys) != 2 {
+		t.Errorf("CryptoServer : full CHLO of the previous server config expected to be accepted")
+	}
+
+	// After the next rotation the server config of the recorded full CHLO is unknown
+	if err = manager.Rotate(); err != nil {
+		t.Fatalf("ServerConfigManager.Rotate : unexpected error %v", err)
+	}
+	if manager.Lookup(first.GetID()) != nil {
+		t.Errorf("ServerConfigManager.Lookup : the server config before the previous one must be forgotten")
+	}
+	protocol.ReadHandshakeMessage(recorded)
+	out := new(bytes.Buffer)
+	server = NewCryptoServer(&testPipe{Reader: recorded, Writer: out}, 0x1234, testClientAddr,
+		protocol.QUIC_VERSION_39, protocol.SupportedVersions(), manager, params, new(testKeyHandler))
+	server.Run()
+	rej, err := protocol.ReadHandshakeMessage(out)
+	if err != nil {
+		t.Fatalf("CryptoServer : REJ expected (%v)", err)
+	}
+	rrej, _ := rej.GetTag(protocol.TagRREJ)
+	scfg, _ := rej.GetTag(protocol.TagSCFG)
+	if len(rrej) != 4 || RejectReason(binary.LittleEndian.Uint32(rrej)) != REJECT_UNKNOWN_SERVER_CONFIG ||
+		!bytes.Equal(scfg, manager.Current().Serialize()) {
+		t.Errorf("CryptoServer : REJ of the current server config with REJECT_UNKNOWN_SERVER_CONFIG expected instead of %x", rrej)
+	}
+}
+
+// rotatingWriter rotates the server configs of the manager before the first message written.
+type rotatingWriter struct {
+	io.Writer
+	manager *ServerConfigManager
+	rotated bool
+}
+
+func (this *rotatingWriter) Write(b []byte) (int, error) {
+	if !this.rotated {
+		this.rotated = true
+		if err := this.manager.Rotate(); err != nil {
+			return 0, err
+		}
+	}
+	return this.Writer.Write(b)
+}
+
+func Test_ServerConfig_Export(t *testing.T) {
+	config, err := NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+	masterKey := bytes.Repeat([]byte{0x42}, SERVER_CONFIG_MASTER_KEY_SIZE)
+	exported, err := config.Export(masterKey)
+	if err != nil {
+		t.Fatalf("ServerConfig.Export : unexpected error %v", err)
+	}
+
+	// The imported server config has the same SCFG and private keys
+	imported, err := ImportServerConfig(exported, masterKey)
+	if err != nil {
+		t.Fatalf("ImportServerConfig : unexpected error %v", err)
+	}
+	if !bytes.Equal(imported.Serialize(), config.Serialize()) || len(imported.kex) != len(config.kex) {
+		t.Fatalf("ImportServerConfig : server config of the exported one expected")
+	}
+	for i, kex := range config.kex {
+		if !bytes.Equal(imported.kex[i].PrivateKey(), kex.PrivateKey()) {
+			t.Errorf("ImportServerConfig : private key of the exported server config expected in test n°%v", i)
+		}
+	}
+
+	// Another master key, a corrupted export and a parsed server config are rejected
+	corrupted := append([]byte(nil), exported...)
+	corrupted[len(corrupted)-1] ^= 1
+	var tests_import = []struct {
+		b         []byte
+		masterKey []byte
+	}{
+		{exported, bytes.Repeat([]byte{0x43}, SERVER_CONFIG_MASTER_KEY_SIZE)},
+		{exported, masterKey[:8]},
+		{corrupted, masterKey},
+		{exported[:10], masterKey},
+	}
+	for i, v := range tests_import {
+		if _, err = ImportServerConfig(v.b, v.masterKey); err == nil {
+			t.Errorf("ImportServerConfig : error expected in test n°%v", i)
+		}
+	}
+	parsed, _ := ParseServerConfig(config.Serialize())
+	if _, err = parsed.Export(masterKey); err == nil {
+		t.Errorf("ServerConfig.Export : error expected for a parsed server config")
+	}
+
+	// A ServerConfigManager rotates to the configs of its source
+	manager, err := NewServerConfigManager(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfigManager : unexpected error %v", err)
+	}
+	manager.SetSource(func() (*ServerConfig, error) {
+		return ImportServerConfig(exported, masterKey)
+	})
+	if err = manager.Rotate(); err != nil {
+		t.Fatalf("ServerConfigManager.Rotate : unexpected error %v", err)
+	}
+	if !bytes.Equal(manager.Current().GetID(), config.GetID()) {
+		t.Errorf("ServerConfigManager.Rotate : server config of the source expected")
+	}
+}
+
+func Test_ProofVerifier(t *testing.T) {
+	cert, roots := testCertificate(t)
+	ca, err := tls.LoadX509KeyPair("../testdata/ca.pem", "../testdata/ca.key")
+	if err != nil {
+		t.Fatalf("tls.LoadX509KeyPair : unexpected error %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(ca.Certificate[0])
+
+	// An RSA certificate of localhost signed by the test CA
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &rsaKey.PublicKey, ca.PrivateKey)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate : unexpected error %v", err)
+	}
+	rsaCert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: rsaKey}
+
+	chlo, scfg := []byte("CHLO"), []byte("SCFG")
+	var tests_proofs = []struct {
+		cert     tls.Certificate
+		hostname string
+		roots    *x509.CertPool
+		chlo     []byte
+		x509Err  error
+		valid    bool
+	}{
+		{cert, "localhost", roots, chlo, nil, true},
+		{rsaCert, "localhost", roots, chlo, nil, true},
+		{cert, "127.0.0.1", roots, chlo, nil, true},
+		{cert, "example.org", roots, chlo, x509.HostnameError{}, false},
+		{cert, "localhost", x509.NewCertPool(), chlo, x509.UnknownAuthorityError{}, false},
+		{cert, "localhost", roots, []byte("another CHLO"), nil, false},
+		{rsaCert, "localhost", roots, []byte("another CHLO"), nil, false},
+	}
+	for i, v := range tests_proofs {
+		signer, err := NewProofSigner(v.cert)
+		if err != nil {
+			t.Fatalf("NewProofSigner : unexpected error %v in test n°%v", err, i)
+		}
+		proof, err := signer.SignProof(chlo, scfg)
+		if err != nil {
+			t.Fatalf("ProofSigner.SignProof : unexpected error %v in test n°%v", err, i)
+		}
+		err = NewProofVerifier(v.roots).VerifyProof(v.hostname, signer.GetCertificateChain(), proof, v.chlo, scfg)
+		if v.valid {
+			if err != nil {
+				t.Errorf("ProofVerifier.VerifyProof : unexpected error %v in test n°%v", err, i)
+			}
+			continue
+		}
+		if perr, ok := err.(ErrProofInvalid); !ok || perr.ErrorCode() != protocol.QUIC_PROOF_INVALID {
+			t.Errorf("ProofVerifier.VerifyProof : ErrProofInvalid expected instead of %v in test n°%v", err, i)
+		}
+		switch v.x509Err.(type) {
+		case x509.HostnameError:
+			var herr x509.HostnameError
+			if !errors.As(err, &herr) {
+				t.Errorf("ProofVerifier.VerifyProof : x509.HostnameError expected instead of %v in test n°%v", err, i)
+			}
+		case x509.UnknownAuthorityError:
+			var uerr x509.UnknownAuthorityError
+			if !errors.As(err, &uerr) {
+				t.Errorf("ProofVerifier.VerifyProof : x509.UnknownAuthorityError expected instead of %v in test n°%v", err, i)
+			}
+		}
+	}
+
+	// Invalid certificate chains
+	for i, chain := range [][][]byte{nil, {[]byte("garbage")}} {
+		if err := NewProofVerifier(roots).VerifyProof("localhost", chain, []byte("proof"), chlo, scfg); err == nil {
+			t.Errorf("ProofVerifier.VerifyProof : error expected for an invalid chain in test n°%v", i)
+		}
+	}
+}
+
+func Test_CryptoClient_InvalidProof(t *testing.T) {
+	config, err := NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+	cert, roots := testCertificate(t)
+	config.SetCertificate(cert)
+	params := NegotiatedParams{IdleTimeout: 30 * time.Second}
+
+	// The certificate isn't valid for the hostname: the client doesn't send the full CHLO
+	clientPipe, serverPipe := newTestPipes()
+	recorded := new(bytes.Buffer)
+	closer := clientPipe.Writer.(io.Closer)
+	clientPipe.Writer = io.MultiWriter(clientPipe.Writer, recorded)
+	keys := new(testKeyHandler)
+	client := NewCryptoClient(clientPipe, 0x1234, "example.org", protocol.QUIC_VERSION_39, protocol.QUIC_VERSION_39, params,
+		NewProofVerifier(roots), keys)
+	server := NewCryptoServer(serverPipe, 0x1234, testClientAddr, protocol.QUIC_VERSION_39, protocol.SupportedVersions(), config, params, new(testKeyHandler))
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Run()
+	}()
+	err = client.Run()
+	var herr x509.HostnameError
+	if _, ok := err.(ErrProofInvalid); !ok || !errors.As(err, &herr) {
+		t.Errorf("CryptoClient.Run : ErrProofInvalid with x509.HostnameError expected instead of %v", err)
+	}
+	closer.Close()
+	<-done
+	if msg, _ := protocol.ReadHandshakeMessage(recorded); msg == nil || recorded.Len() != 0 || len(keys.keys) != 0 {
+		t.Errorf("CryptoClient : only the inchoate CHLO expected")
+	}
+}
+
+func Test_ClientSessionCache_LRU(t *testing.T) {
+	cache := NewLRUClientSessionCache(2)
+	states := []*ClientSessionState{{Proof: []byte("a")}, {Proof: []byte("b")}, {Proof: []byte("c")}}
+
+	// "a" is used after "b" was stored, "b" is evicted by "c"
+	cache.Put("a", states[0])
+	cache.Put("b", states[1])
+	cache.Get("a")
+	cache.Put("c", states[2])
+	var tests_lru = []struct {
+		hostname string
+		state    *ClientSessionState
+	}{
+		{"a", states[0]},
+		{"b", nil},
+		{"c", states[2]},
+	}
+	for i, v := range tests_lru {
+		if state, ok := cache.Get(v.hostname); state != v.state || ok != (v.state != nil) {
+			t.Errorf("ClientSessionCache.Get : state %v expected instead of %v in test n°%v", v.state, state, i)
+		}
+	}
+
+	// A nil state removes the entry
+	cache.Put("a", nil)
+	if _, ok := cache.Get("a"); ok {
+		t.Errorf("ClientSessionCache.Put : the nil state must remove the entry")
+	}
+	if NewLRUClientSessionCache(0).(*lruClientSessionCache).capacity != DEFAULT_CLIENT_SESSION_CACHE_SIZE {
+		t.Errorf("NewLRUClientSessionCache : default capacity expected")
+	}
+}
+
+// recordingSessionCache records the states put in the cache.
+type recordingSessionCache struct {
+	ClientSessionCache
+	puts []*ClientSessionState
+}
+
+func (this *recordingSessionCache) Put(hostname string, state *ClientSessionState) {
+	this.puts = append(this.puts, state)
+	this.ClientSessionCache.Put(hostname, state)
+}
+
+func Test_CryptoClient_SessionCache(t *testing.T) {
+	first, err := NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+	second, err := NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+	cert, roots := testCertificate(t)
+	for _, config := range []*ServerConfig{first, second} {
+		if err = config.SetCertificate(cert); err != nil {
+			t.Fatalf("ServerConfig.SetCertificate : unexpected error %v", err)
+		}
+	}
+	params := NegotiatedParams{IdleTimeout: 30 * time.Second}
+
+	// The cached server config saves the inchoate CHLO, an unknown one is removed from the cache by the REJ before the new state
+	var tests_cache = []struct {
+		server *ServerConfig
+		chlos  int
+		puts   int
+	}{
+		{first, 2, 1},
+		{first, 1, 1},
+		{second, 2, 2},
+		{second, 1, 1},
+	}
+	cache := NewLRUClientSessionCache(0)
+	for i, v := range tests_cache {
+		recording := &recordingSessionCache{ClientSessionCache: cache}
+		clientPipe, serverPipe := newTestPipes()
+		client := NewCryptoClient(clientPipe, 0x1234, "localhost", protocol.QUIC_VERSION_39, protocol.QUIC_VERSION_39, params,
+			NewProofVerifier(roots), new(testKeyHandler))
+		client.SetSessionCache(recording)
+		server := NewCryptoServer(serverPipe, 0x1234, testClientAddr, protocol.QUIC_VERSION_39, protocol.SupportedVersions(), v.server, params,
+			new(testKeyHandler))
+		done := make(chan error, 1)
+		go func() {
+			done <- server.Run()
+		}()
+		if err = client.Run(); err != nil {
+			t.Fatalf("CryptoClient.Run : unexpected error %v in test n°%v", err, i)
+		}
+		if err = <-done; err != nil {
+			t.Fatalf("CryptoServer.Run : unexpected error %v in test n°%v", err, i)
+		}
+		if n := client.GetClientHellosSent(); n != v.chlos {
+			t.Errorf("CryptoClient : %v CHLO expected instead of %v in test n°%v", v.chlos, n, i)
+		}
+		if len(recording.puts) != v.puts || (v.puts == 2 && recording.puts[0] != nil) {
+			t.Errorf("ClientSessionCache.Put : %v states expected instead of %v in test n°%v", v.puts, recording.puts, i)
+		}
+		state, ok := cache.Get("localhost")
+		if !ok || !bytes.Equal(state.ServerConfig.GetID(), v.server.GetID()) || state.SourceAddressToken == nil {
+			t.Errorf("ClientSessionCache.Get : state of the server config expected in test n°%v", i)
+		}
+	}
+}
+
+func Test_Handshake_KeyLogWriter(t *testing.T) {
+	config, err := NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+	params := NegotiatedParams{IdleTimeout: 30 * time.Second}
+	clientPipe, serverPipe := newTestPipes()
+	var clientLog, serverLog bytes.Buffer
+	client := NewCryptoClient(clientPipe, 0x1234, "localhost", protocol.QUIC_VERSION_39, protocol.QUIC_VERSION_39, params, nil, new(testKeyHandler))
+	client.SetKeyLogWriter(&clientLog)
+	server := NewCryptoServer(serverPipe, 0x1234, testClientAddr, protocol.QUIC_VERSION_39, protocol.SupportedVersions(), config, params,
+		new(testKeyHandler))
+	server.SetKeyLogWriter(&serverLog)
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Run()
+	}()
+	if err = client.Run(); err != nil {
+		t.Fatalf("CryptoClient.Run : unexpected error %v", err)
+	}
+	if err = <-done; err != nil {
+		t.Fatalf("CryptoServer.Run : unexpected error %v", err)
+	}
+
+	// Both sides log the initial then the forward-secure keys of both directions, the same ones but the diversified initial keys of the server
+	var tests_keylog = []struct {
+		label string
+		same  bool
+	}{
+		{"QUIC_CLIENT_INITIAL", true},
+		{"QUIC_SERVER_INITIAL", false},
+		{"QUIC_CLIENT_FORWARD_SECURE", true},
+		{"QUIC_SERVER_FORWARD_SECURE", true},
+	}
+	clientLines := strings.Split(strings.TrimSuffix(clientLog.String(), "\n"), "\n")
+	serverLines := strings.Split(strings.TrimSuffix(serverLog.String(), "\n"), "\n")
+	if len(clientLines) != len(tests_keylog) || len(serverLines) != len(tests_keylog) {
+		t.Fatalf("KeyLogWriter : %v lines expected instead of %v and %v", len(tests_keylog), len(clientLines), len(serverLines))
+	}
+	for i, v := range tests_keylog {
+		c, s := strings.Fields(clientLines[i]), strings.Fields(serverLines[i])
+		if len(c) != 4 || len(s) != 4 || c[0] != v.label || s[0] != v.label || c[1] != "0000000000001234" || s[1] != c[1] {
+			t.Errorf("KeyLogWriter : %v line expected instead of %q and %q in test n°%v", v.label, clientLines[i], serverLines[i], i)
+			continue
+		}
+		if len(c[2]) != 32 || len(c[3]) != 2*AEAD_IV_SIZE {
+			t.Errorf("KeyLogWriter : hexadecimal key and IV expected instead of %q in test n°%v", clientLines[i], i)
+		}
+		if (c[2] == s[2] && c[3] == s[3]) != v.same {
+			t.Errorf("KeyLogWriter : the keys of the client and server must be the same (%v) instead of %q and %q in test n°%v", v.same, clientLines[i], serverLines[i], i)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package handshake
+
+import "github.com/romain-jacotin/quic/protocol"
+import "fmt"
+import "io"
+import "sync"
+
+// keyLogMutex serializes the lines written on the key log writers, shared by all the connections.
+var keyLogMutex sync.Mutex
+
+// writeKeyLog writes the keys and IVs of an encryption level on the key log writer, one line per direction:
+//
+//	QUIC_<CLIENT|SERVER>_<INITIAL|FORWARD_SECURE> <connection ID> <key> <IV>
+//
+// with the connection ID, the key and the IV in lowercase hexadecimal, like the NSS key log format of TLS.
+// The initial keys of the server logged by the client are not diversified yet: the server logs them diversified with
+// the nonce sent in the public header of its initial packets. The write errors are ignored.
+func writeKeyLog(w io.Writer, connID protocol.QuicConnectionID, level protocol.EncryptionLevel, clientKey, clientIV, serverKey, serverIV []byte) {
+	label := "INITIAL"
+	if level == protocol.ENCRYPTION_FORWARD_SECURE {
+		label = "FORWARD_SECURE"
+	}
+	line := fmt.Sprintf("QUIC_CLIENT_%s %v %x %x\nQUIC_SERVER_%s %v %x %x\n", label, connID, clientKey, clientIV, label, connID, serverKey, serverIV)
+	keyLogMutex.Lock()
+	w.Write([]byte(line))
+	keyLogMutex.Unlock()
+}
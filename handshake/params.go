@@ -0,0 +1,255 @@
+package handshake
+
+import "github.com/romain-jacotin/quic/protocol"
+import "encoding/binary"
+import "time"
+
+const (
+	// DEFAULT_IDLE_TIMEOUT is the idle timeout (ICSL) of ApplyDefaults
+	DEFAULT_IDLE_TIMEOUT = 30 * time.Second
+	// DEFAULT_MAX_STREAMS is the maximum number of streams per connection (MSPC) of ApplyDefaults
+	DEFAULT_MAX_STREAMS = 100
+	// DEFAULT_FLOW_CONTROL_WINDOW is the initial stream and connection receive window (SFCW and CFCW) of ApplyDefaults,
+	// and of a peer that doesn't send it
+	DEFAULT_FLOW_CONTROL_WINDOW = 16 * 1024
+	// MIN_FLOW_CONTROL_WINDOW is the smallest flow control window accepted from the peer
+	MIN_FLOW_CONTROL_WINDOW = 16 * 1024
+)
+
+// NegotiatedParams are the transport parameters of the connection: each endpoint proposes its values in the full CHLO or the SHLO.
+//
+// The smallest idle timeout and maximum number of streams are used by both endpoints. The flow control windows are the initial
+// receive windows of the endpoint, they are the send windows of its peer: once negotiated, the windows are those of the peer.
+// The Connection ID is truncated if both endpoints propose it.
+type NegotiatedParams struct {
+	// IdleTimeout is the idle connection state lifetime (ICSL), sent in seconds
+	IdleTimeout time.Duration
+	// MaxStreams is the maximum number of open streams per connection (MSPC)
+	MaxStreams uint32
+	// StreamFlowControlWindow is the initial receive window of the streams (SFCW)
+	StreamFlowControlWindow protocol.QuicByteOffset
+	// ConnectionFlowControlWindow is the initial receive window of the connection (CFCW)
+	ConnectionFlowControlWindow protocol.QuicByteOffset
+	// TruncateConnectionID proposes to omit the Connection ID of the packets of both endpoints (TCID = 0)
+	TruncateConnectionID bool
+	// NextProtos are the application protocols (ALPN) proposed by the client, or supported by the server in its order of preference
+	NextProtos []string
+	// NegotiatedProtocol is the application protocol selected by the server in the SHLO, empty if the client or the server has none
+	NegotiatedProtocol string
+	// PublicResetNonceProof is the nonce proof of the public resets of the server for the connection (RNON), sent in the SHLO:
+	// zero if the server sends none
+	PublicResetNonceProof uint64
+}
+
+// ErrNoApplicationProtocol fails the handshake of a server whose application protocols are not proposed by the client.
+var ErrNoApplicationProtocol = ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_MESSAGE_PARAMETER_NO_OVERLAP, Reason: "no common application protocol"}
+
+// ApplyDefaults sets the default value of the zero parameters.
+func (this *NegotiatedParams) ApplyDefaults() {
+	if this.IdleTimeout == 0 {
+		this.IdleTimeout = DEFAULT_IDLE_TIMEOUT
+	}
+	if this.MaxStreams == 0 {
+		this.MaxStreams = DEFAULT_MAX_STREAMS
+	}
+	if this.StreamFlowControlWindow == 0 {
+		this.StreamFlowControlWindow = DEFAULT_FLOW_CONTROL_WINDOW
+	}
+	if this.ConnectionFlowControlWindow == 0 {
+		this.ConnectionFlowControlWindow = DEFAULT_FLOW_CONTROL_WINDOW
+	}
+}
+
+// ParseFromCHLO reads the parameters proposed by the client in the full CHLO.
+func (this *NegotiatedParams) ParseFromCHLO(msg *protocol.HandshakeMessage) error {
+	err := this.parse(msg)
+	if err != nil {
+		return err
+	}
+	this.NextProtos, err = parseProtocols(msg)
+	return err
+}
+
+// ParseFromSHLO reads the parameters returned by the server in the SHLO.
+func (this *NegotiatedParams) ParseFromSHLO(msg *protocol.HandshakeMessage) error {
+	if err := this.parse(msg); err != nil {
+		return err
+	}
+	protos, err := parseProtocols(msg)
+	if err != nil {
+		return err
+	}
+	switch len(protos) {
+	case 0:
+		this.NegotiatedProtocol = ""
+	case 1:
+		this.NegotiatedProtocol = protos[0]
+	default:
+		return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: "several application protocols selected"}
+	}
+	this.PublicResetNonceProof = 0
+	if rnon, ok := msg.GetTag(protocol.TagRNON); ok {
+		if len(rnon) != 8 {
+			return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: "invalid RNON"}
+		}
+		this.PublicResetNonceProof = binary.LittleEndian.Uint64(rnon)
+	}
+	return nil
+}
+
+// parse reads the ICSL and MSPC tags, mandatory, the flow control windows that default to DEFAULT_FLOW_CONTROL_WINDOW, and the TCID.
+func (this *NegotiatedParams) parse(msg *protocol.HandshakeMessage) error {
+	icsl, err := requireUint32(msg, protocol.TagICSL)
+	if err != nil {
+		return err
+	}
+	mspc, err := requireUint32(msg, protocol.TagMSPC)
+	if err != nil {
+		return err
+	}
+	if icsl == 0 || mspc == 0 {
+		return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: "invalid ICSL or MSPC"}
+	}
+	this.IdleTimeout = time.Duration(icsl) * time.Second
+	this.MaxStreams = mspc
+	for _, window := range []struct {
+		tag   protocol.MessageTag
+		value *protocol.QuicByteOffset
+	}{
+		{protocol.TagSFCW, &this.StreamFlowControlWindow},
+		{protocol.TagCFCW, &this.ConnectionFlowControlWindow},
+	} {
+		*window.value = DEFAULT_FLOW_CONTROL_WINDOW
+		if _, ok := msg.GetTag(window.tag); !ok {
+			continue
+		}
+		v, err := requireUint32(msg, window.tag)
+		if err != nil {
+			return err
+		}
+		if v < MIN_FLOW_CONTROL_WINDOW {
+			return ErrHandshakeFailed{Code: protocol.QUIC_FLOW_CONTROL_INVALID_WINDOW, Reason: "flow control window " + tagString(window.tag) + " too small"}
+		}
+		*window.value = protocol.QuicByteOffset(v)
+	}
+	tcid, ok := msg.GetTag(protocol.TagTCID)
+	if ok && len(tcid) != 4 {
+		return ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: "invalid TCID"}
+	}
+	this.TruncateConnectionID = ok && binary.LittleEndian.Uint32(tcid) == 0
+	return nil
+}
+
+// negotiate returns the parameters of the connection: the smallest idle timeout and maximum number of streams,
+// the flow control windows of the peer, and the truncation of the Connection ID if both endpoints propose it.
+func (this NegotiatedParams) negotiate(peer NegotiatedParams) NegotiatedParams {
+	params := peer
+	params.TruncateConnectionID = this.TruncateConnectionID && peer.TruncateConnectionID
+	params.IdleTimeout = time.Duration(icslSeconds(this.IdleTimeout)) * time.Second
+	if peer.IdleTimeout < params.IdleTimeout {
+		params.IdleTimeout = peer.IdleTimeout
+	}
+	if this.MaxStreams < params.MaxStreams {
+		params.MaxStreams = this.MaxStreams
+	}
+	return params
+}
+
+// selectProtocol returns the first application protocol of the server proposed by the client, or ErrNoApplicationProtocol.
+// There is no application protocol if the client or the server has none.
+func (this NegotiatedParams) selectProtocol(proposed []string) (string, error) {
+	if len(this.NextProtos) == 0 || len(proposed) == 0 {
+		return "", nil
+	}
+	for _, p := range this.NextProtos {
+		if containsProtocol(proposed, p) {
+			return p, nil
+		}
+	}
+	return "", ErrNoApplicationProtocol
+}
+
+// containsProtocol returns true if the application protocol is in the list.
+func containsProtocol(protos []string, proto string) bool {
+	for _, p := range protos {
+		if p == proto {
+			return true
+		}
+	}
+	return false
+}
+
+// icslSeconds returns the ICSL value of the idle timeout, rounded up to the second.
+func icslSeconds(d time.Duration) uint32 {
+	return uint32((d + time.Second - 1) / time.Second)
+}
+
+// setParams sets the tags of the proposed parameters in the message.
+func setParams(msg *protocol.HandshakeMessage, params NegotiatedParams) {
+	setUint32(msg, protocol.TagICSL, icslSeconds(params.IdleTimeout))
+	setUint32(msg, protocol.TagMSPC, params.MaxStreams)
+	setUint32(msg, protocol.TagSFCW, uint32(params.StreamFlowControlWindow))
+	setUint32(msg, protocol.TagCFCW, uint32(params.ConnectionFlowControlWindow))
+	if params.TruncateConnectionID {
+		setUint32(msg, protocol.TagTCID, 0)
+	}
+	switch {
+	case params.NegotiatedProtocol != "":
+		msg.SetTag(protocol.TagALPN, encodeProtocols([]string{params.NegotiatedProtocol}))
+	case len(params.NextProtos) > 0:
+		msg.SetTag(protocol.TagALPN, encodeProtocols(params.NextProtos))
+	}
+	if params.PublicResetNonceProof != 0 {
+		rnon := make([]byte, 8)
+		binary.LittleEndian.PutUint64(rnon, params.PublicResetNonceProof)
+		msg.SetTag(protocol.TagRNON, rnon)
+	}
+}
+
+// encodeProtocols returns the ALPN value of the application protocols, each one after its 8-bit length.
+func encodeProtocols(protos []string) []byte {
+	var b []byte
+	for _, p := range protos {
+		b = append(b, byte(len(p)))
+		b = append(b, p...)
+	}
+	return b
+}
+
+// parseProtocols returns the application protocols of the ALPN tag, none without the tag.
+func parseProtocols(msg *protocol.HandshakeMessage) ([]string, error) {
+	b, ok := msg.GetTag(protocol.TagALPN)
+	if !ok {
+		return nil, nil
+	}
+	var protos []string
+	for len(b) > 0 {
+		l := int(b[0])
+		if l == 0 || len(b) < 1+l {
+			return nil, ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: "invalid ALPN"}
+		}
+		protos = append(protos, string(b[1:1+l]))
+		b = b[1+l:]
+	}
+	return protos, nil
+}
+
+// setUint32 sets the 32-bit Little Endian value of the tag.
+func setUint32(msg *protocol.HandshakeMessage, tag protocol.MessageTag, v uint32) {
+	var b [4]byte
+
+	binary.LittleEndian.PutUint32(b[:], v)
+	msg.SetTag(tag, b[:])
+}
+
+// requireUint32 returns the 32-bit Little Endian value of a mandatory tag.
+func requireUint32(msg *protocol.HandshakeMessage, tag protocol.MessageTag) (uint32, error) {
+	b, err := requireTag(msg, tag)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) != 4 {
+		return 0, ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: "invalid " + tagString(tag)}
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
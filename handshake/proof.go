@@ -0,0 +1,146 @@
+package handshake
+
+import "github.com/romain-jacotin/quic/protocol"
+import gocrypto "crypto"
+import "crypto/ecdsa"
+import "crypto/rand"
+import "crypto/rsa"
+import "crypto/sha256"
+import "crypto/tls"
+import "crypto/x509"
+import "encoding/binary"
+import "errors"
+import "fmt"
+
+// PROOF_SIGNATURE_LABEL starts the data signed by the proof of the server config (PROF).
+const PROOF_SIGNATURE_LABEL = "QUIC CHLO and server config signature\x00"
+
+// ErrProofInvalid is returned by the client when the certificate chain or the proof of the server config can't be verified,
+// the x509 error explains the rejection of the chain.
+type ErrProofInvalid struct {
+	Reason string
+	Err    error
+}
+
+func (this ErrProofInvalid) Error() string {
+	if this.Err != nil {
+		return fmt.Sprintf("ProofVerifier : %s : %v", this.Reason, this.Err)
+	}
+	return "ProofVerifier : " + this.Reason
+}
+
+// Unwrap returns the x509 error, like x509.HostnameError or x509.UnknownAuthorityError.
+func (this ErrProofInvalid) Unwrap() error {
+	return this.Err
+}
+
+// ErrorCode returns QUIC_PROOF_INVALID.
+func (this ErrProofInvalid) ErrorCode() protocol.QuicErrorCode {
+	return protocol.QUIC_PROOF_INVALID
+}
+
+// ProofSigner signs the proofs of the server config (PROF) with the private key of a certificate: RSA-PSS or ECDSA with SHA-256.
+type ProofSigner struct {
+	chain  [][]byte
+	signer gocrypto.Signer
+}
+
+// NewProofSigner returns the ProofSigner of the certificate chain and its private key.
+func NewProofSigner(cert tls.Certificate) (*ProofSigner, error) {
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("NewProofSigner : empty certificate chain")
+	}
+	signer, ok := cert.PrivateKey.(gocrypto.Signer)
+	if !ok {
+		return nil, errors.New("NewProofSigner : the private key can't sign")
+	}
+	switch signer.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, errors.New("NewProofSigner : RSA or ECDSA private key expected")
+	}
+	return &ProofSigner{chain: cert.Certificate, signer: signer}, nil
+}
+
+// GetCertificateChain returns the DER certificates of the chain, the leaf first.
+func (this *ProofSigner) GetCertificateChain() [][]byte {
+	return this.chain
+}
+
+// SignProof returns the proof of the server config for the CHLO.
+func (this *ProofSigner) SignProof(chlo, scfg []byte) ([]byte, error) {
+	var opts gocrypto.SignerOpts = gocrypto.SHA256
+	if _, ok := this.signer.Public().(*rsa.PublicKey); ok {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: gocrypto.SHA256}
+	}
+	return this.signer.Sign(rand.Reader, proofDigest(chlo, scfg), opts)
+}
+
+// ProofVerifier verifies the certificate chain of the server against the root certificate authorities and the hostname (SNI),
+// then the proof of the server config with the public key of the leaf certificate.
+type ProofVerifier struct {
+	roots *x509.CertPool
+}
+
+// NewProofVerifier returns the ProofVerifier of the root certificate authorities, the system ones if nil.
+func NewProofVerifier(roots *x509.CertPool) *ProofVerifier {
+	return &ProofVerifier{roots: roots}
+}
+
+// VerifyProof returns nil if the certificate chain is valid for the hostname and the proof is the signature of the CHLO
+// and of the server config by the leaf certificate, ErrProofInvalid otherwise.
+func (this *ProofVerifier) VerifyProof(hostname string, chain [][]byte, proof, chlo, scfg []byte) error {
+	if len(chain) == 0 {
+		return ErrProofInvalid{Reason: "empty certificate chain"}
+	}
+	certs := make([]*x509.Certificate, len(chain))
+	for i, der := range chain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return ErrProofInvalid{Reason: "invalid certificate", Err: err}
+		}
+		certs[i] = cert
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       hostname,
+		Roots:         this.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+	if err != nil {
+		return ErrProofInvalid{Reason: "invalid certificate chain", Err: err}
+	}
+
+	digest := proofDigest(chlo, scfg)
+	switch pub := certs[0].PublicKey.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPSS(pub, gocrypto.SHA256, digest, proof, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, proof) {
+			err = errors.New("invalid ECDSA signature")
+		}
+	default:
+		return ErrProofInvalid{Reason: "RSA or ECDSA certificate expected"}
+	}
+	if err != nil {
+		return ErrProofInvalid{Reason: "invalid signature of the server config", Err: err}
+	}
+	return nil
+}
+
+// proofDigest returns the SHA-256 digest signed by the proof: the label, the length and the SHA-256 hash of the CHLO, then the server config.
+func proofDigest(chlo, scfg []byte) []byte {
+	var size [4]byte
+
+	chloHash := sha256.Sum256(chlo)
+	binary.LittleEndian.PutUint32(size[:], uint32(len(chloHash)))
+	h := sha256.New()
+	h.Write([]byte(PROOF_SIGNATURE_LABEL))
+	h.Write(size[:])
+	h.Write(chloHash[:])
+	h.Write(scfg)
+	return h.Sum(nil)
+}
@@ -0,0 +1,325 @@
+package handshake
+
+import "github.com/romain-jacotin/quic/crypto"
+import "github.com/romain-jacotin/quic/protocol"
+import "bytes"
+import "crypto/rand"
+import "crypto/tls"
+import "encoding/binary"
+import "errors"
+import "io"
+import "time"
+
+const (
+	// SERVER_CONFIG_ID_SIZE is the size of the server config ID (SCID)
+	SERVER_CONFIG_ID_SIZE = 16
+	// SERVER_CONFIG_MASTER_KEY_SIZE is the size of the AES-128 master key sealing the private keys of the exported server configs
+	SERVER_CONFIG_MASTER_KEY_SIZE = 16
+	// serverConfigNonceSize is the size of the random AES-GCM nonce of the exported server configs
+	serverConfigNonceSize = 12
+)
+
+// ServerConfig is the server config (SCFG) sent in the REJ messages: the Curve25519 and P-256 public values of the server,
+// the supported AEADs and the expiry. The configs of the server also own the private keys, the parsed ones don't.
+//
+// The configs of the server hold the crypto state shared by the connections: the certificate signing the proofs,
+// the source-address tokens and the strike register of the client nonces.
+type ServerConfig struct {
+	id         []byte
+	kexs       []protocol.MessageTag
+	kex        []crypto.KeyExchange
+	publicKeys [][]byte
+	orbit      []byte
+	aeads      []protocol.MessageTag
+	expiry     time.Time
+	serialized []byte
+
+	signer  *ProofSigner
+	tokens  *SourceAddressTokens
+	strikes *strikeRegister
+}
+
+// NewServerConfig returns a new server config with a random ID and new Curve25519 and P-256 key pairs, valid for the lifetime.
+// It has a self-signed certificate for localhost valid for a year, and source-address tokens valid for DEFAULT_SOURCE_ADDRESS_TOKEN_LIFETIME.
+func NewServerConfig(lifetime time.Duration) (*ServerConfig, error) {
+	var expiry [8]byte
+
+	this := &ServerConfig{
+		id:     make([]byte, SERVER_CONFIG_ID_SIZE),
+		kexs:   []protocol.MessageTag{protocol.TagC255, protocol.TagP256},
+		orbit:  make([]byte, 8),
+		aeads:  SupportedAEADs(),
+		expiry: time.Now().Add(lifetime).Truncate(time.Second)}
+	for _, t := range this.kexs {
+		err, kex := crypto.NewKeyExchange(t)
+		if err != nil {
+			return nil, err
+		}
+		this.kex = append(this.kex, kex)
+		this.publicKeys = append(this.publicKeys, kex.PublicKey())
+	}
+	if _, err := io.ReadFull(rand.Reader, this.id); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, this.orbit); err != nil {
+		return nil, err
+	}
+	if err := this.initServer(); err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint64(expiry[:], uint64(this.expiry.Unix()))
+
+	msg := protocol.NewHandshakeMessage(protocol.TagSCFG)
+	msg.SetTag(protocol.TagSCID, this.id)
+	msg.SetTag(protocol.TagKEXS, tagList(this.kexs...))
+	msg.SetTag(protocol.TagAEAD, tagList(this.aeads...))
+	msg.SetTag(protocol.TagPUBS, encodePublicValues(this.publicKeys))
+	msg.SetTag(protocol.TagORBT, this.orbit)
+	msg.SetTag(protocol.TagEXPY, expiry[:])
+	this.serialized = msg.Serialize()
+	return this, nil
+}
+
+// initServer creates the crypto state of a config of the server: a self-signed certificate, the source-address tokens
+// and the strike register.
+func (this *ServerConfig) initServer() (err error) {
+	cert, err := generateCertificate(365 * 24 * time.Hour)
+	if err != nil {
+		return
+	}
+	if this.signer, err = NewProofSigner(cert); err != nil {
+		return
+	}
+	if this.tokens, err = NewSourceAddressTokens(DEFAULT_SOURCE_ADDRESS_TOKEN_LIFETIME, false); err != nil {
+		return
+	}
+	this.strikes = newStrikeRegister(this.orbit, STRIKE_REGISTER_WINDOW)
+	return
+}
+
+// ParseServerConfig parses the SCFG value of a REJ message.
+func ParseServerConfig(b []byte) (*ServerConfig, error) {
+	msg, err := protocol.ParseHandshakeMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	if msg.GetMessageTag() != protocol.TagSCFG {
+		return nil, errors.New("ParseServerConfig : SCFG message expected")
+	}
+	this := &ServerConfig{serialized: append([]byte(nil), b...)}
+	if this.id, err = requireTag(msg, protocol.TagSCID); err != nil {
+		return nil, err
+	}
+	kexs, err := requireTag(msg, protocol.TagKEXS)
+	if err != nil {
+		return nil, err
+	}
+	this.kexs = parseTagList(kexs)
+	if selectKeyExchange(this.kexs) == 0 {
+		return nil, ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_MESSAGE_PARAMETER_NO_OVERLAP, Reason: "no common key exchange"}
+	}
+	aeads, err := requireTag(msg, protocol.TagAEAD)
+	if err != nil {
+		return nil, err
+	}
+	this.aeads = parseTagList(aeads)
+	pubs, err := requireTag(msg, protocol.TagPUBS)
+	if err != nil {
+		return nil, err
+	}
+	if this.publicKeys, err = decodePublicValues(pubs); err != nil {
+		return nil, err
+	}
+	if len(this.publicKeys) != len(this.kexs) {
+		return nil, ErrHandshakeFailed{Code: protocol.QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER, Reason: "a public value per key exchange expected"}
+	}
+	if this.orbit, err = requireTag(msg, protocol.TagORBT); err != nil {
+		return nil, err
+	}
+	if len(this.orbit) != 8 {
+		return nil, ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_INVALID_VALUE_LENGTH, Reason: "invalid ORBT"}
+	}
+	expiry, err := requireTag(msg, protocol.TagEXPY)
+	if err != nil {
+		return nil, err
+	}
+	if len(expiry) != 8 {
+		return nil, ErrHandshakeFailed{Code: protocol.QUIC_CRYPTO_INVALID_VALUE_LENGTH, Reason: "invalid EXPY"}
+	}
+	this.expiry = time.Unix(int64(binary.LittleEndian.Uint64(expiry)), 0)
+	return this, nil
+}
+
+// Export returns the server config with its private keys sealed with AES-128-GCM and the master key, so that the server instances
+// sharing the master key can import it: the length and the SCFG message, the random nonce, then the sealed private keys.
+func (this *ServerConfig) Export(masterKey []byte) ([]byte, error) {
+	if len(this.kex) == 0 {
+		return nil, errors.New("ServerConfig.Export : the private keys of a parsed server config are unknown")
+	}
+	aead, err := newMasterKeyAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	privateKeys := make([][]byte, len(this.kex))
+	for i, kex := range this.kex {
+		privateKeys[i] = kex.PrivateKey()
+	}
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(this.serialized)))
+	b = append(b, this.serialized...)
+	nonce := make([]byte, serverConfigNonceSize)
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	b = append(b, nonce...)
+	return aead.Seal(b, nonce, encodePublicValues(privateKeys), this.serialized), nil
+}
+
+// ImportServerConfig returns the server config exported with the master key, it has a new certificate, source-address tokens
+// and strike register like NewServerConfig.
+func ImportServerConfig(b, masterKey []byte) (*ServerConfig, error) {
+	aead, err := newMasterKeyAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 4 {
+		return nil, errors.New("ImportServerConfig : truncated server config")
+	}
+	size := binary.LittleEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(size)+serverConfigNonceSize {
+		return nil, errors.New("ImportServerConfig : truncated server config")
+	}
+	scfg, nonce, sealed := b[4:4+size], b[4+size:4+size+serverConfigNonceSize], b[4+size+serverConfigNonceSize:]
+	plaintext, err := aead.Open(nil, nonce, sealed, scfg)
+	if err != nil {
+		return nil, errors.New("ImportServerConfig : invalid master key or corrupted server config")
+	}
+	privateKeys, err := decodePublicValues(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	this, err := ParseServerConfig(scfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(privateKeys) != len(this.kexs) {
+		return nil, errors.New("ImportServerConfig : a private key per key exchange expected")
+	}
+	for i, t := range this.kexs {
+		err, kex := crypto.NewKeyExchangeFromPrivateKey(t, privateKeys[i])
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(kex.PublicKey(), this.publicKeys[i]) {
+			return nil, errors.New("ImportServerConfig : private key of another public value")
+		}
+		this.kex = append(this.kex, kex)
+	}
+	if err = this.initServer(); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
+
+// newMasterKeyAEAD returns the AES-128-GCM AEAD of the master key of the exported server configs.
+func newMasterKeyAEAD(masterKey []byte) (*crypto.AesGcmAEAD, error) {
+	if len(masterKey) != SERVER_CONFIG_MASTER_KEY_SIZE {
+		return nil, errors.New("ServerConfig : invalid master key size")
+	}
+	return crypto.NewAesGcmAEAD(masterKey, make([]byte, 4))
+}
+
+// Current returns the server config itself, a single ServerConfig never rotates.
+func (this *ServerConfig) Current() *ServerConfig {
+	return this
+}
+
+// Lookup returns the server config if the ID is its own, nil otherwise.
+func (this *ServerConfig) Lookup(scid []byte) *ServerConfig {
+	if bytes.Equal(scid, this.id) {
+		return this
+	}
+	return nil
+}
+
+// keyExchange returns the key pair and the public value of the key exchange algorithm, nil if the server config doesn't support it.
+func (this *ServerConfig) keyExchange(kexs protocol.MessageTag) (crypto.KeyExchange, []byte) {
+	for i, t := range this.kexs {
+		if t != kexs {
+			continue
+		}
+		if len(this.kex) == 0 {
+			return nil, this.publicKeys[i]
+		}
+		return this.kex[i], this.publicKeys[i]
+	}
+	return nil, nil
+}
+
+// SetCertificate sets the certificate chain sent in the REJ messages, its private key signs the proofs of the server config.
+func (this *ServerConfig) SetCertificate(cert tls.Certificate) error {
+	signer, err := NewProofSigner(cert)
+	if err != nil {
+		return err
+	}
+	this.signer = signer
+	return nil
+}
+
+// SetSourceAddressTokens sets the source-address tokens issued and validated by the server.
+func (this *ServerConfig) SetSourceAddressTokens(tokens *SourceAddressTokens) {
+	this.tokens = tokens
+}
+
+// GetID returns the server config ID (SCID).
+func (this *ServerConfig) GetID() []byte {
+	return this.id
+}
+
+// GetExpiry returns the expiry time of the server config.
+func (this *ServerConfig) GetExpiry() time.Time {
+	return this.expiry
+}
+
+// Serialize returns the serialized SCFG message.
+func (this *ServerConfig) Serialize() []byte {
+	return this.serialized
+}
+
+// tagList returns the value of a tag list: the tags in Little Endian.
+func tagList(tags ...protocol.MessageTag) []byte {
+	b := make([]byte, 4*len(tags))
+	for i, t := range tags {
+		binary.LittleEndian.PutUint32(b[4*i:], uint32(t))
+	}
+	return b
+}
+
+// parseTagList returns the tags of a tag list value, a trailing partial tag is ignored.
+func parseTagList(b []byte) []protocol.MessageTag {
+	tags := make([]protocol.MessageTag, len(b)/4)
+	for i := range tags {
+		tags[i] = protocol.MessageTag(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return tags
+}
+
+// selectKeyExchange returns the first key exchange algorithm of the client supported by the server config, 0 if none:
+// Curve25519 then P-256.
+func selectKeyExchange(kexs []protocol.MessageTag) protocol.MessageTag {
+	for _, t := range []protocol.MessageTag{protocol.TagC255, protocol.TagP256} {
+		if containsTag(kexs, t) {
+			return t
+		}
+	}
+	return 0
+}
+
+// containsTag returns true if the tag is in the list.
+func containsTag(tags []protocol.MessageTag, tag protocol.MessageTag) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
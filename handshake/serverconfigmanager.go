@@ -0,0 +1,129 @@
+package handshake
+
+import "crypto/tls"
+import "sync"
+import "time"
+
+// ServerConfigs gives the server configs to the CryptoServer: the current one sent in the REJ messages,
+// and the ones accepted in a full CHLO by their ID. A ServerConfig and a ServerConfigManager are ServerConfigs.
+type ServerConfigs interface {
+	// Current returns the server config sent in the REJ messages.
+	Current() *ServerConfig
+	// Lookup returns the server config of the ID, nil if it is unknown.
+	Lookup(scid []byte) *ServerConfig
+}
+
+// ServerConfigSource returns the next server config of a rotation, like a config imported from an external storage
+// shared by the server instances.
+type ServerConfigSource func() (*ServerConfig, error)
+
+// ServerConfigManager rotates the server configs of a server: the current server config is sent in the REJ messages,
+// and the previous one stays valid until the next rotation, so that the full CHLOs in flight during a rotation are accepted.
+//
+// The server configs of a ServerConfigManager share a certificate and the source-address tokens.
+type ServerConfigManager struct {
+	mutex    sync.RWMutex
+	lifetime time.Duration
+	source   ServerConfigSource
+	signer   *ProofSigner
+	tokens   *SourceAddressTokens
+	current  *ServerConfig
+	previous *ServerConfig
+}
+
+var _ ServerConfigs = (*ServerConfigManager)(nil)
+var _ ServerConfigs = (*ServerConfig)(nil)
+
+// NewServerConfigManager returns a ServerConfigManager with a new server config, the new server configs are valid for the lifetime.
+func NewServerConfigManager(lifetime time.Duration) (*ServerConfigManager, error) {
+	config, err := NewServerConfig(lifetime)
+	if err != nil {
+		return nil, err
+	}
+	return &ServerConfigManager{
+		lifetime: lifetime,
+		signer:   config.signer,
+		tokens:   config.tokens,
+		current:  config}, nil
+}
+
+// SetSource sets the source of the server configs of the next rotations, instead of new server configs.
+func (this *ServerConfigManager) SetSource(source ServerConfigSource) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.source = source
+}
+
+// SetCertificate sets the certificate chain of the server configs, like ServerConfig.SetCertificate before the server is started.
+func (this *ServerConfigManager) SetCertificate(cert tls.Certificate) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	signer, err := NewProofSigner(cert)
+	if err != nil {
+		return err
+	}
+	for _, config := range []*ServerConfig{this.current, this.previous} {
+		if config != nil {
+			config.signer = signer
+		}
+	}
+	this.signer = signer
+	return nil
+}
+
+// SetSourceAddressTokens sets the source-address tokens of the server configs before the server is started.
+func (this *ServerConfigManager) SetSourceAddressTokens(tokens *SourceAddressTokens) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, config := range []*ServerConfig{this.current, this.previous} {
+		if config != nil {
+			config.SetSourceAddressTokens(tokens)
+		}
+	}
+	this.tokens = tokens
+}
+
+// Rotate makes the next server config current, from the source or a new one, and keeps the current one as the previous one.
+// The server config before is forgotten.
+func (this *ServerConfigManager) Rotate() error {
+	this.mutex.RLock()
+	source := this.source
+	this.mutex.RUnlock()
+
+	var next *ServerConfig
+	var err error
+	if source != nil {
+		next, err = source()
+	} else {
+		next, err = NewServerConfig(this.lifetime)
+	}
+	if err != nil {
+		return err
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	next.signer = this.signer
+	next.tokens = this.tokens
+	this.previous, this.current = this.current, next
+	return nil
+}
+
+// Current returns the current server config.
+func (this *ServerConfigManager) Current() *ServerConfig {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.current
+}
+
+// Lookup returns the current or the previous server config of the ID, nil otherwise.
+func (this *ServerConfigManager) Lookup(scid []byte) *ServerConfig {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	for _, config := range []*ServerConfig{this.current, this.previous} {
+		if config != nil && config.Lookup(scid) != nil {
+			return config
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package handshake
+
+import "container/list"
+import "sync"
+
+// DEFAULT_CLIENT_SESSION_CACHE_SIZE is the number of servers of NewLRUClientSessionCache without capacity
+const DEFAULT_CLIENT_SESSION_CACHE_SIZE = 64
+
+// ClientSessionState is what the client keeps of a connection to a server to resume the next one: the full CHLO is sent at once,
+// with 0-RTT data, while the server config is unexpired.
+type ClientSessionState struct {
+	ServerConfig       *ServerConfig
+	SourceAddressToken []byte
+	// CertificateChain and Proof were verified with the server config, the certificates are sent as cached (CCRT)
+	CertificateChain [][]byte
+	Proof            []byte
+	ServerNonce      []byte
+}
+
+// ClientSessionCache stores the ClientSessionState of the servers by hostname, it is shared by the connections of the clients.
+type ClientSessionCache interface {
+	// Get returns the state of the last connection to the server
+	Get(hostname string) (*ClientSessionState, bool)
+	// Put stores the state of a connection to the server, a nil state removes the entry of the server
+	Put(hostname string, state *ClientSessionState)
+}
+
+// lruClientSessionCache is a ClientSessionCache of limited capacity, the least recently used entry is evicted first.
+type lruClientSessionCache struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	lru      *list.List
+}
+
+// lruClientSessionEntry is an element of the LRU list, the most recently used first.
+type lruClientSessionEntry struct {
+	hostname string
+	state    *ClientSessionState
+}
+
+// NewLRUClientSessionCache returns an in-memory ClientSessionCache of the capacity, DEFAULT_CLIENT_SESSION_CACHE_SIZE if it is less than 1.
+func NewLRUClientSessionCache(capacity int) ClientSessionCache {
+	if capacity < 1 {
+		capacity = DEFAULT_CLIENT_SESSION_CACHE_SIZE
+	}
+	return &lruClientSessionCache{capacity: capacity, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// Get returns the state of the last connection to the server, and makes it the most recently used.
+func (this *lruClientSessionCache) Get(hostname string) (*ClientSessionState, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if e, ok := this.entries[hostname]; ok {
+		this.lru.MoveToFront(e)
+		return e.Value.(*lruClientSessionEntry).state, true
+	}
+	return nil, false
+}
+
+// Put stores the state of a connection to the server, the least recently used entry is evicted at the capacity.
+func (this *lruClientSessionCache) Put(hostname string, state *ClientSessionState) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if e, ok := this.entries[hostname]; ok {
+		if state == nil {
+			this.lru.Remove(e)
+			delete(this.entries, hostname)
+			return
+		}
+		e.Value.(*lruClientSessionEntry).state = state
+		this.lru.MoveToFront(e)
+		return
+	}
+	if state == nil {
+		return
+	}
+	if this.lru.Len() >= this.capacity {
+		oldest := this.lru.Back()
+		this.lru.Remove(oldest)
+		delete(this.entries, oldest.Value.(*lruClientSessionEntry).hostname)
+	}
+	this.entries[hostname] = this.lru.PushFront(&lruClientSessionEntry{hostname: hostname, state: state})
+}
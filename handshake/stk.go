@@ -0,0 +1,102 @@
+package handshake
+
+import "github.com/romain-jacotin/quic/crypto"
+import "crypto/rand"
+import "encoding/binary"
+import "errors"
+import "io"
+import "net"
+import "strconv"
+import "time"
+
+const (
+	// DEFAULT_SOURCE_ADDRESS_TOKEN_LIFETIME is the lifetime of the source-address tokens of a new server config
+	DEFAULT_SOURCE_ADDRESS_TOKEN_LIFETIME = 24 * time.Hour
+	// SOURCE_ADDRESS_TOKEN_CLOCK_SKEW is how far in the future the timestamp of a source-address token can be
+	SOURCE_ADDRESS_TOKEN_CLOCK_SKEW = 5 * time.Minute
+	// stkNonceSize is the size of the random AES-GCM nonce at the start of a token
+	stkNonceSize = 12
+)
+
+// ErrTokenInvalid is returned for a source-address token that can't be opened.
+var ErrTokenInvalid = errors.New("SourceAddressTokens : invalid source-address token")
+
+// ErrTokenExpired is returned for a source-address token older than the lifetime.
+var ErrTokenExpired = errors.New("SourceAddressTokens : source-address token expired")
+
+// ErrTokenAddressMismatch is returned for a source-address token issued to another address.
+var ErrTokenAddressMismatch = errors.New("SourceAddressTokens : source-address token of another address")
+
+// SourceAddressTokens issues and validates the source-address tokens (STK) of a server: the IP address and port of the client
+// with a timestamp, sealed with AES-GCM and a random key of the server. A client proves its address by echoing its token.
+//
+// The port can be ignored so that the tokens survive the NAT rebindings, the IP address is always checked.
+type SourceAddressTokens struct {
+	aead            *crypto.AesGcmAEAD
+	lifetime        time.Duration
+	allowPortChange bool
+}
+
+// NewSourceAddressTokens returns the SourceAddressTokens of a new random key, the tokens are valid for the lifetime.
+func NewSourceAddressTokens(lifetime time.Duration, allowPortChange bool) (*SourceAddressTokens, error) {
+	key := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	aead, err := crypto.NewAesGcmAEAD(key, make([]byte, 4))
+	if err != nil {
+		return nil, err
+	}
+	return &SourceAddressTokens{aead: aead, lifetime: lifetime, allowPortChange: allowPortChange}, nil
+}
+
+// NewToken returns a token of the address issued at now: the random nonce, then the sealed timestamp, port and IP address.
+func (this *SourceAddressTokens) NewToken(addr net.Addr, now time.Time) ([]byte, error) {
+	ip, port := splitAddr(addr)
+	plaintext := make([]byte, 10+net.IPv6len)
+	binary.LittleEndian.PutUint64(plaintext, uint64(now.Unix()))
+	binary.LittleEndian.PutUint16(plaintext[8:], uint16(port))
+	copy(plaintext[10:], ip.To16())
+
+	token := make([]byte, stkNonceSize, stkNonceSize+len(plaintext)+this.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, token); err != nil {
+		return nil, err
+	}
+	return this.aead.Seal(token, token[:stkNonceSize], plaintext, nil), nil
+}
+
+// ValidateToken returns nil if the token was issued to the address less than the lifetime before now.
+func (this *SourceAddressTokens) ValidateToken(token []byte, addr net.Addr, now time.Time) error {
+	if len(token) < stkNonceSize+this.aead.Overhead() {
+		return ErrTokenInvalid
+	}
+	plaintext, err := this.aead.Open(nil, token[:stkNonceSize], token[stkNonceSize:], nil)
+	if err != nil || len(plaintext) != 10+net.IPv6len {
+		return ErrTokenInvalid
+	}
+	issued := time.Unix(int64(binary.LittleEndian.Uint64(plaintext)), 0)
+	if now.Sub(issued) > this.lifetime {
+		return ErrTokenExpired
+	}
+	if issued.Sub(now) > SOURCE_ADDRESS_TOKEN_CLOCK_SKEW {
+		return ErrTokenInvalid
+	}
+	ip, port := splitAddr(addr)
+	if !ip.Equal(net.IP(plaintext[10:])) || (!this.allowPortChange && uint16(port) != binary.LittleEndian.Uint16(plaintext[8:])) {
+		return ErrTokenAddressMismatch
+	}
+	return nil
+}
+
+// splitAddr returns the IP address and the port of an UDP address, or of the "ip:port" string of another address.
+func splitAddr(addr net.Addr) (net.IP, int) {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return udp.IP, udp.Port
+	}
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, 0
+	}
+	p, _ := strconv.Atoi(port)
+	return net.ParseIP(host), p
+}
@@ -0,0 +1,47 @@
+package handshake
+
+import "encoding/binary"
+import "sync"
+import "time"
+
+// STRIKE_REGISTER_WINDOW is how far the timestamp of a client nonce can be from the time of the server.
+const STRIKE_REGISTER_WINDOW = 5 * time.Minute
+
+// strikeRegister rejects the replayed full CHLOs of a server config: each client nonce is accepted once, and the nonces whose timestamp
+// is out of the window are rejected, so that the register only keeps the nonces of the window.
+type strikeRegister struct {
+	mutex  sync.Mutex
+	orbit  []byte
+	window time.Duration
+	nonces map[string]time.Time
+}
+
+// newStrikeRegister returns the strikeRegister of the orbit of a server config.
+func newStrikeRegister(orbit []byte, window time.Duration) *strikeRegister {
+	return &strikeRegister{orbit: orbit, window: window, nonces: make(map[string]time.Time)}
+}
+
+// Insert returns REJECT_CLIENT_NONCE_INVALID for a nonce of another orbit or out of the window,
+// REJECT_CLIENT_NONCE_NOT_UNIQUE for a nonce already inserted, and 0 for a new nonce.
+func (this *strikeRegister) Insert(nonce []byte, now time.Time) RejectReason {
+	if len(nonce) != NONCE_SIZE || string(nonce[4:12]) != string(this.orbit) {
+		return REJECT_CLIENT_NONCE_INVALID
+	}
+	timestamp := time.Unix(int64(binary.BigEndian.Uint32(nonce)), 0)
+	if d := now.Sub(timestamp); d > this.window || d < -this.window {
+		return REJECT_CLIENT_NONCE_INVALID
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if _, ok := this.nonces[string(nonce)]; ok {
+		return REJECT_CLIENT_NONCE_NOT_UNIQUE
+	}
+	for n, t := range this.nonces {
+		if now.Sub(t) > this.window {
+			delete(this.nonces, n)
+		}
+	}
+	this.nonces[string(nonce)] = timestamp
+	return 0
+}
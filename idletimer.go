@@ -0,0 +1,61 @@
+package quic
+
+import "time"
+
+// idleTimer tracks the activity of a session: the session is closed after the idle timeout without retransmittable packet sent
+// or received, and a keep-alive PING is sent at half the idle timeout. The ACK-only packets are not an activity.
+//
+// It is owned by the run goroutine, the times are given by the caller.
+type idleTimer struct {
+	timeout      time.Duration
+	keepAlive    bool
+	lastActivity time.Time
+	pingQueued   bool
+}
+
+// newIdleTimer returns an idleTimer whose last activity is now.
+func newIdleTimer(timeout time.Duration, keepAlive bool, now time.Time) *idleTimer {
+	return &idleTimer{timeout: timeout, keepAlive: keepAlive, lastActivity: now}
+}
+
+// SetTimeout changes the idle timeout to the negotiated one.
+func (this *idleTimer) SetTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		this.timeout = timeout
+	}
+}
+
+// GetTimeout returns the idle timeout.
+func (this *idleTimer) GetTimeout() time.Duration {
+	return this.timeout
+}
+
+// OnActivity restarts the idle timeout on a retransmittable packet sent or received.
+func (this *idleTimer) OnActivity(now time.Time) {
+	if now.After(this.lastActivity) {
+		this.lastActivity = now
+	}
+	this.pingQueued = false
+}
+
+// IsExpired returns true if the idle timeout has elapsed since the last activity.
+func (this *idleTimer) IsExpired(now time.Time) bool {
+	return !now.Before(this.lastActivity.Add(this.timeout))
+}
+
+// ShouldSendPing returns true once per idle period if the keep-alive is on and half the idle timeout has elapsed.
+func (this *idleTimer) ShouldSendPing(now time.Time) bool {
+	if !this.keepAlive || this.pingQueued || now.Before(this.lastActivity.Add(this.timeout/2)) {
+		return false
+	}
+	this.pingQueued = true
+	return true
+}
+
+// GetAlarmTimeout returns the time of the next keep-alive PING or of the idle timeout.
+func (this *idleTimer) GetAlarmTimeout() time.Time {
+	if this.keepAlive && !this.pingQueued {
+		return this.lastActivity.Add(this.timeout / 2)
+	}
+	return this.lastActivity.Add(this.timeout)
+}
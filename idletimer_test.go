@@ -0,0 +1,68 @@
+package quic
+
+import "testing"
+import "time"
+
+func Test_IdleTimer(t *testing.T) {
+	start := time.Unix(1000, 0)
+	at := func(ms int) time.Time {
+		return start.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	// Without keep-alive, the idle timeout fires after the last activity
+	timer := newIdleTimer(10*time.Second, false, start)
+	if timer.IsExpired(at(9999)) || !timer.IsExpired(at(10000)) || timer.GetAlarmTimeout() != at(10000) {
+		t.Errorf("idleTimer : idle timeout expected after 10s")
+	}
+	if timer.ShouldSendPing(at(9000)) {
+		t.Errorf("idleTimer.ShouldSendPing : no PING expected without keep-alive")
+	}
+	timer.OnActivity(at(4000))
+	if timer.IsExpired(at(10000)) || !timer.IsExpired(at(14000)) {
+		t.Errorf("idleTimer.OnActivity : the idle timeout must restart")
+	}
+	timer.OnActivity(at(3000))
+	if !timer.IsExpired(at(14000)) {
+		t.Errorf("idleTimer.OnActivity : an older activity must be ignored")
+	}
+
+	// The negotiated idle timeout replaces the local one
+	timer.SetTimeout(5 * time.Second)
+	if timer.GetTimeout() != 5*time.Second || !timer.IsExpired(at(9000)) {
+		t.Errorf("idleTimer.SetTimeout : idle timeout of 5s expected")
+	}
+	timer.SetTimeout(0)
+	if timer.GetTimeout() != 5*time.Second {
+		t.Errorf("idleTimer.SetTimeout : a zero idle timeout must be ignored")
+	}
+
+	// With keep-alive, a PING is sent once at half the idle timeout, and its activity prevents the idle timeout
+	timer = newIdleTimer(10*time.Second, true, start)
+	var tests_keepalive = []struct {
+		now   int
+		ping  bool
+		alarm int
+	}{
+		{4999, false, 5000},
+		{5000, true, 10000},
+		{5001, false, 10000},
+	}
+	for i, v := range tests_keepalive {
+		if timer.ShouldSendPing(at(v.now)) != v.ping {
+			t.Errorf("idleTimer.ShouldSendPing : %v expected in test n°%v", v.ping, i)
+		}
+		if timer.GetAlarmTimeout() != at(v.alarm) {
+			t.Errorf("idleTimer.GetAlarmTimeout : %v expected instead of %v in test n°%v", at(v.alarm), timer.GetAlarmTimeout(), i)
+		}
+	}
+	for now := 5000; now <= 60000; now += 5000 {
+		if timer.IsExpired(at(now)) {
+			t.Fatalf("idleTimer : the keep-alive must prevent the idle timeout at %vms", now)
+		}
+		if now > 5000 && !timer.ShouldSendPing(at(now)) {
+			t.Errorf("idleTimer.ShouldSendPing : PING expected at %vms", now)
+		}
+		// The PING is a retransmittable packet sent
+		timer.OnActivity(at(now))
+	}
+}
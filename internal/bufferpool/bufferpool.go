@@ -0,0 +1,74 @@
+// Package bufferpool recycles the packet buffers of the connections, to spare an allocation per packet sent or received.
+//
+// A buffer has a single owner at a time: the owner returns it with Put once the packet is fully processed, and must not
+// use it afterwards, nor any slice of it. The ownership of the received datagrams goes from the read goroutine to the session,
+// the buffers of the sent packets are returned once written on the connection: the retransmissions are packed again.
+//
+// A Buffer is shared by several owners instead: the decrypted packets are retained by the streams that buffer their data.
+package bufferpool
+
+import "sync"
+import "sync/atomic"
+
+// BUFFER_SIZE is the size of the pooled buffers, the largest packet sent or received.
+const BUFFER_SIZE = 1500
+
+var pool = sync.Pool{New: func() interface{} { return new([BUFFER_SIZE]byte) }}
+
+// Get returns a buffer of size bytes with an undefined content, from the pool up to BUFFER_SIZE bytes.
+func Get(size int) []byte {
+	if size > BUFFER_SIZE {
+		return make([]byte, size)
+	}
+	return pool.Get().(*[BUFFER_SIZE]byte)[:size]
+}
+
+// Put returns a buffer of Get to the pool, b can be resliced but must start at the start of the buffer.
+// The other slices are ignored.
+func Put(b []byte) {
+	if cap(b) != BUFFER_SIZE {
+		return
+	}
+	pool.Put((*[BUFFER_SIZE]byte)(b[:BUFFER_SIZE]))
+}
+
+// Buffer is a pooled buffer counted by reference: each owner releases it once, and the last Release returns it to the pool.
+type Buffer struct {
+	Data  []byte
+	refs  int32
+	array [BUFFER_SIZE]byte
+}
+
+var buffers = sync.Pool{New: func() interface{} { return new(Buffer) }}
+
+// GetBuffer returns a Buffer of size bytes with an undefined content and a single reference, from the pool up to BUFFER_SIZE bytes.
+func GetBuffer(size int) *Buffer {
+	if size > BUFFER_SIZE {
+		return &Buffer{Data: make([]byte, size), refs: 1}
+	}
+	b := buffers.Get().(*Buffer)
+	b.Data = b.array[:size]
+	b.refs = 1
+	return b
+}
+
+// Retain adds a reference to the buffer, the new owner must Release it.
+func (this *Buffer) Retain() {
+	atomic.AddInt32(&this.refs, 1)
+}
+
+// Release removes a reference to the buffer, nil is ignored. The buffer returns to the pool when its last reference is released,
+// the owner must not use its data afterwards.
+func (this *Buffer) Release() {
+	if this == nil {
+		return
+	}
+	refs := atomic.AddInt32(&this.refs, -1)
+	if refs < 0 {
+		panic("Buffer.Release : buffer released too many times")
+	}
+	if refs == 0 && cap(this.Data) == BUFFER_SIZE {
+		this.Data = nil
+		buffers.Put(this)
+	}
+}
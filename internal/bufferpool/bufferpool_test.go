@@ -0,0 +1,93 @@
+package bufferpool
+
+import "sync"
+import "testing"
+
+var tests_get = []struct {
+	size   int
+	pooled bool
+}{
+	{0, true},
+	{1200, true},
+	{BUFFER_SIZE, true},
+	{BUFFER_SIZE + 1, false},
+}
+
+func Test_BufferPool(t *testing.T) {
+	for i, v := range tests_get {
+		b := Get(v.size)
+		if len(b) != v.size {
+			t.Errorf("Get : %v bytes instead of %v in test n°%v", len(b), v.size, i)
+		}
+		if pooled := cap(b) == BUFFER_SIZE; pooled != v.pooled {
+			t.Errorf("Get : pooled buffer %v instead of %v in test n°%v", pooled, v.pooled, i)
+		}
+		Put(b)
+	}
+
+	// Foreign slices are ignored
+	Put(make([]byte, 10))
+	Put(nil)
+	Put(make([]byte, BUFFER_SIZE+1))
+}
+
+func Test_BufferPool_Buffer(t *testing.T) {
+	for i, v := range tests_get {
+		b := GetBuffer(v.size)
+		if len(b.Data) != v.size || b.refs != 1 {
+			t.Errorf("GetBuffer : %v bytes and %v references in test n°%v", len(b.Data), b.refs, i)
+		}
+		// The last owner returns the buffer to the pool
+		b.Retain()
+		b.Release()
+		if b.Data == nil {
+			t.Errorf("Buffer.Release : buffer returned to the pool with a reference in test n°%v", i)
+		}
+		b.Release()
+		if pooled := b.Data == nil; pooled != v.pooled {
+			t.Errorf("Buffer.Release : pooled buffer %v instead of %v in test n°%v", pooled, v.pooled, i)
+		}
+	}
+	var b *Buffer
+	b.Release()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Buffer.Release : panic expected for a buffer released too many times")
+		}
+	}()
+	b = GetBuffer(10)
+	b.Release()
+	b.Release()
+}
+
+func Test_BufferPool_Ownership(t *testing.T) {
+	// The reader fills the buffers and hands them over, the consumer checks them and returns them to the pool
+	c := make(chan []byte, 16)
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				b := Get(1 + (i % BUFFER_SIZE))
+				for j := range b {
+					b[j] = byte(r)
+				}
+				c <- b
+			}
+		}(r)
+	}
+	go func() {
+		wg.Wait()
+		close(c)
+	}()
+	for b := range c {
+		for j := range b {
+			if b[j] != b[0] {
+				t.Fatalf("Put : buffer modified by its previous owner at byte %v", j)
+			}
+		}
+		Put(b)
+	}
+}
@@ -0,0 +1,359 @@
+// Package hpack is the HPACK header compression of RFC 7541, for the header blocks of the headers stream of the HTTP mapping.
+//
+// The Decoder implements the whole format, with the dynamic table and the Huffman code. The Encoder doesn't insert
+// in the dynamic table: the fields are indexed in the static table or sent as literals without indexing, Huffman coded
+// if shorter, so that its header blocks don't depend on the order of their decoding.
+package hpack
+
+import "errors"
+
+// DEFAULT_TABLE_SIZE is the initial size of the dynamic table, SETTINGS_HEADER_TABLE_SIZE of HTTP/2.
+const DEFAULT_TABLE_SIZE = 4096
+
+// ENTRY_OVERHEAD is the overhead of the size of an entry of the dynamic table, added to the length of its name and value.
+const ENTRY_OVERHEAD = 32
+
+// ErrInvalidHeaderBlock is returned by Decode for a malformed header block.
+var ErrInvalidHeaderBlock = errors.New("Decoder.Decode : invalid header block")
+
+// ErrInvalidIndex is returned by Decode for an index outside of the static and dynamic tables.
+var ErrInvalidIndex = errors.New("Decoder.Decode : invalid index")
+
+// ErrInvalidHuffman is returned by Decode for a malformed Huffman coded string.
+var ErrInvalidHuffman = errors.New("Decoder.Decode : invalid Huffman code")
+
+// ErrHeaderListTooLarge is returned by Decode when the header list exceeds the maximum size of the Decoder.
+var ErrHeaderListTooLarge = errors.New("Decoder.Decode : header list too large")
+
+// HeaderField is a name and value pair of a header list, Sensitive fields are never indexed.
+type HeaderField struct {
+	Name      string
+	Value     string
+	Sensitive bool
+}
+
+// Size returns the size of the field in the dynamic table.
+func (this HeaderField) Size() int {
+	return len(this.Name) + len(this.Value) + ENTRY_OVERHEAD
+}
+
+// Encoder encodes the header lists of a connection in header blocks.
+type Encoder struct {
+	staticNames map[string]int
+	staticPairs map[HeaderField]int
+}
+
+// NewEncoder returns an Encoder.
+func NewEncoder() *Encoder {
+	encoder := &Encoder{staticNames: make(map[string]int), staticPairs: make(map[HeaderField]int)}
+	for i := len(staticTable) - 1; i >= 0; i-- {
+		encoder.staticNames[staticTable[i].Name] = i + 1
+		encoder.staticPairs[staticTable[i]] = i + 1
+	}
+	return encoder
+}
+
+// AppendHeaderBlock appends the header block of the fields to b and returns it.
+func (this *Encoder) AppendHeaderBlock(b []byte, fields []HeaderField) []byte {
+	for _, f := range fields {
+		if i, ok := this.staticPairs[HeaderField{Name: f.Name, Value: f.Value}]; ok && !f.Sensitive {
+			b = appendInteger(b, 0x80, 7, uint64(i))
+			continue
+		}
+		// Literal header field without indexing, or never indexed
+		prefix := byte(0x00)
+		if f.Sensitive {
+			prefix = 0x10
+		}
+		if i, ok := this.staticNames[f.Name]; ok {
+			b = appendInteger(b, prefix, 4, uint64(i))
+		} else {
+			b = appendInteger(b, prefix, 4, 0)
+			b = appendString(b, f.Name)
+		}
+		b = appendString(b, f.Value)
+	}
+	return b
+}
+
+// Decoder decodes the header blocks of a connection, in the order of their encoding.
+type Decoder struct {
+	// dynamic is the dynamic table, the newest entry last
+	dynamic       []HeaderField
+	size          int
+	maxSize       int
+	maxAllowed    int
+	maxHeaderList int
+}
+
+// NewDecoder returns a Decoder with a dynamic table of DEFAULT_TABLE_SIZE bytes at most, that rejects the header lists
+// larger than maxHeaderList bytes counted like the entries of the dynamic table, 0 for no limit.
+func NewDecoder(maxHeaderList int) *Decoder {
+	return &Decoder{maxSize: DEFAULT_TABLE_SIZE, maxAllowed: DEFAULT_TABLE_SIZE, maxHeaderList: maxHeaderList}
+}
+
+// Decode returns the header list of a complete header block.
+func (this *Decoder) Decode(b []byte) ([]HeaderField, error) {
+	var fields []HeaderField
+	var listSize int
+
+	for len(b) > 0 {
+		var f HeaderField
+		var err error
+
+		switch {
+		case b[0]&0x80 != 0:
+			// Indexed header field
+			var i uint64
+			if i, b, err = readInteger(b, 7); err != nil {
+				return nil, err
+			}
+			if f, err = this.field(i); err != nil {
+				return nil, err
+			}
+		case b[0]&0xc0 == 0x40:
+			// Literal header field with incremental indexing
+			if f, b, err = this.readLiteral(b, 6); err != nil {
+				return nil, err
+			}
+			this.add(f)
+		case b[0]&0xe0 == 0x20:
+			// Dynamic table size update
+			var size uint64
+			if size, b, err = readInteger(b, 5); err != nil {
+				return nil, err
+			}
+			if size > uint64(this.maxAllowed) {
+				return nil, ErrInvalidHeaderBlock
+			}
+			this.maxSize = int(size)
+			this.evict(0)
+			continue
+		default:
+			// Literal header field without indexing (0000) or never indexed (0001)
+			sensitive := b[0]&0x10 != 0
+			if f, b, err = this.readLiteral(b, 4); err != nil {
+				return nil, err
+			}
+			f.Sensitive = sensitive
+		}
+		listSize += f.Size()
+		if this.maxHeaderList > 0 && listSize > this.maxHeaderList {
+			return nil, ErrHeaderListTooLarge
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// field returns the field of the index in the static table then in the dynamic table.
+func (this *Decoder) field(i uint64) (HeaderField, error) {
+	switch {
+	case i == 0:
+		return HeaderField{}, ErrInvalidIndex
+	case i <= uint64(len(staticTable)):
+		return staticTable[i-1], nil
+	case i-uint64(len(staticTable)) <= uint64(len(this.dynamic)):
+		return this.dynamic[len(this.dynamic)-int(i-uint64(len(staticTable)))], nil
+	}
+	return HeaderField{}, ErrInvalidIndex
+}
+
+// readLiteral reads a literal field with the name index on the prefix bits, or with a literal name if the index is 0.
+func (this *Decoder) readLiteral(b []byte, prefix uint) (HeaderField, []byte, error) {
+	var f HeaderField
+
+	i, b, err := readInteger(b, prefix)
+	if err != nil {
+		return f, nil, err
+	}
+	if i == 0 {
+		if f.Name, b, err = this.readString(b); err != nil {
+			return f, nil, err
+		}
+	} else {
+		named, err := this.field(i)
+		if err != nil {
+			return f, nil, err
+		}
+		f.Name = named.Name
+	}
+	if f.Value, b, err = this.readString(b); err != nil {
+		return f, nil, err
+	}
+	return f, b, nil
+}
+
+// readString reads a string literal, Huffman coded or not.
+func (this *Decoder) readString(b []byte) (string, []byte, error) {
+	if len(b) == 0 {
+		return "", nil, ErrInvalidHeaderBlock
+	}
+	huffman := b[0]&0x80 != 0
+	length, b, err := readInteger(b, 7)
+	if err != nil {
+		return "", nil, err
+	}
+	if length > uint64(len(b)) || (this.maxHeaderList > 0 && length > uint64(this.maxHeaderList)) {
+		return "", nil, ErrInvalidHeaderBlock
+	}
+	s, b := b[:length], b[length:]
+	if !huffman {
+		return string(s), b, nil
+	}
+	decoded, err := huffmanDecode(s)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(decoded), b, nil
+}
+
+// add inserts the field in the dynamic table, after the eviction of the oldest entries to make room for it.
+func (this *Decoder) add(f HeaderField) {
+	f.Sensitive = false
+	if f.Size() > this.maxSize {
+		this.dynamic = this.dynamic[:0]
+		this.size = 0
+		return
+	}
+	this.evict(f.Size())
+	this.dynamic = append(this.dynamic, f)
+	this.size += f.Size()
+}
+
+// evict removes the oldest entries until the size of the dynamic table leaves room for an entry of the size.
+func (this *Decoder) evict(size int) {
+	n := 0
+	for this.size+size > this.maxSize && n < len(this.dynamic) {
+		this.size -= this.dynamic[n].Size()
+		n++
+	}
+	this.dynamic = append(this.dynamic[:0], this.dynamic[n:]...)
+}
+
+// appendInteger appends the integer on the prefix bits of the first byte, ORed with the flags of the representation.
+func appendInteger(b []byte, flags byte, prefix uint, v uint64) []byte {
+	max := uint64(1)<<prefix - 1
+	if v < max {
+		return append(b, flags|byte(v))
+	}
+	b = append(b, flags|byte(max))
+	for v -= max; v >= 0x80; v >>= 7 {
+		b = append(b, byte(v)|0x80)
+	}
+	return append(b, byte(v))
+}
+
+// readInteger reads the integer on the prefix bits of the first byte, and returns the rest of the data.
+func readInteger(b []byte, prefix uint) (uint64, []byte, error) {
+	if len(b) == 0 {
+		return 0, nil, ErrInvalidHeaderBlock
+	}
+	max := uint64(1)<<prefix - 1
+	v := uint64(b[0]) & max
+	b = b[1:]
+	if v < max {
+		return v, b, nil
+	}
+	for shift := uint(0); len(b) > 0; shift += 7 {
+		// The integers are limited to 63 bits
+		if shift > 56 {
+			return 0, nil, ErrInvalidHeaderBlock
+		}
+		c := b[0]
+		b = b[1:]
+		v += uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, b, nil
+		}
+	}
+	return 0, nil, ErrInvalidHeaderBlock
+}
+
+// appendString appends the string literal, Huffman coded if it is shorter.
+func appendString(b []byte, s string) []byte {
+	if n := huffmanLength(s); n < len(s) {
+		b = appendInteger(b, 0x80, 7, uint64(n))
+		return huffmanEncode(b, s)
+	}
+	b = appendInteger(b, 0x00, 7, uint64(len(s)))
+	return append(b, s...)
+}
+
+// huffmanLength returns the size of the Huffman code of the string.
+func huffmanLength(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		n += int(huffmanCodeLen[s[i]])
+	}
+	return (n + 7) / 8
+}
+
+// huffmanEncode appends the Huffman code of the string, padded with the most significant bits of the EOS code.
+func huffmanEncode(b []byte, s string) []byte {
+	var bits uint64
+	var n uint
+
+	for i := 0; i < len(s); i++ {
+		bits = bits<<huffmanCodeLen[s[i]] | uint64(huffmanCodes[s[i]])
+		n += uint(huffmanCodeLen[s[i]])
+		for n >= 8 {
+			n -= 8
+			b = append(b, byte(bits>>n))
+		}
+	}
+	if n > 0 {
+		b = append(b, byte(bits<<(8-n))|byte(0xff>>n))
+	}
+	return b
+}
+
+// huffmanNode is a node of the decoding tree of the Huffman code, a leaf if its children are nil.
+type huffmanNode struct {
+	children [2]*huffmanNode
+	symbol   byte
+}
+
+var huffmanRoot = func() *huffmanNode {
+	root := new(huffmanNode)
+	for symbol, code := range huffmanCodes {
+		n := root
+		for bit := int(huffmanCodeLen[symbol]) - 1; bit >= 0; bit-- {
+			b := (code >> uint(bit)) & 1
+			if n.children[b] == nil {
+				n.children[b] = new(huffmanNode)
+			}
+			n = n.children[b]
+		}
+		n.symbol = byte(symbol)
+	}
+	return root
+}()
+
+// huffmanDecode decodes the Huffman code, the padding must be shorter than 8 bits and a prefix of the EOS code.
+func huffmanDecode(code []byte) ([]byte, error) {
+	decoded := make([]byte, 0, len(code)*8/5)
+	n := huffmanRoot
+	// depth is the number of bits since the last symbol, ones is true while they are all 1
+	depth, ones := 0, true
+	for _, c := range code {
+		for bit := 7; bit >= 0; bit-- {
+			b := (c >> uint(bit)) & 1
+			n = n.children[b]
+			depth++
+			ones = ones && b == 1
+			// The EOS symbol of 30 bits is not a leaf of the tree
+			if n == nil {
+				return nil, ErrInvalidHuffman
+			}
+			if n.children[0] == nil && n.children[1] == nil {
+				decoded = append(decoded, n.symbol)
+				n, depth, ones = huffmanRoot, 0, true
+			}
+		}
+	}
+	if depth > 7 || !ones {
+		return nil, ErrInvalidHuffman
+	}
+	return decoded, nil
+}
@@ -0,0 +1,154 @@
+package hpack
+
+import "bytes"
+import "encoding/hex"
+import "reflect"
+import "strings"
+import "testing"
+
+var tests_integer = []struct {
+	prefix uint
+	value  uint64
+	data   []byte
+}{
+	// RFC 7541 C.1
+	{5, 10, []byte{0x0a}},
+	{5, 1337, []byte{0x1f, 0x9a, 0x0a}},
+	{8, 42, []byte{0x2a}},
+	{7, 127, []byte{0x7f, 0x00}},
+	{4, 1<<63 - 1, []byte{0x0f, 0xf0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+}
+
+func Test_Integer(t *testing.T) {
+	for i, v := range tests_integer {
+		if b := appendInteger(nil, 0, v.prefix, v.value); !bytes.Equal(b, v.data) {
+			t.Errorf("appendInteger : %x expected instead of %x in test n°%v", v.data, b, i)
+		}
+		value, rest, err := readInteger(v.data, v.prefix)
+		if err != nil || value != v.value || len(rest) != 0 {
+			t.Errorf("readInteger : %v expected instead of %v (%v) in test n°%v", v.value, value, err, i)
+		}
+		if _, _, err = readInteger(v.data[:len(v.data)-1], v.prefix); len(v.data) > 1 && err != ErrInvalidHeaderBlock {
+			t.Errorf("readInteger : ErrInvalidHeaderBlock expected for a truncated integer in test n°%v", i)
+		}
+	}
+}
+
+// tests_requests are the three requests of RFC 7541 C.3 and C.4, decoded with the same Decoder.
+var tests_requests = []struct {
+	plain   string
+	huffman string
+	fields  []HeaderField
+}{
+	{
+		"828684410f7777772e6578616d706c652e636f6d",
+		"828684418cf1e3c2e5f23a6ba0ab90f4ff",
+		[]HeaderField{{Name: ":method", Value: "GET"}, {Name: ":scheme", Value: "http"}, {Name: ":path", Value: "/"},
+			{Name: ":authority", Value: "www.example.com"}},
+	},
+	{
+		"828684be58086e6f2d6361636865",
+		"828684be5886a8eb10649cbf",
+		[]HeaderField{{Name: ":method", Value: "GET"}, {Name: ":scheme", Value: "http"}, {Name: ":path", Value: "/"},
+			{Name: ":authority", Value: "www.example.com"}, {Name: "cache-control", Value: "no-cache"}},
+	},
+	{
+		"828785bf400a637573746f6d2d6b65790c637573746f6d2d76616c7565",
+		"828785bf408825a849e95ba97d7f8925a849e95bb8e8b4bf",
+		[]HeaderField{{Name: ":method", Value: "GET"}, {Name: ":scheme", Value: "https"}, {Name: ":path", Value: "/index.html"},
+			{Name: ":authority", Value: "www.example.com"}, {Name: "custom-key", Value: "custom-value"}},
+	},
+}
+
+func Test_Decoder_RFC7541(t *testing.T) {
+	plain, huffman := NewDecoder(0), NewDecoder(0)
+	for i, v := range tests_requests {
+		for _, c := range []struct {
+			decoder *Decoder
+			block   string
+		}{{plain, v.plain}, {huffman, v.huffman}} {
+			b, _ := hex.DecodeString(c.block)
+			fields, err := c.decoder.Decode(b)
+			if err != nil || !reflect.DeepEqual(fields, v.fields) {
+				t.Errorf("Decoder.Decode : %v expected instead of %v (%v) in test n°%v", v.fields, fields, err, i)
+			}
+		}
+	}
+	// custom-key: custom-value, cache-control: no-cache and :authority: www.example.com
+	if len(plain.dynamic) != 3 || plain.size != 164 {
+		t.Errorf("Decoder.Decode : dynamic table of 3 entries and 164 bytes expected instead of %v entries and %v bytes", len(plain.dynamic), plain.size)
+	}
+}
+
+var tests_invalidblocks = []struct {
+	block string
+	err   error
+}{
+	{"80", ErrInvalidIndex},
+	{"be", ErrInvalidIndex},
+	{"bf", ErrInvalidIndex},
+	{"0f", ErrInvalidHeaderBlock},
+	{"000361", ErrInvalidHeaderBlock},
+	{"3fe21f", ErrInvalidHeaderBlock},
+	// Padding longer than 7 bits, and padding that is not a prefix of EOS
+	{"0481ff", ErrInvalidHuffman},
+	{"0001618100", ErrInvalidHuffman},
+}
+
+func Test_Decoder_Invalid(t *testing.T) {
+	for i, v := range tests_invalidblocks {
+		b, _ := hex.DecodeString(v.block)
+		if _, err := NewDecoder(0).Decode(b); err != v.err {
+			t.Errorf("Decoder.Decode : %v expected instead of %v in test n°%v", v.err, err, i)
+		}
+	}
+	fields := []HeaderField{{Name: "x-large", Value: strings.Repeat("a", 100)}}
+	if _, err := NewDecoder(100).Decode(NewEncoder().AppendHeaderBlock(nil, fields)); err != ErrHeaderListTooLarge {
+		t.Errorf("Decoder.Decode : ErrHeaderListTooLarge expected instead of %v", err)
+	}
+}
+
+func Test_Decoder_TableSize(t *testing.T) {
+	decoder := NewDecoder(0)
+	// Size update to 0 evicts the entries, then 40 bytes of room for one entry
+	b, _ := hex.DecodeString("400161016120400162016221")
+	if _, err := decoder.Decode(b); err != nil || len(decoder.dynamic) != 0 {
+		t.Errorf("Decoder.Decode : empty dynamic table expected instead of %v (%v)", decoder.dynamic, err)
+	}
+	b, _ = hex.DecodeString("3f09400161016140016201624001630163")
+	if _, err := decoder.Decode(b); err != nil || !reflect.DeepEqual(decoder.dynamic, []HeaderField{{Name: "c", Value: "c"}}) {
+		t.Errorf("Decoder.Decode : only the newest entry expected instead of %v (%v)", decoder.dynamic, err)
+	}
+	if _, err := decoder.Decode([]byte{0x3f, 0xe2, 0x1f}); err != ErrInvalidHeaderBlock {
+		t.Errorf("Decoder.Decode : ErrInvalidHeaderBlock expected for a size above the maximum instead of %v", err)
+	}
+}
+
+func Test_Encoder(t *testing.T) {
+	fields := []HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":path", Value: "/index.html"},
+		{Name: ":authority", Value: "www.example.com"},
+		{Name: "content-type", Value: "text/plain; charset=utf-8"},
+		{Name: "x-binary", Value: "\x00\xff\x7f"},
+		{Name: "authorization", Value: "secret", Sensitive: true},
+		{Name: "x-empty", Value: ""},
+	}
+	encoder, decoder := NewEncoder(), NewDecoder(0)
+	for i := 0; i < 2; i++ {
+		b := encoder.AppendHeaderBlock(nil, fields)
+		decoded, err := decoder.Decode(b)
+		if err != nil || !reflect.DeepEqual(decoded, fields) {
+			t.Errorf("Encoder.AppendHeaderBlock : %v expected instead of %v (%v) in test n°%v", fields, decoded, err, i)
+		}
+		if b[0] != 0x82 || b[1] != 0x85 {
+			t.Errorf("Encoder.AppendHeaderBlock : indexed fields of the static table expected instead of %x in test n°%v", b[:2], i)
+		}
+	}
+	for c := 0; c < 256; c++ {
+		s := string([]byte{byte(c), byte(c), byte(c)})
+		if decoded, err := huffmanDecode(huffmanEncode(nil, s)); err != nil || string(decoded) != s {
+			t.Errorf("huffmanDecode : %q expected instead of %q (%v)", s, decoded, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Package packetconn reads and writes the datagrams of a net.PacketConn in batches, to spare a system call per datagram.
+//
+// On Linux the UDPConns use recvmmsg and sendmmsg, and let the kernel segment the buffers of WriteGSO when it supports UDP_SEGMENT.
+// The ECN codepoint of the IP header is written and read with control messages.
+// The other PacketConns read and write one datagram at a time, without ECN.
+package packetconn
+
+import "net"
+
+const (
+	// BATCH_SIZE is the largest number of datagrams read or written with a single system call.
+	BATCH_SIZE = 64
+	// GSO_MAX_SEGMENTS and GSO_MAX_SIZE bound the segments and the bytes of a buffer segmented by the kernel.
+	GSO_MAX_SEGMENTS = 64
+	GSO_MAX_SIZE     = 65507
+)
+
+// ECN is the Explicit Congestion Notification codepoint of the IP header of a datagram.
+type ECN byte
+
+const (
+	ECN_NOT_ECT ECN = 0
+	ECN_ECT1    ECN = 1
+	ECN_ECT0    ECN = 2
+	// ECN_CE is the Congestion Experienced mark set by the routers instead of dropping the datagram
+	ECN_CE ECN = 3
+)
+
+// Message is a datagram of a batch: ReadBatch reads N bytes in Buffer from Addr, WriteBatch writes Buffer to Addr.
+// ECN is the codepoint of the datagram read or written.
+type Message struct {
+	Buffer []byte
+	N      int
+	Addr   net.Addr
+	ECN    ECN
+}
+
+// Conn reads and writes the datagrams of a PacketConn in batches.
+//
+// ReadBatch is called by a single goroutine, WriteBatch is safe for concurrent use.
+type Conn interface {
+	// ReadBatch blocks until at least one datagram is received, and returns the number of messages read.
+	ReadBatch(ms []Message) (int, error)
+	// WriteBatch writes the messages in order, and returns the number of messages written before the error.
+	WriteBatch(ms []Message) (int, error)
+	// WriteGSO writes the segments of segSize bytes of the buffer of the message, the last one can be shorter.
+	// The kernel segments the buffer while SupportsGSO returns true, the segments are written as datagrams otherwise.
+	WriteGSO(m Message, segSize int) error
+	// SupportsGSO returns true until the kernel fails to segment a buffer.
+	SupportsGSO() bool
+}
+
+// New returns the Conn of the PacketConn.
+func New(pc net.PacketConn) Conn {
+	if c := newBatchConn(pc); c != nil {
+		return c
+	}
+	return newSingleConn(pc)
+}
+
+// singleConn reads and writes one datagram per system call.
+type singleConn struct {
+	pc net.PacketConn
+}
+
+func newSingleConn(pc net.PacketConn) *singleConn {
+	return &singleConn{pc: pc}
+}
+
+// ReadBatch reads a single datagram, its ECN codepoint is unknown.
+func (this *singleConn) ReadBatch(ms []Message) (int, error) {
+	if len(ms) == 0 {
+		return 0, nil
+	}
+	n, addr, err := this.pc.ReadFrom(ms[0].Buffer)
+	if err != nil {
+		return 0, err
+	}
+	ms[0].N, ms[0].Addr, ms[0].ECN = n, addr, ECN_NOT_ECT
+	return 1, nil
+}
+
+// WriteBatch writes the datagrams one at a time, without their ECN codepoint.
+func (this *singleConn) WriteBatch(ms []Message) (int, error) {
+	for i := range ms {
+		if _, err := this.pc.WriteTo(ms[i].Buffer, ms[i].Addr); err != nil {
+			return i, err
+		}
+	}
+	return len(ms), nil
+}
+
+// WriteGSO writes the segments one datagram at a time.
+func (this *singleConn) WriteGSO(m Message, segSize int) error {
+	return writeSegments(this, m, segSize)
+}
+
+func (this *singleConn) SupportsGSO() bool {
+	return false
+}
+
+// writeSegments writes the segments of segSize bytes of the message as datagrams, in batches.
+func writeSegments(c Conn, m Message, segSize int) error {
+	buf := m.Buffer
+	if segSize <= 0 {
+		segSize = len(buf)
+	}
+	ms := make([]Message, 0, (len(buf)+segSize-1)/segSize)
+	for len(buf) > 0 {
+		n := segSize
+		if n > len(buf) {
+			n = len(buf)
+		}
+		ms = append(ms, Message{Buffer: buf[:n], Addr: m.Addr, ECN: m.ECN})
+		buf = buf[n:]
+	}
+	_, err := c.WriteBatch(ms)
+	return err
+}
@@ -0,0 +1,354 @@
+package packetconn
+
+import "golang.org/x/sys/unix"
+import "encoding/binary"
+import "errors"
+import "net"
+import "net/netip"
+import "os"
+import "strconv"
+import "sync"
+import "sync/atomic"
+import "syscall"
+import "unsafe"
+
+// mmsghdr is the struct mmsghdr of recvmmsg and sendmmsg.
+type mmsghdr struct {
+	hdr unix.Msghdr
+	len uint32
+}
+
+// OOB_SIZE is the size of the control messages of a datagram: UDP_SEGMENT, and the IP_TOS or the IPV6_TCLASS of the ECN codepoint.
+const OOB_SIZE = 64
+
+// mmsgBuffers are the headers of a batch of recvmmsg or sendmmsg.
+type mmsgBuffers struct {
+	hdrs  [BATCH_SIZE]mmsghdr
+	iovs  [BATCH_SIZE]unix.Iovec
+	names [BATCH_SIZE]unix.RawSockaddrAny
+	oobs  [BATCH_SIZE][OOB_SIZE]byte
+}
+
+// sendmsg is the system call of WriteGSO, replaced by the tests.
+var sendmsg = unix.SendmsgN
+
+// mmsgConn reads and writes the datagrams of a UDPConn with recvmmsg and sendmmsg, and writes the buffers segmented by the kernel
+// with a UDP_SEGMENT control message. The kernel reports the TOS or the Traffic Class of the datagrams read.
+type mmsgConn struct {
+	conn  *net.UDPConn
+	raw   syscall.RawConn
+	inet6 bool
+	// gso is set if the kernel has the UDP_SEGMENT socket option, and cleared for good once it fails to segment a buffer
+	gso atomic.Bool
+
+	// rbufs is used by the read goroutine only
+	rbufs  mmsgBuffers
+	wmutex sync.Mutex
+	wbufs  mmsgBuffers
+	oob    [OOB_SIZE]byte
+}
+
+// newBatchConn returns the mmsgConn of a UDPConn, or nil.
+func newBatchConn(pc net.PacketConn) Conn {
+	conn, ok := pc.(*net.UDPConn)
+	if !ok {
+		return nil
+	}
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	this := &mmsgConn{conn: conn, raw: raw}
+	var sa unix.Sockaddr
+	var gsoErr error
+	if err = raw.Control(func(fd uintptr) {
+		if sa, err = unix.Getsockname(int(fd)); err != nil {
+			return
+		}
+		_, gsoErr = unix.GetsockoptInt(int(fd), unix.IPPROTO_UDP, unix.UDP_SEGMENT)
+		// The IPv4 datagrams of a dual-stack socket have a TOS too, the ECN codepoint is unknown without these options
+		unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_RECVTOS, 1)
+		if _, ok := sa.(*unix.SockaddrInet6); ok {
+			unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_RECVTCLASS, 1)
+		}
+	}); err != nil {
+		return nil
+	}
+	this.gso.Store(gsoErr == nil)
+	switch sa.(type) {
+	case *unix.SockaddrInet4:
+	case *unix.SockaddrInet6:
+		this.inet6 = true
+	default:
+		return nil
+	}
+	return this
+}
+
+func (this *mmsgConn) ReadBatch(ms []Message) (int, error) {
+	if len(ms) > BATCH_SIZE {
+		ms = ms[:BATCH_SIZE]
+	}
+	if len(ms) == 0 {
+		return 0, nil
+	}
+	b := &this.rbufs
+	for i := range ms {
+		b.iovs[i].Base = &ms[i].Buffer[0]
+		b.iovs[i].SetLen(len(ms[i].Buffer))
+		b.hdrs[i] = mmsghdr{}
+		b.hdrs[i].hdr.Name = (*byte)(unsafe.Pointer(&b.names[i]))
+		b.hdrs[i].hdr.Namelen = unix.SizeofSockaddrAny
+		b.hdrs[i].hdr.Iov = &b.iovs[i]
+		b.hdrs[i].hdr.SetIovlen(1)
+		b.hdrs[i].hdr.Control = &b.oobs[i][0]
+		b.hdrs[i].hdr.SetControllen(OOB_SIZE)
+	}
+	var n int
+	var errno syscall.Errno
+	err := this.raw.Read(func(fd uintptr) bool {
+		r, _, e := unix.Syscall6(unix.SYS_RECVMMSG, fd, uintptr(unsafe.Pointer(&b.hdrs[0])), uintptr(len(ms)), 0, 0, 0)
+		if e == unix.EAGAIN {
+			return false
+		}
+		n, errno = int(r), e
+		return true
+	})
+	if err == nil && errno != 0 {
+		err = os.NewSyscallError("recvmmsg", errno)
+	}
+	if err != nil {
+		return 0, &net.OpError{Op: "read", Net: this.conn.LocalAddr().Network(), Source: this.conn.LocalAddr(), Err: err}
+	}
+	for i := 0; i < n; i++ {
+		ms[i].N = int(b.hdrs[i].len)
+		ms[i].Addr = decodeSockaddr(&b.names[i])
+		ms[i].ECN = parseECN(b.oobs[i][:b.hdrs[i].hdr.Controllen])
+	}
+	return n, nil
+}
+
+func (this *mmsgConn) WriteBatch(ms []Message) (int, error) {
+	this.wmutex.Lock()
+	defer this.wmutex.Unlock()
+	sent := 0
+	for sent < len(ms) {
+		batch := ms[sent:]
+		if len(batch) > BATCH_SIZE {
+			batch = batch[:BATCH_SIZE]
+		}
+		n, err := this.writeBatch(batch)
+		sent += n
+		if err != nil {
+			return sent, &net.OpError{Op: "write", Net: this.conn.LocalAddr().Network(), Source: this.conn.LocalAddr(),
+				Addr: ms[sent].Addr, Err: err}
+		}
+	}
+	return sent, nil
+}
+
+// writeBatch writes up to BATCH_SIZE messages with sendmmsg, a message with an address that can't be encoded is written with WriteTo.
+func (this *mmsgConn) writeBatch(ms []Message) (int, error) {
+	b := &this.wbufs
+	count := 0
+	for i := range ms {
+		namelen, ok := this.encodeSockaddr(ms[i].Addr, &b.names[i])
+		if !ok {
+			break
+		}
+		b.iovs[i].Base = nil
+		if len(ms[i].Buffer) > 0 {
+			b.iovs[i].Base = &ms[i].Buffer[0]
+		}
+		b.iovs[i].SetLen(len(ms[i].Buffer))
+		b.hdrs[i] = mmsghdr{}
+		b.hdrs[i].hdr.Name = (*byte)(unsafe.Pointer(&b.names[i]))
+		b.hdrs[i].hdr.Namelen = namelen
+		b.hdrs[i].hdr.Iov = &b.iovs[i]
+		b.hdrs[i].hdr.SetIovlen(1)
+		if ms[i].ECN != ECN_NOT_ECT {
+			b.hdrs[i].hdr.Control = &b.oobs[i][0]
+			b.hdrs[i].hdr.SetControllen(putECN(b.oobs[i][:], ms[i].ECN, &b.names[i]))
+		}
+		count++
+	}
+	if count == 0 {
+		if _, err := this.conn.WriteTo(ms[0].Buffer, ms[0].Addr); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+	var n int
+	var errno syscall.Errno
+	err := this.raw.Write(func(fd uintptr) bool {
+		r, _, e := unix.Syscall6(unix.SYS_SENDMMSG, fd, uintptr(unsafe.Pointer(&b.hdrs[0])), uintptr(count), 0, 0, 0)
+		if e == unix.EAGAIN {
+			return false
+		}
+		n, errno = int(r), e
+		return true
+	})
+	if err == nil && errno != 0 {
+		err = os.NewSyscallError("sendmmsg", errno)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (this *mmsgConn) SupportsGSO() bool {
+	return this.gso.Load()
+}
+
+func (this *mmsgConn) WriteGSO(m Message, segSize int) error {
+	var name unix.RawSockaddrAny
+	sa, ok := this.sockaddr(m.Addr, &name)
+	if !ok || segSize <= 0 || !this.gso.Load() {
+		return writeSegments(this, m, segSize)
+	}
+	segments := GSO_MAX_SIZE / segSize
+	if segments > GSO_MAX_SEGMENTS {
+		segments = GSO_MAX_SEGMENTS
+	}
+	for buf := m.Buffer; len(buf) > 0; {
+		chunk := buf
+		if len(chunk) > segments*segSize {
+			chunk = chunk[:segments*segSize]
+		}
+		err := this.sendGSO(chunk, segSize, m.ECN, sa, &name)
+		if errors.Is(err, unix.EIO) {
+			// The device can't segment the buffers
+			this.gso.Store(false)
+			m.Buffer = buf
+			return writeSegments(this, m, segSize)
+		}
+		if err != nil {
+			return &net.OpError{Op: "write", Net: this.conn.LocalAddr().Network(), Source: this.conn.LocalAddr(), Addr: m.Addr, Err: err}
+		}
+		buf = buf[len(chunk):]
+	}
+	return nil
+}
+
+// sendGSO writes the buffer with a single sendmsg, the kernel segments it in datagrams of segSize bytes.
+func (this *mmsgConn) sendGSO(buf []byte, segSize int, ecn ECN, sa unix.Sockaddr, name *unix.RawSockaddrAny) error {
+	this.wmutex.Lock()
+	defer this.wmutex.Unlock()
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&this.oob[0]))
+	h.Level = unix.IPPROTO_UDP
+	h.Type = unix.UDP_SEGMENT
+	h.SetLen(unix.CmsgLen(2))
+	*(*uint16)(unsafe.Pointer(&this.oob[unix.CmsgLen(0)])) = uint16(segSize)
+	oob := this.oob[:unix.CmsgSpace(2)]
+	if ecn != ECN_NOT_ECT {
+		oob = this.oob[:len(oob)+putECN(this.oob[len(oob):], ecn, name)]
+	}
+
+	var errno error
+	err := this.raw.Write(func(fd uintptr) bool {
+		_, errno = sendmsg(int(fd), buf, oob, sa, 0)
+		return errno != unix.EAGAIN
+	})
+	if err == nil && errno != nil {
+		err = os.NewSyscallError("sendmsg", errno)
+	}
+	return err
+}
+
+// sockaddr writes the UDP address in the family of the socket, and returns it for sendmsg.
+func (this *mmsgConn) sockaddr(addr net.Addr, name *unix.RawSockaddrAny) (unix.Sockaddr, bool) {
+	if _, ok := this.encodeSockaddr(addr, name); !ok {
+		return nil, false
+	}
+	udp := addr.(*net.UDPAddr)
+	if this.inet6 {
+		return &unix.SockaddrInet6{Port: udp.Port, Addr: (*unix.RawSockaddrInet6)(unsafe.Pointer(name)).Addr}, true
+	}
+	return &unix.SockaddrInet4{Port: udp.Port, Addr: (*unix.RawSockaddrInet4)(unsafe.Pointer(name)).Addr}, true
+}
+
+// putECN writes the control message of the ECN codepoint of a datagram sent to the address, and returns its length:
+// IP_TOS for the IPv4 addresses, even on a dual-stack socket, IPV6_TCLASS otherwise.
+func putECN(oob []byte, ecn ECN, name *unix.RawSockaddrAny) int {
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level, h.Type = unix.IPPROTO_IP, unix.IP_TOS
+	if name.Addr.Family == unix.AF_INET6 {
+		if addr := netip.AddrFrom16((*unix.RawSockaddrInet6)(unsafe.Pointer(name)).Addr); !addr.Is4In6() {
+			h.Level, h.Type = unix.IPPROTO_IPV6, unix.IPV6_TCLASS
+		}
+	}
+	h.SetLen(unix.CmsgLen(4))
+	*(*int32)(unsafe.Pointer(&oob[unix.CmsgLen(0)])) = int32(ecn)
+	return unix.CmsgSpace(4)
+}
+
+// parseECN returns the ECN codepoint of the TOS or of the Traffic Class of the control messages of a datagram.
+func parseECN(oob []byte) ECN {
+	for len(oob) >= unix.SizeofCmsghdr {
+		h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		if int(h.Len) < unix.CmsgLen(0) || int(h.Len) > len(oob) {
+			break
+		}
+		data := oob[unix.CmsgLen(0):h.Len]
+		switch {
+		// The TOS is a byte, the Traffic Class an int
+		case h.Level == unix.IPPROTO_IP && h.Type == unix.IP_TOS && len(data) >= 1:
+			return ECN(data[0] & 3)
+		case h.Level == unix.IPPROTO_IPV6 && h.Type == unix.IPV6_TCLASS && len(data) >= 4:
+			return ECN(*(*int32)(unsafe.Pointer(&data[0])) & 3)
+		}
+		space := unix.CmsgSpace(int(h.Len) - unix.CmsgLen(0))
+		if space > len(oob) {
+			break
+		}
+		oob = oob[space:]
+	}
+	return ECN_NOT_ECT
+}
+
+// encodeSockaddr writes the UDP address in the family of the socket, and returns its length.
+func (this *mmsgConn) encodeSockaddr(addr net.Addr, name *unix.RawSockaddrAny) (uint32, bool) {
+	udp, ok := addr.(*net.UDPAddr)
+	if !ok || udp.Zone != "" {
+		return 0, false
+	}
+	ip, ok := netip.AddrFromSlice(udp.IP)
+	if !ok {
+		return 0, false
+	}
+	if this.inet6 {
+		sa := (*unix.RawSockaddrInet6)(unsafe.Pointer(name))
+		*sa = unix.RawSockaddrInet6{Family: unix.AF_INET6, Addr: ip.As16()}
+		binary.BigEndian.PutUint16((*[2]byte)(unsafe.Pointer(&sa.Port))[:], uint16(udp.Port))
+		return unix.SizeofSockaddrInet6, true
+	}
+	ip = ip.Unmap()
+	if !ip.Is4() {
+		return 0, false
+	}
+	sa := (*unix.RawSockaddrInet4)(unsafe.Pointer(name))
+	*sa = unix.RawSockaddrInet4{Family: unix.AF_INET, Addr: ip.As4()}
+	binary.BigEndian.PutUint16((*[2]byte)(unsafe.Pointer(&sa.Port))[:], uint16(udp.Port))
+	return unix.SizeofSockaddrInet4, true
+}
+
+// decodeSockaddr returns the UDP address of the sender of a datagram.
+func decodeSockaddr(name *unix.RawSockaddrAny) net.Addr {
+	switch name.Addr.Family {
+	case unix.AF_INET:
+		sa := (*unix.RawSockaddrInet4)(unsafe.Pointer(name))
+		port := binary.BigEndian.Uint16((*[2]byte)(unsafe.Pointer(&sa.Port))[:])
+		return net.UDPAddrFromAddrPort(netip.AddrPortFrom(netip.AddrFrom4(sa.Addr), port))
+	case unix.AF_INET6:
+		sa := (*unix.RawSockaddrInet6)(unsafe.Pointer(name))
+		port := binary.BigEndian.Uint16((*[2]byte)(unsafe.Pointer(&sa.Port))[:])
+		// The IPv4 peers of a dual-stack socket are returned as IPv4 addresses
+		ip := netip.AddrFrom16(sa.Addr).Unmap()
+		if sa.Scope_id != 0 {
+			ip = ip.WithZone(strconv.FormatUint(uint64(sa.Scope_id), 10))
+		}
+		return net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip, port))
+	}
+	return nil
+}
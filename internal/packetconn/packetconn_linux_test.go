@@ -0,0 +1,93 @@
+package packetconn
+
+import "golang.org/x/sys/unix"
+import "net"
+import "testing"
+import "time"
+
+func Test_Conn_WriteGSO_Fallback(t *testing.T) {
+	reader, writer := listenPair(t)
+	defer reader.Close()
+	defer writer.Close()
+	r, w := New(reader), New(writer)
+	if !w.SupportsGSO() {
+		t.Skip("the kernel doesn't segment the buffers")
+	}
+
+	// A device without checksum offload fails with EIO: the segments are written as datagrams from then on
+	calls := 0
+	sendmsg = func(fd int, p, oob []byte, to unix.Sockaddr, flags int) (int, error) {
+		calls++
+		return 0, unix.EIO
+	}
+	defer func() { sendmsg = unix.SendmsgN }()
+	for i := 0; i < 2; i++ {
+		if err := w.WriteGSO(Message{Buffer: segmentedBuffer(5500, 1000), Addr: reader.LocalAddr()}, 1000); err != nil {
+			t.Fatalf("Conn.WriteGSO : unexpected error %v in test n°%v", err, i)
+		}
+		if w.SupportsGSO() || calls != 1 {
+			t.Errorf("Conn.WriteGSO : GSO must be disabled after EIO (%v calls) in test n°%v", calls, i)
+		}
+		checkSegments(t, r, reader, 5500, 1000, i)
+	}
+}
+
+var tests_ecn = []struct {
+	network string
+	address string
+	dst     net.IP
+}{
+	{"udp4", "127.0.0.1:0", net.IPv4(127, 0, 0, 1)},
+	{"udp", ":0", net.IPv4(127, 0, 0, 1)},
+	{"udp6", "[::1]:0", net.IPv6loopback},
+}
+
+func Test_Conn_ECN(t *testing.T) {
+	for i, v := range tests_ecn {
+		reader, err := net.ListenPacket(v.network, v.address)
+		if err != nil {
+			t.Logf("net.ListenPacket : %v skipped in test n°%v", err, i)
+			continue
+		}
+		writer, err := net.ListenPacket(v.network, v.address)
+		if err != nil {
+			t.Fatalf("net.ListenPacket : unexpected error %v in test n°%v", err, i)
+		}
+		r, w := New(reader), New(writer)
+		dst := &net.UDPAddr{IP: v.dst, Port: reader.LocalAddr().(*net.UDPAddr).Port}
+
+		// The codepoints are written with the batches and with the segmented buffers
+		codepoints := []ECN{ECN_NOT_ECT, ECN_ECT1, ECN_ECT0, ECN_CE}
+		out := make([]Message, len(codepoints))
+		for j, ecn := range codepoints {
+			out[j] = Message{Buffer: []byte{byte(j)}, Addr: dst, ECN: ecn}
+		}
+		if _, err = w.WriteBatch(out); err != nil {
+			t.Fatalf("Conn.WriteBatch : unexpected error %v in test n°%v", err, i)
+		}
+		for j, ecn := range codepoints {
+			if err = w.WriteGSO(Message{Buffer: []byte{byte(j + 4), byte(j + 4)}, Addr: dst, ECN: ecn}, 1); err != nil {
+				t.Fatalf("Conn.WriteGSO : unexpected error %v in test n°%v", err, i)
+			}
+		}
+		in := make([]Message, BATCH_SIZE)
+		for j := range in {
+			in[j].Buffer = make([]byte, 1500)
+		}
+		reader.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for received := 0; received < 3*len(codepoints); {
+			n, err := r.ReadBatch(in)
+			if err != nil {
+				t.Fatalf("Conn.ReadBatch : unexpected error %v after %v datagrams in test n°%v", err, received, i)
+			}
+			for _, m := range in[:n] {
+				if ecn := codepoints[m.Buffer[0]%4]; m.N == 0 || m.ECN != ecn {
+					t.Errorf("Conn.ReadBatch : ECN %v instead of %v for datagram %v in test n°%v", m.ECN, ecn, m.Buffer[0], i)
+				}
+			}
+			received += n
+		}
+		reader.Close()
+		writer.Close()
+	}
+}
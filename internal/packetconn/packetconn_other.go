@@ -0,0 +1,10 @@
+//go:build !linux
+
+package packetconn
+
+import "net"
+
+// newBatchConn returns nil: the datagrams are read and written one at a time.
+func newBatchConn(pc net.PacketConn) Conn {
+	return nil
+}
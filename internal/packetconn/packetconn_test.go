@@ -0,0 +1,223 @@
+package packetconn
+
+import "bytes"
+import "net"
+import "testing"
+import "time"
+
+var tests_conn = []struct {
+	network string
+	address string
+	batched bool
+}{
+	{"udp4", "127.0.0.1:0", true},
+	{"udp4", "127.0.0.1:0", false},
+	{"udp", "[::1]:0", true},
+	{"udp", ":0", true},
+}
+
+func Test_Conn(t *testing.T) {
+	for i, v := range tests_conn {
+		reader, err := net.ListenPacket(v.network, v.address)
+		if err != nil {
+			t.Logf("net.ListenPacket : %v skipped in test n°%v", err, i)
+			continue
+		}
+		writer, err := net.ListenPacket(v.network, v.address)
+		if err != nil {
+			t.Fatalf("net.ListenPacket : unexpected error %v in test n°%v", err, i)
+		}
+		r, w := newConn(reader, v.batched), newConn(writer, v.batched)
+		dst := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: reader.LocalAddr().(*net.UDPAddr).Port}
+		if v.address == "[::1]:0" {
+			dst.IP = net.IPv6loopback
+		}
+
+		// More datagrams than a batch, each with its own size and content
+		out := make([]Message, BATCH_SIZE+10)
+		for j := range out {
+			out[j] = Message{Buffer: bytes.Repeat([]byte{byte(j)}, 100+j), Addr: dst}
+		}
+		if n, err := w.WriteBatch(out); n != len(out) || err != nil {
+			t.Fatalf("Conn.WriteBatch : %v datagrams written (%v) instead of %v in test n°%v", n, err, len(out), i)
+		}
+		in := make([]Message, BATCH_SIZE)
+		for j := range in {
+			in[j].Buffer = make([]byte, 1500)
+		}
+		reader.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for j := 0; j < len(out); {
+			n, err := r.ReadBatch(in)
+			if err != nil || n == 0 {
+				t.Fatalf("Conn.ReadBatch : %v datagrams read (%v) in test n°%v", n, err, i)
+			}
+			for k := 0; k < n; k, j = k+1, j+1 {
+				if !bytes.Equal(in[k].Buffer[:in[k].N], out[j].Buffer) {
+					t.Errorf("Conn.ReadBatch : invalid datagram %v in test n°%v", j, i)
+				}
+				if in[k].Addr.(*net.UDPAddr).Port != writer.LocalAddr().(*net.UDPAddr).Port {
+					t.Errorf("Conn.ReadBatch : invalid address %v of datagram %v in test n°%v", in[k].Addr, j, i)
+				}
+			}
+		}
+
+		// The read error is returned once the PacketConn is closed
+		reader.Close()
+		if _, err = r.ReadBatch(in); err == nil {
+			t.Errorf("Conn.ReadBatch : error expected on a closed PacketConn in test n°%v", i)
+		}
+		writer.Close()
+	}
+}
+
+var tests_writegso = []struct {
+	batched bool
+	segSize int
+	size    int
+}{
+	{true, 1000, 10500},
+	{true, 1200, 1200},
+	{true, 1000, 100 * 1000},
+	{false, 1000, 10500},
+}
+
+func Test_Conn_WriteGSO(t *testing.T) {
+	for i, v := range tests_writegso {
+		reader, writer := listenPair(t)
+		r, w := newConn(reader, v.batched), newConn(writer, v.batched)
+		if !v.batched && w.SupportsGSO() {
+			t.Errorf("Conn.SupportsGSO : GSO not expected without batching in test n°%v", i)
+		}
+		// The datagrams are received whether the kernel segments the buffer or not
+		if err := w.WriteGSO(Message{Buffer: segmentedBuffer(v.size, v.segSize), Addr: reader.LocalAddr()}, v.segSize); err != nil {
+			t.Fatalf("Conn.WriteGSO : unexpected error %v in test n°%v", err, i)
+		}
+		checkSegments(t, r, reader, v.size, v.segSize, i)
+		reader.Close()
+		writer.Close()
+	}
+}
+
+// listenPair returns two PacketConns on the IPv4 loopback.
+func listenPair(t testing.TB) (net.PacketConn, net.PacketConn) {
+	reader, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.(*net.UDPConn).SetReadBuffer(4 << 20)
+	return reader, writer
+}
+
+// segmentedBuffer returns a buffer of segments of segSize bytes, each filled with its index.
+func segmentedBuffer(size, segSize int) []byte {
+	buf := make([]byte, size)
+	for i := range buf {
+		buf[i] = byte(i / segSize)
+	}
+	return buf
+}
+
+// checkSegments reads the segments of segmentedBuffer as datagrams.
+func checkSegments(t *testing.T, r Conn, reader net.PacketConn, size, segSize, test int) {
+	in := make([]Message, BATCH_SIZE)
+	for j := range in {
+		in[j].Buffer = make([]byte, 1500)
+	}
+	expected := segmentedBuffer(size, segSize)
+	reader.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for j := 0; len(expected) > 0; {
+		n, err := r.ReadBatch(in)
+		if err != nil {
+			t.Fatalf("Conn.ReadBatch : unexpected error %v after %v datagrams in test n°%v", err, j, test)
+		}
+		for k := 0; k < n; k, j = k+1, j+1 {
+			l := segSize
+			if l > len(expected) {
+				l = len(expected)
+			}
+			if !bytes.Equal(in[k].Buffer[:in[k].N], expected[:l]) {
+				t.Fatalf("Conn.ReadBatch : invalid datagram %v of %v bytes in test n°%v", j, in[k].N, test)
+			}
+			expected = expected[l:]
+		}
+	}
+}
+
+// newConn returns the Conn of the PacketConn, with or without batching.
+func newConn(pc net.PacketConn, batched bool) Conn {
+	if batched {
+		return New(pc)
+	}
+	return newSingleConn(pc)
+}
+
+func Benchmark_Conn_Batched(b *testing.B) {
+	benchmarkConn(b, true)
+}
+
+func Benchmark_Conn_Single(b *testing.B) {
+	benchmarkConn(b, false)
+}
+
+func Benchmark_Conn_GSO(b *testing.B) {
+	reader, writer := listenPair(b)
+	defer reader.Close()
+	defer writer.Close()
+	r, w := New(reader), New(writer)
+	if !w.SupportsGSO() {
+		b.Skip("the kernel doesn't segment the buffers")
+	}
+
+	buf := make([]byte, BATCH_SIZE*1350)
+	in := make([]Message, BATCH_SIZE)
+	for i := range in {
+		in[i].Buffer = make([]byte, 1500)
+	}
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := w.WriteGSO(Message{Buffer: buf, Addr: reader.LocalAddr()}, 1350); err != nil {
+			b.Fatal(err)
+		}
+		readAll(r, reader, in)
+	}
+}
+
+// benchmarkConn sends datagrams of 1350 bytes in batches on the loopback, and reads them.
+func benchmarkConn(b *testing.B, batched bool) {
+	reader, writer := listenPair(b)
+	defer reader.Close()
+	defer writer.Close()
+	r, w := newConn(reader, batched), newConn(writer, batched)
+
+	out := make([]Message, BATCH_SIZE)
+	in := make([]Message, BATCH_SIZE)
+	for i := range out {
+		out[i] = Message{Buffer: make([]byte, 1350), Addr: reader.LocalAddr()}
+		in[i].Buffer = make([]byte, 1500)
+	}
+	b.SetBytes(int64(len(out) * 1350))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := w.WriteBatch(out); err != nil {
+			b.Fatal(err)
+		}
+		readAll(r, reader, in)
+	}
+}
+
+// readAll reads a batch of datagrams, the datagrams lost by the loopback under load don't block the benchmark.
+func readAll(r Conn, reader net.PacketConn, in []Message) {
+	reader.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	for received := 0; received < len(in); {
+		n, err := r.ReadBatch(in)
+		if err != nil {
+			return
+		}
+		received += n
+	}
+}
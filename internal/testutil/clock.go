@@ -0,0 +1,182 @@
+// Package testutil runs the sessions of the tests on a simulated network with a simulated clock: the delays, the losses
+// and the timers of the connections are reproducible, and the simulated time runs faster than the wall time.
+package testutil
+
+import "github.com/romain-jacotin/quic/protocol"
+import "runtime"
+import "sync"
+import "time"
+
+// SETTLE_TIME is the wall time left to the goroutines between two advances of Clock.Run.
+const SETTLE_TIME = 100 * time.Microsecond
+
+// Clock is a protocol.Clock whose time only moves with Advance: the timers fire in the order of their deadlines,
+// at their deadlines. The callbacks of AfterFunc are run by the goroutine of Advance.
+type Clock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*timer
+	seq    uint64
+}
+
+// timer is a timer of the Clock: it sends on c, or calls f.
+type timer struct {
+	clock *Clock
+	when  time.Time
+	seq   uint64
+	c     chan time.Time
+	f     func()
+}
+
+// NewClock returns a Clock at the time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the simulated time.
+func (this *Clock) Now() time.Time {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.now
+}
+
+// NewTimer returns a timer that fires once the Clock advances by the duration.
+func (this *Clock) NewTimer(d time.Duration) protocol.Timer {
+	t := &timer{clock: this, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// AfterFunc calls f in the goroutine of Advance once the Clock advances by the duration, the channel of the timer is nil.
+func (this *Clock) AfterFunc(d time.Duration, f func()) protocol.Timer {
+	t := &timer{clock: this, f: f}
+	t.Reset(d)
+	return t
+}
+
+// After returns the channel of a new timer, like time.After.
+func (this *Clock) After(d time.Duration) <-chan time.Time {
+	return this.NewTimer(d).Chan()
+}
+
+// Advance moves the time forward by the duration, and fires the timers whose deadline is reached.
+func (this *Clock) Advance(d time.Duration) {
+	this.mutex.Lock()
+	end := this.now.Add(d)
+	for {
+		t := this.next()
+		if t == nil || t.when.After(end) {
+			break
+		}
+		this.remove(t)
+		if t.when.After(this.now) {
+			this.now = t.when
+		}
+		if t.f == nil {
+			select {
+			case t.c <- this.now:
+			default:
+			}
+			continue
+		}
+		this.mutex.Unlock()
+		t.f()
+		this.mutex.Lock()
+	}
+	this.now = end
+	this.mutex.Unlock()
+}
+
+// Until returns the duration until the next deadline of the timers, and false if no timer is active.
+func (this *Clock) Until() (time.Duration, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	t := this.next()
+	if t == nil {
+		return 0, false
+	}
+	return t.when.Sub(this.now), true
+}
+
+// Run advances the Clock in the background by step every SETTLE_TIME of wall time, until stop is called.
+// The goroutines woken by the timers run before the next advance unless they need more than SETTLE_TIME:
+// they see the time at the end of the step.
+func (this *Clock) Run(step time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			// The timers of the time package are too coarse: the goroutine yields until SETTLE_TIME elapses
+			for start := time.Now(); time.Since(start) < SETTLE_TIME; {
+				runtime.Gosched()
+			}
+			select {
+			case <-done:
+				return
+			default:
+			}
+			this.Advance(step)
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// next returns the active timer of the earliest deadline, the first one created among equal deadlines.
+func (this *Clock) next() *timer {
+	var first *timer
+	for _, t := range this.timers {
+		if first == nil || t.when.Before(first.when) || (t.when.Equal(first.when) && t.seq < first.seq) {
+			first = t
+		}
+	}
+	return first
+}
+
+// remove deactivates the timer, it returns false if it was not active.
+func (this *Clock) remove(t *timer) bool {
+	for i, u := range this.timers {
+		if u == t {
+			this.timers = append(this.timers[:i], this.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (this *timer) Chan() <-chan time.Time {
+	return this.c
+}
+
+func (this *timer) Stop() bool {
+	this.clock.mutex.Lock()
+	defer this.clock.mutex.Unlock()
+	this.drain()
+	return this.clock.remove(this)
+}
+
+func (this *timer) Reset(d time.Duration) bool {
+	this.clock.mutex.Lock()
+	defer this.clock.mutex.Unlock()
+	this.drain()
+	active := this.clock.remove(this)
+	if d < 0 {
+		d = 0
+	}
+	this.when = this.clock.now.Add(d)
+	this.clock.seq++
+	this.seq = this.clock.seq
+	this.clock.timers = append(this.clock.timers, this)
+	return active
+}
+
+// drain drops the time of a fired timer not received, like the timers of the time package since Go 1.23.
+func (this *timer) drain() {
+	select {
+	case <-this.c:
+	default:
+	}
+}
@@ -0,0 +1,83 @@
+package testutil
+
+import "testing"
+import "time"
+
+func Test_Clock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewClock(start)
+	var fired []int
+	clock.AfterFunc(30*time.Millisecond, func() { fired = append(fired, 30) })
+	clock.AfterFunc(10*time.Millisecond, func() { fired = append(fired, 10) })
+	timer := clock.NewTimer(20 * time.Millisecond)
+	stopped := clock.AfterFunc(15*time.Millisecond, func() { fired = append(fired, 15) })
+	if !stopped.Stop() || stopped.Stop() {
+		t.Error("Timer.Stop : true expected for an active timer only")
+	}
+	if d, ok := clock.Until(); !ok || d != 10*time.Millisecond {
+		t.Errorf("Clock.Until : 10ms expected instead of %v (%v)", d, ok)
+	}
+
+	var tests_advance = []struct {
+		d     time.Duration
+		fired int
+		timer bool
+	}{
+		{5 * time.Millisecond, 0, false},
+		{5 * time.Millisecond, 1, false},
+		{15 * time.Millisecond, 1, true},
+		{time.Second, 2, false},
+	}
+	elapsed := time.Duration(0)
+	for i, v := range tests_advance {
+		clock.Advance(v.d)
+		elapsed += v.d
+		if now := clock.Now(); !now.Equal(start.Add(elapsed)) {
+			t.Errorf("Clock.Now : %v expected instead of %v in test n°%v", start.Add(elapsed), now, i)
+		}
+		if len(fired) != v.fired {
+			t.Errorf("Clock.AfterFunc : %v callbacks expected instead of %v in test n°%v", v.fired, len(fired), i)
+		}
+		select {
+		case now := <-timer.Chan():
+			if !v.timer || !now.Equal(start.Add(20*time.Millisecond)) {
+				t.Errorf("Timer.Chan : unexpected time %v in test n°%v", now, i)
+			}
+		default:
+			if v.timer {
+				t.Errorf("Timer.Chan : the timer must fire in test n°%v", i)
+			}
+		}
+	}
+	if len(fired) != 2 || fired[0] != 10 || fired[1] != 30 {
+		t.Errorf("Clock.AfterFunc : the callbacks must run in the order of their deadlines instead of %v", fired)
+	}
+
+	// A fired timer is inactive, Reset activates it again and drops the time not received
+	if timer.Reset(10*time.Millisecond) || !timer.Reset(20*time.Millisecond) {
+		t.Error("Timer.Reset : true expected for an active timer only")
+	}
+	clock.Advance(10 * time.Millisecond)
+	timer.Reset(0)
+	clock.Advance(0)
+	if now := <-timer.Chan(); !now.Equal(clock.Now()) {
+		t.Errorf("Timer.Chan : %v expected instead of %v", clock.Now(), now)
+	}
+	if _, ok := clock.Until(); ok {
+		t.Error("Clock.Until : no active timer expected")
+	}
+}
+
+func Test_Clock_Run(t *testing.T) {
+	clock := NewClock(time.Unix(1000, 0))
+	stop := clock.Run(time.Millisecond)
+	defer stop()
+
+	// The simulated time runs faster than the wall time, and wakes the timers
+	timer := clock.NewTimer(100 * time.Millisecond)
+	select {
+	case <-timer.Chan():
+	case <-time.After(5 * time.Second):
+		t.Error("Clock.Run : the timer must fire")
+	}
+}
@@ -0,0 +1,261 @@
+package testutil
+
+import "github.com/romain-jacotin/quic/protocol"
+import "math/rand"
+import "net"
+import "os"
+import "sync"
+import "time"
+
+// Link is the path of the datagrams sent by an endpoint of the SimulatedNetwork.
+type Link struct {
+	// Delay is the one-way delay of the datagrams
+	Delay time.Duration
+	// Jitter adds a random delay up to Jitter to each datagram, the datagrams stay in order
+	Jitter time.Duration
+	// Loss is the probability that a datagram is lost
+	Loss float64
+	// Reorder is the probability that a datagram is delayed by another Delay, behind the next ones
+	Reorder float64
+	// Bandwidth is the rate of the link in bytes per second, unlimited if 0
+	Bandwidth int
+	// QueueSize is the number of bytes waiting for the bandwidth, the datagrams beyond are dropped: unlimited if 0
+	QueueSize int
+	// MTU drops the datagrams larger than MTU bytes, unlimited if 0
+	MTU int
+}
+
+// Stats counts the datagrams sent on a SimulatedNetwork, and the ones that did not arrive or arrived out of order.
+type Stats struct {
+	Sent      int
+	Lost      int
+	Dropped   int
+	Reordered int
+}
+
+// SimulatedNetwork connects SimulatedConns with Links on the time of a Clock: a datagram arrives once the Clock reaches
+// the end of its transmission plus the delay of the Link. The random losses, jitter and reordering are drawn from the seed,
+// the same datagrams sent at the same times have the same fate.
+type SimulatedNetwork struct {
+	clock *Clock
+
+	mutex sync.Mutex
+	rand  *rand.Rand
+	link  Link
+	conns map[string]*SimulatedConn
+	stats Stats
+}
+
+// NewSimulatedNetwork returns a SimulatedNetwork whose endpoints send on the Link by default.
+func NewSimulatedNetwork(clock *Clock, link Link, seed int64) *SimulatedNetwork {
+	return &SimulatedNetwork{
+		clock: clock,
+		rand:  rand.New(rand.NewSource(seed)),
+		link:  link,
+		conns: make(map[string]*SimulatedConn)}
+}
+
+// ListenPacket returns a new endpoint of the network, at the address 10.0.0.n:443.
+func (this *SimulatedNetwork) ListenPacket() *SimulatedConn {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	n := len(this.conns) + 1
+	c := &SimulatedConn{
+		network: this,
+		addr:    &net.UDPAddr{IP: net.IPv4(10, 0, byte(n>>8), byte(n)), Port: 443},
+		link:    this.link}
+	c.cond = sync.NewCond(&c.mutex)
+	this.conns[c.addr.String()] = c
+	return c
+}
+
+// Stats returns the counters of the datagrams sent.
+func (this *SimulatedNetwork) Stats() Stats {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.stats
+}
+
+// send schedules the arrival of a copy of the datagram at the endpoint of the address, unless the Link of the sender drops it.
+func (this *SimulatedNetwork) send(src *SimulatedConn, b []byte, addr net.Addr) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.stats.Sent++
+	link := src.link
+	now := this.clock.Now()
+	if link.MTU > 0 && len(b) > link.MTU {
+		this.stats.Dropped++
+		return
+	}
+	// The datagram waits for the transmission of the previous ones
+	sent := now
+	if src.busyUntil.After(now) {
+		sent = src.busyUntil
+	}
+	if link.Bandwidth > 0 {
+		if link.QueueSize > 0 && int(int64(sent.Sub(now))*int64(link.Bandwidth)/int64(time.Second))+len(b) > link.QueueSize {
+			this.stats.Dropped++
+			return
+		}
+		sent = sent.Add(time.Duration(len(b)) * time.Second / time.Duration(link.Bandwidth))
+		src.busyUntil = sent
+	}
+	if link.Loss > 0 && this.rand.Float64() < link.Loss {
+		this.stats.Lost++
+		return
+	}
+	arrival := sent.Add(link.Delay)
+	if link.Jitter > 0 {
+		arrival = arrival.Add(time.Duration(this.rand.Int63n(int64(link.Jitter))))
+	}
+	if link.Reorder > 0 && this.rand.Float64() < link.Reorder {
+		this.stats.Reordered++
+		arrival = arrival.Add(link.Delay)
+	} else {
+		if arrival.Before(src.lastArrival) {
+			arrival = src.lastArrival
+		}
+		src.lastArrival = arrival
+	}
+	dst := this.conns[addr.String()]
+	if dst == nil {
+		return
+	}
+	d := datagram{data: append([]byte(nil), b...), addr: src.addr}
+	if !arrival.After(now) {
+		dst.deliver(d)
+		return
+	}
+	this.clock.AfterFunc(arrival.Sub(now), func() { dst.deliver(d) })
+}
+
+// remove disconnects the endpoint, the datagrams sent to it are lost.
+func (this *SimulatedNetwork) remove(c *SimulatedConn) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.conns[c.addr.String()] == c {
+		delete(this.conns, c.addr.String())
+	}
+}
+
+// datagram is a datagram received by a SimulatedConn.
+type datagram struct {
+	data []byte
+	addr net.Addr
+}
+
+// SimulatedConn is an endpoint of a SimulatedNetwork, its deadlines are times of the Clock.
+type SimulatedConn struct {
+	network *SimulatedNetwork
+	addr    *net.UDPAddr
+	// link, busyUntil and lastArrival are guarded by the mutex of the network
+	link        Link
+	busyUntil   time.Time
+	lastArrival time.Time
+
+	mutex         sync.Mutex
+	cond          *sync.Cond
+	queue         []datagram
+	closed        bool
+	deadline      time.Time
+	deadlineTimer protocol.Timer
+}
+
+// SetLink changes the Link of the datagrams sent by the endpoint.
+func (this *SimulatedConn) SetLink(link Link) {
+	this.network.mutex.Lock()
+	this.link = link
+	this.network.mutex.Unlock()
+}
+
+// deliver queues a datagram arrived at the endpoint.
+func (this *SimulatedConn) deliver(d datagram) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.closed {
+		return
+	}
+	this.queue = append(this.queue, d)
+	this.cond.Signal()
+}
+
+// ReadFrom waits for the next datagram, until the endpoint is closed or the Clock reaches the read deadline.
+func (this *SimulatedConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for len(this.queue) == 0 {
+		if this.closed {
+			return 0, nil, &net.OpError{Op: "read", Net: "udp", Addr: this.addr, Err: net.ErrClosed}
+		}
+		if !this.deadline.IsZero() && !this.network.clock.Now().Before(this.deadline) {
+			return 0, nil, &net.OpError{Op: "read", Net: "udp", Addr: this.addr, Err: os.ErrDeadlineExceeded}
+		}
+		this.cond.Wait()
+	}
+	d := this.queue[0]
+	this.queue[0] = datagram{}
+	this.queue = this.queue[1:]
+	return copy(b, d.data), d.addr, nil
+}
+
+// WriteTo sends the datagram on the Link of the endpoint, it never blocks.
+func (this *SimulatedConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	this.mutex.Lock()
+	closed := this.closed
+	this.mutex.Unlock()
+	if closed {
+		return 0, &net.OpError{Op: "write", Net: "udp", Addr: this.addr, Err: net.ErrClosed}
+	}
+	this.network.send(this, b, addr)
+	return len(b), nil
+}
+
+// Close disconnects the endpoint and interrupts ReadFrom.
+func (this *SimulatedConn) Close() error {
+	this.network.remove(this)
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.closed {
+		return &net.OpError{Op: "close", Net: "udp", Addr: this.addr, Err: net.ErrClosed}
+	}
+	this.closed = true
+	this.queue = nil
+	if this.deadlineTimer != nil {
+		this.deadlineTimer.Stop()
+	}
+	this.cond.Broadcast()
+	return nil
+}
+
+func (this *SimulatedConn) LocalAddr() net.Addr {
+	return this.addr
+}
+
+func (this *SimulatedConn) SetDeadline(t time.Time) error {
+	return this.SetReadDeadline(t)
+}
+
+// SetReadDeadline interrupts ReadFrom once the Clock reaches the time.
+func (this *SimulatedConn) SetReadDeadline(t time.Time) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.deadline = t
+	if this.deadlineTimer != nil {
+		this.deadlineTimer.Stop()
+		this.deadlineTimer = nil
+	}
+	if !t.IsZero() {
+		this.deadlineTimer = this.network.clock.AfterFunc(t.Sub(this.network.clock.Now()), func() {
+			this.mutex.Lock()
+			this.cond.Broadcast()
+			this.mutex.Unlock()
+		})
+	}
+	this.cond.Broadcast()
+	return nil
+}
+
+// SetWriteDeadline does nothing: WriteTo never blocks.
+func (this *SimulatedConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,142 @@
+package testutil
+
+import "bytes"
+import "errors"
+import "net"
+import "os"
+import "testing"
+import "time"
+
+// receive returns the datagrams arrived at the endpoint, with the times of the Clock they were read.
+func receive(clock *Clock, c *SimulatedConn, step time.Duration, steps int) ([][]byte, []time.Duration) {
+	var data [][]byte
+	var times []time.Duration
+	start := clock.Now()
+	b := make([]byte, 2048)
+	for i := 0; i <= steps; i++ {
+		for {
+			c.mutex.Lock()
+			n := len(c.queue)
+			c.mutex.Unlock()
+			if n == 0 {
+				break
+			}
+			m, _, _ := c.ReadFrom(b)
+			data = append(data, append([]byte(nil), b[:m]...))
+			times = append(times, clock.Now().Sub(start))
+		}
+		clock.Advance(step)
+	}
+	return data, times
+}
+
+func Test_SimulatedNetwork_Link(t *testing.T) {
+	var tests_link = []struct {
+		link    Link
+		sizes   []int
+		arrived []int
+		times   []time.Duration
+		stats   Stats
+	}{
+		// The delay of the link
+		{Link{Delay: 10 * time.Millisecond}, []int{100, 100}, []int{0, 1}, []time.Duration{10 * time.Millisecond, 10 * time.Millisecond}, Stats{Sent: 2}},
+		// The datagrams wait for the transmission of the previous ones, 1ms per 1000 bytes
+		{Link{Delay: 10 * time.Millisecond, Bandwidth: 1000 * 1000}, []int{1000, 1000, 500}, []int{0, 1, 2},
+			[]time.Duration{11 * time.Millisecond, 12 * time.Millisecond, 13 * time.Millisecond}, Stats{Sent: 3}},
+		// The queue holds 1500 bytes
+		{Link{Bandwidth: 1000 * 1000, QueueSize: 1500}, []int{1000, 1000, 500}, []int{0, 2},
+			[]time.Duration{time.Millisecond, 2 * time.Millisecond}, Stats{Sent: 3, Dropped: 1}},
+		// The datagrams over the MTU are dropped
+		{Link{MTU: 1200}, []int{1200, 1201, 100}, []int{0, 2}, []time.Duration{0, 0}, Stats{Sent: 3, Dropped: 1}},
+		// A lossy link loses all the datagrams
+		{Link{Loss: 1}, []int{100, 100}, nil, nil, Stats{Sent: 2, Lost: 2}},
+		// A reordered datagram arrives after the next ones
+		{Link{Delay: 10 * time.Millisecond, Reorder: 1}, []int{100}, []int{0}, []time.Duration{20 * time.Millisecond}, Stats{Sent: 1, Reordered: 1}},
+	}
+	for i, v := range tests_link {
+		clock := NewClock(time.Unix(1000, 0))
+		network := NewSimulatedNetwork(clock, v.link, 1)
+		a, b := network.ListenPacket(), network.ListenPacket()
+		for j, size := range v.sizes {
+			if n, err := a.WriteTo(bytes.Repeat([]byte{byte(j)}, size), b.LocalAddr()); n != size || err != nil {
+				t.Errorf("SimulatedConn.WriteTo : %v bytes expected instead of %v (%v) in test n°%v", size, n, err, i)
+			}
+		}
+		data, times := receive(clock, b, time.Millisecond, 50)
+		if len(data) != len(v.arrived) {
+			t.Errorf("SimulatedConn.ReadFrom : %v datagrams expected instead of %v in test n°%v", len(v.arrived), len(data), i)
+			continue
+		}
+		for j, k := range v.arrived {
+			if len(data[j]) != v.sizes[k] || data[j][0] != byte(k) || times[j] != v.times[j] {
+				t.Errorf("SimulatedConn.ReadFrom : datagram %v expected at %v instead of %v bytes at %v in test n°%v", k, v.times[j], len(data[j]), times[j], i)
+			}
+		}
+		if stats := network.Stats(); stats != v.stats {
+			t.Errorf("SimulatedNetwork.Stats : %+v expected instead of %+v in test n°%v", v.stats, stats, i)
+		}
+	}
+}
+
+func Test_SimulatedNetwork_Seed(t *testing.T) {
+	// The same seed loses the same datagrams, with the same jitter
+	run := func(seed int64) ([][]byte, []time.Duration) {
+		clock := NewClock(time.Unix(1000, 0))
+		network := NewSimulatedNetwork(clock, Link{Delay: 10 * time.Millisecond, Jitter: 5 * time.Millisecond, Loss: 0.3}, seed)
+		a, b := network.ListenPacket(), network.ListenPacket()
+		for i := 0; i < 100; i++ {
+			a.WriteTo([]byte{byte(i)}, b.LocalAddr())
+			clock.Advance(time.Millisecond)
+		}
+		return receive(clock, b, 100*time.Microsecond, 200)
+	}
+	data1, times1 := run(1)
+	data2, times2 := run(1)
+	if len(data1) == 0 || len(data1) == 100 || len(data1) != len(data2) {
+		t.Fatalf("SimulatedNetwork : %v and %v datagrams received", len(data1), len(data2))
+	}
+	for i := range data1 {
+		if !bytes.Equal(data1[i], data2[i]) || times1[i] != times2[i] {
+			t.Errorf("SimulatedNetwork : datagram %v at %v expected instead of %v at %v in test n°%v", data1[i], times1[i], data2[i], times2[i], i)
+		}
+		// The jitter keeps the datagrams in order
+		if i > 0 && data1[i][0] < data1[i-1][0] {
+			t.Errorf("SimulatedNetwork : datagram %v received after %v in test n°%v", data1[i], data1[i-1], i)
+		}
+	}
+}
+
+func Test_SimulatedConn_Deadline(t *testing.T) {
+	clock := NewClock(time.Unix(1000, 0))
+	network := NewSimulatedNetwork(clock, Link{}, 1)
+	a, b := network.ListenPacket(), network.ListenPacket()
+
+	// The read deadline is a time of the Clock
+	errs := make(chan error, 1)
+	b.SetReadDeadline(clock.Now().Add(time.Second))
+	go func() {
+		_, _, err := b.ReadFrom(make([]byte, 10))
+		errs <- err
+	}()
+	clock.Advance(time.Second)
+	if err := <-errs; !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("SimulatedConn.ReadFrom : os.ErrDeadlineExceeded expected instead of %v", err)
+	}
+
+	// Close interrupts ReadFrom, the datagrams sent to a closed endpoint are lost
+	b.SetReadDeadline(time.Time{})
+	go func() {
+		_, _, err := b.ReadFrom(make([]byte, 10))
+		errs <- err
+	}()
+	b.Close()
+	if err := <-errs; !errors.Is(err, net.ErrClosed) {
+		t.Errorf("SimulatedConn.ReadFrom : net.ErrClosed expected instead of %v", err)
+	}
+	if _, err := a.WriteTo([]byte{1}, b.LocalAddr()); err != nil {
+		t.Errorf("SimulatedConn.WriteTo : unexpected error %v", err)
+	}
+	if _, err := b.WriteTo([]byte{1}, a.LocalAddr()); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("SimulatedConn.WriteTo : net.ErrClosed expected instead of %v", err)
+	}
+}
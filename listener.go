@@ -0,0 +1,325 @@
+package quic
+
+import "github.com/romain-jacotin/quic/crypto"
+import "github.com/romain-jacotin/quic/handshake"
+import "github.com/romain-jacotin/quic/internal/bufferpool"
+import "github.com/romain-jacotin/quic/internal/packetconn"
+import "github.com/romain-jacotin/quic/protocol"
+import "bytes"
+import "context"
+import "crypto/hmac"
+import "crypto/sha256"
+import "encoding/binary"
+import "errors"
+import "net"
+import "sync"
+import "time"
+
+const (
+	// MIN_INITIAL_PACKET_SIZE is the minimum size of the first packet of a client, that carries a CHLO padded to
+	// handshake.CLIENT_HELLO_MINIMUM_SIZE: the smaller ones are dropped, the answers are not larger than the packet
+	MIN_INITIAL_PACKET_SIZE = handshake.CLIENT_HELLO_MINIMUM_SIZE
+	// VERSION_NEGOTIATION_INTERVAL is the minimum interval between the version negotiation packets sent to a source address
+	VERSION_NEGOTIATION_INTERVAL = 100 * time.Millisecond
+	// MAX_RATE_LIMITER_SOURCES is the number of source addresses remembered by the rate limiters of the version negotiation
+	// and public reset packets
+	MAX_RATE_LIMITER_SOURCES = 1024
+)
+
+// ErrListenerClosed is returned by Accept after Close.
+var ErrListenerClosed = errors.New("Listener : listener closed")
+
+// Listener accepts the sessions of the clients on a PacketConn.
+type Listener interface {
+	// Accept returns the next session whose crypto handshake is complete, it blocks until there is one
+	Accept() (Session, error)
+	// Addr returns the local network address of the PacketConn
+	Addr() net.Addr
+	// Close stops accepting sessions: the sessions not yet accepted are closed, but the accepted ones and the PacketConn are not
+	Close() error
+	// Metrics returns the counters and gauges of the Listener and its sessions, they can be read from any goroutine
+	Metrics() Metrics
+}
+
+// listener implements Listener: the packetMux gives it the datagrams of the unknown Connection IDs,
+// and a server session is created for each valid CHLO. The sessions are accepted once they have the forward-secure keys.
+type listener struct {
+	mux *packetMux
+	// peer is the only address whose sessions are accepted, any address if it is nil
+	peer    net.Addr
+	config  *Config
+	metrics *listenerMetrics
+	// versionNegotiations and publicResets limit the packets sent without state, used by the read goroutine
+	versionNegotiations *rateLimiter
+	publicResets        *rateLimiter
+
+	mutex       sync.Mutex
+	cond        *sync.Cond
+	pending     map[protocol.QuicConnectionID]*session
+	acceptQueue []*session
+	closeErr    error
+}
+
+var _ Listener = (*listener)(nil)
+
+// Accept returns the next session whose crypto handshake is complete, it blocks until there is one.
+func (this *listener) Accept() (Session, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for len(this.acceptQueue) == 0 {
+		if this.closeErr != nil {
+			return nil, this.closeErr
+		}
+		this.cond.Wait()
+	}
+	s := this.acceptQueue[0]
+	this.acceptQueue = this.acceptQueue[1:]
+	return s, nil
+}
+
+// acceptContext is Accept interrupted by the end of the context, that closes the listener with a protocol.ContextError of the operation.
+func (this *listener) acceptContext(ctx context.Context, op string) (Session, error) {
+	if ctx.Done() != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				this.closeWithError(protocol.ContextError{Op: op, Err: ctx.Err()})
+			case <-stop:
+			}
+		}()
+	}
+	return this.Accept()
+}
+
+// Addr returns the local network address of the PacketConn.
+func (this *listener) Addr() net.Addr {
+	return this.mux.pc.LocalAddr()
+}
+
+// Metrics returns the counters and gauges of the Listener and its sessions.
+func (this *listener) Metrics() Metrics {
+	return this.metrics
+}
+
+// Close stops accepting sessions: the sessions not yet accepted are closed, but the accepted ones and the PacketConn are not.
+func (this *listener) Close() error {
+	this.closeWithError(ErrListenerClosed)
+	return nil
+}
+
+// closeWithError closes the sessions not yet accepted, and detaches the listener from the packetMux.
+func (this *listener) closeWithError(err error) {
+	this.mutex.Lock()
+	if this.closeErr != nil {
+		this.mutex.Unlock()
+		return
+	}
+	this.closeErr = err
+	sessions := this.acceptQueue
+	for _, s := range this.pending {
+		sessions = append(sessions, s)
+	}
+	this.acceptQueue = nil
+	this.cond.Broadcast()
+	this.mutex.Unlock()
+	for _, s := range sessions {
+		s.close(Error{ErrorCode: protocol.QUIC_PEER_GOING_AWAY, ReasonPhrase: "listener closed"})
+	}
+	this.mux.removeListener()
+}
+
+// handleDatagram answers the unsupported versions with a version negotiation packet, the packets of the unknown connections with
+// a public reset, and creates a server session for a valid CHLO. The buffer of the datagram goes to the new session, or back to the pool.
+//
+// No state is created before a valid CHLO of a supported version: the packets smaller than MIN_INITIAL_PACKET_SIZE are dropped,
+// the version negotiation and public reset packets are rate limited. The CHLOs are dropped while MaxPendingSessions sessions
+// are in handshake, a session in handshake is closed after the HandshakeTimeout.
+func (this *listener) handleDatagram(b []byte, addr net.Addr, ecn packetconn.ECN, connID protocol.QuicConnectionID, rcvTime time.Time) {
+	s := this.newSession(b, addr, connID, rcvTime)
+	if s == nil {
+		bufferpool.Put(b)
+		return
+	}
+	s.handleDatagram(b, addr, ecn, rcvTime)
+	go this.waitForHandshake(s)
+}
+
+// newSession returns the started server session of a valid CHLO, or nil.
+func (this *listener) newSession(b []byte, addr net.Addr, connID protocol.QuicConnectionID, rcvTime time.Time) *session {
+	if this.peer != nil && addr.String() != this.peer.String() {
+		return nil
+	}
+	header, _, err := protocol.ParsePublicHeader(b)
+	if err != nil || header.GetPublicResetFlag() {
+		return nil
+	}
+	if !header.GetVersionFlag() {
+		this.sendPublicReset(b, addr, header, rcvTime)
+		return nil
+	}
+	if len(b) < MIN_INITIAL_PACKET_SIZE {
+		return nil
+	}
+	if !containsVersion(this.config.Versions, header.GetVersion()) {
+		if this.versionNegotiations.Allow(addr, rcvTime) {
+			this.mux.pc.WriteTo(protocol.BuildVersionNegotiationPacket(connID, this.config.Versions), addr)
+			this.metrics.versionNegotiationsSent.Add(1)
+		}
+		return nil
+	}
+	if !isValidCHLO(b) {
+		return nil
+	}
+	// The CHLO retransmitted by the client gets a session once a handshake ends
+	this.mutex.Lock()
+	full := len(this.pending) >= this.config.MaxPendingSessions
+	this.mutex.Unlock()
+	if full {
+		this.metrics.chlosDropped.Add(1)
+		return nil
+	}
+	conn := &muxConn{mux: this.mux, remote: addr, connID: connID, ecn: ecnCodepoint(this.config)}
+	config := this.config
+	if config.TruncateConnectionID && this.mux.addTruncatedConn(conn) != nil {
+		// The address has a truncated connection already
+		c := *config
+		c.TruncateConnectionID = false
+		config = &c
+	}
+	s, err := newServerSession(conn, connID, header.GetVersion(), config)
+	if err != nil || this.mux.addSession(connID, s) != nil {
+		this.mux.removeTruncatedConn(conn)
+		return nil
+	}
+	s.metrics = this.metrics
+	this.mutex.Lock()
+	closed := this.closeErr != nil
+	if !closed {
+		this.pending[connID] = s
+	}
+	this.mutex.Unlock()
+	if closed {
+		conn.Close()
+		return nil
+	}
+	this.metrics.activeConnections.Add(1)
+	s.start()
+	return s
+}
+
+// waitForHandshake queues the session for Accept once it has the forward-secure keys, and counts the session
+// as active until its end.
+func (this *listener) waitForHandshake(s *session) {
+	err := s.waitForEncryptionLevel(context.Background(), protocol.ENCRYPTION_FORWARD_SECURE)
+	if err == nil {
+		this.metrics.handshakes.Add(1)
+		this.metrics.handshakeRate.add(this.config.Clock.Now())
+	} else {
+		this.metrics.onHandshakeFailed(errorCode(err))
+	}
+	this.mutex.Lock()
+	delete(this.pending, s.connID)
+	if err == nil && this.closeErr == nil {
+		this.acceptQueue = append(this.acceptQueue, s)
+		this.cond.Broadcast()
+	}
+	this.mutex.Unlock()
+	<-s.runDone
+	this.metrics.activeConnections.Add(-1)
+}
+
+// sendPublicReset answers a packet of an unknown connection, of a previous process of the server or of a closed session, with
+// a public reset whose nonce proof is derived from the PublicResetSecret. Like the packets of the sessions to an unvalidated
+// address, the public reset is at most AMPLIFICATION_FACTOR times larger than the packet.
+func (this *listener) sendPublicReset(b []byte, addr net.Addr, header *protocol.QuicPacketHeader, now time.Time) {
+	if header.IsConnectionIDOmitted() {
+		return
+	}
+	connID := header.GetConnectionID()
+	reset := protocol.BuildPublicReset(connID, header.GetSequenceNumber(), publicResetNonceProof(this.config.PublicResetSecret, connID))
+	if len(reset) > AMPLIFICATION_FACTOR*len(b) || !this.publicResets.Allow(addr, now) {
+		return
+	}
+	this.mux.pc.WriteTo(reset, addr)
+	this.metrics.publicResetsSent.Add(1)
+}
+
+// publicResetNonceProof returns the nonce proof of the public resets of the connection: the first 8 bytes of its HMAC-SHA256
+// with the secret, never zero.
+func publicResetNonceProof(secret []byte, connID protocol.QuicConnectionID) uint64 {
+	var id [8]byte
+
+	binary.LittleEndian.PutUint64(id[:], uint64(connID))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(id[:])
+	if proof := binary.LittleEndian.Uint64(mac.Sum(nil)); proof != 0 {
+		return proof
+	}
+	return 1
+}
+
+// rateLimiter limits the packets sent without state to the source addresses: one per interval and per source address,
+// and at most perSecond per second in total if it is positive. It is used by the read goroutine.
+type rateLimiter struct {
+	interval  time.Duration
+	perSecond int
+	sources   map[string]time.Time
+	second    time.Time
+	count     int
+}
+
+func newRateLimiter(interval time.Duration, perSecond int) *rateLimiter {
+	return &rateLimiter{interval: interval, perSecond: perSecond, sources: make(map[string]time.Time)}
+}
+
+// Allow returns true if a packet can be sent to the source address now. The expired sources are forgotten when the rate limiter
+// is full, the packets are dropped if it stays full.
+func (this *rateLimiter) Allow(addr net.Addr, now time.Time) bool {
+	source := addr.String()
+	if last, ok := this.sources[source]; ok && now.Sub(last) < this.interval {
+		return false
+	}
+	if this.perSecond > 0 {
+		if now.Sub(this.second) >= time.Second {
+			this.second, this.count = now, 0
+		}
+		if this.count >= this.perSecond {
+			return false
+		}
+	}
+	if len(this.sources) >= MAX_RATE_LIMITER_SOURCES {
+		for s, last := range this.sources {
+			if now.Sub(last) >= this.interval {
+				delete(this.sources, s)
+			}
+		}
+		if len(this.sources) >= MAX_RATE_LIMITER_SOURCES {
+			return false
+		}
+	}
+	this.sources[source] = now
+	this.count++
+	return true
+}
+
+// isValidCHLO returns true if the unencrypted packet starts the crypto stream with a CHLO message that has a version.
+func isValidCHLO(b []byte) bool {
+	packet, err := protocol.NewPacketUnpacker(crypto.NewAEAD_NullFNV1A128()).Unpack(b)
+	if err != nil {
+		return false
+	}
+	defer packet.Release()
+	for _, f := range packet.Frames {
+		if sf, ok := f.(*protocol.StreamFrame); ok && sf.StreamID.IsCryptoStream() && sf.Offset == 0 {
+			msg, err := protocol.ReadHandshakeMessage(bytes.NewReader(sf.Data))
+			if err != nil || msg.GetMessageTag() != protocol.TagCHLO {
+				return false
+			}
+			_, ok = msg.GetTag(protocol.TagVERS)
+			return ok
+		}
+	}
+	return false
+}
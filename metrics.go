@@ -0,0 +1,120 @@
+package quic
+
+import "github.com/romain-jacotin/quic/protocol"
+import "sort"
+import "sync"
+import "sync/atomic"
+import "time"
+
+// MetricKind is the kind of a Metric.
+type MetricKind int
+
+const (
+	// METRIC_COUNTER is a value that only increases, like a number of packets
+	METRIC_COUNTER MetricKind = iota
+	// METRIC_GAUGE is a value that goes up and down, like a number of connections
+	METRIC_GAUGE
+)
+
+// Metric is the current value of a counter or a gauge. The counters with a label, like the handshake failures by reason,
+// give one Metric per label value.
+type Metric struct {
+	Name       string
+	Help       string
+	Kind       MetricKind
+	LabelName  string
+	LabelValue string
+	Value      float64
+}
+
+// Metrics are the counters and gauges of a Listener, read with atomic loads: the adapters package publishes them
+// with expvar and in the Prometheus text format, without dependency of the quic package.
+type Metrics interface {
+	// Each calls f with the current value of each metric, always in the same order
+	Each(f func(m Metric))
+}
+
+// listenerMetrics implements Metrics, the counters are updated by the listener and its sessions.
+type listenerMetrics struct {
+	clock                   protocol.Clock
+	activeConnections       atomic.Int64
+	handshakes              atomic.Uint64
+	handshakeRate           rateCounter
+	handshakeFailures       sync.Map // protocol.QuicErrorCode -> *atomic.Uint64
+	versionNegotiationsSent atomic.Uint64
+	publicResetsSent        atomic.Uint64
+	chlosDropped            atomic.Uint64
+	bytesReceived           atomic.Uint64
+	bytesSent               atomic.Uint64
+}
+
+var _ Metrics = (*listenerMetrics)(nil)
+
+// onHandshakeFailed counts a handshake failed with the error code.
+func (this *listenerMetrics) onHandshakeFailed(code protocol.QuicErrorCode) {
+	counter, ok := this.handshakeFailures.Load(code)
+	if !ok {
+		counter, _ = this.handshakeFailures.LoadOrStore(code, new(atomic.Uint64))
+	}
+	counter.(*atomic.Uint64).Add(1)
+}
+
+// Each calls f with the current value of each metric, the handshake failures by increasing error code.
+func (this *listenerMetrics) Each(f func(m Metric)) {
+	f(Metric{Name: "quic_listener_active_connections", Help: "Sessions of the Listener not closed yet, in handshake or accepted.",
+		Kind: METRIC_GAUGE, Value: float64(this.activeConnections.Load())})
+	f(Metric{Name: "quic_listener_handshakes_total", Help: "Handshakes completed.",
+		Kind: METRIC_COUNTER, Value: float64(this.handshakes.Load())})
+	f(Metric{Name: "quic_listener_handshakes_per_second", Help: "Handshakes completed during the last second.",
+		Kind: METRIC_GAUGE, Value: float64(this.handshakeRate.rate(this.clock.Now()))})
+	var codes []protocol.QuicErrorCode
+	this.handshakeFailures.Range(func(key, value interface{}) bool {
+		codes = append(codes, key.(protocol.QuicErrorCode))
+		return true
+	})
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	for _, code := range codes {
+		counter, _ := this.handshakeFailures.Load(code)
+		f(Metric{Name: "quic_listener_handshake_failures_total", Help: "Handshakes failed, by error code.", Kind: METRIC_COUNTER,
+			LabelName: "reason", LabelValue: code.String(), Value: float64(counter.(*atomic.Uint64).Load())})
+	}
+	f(Metric{Name: "quic_listener_version_negotiation_packets_sent_total", Help: "Version negotiation packets sent.",
+		Kind: METRIC_COUNTER, Value: float64(this.versionNegotiationsSent.Load())})
+	f(Metric{Name: "quic_listener_public_resets_sent_total", Help: "Public reset packets sent.",
+		Kind: METRIC_COUNTER, Value: float64(this.publicResetsSent.Load())})
+	f(Metric{Name: "quic_listener_chlos_dropped_total", Help: "CHLOs of new connections dropped while MaxPendingSessions sessions are in handshake.",
+		Kind: METRIC_COUNTER, Value: float64(this.chlosDropped.Load())})
+	f(Metric{Name: "quic_listener_bytes_received_total", Help: "Bytes of the packets received by the sessions.",
+		Kind: METRIC_COUNTER, Value: float64(this.bytesReceived.Load())})
+	f(Metric{Name: "quic_listener_bytes_sent_total", Help: "Bytes of the packets sent by the sessions.",
+		Kind: METRIC_COUNTER, Value: float64(this.bytesSent.Load())})
+}
+
+// rateCounter counts the events of the current second and of the previous one, without lock: an event counted while
+// the second changes can be lost.
+type rateCounter struct {
+	buckets [2]struct {
+		second atomic.Int64
+		count  atomic.Uint64
+	}
+}
+
+// add counts an event at the time.
+func (this *rateCounter) add(now time.Time) {
+	second := now.Unix()
+	b := &this.buckets[second&1]
+	if old := b.second.Load(); old != second && b.second.CompareAndSwap(old, second) {
+		b.count.Store(0)
+	}
+	b.count.Add(1)
+}
+
+// rate returns the number of events of the last complete second before the time.
+func (this *rateCounter) rate(now time.Time) uint64 {
+	second := now.Unix() - 1
+	b := &this.buckets[second&1]
+	if b.second.Load() != second {
+		return 0
+	}
+	return b.count.Load()
+}
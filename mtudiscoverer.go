@@ -0,0 +1,97 @@
+package quic
+
+import "github.com/romain-jacotin/quic/protocol"
+import "time"
+
+const (
+	// MTU_DISCOVERY_MIN_SIZE and MTU_DISCOVERY_MAX_SIZE bound the packet sizes searched by the path MTU discovery
+	MTU_DISCOVERY_MIN_SIZE = 1280
+	MTU_DISCOVERY_MAX_SIZE = 1500
+	// MTU_DISCOVERY_INTERVAL is the delay before the search starts again up to MTU_DISCOVERY_MAX_SIZE, once it has converged
+	MTU_DISCOVERY_INTERVAL = 10 * time.Minute
+)
+
+// mtuDiscoverer searches the largest packet size of the path with padded PING packets: a binary search between the validated
+// packet size and the smallest size lost, one probe in flight at a time. An acknowledged probe validates its size.
+//
+// It is owned by the run goroutine, the times are given by the caller.
+type mtuDiscoverer struct {
+	enabled bool
+	// current is the validated packet size, the sizes above max are lost
+	current     int
+	max         int
+	probing     bool
+	probeSize   int
+	probeSeqnum protocol.QuicPacketSequenceNumber
+	doneTime    time.Time
+}
+
+// newMTUDiscoverer returns an mtuDiscoverer of the initial packet size, that never sends a probe if it is not enabled.
+func newMTUDiscoverer(size int, enabled bool) *mtuDiscoverer {
+	if size < MTU_DISCOVERY_MIN_SIZE {
+		size = MTU_DISCOVERY_MIN_SIZE
+	}
+	return &mtuDiscoverer{enabled: enabled, current: size, max: MTU_DISCOVERY_MAX_SIZE}
+}
+
+// GetPacketSize returns the largest packet size validated on the path.
+func (this *mtuDiscoverer) GetPacketSize() int {
+	return this.current
+}
+
+// ShouldSendProbe returns true if no probe is in flight and the search has not converged,
+// or has converged MTU_DISCOVERY_INTERVAL ago below MTU_DISCOVERY_MAX_SIZE.
+func (this *mtuDiscoverer) ShouldSendProbe(now time.Time) bool {
+	if !this.enabled || this.probing || this.current >= MTU_DISCOVERY_MAX_SIZE {
+		return false
+	}
+	if this.current >= this.max {
+		if now.Before(this.doneTime.Add(MTU_DISCOVERY_INTERVAL)) {
+			return false
+		}
+		this.max = MTU_DISCOVERY_MAX_SIZE
+	}
+	return true
+}
+
+// GetProbeSize returns the size of the next probe, halfway between the validated size and the smallest size lost.
+func (this *mtuDiscoverer) GetProbeSize() int {
+	return (this.current + this.max + 1) / 2
+}
+
+// OnProbeSent records the probe in flight.
+func (this *mtuDiscoverer) OnProbeSent(seqnum protocol.QuicPacketSequenceNumber, size int) {
+	this.probing = true
+	this.probeSeqnum = seqnum
+	this.probeSize = size
+}
+
+// GetProbe returns the sequence number of the probe in flight, if any.
+func (this *mtuDiscoverer) GetProbe() (protocol.QuicPacketSequenceNumber, bool) {
+	return this.probeSeqnum, this.probing
+}
+
+// OnProbeAcked validates the size of the probe.
+func (this *mtuDiscoverer) OnProbeAcked(now time.Time) {
+	this.probing = false
+	if this.probeSize > this.current {
+		this.current = this.probeSize
+	}
+	this.checkDone(now)
+}
+
+// OnProbeLost searches below the size of the probe.
+func (this *mtuDiscoverer) OnProbeLost(now time.Time) {
+	this.probing = false
+	if this.probeSize-1 < this.max {
+		this.max = this.probeSize - 1
+	}
+	this.checkDone(now)
+}
+
+// checkDone records the time the search converges.
+func (this *mtuDiscoverer) checkDone(now time.Time) {
+	if this.current >= this.max {
+		this.doneTime = now
+	}
+}
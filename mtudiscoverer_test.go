@@ -0,0 +1,54 @@
+package quic
+
+import "github.com/romain-jacotin/quic/protocol"
+import "testing"
+import "time"
+
+func Test_MTUDiscoverer(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	// Binary search on a path of 1400 bytes
+	d := newMTUDiscoverer(MAX_PACKET_SIZE, true)
+	var probes []int
+	for seqnum := protocol.QuicPacketSequenceNumber(1); d.ShouldSendProbe(now); seqnum++ {
+		size := d.GetProbeSize()
+		probes = append(probes, size)
+		d.OnProbeSent(seqnum, size)
+		if d.ShouldSendProbe(now) {
+			t.Fatalf("mtuDiscoverer.ShouldSendProbe : a single probe in flight expected")
+		}
+		if size <= 1400 {
+			d.OnProbeAcked(now)
+		} else {
+			d.OnProbeLost(now)
+		}
+		if len(probes) > 10 {
+			t.Fatalf("mtuDiscoverer : the search doesn't converge %v", probes)
+		}
+	}
+	if d.GetPacketSize() != 1400 || probes[0] != 1425 {
+		t.Errorf("mtuDiscoverer : 1400 bytes expected instead of %v with the probes %v", d.GetPacketSize(), probes)
+	}
+
+	// The search starts again up to the largest size after MTU_DISCOVERY_INTERVAL
+	if d.ShouldSendProbe(now.Add(MTU_DISCOVERY_INTERVAL-time.Second)) || !d.ShouldSendProbe(now.Add(MTU_DISCOVERY_INTERVAL)) ||
+		d.GetProbeSize() != 1450 {
+		t.Errorf("mtuDiscoverer.ShouldSendProbe : probe of 1450 bytes expected after MTU_DISCOVERY_INTERVAL instead of %v", d.GetProbeSize())
+	}
+
+	var tests_disabled = []struct {
+		size    int
+		enabled bool
+	}{
+		{MAX_PACKET_SIZE, false},
+		{MTU_DISCOVERY_MAX_SIZE, true},
+	}
+	for i, v := range tests_disabled {
+		if d = newMTUDiscoverer(v.size, v.enabled); d.ShouldSendProbe(now) || d.GetPacketSize() != v.size {
+			t.Errorf("mtuDiscoverer.ShouldSendProbe : no probe expected in test n°%v", i)
+		}
+	}
+	if d = newMTUDiscoverer(1000, true); d.GetPacketSize() != MTU_DISCOVERY_MIN_SIZE {
+		t.Errorf("newMTUDiscoverer : %v bytes expected instead of %v", MTU_DISCOVERY_MIN_SIZE, d.GetPacketSize())
+	}
+}
@@ -0,0 +1,328 @@
+package quic
+
+import "github.com/romain-jacotin/quic/internal/bufferpool"
+import "github.com/romain-jacotin/quic/internal/packetconn"
+import "github.com/romain-jacotin/quic/protocol"
+import "encoding/binary"
+import "errors"
+import "net"
+import "sync"
+import "time"
+
+// MAX_RECEIVE_PACKET_SIZE is the size of the buffer of a received datagram, up to the largest probe of the path MTU discovery.
+const MAX_RECEIVE_PACKET_SIZE = MTU_DISCOVERY_MAX_SIZE
+
+// packetMux demultiplexes the datagrams received on a PacketConn to the sessions by Connection ID,
+// the datagrams of the unknown Connection IDs go to the listener. The datagrams without Connection ID of the truncated
+// connections are demultiplexed by the address of the peer: they are dropped on a PacketConn without truncated connection.
+//
+// A PacketConn has a single packetMux shared by Listen and the Dials, with one read goroutine that reads the datagrams in batches.
+// The sessions and the listener hold a reference: a PacketConn created by Dial is closed with its last reference,
+// a PacketConn of the user is read until it is closed.
+type packetMux struct {
+	pc       net.PacketConn
+	conn     packetconn.Conn
+	ownsConn bool
+	clock    protocol.Clock
+
+	mutex    sync.Mutex
+	sessions map[protocol.QuicConnectionID]*session
+	// truncated are the Connection IDs of the truncated connections by address of the peer
+	truncated map[string]protocol.QuicConnectionID
+	listener  *listener
+	refs      int
+	closeErr  error
+}
+
+// packetMuxes are the packetMuxes of the PacketConns in use.
+var packetMuxes = struct {
+	sync.Mutex
+	muxes map[net.PacketConn]*packetMux
+}{muxes: make(map[net.PacketConn]*packetMux)}
+
+// getPacketMux returns the packetMux of the PacketConn with a new reference, it is created with its read goroutine on first use:
+// the clock gives the time of the received datagrams.
+func getPacketMux(pc net.PacketConn, ownsConn bool, clock protocol.Clock) *packetMux {
+	packetMuxes.Lock()
+	defer packetMuxes.Unlock()
+	mux, ok := packetMuxes.muxes[pc]
+	if !ok {
+		mux = &packetMux{pc: pc, conn: packetconn.New(pc), ownsConn: ownsConn, clock: clock, sessions: make(map[protocol.QuicConnectionID]*session),
+			truncated: make(map[string]protocol.QuicConnectionID)}
+		packetMuxes.muxes[pc] = mux
+		go mux.run()
+	}
+	mux.mutex.Lock()
+	mux.refs++
+	mux.mutex.Unlock()
+	return mux
+}
+
+// release drops a reference, the PacketConn created by Dial is closed with the last one.
+func (this *packetMux) release() {
+	this.mutex.Lock()
+	this.refs--
+	closing := this.refs == 0 && this.ownsConn
+	this.mutex.Unlock()
+	if closing {
+		this.pc.Close()
+	}
+}
+
+// addSession routes the datagrams of the Connection ID to the session, the session holds a reference until removeSession.
+func (this *packetMux) addSession(connID protocol.QuicConnectionID, s *session) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.closeErr != nil {
+		return this.closeErr
+	}
+	if _, ok := this.sessions[connID]; ok {
+		return errors.New("packetMux.addSession : Connection ID already in use on the PacketConn")
+	}
+	this.sessions[connID] = s
+	this.refs++
+	return nil
+}
+
+// removeSession stops routing the datagrams of the Connection ID, and releases the reference of the session.
+func (this *packetMux) removeSession(connID protocol.QuicConnectionID) {
+	this.mutex.Lock()
+	delete(this.sessions, connID)
+	this.mutex.Unlock()
+	this.release()
+}
+
+// addTruncatedConn routes the datagrams without Connection ID from the address of the peer to the connection, until its Close.
+// The peer can't send them from another address: an address has a single truncated connection.
+func (this *packetMux) addTruncatedConn(conn *muxConn) error {
+	addr := conn.RemoteAddr().String()
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if _, ok := this.truncated[addr]; ok {
+		return errors.New("packetMux.addTruncatedConn : address of the peer already in use by a truncated connection")
+	}
+	this.truncated[addr] = conn.connID
+	conn.truncatedAddr = addr
+	return nil
+}
+
+// removeTruncatedConn stops routing the datagrams without Connection ID to the connection.
+func (this *packetMux) removeTruncatedConn(conn *muxConn) {
+	if conn.truncatedAddr == "" {
+		return
+	}
+	this.mutex.Lock()
+	if this.truncated[conn.truncatedAddr] == conn.connID {
+		delete(this.truncated, conn.truncatedAddr)
+	}
+	this.mutex.Unlock()
+	conn.truncatedAddr = ""
+}
+
+// setListener routes the datagrams of the unknown Connection IDs to the listener, its reference of getPacketMux is released by removeListener.
+func (this *packetMux) setListener(l *listener) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.closeErr != nil {
+		return this.closeErr
+	}
+	if this.listener != nil {
+		return errors.New("packetMux.setListener : the PacketConn already has a Listener")
+	}
+	this.listener = l
+	return nil
+}
+
+// removeListener drops the datagrams of the unknown Connection IDs, and releases the reference of the listener.
+func (this *packetMux) removeListener() {
+	this.mutex.Lock()
+	this.listener = nil
+	this.mutex.Unlock()
+	this.release()
+}
+
+// run reads the datagrams until the PacketConn fails, then closes the sessions and the listener with the error.
+func (this *packetMux) run() {
+	ms := make([]packetconn.Message, packetconn.BATCH_SIZE)
+	for {
+		for i := range ms {
+			if ms[i].Buffer == nil {
+				ms[i].Buffer = bufferpool.Get(MAX_RECEIVE_PACKET_SIZE)
+			}
+		}
+		n, err := this.conn.ReadBatch(ms)
+		if err != nil {
+			for i := range ms {
+				bufferpool.Put(ms[i].Buffer)
+			}
+			this.closeWithError(err)
+			return
+		}
+		rcvTime := this.clock.Now()
+		for i := 0; i < n; i++ {
+			this.handleDatagram(ms[i].Buffer[:ms[i].N], ms[i].Addr, ms[i].ECN, rcvTime)
+			ms[i].Buffer = nil
+		}
+	}
+}
+
+// handleDatagram delivers a datagram to the session of its Connection ID, or to the listener: they own the buffer of the datagram.
+// A datagram without Connection ID goes to the truncated connection of its address, never to the listener.
+func (this *packetMux) handleDatagram(b []byte, addr net.Addr, ecn packetconn.ECN, rcvTime time.Time) {
+	var connID protocol.QuicConnectionID
+	var s *session
+	var l *listener
+
+	switch {
+	case len(b) == 0:
+	case b[0]&(protocol.QUICMASK_RESERVED|protocol.QUICMASK_CONNID_SIZE) == protocol.QUICFLAG_CONNID_64bit && len(b) >= 9:
+		// Our Connection IDs are always sent on 64 bits
+		connID = protocol.QuicConnectionID(binary.LittleEndian.Uint64(b[1:]))
+		this.mutex.Lock()
+		s = this.sessions[connID]
+		l = this.listener
+		this.mutex.Unlock()
+	case b[0]&(protocol.QUICMASK_RESERVED|protocol.QUICMASK_CONNID_SIZE) == protocol.QUICFLAG_CONNID_0bit:
+		this.mutex.Lock()
+		if len(this.truncated) > 0 {
+			if id, ok := this.truncated[addr.String()]; ok {
+				s = this.sessions[id]
+			}
+		}
+		this.mutex.Unlock()
+	}
+	switch {
+	case s != nil:
+		s.handleDatagram(b, addr, ecn, rcvTime)
+	case l != nil:
+		l.handleDatagram(b, addr, ecn, connID, rcvTime)
+	default:
+		bufferpool.Put(b)
+	}
+}
+
+// closeWithError forgets the PacketConn, and closes the sessions and the listener with the error.
+func (this *packetMux) closeWithError(err error) {
+	packetMuxes.Lock()
+	if packetMuxes.muxes[this.pc] == this {
+		delete(packetMuxes.muxes, this.pc)
+	}
+	packetMuxes.Unlock()
+
+	this.mutex.Lock()
+	this.closeErr = err
+	sessions := make([]*session, 0, len(this.sessions))
+	for _, s := range this.sessions {
+		sessions = append(sessions, s)
+	}
+	l := this.listener
+	this.mutex.Unlock()
+	for _, s := range sessions {
+		s.close(err)
+	}
+	if l != nil {
+		l.closeWithError(err)
+	}
+}
+
+// muxConn is the connection of a session to its peer through the packetMux, the datagrams are sent with the ECN codepoint.
+type muxConn struct {
+	mux       *packetMux
+	connID    protocol.QuicConnectionID
+	ecn       packetconn.ECN
+	closeOnce sync.Once
+	// truncatedAddr is the address of the peer of a truncated connection, set by packetMux.addTruncatedConn
+	truncatedAddr string
+
+	mutex  sync.Mutex
+	remote net.Addr
+}
+
+func (this *muxConn) Write(b []byte) error {
+	return this.WriteTo(b, this.RemoteAddr())
+}
+
+func (this *muxConn) WriteTo(b []byte, addr net.Addr) error {
+	ms := [1]packetconn.Message{{Buffer: b, Addr: addr, ECN: this.ecn}}
+	_, err := this.mux.conn.WriteBatch(ms[:])
+	return err
+}
+
+// WriteBatch writes the datagrams to the peer with a single system call per packetconn.BATCH_SIZE datagrams.
+// When the kernel supports GSO, the consecutive datagrams of the same size are coalesced in a buffer segmented by the kernel.
+func (this *muxConn) WriteBatch(bs [][]byte) error {
+	addr := this.RemoteAddr()
+	if !this.mux.conn.SupportsGSO() {
+		ms := make([]packetconn.Message, len(bs))
+		for i, b := range bs {
+			ms[i] = packetconn.Message{Buffer: b, Addr: addr, ECN: this.ecn}
+		}
+		_, err := this.mux.conn.WriteBatch(ms)
+		return err
+	}
+	for len(bs) > 0 {
+		// A shorter datagram ends the run of segments
+		n := 1
+		for n < len(bs) && len(bs[n-1]) == len(bs[0]) && len(bs[n]) <= len(bs[0]) {
+			n++
+		}
+		if err := this.writeGSO(bs[:n], addr); err != nil {
+			return err
+		}
+		bs = bs[n:]
+	}
+	return nil
+}
+
+// gsoBuffers are the buffers of the datagrams coalesced by WriteBatch.
+var gsoBuffers = sync.Pool{New: func() interface{} {
+	b := make([]byte, 0, packetconn.BATCH_SIZE*MAX_RECEIVE_PACKET_SIZE)
+	return &b
+}}
+
+// writeGSO writes the datagrams as the segments of a single buffer, all but the last one have the same size.
+func (this *muxConn) writeGSO(bs [][]byte, addr net.Addr) error {
+	if len(bs) == 1 {
+		return this.WriteTo(bs[0], addr)
+	}
+	b := gsoBuffers.Get().(*[]byte)
+	defer gsoBuffers.Put(b)
+	*b = (*b)[:0]
+	for _, data := range bs {
+		*b = append(*b, data...)
+	}
+	return this.mux.conn.WriteGSO(packetconn.Message{Buffer: *b, Addr: addr, ECN: this.ecn}, len(bs[0]))
+}
+
+func (this *muxConn) LocalAddr() net.Addr {
+	return this.mux.pc.LocalAddr()
+}
+
+func (this *muxConn) RemoteAddr() net.Addr {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.remote
+}
+
+func (this *muxConn) SetRemoteAddr(addr net.Addr) {
+	this.mutex.Lock()
+	this.remote = addr
+	this.mutex.Unlock()
+}
+
+// ecnCodepoint returns the ECN codepoint of the packets of the config.
+func ecnCodepoint(config *Config) packetconn.ECN {
+	if config.DisableECN {
+		return packetconn.ECN_NOT_ECT
+	}
+	return packetconn.ECN_ECT0
+}
+
+// Close removes the session from the packetMux.
+func (this *muxConn) Close() error {
+	this.closeOnce.Do(func() {
+		this.mux.removeTruncatedConn(this)
+		this.mux.removeSession(this.connID)
+	})
+	return nil
+}
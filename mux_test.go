@@ -0,0 +1,120 @@
+package quic
+
+import "github.com/romain-jacotin/quic/crypto"
+import "github.com/romain-jacotin/quic/internal/bufferpool"
+import "github.com/romain-jacotin/quic/protocol"
+import "bytes"
+import "io"
+import "net"
+import "sync"
+import "testing"
+import "time"
+
+// Benchmark_ReceivePath reads a datagram of a STREAM frame in a pooled buffer, opens it with AES-GCM and parses its frames,
+// like the read goroutine and the session.
+func Benchmark_ReceivePath(b *testing.B) {
+	key := make([]byte, 16)
+	iv := make([]byte, 4)
+	sealer, err := crypto.NewAEAD_AES128GCM12(key, iv)
+	if err != nil {
+		b.Fatal(err)
+	}
+	opener, _ := crypto.NewAEAD_AES128GCM12(key, iv)
+	packer := protocol.NewPacketPacker(0x42, 8, MAX_PACKET_SIZE)
+	packer.SetEncryptionLevels(protocol.ENCRYPTION_FORWARD_SECURE, protocol.ENCRYPTION_UNENCRYPTED)
+	packer.QueueStreamFrame(&protocol.StreamFrame{StreamID: 5, Data: make([]byte, 1200)})
+	p, err := packer.PackPacket(sealer)
+	if err != nil {
+		b.Fatal(err)
+	}
+	unpacker := protocol.NewPacketUnpacker(crypto.NewAEAD_NullFNV1A128())
+	unpacker.SetOpener(protocol.ENCRYPTION_FORWARD_SECURE, opener)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(p.Data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf := bufferpool.Get(MAX_RECEIVE_PACKET_SIZE)
+		n := copy(buf, p.Data)
+		packet, err := unpacker.Unpack(buf[:n])
+		bufferpool.Put(buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+		packet.Release()
+	}
+}
+
+func Test_PacketMux_BufferOwnership(t *testing.T) {
+	pc := listenUDP(t)
+	defer pc.Close()
+	l, err := Listen(pc, testServerConfig(t, nil))
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+	go echoServer(l)
+	s, err := Dial(l.Addr().String(), testClientConfig(t, nil))
+	if err != nil {
+		t.Fatalf("Dial : unexpected error %v", err)
+	}
+	defer s.Close(nil)
+
+	// The buffers go from the read goroutines to the sessions and back to the pool: a buffer reused too early corrupts the data
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			st, err := s.OpenStream()
+			if err != nil {
+				t.Errorf("Session.OpenStream : unexpected error %v in test n°%v", err, i)
+				return
+			}
+			data := bytes.Repeat([]byte{byte(i)}, 64*1024)
+			go func() {
+				st.Write(data)
+				st.Close()
+			}()
+			// The deadline is renewed at each chunk echoed: a transfer slowed down by a loaded CPU fails only if it stalls
+			echo := make([]byte, len(data))
+			for n := 0; n < len(echo); n += 4096 {
+				st.SetReadDeadline(time.Now().Add(10 * time.Second))
+				if _, err := io.ReadFull(st, echo[n:n+4096]); err != nil {
+					t.Errorf("Stream.Read : %v bytes echoed instead of %v (%v) in test n°%v", n, len(data), err, i)
+					return
+				}
+			}
+			st.SetReadDeadline(time.Now().Add(10 * time.Second))
+			if n, err := st.Read(make([]byte, 1)); n != 0 || err != io.EOF || !bytes.Equal(echo, data) {
+				t.Errorf("Stream.Read : invalid echo (%v) in test n°%v", err, i)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func Test_PacketMux_TruncatedConn(t *testing.T) {
+	pc := listenUDP(t)
+	defer pc.Close()
+	mux := getPacketMux(pc, false, protocol.RealClock)
+	defer mux.release()
+
+	// An address of peer has a single truncated connection, the next one keeps the Connection ID until the first one is closed
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4433}
+	conns := []*muxConn{{mux: mux, remote: peer, connID: 1}, {mux: mux, remote: peer, connID: 2}}
+	if err := mux.addTruncatedConn(conns[0]); err != nil {
+		t.Fatalf("packetMux.addTruncatedConn : unexpected error %v", err)
+	}
+	if err := mux.addTruncatedConn(conns[1]); err == nil || conns[1].truncatedAddr != "" {
+		t.Errorf("packetMux.addTruncatedConn : error expected for the second truncated connection of the address")
+	}
+	mux.removeTruncatedConn(conns[1])
+	if mux.truncated[peer.String()] != 1 {
+		t.Errorf("packetMux.removeTruncatedConn : the truncated connection of the address must stay")
+	}
+	mux.removeTruncatedConn(conns[0])
+	if err := mux.addTruncatedConn(conns[1]); err != nil || mux.truncated[peer.String()] != 2 {
+		t.Errorf("packetMux.addTruncatedConn : unexpected error %v once the first connection is closed", err)
+	}
+}
@@ -0,0 +1,50 @@
+package protocol
+
+import "time"
+
+// Clock gives the time to the timers of a connection: the loss recovery, the idle timeout and the pacing.
+// The tests replace the real clock with a simulated one.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a Timer that sends the time on its channel once the duration elapses.
+	NewTimer(d time.Duration) Timer
+	// AfterFunc returns a Timer that calls f in another goroutine once the duration elapses, its channel is nil.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is the timer of a Clock, it has the semantics of time.Timer.
+type Timer interface {
+	// Chan returns the channel that receives the time when the timer fires.
+	Chan() <-chan time.Time
+	// Stop prevents the timer from firing, it returns false if the timer has already fired or been stopped.
+	Stop() bool
+	// Reset changes the timer to fire after the duration, it returns true if the timer was active.
+	Reset(d time.Duration) bool
+}
+
+// RealClock is the Clock of the time package.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+// realTimer is a time.Timer.
+type realTimer struct {
+	*time.Timer
+}
+
+func (this realTimer) Chan() <-chan time.Time {
+	return this.C
+}
@@ -0,0 +1,23 @@
+package protocol
+
+import "context"
+
+// ContextError is returned by the blocking calls interrupted by their context: Op is the call, Err is the error of the context.
+type ContextError struct {
+	Op  string
+	Err error
+}
+
+func (this ContextError) Error() string {
+	return this.Op + " : " + this.Err.Error()
+}
+
+// Unwrap returns the error of the context, for errors.Is(err, context.Canceled).
+func (this ContextError) Unwrap() error {
+	return this.Err
+}
+
+// Timeout returns true if the deadline of the context is exceeded, like the net.Error of the deadlines.
+func (this ContextError) Timeout() bool {
+	return this.Err == context.DeadlineExceeded
+}
@@ -0,0 +1,174 @@
+package protocol
+
+import "encoding/binary"
+import "fmt"
+import "strings"
+
+// DEBUG_DATA_SIZE is the number of bytes of the STREAM frame data shown by DecodePacketForDebug.
+const DEBUG_DATA_SIZE = 16
+
+// DebugOpener is an opener of DebugKeys with the label shown in the dump, like "client forward-secure".
+type DebugOpener struct {
+	Label  string
+	Opener PacketOpener
+}
+
+// DebugKeys are the openers tried by DecodePacketForDebug to decrypt the packets of a connection, in order.
+//
+// The direction of a packet is unknown: the openers of the client and of the server are tried on all packets.
+type DebugKeys struct {
+	Openers []DebugOpener
+	// LargestReceived is the largest sequence number decrypted, to infer the full sequence number of the next packets
+	LargestReceived QuicPacketSequenceNumber
+}
+
+// DecodePacketForDebug returns a human-readable dump of the datagram: the public header, and the frames of the payload
+// if an opener of the keys decrypts it. It updates the LargestReceived of the keys.
+//
+// A packet with the version flag is shown as a version negotiation packet if it only contains QUIC version tags after the
+// connection ID. The dump of the public header is returned with the error if the payload can't be decrypted or parsed.
+func DecodePacketForDebug(b []byte, keys *DebugKeys) (string, error) {
+	var s strings.Builder
+
+	fmt.Fprintf(&s, "packet of %v bytes\n", len(b))
+	if isVersionNegotiationForDebug(b) {
+		connID, versions, err := ParseVersionNegotiationPacket(b)
+		if err != nil {
+			return s.String(), err
+		}
+		fmt.Fprintf(&s, "  version negotiation, connection ID %v\n", connID)
+		for _, v := range versions {
+			fmt.Fprintf(&s, "    %v\n", v)
+		}
+		return s.String(), nil
+	}
+	header, size, err := ParsePublicHeader(b)
+	if err != nil {
+		return s.String(), err
+	}
+	if header.GetPublicResetFlag() {
+		reset, err := ParsePublicReset(b)
+		if err != nil {
+			return s.String(), err
+		}
+		fmt.Fprintf(&s, "  public reset, connection ID %v\n", reset.ConnectionID)
+		fmt.Fprintf(&s, "    rejected sequence number %v\n", reset.RejectedSequenceNumber)
+		fmt.Fprintf(&s, "    nonce proof %016x\n", reset.NonceProof)
+		return s.String(), nil
+	}
+
+	fmt.Fprintf(&s, "  public flags 0x%02x\n", b[0])
+	if header.IsConnectionIDOmitted() {
+		s.WriteString("  connection ID omitted\n")
+	} else {
+		fmt.Fprintf(&s, "  connection ID %v (%v bytes)\n", header.GetConnectionID().Truncate(header.GetConnectionIdSize()), header.GetConnectionIdSize())
+	}
+	if header.GetVersionFlag() {
+		fmt.Fprintf(&s, "  version %v\n", header.GetVersion())
+	}
+	if nonce := header.GetDiversificationNonce(); nonce != nil {
+		fmt.Fprintf(&s, "  diversification nonce %x\n", nonce)
+	}
+	fmt.Fprintf(&s, "  sequence number %v (%v bytes)\n", header.GetSequenceNumber(), header.GetSequenceNumberSize())
+	if keys == nil || len(keys.Openers) == 0 {
+		fmt.Fprintf(&s, "  payload of %v bytes, encrypted\n", len(b)-size)
+		return s.String(), nil
+	}
+
+	seqnum := InferSequenceNumber(uint64(header.GetSequenceNumber()), header.GetSequenceNumberSize(), keys.LargestReceived)
+	plaintext := make([]byte, len(b)-size)
+	for _, o := range keys.Openers {
+		n, err := openForDebug(o.Opener, header, seqnum, plaintext, b[:size], b[size:])
+		if err != nil {
+			continue
+		}
+		if seqnum > keys.LargestReceived {
+			keys.LargestReceived = seqnum
+		}
+		fmt.Fprintf(&s, "  payload of %v bytes, opened with the %v keys as sequence number %v\n", len(b)-size, o.Label, seqnum)
+		header.SetSequenceNumber(seqnum)
+		for p := plaintext[:n]; len(p) > 0; {
+			frame, m, err := ParseNextFrame(p, header)
+			if err != nil {
+				fmt.Fprintf(&s, "    invalid frame 0x%02x\n", p[0])
+				return s.String(), err
+			}
+			s.WriteString("    ")
+			s.WriteString(frameForDebug(frame, seqnum))
+			s.WriteString("\n")
+			p = p[m:]
+		}
+		return s.String(), nil
+	}
+	fmt.Fprintf(&s, "  payload of %v bytes, not decrypted\n", len(b)-size)
+	return s.String(), ErrDecryptionFailed
+}
+
+// isVersionNegotiationForDebug returns true if the datagram has the version flag, a 64-bit connection ID and a non-empty
+// list of QUIC version tags.
+func isVersionNegotiationForDebug(b []byte) bool {
+	if len(b) < 13 || b[0] != QUICFLAG_VERSION|QUICFLAG_CONNID_64bit || (len(b)-9)%4 != 0 {
+		return false
+	}
+	for i := 9; i < len(b); i += 4 {
+		if QuicVersion(binary.LittleEndian.Uint32(b[i:])).Number() < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// openForDebug opens the packet with the opener, diversified with the nonce of the header if needed.
+func openForDebug(opener PacketOpener, header *QuicPacketHeader, seqnum QuicPacketSequenceNumber, plaintext, aad, ciphertext []byte) (int, error) {
+	if d, ok := opener.(DiversifiableOpener); ok {
+		nonce := header.GetDiversificationNonce()
+		if nonce == nil {
+			return 0, ErrDecryptionFailed
+		}
+		diversified, err := d.Diversify(nonce)
+		if err != nil {
+			return 0, err
+		}
+		opener = diversified
+	}
+	return opener.Open(seqnum, plaintext, aad, ciphertext)
+}
+
+// frameForDebug returns the frame type and the fields of the frame on one line.
+func frameForDebug(frame Frame, seqnum QuicPacketSequenceNumber) string {
+	switch f := frame.(type) {
+	case *StreamFrame:
+		data := fmt.Sprintf("%x", f.Data)
+		if len(f.Data) > DEBUG_DATA_SIZE {
+			data = fmt.Sprintf("%x...", f.Data[:DEBUG_DATA_SIZE])
+		}
+		return fmt.Sprintf("STREAM stream %v, offset %v, %v bytes, fin %v: %v", f.StreamID, f.Offset, len(f.Data), f.FIN, data)
+	case *AckFrame:
+		ranges := make([]string, len(f.Ranges))
+		for i, r := range f.Ranges {
+			ranges[i] = fmt.Sprintf("%v-%v", r.Smallest, r.Largest)
+		}
+		s := fmt.Sprintf("ACK largest acked %v, delay %v, ranges %v", f.LargestAcked, f.AckDelay, strings.Join(ranges, " "))
+		for _, ts := range f.Timestamps {
+			s += fmt.Sprintf(", packet %v received at %v", ts.SequenceNumber, ts.Received)
+		}
+		return s
+	case *StopWaitingFrame:
+		return fmt.Sprintf("STOP_WAITING least unacked %v", f.GetLeastUnacked(seqnum))
+	case *RstStreamFrame:
+		return fmt.Sprintf("RST_STREAM stream %v, offset %v, %v", f.StreamID, f.ByteOffset, f.ErrorCode)
+	case *WindowUpdateFrame:
+		return fmt.Sprintf("WINDOW_UPDATE stream %v, offset %v", f.StreamID, f.ByteOffset)
+	case *BlockedFrame:
+		return fmt.Sprintf("BLOCKED stream %v", f.StreamID)
+	case *ConnectionCloseFrame:
+		return fmt.Sprintf("CONNECTION_CLOSE %v, reason %q", f.ErrorCode, f.ReasonPhrase)
+	case *GoawayFrame:
+		return fmt.Sprintf("GOAWAY %v, last good stream %v, reason %q", f.ErrorCode, f.LastGoodStreamID, f.ReasonPhrase)
+	case *PingFrame:
+		return "PING"
+	case *PaddingFrame:
+		return fmt.Sprintf("PADDING %v bytes", f.Size)
+	}
+	return fmt.Sprintf("%T", frame)
+}
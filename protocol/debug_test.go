@@ -0,0 +1,104 @@
+package protocol
+
+import "bytes"
+import "flag"
+import "os"
+import "path/filepath"
+import "testing"
+import "time"
+
+var updateGolden = flag.Bool("update", false, "update the golden files of testdata")
+
+// debugTestPackets returns the datagrams of the round-trip tests: packets of each encryption level, the control frames,
+// an ACK with its STOP_WAITING, a version negotiation packet and a Public Reset.
+func debugTestPackets(t *testing.T) [][]byte {
+	var packets [][]byte
+
+	pack := func(packer *PacketPacker, level EncryptionLevel, frames ...Frame) {
+		for _, f := range frames {
+			if sf, ok := f.(*StreamFrame); ok {
+				packer.QueueStreamFrame(sf)
+			} else {
+				packer.QueueControlFrame(f)
+			}
+		}
+		sealer := &testSealer{macSize: 12, key: byte(level)}
+		p, err := packer.PackPacket(sealer)
+		if p == nil && err == nil {
+			p, err = packer.PackCryptoPacket(sealer)
+		}
+		if err != nil {
+			t.Fatalf("PacketPacker.PackPacket : unexpected error %v", err)
+		}
+		packets = append(packets, p.Data)
+	}
+
+	client := NewPacketPacker(0x0102030405060708, 8, 1350)
+	client.SetVersion(QuicVersion(0x39333051))
+	pack(client, ENCRYPTION_UNENCRYPTED, &PingFrame{}, &StreamFrame{StreamID: 5, Data: []byte("GET /index.html HTTP/1.1"), FIN: true})
+	client.OmitVersion()
+	client.QueueAckFrame(&AckFrame{LargestAcked: 5, AckDelay: 25 * time.Millisecond,
+		Ranges: []AckRange{{Smallest: 4, Largest: 5}, {Smallest: 1, Largest: 2}}}, 2)
+	pack(client, ENCRYPTION_FORWARD_SECURE, &WindowUpdateFrame{StreamID: 5, ByteOffset: 65536}, &BlockedFrame{StreamID: 7})
+	pack(client, ENCRYPTION_FORWARD_SECURE, &RstStreamFrame{StreamID: 7, ByteOffset: 100, ErrorCode: QUIC_PEER_GOING_AWAY},
+		&GoawayFrame{ErrorCode: QUIC_PEER_GOING_AWAY, LastGoodStreamID: 5, ReasonPhrase: "bye"})
+	pack(client, ENCRYPTION_FORWARD_SECURE, &ConnectionCloseFrame{ErrorCode: QUIC_NO_ERROR, ReasonPhrase: "done"})
+
+	server := NewPacketPacker(0x0102030405060708, 0, 1350)
+	server.SetDiversificationNonce(bytes.Repeat([]byte{0xaa}, QUIC_DIVERSIFICATION_NONCE_SIZE))
+	server.SetEncryptionLevels(ENCRYPTION_INITIAL, ENCRYPTION_INITIAL)
+	pack(server, ENCRYPTION_INITIAL, &StreamFrame{StreamID: 1, Offset: 1024, Data: []byte{0x01, 0x02, 0x03}})
+
+	packets = append(packets, BuildVersionNegotiationPacket(0x0102030405060708, []QuicVersion{QuicVersion(0x39333051), QuicVersion(0x33343051)}))
+	packets = append(packets, BuildPublicReset(0x0102030405060708, 6, 0x1122334455667788))
+	return packets
+}
+
+func Test_DecodePacketForDebug(t *testing.T) {
+	var out bytes.Buffer
+
+	keys := &DebugKeys{Openers: []DebugOpener{
+		{Label: "unencrypted", Opener: &testSealer{macSize: 12}},
+		{Label: "initial", Opener: &testSealer{macSize: 12, key: byte(ENCRYPTION_INITIAL)}},
+		{Label: "forward-secure", Opener: &testSealer{macSize: 12, key: byte(ENCRYPTION_FORWARD_SECURE)}}}}
+	packets := debugTestPackets(t)
+	for i, b := range packets {
+		s, err := DecodePacketForDebug(b, keys)
+		if err != nil {
+			t.Errorf("DecodePacketForDebug : unexpected error %v in test n°%v", err, i)
+		}
+		out.WriteString(s)
+	}
+	if keys.LargestReceived != 4 {
+		t.Errorf("DecodePacketForDebug : largest received 4 expected instead of %v", keys.LargestReceived)
+	}
+
+	// Without keys the payload is not decrypted, with the wrong keys the header is returned with the error
+	s, err := DecodePacketForDebug(packets[0], nil)
+	if err != nil {
+		t.Errorf("DecodePacketForDebug : unexpected error %v without keys", err)
+	}
+	out.WriteString(s)
+	s, err = DecodePacketForDebug(packets[1], &DebugKeys{Openers: []DebugOpener{{Label: "initial", Opener: &testSealer{macSize: 12, key: 9}}}})
+	if err != ErrDecryptionFailed {
+		t.Errorf("DecodePacketForDebug : ErrDecryptionFailed expected instead of %v", err)
+	}
+	out.WriteString(s)
+	if _, err = DecodePacketForDebug([]byte{QUICMASK_RESERVED}, nil); err != ErrReservedFlagBits {
+		t.Errorf("DecodePacketForDebug : ErrReservedFlagBits expected instead of %v", err)
+	}
+
+	golden := filepath.Join("testdata", "decode.golden")
+	if *updateGolden {
+		if err = os.WriteFile(golden, out.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("DecodePacketForDebug : output differs from %v, run go test -update to see the differences\n%s", golden, out.Bytes())
+	}
+}
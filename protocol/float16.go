@@ -0,0 +1,52 @@
+package protocol
+
+/*
+
+16-bit unsigned floating point format used for the time values (ACK delay, timestamps deltas):
+
++---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+|     Exponent      |                  Mantissa                 |
+|     (5 bits)      |                  (11 bits)                |
++---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+
+When the exponent is 0 the value is the mantissa (denormalized values 0 to 2^11-1), otherwise the mantissa has a
+12th hidden bit set to 1 and the value is (2^11 + mantissa) << (exponent - 1).
+
+Values 0 to 2^12-1 are encoded as is, the maximum value is 0x3FFC0000000 (encoded as 0xFFFF).
+
+*/
+
+// FLOAT16_MAX is the largest value that can be encoded in the 16-bit unsigned floating point format.
+const FLOAT16_MAX = uint64(0xfff) << 30
+
+// Float16Encode encodes the value (in microseconds for the time values) in the 16-bit unsigned floating point format.
+//
+// The value is rounded down to the nearest representable value, and clamped to FLOAT16_MAX.
+func Float16Encode(us uint64) uint16 {
+	if us < 1<<12 {
+		// Denormalized value or exponent 1: encoded as is
+		return uint16(us)
+	}
+	if us >= FLOAT16_MAX {
+		return 0xffff
+	}
+	exponent := uint64(0)
+	for offset := uint(16); offset > 0; offset >>= 1 {
+		if us >= 1<<(11+offset) {
+			exponent += uint64(offset)
+			us >>= offset
+		}
+	}
+	// us is now in [2^11, 2^12): the hidden bit is added to the exponent
+	return uint16(us + exponent<<11)
+}
+
+// Float16Decode decodes a value in the 16-bit unsigned floating point format.
+func Float16Decode(v uint16) uint64 {
+	us := uint64(v)
+	if us < 1<<12 {
+		return us
+	}
+	exponent := (us >> 11) - 1
+	return (us - exponent<<11) << exponent
+}
@@ -0,0 +1,54 @@
+package protocol
+
+import "testing"
+
+var tests_float16 = []struct {
+	value   uint64
+	encoded uint16
+	decoded uint64
+}{
+	// Denormalized values
+	{0, 0, 0},
+	{1, 1, 1},
+	{2047, 2047, 2047},
+	// Exponent 1
+	{2048, 2048, 2048},
+	{4095, 4095, 4095},
+	// Exponent 2 : rounded down to an even value
+	{4096, 4096, 4096},
+	{4097, 4096, 4096},
+	{4098, 4097, 4098},
+	{8191, 6143, 8190},
+	// Exponent steps
+	{8192, 6144, 8192},
+	{16383, 8191, 16380},
+	{16384, 8192, 16384},
+	{1 << 20, 20480, 1 << 20},
+	{1<<30 + 1, 0xa000, 1 << 30},
+	// Largest values and saturation
+	{FLOAT16_MAX - 1, 0xfffe, 0xffe << 30},
+	{FLOAT16_MAX, 0xffff, FLOAT16_MAX},
+	{FLOAT16_MAX + 1, 0xffff, FLOAT16_MAX},
+	{1 << 63, 0xffff, FLOAT16_MAX},
+}
+
+func Test_Float16(t *testing.T) {
+	for i, v := range tests_float16 {
+		if e := Float16Encode(v.value); e != v.encoded {
+			t.Errorf("Float16Encode : invalid encoded value %x for %v in test n°%v", e, v.value, i)
+		}
+		if d := Float16Decode(v.encoded); d != v.decoded {
+			t.Errorf("Float16Decode : invalid decoded value %v for %x in test n°%v", d, v.encoded, i)
+		}
+	}
+
+	// Every encoded value must decode to a value that encodes to itself, in increasing order
+	previous := uint64(0)
+	for e := 1; e <= 0xffff; e++ {
+		d := Float16Decode(uint16(e))
+		if d <= previous || Float16Encode(d) != uint16(e) || Float16Encode(d-1) != uint16(e-1) {
+			t.Fatalf("Float16Decode : invalid decoded value %v for %x", d, e)
+		}
+		previous = d
+	}
+}
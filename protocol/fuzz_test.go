@@ -0,0 +1,96 @@
+//go:build fuzz
+
+package protocol
+
+import "bytes"
+import "reflect"
+import "testing"
+
+// The fuzz targets of the parsers reachable before the authentication of the packets, run with:
+//
+//	go test -tags fuzz -run XXX -fuzz FuzzParseNextFrame ./protocol
+//
+// The seeds are the vectors of the unit tests, and the corpus of testdata/fuzz.
+
+func FuzzParsePublicHeader(f *testing.F) {
+	nonce := bytes.Repeat([]byte{0xaa}, QUIC_DIVERSIFICATION_NONCE_SIZE)
+	f.Add([]byte{QUICFLAG_CONNID_64bit | QUICFLAG_SEQNUM_8bit, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11, 0x01})
+	f.Add([]byte{QUICFLAG_VERSION | QUICFLAG_CONNID_64bit | QUICFLAG_SEQNUM_48bit, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11,
+		'Q', '0', '3', '9', 0x01, 0x02, 0x03, 0x04, 0x05, 0x06})
+	f.Add(append([]byte{QUICFLAG_DIVERSIFICATION_NONCE | QUICFLAG_CONNID_64bit | QUICFLAG_SEQNUM_16bit,
+		0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11}, append(nonce, 0x01, 0x02)...))
+	f.Add([]byte{QUICFLAG_PUBLICRESET | QUICFLAG_CONNID_64bit, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11})
+	f.Add([]byte{QUICMASK_RESERVED | QUICFLAG_SEQNUM_8bit, 0x0d})
+	for _, v := range tests_quicpacketheader {
+		f.Add(v.data)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		h, n, err := ParsePublicHeader(b)
+		if err != nil {
+			return
+		}
+		if n <= 0 || n > len(b) {
+			t.Fatalf("ParsePublicHeader : %v bytes consumed out of %v", n, len(b))
+		}
+		if h.GetPublicResetFlag() {
+			return
+		}
+		// The header parsed is serialized again in the same bytes
+		out := make([]byte, h.GetSerializedSize())
+		if m, err := h.WritePublicHeader(out); err != nil || m != n || !bytes.Equal(out[:m], b[:n]) {
+			t.Fatalf("QuicPacketHeader.WritePublicHeader : %x expected instead of %x (%v)", b[:n], out[:m], err)
+		}
+	})
+}
+
+func FuzzParseNextFrame(f *testing.F) {
+	for _, v := range tests_controlframes {
+		f.Add(v.data, byte(v.seqnumSize))
+	}
+	for _, v := range tests_streamframe {
+		f.Add(v.data, byte(1))
+	}
+	for _, v := range tests_ackframe {
+		f.Add(v.data, byte(1))
+	}
+	f.Fuzz(func(t *testing.T, b []byte, seqnumSize byte) {
+		header := new(QuicPacketHeader)
+		header.SetSequenceNumberSize([]int{1, 2, 4, 6}[seqnumSize&3])
+		frame, n, err := ParseNextFrame(b, header)
+		if err != nil {
+			return
+		}
+		if n <= 0 || n > len(b) {
+			t.Fatalf("ParseNextFrame : %v bytes consumed out of %v", n, len(b))
+		}
+		// The frame parsed is serialized again as the same frame
+		out := make([]byte, frame.GetSerializedSize())
+		m, err := frame.Write(out)
+		if err != nil {
+			return
+		}
+		again, _, err := ParseNextFrame(out[:m], header)
+		if err != nil || !reflect.DeepEqual(again, frame) {
+			t.Fatalf("ParseNextFrame : %+v expected instead of %+v (%v)", frame, again, err)
+		}
+	})
+}
+
+func FuzzParseHandshakeMessage(f *testing.F) {
+	for _, v := range tests_handshakemessage {
+		f.Add(v.data)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		msg, err := ParseHandshakeMessage(b)
+		if err != nil {
+			return
+		}
+		// A valid message is its own serialization but the padding of the header, and ReadHandshakeMessage reads it from a stream
+		if out := msg.Serialize(); len(out) != len(b) || !bytes.Equal(out[:6], b[:6]) || !bytes.Equal(out[8:], b[8:]) {
+			t.Fatalf("HandshakeMessage.Serialize : %x expected instead of %x", b, out)
+		}
+		if _, err = ReadHandshakeMessage(bytes.NewReader(b)); err != nil && len(b) <= MAX_HANDSHAKE_MESSAGE_SIZE {
+			t.Fatalf("ReadHandshakeMessage : unexpected error %v", err)
+		}
+	})
+}
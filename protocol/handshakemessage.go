@@ -0,0 +1,184 @@
+package protocol
+
+import "encoding/binary"
+import "errors"
+import "io"
+import "sort"
+
+/*
+
+     0        1        2        3        4        5        6        7
++--------+--------+--------+--------+--------+--------+--------+--------+
+|         Message Tag (32)          |  Num entries (16)  |  Padding (16) |
++--------+--------+--------+--------+--------+--------+--------+--------+
+|            Tag 1 (32)             |     Tag 1 value end offset (32)   |
++--------+--------+--------+--------+--------+--------+--------+--------+
+|            Tag 2 (32)             |     Tag 2 value end offset (32)   |  ...
++--------+--------+--------+--------+--------+--------+--------+--------+
+|   Tag 1 value   |   Tag 2 value   | ...
++--------+--------+--------+--------+
+
+The tags are sorted in strictly increasing order, and the end offsets are relative to the start of the values.
+
+*/
+
+// MAX_HANDSHAKE_MESSAGE_SIZE bounds the size of the handshake messages read from the crypto stream.
+const MAX_HANDSHAKE_MESSAGE_SIZE = 64 * 1024
+
+// ErrHandshakeMessageTooManyEntries is returned when a handshake message has more than MaxMessageTagNumEntries tag/value pairs.
+var ErrHandshakeMessageTooManyEntries = errors.New("HandshakeMessage : too many tag/value pairs")
+
+// ErrHandshakeMessageTooLarge is returned by ReadHandshakeMessage when the header announces a message larger than MAX_HANDSHAKE_MESSAGE_SIZE.
+var ErrHandshakeMessageTooLarge = errors.New("ReadHandshakeMessage : handshake message too large")
+
+// HandshakeMessage is a crypto handshake message (CHLO, REJ, SHLO, SCUP ...) made of a message tag and tag/value pairs.
+type HandshakeMessage struct {
+	msgTag MessageTag
+	values map[MessageTag][]byte
+}
+
+// NewHandshakeMessage returns an empty handshake message of the message tag.
+func NewHandshakeMessage(msgTag MessageTag) *HandshakeMessage {
+	return &HandshakeMessage{msgTag: msgTag, values: make(map[MessageTag][]byte)}
+}
+
+// ParseHandshakeMessage parses a handshake message that must fill all the data.
+//
+// Unsorted or duplicated tags, end offsets going backwards and length mismatches are rejected.
+func ParseHandshakeMessage(b []byte) (*HandshakeMessage, error) {
+	var prevTag MessageTag
+	var prevOffset uint32
+
+	if len(b) < 8 {
+		return nil, errors.New("ParseHandshakeMessage : data size too small to contain the message header")
+	}
+	numEntries := int(binary.LittleEndian.Uint16(b[4:]))
+	if numEntries > MaxMessageTagNumEntries {
+		return nil, ErrHandshakeMessageTooManyEntries
+	}
+	if len(b) < 8+8*numEntries {
+		return nil, errors.New("ParseHandshakeMessage : data size too small to contain the tag/offset pairs")
+	}
+	values := b[8+8*numEntries:]
+	msg := NewHandshakeMessage(MessageTag(binary.LittleEndian.Uint32(b)))
+	for i := 0; i < numEntries; i++ {
+		tag := MessageTag(binary.LittleEndian.Uint32(b[8+8*i:]))
+		offset := binary.LittleEndian.Uint32(b[12+8*i:])
+		if i > 0 && tag <= prevTag {
+			return nil, errors.New("ParseHandshakeMessage : tags must be sorted in strictly increasing order")
+		}
+		if offset < prevOffset {
+			return nil, errors.New("ParseHandshakeMessage : tag value end offsets must not go backwards")
+		}
+		if uint64(offset) > uint64(len(values)) {
+			return nil, errors.New("ParseHandshakeMessage : tag value end offset beyond the end of data")
+		}
+		msg.values[tag] = append([]byte(nil), values[prevOffset:offset]...)
+		prevTag = tag
+		prevOffset = offset
+	}
+	if int(prevOffset) != len(values) {
+		return nil, errors.New("ParseHandshakeMessage : values length mismatch with the last end offset")
+	}
+	return msg, nil
+}
+
+// ReadHandshakeMessage reads the next handshake message from the crypto stream: the header gives the number of entries,
+// and the last end offset gives the size of the values. The message is returned once all its data is read, whatever the
+// STREAM frames it is split into. Messages larger than MAX_HANDSHAKE_MESSAGE_SIZE are rejected before their values are read.
+func ReadHandshakeMessage(r io.Reader) (*HandshakeMessage, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	numEntries := int(binary.LittleEndian.Uint16(header[4:]))
+	if numEntries > MaxMessageTagNumEntries {
+		return nil, ErrHandshakeMessageTooManyEntries
+	}
+	b := make([]byte, 8+8*numEntries)
+	copy(b, header)
+	if _, err := io.ReadFull(r, b[8:]); err != nil {
+		return nil, err
+	}
+	// The size is checked on 64 bits: the last end offset would be negative as an int of 32 bits
+	var size uint64
+	if numEntries > 0 {
+		size = uint64(binary.LittleEndian.Uint32(b[len(b)-4:]))
+	}
+	if uint64(len(b))+size > MAX_HANDSHAKE_MESSAGE_SIZE {
+		return nil, ErrHandshakeMessageTooLarge
+	}
+	b = append(b, make([]byte, size)...)
+	if _, err := io.ReadFull(r, b[8+8*numEntries:]); err != nil {
+		return nil, err
+	}
+	return ParseHandshakeMessage(b)
+}
+
+// GetMessageTag returns the message tag.
+func (this *HandshakeMessage) GetMessageTag() MessageTag {
+	return this.msgTag
+}
+
+// GetNumEntries returns the number of tag/value pairs.
+func (this *HandshakeMessage) GetNumEntries() int {
+	return len(this.values)
+}
+
+// GetTag returns the value of the tag and true, or nil and false if the message doesn't contain the tag.
+func (this *HandshakeMessage) GetTag(tag MessageTag) ([]byte, bool) {
+	v, ok := this.values[tag]
+	return v, ok
+}
+
+// SetTag adds or replaces the value of the tag.
+func (this *HandshakeMessage) SetTag(tag MessageTag, value []byte) error {
+	if _, ok := this.values[tag]; !ok && len(this.values) >= MaxMessageTagNumEntries {
+		return ErrHandshakeMessageTooManyEntries
+	}
+	this.values[tag] = value
+	return nil
+}
+
+// DeleteTag removes the tag/value pair of the tag.
+func (this *HandshakeMessage) DeleteTag(tag MessageTag) {
+	delete(this.values, tag)
+}
+
+// Tags returns the tags of the message in increasing order.
+func (this *HandshakeMessage) Tags() []MessageTag {
+	tags := make([]MessageTag, 0, len(this.values))
+	for t := range this.values {
+		tags = append(tags, t)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	return tags
+}
+
+// GetSerializedSize returns the size of the serialized message.
+func (this *HandshakeMessage) GetSerializedSize() int {
+	size := 8 + 8*len(this.values)
+	for _, v := range this.values {
+		size += len(v)
+	}
+	return size
+}
+
+// Serialize returns the serialized message, with the tags sorted and the cumulative end offsets of their values.
+func (this *HandshakeMessage) Serialize() []byte {
+	var offset uint32
+
+	tags := this.Tags()
+	b := make([]byte, this.GetSerializedSize())
+	binary.LittleEndian.PutUint32(b, uint32(this.msgTag))
+	binary.LittleEndian.PutUint16(b[4:], uint16(len(tags)))
+	values := b[8+8*len(tags):]
+	for i, t := range tags {
+		v := this.values[t]
+		copy(values[offset:], v)
+		offset += uint32(len(v))
+		binary.LittleEndian.PutUint32(b[8+8*i:], uint32(t))
+		binary.LittleEndian.PutUint32(b[12+8*i:], offset)
+	}
+	return b
+}
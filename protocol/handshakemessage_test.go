@@ -0,0 +1,195 @@
+package protocol
+
+import "testing"
+import "bytes"
+import "io"
+
+var tests_handshakemessage = []struct {
+	positiveTest bool
+	data         []byte
+}{
+	{true, []byte{
+		'C', 'H', 'L', 'O', // Message tag
+		0x00, 0x00, 0x00, 0x00}}, // No entries
+	{true, []byte{
+		'C', 'H', 'L', 'O', // Message tag
+		0x02, 0x00, 0x00, 0x00, // Num entries (uint16) + 2 bytes of padding
+		'S', 'N', 'I', 0x00, // Tag 'SNI'
+		0x03, 0x00, 0x00, 0x00, //     'SNI' end offset
+		'V', 'E', 'R', 'S', // Tag 'VERS'
+		0x07, 0x00, 0x00, 0x00, //     'VERS' end offset
+		'a', '.', 'b', // SNI value
+		'Q', '0', '3', '9'}}, // VERS value
+	// Empty value
+	{true, []byte{
+		'R', 'E', 'J', 0x00, // Message tag
+		0x02, 0x00, 0x00, 0x00, // Num entries (uint16) + 2 bytes of padding
+		'S', 'T', 'K', 0x00, // Tag 'STK'
+		0x00, 0x00, 0x00, 0x00, //     'STK' end offset
+		'S', 'N', 'O', 0x00, // Tag 'SNO'
+		0x01, 0x00, 0x00, 0x00, //     'SNO' end offset
+		0xaa}}, // SNO value
+	// Unsorted tags
+	{false, []byte{
+		'C', 'H', 'L', 'O', // Message tag
+		0x02, 0x00, 0x00, 0x00, // Num entries (uint16) + 2 bytes of padding
+		'V', 'E', 'R', 'S', // Tag 'VERS'
+		0x04, 0x00, 0x00, 0x00, //     'VERS' end offset
+		'S', 'N', 'I', 0x00, // Tag 'SNI'
+		0x07, 0x00, 0x00, 0x00, //     'SNI' end offset
+		'Q', '0', '3', '9', // VERS value
+		'a', '.', 'b'}}, // SNI value
+	// Duplicated tags
+	{false, []byte{
+		'C', 'H', 'L', 'O', // Message tag
+		0x02, 0x00, 0x00, 0x00, // Num entries (uint16) + 2 bytes of padding
+		'S', 'N', 'I', 0x00, // Tag 'SNI'
+		0x01, 0x00, 0x00, 0x00, //     'SNI' end offset
+		'S', 'N', 'I', 0x00, // Tag 'SNI'
+		0x02, 0x00, 0x00, 0x00, //     'SNI' end offset
+		'a', 'b'}},
+	// Offsets going backwards
+	{false, []byte{
+		'C', 'H', 'L', 'O', // Message tag
+		0x02, 0x00, 0x00, 0x00, // Num entries (uint16) + 2 bytes of padding
+		'S', 'N', 'I', 0x00, // Tag 'SNI'
+		0x04, 0x00, 0x00, 0x00, //     'SNI' end offset
+		'V', 'E', 'R', 'S', // Tag 'VERS'
+		0x03, 0x00, 0x00, 0x00, //     'VERS' end offset
+		'a', '.', 'b', 'c'}},
+	// Values shorter than the last end offset
+	{false, []byte{
+		'C', 'H', 'L', 'O', // Message tag
+		0x01, 0x00, 0x00, 0x00, // Num entries (uint16) + 2 bytes of padding
+		'S', 'N', 'I', 0x00, // Tag 'SNI'
+		0x04, 0x00, 0x00, 0x00, //     'SNI' end offset
+		'a', '.', 'b'}},
+	// Values longer than the last end offset
+	{false, []byte{
+		'C', 'H', 'L', 'O', // Message tag
+		0x01, 0x00, 0x00, 0x00, // Num entries (uint16) + 2 bytes of padding
+		'S', 'N', 'I', 0x00, // Tag 'SNI'
+		0x02, 0x00, 0x00, 0x00, //     'SNI' end offset
+		'a', '.', 'b'}},
+	// Huge end offset
+	{false, []byte{
+		'C', 'H', 'L', 'O', // Message tag
+		0x01, 0x00, 0x00, 0x00, // Num entries (uint16) + 2 bytes of padding
+		'S', 'N', 'I', 0x00, // Tag 'SNI'
+		0xff, 0xff, 0xff, 0xff, //     'SNI' end offset
+		'a', '.', 'b'}},
+	// Missing tag/offset pairs
+	{false, []byte{
+		'C', 'H', 'L', 'O', // Message tag
+		0x02, 0x00, 0x00, 0x00, // Num entries (uint16) + 2 bytes of padding
+		'S', 'N', 'I', 0x00, // Tag 'SNI'
+		0x00, 0x00, 0x00, 0x00}}, //     'SNI' end offset
+	// Too many entries
+	{false, []byte{
+		'C', 'H', 'L', 'O', // Message tag
+		0x81, 0x00, 0x00, 0x00}}, // Num entries (uint16) + 2 bytes of padding
+	// Truncated header
+	{false, []byte{'C', 'H', 'L', 'O', 0x00, 0x00, 0x00}},
+}
+
+func Test_HandshakeMessage_Parse(t *testing.T) {
+	for i, v := range tests_handshakemessage {
+		msg, err := ParseHandshakeMessage(v.data)
+		if !v.positiveTest {
+			if err == nil {
+				t.Errorf("ParseHandshakeMessage : missing error in test n°%v", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseHandshakeMessage : error %v in test n°%v", err, i)
+			continue
+		}
+		if b := msg.Serialize(); !bytes.Equal(b, v.data) {
+			t.Errorf("HandshakeMessage.Serialize : invalid serialized data %x in test n°%v", b, i)
+		}
+	}
+}
+
+func Test_HandshakeMessage_Serialize(t *testing.T) {
+	msg := NewHandshakeMessage(TagCHLO)
+	msg.SetTag(TagVERS, []byte("Q039"))
+	msg.SetTag(TagSNI, []byte("a.b"))
+	msg.SetTag(TagPAD, []byte{0, 0})
+	msg.SetTag(TagPAD, nil)
+	if v, ok := msg.GetTag(TagPAD); !ok || len(v) != 0 || msg.GetNumEntries() != 3 {
+		t.Errorf("HandshakeMessage.SetTag : invalid replaced PAD value %x", v)
+	}
+	msg.DeleteTag(TagPAD)
+	b := msg.Serialize()
+	if !bytes.Equal(b, tests_handshakemessage[1].data) || len(b) != msg.GetSerializedSize() {
+		t.Errorf("HandshakeMessage.Serialize : invalid serialized data %x", b)
+	}
+	if v, ok := msg.GetTag(TagSNI); !ok || string(v) != "a.b" {
+		t.Errorf("HandshakeMessage.GetTag : invalid SNI value %q", v)
+	}
+	if _, ok := msg.GetTag(TagSTK); ok {
+		t.Error("HandshakeMessage.GetTag : missing STK tag expected")
+	}
+	if msg.GetMessageTag() != TagCHLO || msg.GetNumEntries() != 2 {
+		t.Errorf("HandshakeMessage : invalid message tag %x or number of entries %v", msg.GetMessageTag(), msg.GetNumEntries())
+	}
+
+	msg = NewHandshakeMessage(TagSHLO)
+	for i := 0; i < MaxMessageTagNumEntries; i++ {
+		if err := msg.SetTag(MessageTag(i), []byte{byte(i)}); err != nil {
+			t.Fatalf("HandshakeMessage.SetTag : unexpected error %v for entry n°%v", err, i)
+		}
+	}
+	if err := msg.SetTag(MessageTag(MaxMessageTagNumEntries), nil); err != ErrHandshakeMessageTooManyEntries {
+		t.Errorf("HandshakeMessage.SetTag : ErrHandshakeMessageTooManyEntries expected instead of %v", err)
+	}
+	if err := msg.SetTag(0, []byte{0xff}); err != nil {
+		t.Errorf("HandshakeMessage.SetTag : replacing a value must be accepted with the maximum number of entries : %v", err)
+	}
+	if _, err := ParseHandshakeMessage(msg.Serialize()); err != nil {
+		t.Errorf("ParseHandshakeMessage : message with the maximum number of entries must be accepted : %v", err)
+	}
+}
+
+func Test_HandshakeMessage_Read(t *testing.T) {
+	// Consecutive messages on a stream
+	var stream bytes.Buffer
+	for _, v := range tests_handshakemessage {
+		if v.positiveTest {
+			stream.Write(v.data)
+		}
+	}
+	for i, v := range tests_handshakemessage {
+		if !v.positiveTest {
+			continue
+		}
+		msg, err := ReadHandshakeMessage(&stream)
+		if err != nil {
+			t.Fatalf("ReadHandshakeMessage : unexpected error %v in test n°%v", err, i)
+		}
+		if b := msg.Serialize(); !bytes.Equal(b, v.data) {
+			t.Errorf("ReadHandshakeMessage : invalid message %x in test n°%v", b, i)
+		}
+	}
+	if _, err := ReadHandshakeMessage(&stream); err != io.EOF {
+		t.Errorf("ReadHandshakeMessage : io.EOF expected instead of %v", err)
+	}
+
+	// Truncated and oversized messages
+	msg := NewHandshakeMessage(TagREJ)
+	msg.SetTag(TagSCFG, make([]byte, 100))
+	b := msg.Serialize()
+	if _, err := ReadHandshakeMessage(bytes.NewReader(b[:len(b)-1])); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadHandshakeMessage : io.ErrUnexpectedEOF expected instead of %v", err)
+	}
+	msg.SetTag(TagSCFG, make([]byte, MAX_HANDSHAKE_MESSAGE_SIZE))
+	if _, err := ReadHandshakeMessage(bytes.NewReader(msg.Serialize())); err != ErrHandshakeMessageTooLarge {
+		t.Errorf("ReadHandshakeMessage : ErrHandshakeMessageTooLarge expected instead of %v", err)
+	}
+	// The largest end offset, negative as an int of 32 bits
+	b = []byte{'R', 'E', 'J', 0x00, 0x01, 0x00, 0x00, 0x00, 'S', 'C', 'F', 'G', 0xff, 0xff, 0xff, 0xff}
+	if _, err := ReadHandshakeMessage(bytes.NewReader(b)); err != ErrHandshakeMessageTooLarge {
+		t.Errorf("ReadHandshakeMessage : ErrHandshakeMessageTooLarge expected instead of %v for an end offset of 0xffffffff", err)
+	}
+}
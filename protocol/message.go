@@ -51,6 +51,7 @@ const (
 	TagNULL = ('N') + ('U' << 8) + ('L' << 16) + ('L' << 24) //     null algorithm = no encryption with FNV1A-128 12-byte tag
 	TagAESG = ('A') + ('E' << 8) + ('S' << 16) + ('G' << 24) //     AES-GCM with 12-byte tag
 	TagS20P = ('S') + ('2' << 8) + ('0' << 16) + ('P' << 24) //     Salsa20 with Poly1305
+	TagCC20 = ('C') + ('C' << 8) + ('2' << 16) + ('0' << 24) //     ChaCha20 with Poly1305 12-byte tag
 
 	TagORBT = ('O') + ('R' << 8) + ('B' << 16) + ('T' << 24) // Orbit, 8-byte opaque value that identifies strike-register
 	TagEXPY = ('E') + ('X' << 8) + ('P' << 16) + ('Y' << 24) // Expiry, 64-bit expiry time for server config in UNIX epoch-seconds
@@ -74,6 +75,8 @@ const (
 	TagSWND = ('S') + ('W' << 8) + ('N' << 16) + ('D' << 24) //     Server’s Initial congestion window
 	TagSFCW = ('S') + ('F' << 8) + ('C' << 16) + ('W' << 24) //     Initial stream flow control receive window
 	TagCFCW = ('C') + ('F' << 8) + ('C' << 16) + ('W' << 24) //     Initial session/connection flow control receive window
+	TagTCID = ('T') + ('C' << 8) + ('I' << 16) + ('D' << 24) //     Truncated Connection ID, 0 to omit the Connection ID of the packets received
+	TagALPN = ('A') + ('L' << 8) + ('P' << 16) + ('N' << 24) //     Application protocols, each one after its 8-bit length: proposed in CHLO, selected in SHLO
 
 // new Tag = '' + ('' << 8) + ('' << 16) + ('' << 24) //
 )
@@ -0,0 +1,336 @@
+package protocol
+
+import "github.com/romain-jacotin/quic/internal/bufferpool"
+import "errors"
+
+// PacketSealer protects the payload of the packets, the crypto.AEAD interface implements it.
+type PacketSealer interface {
+	// Seal encrypts and authenticates the plaintext and the aad, and writes the ciphertext followed by the MAC
+	Seal(seqnum QuicPacketSequenceNumber, ciphertext, aad, plaintext []byte) (int, error)
+	// GetMacSize returns the size of the MAC appended to the ciphertext
+	GetMacSize() int
+}
+
+// ErrFrameTooLarge is returned by PackPacket when a control frame doesn't fit in an empty packet.
+var ErrFrameTooLarge = errors.New("PacketPacker.PackPacket : frame too large to fit in a packet")
+
+// PackedPacket is a protected packet ready to be sent, with the frames it contains for the loss recovery.
+type PackedPacket struct {
+	SequenceNumber QuicPacketSequenceNumber
+	Data           []byte
+	Frames         []Frame
+	// EncryptionLevel is the encryption level of the sealer, the packets of rejected initial keys are retransmitted with the new ones
+	EncryptionLevel EncryptionLevel
+	// Retransmittable is false for the packets that only contain ACK, STOP_WAITING or PADDING frames
+	Retransmittable bool
+	// MTUProbe is true for the padded PING packets of PackMTUProbePacket
+	MTUProbe bool
+}
+
+// Release returns the buffer of the packet to the pool once it is written on the connection, the data can't be used anymore.
+func (this *PackedPacket) Release() {
+	bufferpool.Put(this.Data)
+	this.Data = nil
+}
+
+// PacketPacker assembles the pending frames into packets of the maximum packet size.
+//
+// The control frames are packed before the stream data, and a STREAM frame that doesn't fit in the packet is split
+// at the packet boundary: the rest of its data stays pending with the updated offset.
+//
+// The data of the crypto stream is packed in separate packets by PackCryptoPacket, as the handshake messages
+// are protected with the keys of their encryption level and not with the newest keys.
+type PacketPacker struct {
+	connID        QuicConnectionID
+	connIDSize    int
+	version       QuicVersion
+	sendVersion   bool
+	maxPacketSize int
+	seqnum        QuicPacketSequenceNumber
+	largestAcked  QuicPacketSequenceNumber
+	ackFrame      *AckFrame
+	leastUnacked  QuicPacketSequenceNumber
+	controlFrames []Frame
+	streamFrames  []*StreamFrame
+	cryptoFrames  []*StreamFrame
+	level         EncryptionLevel
+	cryptoLevel   EncryptionLevel
+	nonce         []byte
+}
+
+// packing selects the frames of the next packet.
+type packing int
+
+const (
+	packAll packing = iota
+	packAckOnly
+	packCrypto
+	packMTUProbe
+)
+
+// NewPacketPacker returns a PacketPacker for the connection, that writes the Connection ID on connIDSize bytes (0, 1, 4 or 8).
+func NewPacketPacker(connID QuicConnectionID, connIDSize int, maxPacketSize int) *PacketPacker {
+	return &PacketPacker{connID: connID, connIDSize: connIDSize, maxPacketSize: maxPacketSize}
+}
+
+// SetVersion adds the version in the header of the next packets, as the client does until the version is negotiated.
+func (this *PacketPacker) SetVersion(version QuicVersion) {
+	this.version = version
+	this.sendVersion = true
+}
+
+// OmitVersion removes the version from the header of the next packets.
+func (this *PacketPacker) OmitVersion() {
+	this.sendVersion = false
+}
+
+// SetDiversificationNonce adds the diversification nonce in the header of the next packets of the initial encryption level,
+// as the server does with the nonce of its initial keys.
+func (this *PacketPacker) SetDiversificationNonce(nonce []byte) {
+	this.nonce = nonce
+}
+
+// SetMaxPacketSize sets the maximum size of the packets, from the path MTU.
+func (this *PacketPacker) SetMaxPacketSize(size int) {
+	this.maxPacketSize = size
+}
+
+// SetConnectionIDSize sets the size of the Connection ID of the next packets (0, 1, 4 or 8), 0 once its truncation is negotiated.
+func (this *PacketPacker) SetConnectionIDSize(size int) {
+	this.connIDSize = size
+}
+
+// SetEncryptionLevels sets the encryption levels of the sealers of PackPacket and PackCryptoPacket, recorded in the packed packets.
+func (this *PacketPacker) SetEncryptionLevels(level, cryptoLevel EncryptionLevel) {
+	this.level = level
+	this.cryptoLevel = cryptoLevel
+}
+
+// SetLargestAcked sets the largest sequence number acknowledged by the peer, it gives the size of the truncated sequence numbers.
+func (this *PacketPacker) SetLargestAcked(seqnum QuicPacketSequenceNumber) {
+	if seqnum > this.largestAcked {
+		this.largestAcked = seqnum
+	}
+}
+
+// GetSequenceNumber returns the sequence number of the last packed packet.
+func (this *PacketPacker) GetSequenceNumber() QuicPacketSequenceNumber {
+	return this.seqnum
+}
+
+// QueueAckFrame queues the ACK frame of the next packet, followed by a STOP_WAITING frame with the least unacked sequence number.
+//
+// The STOP_WAITING frame depends on the sequence number of the packet, so it is built when the packet is packed.
+// A queued ACK frame replaces the previous one.
+func (this *PacketPacker) QueueAckFrame(f *AckFrame, leastUnacked QuicPacketSequenceNumber) {
+	this.ackFrame = f
+	this.leastUnacked = leastUnacked
+}
+
+// QueueControlFrame queues a frame that is sent before the stream data.
+func (this *PacketPacker) QueueControlFrame(f Frame) {
+	this.controlFrames = append(this.controlFrames, f)
+}
+
+// QueueStreamFrame queues stream data, the frame is copied and can be split over several packets.
+func (this *PacketPacker) QueueStreamFrame(f *StreamFrame) {
+	sf := *f
+	sf.OmitDataLength = false
+	if sf.StreamID.IsCryptoStream() {
+		this.cryptoFrames = append(this.cryptoFrames, &sf)
+	} else {
+		this.streamFrames = append(this.streamFrames, &sf)
+	}
+}
+
+// HasPendingFrames returns true if some frames, other than the crypto stream data, are waiting to be packed.
+func (this *PacketPacker) HasPendingFrames() bool {
+	return this.ackFrame != nil || len(this.controlFrames) > 0 || len(this.streamFrames) > 0
+}
+
+// HasPendingCryptoFrames returns true if some crypto stream data is waiting to be packed.
+func (this *PacketPacker) HasPendingCryptoFrames() bool {
+	return len(this.cryptoFrames) > 0
+}
+
+// PackPacket packs the pending frames in the next packet and protects it with the sealer, the public header is the associated data.
+//
+// PackPacket returns nil if there is no pending frame. The crypto stream data is not packed.
+func (this *PacketPacker) PackPacket(sealer PacketSealer) (*PackedPacket, error) {
+	if !this.HasPendingFrames() {
+		return nil, nil
+	}
+	return this.pack(sealer, packAll)
+}
+
+// PackCryptoPacket packs the pending crypto stream data alone, protected with the sealer of the handshake encryption level.
+//
+// PackCryptoPacket returns nil if there is no pending crypto stream data.
+func (this *PacketPacker) PackCryptoPacket(sealer PacketSealer) (*PackedPacket, error) {
+	if !this.HasPendingCryptoFrames() {
+		return nil, nil
+	}
+	return this.pack(sealer, packCrypto)
+}
+
+// PackAckPacket packs the queued ACK frame alone, as it can be sent when the congestion window is full.
+//
+// PackAckPacket returns nil if there is no queued ACK frame.
+func (this *PacketPacker) PackAckPacket(sealer PacketSealer) (*PackedPacket, error) {
+	if this.ackFrame == nil {
+		return nil, nil
+	}
+	return this.pack(sealer, packAckOnly)
+}
+
+// PackMTUProbePacket packs a PING frame padded to a packet of the size, that can be larger than the maximum packet size:
+// the path MTU is at least the size if the packet is acknowledged.
+func (this *PacketPacker) PackMTUProbePacket(sealer PacketSealer, size int) (*PackedPacket, error) {
+	maxPacketSize := this.maxPacketSize
+	this.maxPacketSize = size
+	defer func() { this.maxPacketSize = maxPacketSize }()
+	return this.pack(sealer, packMTUProbe)
+}
+
+// pack packs the next packet with the frames selected by the packing.
+func (this *PacketPacker) pack(sealer PacketSealer, packing packing) (*PackedPacket, error) {
+	var header QuicPacketHeader
+	var frames []Frame
+	var size int
+
+	seqnum := this.seqnum + 1
+	seqnumSize, _ := TruncateSequenceNumber(seqnum, this.largestAcked)
+	header.SetConnectionID(this.connID)
+	if err := header.SetConnectionIdSize(this.connIDSize); err != nil {
+		return nil, err
+	}
+	header.SetSequenceNumber(seqnum)
+	header.SetSequenceNumberSize(seqnumSize)
+	if this.sendVersion {
+		header.SetVersionFlag(true)
+		header.SetVersion(this.version)
+	}
+	level := this.level
+	if packing == packCrypto {
+		level = this.cryptoLevel
+	}
+	if this.nonce != nil && level == ENCRYPTION_INITIAL {
+		if err := header.SetDiversificationNonce(this.nonce); err != nil {
+			return nil, err
+		}
+	}
+	headerSize := header.GetSerializedSize()
+	budget := this.maxPacketSize - headerSize - sealer.GetMacSize()
+
+	// ACK and STOP_WAITING frames first
+	if this.ackFrame != nil && (packing == packAll || packing == packAckOnly) {
+		sw := NewStopWaitingFrame(this.leastUnacked, seqnum, seqnumSize)
+		size = this.ackFrame.GetSerializedSize() + sw.GetSerializedSize()
+		if size > budget {
+			return nil, ErrFrameTooLarge
+		}
+		frames = append(frames, this.ackFrame, sw)
+		this.ackFrame = nil
+	}
+
+	// Then control frames
+	for packing == packAll && len(this.controlFrames) > 0 {
+		f := this.controlFrames[0]
+		s := f.GetSerializedSize()
+		if s > budget-size {
+			if len(frames) == 0 {
+				return nil, ErrFrameTooLarge
+			}
+			break
+		}
+		frames = append(frames, f)
+		size += s
+		this.controlFrames = this.controlFrames[1:]
+	}
+
+	// Then stream data, split at the packet boundary
+	queue := &this.streamFrames
+	if packing == packCrypto {
+		queue = &this.cryptoFrames
+	}
+	for (packing == packCrypto || packing == packAll && len(this.controlFrames) == 0) && len(*queue) > 0 {
+		sf := (*queue)[0]
+		overhead := (&StreamFrame{StreamID: sf.StreamID, Offset: sf.Offset}).GetSerializedSize()
+		room := budget - size - overhead
+		if len(sf.Data) <= room {
+			frames = append(frames, sf)
+			size += overhead + len(sf.Data)
+			*queue = (*queue)[1:]
+			continue
+		}
+		// The frame ends the packet, without the Data Length field
+		room += 2
+		if len(sf.Data) <= room {
+			frames = append(frames, sf)
+			size += overhead - 2 + len(sf.Data)
+			*queue = (*queue)[1:]
+			break
+		}
+		if room <= 0 {
+			break
+		}
+		frames = append(frames, &StreamFrame{StreamID: sf.StreamID, Offset: sf.Offset, Data: sf.Data[:room]})
+		size += overhead - 2 + room
+		sf.Offset += QuicByteOffset(room)
+		sf.Data = sf.Data[room:]
+		break
+	}
+	if packing == packMTUProbe {
+		padded, err := PadPacket([]Frame{&PingFrame{}}, budget)
+		if err != nil {
+			return nil, err
+		}
+		frames, size = padded, budget
+	}
+	if len(frames) == 0 {
+		return nil, ErrFrameTooLarge
+	}
+	// The last STREAM frame of the packet doesn't need the Data Length field
+	if sf, ok := frames[len(frames)-1].(*StreamFrame); ok {
+		sf.OmitDataLength = true
+	}
+
+	// Serialize and protect the packet
+	b := bufferpool.Get(this.maxPacketSize)
+	plaintext := bufferpool.Get(size)
+	defer bufferpool.Put(plaintext)
+	if _, err := header.WritePublicHeader(b); err != nil {
+		bufferpool.Put(b)
+		return nil, err
+	}
+	s, err := WriteFrames(plaintext, frames)
+	if err != nil {
+		bufferpool.Put(b)
+		return nil, err
+	}
+	n, err := sealer.Seal(seqnum, b[headerSize:], b[:headerSize], plaintext[:s])
+	if err != nil {
+		bufferpool.Put(b)
+		return nil, err
+	}
+	this.seqnum = seqnum
+	return &PackedPacket{
+		SequenceNumber:  seqnum,
+		Data:            b[:headerSize+n],
+		Frames:          frames,
+		EncryptionLevel: level,
+		Retransmittable: IsRetransmittable(frames),
+		MTUProbe:        packing == packMTUProbe}, nil
+}
+
+// IsRetransmittable returns true if one of the frames must be retransmitted when the packet is lost.
+func IsRetransmittable(frames []Frame) bool {
+	for _, f := range frames {
+		switch f.(type) {
+		case *AckFrame, *StopWaitingFrame, *PaddingFrame:
+		default:
+			return true
+		}
+	}
+	return false
+}
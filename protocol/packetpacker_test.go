@@ -0,0 +1,279 @@
+package protocol
+
+import "testing"
+import "bytes"
+import "errors"
+
+// testSealer copies the plaintext and appends a MAC made of the low byte of the sequence number xored with the key.
+type testSealer struct {
+	macSize int
+	key     byte
+}
+
+func (this *testSealer) Seal(seqnum QuicPacketSequenceNumber, ciphertext, aad, plaintext []byte) (int, error) {
+	if len(ciphertext) < len(plaintext)+this.macSize {
+		return 0, errors.New("testSealer.Seal : ciphertext too small")
+	}
+	copy(ciphertext, plaintext)
+	for i := 0; i < this.macSize; i++ {
+		ciphertext[len(plaintext)+i] = byte(seqnum) ^ this.key
+	}
+	return len(plaintext) + this.macSize, nil
+}
+
+func (this *testSealer) Open(seqnum QuicPacketSequenceNumber, plaintext, aad, ciphertext []byte) (int, error) {
+	l := len(ciphertext) - this.macSize
+	if l < 0 {
+		return 0, errors.New("testSealer.Open : ciphertext too small")
+	}
+	for _, v := range ciphertext[l:] {
+		if v != byte(seqnum)^this.key {
+			return 0, errors.New("testSealer.Open : invalid MAC")
+		}
+	}
+	return copy(plaintext, ciphertext[:l]), nil
+}
+
+func (this *testSealer) GetMacSize() int {
+	return this.macSize
+}
+
+// unpackTestPacket parses the header and the frames of a packet sealed by a testSealer.
+func unpackTestPacket(t *testing.T, b []byte, macSize int) (*QuicPacketHeader, []Frame) {
+	header, s, err := ParsePublicHeader(b)
+	if err != nil {
+		t.Fatalf("ParsePublicHeader : unexpected error %v", err)
+	}
+	frames, err := ParseFrames(b[s:len(b)-macSize], header)
+	if err != nil {
+		t.Fatalf("ParseFrames : unexpected error %v", err)
+	}
+	return header, frames
+}
+
+func Test_PacketPacker_SplitStreamFrame(t *testing.T) {
+	var offset QuicByteOffset
+	var received []byte
+
+	sealer := &testSealer{macSize: 12}
+	data := make([]byte, 5000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	packer := NewPacketPacker(0x0102030405060708, 8, 1350)
+	packer.QueueStreamFrame(&StreamFrame{StreamID: 5, Data: data, FIN: true})
+	for i := 1; packer.HasPendingFrames(); i++ {
+		p, err := packer.PackPacket(sealer)
+		if err != nil {
+			t.Fatalf("PacketPacker.PackPacket : unexpected error %v in packet n°%v", err, i)
+		}
+		if len(p.Data) > 1350 {
+			t.Errorf("PacketPacker.PackPacket : packet size %v exceeds the MTU in packet n°%v", len(p.Data), i)
+		}
+		if packer.HasPendingFrames() && len(p.Data) != 1350 {
+			t.Errorf("PacketPacker.PackPacket : packet size %v instead of the MTU in packet n°%v", len(p.Data), i)
+		}
+		if p.SequenceNumber != QuicPacketSequenceNumber(i) || !p.Retransmittable {
+			t.Errorf("PacketPacker.PackPacket : invalid packet %v %v in packet n°%v", p.SequenceNumber, p.Retransmittable, i)
+		}
+		header, frames := unpackTestPacket(t, p.Data, 12)
+		if header.GetConnectionID() != 0x0102030405060708 || header.GetSequenceNumber() != p.SequenceNumber || len(frames) != 1 {
+			t.Fatalf("PacketPacker.PackPacket : invalid header or frames in packet n°%v", i)
+		}
+		sf := frames[0].(*StreamFrame)
+		if sf.StreamID != 5 || sf.Offset != offset || sf.FIN != !packer.HasPendingFrames() {
+			t.Errorf("PacketPacker.PackPacket : invalid STREAM frame offset %v (%v expected) in packet n°%v", sf.Offset, offset, i)
+		}
+		offset += QuicByteOffset(len(sf.Data))
+		received = append(received, sf.Data...)
+	}
+	if !bytes.Equal(received, data) {
+		t.Error("PacketPacker.PackPacket : invalid stream data")
+	}
+}
+
+func Test_PacketPacker_ControlFrames(t *testing.T) {
+	sealer := &testSealer{macSize: 12}
+	packer := NewPacketPacker(0x42, 1, 100)
+	packer.SetVersion(QUIC_VERSION_39)
+
+	// ACK only packets are not retransmittable
+	packer.QueueControlFrame(&AckFrame{LargestAcked: 3, Ranges: []AckRange{{1, 3}}})
+	p, err := packer.PackPacket(sealer)
+	if err != nil || p.Retransmittable || len(p.Frames) != 1 {
+		t.Fatalf("PacketPacker.PackPacket : invalid ACK only packet %+v (%v)", p, err)
+	}
+	header, _ := unpackTestPacket(t, p.Data, 12)
+	if !header.GetVersionFlag() || header.GetVersion() != QUIC_VERSION_39 || header.GetConnectionID() != 0x42 {
+		t.Errorf("PacketPacker.PackPacket : invalid header %+v", header)
+	}
+
+	// Control frames go before stream data
+	packer.OmitVersion()
+	packer.QueueStreamFrame(&StreamFrame{StreamID: 5, Data: make([]byte, 200)})
+	packer.QueueControlFrame(&WindowUpdateFrame{StreamID: 5, ByteOffset: 0x10000})
+	packer.QueueControlFrame(&BlockedFrame{StreamID: 0})
+	p, err = packer.PackPacket(sealer)
+	if err != nil || !p.Retransmittable || len(p.Data) != 100 {
+		t.Fatalf("PacketPacker.PackPacket : invalid packet (%v)", err)
+	}
+	_, frames := unpackTestPacket(t, p.Data, 12)
+	if len(frames) != 3 {
+		t.Fatalf("PacketPacker.PackPacket : 3 frames expected instead of %v", len(frames))
+	}
+	if _, ok := frames[0].(*WindowUpdateFrame); !ok {
+		t.Errorf("PacketPacker.PackPacket : WINDOW_UPDATE frame expected first instead of %T", frames[0])
+	}
+	if _, ok := frames[1].(*BlockedFrame); !ok {
+		t.Errorf("PacketPacker.PackPacket : BLOCKED frame expected second instead of %T", frames[1])
+	}
+	if sf, ok := frames[2].(*StreamFrame); !ok || sf.Offset != 0 || len(sf.Data) != 100-3-12-13-5-2 {
+		t.Errorf("PacketPacker.PackPacket : split STREAM frame expected last instead of %+v", frames[2])
+	}
+
+	// A control frame larger than a packet
+	packer.QueueControlFrame(&ConnectionCloseFrame{ReasonPhrase: string(make([]byte, 100))})
+	if _, err = packer.PackPacket(sealer); err != ErrFrameTooLarge {
+		t.Errorf("PacketPacker.PackPacket : ErrFrameTooLarge expected instead of %v", err)
+	}
+}
+
+func Test_PacketPacker_Empty(t *testing.T) {
+	packer := NewPacketPacker(0x42, 8, 1350)
+	if p, err := packer.PackPacket(&testSealer{macSize: 12}); p != nil || err != nil {
+		t.Errorf("PacketPacker.PackPacket : no packet expected instead of %+v (%v)", p, err)
+	}
+}
+
+func Test_PacketPacker_AckFrame(t *testing.T) {
+	sealer := &testSealer{macSize: 12}
+	packer := NewPacketPacker(0x42, 8, 1350)
+
+	// The ACK frame is packed alone, with the STOP_WAITING frame of the packet
+	packer.QueueStreamFrame(&StreamFrame{StreamID: 5, Data: make([]byte, 100)})
+	packer.QueueAckFrame(&AckFrame{LargestAcked: 3, Ranges: []AckRange{{1, 3}}}, 1)
+	p, err := packer.PackAckPacket(sealer)
+	if err != nil || p.Retransmittable || len(p.Frames) != 2 {
+		t.Fatalf("PacketPacker.PackAckPacket : invalid ACK only packet %+v (%v)", p, err)
+	}
+	header, frames := unpackTestPacket(t, p.Data, 12)
+	sw, ok := frames[1].(*StopWaitingFrame)
+	if _, isAck := frames[0].(*AckFrame); !isAck || !ok || sw.GetLeastUnacked(header.GetSequenceNumber()) != 1 {
+		t.Errorf("PacketPacker.PackAckPacket : ACK and STOP_WAITING frames expected instead of %+v", frames)
+	}
+	if p, err = packer.PackAckPacket(sealer); p != nil || err != nil {
+		t.Errorf("PacketPacker.PackAckPacket : no packet expected instead of %+v (%v)", p, err)
+	}
+
+	// The ACK frame goes before the stream data, and the last queued ACK frame is sent
+	packer.QueueAckFrame(&AckFrame{LargestAcked: 4, Ranges: []AckRange{{1, 4}}}, 2)
+	packer.QueueAckFrame(&AckFrame{LargestAcked: 5, Ranges: []AckRange{{1, 5}}}, 2)
+	p, err = packer.PackPacket(sealer)
+	if err != nil || !p.Retransmittable || len(p.Frames) != 3 {
+		t.Fatalf("PacketPacker.PackPacket : invalid packet %+v (%v)", p, err)
+	}
+	header, frames = unpackTestPacket(t, p.Data, 12)
+	if ack, ok := frames[0].(*AckFrame); !ok || ack.LargestAcked != 5 {
+		t.Errorf("PacketPacker.PackPacket : last ACK frame expected first instead of %+v", frames[0])
+	}
+	if sw, ok := frames[1].(*StopWaitingFrame); !ok || sw.GetLeastUnacked(header.GetSequenceNumber()) != 2 {
+		t.Errorf("PacketPacker.PackPacket : STOP_WAITING frame expected second instead of %+v", frames[1])
+	}
+	if sf, ok := frames[2].(*StreamFrame); !ok || len(sf.Data) != 100 {
+		t.Errorf("PacketPacker.PackPacket : STREAM frame expected last instead of %+v", frames[2])
+	}
+}
+
+func Test_PacketPacker_CryptoFrames(t *testing.T) {
+	sealer := &testSealer{macSize: 12}
+	cryptoSealer := &testSealer{macSize: 12, key: 0x55}
+	packer := NewPacketPacker(0x42, 8, 1350)
+	packer.SetEncryptionLevels(ENCRYPTION_INITIAL, ENCRYPTION_UNENCRYPTED)
+
+	// The crypto stream data alone is not packed by PackPacket
+	packer.QueueStreamFrame(&StreamFrame{StreamID: 1, Data: make([]byte, 2000)})
+	if p, err := packer.PackPacket(sealer); p != nil || err != nil || packer.HasPendingFrames() || !packer.HasPendingCryptoFrames() {
+		t.Fatalf("PacketPacker.PackPacket : no packet expected instead of %+v (%v)", p, err)
+	}
+
+	// The crypto packets carry neither ACK, control frames nor other stream data
+	packer.QueueAckFrame(&AckFrame{LargestAcked: 3, Ranges: []AckRange{{1, 3}}}, 1)
+	packer.QueueControlFrame(&PingFrame{})
+	packer.QueueStreamFrame(&StreamFrame{StreamID: 5, Data: make([]byte, 100)})
+	var length int
+	for i := 0; packer.HasPendingCryptoFrames(); i++ {
+		p, err := packer.PackCryptoPacket(cryptoSealer)
+		if err != nil || !p.Retransmittable || p.EncryptionLevel != ENCRYPTION_UNENCRYPTED {
+			t.Fatalf("PacketPacker.PackCryptoPacket : invalid packet %+v (%v) in test n°%v", p, err, i)
+		}
+		_, frames := unpackTestPacket(t, p.Data, 12)
+		if p.Data[len(p.Data)-1] != byte(p.SequenceNumber)^0x55 {
+			t.Errorf("PacketPacker.PackCryptoPacket : packet not sealed by the crypto sealer in test n°%v", i)
+		}
+		for _, f := range frames {
+			sf, ok := f.(*StreamFrame)
+			if !ok || sf.StreamID != 1 {
+				t.Fatalf("PacketPacker.PackCryptoPacket : crypto STREAM frame expected instead of %+v in test n°%v", f, i)
+			}
+			length += len(sf.Data)
+		}
+	}
+	if length != 2000 {
+		t.Errorf("PacketPacker.PackCryptoPacket : 2000 bytes expected instead of %v", length)
+	}
+	if p, err := packer.PackCryptoPacket(cryptoSealer); p != nil || err != nil {
+		t.Errorf("PacketPacker.PackCryptoPacket : no packet expected instead of %+v (%v)", p, err)
+	}
+	p, err := packer.PackPacket(sealer)
+	if err != nil || len(p.Frames) != 4 || p.EncryptionLevel != ENCRYPTION_INITIAL {
+		t.Errorf("PacketPacker.PackPacket : ACK, STOP_WAITING, PING and STREAM frames at the initial level expected instead of %+v (%v)", p, err)
+	}
+}
+
+func Test_PacketPacker_MTUProbePacket(t *testing.T) {
+	sealer := &testSealer{macSize: 12}
+	packer := NewPacketPacker(0x42, 8, 1350)
+	packer.QueueAckFrame(&AckFrame{LargestAcked: 3, Ranges: []AckRange{{1, 3}}}, 1)
+	packer.QueueStreamFrame(&StreamFrame{StreamID: 5, Data: make([]byte, 100)})
+
+	// A padded PING larger than the maximum packet size, the pending frames wait for the next packet
+	var tests_probe = []int{1280, 1400, 1500}
+	for i, size := range tests_probe {
+		p, err := packer.PackMTUProbePacket(sealer, size)
+		if err != nil || len(p.Data) != size || !p.Retransmittable || !p.MTUProbe {
+			t.Fatalf("PacketPacker.PackMTUProbePacket : packet of %v bytes expected instead of %+v (%v) in test n°%v", size, p, err, i)
+		}
+		_, frames := unpackTestPacket(t, p.Data, 12)
+		if _, ok := frames[0].(*PingFrame); !ok || len(frames) != 1 {
+			t.Errorf("PacketPacker.PackMTUProbePacket : PING frame alone expected instead of %+v in test n°%v", frames, i)
+		}
+	}
+	p, err := packer.PackPacket(sealer)
+	if err != nil || len(p.Frames) != 3 || len(p.Data) > 1350 || p.MTUProbe {
+		t.Errorf("PacketPacker.PackPacket : ACK, STOP_WAITING and STREAM frames expected instead of %+v (%v)", p, err)
+	}
+}
+
+func Test_PacketPacker_ConnectionIDSize(t *testing.T) {
+	sealer := &testSealer{macSize: 12}
+	packer := NewPacketPacker(0x0102030405060708, 8, 1350)
+
+	// The truncated Connection ID saves its 8 bytes in the next packets
+	var sizes []int
+	for i, size := range []int{8, 0} {
+		packer.SetConnectionIDSize(size)
+		packer.QueueControlFrame(&PingFrame{})
+		p, err := packer.PackPacket(sealer)
+		if err != nil {
+			t.Fatalf("PacketPacker.PackPacket : unexpected error %v in test n°%v", err, i)
+		}
+		header, frames := unpackTestPacket(t, p.Data, 12)
+		if header.GetConnectionIdSize() != size || header.IsConnectionIDOmitted() != (size == 0) || len(frames) != 1 {
+			t.Errorf("PacketPacker.PackPacket : Connection ID of %v bytes expected instead of %v in test n°%v", size, header.GetConnectionIdSize(), i)
+		}
+		sizes = append(sizes, len(p.Data))
+	}
+	if sizes[0]-sizes[1] != 8 {
+		t.Errorf("PacketPacker.PackPacket : packet 8 bytes smaller expected instead of %v then %v bytes", sizes[0], sizes[1])
+	}
+}
@@ -0,0 +1,239 @@
+package protocol
+
+import "github.com/romain-jacotin/quic/internal/bufferpool"
+import "errors"
+import "io"
+
+// PacketOpener removes the protection of the packets, the crypto.AEAD interface implements it.
+type PacketOpener interface {
+	// Open authenticates the ciphertext and the aad, and writes the decrypted plaintext
+	Open(seqnum QuicPacketSequenceNumber, plaintext, aad, ciphertext []byte) (int, error)
+	// GetMacSize returns the size of the MAC appended to the ciphertext
+	GetMacSize() int
+}
+
+// DiversifiableOpener is the opener of the initial keys of the server on the client, until the diversification nonce
+// of the server is received in the public header of its initial packets.
+type DiversifiableOpener interface {
+	PacketOpener
+	// Diversify returns the opener of the keys diversified with the nonce
+	Diversify(nonce []byte) (PacketOpener, error)
+}
+
+// EncryptionLevel is the protection of a packet during the crypto handshake.
+type EncryptionLevel int
+
+const (
+	// ENCRYPTION_UNENCRYPTED packets are only protected by the FNV1A-128 hash of the null AEAD
+	ENCRYPTION_UNENCRYPTED EncryptionLevel = 0
+	// ENCRYPTION_INITIAL packets are protected with the initial keys, derived before the server hello
+	ENCRYPTION_INITIAL EncryptionLevel = 1
+	// ENCRYPTION_FORWARD_SECURE packets are protected with the forward-secure keys
+	ENCRYPTION_FORWARD_SECURE EncryptionLevel = 2
+)
+
+// String returns "unencrypted", "initial" or "forward-secure".
+func (this EncryptionLevel) String() string {
+	switch this {
+	case ENCRYPTION_UNENCRYPTED:
+		return "unencrypted"
+	case ENCRYPTION_INITIAL:
+		return "initial"
+	case ENCRYPTION_FORWARD_SECURE:
+		return "forward-secure"
+	}
+	return "unknown"
+}
+
+// ErrDecryptionFailed is returned by Unpack when no key of the handshake state can open the packet.
+var ErrDecryptionFailed = errors.New("PacketUnpacker.Unpack : packet decryption failed")
+
+// ErrDuplicatePacket is returned by Unpack for a packet already received, it is not opened.
+var ErrDuplicatePacket = errors.New("PacketUnpacker.Unpack : duplicate packet")
+
+// ErrUnauthenticatedFrame is returned by Unpack instead of the ErrInvalidFrame of an unencrypted packet: the null AEAD doesn't
+// authenticate the packet, anybody on the path can forge it.
+var ErrUnauthenticatedFrame = errors.New("PacketUnpacker.Unpack : invalid frame in an unencrypted packet")
+
+// MAX_TRAILING_BYTES is the number of bytes after the payload of a packet tolerated by Unpack, as added by some middleboxes.
+const MAX_TRAILING_BYTES = 16
+
+// ReceivedPackets remembers the packets received, the ackhandler.ReceivedPacketTracker implements it.
+type ReceivedPackets interface {
+	// IsDuplicate returns true if the packet has already been received, or is too old to tell
+	IsDuplicate(seqnum QuicPacketSequenceNumber) bool
+}
+
+// UnpackedPacket is a received packet after the removal of its protection.
+//
+// The frames point into a pooled buffer: the data of the STREAM frames must be copied, or the buffer retained, before Release.
+type UnpackedPacket struct {
+	Header          *QuicPacketHeader
+	SequenceNumber  QuicPacketSequenceNumber
+	EncryptionLevel EncryptionLevel
+	Frames          []Frame
+	buffer          *bufferpool.Buffer
+}
+
+// GetBuffer returns the pooled buffer of the frames: an owner that keeps the data of a frame after Release retains the buffer.
+func (this *UnpackedPacket) GetBuffer() *bufferpool.Buffer {
+	return this.buffer
+}
+
+// Release releases the buffer of the frames once the packet is processed, the frames can't be used anymore.
+func (this *UnpackedPacket) Release() {
+	this.buffer.Release()
+	this.buffer = nil
+	this.Frames = nil
+}
+
+// PacketUnpacker opens the received packets with the keys of the handshake state, and parses their frames.
+//
+// A packet is opened with the newest key, and with the previous key if it fails: packets protected with the previous key
+// can still be received during a transition. The receiver state only advances when a packet is opened successfully.
+//
+// A DiversifiableOpener is replaced by its diversified opener once it opens a packet with the diversification nonce of its header,
+// the packets without nonce can't be opened before.
+//
+// The packets already received are dropped before they are opened: even those of the null AEAD, that anybody can forge,
+// can't be replayed.
+//
+// The openers replaced or discarded, and all the openers on Close, are closed when they implement io.Closer like the crypto.AEAD:
+// their key material is zeroed.
+type PacketUnpacker struct {
+	openers         [ENCRYPTION_FORWARD_SECURE + 1]PacketOpener
+	largestReceived QuicPacketSequenceNumber
+	received        ReceivedPackets
+}
+
+// NewPacketUnpacker returns a PacketUnpacker with the null AEAD opener of the unencrypted packets.
+func NewPacketUnpacker(null PacketOpener) *PacketUnpacker {
+	unpacker := new(PacketUnpacker)
+	unpacker.openers[ENCRYPTION_UNENCRYPTED] = null
+	return unpacker
+}
+
+// SetOpener installs the opener of the encryption level when its keys are available, the previous opener of the level is closed.
+func (this *PacketUnpacker) SetOpener(level EncryptionLevel, opener PacketOpener) {
+	if this.openers[level] != opener {
+		closeOpener(this.openers[level])
+	}
+	this.openers[level] = opener
+}
+
+// Close closes the openers of all the encryption levels, no packet can be opened anymore.
+func (this *PacketUnpacker) Close() {
+	for level, opener := range this.openers {
+		closeOpener(opener)
+		this.openers[level] = nil
+	}
+}
+
+// closeOpener zeroes the key material of the opener, if it has any.
+func closeOpener(opener PacketOpener) {
+	if c, ok := opener.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// SetReceivedPackets drops the packets already received in the ReceivedPackets.
+func (this *PacketUnpacker) SetReceivedPackets(received ReceivedPackets) {
+	this.received = received
+}
+
+// GetLargestReceived returns the largest sequence number of the packets opened successfully.
+func (this *PacketUnpacker) GetLargestReceived() QuicPacketSequenceNumber {
+	return this.largestReceived
+}
+
+// Unpack parses the public header of the datagram, opens the payload and returns the frames.
+//
+// The public header of gQUIC has no payload length: the payload runs to the end of the datagram. The aad is exactly the parsed
+// header, and a payload that fails to open is opened again without its last bytes, up to MAX_TRAILING_BYTES: the payload
+// of a packet followed by trailing bytes is the longest one that authenticates. A datagram that can't be opened costs up to
+// MAX_TRAILING_BYTES + 1 attempts per key.
+//
+// Public Reset and version negotiation packets are not handled by Unpack.
+func (this *PacketUnpacker) Unpack(b []byte) (*UnpackedPacket, error) {
+	header, size, err := ParsePublicHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	if header.GetPublicResetFlag() {
+		return nil, errors.New("PacketUnpacker.Unpack : Public Reset packet")
+	}
+	seqnum := InferSequenceNumber(uint64(header.GetSequenceNumber()), header.GetSequenceNumberSize(), this.largestReceived)
+	if this.received != nil && this.received.IsDuplicate(seqnum) {
+		return nil, ErrDuplicatePacket
+	}
+
+	plaintext := bufferpool.GetBuffer(len(b) - size)
+	level, n, err := this.openPayload(header, seqnum, plaintext.Data, b[:size], b[size:])
+	for trailing := 1; err != nil && trailing <= MAX_TRAILING_BYTES && len(b)-trailing > size; trailing++ {
+		level, n, err = this.openPayload(header, seqnum, plaintext.Data, b[:size], b[size:len(b)-trailing])
+	}
+	if err != nil {
+		plaintext.Release()
+		return nil, ErrDecryptionFailed
+	}
+
+	header.SetSequenceNumber(seqnum)
+	frames, err := ParseFrames(plaintext.Data[:n], header)
+	if err != nil {
+		plaintext.Release()
+		if _, ok := err.(ErrInvalidFrame); ok && level == ENCRYPTION_UNENCRYPTED {
+			return nil, ErrUnauthenticatedFrame
+		}
+		return nil, err
+	}
+	if seqnum > this.largestReceived {
+		this.largestReceived = seqnum
+	}
+	return &UnpackedPacket{Header: header, SequenceNumber: seqnum, EncryptionLevel: level, Frames: frames, buffer: plaintext}, nil
+}
+
+// openPayload opens the payload with the newest key, then falls back to the previous key once. It returns the encryption level
+// of the key that opens it.
+func (this *PacketUnpacker) openPayload(header *QuicPacketHeader, seqnum QuicPacketSequenceNumber,
+	plaintext, aad, ciphertext []byte) (EncryptionLevel, int, error) {
+	level := ENCRYPTION_FORWARD_SECURE
+	for level > ENCRYPTION_UNENCRYPTED && this.openers[level] == nil {
+		level--
+	}
+	n, err := this.open(level, header, seqnum, plaintext, aad, ciphertext)
+	if err != nil && level > ENCRYPTION_UNENCRYPTED && this.openers[level-1] != nil {
+		level--
+		n, err = this.open(level, header, seqnum, plaintext, aad, ciphertext)
+	}
+	return level, n, err
+}
+
+// open opens the packet with the opener of the encryption level, diversified with the nonce of the header if needed.
+func (this *PacketUnpacker) open(level EncryptionLevel, header *QuicPacketHeader, seqnum QuicPacketSequenceNumber,
+	plaintext, aad, ciphertext []byte) (int, error) {
+	opener := this.openers[level]
+	if opener == nil {
+		return 0, ErrDecryptionFailed
+	}
+	d, ok := opener.(DiversifiableOpener)
+	if !ok {
+		return opener.Open(seqnum, plaintext, aad, ciphertext)
+	}
+	nonce := header.GetDiversificationNonce()
+	if nonce == nil {
+		return 0, ErrDecryptionFailed
+	}
+	// A forged nonce must not replace the opener
+	diversified, err := d.Diversify(nonce)
+	if err != nil {
+		return 0, err
+	}
+	n, err := diversified.Open(seqnum, plaintext, aad, ciphertext)
+	if err != nil {
+		closeOpener(diversified)
+		return n, err
+	}
+	closeOpener(opener)
+	this.openers[level] = diversified
+	return n, err
+}
@@ -0,0 +1,286 @@
+package protocol
+
+import "bytes"
+import "errors"
+import "testing"
+import "reflect"
+
+// newTestUnpacker returns a PacketUnpacker with the test openers up to the encryption level.
+func newTestUnpacker(level EncryptionLevel) *PacketUnpacker {
+	unpacker := NewPacketUnpacker(&testSealer{macSize: 12})
+	for l := ENCRYPTION_INITIAL; l <= level; l++ {
+		unpacker.SetOpener(l, &testSealer{macSize: 12, key: byte(l)})
+	}
+	return unpacker
+}
+
+func Test_PacketUnpacker_Levels(t *testing.T) {
+	for level := ENCRYPTION_UNENCRYPTED; level <= ENCRYPTION_FORWARD_SECURE; level++ {
+		packer := NewPacketPacker(0x0102030405060708, 8, 1350)
+		unpacker := newTestUnpacker(level)
+		sealer := &testSealer{macSize: 12, key: byte(level)}
+		for i := 1; i <= 300; i++ {
+			packer.QueueControlFrame(&PingFrame{})
+			packer.QueueStreamFrame(&StreamFrame{StreamID: 1, Offset: QuicByteOffset(i), Data: []byte{byte(i)}})
+			p, err := packer.PackPacket(sealer)
+			if err != nil {
+				t.Fatalf("PacketPacker.PackPacket : unexpected error %v at level %v", err, level)
+			}
+			u, err := unpacker.Unpack(p.Data)
+			if err != nil {
+				t.Fatalf("PacketUnpacker.Unpack : unexpected error %v for packet %v at level %v", err, i, level)
+			}
+			if u.SequenceNumber != p.SequenceNumber || u.EncryptionLevel != level || !reflect.DeepEqual(u.Frames, p.Frames) {
+				t.Errorf("PacketUnpacker.Unpack : invalid packet %v at level %v", u.SequenceNumber, level)
+			}
+		}
+		if unpacker.GetLargestReceived() != 300 {
+			t.Errorf("PacketUnpacker.GetLargestReceived : 300 expected instead of %v at level %v", unpacker.GetLargestReceived(), level)
+		}
+	}
+}
+
+func Test_PacketUnpacker_Fallback(t *testing.T) {
+	packer := NewPacketPacker(0x42, 8, 1350)
+	unpacker := newTestUnpacker(ENCRYPTION_FORWARD_SECURE)
+	pack := func(level EncryptionLevel) []byte {
+		packer.QueueControlFrame(&PingFrame{})
+		p, err := packer.PackPacket(&testSealer{macSize: 12, key: byte(level)})
+		if err != nil {
+			t.Fatalf("PacketPacker.PackPacket : unexpected error %v", err)
+		}
+		return p.Data
+	}
+
+	// Packets protected with the previous key during the transition
+	u, err := unpacker.Unpack(pack(ENCRYPTION_INITIAL))
+	if err != nil || u.EncryptionLevel != ENCRYPTION_INITIAL {
+		t.Errorf("PacketUnpacker.Unpack : initial packet expected (%v)", err)
+	}
+	u, err = unpacker.Unpack(pack(ENCRYPTION_FORWARD_SECURE))
+	if err != nil || u.EncryptionLevel != ENCRYPTION_FORWARD_SECURE || unpacker.GetLargestReceived() != 2 {
+		t.Errorf("PacketUnpacker.Unpack : forward-secure packet expected (%v)", err)
+	}
+
+	// Only one fallback: unencrypted packets are rejected with the forward-secure key, without advancing the receiver state
+	if _, err = unpacker.Unpack(pack(ENCRYPTION_UNENCRYPTED)); err != ErrDecryptionFailed {
+		t.Errorf("PacketUnpacker.Unpack : ErrDecryptionFailed expected instead of %v", err)
+	}
+	b := pack(ENCRYPTION_FORWARD_SECURE)
+	b[len(b)-1] ^= 0xff
+	if _, err = unpacker.Unpack(b); err != ErrDecryptionFailed {
+		t.Errorf("PacketUnpacker.Unpack : ErrDecryptionFailed expected instead of %v", err)
+	}
+	if unpacker.GetLargestReceived() != 2 {
+		t.Errorf("PacketUnpacker.Unpack : receiver state must not advance on failures, largest received %v", unpacker.GetLargestReceived())
+	}
+	if _, err = unpacker.Unpack(BuildPublicReset(0x42, 1, 2)); err == nil {
+		t.Error("PacketUnpacker.Unpack : Public Reset packet must be rejected")
+	}
+}
+
+func Test_PacketUnpacker_UnauthenticatedFrame(t *testing.T) {
+	packer := NewPacketPacker(0x42, 8, 1350)
+	packer.QueueControlFrame(&PingFrame{})
+	p, err := packer.PackPacket(&testSealer{macSize: 12})
+	if err != nil {
+		t.Fatalf("PacketPacker.PackPacket : unexpected error %v", err)
+	}
+	_, size, _ := ParsePublicHeader(p.Data)
+	p.Data[size] = 0x1f
+
+	// The malformed frame of an unencrypted packet is reported as forgeable, before and after the initial keys
+	for level := ENCRYPTION_UNENCRYPTED; level <= ENCRYPTION_INITIAL; level++ {
+		if _, err = newTestUnpacker(level).Unpack(p.Data); err != ErrUnauthenticatedFrame {
+			t.Errorf("PacketUnpacker.Unpack : ErrUnauthenticatedFrame expected instead of %v at level %v", err, level)
+		}
+	}
+
+	// The malformed frame of an authenticated packet stays a connection error
+	packer.QueueControlFrame(&PingFrame{})
+	if p, err = packer.PackPacket(&testSealer{macSize: 12, key: byte(ENCRYPTION_INITIAL)}); err != nil {
+		t.Fatalf("PacketPacker.PackPacket : unexpected error %v", err)
+	}
+	p.Data[size] = 0x1f
+	if _, err = newTestUnpacker(ENCRYPTION_INITIAL).Unpack(p.Data); !errors.As(err, new(ErrInvalidFrame)) {
+		t.Errorf("PacketUnpacker.Unpack : ErrInvalidFrame expected instead of %v", err)
+	}
+}
+
+func Test_PacketUnpacker_TrailingBytes(t *testing.T) {
+	for level := ENCRYPTION_UNENCRYPTED; level <= ENCRYPTION_FORWARD_SECURE; level++ {
+		packer := NewPacketPacker(0x42, 8, 1350)
+		unpacker := newTestUnpacker(level)
+		sealer := &testSealer{macSize: 12, key: byte(level)}
+
+		// The payload is the longest one that opens, up to MAX_TRAILING_BYTES trailing bytes
+		for trailing := 0; trailing <= MAX_TRAILING_BYTES+1; trailing++ {
+			packer.QueueStreamFrame(&StreamFrame{StreamID: 5, Data: []byte("trailing")})
+			p, err := packer.PackPacket(sealer)
+			if err != nil {
+				t.Fatalf("PacketPacker.PackPacket : unexpected error %v at level %v", err, level)
+			}
+			b := append(append([]byte(nil), p.Data...), bytes.Repeat([]byte{0xff}, trailing)...)
+			u, err := unpacker.Unpack(b)
+			if trailing > MAX_TRAILING_BYTES {
+				if err != ErrDecryptionFailed {
+					t.Errorf("PacketUnpacker.Unpack : ErrDecryptionFailed expected instead of %v for %v trailing bytes at level %v", err, trailing, level)
+				}
+				continue
+			}
+			if err != nil || u.EncryptionLevel != level || !reflect.DeepEqual(u.Frames, p.Frames) {
+				t.Errorf("PacketUnpacker.Unpack : packet expected instead of %v for %v trailing bytes at level %v", err, trailing, level)
+			}
+		}
+	}
+}
+
+// testDiversifiableOpener diversifies into a testSealer keyed with the first byte of the nonce.
+type testDiversifiableOpener struct {
+	testSealer
+}
+
+func (this *testDiversifiableOpener) Open(seqnum QuicPacketSequenceNumber, plaintext, aad, ciphertext []byte) (int, error) {
+	return 0, ErrDecryptionFailed
+}
+
+func (this *testDiversifiableOpener) Diversify(nonce []byte) (PacketOpener, error) {
+	return &testSealer{macSize: this.macSize, key: nonce[0]}, nil
+}
+
+func Test_PacketUnpacker_DiversificationNonce(t *testing.T) {
+	nonce := make([]byte, QUIC_DIVERSIFICATION_NONCE_SIZE)
+	nonce[0] = 0x42
+	forged := make([]byte, QUIC_DIVERSIFICATION_NONCE_SIZE)
+	forged[0] = 0x43
+	sealer := &testSealer{macSize: 12, key: 0x42}
+	pack := func(nonce []byte, level EncryptionLevel) []byte {
+		packer := NewPacketPacker(0x42, 8, 1350)
+		packer.SetDiversificationNonce(nonce)
+		packer.SetEncryptionLevels(level, level)
+		packer.QueueControlFrame(&PingFrame{})
+		p, err := packer.PackPacket(sealer)
+		if err != nil {
+			t.Fatalf("PacketPacker.PackPacket : unexpected error %v", err)
+		}
+		return p.Data
+	}
+
+	// Only the initial packets carry the nonce
+	if h, _ := unpackTestPacket(t, pack(nonce, ENCRYPTION_INITIAL), 12); !reflect.DeepEqual(h.GetDiversificationNonce(), nonce) {
+		t.Errorf("PacketPacker.PackPacket : diversification nonce expected in the initial packets")
+	}
+	if h, _ := unpackTestPacket(t, pack(nonce, ENCRYPTION_FORWARD_SECURE), 12); h.GetDiversificationNonce() != nil {
+		t.Errorf("PacketPacker.PackPacket : no diversification nonce expected in the forward-secure packets")
+	}
+
+	// The packets without nonce or with a forged nonce can't be opened, the opener is diversified by the first valid nonce
+	unpacker := NewPacketUnpacker(&testSealer{macSize: 12})
+	unpacker.SetOpener(ENCRYPTION_INITIAL, &testDiversifiableOpener{testSealer{macSize: 12}})
+	var tests_nonce = []struct {
+		nonce []byte
+		valid bool
+	}{
+		{nil, false},
+		{forged, false},
+		{nonce, true},
+		{nil, true},
+	}
+	for i, v := range tests_nonce {
+		b := pack(v.nonce, ENCRYPTION_INITIAL)
+		if v.nonce != nil {
+			// The forged nonce doesn't change the protection of the packet
+			copy(b[9:], v.nonce)
+		}
+		u, err := unpacker.Unpack(b)
+		if v.valid && (err != nil || u.EncryptionLevel != ENCRYPTION_INITIAL) {
+			t.Errorf("PacketUnpacker.Unpack : unexpected error %v in test n°%v", err, i)
+		}
+		if !v.valid && err != ErrDecryptionFailed {
+			t.Errorf("PacketUnpacker.Unpack : ErrDecryptionFailed expected instead of %v in test n°%v", err, i)
+		}
+	}
+}
+
+// testClosingOpener is a testSealer counting the calls of Close.
+type testClosingOpener struct {
+	testSealer
+	closed int
+}
+
+func (this *testClosingOpener) Close() error {
+	this.closed++
+	return nil
+}
+
+func Test_PacketUnpacker_Close(t *testing.T) {
+	null := &testClosingOpener{testSealer: testSealer{macSize: 12}}
+	first := &testClosingOpener{testSealer: testSealer{macSize: 12, key: 1}}
+	second := &testClosingOpener{testSealer: testSealer{macSize: 12, key: 2}}
+	unpacker := NewPacketUnpacker(null)
+
+	// The replaced opener is closed, not the opener installed again
+	unpacker.SetOpener(ENCRYPTION_INITIAL, first)
+	unpacker.SetOpener(ENCRYPTION_INITIAL, first)
+	unpacker.SetOpener(ENCRYPTION_INITIAL, second)
+	if first.closed != 1 || second.closed != 0 || null.closed != 0 {
+		t.Errorf("PacketUnpacker.SetOpener : closed %v %v %v times instead of 1 0 0", first.closed, second.closed, null.closed)
+	}
+
+	// All the openers are closed once, no packet can be opened anymore
+	unpacker.Close()
+	unpacker.Close()
+	if first.closed != 1 || second.closed != 1 || null.closed != 1 {
+		t.Errorf("PacketUnpacker.Close : closed %v %v %v times instead of 1 1 1", first.closed, second.closed, null.closed)
+	}
+	packer := NewPacketPacker(0x42, 8, 1350)
+	packer.QueueControlFrame(&PingFrame{})
+	p, err := packer.PackPacket(&testSealer{macSize: 12})
+	if err != nil {
+		t.Fatalf("PacketPacker.PackPacket : unexpected error %v", err)
+	}
+	if _, err = unpacker.Unpack(p.Data); err != ErrDecryptionFailed {
+		t.Errorf("PacketUnpacker.Unpack : ErrDecryptionFailed expected instead of %v", err)
+	}
+}
+
+// testReceivedPackets are the sequence numbers of the packets received.
+type testReceivedPackets map[QuicPacketSequenceNumber]bool
+
+func (this testReceivedPackets) IsDuplicate(seqnum QuicPacketSequenceNumber) bool {
+	return this[seqnum]
+}
+
+func Test_PacketUnpacker_ReceivedPackets(t *testing.T) {
+	packer := NewPacketPacker(0x42, 8, 1350)
+	unpacker := NewPacketUnpacker(&testSealer{macSize: 12})
+	received := testReceivedPackets{}
+	unpacker.SetReceivedPackets(received)
+
+	// A replayed packet of the null AEAD is dropped before it is opened
+	var packets [][]byte
+	for i := 0; i < 3; i++ {
+		packer.QueueStreamFrame(&StreamFrame{StreamID: 5, Offset: QuicByteOffset(i), Data: []byte{byte(i)}})
+		p, err := packer.PackPacket(&testSealer{macSize: 12})
+		if err != nil {
+			t.Fatalf("PacketPacker.PackPacket : unexpected error %v", err)
+		}
+		packets = append(packets, p.Data)
+	}
+	for i, b := range packets[:2] {
+		u, err := unpacker.Unpack(b)
+		if err != nil {
+			t.Fatalf("PacketUnpacker.Unpack : unexpected error %v in test n°%v", err, i)
+		}
+		received[u.SequenceNumber] = true
+		u.Release()
+	}
+	for i, b := range packets[:2] {
+		if u, err := unpacker.Unpack(b); err != ErrDuplicatePacket || u != nil {
+			t.Errorf("PacketUnpacker.Unpack : ErrDuplicatePacket expected instead of %v in test n°%v", err, i)
+		}
+	}
+	if u, err := unpacker.Unpack(packets[2]); err != nil || u.SequenceNumber != 3 {
+		t.Errorf("PacketUnpacker.Unpack : packet 3 expected instead of %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package protocol
+
+// Perspective tells if an endpoint is the client or the server of the connection.
+type Perspective int
+
+const (
+	PERSPECTIVE_SERVER Perspective = 1
+	PERSPECTIVE_CLIENT Perspective = 2
+)
+
+// Opposite returns the perspective of the peer.
+func (this Perspective) Opposite() Perspective {
+	if this == PERSPECTIVE_CLIENT {
+		return PERSPECTIVE_SERVER
+	}
+	return PERSPECTIVE_CLIENT
+}
+
+// String returns "client" or "server".
+func (this Perspective) String() string {
+	switch this {
+	case PERSPECTIVE_CLIENT:
+		return "client"
+	case PERSPECTIVE_SERVER:
+		return "server"
+	}
+	return "invalid perspective"
+}
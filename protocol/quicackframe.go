@@ -0,0 +1,351 @@
+package protocol
+
+import "errors"
+import "sort"
+import "time"
+
+/*
+
+ACK Frame:
+
++--------+--------+--- ---+--------+--------+--------+--------+--------+--- ---+--------+
+|Type (8)| Largest Acked (8-48)  | Ack Delay (16)  |Blocks(8)| First Ack Block Length   |
+|        |                       | (ufloat16, us)  | (opt)   |      (8, 16, 32 or 48)   |
++--------+--------+--- ---+--------+--------+--------+--------+--------+--- ---+--------+
+
++--------+--------+--- ---+--------+         +--------+--------+--------+--------+--------+--------+--- ---+
+|Gap (8) | Ack Block Length (8-48) |  ...    |NumTs(8)|Delta(8)| Time Since Largest Acked (32, us)|   ...    |
++--------+--------+--- ---+--------+         +--------+--------+--------+--------+--------+--------+--- ---+
+
+Frame type:
++---+---+---+---+---+---+---+---+
+| 0 | 1 | N | 0 |LargLen|BlkLen |
++---+---+---+---+---+---+---+---+
+
+The ACK ranges are encoded from the largest to the smallest: the first block ends at the Largest Acked, then each block
+starts Gap missing packets before the previous one. A gap greater than 255 is split in several blocks of length 0.
+
+*/
+
+const (
+	// ACK FRAME mask and flag for multiple ACK blocks, the reserved flag must be 0
+	QUICFLAG_ACK_MULTIPLEBLOCKS = 0x20
+	QUICFLAG_ACK_RESERVED       = 0x10
+	// Maximum number of ACK blocks and timestamps in an ACK frame
+	ACKFRAME_MAX_BLOCKS     = 255
+	ACKFRAME_MAX_TIMESTAMPS = 255
+)
+
+// AckRange is a range of contiguous acknowledged sequence numbers.
+type AckRange struct {
+	Smallest QuicPacketSequenceNumber
+	Largest  QuicPacketSequenceNumber
+}
+
+// AckTimestamp is the reception time of an acknowledged packet, relative to the start of the connection.
+type AckTimestamp struct {
+	SequenceNumber QuicPacketSequenceNumber
+	Received       time.Duration
+}
+
+// AckFrame is an ACK frame.
+//
+// Ranges are sorted in descending order without overlap, and the first range ends at LargestAcked.
+type AckFrame struct {
+	LargestAcked QuicPacketSequenceNumber
+	AckDelay     time.Duration
+	Ranges       []AckRange
+	Timestamps   []AckTimestamp
+}
+
+// BuildAckFrame returns the ACK frame of the received sequence numbers, or nil if no sequence number is received.
+//
+// The received sequence numbers can be unordered and duplicated, contiguous sequence numbers are coalesced in ranges.
+func BuildAckFrame(received []QuicPacketSequenceNumber, delay time.Duration) *AckFrame {
+	if len(received) == 0 {
+		return nil
+	}
+	seqnums := make([]QuicPacketSequenceNumber, len(received))
+	copy(seqnums, received)
+	sort.Slice(seqnums, func(i, j int) bool { return seqnums[i] > seqnums[j] })
+
+	f := &AckFrame{LargestAcked: seqnums[0], AckDelay: delay}
+	r := AckRange{Smallest: seqnums[0], Largest: seqnums[0]}
+	for _, seqnum := range seqnums[1:] {
+		switch {
+		case seqnum == r.Smallest:
+			// duplicate
+		case seqnum == r.Smallest-1:
+			r.Smallest = seqnum
+		default:
+			f.Ranges = append(f.Ranges, r)
+			r = AckRange{Smallest: seqnum, Largest: seqnum}
+		}
+	}
+	f.Ranges = append(f.Ranges, r)
+	return f
+}
+
+// AcksPacket returns true if the sequence number is acknowledged by the frame.
+func (this *AckFrame) AcksPacket(pn QuicPacketSequenceNumber) bool {
+	// Ranges are in descending order: find the first range with Smallest <= pn
+	i := sort.Search(len(this.Ranges), func(i int) bool { return this.Ranges[i].Smallest <= pn })
+	return i < len(this.Ranges) && pn <= this.Ranges[i].Largest
+}
+
+// ParseAckFrame parses the ACK frame at the start of the data, and returns it with the number of bytes consumed.
+func ParseAckFrame(b []byte) (*AckFrame, int, error) {
+	var size, numBlocks int
+	var v uint64
+
+	if len(b) < 1 {
+		return nil, 0, ErrTruncatedFrame
+	}
+	ft := b[0]
+	if (ft & QUICFRAMETYPE_ACK_MASK) != QUICFRAMETYPE_ACK {
+		return nil, 0, ErrInvalidFrameType
+	}
+	if (ft & QUICFLAG_ACK_RESERVED) != 0 {
+		return nil, 0, errors.New("ParseAckFrame : reserved flag set")
+	}
+	largestSize := int(parseLargestObservedSize[ft&0x0f])
+	blockSize := int(parseMissingPacketSequenceNumberDeltaSize[ft&0x0f])
+	multipleBlocks := (ft & QUICFLAG_ACK_MULTIPLEBLOCKS) == QUICFLAG_ACK_MULTIPLEBLOCKS
+
+	// Largest Acked, Ack Delay, Num Blocks and First Ack Block Length
+	size = 1 + largestSize + 2 + blockSize
+	if multipleBlocks {
+		size++
+	}
+	if len(b) < size {
+		return nil, 0, ErrTruncatedFrame
+	}
+	f := new(AckFrame)
+	size = 1
+	f.LargestAcked = QuicPacketSequenceNumber(readLittleEndian(b[size:], largestSize))
+	size += largestSize
+	f.AckDelay = time.Duration(Float16Decode(uint16(b[size])|uint16(b[size+1])<<8)) * time.Microsecond
+	size += 2
+	if multipleBlocks {
+		numBlocks = int(b[size])
+		size++
+	}
+	v = readLittleEndian(b[size:], blockSize)
+	size += blockSize
+	if v == 0 || v > uint64(f.LargestAcked)+1 {
+		return nil, 0, errors.New("ParseAckFrame : invalid first ACK block length")
+	}
+	smallest := f.LargestAcked + 1 - QuicPacketSequenceNumber(v)
+	f.Ranges = append(f.Ranges, AckRange{Smallest: smallest, Largest: f.LargestAcked})
+
+	// Additional ACK blocks
+	if len(b) < size+numBlocks*(1+blockSize)+1 {
+		return nil, 0, ErrTruncatedFrame
+	}
+	for i := 0; i < numBlocks; i++ {
+		gap := QuicPacketSequenceNumber(b[size])
+		size++
+		v = readLittleEndian(b[size:], blockSize)
+		size += blockSize
+		if uint64(smallest) < uint64(gap)+v {
+			return nil, 0, errors.New("ParseAckFrame : ACK block below sequence number 0")
+		}
+		smallest -= gap + QuicPacketSequenceNumber(v)
+		if v > 0 {
+			f.Ranges = append(f.Ranges, AckRange{Smallest: smallest, Largest: smallest + QuicPacketSequenceNumber(v) - 1})
+		}
+	}
+
+	// Timestamps
+	numTimestamps := int(b[size])
+	size++
+	if numTimestamps > 0 {
+		if len(b) < size+5+(numTimestamps-1)*3 {
+			return nil, 0, ErrTruncatedFrame
+		}
+		var received time.Duration
+		for i := 0; i < numTimestamps; i++ {
+			delta := QuicPacketSequenceNumber(b[size])
+			size++
+			if i == 0 {
+				received = time.Duration(readLittleEndian(b[size:], 4)) * time.Microsecond
+				size += 4
+			} else {
+				received += time.Duration(Float16Decode(uint16(b[size])|uint16(b[size+1])<<8)) * time.Microsecond
+				size += 2
+			}
+			if delta > f.LargestAcked {
+				return nil, 0, errors.New("ParseAckFrame : timestamp below sequence number 0")
+			}
+			f.Timestamps = append(f.Timestamps, AckTimestamp{SequenceNumber: f.LargestAcked - delta, Received: received})
+		}
+	}
+	return f, size, nil
+}
+
+// ackBlock is an encoded ACK block: the gap before the block and its length.
+type ackBlock struct {
+	gap    byte
+	length uint64
+}
+
+// blocks returns the encoded ACK blocks after the first one, splitting the gaps greater than 255 and keeping at most ACKFRAME_MAX_BLOCKS blocks.
+func (this *AckFrame) blocks() (blocks []ackBlock) {
+	for i := 1; i < len(this.Ranges); i++ {
+		gap := uint64(this.Ranges[i-1].Smallest - this.Ranges[i].Largest - 1)
+		n := len(blocks)
+		for ; gap > 255 && len(blocks) < ACKFRAME_MAX_BLOCKS; gap -= 255 {
+			blocks = append(blocks, ackBlock{gap: 255})
+		}
+		if len(blocks) == ACKFRAME_MAX_BLOCKS {
+			// No room left for this range, the smallest ranges are not acknowledged
+			return blocks[:n]
+		}
+		blocks = append(blocks, ackBlock{gap: byte(gap), length: uint64(this.Ranges[i].Largest-this.Ranges[i].Smallest) + 1})
+	}
+	return
+}
+
+// timestamps returns the timestamps that can be encoded: at most ACKFRAME_MAX_TIMESTAMPS, at most 255 packets below the Largest Acked.
+func (this *AckFrame) timestamps() (timestamps []AckTimestamp) {
+	for _, t := range this.Timestamps {
+		if t.SequenceNumber <= this.LargestAcked && this.LargestAcked-t.SequenceNumber <= 255 && len(timestamps) < ACKFRAME_MAX_TIMESTAMPS {
+			timestamps = append(timestamps, t)
+		}
+	}
+	return
+}
+
+// sizes returns the byte sizes of the Largest Acked and Ack Block Length fields.
+func (this *AckFrame) sizes(blocks []ackBlock) (largestSize, blockSize int) {
+	largestSize = seqnumByteSize(uint64(this.LargestAcked))
+	max := uint64(this.Ranges[0].Largest-this.Ranges[0].Smallest) + 1
+	for _, b := range blocks {
+		if b.length > max {
+			max = b.length
+		}
+	}
+	blockSize = seqnumByteSize(max)
+	return
+}
+
+// GetSerializedSize returns the size of the serialized frame.
+func (this *AckFrame) GetSerializedSize() int {
+	if len(this.Ranges) == 0 {
+		return 0
+	}
+	blocks := this.blocks()
+	largestSize, blockSize := this.sizes(blocks)
+	size := 1 + largestSize + 2 + blockSize + len(blocks)*(1+blockSize) + 1
+	if len(blocks) > 0 {
+		size++
+	}
+	if n := len(this.timestamps()); n > 0 {
+		size += 5 + (n-1)*3
+	}
+	return size
+}
+
+// Write serializes the frame at the start of the data and returns the number of bytes written.
+func (this *AckFrame) Write(b []byte) (int, error) {
+	var size int
+
+	if len(this.Ranges) == 0 || this.Ranges[0].Largest != this.LargestAcked {
+		return 0, errors.New("AckFrame.Write : the first ACK range must end at the Largest Acked")
+	}
+	for i, r := range this.Ranges {
+		if r.Smallest > r.Largest || (i > 0 && r.Largest+1 >= this.Ranges[i-1].Smallest) {
+			return 0, errors.New("AckFrame.Write : ACK ranges must be sorted in descending order without overlap")
+		}
+	}
+	if len(b) < this.GetSerializedSize() {
+		return 0, errors.New("AckFrame.Write : data size too small to contain the serialized frame")
+	}
+	blocks := this.blocks()
+	timestamps := this.timestamps()
+	largestSize, blockSize := this.sizes(blocks)
+
+	// Frame type
+	b[0] = QUICFRAMETYPE_ACK | seqnumSizeFlag(largestSize)<<2 | seqnumSizeFlag(blockSize)
+	if len(blocks) > 0 {
+		b[0] |= QUICFLAG_ACK_MULTIPLEBLOCKS
+	}
+	size = 1
+	// Largest Acked and Ack Delay
+	writeLittleEndian(b[size:], uint64(this.LargestAcked), largestSize)
+	size += largestSize
+	delay := Float16Encode(uint64(this.AckDelay / time.Microsecond))
+	b[size] = byte(delay)
+	b[size+1] = byte(delay >> 8)
+	size += 2
+	// ACK blocks
+	if len(blocks) > 0 {
+		b[size] = byte(len(blocks))
+		size++
+	}
+	writeLittleEndian(b[size:], uint64(this.Ranges[0].Largest-this.Ranges[0].Smallest)+1, blockSize)
+	size += blockSize
+	for _, block := range blocks {
+		b[size] = block.gap
+		writeLittleEndian(b[size+1:], block.length, blockSize)
+		size += 1 + blockSize
+	}
+	// Timestamps
+	b[size] = byte(len(timestamps))
+	size++
+	for i, t := range timestamps {
+		b[size] = byte(this.LargestAcked - t.SequenceNumber)
+		size++
+		if i == 0 {
+			writeLittleEndian(b[size:], uint64(t.Received/time.Microsecond), 4)
+			size += 4
+		} else {
+			delta := Float16Encode(uint64((t.Received - timestamps[i-1].Received) / time.Microsecond))
+			b[size] = byte(delta)
+			b[size+1] = byte(delta >> 8)
+			size += 2
+		}
+	}
+	return size, nil
+}
+
+// seqnumByteSize returns the minimal size (1, 2, 4 or 6 bytes) of a sequence number field.
+func seqnumByteSize(v uint64) int {
+	switch {
+	case v < 1<<8:
+		return 1
+	case v < 1<<16:
+		return 2
+	case v < 1<<32:
+		return 4
+	}
+	return 6
+}
+
+// seqnumSizeFlag returns the 2 bits flag of a sequence number field size.
+func seqnumSizeFlag(size int) byte {
+	switch size {
+	case 1:
+		return 0
+	case 2:
+		return 1
+	case 4:
+		return 2
+	}
+	return 3
+}
+
+// readLittleEndian returns the Little Endian unsigned integer of the first n bytes.
+func readLittleEndian(b []byte, n int) (v uint64) {
+	for i := 0; i < n; i++ {
+		v |= uint64(b[i]) << uint(i<<3)
+	}
+	return
+}
+
+// writeLittleEndian writes the n low bytes of v in Little Endian order.
+func writeLittleEndian(b []byte, v uint64, n int) {
+	for i := 0; i < n; i++ {
+		b[i] = byte(v >> uint(i<<3))
+	}
+}
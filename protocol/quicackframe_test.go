@@ -0,0 +1,163 @@
+package protocol
+
+import "testing"
+import "bytes"
+import "reflect"
+import "time"
+
+var tests_buildackframe = []struct {
+	received []QuicPacketSequenceNumber
+	ranges   []AckRange
+}{
+	{[]QuicPacketSequenceNumber{1}, []AckRange{{1, 1}}},
+	{[]QuicPacketSequenceNumber{1, 2, 3, 4}, []AckRange{{1, 4}}},
+	// Reordered
+	{[]QuicPacketSequenceNumber{4, 2, 3, 1}, []AckRange{{1, 4}}},
+	{[]QuicPacketSequenceNumber{10, 1, 5, 2, 6, 9}, []AckRange{{9, 10}, {5, 6}, {1, 2}}},
+	// Duplicated
+	{[]QuicPacketSequenceNumber{3, 3, 1, 2, 2, 7, 7}, []AckRange{{7, 7}, {1, 3}}},
+	{[]QuicPacketSequenceNumber{0, 0, 0}, []AckRange{{0, 0}}},
+}
+
+func Test_BuildAckFrame(t *testing.T) {
+	for i, v := range tests_buildackframe {
+		f := BuildAckFrame(v.received, 5*time.Millisecond)
+		if f.LargestAcked != v.ranges[0].Largest || f.AckDelay != 5*time.Millisecond || !reflect.DeepEqual(f.Ranges, v.ranges) {
+			t.Errorf("BuildAckFrame : invalid frame %+v in test n°%v", f, i)
+		}
+		for _, seqnum := range v.received {
+			if !f.AcksPacket(seqnum) {
+				t.Errorf("AckFrame.AcksPacket : sequence number %v must be acknowledged in test n°%v", seqnum, i)
+			}
+		}
+	}
+	if BuildAckFrame(nil, 0) != nil {
+		t.Error("BuildAckFrame : nil frame expected without received packet")
+	}
+
+	f := BuildAckFrame([]QuicPacketSequenceNumber{10, 1, 5, 2, 6, 9}, 0)
+	for _, seqnum := range []QuicPacketSequenceNumber{0, 3, 4, 7, 8, 11} {
+		if f.AcksPacket(seqnum) {
+			t.Errorf("AckFrame.AcksPacket : sequence number %v must not be acknowledged", seqnum)
+		}
+	}
+}
+
+var tests_ackframe = []struct {
+	frame AckFrame
+	data  []byte
+}{
+	// Single range, no timestamp
+	{AckFrame{LargestAcked: 0x10, AckDelay: 100 * time.Microsecond, Ranges: []AckRange{{0x0c, 0x10}}},
+		[]byte{0x40, 0x10, 0x64, 0x00, 0x05, 0x00}},
+	// Multiple ranges, the gap of 0x121e packets is split in 18 blocks of length 0
+	{AckFrame{LargestAcked: 0x1234, Ranges: []AckRange{{0x1230, 0x1234}, {0x1220, 0x1227}, {0x01, 0x01}}},
+		append(append([]byte{0x64, 0x34, 0x12, 0x00, 0x00, 20, 0x05, 0x08, 0x08}, bytes.Repeat([]byte{0xff, 0x00}, 18)...), 0x30, 0x01, 0x00)},
+	// Timestamps
+	{AckFrame{LargestAcked: 0x20, AckDelay: 0x1000 * time.Microsecond, Ranges: []AckRange{{0x1e, 0x20}},
+		Timestamps: []AckTimestamp{{0x20, 0x01020304 * time.Microsecond}, {0x1e, 0x01020404 * time.Microsecond}}},
+		[]byte{0x40, 0x20, 0x00, 0x10, 0x03, 0x02, 0x00, 0x04, 0x03, 0x02, 0x01, 0x02, 0x00, 0x01}},
+}
+
+func Test_AckFrame(t *testing.T) {
+	for i, v := range tests_ackframe {
+		b := make([]byte, 128)
+		s, err := v.frame.Write(b)
+		if err != nil || s != v.frame.GetSerializedSize() || !bytes.Equal(b[:s], v.data) {
+			t.Errorf("AckFrame.Write : invalid serialized data %x (%v) in test n°%v", b[:s], err, i)
+		}
+
+		f, s, err := ParseAckFrame(v.data)
+		if err != nil || s != len(v.data) {
+			t.Fatalf("ParseAckFrame : invalid parsed size %v (%v) in test n°%v", s, err, i)
+		}
+		if f.LargestAcked != v.frame.LargestAcked || f.AckDelay != v.frame.AckDelay || !reflect.DeepEqual(f.Ranges, v.frame.Ranges) || !reflect.DeepEqual(f.Timestamps, v.frame.Timestamps) {
+			t.Errorf("ParseAckFrame : invalid frame %+v in test n°%v", f, i)
+		}
+
+		for l := 0; l < len(v.data); l++ {
+			if _, _, err = ParseAckFrame(v.data[:l]); err != ErrTruncatedFrame {
+				t.Errorf("ParseAckFrame : ErrTruncatedFrame expected for %v bytes in test n°%v instead of %v", l, i, err)
+			}
+		}
+	}
+}
+
+func Test_AckFrame_MaxBlocks(t *testing.T) {
+	// 300 ranges of one packet separated by one missing packet
+	var received []QuicPacketSequenceNumber
+	for i := 0; i < 300; i++ {
+		received = append(received, QuicPacketSequenceNumber(1000+2*i))
+	}
+	f := BuildAckFrame(received, 0)
+	if len(f.Ranges) != 300 {
+		t.Fatalf("BuildAckFrame : invalid number of ranges %v", len(f.Ranges))
+	}
+	b := make([]byte, f.GetSerializedSize())
+	s, err := f.Write(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := ParseAckFrame(b[:s])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Ranges) != ACKFRAME_MAX_BLOCKS+1 || !reflect.DeepEqual(parsed.Ranges, f.Ranges[:ACKFRAME_MAX_BLOCKS+1]) {
+		t.Errorf("AckFrame.Write : the %v largest ranges must be kept instead of %v", ACKFRAME_MAX_BLOCKS+1, len(parsed.Ranges))
+	}
+	for _, seqnum := range received {
+		if parsed.AcksPacket(seqnum) && !f.AcksPacket(seqnum) {
+			t.Errorf("AckFrame.Write : sequence number %v acknowledged but not received", seqnum)
+		}
+	}
+}
+
+func Test_AckFrame_Errors(t *testing.T) {
+	b := make([]byte, 64)
+	for i, f := range []AckFrame{
+		{LargestAcked: 5},
+		{LargestAcked: 5, Ranges: []AckRange{{1, 4}}},
+		{LargestAcked: 5, Ranges: []AckRange{{3, 5}, {1, 2}}},
+		{LargestAcked: 5, Ranges: []AckRange{{3, 5}, {1, 4}}},
+	} {
+		if _, err := f.Write(b); err == nil {
+			t.Errorf("AckFrame.Write : invalid ranges must be rejected in test n°%v", i)
+		}
+	}
+
+	// First block larger than Largest Acked + 1
+	if _, _, err := ParseAckFrame([]byte{0x40, 0x02, 0x00, 0x00, 0x04, 0x00}); err == nil || err == ErrTruncatedFrame {
+		t.Errorf("ParseAckFrame : invalid first ACK block must be rejected instead of %v", err)
+	}
+	// Block below sequence number 0
+	if _, _, err := ParseAckFrame([]byte{0x60, 0x05, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04, 0x00}); err == nil || err == ErrTruncatedFrame {
+		t.Errorf("ParseAckFrame : ACK block below 0 must be rejected instead of %v", err)
+	}
+	// Reserved flag set
+	if _, _, err := ParseAckFrame([]byte{0x50, 0x01, 0x00, 0x00, 0x01, 0x00}); err == nil || err == ErrTruncatedFrame {
+		t.Errorf("ParseAckFrame : reserved flag must be rejected instead of %v", err)
+	}
+	if _, _, err := ParseAckFrame([]byte{QUICFRAMETYPE_STREAM}); err != ErrInvalidFrameType {
+		t.Errorf("ParseAckFrame : ErrInvalidFrameType expected instead of %v", err)
+	}
+}
+
+func Fuzz_ParseAckFrame(f *testing.F) {
+	for _, v := range tests_ackframe {
+		f.Add(v.data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		frame, s, err := ParseAckFrame(data)
+		if err != nil {
+			return
+		}
+		if s > len(data) {
+			t.Fatalf("ParseAckFrame : parsed size %d greater than data size %d", s, len(data))
+		}
+		for _, r := range frame.Ranges {
+			if !frame.AcksPacket(r.Smallest) || !frame.AcksPacket(r.Largest) {
+				t.Fatalf("AckFrame.AcksPacket : range %+v not acknowledged", r)
+			}
+		}
+	})
+}
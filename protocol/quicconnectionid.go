@@ -0,0 +1,39 @@
+package protocol
+
+import "encoding/binary"
+import "errors"
+import "fmt"
+import "io"
+
+// QuicConnectionID is the 64-bit Connection ID chosen by the client.
+//
+// The Connection ID can be truncated to 32 or 8 bits, or omitted, in the packets sent by the server if the client
+// asked for it in its CHLO. An omitted Connection ID is parsed as the zero value, which GenerateConnectionID never returns.
+type QuicConnectionID uint64
+
+// GenerateConnectionID returns a random non-zero Connection ID read from the random source.
+func GenerateConnectionID(rand io.Reader) (QuicConnectionID, error) {
+	var b [8]byte
+
+	if _, err := io.ReadFull(rand, b[:]); err != nil {
+		return 0, err
+	}
+	connID := QuicConnectionID(binary.LittleEndian.Uint64(b[:]))
+	if connID == 0 {
+		return 0, errors.New("GenerateConnectionID : random source returned a zero Connection ID")
+	}
+	return connID, nil
+}
+
+// Truncate returns the Connection ID truncated to its size bytes (0, 1, 4 or 8) of lowest weight, as serialized in the packet header.
+func (this QuicConnectionID) Truncate(size int) QuicConnectionID {
+	if size >= 8 {
+		return this
+	}
+	return this & (1<<uint(size<<3) - 1)
+}
+
+// String returns the Connection ID as 16 hexadecimal digits.
+func (this QuicConnectionID) String() string {
+	return fmt.Sprintf("%016x", uint64(this))
+}
@@ -0,0 +1,60 @@
+package protocol
+
+import "testing"
+import "bytes"
+import "crypto/rand"
+import "errors"
+import "testing/iotest"
+
+func Test_GenerateConnectionID(t *testing.T) {
+	a, err := GenerateConnectionID(rand.Reader)
+	if err != nil || a == 0 {
+		t.Errorf("GenerateConnectionID : invalid Connection ID %v (%v)", a, err)
+	}
+	b, err := GenerateConnectionID(rand.Reader)
+	if err != nil || a == b {
+		t.Errorf("GenerateConnectionID : two identical Connection IDs %v (%v)", b, err)
+	}
+	c, err := GenerateConnectionID(bytes.NewReader([]byte{0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01}))
+	if err != nil || c != 0x0102030405060708 || c.String() != "0102030405060708" {
+		t.Errorf("GenerateConnectionID : invalid Connection ID %v (%v)", c, err)
+	}
+
+	// Random source errors
+	e := errors.New("entropy exhausted")
+	if _, err = GenerateConnectionID(iotest.ErrReader(e)); err != e {
+		t.Errorf("GenerateConnectionID : random source error expected instead of %v", err)
+	}
+	if _, err = GenerateConnectionID(bytes.NewReader([]byte{1, 2, 3})); err == nil {
+		t.Error("GenerateConnectionID : short random source must be rejected")
+	}
+	if _, err = GenerateConnectionID(bytes.NewReader(make([]byte, 8))); err == nil {
+		t.Error("GenerateConnectionID : zero Connection ID must be rejected")
+	}
+
+	if c.Truncate(0) != 0 || c.Truncate(1) != 0x08 || c.Truncate(4) != 0x05060708 || c.Truncate(8) != c {
+		t.Error("QuicConnectionID.Truncate : invalid truncated Connection ID")
+	}
+}
+
+func Test_QuicPacketHeader_OmittedConnectionID(t *testing.T) {
+	var h QuicPacketHeader
+
+	b := make([]byte, 16)
+	h.SetConnectionID(0x0102030405060708)
+	h.SetConnectionIdSize(8)
+	h.SetSequenceNumber(0x42)
+	h.SetSequenceNumberSize(1)
+	h.OmitConnectionID()
+	if !h.IsConnectionIDOmitted() || h.GetConnectionID() != 0 {
+		t.Error("QuicPacketHeader.OmitConnectionID : Connection ID must be omitted")
+	}
+	s, err := h.WritePublicHeader(b)
+	if err != nil || s != 2 || !bytes.Equal(b[:s], []byte{0x00, 0x42}) {
+		t.Errorf("QuicPacketHeader.WritePublicHeader : invalid header %x (%v)", b[:s], err)
+	}
+	p, s, err := ParsePublicHeader(b[:s])
+	if err != nil || s != 2 || !p.IsConnectionIDOmitted() || p.GetConnectionID() != 0 || p.GetSequenceNumber() != 0x42 {
+		t.Errorf("ParsePublicHeader : invalid header %+v (%v)", p, err)
+	}
+}
@@ -1,3 +1,151 @@
 package protocol
 
+import "fmt"
+
+// QuicErrorCode is the error code of the RST_STREAM, CONNECTION_CLOSE and GOAWAY frames.
 type QuicErrorCode uint32
+
+// Standard QUIC error codes
+const (
+	QUIC_NO_ERROR                                QuicErrorCode = 0
+	QUIC_INTERNAL_ERROR                          QuicErrorCode = 1
+	QUIC_STREAM_DATA_AFTER_TERMINATION           QuicErrorCode = 2
+	QUIC_INVALID_PACKET_HEADER                   QuicErrorCode = 3
+	QUIC_INVALID_FRAME_DATA                      QuicErrorCode = 4
+	QUIC_INVALID_FEC_DATA                        QuicErrorCode = 5
+	QUIC_INVALID_RST_STREAM_DATA                 QuicErrorCode = 6
+	QUIC_INVALID_CONNECTION_CLOSE_DATA           QuicErrorCode = 7
+	QUIC_INVALID_GOAWAY_DATA                     QuicErrorCode = 8
+	QUIC_INVALID_ACK_DATA                        QuicErrorCode = 9
+	QUIC_INVALID_VERSION_NEGOTIATION_PACKET      QuicErrorCode = 10
+	QUIC_INVALID_PUBLIC_RST_PACKET               QuicErrorCode = 11
+	QUIC_DECRYPTION_FAILURE                      QuicErrorCode = 12
+	QUIC_ENCRYPTION_FAILURE                      QuicErrorCode = 13
+	QUIC_PACKET_TOO_LARGE                        QuicErrorCode = 14
+	QUIC_PEER_GOING_AWAY                         QuicErrorCode = 16
+	QUIC_INVALID_STREAM_ID                       QuicErrorCode = 17
+	QUIC_TOO_MANY_OPEN_STREAMS                   QuicErrorCode = 18
+	QUIC_PUBLIC_RESET                            QuicErrorCode = 19
+	QUIC_INVALID_VERSION                         QuicErrorCode = 20
+	QUIC_INVALID_HEADER_ID                       QuicErrorCode = 22
+	QUIC_INVALID_NEGOTIATED_VALUE                QuicErrorCode = 23
+	QUIC_DECOMPRESSION_FAILURE                   QuicErrorCode = 24
+	QUIC_NETWORK_IDLE_TIMEOUT                    QuicErrorCode = 25
+	QUIC_ERROR_MIGRATING_ADDRESS                 QuicErrorCode = 26
+	QUIC_PACKET_WRITE_ERROR                      QuicErrorCode = 27
+	QUIC_HANDSHAKE_FAILED                        QuicErrorCode = 28
+	QUIC_CRYPTO_TAGS_OUT_OF_ORDER                QuicErrorCode = 29
+	QUIC_CRYPTO_TOO_MANY_ENTRIES                 QuicErrorCode = 30
+	QUIC_CRYPTO_INVALID_VALUE_LENGTH             QuicErrorCode = 31
+	QUIC_CRYPTO_MESSAGE_AFTER_HANDSHAKE_COMPLETE QuicErrorCode = 32
+	QUIC_INVALID_CRYPTO_MESSAGE_TYPE             QuicErrorCode = 33
+	QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER        QuicErrorCode = 34
+	QUIC_CRYPTO_MESSAGE_PARAMETER_NOT_FOUND      QuicErrorCode = 35
+	QUIC_CRYPTO_MESSAGE_PARAMETER_NO_OVERLAP     QuicErrorCode = 36
+	QUIC_CRYPTO_MESSAGE_INDEX_NOT_FOUND          QuicErrorCode = 37
+	QUIC_CRYPTO_INTERNAL_ERROR                   QuicErrorCode = 38
+	QUIC_CRYPTO_VERSION_NOT_SUPPORTED            QuicErrorCode = 39
+	QUIC_CRYPTO_NO_SUPPORT                       QuicErrorCode = 40
+	QUIC_CRYPTO_TOO_MANY_REJECTS                 QuicErrorCode = 41
+	QUIC_PROOF_INVALID                           QuicErrorCode = 42
+	QUIC_CRYPTO_DUPLICATE_TAG                    QuicErrorCode = 43
+	QUIC_CRYPTO_ENCRYPTION_LEVEL_INCORRECT       QuicErrorCode = 44
+	QUIC_CRYPTO_SERVER_CONFIG_EXPIRED            QuicErrorCode = 45
+	QUIC_INVALID_STREAM_DATA                     QuicErrorCode = 46
+	QUIC_MISSING_PAYLOAD                         QuicErrorCode = 48
+	QUIC_INVALID_PRIORITY                        QuicErrorCode = 49
+	QUIC_INVALID_STREAM_FRAME                    QuicErrorCode = 50
+	QUIC_PACKET_READ_ERROR                       QuicErrorCode = 51
+	QUIC_CRYPTO_SYMMETRIC_KEY_SETUP_FAILED       QuicErrorCode = 53
+	QUIC_VERSION_NEGOTIATION_MISMATCH            QuicErrorCode = 55
+	QUIC_INVALID_WINDOW_UPDATE_DATA              QuicErrorCode = 57
+	QUIC_INVALID_BLOCKED_DATA                    QuicErrorCode = 58
+	QUIC_FLOW_CONTROL_RECEIVED_TOO_MUCH_DATA     QuicErrorCode = 59
+	QUIC_INVALID_STOP_WAITING_DATA               QuicErrorCode = 60
+	QUIC_UNENCRYPTED_STREAM_DATA                 QuicErrorCode = 61
+	QUIC_FLOW_CONTROL_SENT_TOO_MUCH_DATA         QuicErrorCode = 63
+	QUIC_FLOW_CONTROL_INVALID_WINDOW             QuicErrorCode = 64
+	QUIC_HANDSHAKE_TIMEOUT                       QuicErrorCode = 67
+	QUIC_TOO_MANY_OUTSTANDING_SENT_PACKETS       QuicErrorCode = 68
+	QUIC_TOO_MANY_OUTSTANDING_RECEIVED_PACKETS   QuicErrorCode = 69
+	QUIC_CONNECTION_CANCELLED                    QuicErrorCode = 70
+	QUIC_TOO_MANY_AVAILABLE_STREAMS              QuicErrorCode = 76
+	QUIC_TOO_MANY_RTOS                           QuicErrorCode = 85
+	QUIC_OVERLAPPING_STREAM_DATA                 QuicErrorCode = 87
+)
+
+var errorCodeNames = map[QuicErrorCode]string{
+	QUIC_NO_ERROR:                                "QUIC_NO_ERROR",
+	QUIC_INTERNAL_ERROR:                          "QUIC_INTERNAL_ERROR",
+	QUIC_STREAM_DATA_AFTER_TERMINATION:           "QUIC_STREAM_DATA_AFTER_TERMINATION",
+	QUIC_INVALID_PACKET_HEADER:                   "QUIC_INVALID_PACKET_HEADER",
+	QUIC_INVALID_FRAME_DATA:                      "QUIC_INVALID_FRAME_DATA",
+	QUIC_INVALID_FEC_DATA:                        "QUIC_INVALID_FEC_DATA",
+	QUIC_INVALID_RST_STREAM_DATA:                 "QUIC_INVALID_RST_STREAM_DATA",
+	QUIC_INVALID_CONNECTION_CLOSE_DATA:           "QUIC_INVALID_CONNECTION_CLOSE_DATA",
+	QUIC_INVALID_GOAWAY_DATA:                     "QUIC_INVALID_GOAWAY_DATA",
+	QUIC_INVALID_ACK_DATA:                        "QUIC_INVALID_ACK_DATA",
+	QUIC_INVALID_VERSION_NEGOTIATION_PACKET:      "QUIC_INVALID_VERSION_NEGOTIATION_PACKET",
+	QUIC_INVALID_PUBLIC_RST_PACKET:               "QUIC_INVALID_PUBLIC_RST_PACKET",
+	QUIC_DECRYPTION_FAILURE:                      "QUIC_DECRYPTION_FAILURE",
+	QUIC_ENCRYPTION_FAILURE:                      "QUIC_ENCRYPTION_FAILURE",
+	QUIC_PACKET_TOO_LARGE:                        "QUIC_PACKET_TOO_LARGE",
+	QUIC_PEER_GOING_AWAY:                         "QUIC_PEER_GOING_AWAY",
+	QUIC_INVALID_STREAM_ID:                       "QUIC_INVALID_STREAM_ID",
+	QUIC_TOO_MANY_OPEN_STREAMS:                   "QUIC_TOO_MANY_OPEN_STREAMS",
+	QUIC_PUBLIC_RESET:                            "QUIC_PUBLIC_RESET",
+	QUIC_INVALID_VERSION:                         "QUIC_INVALID_VERSION",
+	QUIC_INVALID_HEADER_ID:                       "QUIC_INVALID_HEADER_ID",
+	QUIC_INVALID_NEGOTIATED_VALUE:                "QUIC_INVALID_NEGOTIATED_VALUE",
+	QUIC_DECOMPRESSION_FAILURE:                   "QUIC_DECOMPRESSION_FAILURE",
+	QUIC_NETWORK_IDLE_TIMEOUT:                    "QUIC_NETWORK_IDLE_TIMEOUT",
+	QUIC_ERROR_MIGRATING_ADDRESS:                 "QUIC_ERROR_MIGRATING_ADDRESS",
+	QUIC_PACKET_WRITE_ERROR:                      "QUIC_PACKET_WRITE_ERROR",
+	QUIC_HANDSHAKE_FAILED:                        "QUIC_HANDSHAKE_FAILED",
+	QUIC_CRYPTO_TAGS_OUT_OF_ORDER:                "QUIC_CRYPTO_TAGS_OUT_OF_ORDER",
+	QUIC_CRYPTO_TOO_MANY_ENTRIES:                 "QUIC_CRYPTO_TOO_MANY_ENTRIES",
+	QUIC_CRYPTO_INVALID_VALUE_LENGTH:             "QUIC_CRYPTO_INVALID_VALUE_LENGTH",
+	QUIC_CRYPTO_MESSAGE_AFTER_HANDSHAKE_COMPLETE: "QUIC_CRYPTO_MESSAGE_AFTER_HANDSHAKE_COMPLETE",
+	QUIC_INVALID_CRYPTO_MESSAGE_TYPE:             "QUIC_INVALID_CRYPTO_MESSAGE_TYPE",
+	QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER:        "QUIC_INVALID_CRYPTO_MESSAGE_PARAMETER",
+	QUIC_CRYPTO_MESSAGE_PARAMETER_NOT_FOUND:      "QUIC_CRYPTO_MESSAGE_PARAMETER_NOT_FOUND",
+	QUIC_CRYPTO_MESSAGE_PARAMETER_NO_OVERLAP:     "QUIC_CRYPTO_MESSAGE_PARAMETER_NO_OVERLAP",
+	QUIC_CRYPTO_MESSAGE_INDEX_NOT_FOUND:          "QUIC_CRYPTO_MESSAGE_INDEX_NOT_FOUND",
+	QUIC_CRYPTO_INTERNAL_ERROR:                   "QUIC_CRYPTO_INTERNAL_ERROR",
+	QUIC_CRYPTO_VERSION_NOT_SUPPORTED:            "QUIC_CRYPTO_VERSION_NOT_SUPPORTED",
+	QUIC_CRYPTO_NO_SUPPORT:                       "QUIC_CRYPTO_NO_SUPPORT",
+	QUIC_CRYPTO_TOO_MANY_REJECTS:                 "QUIC_CRYPTO_TOO_MANY_REJECTS",
+	QUIC_PROOF_INVALID:                           "QUIC_PROOF_INVALID",
+	QUIC_CRYPTO_DUPLICATE_TAG:                    "QUIC_CRYPTO_DUPLICATE_TAG",
+	QUIC_CRYPTO_ENCRYPTION_LEVEL_INCORRECT:       "QUIC_CRYPTO_ENCRYPTION_LEVEL_INCORRECT",
+	QUIC_CRYPTO_SERVER_CONFIG_EXPIRED:            "QUIC_CRYPTO_SERVER_CONFIG_EXPIRED",
+	QUIC_INVALID_STREAM_DATA:                     "QUIC_INVALID_STREAM_DATA",
+	QUIC_MISSING_PAYLOAD:                         "QUIC_MISSING_PAYLOAD",
+	QUIC_INVALID_PRIORITY:                        "QUIC_INVALID_PRIORITY",
+	QUIC_INVALID_STREAM_FRAME:                    "QUIC_INVALID_STREAM_FRAME",
+	QUIC_PACKET_READ_ERROR:                       "QUIC_PACKET_READ_ERROR",
+	QUIC_CRYPTO_SYMMETRIC_KEY_SETUP_FAILED:       "QUIC_CRYPTO_SYMMETRIC_KEY_SETUP_FAILED",
+	QUIC_VERSION_NEGOTIATION_MISMATCH:            "QUIC_VERSION_NEGOTIATION_MISMATCH",
+	QUIC_INVALID_WINDOW_UPDATE_DATA:              "QUIC_INVALID_WINDOW_UPDATE_DATA",
+	QUIC_INVALID_BLOCKED_DATA:                    "QUIC_INVALID_BLOCKED_DATA",
+	QUIC_FLOW_CONTROL_RECEIVED_TOO_MUCH_DATA:     "QUIC_FLOW_CONTROL_RECEIVED_TOO_MUCH_DATA",
+	QUIC_INVALID_STOP_WAITING_DATA:               "QUIC_INVALID_STOP_WAITING_DATA",
+	QUIC_UNENCRYPTED_STREAM_DATA:                 "QUIC_UNENCRYPTED_STREAM_DATA",
+	QUIC_FLOW_CONTROL_SENT_TOO_MUCH_DATA:         "QUIC_FLOW_CONTROL_SENT_TOO_MUCH_DATA",
+	QUIC_FLOW_CONTROL_INVALID_WINDOW:             "QUIC_FLOW_CONTROL_INVALID_WINDOW",
+	QUIC_HANDSHAKE_TIMEOUT:                       "QUIC_HANDSHAKE_TIMEOUT",
+	QUIC_TOO_MANY_OUTSTANDING_SENT_PACKETS:       "QUIC_TOO_MANY_OUTSTANDING_SENT_PACKETS",
+	QUIC_TOO_MANY_OUTSTANDING_RECEIVED_PACKETS:   "QUIC_TOO_MANY_OUTSTANDING_RECEIVED_PACKETS",
+	QUIC_CONNECTION_CANCELLED:                    "QUIC_CONNECTION_CANCELLED",
+	QUIC_TOO_MANY_AVAILABLE_STREAMS:              "QUIC_TOO_MANY_AVAILABLE_STREAMS",
+	QUIC_TOO_MANY_RTOS:                           "QUIC_TOO_MANY_RTOS",
+	QUIC_OVERLAPPING_STREAM_DATA:                 "QUIC_OVERLAPPING_STREAM_DATA",
+}
+
+// String returns the name of the error code, or its numeric value if it is unknown.
+func (this QuicErrorCode) String() string {
+	if s, ok := errorCodeNames[this]; ok {
+		return s
+	}
+	return fmt.Sprintf("QUIC_ERROR_CODE(%d)", uint32(this))
+}
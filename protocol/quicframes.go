@@ -0,0 +1,714 @@
+package protocol
+
+import "encoding/binary"
+import "errors"
+import "fmt"
+
+/*
+
+Regular Frame flags:
++---+---+---+---+---+---+---+---+
+| 0 | 0 | 0 | 0 | 0 |RegularType|
++---+---+---+---+---+---+---+---+
+
+FLAGS
+
+000  0  PADDING
+001  1  RST_STREAM
+010  2  CONNECTION_CLOSE
+011  3  GOAWAY
+100  4  WINDOW_UPDATE
+101  5  BLOCKED
+110  6  STOP_WAITING
+111  7  PING
+
+-----------------------------------------------------------
+
+ACK Frame flags:
++---+---+---+---+---+---+---+---+
+| 0 | 1 |NAC|TRC|LargLen|MissLen|
++---+---+---+---+---+---+---+---+
+
+FLAGS    Largest      Missing Packet Sequence Number
+         Observed     Delta
+         size         size
+
+00 00    1            1
+00 01    1            2
+00 10    1            4
+00 11    1            6
+01 00    2            1
+01 01    2            2
+01 10    2            4
+01 11    2            6
+10 00    4            1
+10 01    4            2
+10 10    4            4
+10 11    4            6
+11 00    6            1
+11 01    6            2
+11 10    6            4
+11 11    6            6
+
+-----------------------------------------------------------
+
+STREAM Frame flags:
++---+---+---+---+---+---+---+---+
+| 1 |FIN|Len| Offset Len| Stream|
++---+---+---+---+---+---+---+---+
+
+FLAGS    Byte Offset size  StreamID size
+
+000 00   0                 1
+000 01   0                 2
+000 10   0                 3
+000 11   0                 4
+001 00   2                 1
+001 01   2                 2
+001 10   2                 3
+001 11   2                 4
+010 00   3                 1
+010 01   3                 2
+010 10   3                 3
+010 11   3                 4
+011 00   4                 1
+011 01   4                 2
+011 10   4                 3
+011 11   4                 4
+100 00   5                 1
+100 01   5                 2
+100 10   5                 3
+100 11   5                 4
+101 00   6                 1
+101 01   6                 2
+101 10   6                 3
+101 11   6                 4
+110 00   7                 1
+110 01   7                 2
+110 10   7                 3
+110 11   7                 4
+111 00   8                 1
+111 01   8                 2
+111 10   8                 3
+111 11   8                 4
+
+*/
+
+var parseMissingPacketSequenceNumberDeltaSize = []uint{1, 2, 4, 6, 1, 2, 4, 6, 1, 2, 4, 6, 1, 2, 4, 6}
+var parseLargestObservedSize = []uint{1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 6, 6, 6, 6}
+
+var parseStreamIdSize = []uint{1, 2, 3, 4, 1, 2, 3, 4, 1, 2, 3, 4, 1, 2, 3, 4, 1, 2, 3, 4, 1, 2, 3, 4, 1, 2, 3, 4, 1, 2, 3, 4}
+var parseByteOffsetSize = []uint{0, 0, 0, 0, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 6, 6, 6, 6, 7, 7, 7, 7, 8, 8, 8, 8}
+
+const (
+	// Quic Frame type
+	QUICFRAMETYPE_STREAM                   = 0x80
+	QUICFRAMETYPE_STREAM_MASK              = 0x80
+	QUICFRAMETYPE_ACK                      = 0x40
+	QUICFRAMETYPE_ACK_MASK                 = 0xc0
+	QUICFRAMETYPE_CONGESTION_FEEDBACK      = 0x20
+	QUICFRAMETYPE_CONGESTION_FEEDBACK_MASK = 0xe0
+	QUICFRAMETYPE_REGULAR_MASK             = 0x1f
+	QUICFRAMETYPE_PADDING                  = 0x00
+	QUICFRAMETYPE_RST_STREAM               = 0x01
+	QUICFRAMETYPE_CONNECTION_CLOSE         = 0x02
+	QUICFRAMETYPE_GOAWAY                   = 0x03
+	QUICFRAMETYPE_WINDOW_UPDATE            = 0x04
+	QUICFRAMETYPE_BLOCKED                  = 0x05
+	QUICFRAMETYPE_STOP_WAITING             = 0x06
+	QUICFRAMETYPE_PING                     = 0x07
+	// STREAM FRAME mask and flags
+	QUICFLAG_FIN              = 0x40
+	QUICFLAG_DATALENGTH       = 0x20
+	QUICMASK_BYTEOFFSET_SIZE  = 0x1c
+	QUICFLAG_BYTEOFFSET_64bit = 0x1c
+	QUICFLAG_BYTEOFFSET_56bit = 0x18
+	QUICFLAG_BYTEOFFSET_48bit = 0x14
+	QUICFLAG_BYTEOFFSET_40bit = 0x10
+	QUICFLAG_BYTEOFFSET_32bit = 0x0c
+	QUICFLAG_BYTEOFFSET_24bit = 0x08
+	QUICFLAG_BYTEOFFSET_16bit = 0x04
+	QUICMASK_STREAMID_SIZE    = 0x03
+	QUICFLAG_STREAMID_32bit   = 0x03
+	QUICFLAG_STREAMID_24bit   = 0x02
+	QUICFLAG_STREAMID_16bit   = 0x01
+	QUICFLAG_STREAMID_8bit    = 0x00
+	// ACK FRAME mask and flags
+	QUICFLAG_NACK                           = 0x20
+	QUICFLAG_TRUNCATED                      = 0x10
+	QUICMASK_LARGESTOBSERVED_SIZE           = 0x0c
+	QUICFLAG_LARGESTOBSERVED_48bit          = 0x0c
+	QUICFLAG_LARGESTOBSERVED_32bit          = 0x08
+	QUICFLAG_LARGESTOBSERVED_16bit          = 0x04
+	QUICFLAG_LARGESTOBSERVED_8bit           = 0x00
+	QUICMASK_MISSINGPACKETSEQNUMDELTA_SIZE  = 0x03
+	QUICFLAG_MISSINGPACKETSEQNUMDELTA_48bit = 0x03
+	QUICFLAG_MISSINGPACKETSEQNUMDELTA_32bit = 0x02
+	QUICFLAG_MISSINGPACKETSEQNUMDELTA_16bit = 0x01
+	QUICFLAG_MISSINGPACKETSEQNUMDELTA_8bit  = 0x00
+)
+
+// QuicByteOffset is the offset of the data of a STREAM frame in its stream.
+type QuicByteOffset uint64
+
+// ErrUnknownFrameType is returned by ParseNextFrame when the frame type is not supported.
+var ErrUnknownFrameType = errors.New("ParseNextFrame : unknown frame type")
+
+// ErrDuplicateFrame is the parse error of a second ACK or STOP_WAITING frame in a packet.
+var ErrDuplicateFrame = errors.New("ParseFrames : duplicate frame")
+
+// ErrReasonPhraseTooLong is returned when the reason phrase of a CONNECTION_CLOSE or GOAWAY frame exceeds QUIC_MAX_REASON_PHRASE_SIZE.
+var ErrReasonPhraseTooLong = errors.New("ParseFrame : reason phrase too long")
+
+// ErrInvalidFrame is returned by ParseNextFrame and ParseFrames for a malformed frame, the connection is closed with its
+// error code: QUIC_INVALID_STREAM_DATA, QUIC_INVALID_ACK_DATA, ... for the frame type, QUIC_INVALID_FRAME_DATA for an unknown type.
+type ErrInvalidFrame struct {
+	FrameType byte
+	Code      QuicErrorCode
+	Err       error
+}
+
+func (this ErrInvalidFrame) Error() string {
+	return fmt.Sprintf("ParseNextFrame : invalid frame of type 0x%02x with %v (%v)", this.FrameType, this.Code, this.Err)
+}
+
+// Unwrap returns the parse error of the frame.
+func (this ErrInvalidFrame) Unwrap() error {
+	return this.Err
+}
+
+// ErrorCode returns the error code of the CONNECTION_CLOSE frame.
+func (this ErrInvalidFrame) ErrorCode() QuicErrorCode {
+	return this.Code
+}
+
+// QUIC_MAX_REASON_PHRASE_SIZE is the maximum size of the reason phrase of the CONNECTION_CLOSE and GOAWAY frames.
+const QUIC_MAX_REASON_PHRASE_SIZE = 1024
+
+// Frame is a QUIC frame that can be serialized in a packet payload.
+type Frame interface {
+	// GetSerializedSize returns the size of the serialized frame
+	GetSerializedSize() int
+	// Write serializes the frame at the start of the data and returns the number of bytes written
+	Write(b []byte) (int, error)
+}
+
+var _ Frame = (*StreamFrame)(nil)
+var _ Frame = (*AckFrame)(nil)
+var _ Frame = (*RstStreamFrame)(nil)
+var _ Frame = (*WindowUpdateFrame)(nil)
+var _ Frame = (*BlockedFrame)(nil)
+var _ Frame = (*StopWaitingFrame)(nil)
+var _ Frame = (*ConnectionCloseFrame)(nil)
+var _ Frame = (*GoawayFrame)(nil)
+var _ Frame = (*PingFrame)(nil)
+var _ Frame = (*PaddingFrame)(nil)
+
+// ParseNextFrame parses the frame at the start of the packet payload, and returns it with the number of bytes consumed.
+//
+// The packet header gives the size of the STOP_WAITING Least Unacked Delta field.
+// A PADDING frame consumes the rest of the packet payload. A malformed frame returns an ErrInvalidFrame.
+func ParseNextFrame(b []byte, header *QuicPacketHeader) (Frame, int, error) {
+	if len(b) < 1 {
+		return nil, 0, ErrInvalidFrame{Code: QUIC_INVALID_FRAME_DATA, Err: ErrTruncatedFrame}
+	}
+	f, size, err := parseNextFrame(b, header)
+	if err != nil {
+		return nil, 0, ErrInvalidFrame{FrameType: b[0], Code: frameErrorCode(b[0]), Err: err}
+	}
+	return f, size, nil
+}
+
+// parseNextFrame parses the frame at the start of the packet payload by frame type.
+func parseNextFrame(b []byte, header *QuicPacketHeader) (Frame, int, error) {
+	ft := b[0]
+	switch {
+	case (ft & QUICFRAMETYPE_STREAM_MASK) == QUICFRAMETYPE_STREAM:
+		return ParseStreamFrame(b)
+	case (ft & QUICFRAMETYPE_ACK_MASK) == QUICFRAMETYPE_ACK:
+		return ParseAckFrame(b)
+	}
+	switch ft {
+	case QUICFRAMETYPE_PADDING:
+		return ParsePaddingFrame(b)
+	case QUICFRAMETYPE_PING:
+		return ParsePingFrame(b)
+	case QUICFRAMETYPE_RST_STREAM:
+		return ParseRstStreamFrame(b)
+	case QUICFRAMETYPE_CONNECTION_CLOSE:
+		return ParseConnectionCloseFrame(b)
+	case QUICFRAMETYPE_GOAWAY:
+		return ParseGoawayFrame(b)
+	case QUICFRAMETYPE_WINDOW_UPDATE:
+		return ParseWindowUpdateFrame(b)
+	case QUICFRAMETYPE_BLOCKED:
+		return ParseBlockedFrame(b)
+	case QUICFRAMETYPE_STOP_WAITING:
+		return ParseStopWaitingFrame(b, header.GetSequenceNumberSize())
+	}
+	return nil, 0, ErrUnknownFrameType
+}
+
+// frameErrorCode returns the error code of a malformed frame of the frame type.
+func frameErrorCode(ft byte) QuicErrorCode {
+	switch {
+	case (ft & QUICFRAMETYPE_STREAM_MASK) == QUICFRAMETYPE_STREAM:
+		return QUIC_INVALID_STREAM_DATA
+	case (ft & QUICFRAMETYPE_ACK_MASK) == QUICFRAMETYPE_ACK:
+		return QUIC_INVALID_ACK_DATA
+	}
+	switch ft {
+	case QUICFRAMETYPE_RST_STREAM:
+		return QUIC_INVALID_RST_STREAM_DATA
+	case QUICFRAMETYPE_CONNECTION_CLOSE:
+		return QUIC_INVALID_CONNECTION_CLOSE_DATA
+	case QUICFRAMETYPE_GOAWAY:
+		return QUIC_INVALID_GOAWAY_DATA
+	case QUICFRAMETYPE_WINDOW_UPDATE:
+		return QUIC_INVALID_WINDOW_UPDATE_DATA
+	case QUICFRAMETYPE_BLOCKED:
+		return QUIC_INVALID_BLOCKED_DATA
+	case QUICFRAMETYPE_STOP_WAITING:
+		return QUIC_INVALID_STOP_WAITING_DATA
+	}
+	return QUIC_INVALID_FRAME_DATA
+}
+
+// ParseFrames parses all the frames of the packet payload, the PADDING frame is skipped.
+// A packet has at most one ACK frame and one STOP_WAITING frame, a duplicate returns an ErrInvalidFrame.
+func ParseFrames(b []byte, header *QuicPacketHeader) ([]Frame, error) {
+	var frames []Frame
+	var ack, stopWaiting bool
+
+	for len(b) > 0 {
+		f, s, err := ParseNextFrame(b, header)
+		if err != nil {
+			return nil, err
+		}
+		switch f.(type) {
+		case *AckFrame:
+			if ack {
+				return nil, ErrInvalidFrame{FrameType: b[0], Code: QUIC_INVALID_ACK_DATA, Err: ErrDuplicateFrame}
+			}
+			ack = true
+		case *StopWaitingFrame:
+			if stopWaiting {
+				return nil, ErrInvalidFrame{FrameType: b[0], Code: QUIC_INVALID_STOP_WAITING_DATA, Err: ErrDuplicateFrame}
+			}
+			stopWaiting = true
+		}
+		if _, ok := f.(*PaddingFrame); !ok {
+			frames = append(frames, f)
+		}
+		b = b[s:]
+	}
+	return frames, nil
+}
+
+// WriteFrames serializes the frames at the start of the data and returns the number of bytes written.
+func WriteFrames(b []byte, frames []Frame) (int, error) {
+	var size int
+
+	for _, f := range frames {
+		s, err := f.Write(b[size:])
+		if err != nil {
+			return 0, err
+		}
+		size += s
+	}
+	return size, nil
+}
+
+// PadPacket returns the frames followed by a PADDING frame, so that the serialized frames fill exactly targetSize bytes.
+//
+// The PADDING frame must be the last frame of the packet, so a STREAM frame without Data Length field is rejected.
+// The frames are returned unchanged when they already fill targetSize bytes.
+func PadPacket(frames []Frame, targetSize int) ([]Frame, error) {
+	var size int
+
+	for _, f := range frames {
+		if sf, ok := f.(*StreamFrame); ok && sf.OmitDataLength {
+			return nil, errors.New("PadPacket : a STREAM frame without Data Length field can't be followed by padding")
+		}
+		size += f.GetSerializedSize()
+	}
+	if size > targetSize {
+		return nil, errors.New("PadPacket : frames are larger than the target size")
+	}
+	if size == targetSize {
+		return frames, nil
+	}
+	padded := make([]Frame, len(frames), len(frames)+1)
+	copy(padded, frames)
+	return append(padded, &PaddingFrame{Size: targetSize - size}), nil
+}
+
+// checkFrameType checks the frame type and the minimum size of a fixed size frame.
+func checkFrameType(b []byte, frameType byte, size int) error {
+	if len(b) < 1 {
+		return ErrTruncatedFrame
+	}
+	if b[0] != frameType {
+		return ErrInvalidFrameType
+	}
+	if len(b) < size {
+		return ErrTruncatedFrame
+	}
+	return nil
+}
+
+// checkWriteSize checks that the data can contain the serialized frame.
+func checkWriteSize(b []byte, f Frame) error {
+	if len(b) < f.GetSerializedSize() {
+		return errors.New("Frame.Write : data size too small to contain the serialized frame")
+	}
+	return nil
+}
+
+// RstStreamFrame is a RST_STREAM frame:
+//
+//	+--------+--------+--------+--------+--------+--------+--- ---+--------+--------+--------+--------+--------+
+//	|Type (8)|         Stream ID (32)            |        Byte Offset (64)       |         Error Code (32)       |
+//	+--------+--------+--------+--------+--------+--------+--- ---+--------+--------+--------+--------+--------+
+type RstStreamFrame struct {
+	StreamID   QuicStreamID
+	ByteOffset QuicByteOffset
+	ErrorCode  QuicErrorCode
+}
+
+// ParseRstStreamFrame parses the RST_STREAM frame at the start of the data, and returns it with the number of bytes consumed.
+func ParseRstStreamFrame(b []byte) (*RstStreamFrame, int, error) {
+	if err := checkFrameType(b, QUICFRAMETYPE_RST_STREAM, 17); err != nil {
+		return nil, 0, err
+	}
+	return &RstStreamFrame{
+		StreamID:   QuicStreamID(binary.LittleEndian.Uint32(b[1:])),
+		ByteOffset: QuicByteOffset(binary.LittleEndian.Uint64(b[5:])),
+		ErrorCode:  QuicErrorCode(binary.LittleEndian.Uint32(b[13:]))}, 17, nil
+}
+
+// GetSerializedSize returns the size of the serialized frame.
+func (this *RstStreamFrame) GetSerializedSize() int {
+	return 17
+}
+
+// Write serializes the frame at the start of the data and returns the number of bytes written.
+func (this *RstStreamFrame) Write(b []byte) (int, error) {
+	if err := checkWriteSize(b, this); err != nil {
+		return 0, err
+	}
+	b[0] = QUICFRAMETYPE_RST_STREAM
+	binary.LittleEndian.PutUint32(b[1:], uint32(this.StreamID))
+	binary.LittleEndian.PutUint64(b[5:], uint64(this.ByteOffset))
+	binary.LittleEndian.PutUint32(b[13:], uint32(this.ErrorCode))
+	return 17, nil
+}
+
+// WindowUpdateFrame is a WINDOW_UPDATE frame, the Stream ID 0 is the connection level flow control window:
+//
+//	+--------+--------+--------+--------+--------+--------+--- ---+--------+
+//	|Type (8)|         Stream ID (32)            |        Byte Offset (64)       |
+//	+--------+--------+--------+--------+--------+--------+--- ---+--------+
+type WindowUpdateFrame struct {
+	StreamID   QuicStreamID
+	ByteOffset QuicByteOffset
+}
+
+// ParseWindowUpdateFrame parses the WINDOW_UPDATE frame at the start of the data, and returns it with the number of bytes consumed.
+func ParseWindowUpdateFrame(b []byte) (*WindowUpdateFrame, int, error) {
+	if err := checkFrameType(b, QUICFRAMETYPE_WINDOW_UPDATE, 13); err != nil {
+		return nil, 0, err
+	}
+	return &WindowUpdateFrame{
+		StreamID:   QuicStreamID(binary.LittleEndian.Uint32(b[1:])),
+		ByteOffset: QuicByteOffset(binary.LittleEndian.Uint64(b[5:]))}, 13, nil
+}
+
+// GetSerializedSize returns the size of the serialized frame.
+func (this *WindowUpdateFrame) GetSerializedSize() int {
+	return 13
+}
+
+// Write serializes the frame at the start of the data and returns the number of bytes written.
+func (this *WindowUpdateFrame) Write(b []byte) (int, error) {
+	if err := checkWriteSize(b, this); err != nil {
+		return 0, err
+	}
+	b[0] = QUICFRAMETYPE_WINDOW_UPDATE
+	binary.LittleEndian.PutUint32(b[1:], uint32(this.StreamID))
+	binary.LittleEndian.PutUint64(b[5:], uint64(this.ByteOffset))
+	return 13, nil
+}
+
+// BlockedFrame is a BLOCKED frame, the Stream ID 0 means the connection is blocked by the connection level flow control:
+//
+//	+--------+--------+--------+--------+--------+
+//	|Type (8)|         Stream ID (32)            |
+//	+--------+--------+--------+--------+--------+
+type BlockedFrame struct {
+	StreamID QuicStreamID
+}
+
+// ParseBlockedFrame parses the BLOCKED frame at the start of the data, and returns it with the number of bytes consumed.
+func ParseBlockedFrame(b []byte) (*BlockedFrame, int, error) {
+	if err := checkFrameType(b, QUICFRAMETYPE_BLOCKED, 5); err != nil {
+		return nil, 0, err
+	}
+	return &BlockedFrame{StreamID: QuicStreamID(binary.LittleEndian.Uint32(b[1:]))}, 5, nil
+}
+
+// GetSerializedSize returns the size of the serialized frame.
+func (this *BlockedFrame) GetSerializedSize() int {
+	return 5
+}
+
+// Write serializes the frame at the start of the data and returns the number of bytes written.
+func (this *BlockedFrame) Write(b []byte) (int, error) {
+	if err := checkWriteSize(b, this); err != nil {
+		return 0, err
+	}
+	b[0] = QUICFRAMETYPE_BLOCKED
+	binary.LittleEndian.PutUint32(b[1:], uint32(this.StreamID))
+	return 5, nil
+}
+
+// StopWaitingFrame is a STOP_WAITING frame:
+//
+//	+--------+--------+--------+--------+--------+--------+--------+
+//	|Type (8)|   Least Unacked Delta (8, 16, 32 or 48 bits)        |
+//	+--------+--------+--------+--------+--------+--------+--------+
+//
+// The Least Unacked Delta field has the same size as the sequence number of the packet header, and the least
+// unacked sequence number is the sequence number of the packet minus the delta.
+type StopWaitingFrame struct {
+	LeastUnackedDelta QuicPacketSequenceNumber
+	// DeltaByteSize is the size of the sequence number of the packet header (1, 2, 4 or 6 bytes)
+	DeltaByteSize int
+}
+
+// NewStopWaitingFrame returns the STOP_WAITING frame of the least unacked sequence number, for a packet header with the sequence number and its size.
+func NewStopWaitingFrame(leastUnacked, seqnum QuicPacketSequenceNumber, seqnumSize int) *StopWaitingFrame {
+	return &StopWaitingFrame{LeastUnackedDelta: seqnum - leastUnacked, DeltaByteSize: seqnumSize}
+}
+
+// ParseStopWaitingFrame parses the STOP_WAITING frame at the start of the data with the sequence number size of the packet header,
+// and returns it with the number of bytes consumed.
+func ParseStopWaitingFrame(b []byte, seqnumSize int) (*StopWaitingFrame, int, error) {
+	switch seqnumSize {
+	case 1, 2, 4, 6:
+	default:
+		return nil, 0, errors.New("ParseStopWaitingFrame : invalid sequence number size")
+	}
+	if err := checkFrameType(b, QUICFRAMETYPE_STOP_WAITING, 1+seqnumSize); err != nil {
+		return nil, 0, err
+	}
+	return &StopWaitingFrame{
+		LeastUnackedDelta: QuicPacketSequenceNumber(readLittleEndian(b[1:], seqnumSize)),
+		DeltaByteSize:     seqnumSize}, 1 + seqnumSize, nil
+}
+
+// GetLeastUnacked returns the least unacked sequence number of the frame sent in the packet with the sequence number.
+func (this *StopWaitingFrame) GetLeastUnacked(seqnum QuicPacketSequenceNumber) QuicPacketSequenceNumber {
+	return seqnum - this.LeastUnackedDelta
+}
+
+// GetSerializedSize returns the size of the serialized frame.
+func (this *StopWaitingFrame) GetSerializedSize() int {
+	return 1 + this.DeltaByteSize
+}
+
+// Write serializes the frame at the start of the data and returns the number of bytes written.
+func (this *StopWaitingFrame) Write(b []byte) (int, error) {
+	switch this.DeltaByteSize {
+	case 1, 2, 4, 6:
+	default:
+		return 0, errors.New("StopWaitingFrame.Write : invalid Least Unacked Delta size")
+	}
+	if this.LeastUnackedDelta >= 1<<uint(this.DeltaByteSize<<3) {
+		return 0, errors.New("StopWaitingFrame.Write : Least Unacked Delta too large for the sequence number size")
+	}
+	if err := checkWriteSize(b, this); err != nil {
+		return 0, err
+	}
+	b[0] = QUICFRAMETYPE_STOP_WAITING
+	writeLittleEndian(b[1:], uint64(this.LeastUnackedDelta), this.DeltaByteSize)
+	return 1 + this.DeltaByteSize, nil
+}
+
+// ConnectionCloseFrame is a CONNECTION_CLOSE frame:
+//
+//	+--------+--------+--------+--------+--------+--------+--------+--------+-- --+
+//	|Type (8)|          Error Code (32)          |Reason length(16)| Reason phrase |
+//	+--------+--------+--------+--------+--------+--------+--------+--------+-- --+
+//
+// The reason phrase is not required to be valid UTF-8.
+type ConnectionCloseFrame struct {
+	ErrorCode    QuicErrorCode
+	ReasonPhrase string
+}
+
+// ParseConnectionCloseFrame parses the CONNECTION_CLOSE frame at the start of the data, and returns it with the number of bytes consumed.
+func ParseConnectionCloseFrame(b []byte) (*ConnectionCloseFrame, int, error) {
+	if err := checkFrameType(b, QUICFRAMETYPE_CONNECTION_CLOSE, 7); err != nil {
+		return nil, 0, err
+	}
+	reason, err := parseReasonPhrase(b[5:])
+	if err != nil {
+		return nil, 0, err
+	}
+	return &ConnectionCloseFrame{
+		ErrorCode:    QuicErrorCode(binary.LittleEndian.Uint32(b[1:])),
+		ReasonPhrase: reason}, 7 + len(reason), nil
+}
+
+// GetSerializedSize returns the size of the serialized frame.
+func (this *ConnectionCloseFrame) GetSerializedSize() int {
+	return 7 + len(this.ReasonPhrase)
+}
+
+// Write serializes the frame at the start of the data and returns the number of bytes written.
+func (this *ConnectionCloseFrame) Write(b []byte) (int, error) {
+	if len(this.ReasonPhrase) > QUIC_MAX_REASON_PHRASE_SIZE {
+		return 0, ErrReasonPhraseTooLong
+	}
+	if err := checkWriteSize(b, this); err != nil {
+		return 0, err
+	}
+	b[0] = QUICFRAMETYPE_CONNECTION_CLOSE
+	binary.LittleEndian.PutUint32(b[1:], uint32(this.ErrorCode))
+	return 5 + writeReasonPhrase(b[5:], this.ReasonPhrase), nil
+}
+
+// GoawayFrame is a GOAWAY frame:
+//
+//	+--------+--------+--------+--------+--------+--------+--------+--------+--------+--------+--------+-- --+
+//	|Type (8)|          Error Code (32)          |    Last Good Stream ID (32)       |Reason length(16)|Reason|
+//	+--------+--------+--------+--------+--------+--------+--------+--------+--------+--------+--------+-- --+
+//
+// The reason phrase is not required to be valid UTF-8.
+type GoawayFrame struct {
+	ErrorCode        QuicErrorCode
+	LastGoodStreamID QuicStreamID
+	ReasonPhrase     string
+}
+
+// ParseGoawayFrame parses the GOAWAY frame at the start of the data, and returns it with the number of bytes consumed.
+func ParseGoawayFrame(b []byte) (*GoawayFrame, int, error) {
+	if err := checkFrameType(b, QUICFRAMETYPE_GOAWAY, 11); err != nil {
+		return nil, 0, err
+	}
+	reason, err := parseReasonPhrase(b[9:])
+	if err != nil {
+		return nil, 0, err
+	}
+	return &GoawayFrame{
+		ErrorCode:        QuicErrorCode(binary.LittleEndian.Uint32(b[1:])),
+		LastGoodStreamID: QuicStreamID(binary.LittleEndian.Uint32(b[5:])),
+		ReasonPhrase:     reason}, 11 + len(reason), nil
+}
+
+// GetSerializedSize returns the size of the serialized frame.
+func (this *GoawayFrame) GetSerializedSize() int {
+	return 11 + len(this.ReasonPhrase)
+}
+
+// Write serializes the frame at the start of the data and returns the number of bytes written.
+func (this *GoawayFrame) Write(b []byte) (int, error) {
+	if len(this.ReasonPhrase) > QUIC_MAX_REASON_PHRASE_SIZE {
+		return 0, ErrReasonPhraseTooLong
+	}
+	if err := checkWriteSize(b, this); err != nil {
+		return 0, err
+	}
+	b[0] = QUICFRAMETYPE_GOAWAY
+	binary.LittleEndian.PutUint32(b[1:], uint32(this.ErrorCode))
+	binary.LittleEndian.PutUint32(b[5:], uint32(this.LastGoodStreamID))
+	return 9 + writeReasonPhrase(b[9:], this.ReasonPhrase), nil
+}
+
+// parseReasonPhrase parses the 16-bit reason length and the reason phrase.
+//
+// The length is checked against QUIC_MAX_REASON_PHRASE_SIZE before anything is allocated.
+func parseReasonPhrase(b []byte) (string, error) {
+	l := int(binary.LittleEndian.Uint16(b))
+	if l > QUIC_MAX_REASON_PHRASE_SIZE {
+		return "", ErrReasonPhraseTooLong
+	}
+	if len(b) < 2+l {
+		return "", ErrTruncatedFrame
+	}
+	return string(b[2 : 2+l]), nil
+}
+
+// writeReasonPhrase writes the 16-bit reason length and the reason phrase, and returns the number of bytes written.
+func writeReasonPhrase(b []byte, reason string) int {
+	binary.LittleEndian.PutUint16(b, uint16(len(reason)))
+	return 2 + copy(b[2:], reason)
+}
+
+// PingFrame is a PING frame, it has no field and only asks the peer for an ACK:
+//
+//	+--------+
+//	|Type (8)|
+//	+--------+
+type PingFrame struct {
+}
+
+// ParsePingFrame parses the PING frame at the start of the data, and returns it with the number of bytes consumed.
+func ParsePingFrame(b []byte) (*PingFrame, int, error) {
+	if err := checkFrameType(b, QUICFRAMETYPE_PING, 1); err != nil {
+		return nil, 0, err
+	}
+	return &PingFrame{}, 1, nil
+}
+
+// GetSerializedSize returns the size of the serialized frame.
+func (this *PingFrame) GetSerializedSize() int {
+	return 1
+}
+
+// Write serializes the frame at the start of the data and returns the number of bytes written.
+func (this *PingFrame) Write(b []byte) (int, error) {
+	if err := checkWriteSize(b, this); err != nil {
+		return 0, err
+	}
+	b[0] = QUICFRAMETYPE_PING
+	return 1, nil
+}
+
+// PaddingFrame is a PADDING frame, the type byte and the following bytes up to the end of the packet are zero:
+//
+//	+--------+--------+-- --+--------+
+//	|Type (8)| Padding (all zero)    |
+//	+--------+--------+-- --+--------+
+type PaddingFrame struct {
+	// Size is the size of the frame type byte and the padding bytes
+	Size int
+}
+
+// ParsePaddingFrame parses the PADDING frame at the start of the data, the frame consumes all the data.
+func ParsePaddingFrame(b []byte) (*PaddingFrame, int, error) {
+	if err := checkFrameType(b, QUICFRAMETYPE_PADDING, 1); err != nil {
+		return nil, 0, err
+	}
+	return &PaddingFrame{Size: len(b)}, len(b), nil
+}
+
+// GetSerializedSize returns the size of the serialized frame.
+func (this *PaddingFrame) GetSerializedSize() int {
+	return this.Size
+}
+
+// Write serializes the frame at the start of the data and returns the number of bytes written.
+func (this *PaddingFrame) Write(b []byte) (int, error) {
+	if this.Size < 1 {
+		return 0, errors.New("PaddingFrame.Write : size must be 1 byte at minimum")
+	}
+	if err := checkWriteSize(b, this); err != nil {
+		return 0, err
+	}
+	for i := range b[:this.Size] {
+		b[i] = 0
+	}
+	return this.Size, nil
+}
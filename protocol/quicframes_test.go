@@ -0,0 +1,228 @@
+package protocol
+
+import "testing"
+import "bytes"
+import "encoding/binary"
+import "errors"
+import "reflect"
+
+var tests_controlframes = []struct {
+	frame      Frame
+	seqnumSize int
+	data       []byte
+}{
+	{&RstStreamFrame{StreamID: 0x01020304, ByteOffset: 0x0102030405060708, ErrorCode: 0x0a0b0c0d}, 1,
+		[]byte{0x01, 0x04, 0x03, 0x02, 0x01, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0x0d, 0x0c, 0x0b, 0x0a}},
+	{&WindowUpdateFrame{StreamID: 0, ByteOffset: 0x4000}, 1,
+		[]byte{0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{&BlockedFrame{StreamID: 5}, 1,
+		[]byte{0x05, 0x05, 0x00, 0x00, 0x00}},
+	{&StopWaitingFrame{LeastUnackedDelta: 0x12, DeltaByteSize: 1}, 1,
+		[]byte{0x06, 0x12}},
+	{&StopWaitingFrame{LeastUnackedDelta: 0x1234, DeltaByteSize: 2}, 2,
+		[]byte{0x06, 0x34, 0x12}},
+	{&StopWaitingFrame{LeastUnackedDelta: 0x12345678, DeltaByteSize: 4}, 4,
+		[]byte{0x06, 0x78, 0x56, 0x34, 0x12}},
+	{&StopWaitingFrame{LeastUnackedDelta: 0x123456789abc, DeltaByteSize: 6}, 6,
+		[]byte{0x06, 0xbc, 0x9a, 0x78, 0x56, 0x34, 0x12}},
+	{&ConnectionCloseFrame{ErrorCode: QUIC_PEER_GOING_AWAY, ReasonPhrase: "bye"}, 1,
+		[]byte{0x02, 0x10, 0x00, 0x00, 0x00, 0x03, 0x00, 'b', 'y', 'e'}},
+	{&ConnectionCloseFrame{ErrorCode: QUIC_NO_ERROR}, 1,
+		[]byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{&ConnectionCloseFrame{ErrorCode: QUIC_INTERNAL_ERROR, ReasonPhrase: "\xff\xfe\x00"}, 1,
+		[]byte{0x02, 0x01, 0x00, 0x00, 0x00, 0x03, 0x00, 0xff, 0xfe, 0x00}},
+	{&GoawayFrame{ErrorCode: QUIC_PEER_GOING_AWAY, LastGoodStreamID: 0x0b, ReasonPhrase: "bye"}, 1,
+		[]byte{0x03, 0x10, 0x00, 0x00, 0x00, 0x0b, 0x00, 0x00, 0x00, 0x03, 0x00, 'b', 'y', 'e'}},
+	{&GoawayFrame{ErrorCode: QUIC_NO_ERROR, LastGoodStreamID: 0x01020304}, 1,
+		[]byte{0x03, 0x00, 0x00, 0x00, 0x00, 0x04, 0x03, 0x02, 0x01, 0x00, 0x00}},
+	{&PingFrame{}, 1,
+		[]byte{0x07}},
+	{&StreamFrame{StreamID: 5, Data: []byte{0xaa, 0xbb}}, 1,
+		[]byte{0xa0, 0x05, 0x02, 0x00, 0xaa, 0xbb}},
+}
+
+func Test_ParseNextFrame(t *testing.T) {
+	for i, v := range tests_controlframes {
+		b := make([]byte, len(v.data)+8)
+		s, err := v.frame.Write(b)
+		if err != nil || s != v.frame.GetSerializedSize() || !bytes.Equal(b[:s], v.data) {
+			t.Errorf("Frame.Write : invalid serialized data %x (%v) in test n°%v", b[:s], err, i)
+		}
+		if _, err = v.frame.Write(b[:len(v.data)-1]); err == nil {
+			t.Errorf("Frame.Write : too small buffer must be rejected in test n°%v", i)
+		}
+
+		header := new(QuicPacketHeader)
+		header.SetSequenceNumberSize(v.seqnumSize)
+		f, s, err := ParseNextFrame(v.data, header)
+		if err != nil || s != len(v.data) {
+			t.Fatalf("ParseNextFrame : invalid parsed size %v (%v) in test n°%v", s, err, i)
+		}
+		if !reflect.DeepEqual(f, v.frame) {
+			t.Errorf("ParseNextFrame : invalid frame %+v in test n°%v", f, i)
+		}
+
+		// Truncated frames
+		for l := 0; l < len(v.data); l++ {
+			if _, _, err = ParseNextFrame(v.data[:l], header); !errors.Is(err, ErrTruncatedFrame) {
+				t.Errorf("ParseNextFrame : ErrTruncatedFrame expected for %v bytes in test n°%v instead of %v", l, i, err)
+			}
+		}
+	}
+}
+
+func Test_ControlFrames_Errors(t *testing.T) {
+	header := new(QuicPacketHeader)
+	if _, _, err := ParseNextFrame([]byte{0x10}, header); !errors.Is(err, ErrUnknownFrameType) {
+		t.Errorf("ParseNextFrame : ErrUnknownFrameType expected instead of %v", err)
+	}
+	if _, _, err := ParseRstStreamFrame([]byte{QUICFRAMETYPE_BLOCKED, 0, 0, 0, 0}); err != ErrInvalidFrameType {
+		t.Errorf("ParseRstStreamFrame : ErrInvalidFrameType expected instead of %v", err)
+	}
+	if _, _, err := ParseStopWaitingFrame([]byte{QUICFRAMETYPE_STOP_WAITING, 0, 0, 0}, 3); err == nil {
+		t.Error("ParseStopWaitingFrame : invalid sequence number size must be rejected")
+	}
+
+	f := NewStopWaitingFrame(0x100, 0x180, 1)
+	if f.LeastUnackedDelta != 0x80 || f.GetLeastUnacked(0x180) != 0x100 {
+		t.Errorf("NewStopWaitingFrame : invalid frame %+v", f)
+	}
+	f = NewStopWaitingFrame(0x100, 0x200, 1)
+	if _, err := f.Write(make([]byte, 8)); err == nil {
+		t.Error("StopWaitingFrame.Write : Least Unacked Delta larger than the sequence number size must be rejected")
+	}
+}
+
+var tests_invalidframes = []struct {
+	data []byte
+	code QuicErrorCode
+}{
+	{[]byte{}, QUIC_INVALID_FRAME_DATA},
+	{[]byte{0x08}, QUIC_INVALID_FRAME_DATA},
+	{[]byte{QUICFRAMETYPE_CONGESTION_FEEDBACK, 0x00}, QUIC_INVALID_FRAME_DATA},
+	{[]byte{0xa0, 0x05, 0xff, 0xff, 0xaa}, QUIC_INVALID_STREAM_DATA},
+	{[]byte{0x40 | QUICFLAG_ACK_RESERVED, 0x01, 0x00, 0x00, 0x01, 0x00}, QUIC_INVALID_ACK_DATA},
+	{[]byte{0x40, 0x02, 0x00, 0x00, 0x04, 0x00}, QUIC_INVALID_ACK_DATA},
+	{[]byte{0x01, 0x05, 0x00, 0x00, 0x00}, QUIC_INVALID_RST_STREAM_DATA},
+	{[]byte{0x02, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff}, QUIC_INVALID_CONNECTION_CLOSE_DATA},
+	{[]byte{0x03, 0x00, 0x00, 0x00, 0x00, 0x05, 0x00}, QUIC_INVALID_GOAWAY_DATA},
+	{[]byte{0x04, 0x05, 0x00, 0x00, 0x00}, QUIC_INVALID_WINDOW_UPDATE_DATA},
+	{[]byte{0x05, 0x05}, QUIC_INVALID_BLOCKED_DATA},
+	{[]byte{0x06}, QUIC_INVALID_STOP_WAITING_DATA},
+	// Duplicate ACK and STOP_WAITING frames
+	{[]byte{0x40, 0x01, 0x00, 0x00, 0x01, 0x00, 0x07, 0x40, 0x01, 0x00, 0x00, 0x01, 0x00}, QUIC_INVALID_ACK_DATA},
+	{[]byte{0x06, 0x01, 0x07, 0x06, 0x01}, QUIC_INVALID_STOP_WAITING_DATA},
+}
+
+func Test_ParseFrames_Errors(t *testing.T) {
+	header := new(QuicPacketHeader)
+	header.SetSequenceNumberSize(1)
+	for i, v := range tests_invalidframes {
+		_, err := ParseFrames(v.data, header)
+		if len(v.data) == 0 {
+			_, _, err = ParseNextFrame(v.data, header)
+		}
+		var ferr ErrInvalidFrame
+		if !errors.As(err, &ferr) || ferr.ErrorCode() != v.code {
+			t.Errorf("ParseFrames : ErrInvalidFrame with %v expected instead of %v in test n°%v", v.code, err, i)
+		}
+	}
+
+	// A single ACK and STOP_WAITING frame of each packet
+	if frames, err := ParseFrames([]byte{0x40, 0x01, 0x00, 0x00, 0x01, 0x00, 0x06, 0x01, 0x07}, header); err != nil || len(frames) != 3 {
+		t.Errorf("ParseFrames : 3 frames expected instead of %v (%v)", len(frames), err)
+	}
+}
+
+func Test_ReasonPhrase_Size(t *testing.T) {
+	reason := string(bytes.Repeat([]byte{0xc3}, QUIC_MAX_REASON_PHRASE_SIZE))
+	frames := []Frame{
+		&ConnectionCloseFrame{ErrorCode: QUIC_INTERNAL_ERROR, ReasonPhrase: reason},
+		&GoawayFrame{ErrorCode: QUIC_INTERNAL_ERROR, LastGoodStreamID: 3, ReasonPhrase: reason}}
+	for i, f := range frames {
+		b := make([]byte, f.GetSerializedSize())
+		s, err := f.Write(b)
+		if err != nil || s != len(b) {
+			t.Fatalf("Frame.Write : max-length reason phrase must be accepted (%v) in test n°%v", err, i)
+		}
+		g, s, err := ParseNextFrame(b, new(QuicPacketHeader))
+		if err != nil || s != len(b) || !reflect.DeepEqual(f, g) {
+			t.Errorf("ParseNextFrame : invalid max-length reason phrase frame (%v) in test n°%v", err, i)
+		}
+
+		// One byte over the limit is rejected on both sides, whatever the remaining data size
+		b = append(b, 0x00)
+		binary.LittleEndian.PutUint16(b[s-QUIC_MAX_REASON_PHRASE_SIZE-2:], QUIC_MAX_REASON_PHRASE_SIZE+1)
+		if _, _, err = ParseNextFrame(b, new(QuicPacketHeader)); !errors.Is(err, ErrReasonPhraseTooLong) {
+			t.Errorf("ParseNextFrame : ErrReasonPhraseTooLong expected in test n°%v instead of %v", i, err)
+		}
+		binary.LittleEndian.PutUint16(b[s-QUIC_MAX_REASON_PHRASE_SIZE-2:], 0xffff)
+		if _, _, err = ParseNextFrame(b[:s-QUIC_MAX_REASON_PHRASE_SIZE], new(QuicPacketHeader)); !errors.Is(err, ErrReasonPhraseTooLong) {
+			t.Errorf("ParseNextFrame : ErrReasonPhraseTooLong expected in test n°%v instead of %v", i, err)
+		}
+	}
+
+	f := &ConnectionCloseFrame{ReasonPhrase: reason + "x"}
+	if _, err := f.Write(make([]byte, 2048)); err != ErrReasonPhraseTooLong {
+		t.Errorf("ConnectionCloseFrame.Write : ErrReasonPhraseTooLong expected instead of %v", err)
+	}
+	g := &GoawayFrame{ReasonPhrase: reason + "x"}
+	if _, err := g.Write(make([]byte, 2048)); err != ErrReasonPhraseTooLong {
+		t.Errorf("GoawayFrame.Write : ErrReasonPhraseTooLong expected instead of %v", err)
+	}
+}
+
+func Test_QuicErrorCode_String(t *testing.T) {
+	if s := QUIC_NO_ERROR.String(); s != "QUIC_NO_ERROR" {
+		t.Errorf("QuicErrorCode.String : invalid name %v", s)
+	}
+	if s := QUIC_INVALID_STREAM_ID.String(); s != "QUIC_INVALID_STREAM_ID" {
+		t.Errorf("QuicErrorCode.String : invalid name %v", s)
+	}
+	if s := QuicErrorCode(0xffffffff).String(); s != "QUIC_ERROR_CODE(4294967295)" {
+		t.Errorf("QuicErrorCode.String : invalid name %v", s)
+	}
+}
+
+func Test_PadPacket(t *testing.T) {
+	header := new(QuicPacketHeader)
+	header.SetSequenceNumberSize(1)
+
+	// A packet made of padding only parses to zero frames
+	for _, l := range []int{1, 2, 1200} {
+		frames, err := ParseFrames(make([]byte, l), header)
+		if err != nil || len(frames) != 0 {
+			t.Errorf("ParseFrames : %v bytes of padding must parse to zero frames instead of %v (%v)", l, len(frames), err)
+		}
+	}
+
+	frames := []Frame{&StreamFrame{StreamID: 1, Data: []byte("CHLO")}, &PingFrame{}}
+	for i, target := range []int{9, 10, 11, 1200} {
+		padded, err := PadPacket(frames, target)
+		if err != nil {
+			t.Fatalf("PadPacket : unexpected error %v in test n°%v", err, i)
+		}
+		b := make([]byte, 1500)
+		s, err := WriteFrames(b, padded)
+		if err != nil || s != target {
+			t.Errorf("PadPacket : %v bytes written instead of %v (%v) in test n°%v", s, target, err, i)
+		}
+		parsed, err := ParseFrames(b[:s], header)
+		if err != nil || !reflect.DeepEqual(parsed, frames) {
+			t.Errorf("ParseFrames : invalid frames %v (%v) in test n°%v", parsed, err, i)
+		}
+	}
+	if len(frames) != 2 {
+		t.Error("PadPacket : the frames slice must not be modified")
+	}
+
+	if _, err := PadPacket(frames, 8); err == nil {
+		t.Error("PadPacket : frames larger than the target size must be rejected")
+	}
+	if _, err := PadPacket([]Frame{&StreamFrame{StreamID: 1, OmitDataLength: true}}, 100); err == nil {
+		t.Error("PadPacket : STREAM frame without Data Length field must be rejected")
+	}
+	if _, err := (&PaddingFrame{}).Write(make([]byte, 8)); err == nil {
+		t.Error("PaddingFrame.Write : empty padding must be rejected")
+	}
+}
@@ -0,0 +1,364 @@
+package protocol
+
+import "encoding/binary"
+import "errors"
+
+/*
+
+QuicPacketHeader is the public header of a QUIC packet, with the optional diversification nonce sent by the server:
+
++--------+--------+--- ---+--------+--------+--- ---+--------+--------+--- ---+--------+--------+--- ---+--------+
+| Public |  Connection ID  |   Quic Version  |    Diversification Nonce   |  Sequence Number (8, 16, 32 or 48)   |
+|Flags(8)|  (0,8,32 or 64) |   (32, opt)     |       (256, optional)      |                                      |
++--------+--------+--- ---+--------+--------+--- ---+--------+--------+--- ---+--------+--------+--- ---+--------+
+
+Public flags:
++---+---+---+---+---+---+---+---+
+| 0 |Non| SeqNum| ConnID|Rst|Ver|
++---+---+---+---+---+---+---+---+
+
+FLAGS    SeqNum size  ConnID size
+
+00 00    1            0
+00 01    1            1
+00 10    1            4
+00 11    1            8
+01 00    2            0
+01 01    2            1
+01 10    2            4
+01 11    2            8
+10 00    4            0
+10 01    4            1
+10 10    4            4
+10 11    4            8
+11 00    6            0
+11 01    6            1
+11 10    6            4
+11 11    6            8
+
+*/
+
+var parsePublicheaderConnectionIdSize = []int{0, 1, 4, 8, 0, 1, 4, 8, 0, 1, 4, 8, 0, 1, 4, 8}
+var parsePublicheaderSequenceNumberSize = []int{1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 6, 6, 6, 6}
+
+const (
+	// Mask and flag for Version in QuicPacketHeader
+	QUICFLAG_VERSION = 0x01
+	// Mask and flag for Public reset in QuicPacketHeader
+	QUICFLAG_PUBLICRESET = 0x02
+	// Mask and flags for Connection ID size in QuicPacketHeader
+	QUICMASK_CONNID_SIZE  = 0x0C
+	QUICFLAG_CONNID_64bit = 0x0C
+	QUICFLAG_CONNID_32bit = 0x08
+	QUICFLAG_CONNID_8bit  = 0x04
+	QUICFLAG_CONNID_0bit  = 0x00
+	// Mask and flags for Sequence Number size in QuicPacketHeader
+	QUICMASK_SEQNUM_SIZE  = 0x30
+	QUICFLAG_SEQNUM_48bit = 0x30
+	QUICFLAG_SEQNUM_32bit = 0x20
+	QUICFLAG_SEQNUM_16bit = 0x10
+	QUICFLAG_SEQNUM_8bit  = 0x00
+	// Mask and flag for Diversification Nonce in QuicPacketHeader
+	QUICFLAG_DIVERSIFICATION_NONCE = 0x40
+	// Mask of the reserved bits of the public flags that must be set to 0
+	QUICMASK_RESERVED = 0x80
+	// Size of the diversification nonce
+	QUIC_DIVERSIFICATION_NONCE_SIZE = 32
+)
+
+// ErrReservedFlagBits is returned by ParsePublicHeader when a reserved bit of the public flags is set.
+var ErrReservedFlagBits = errors.New("ParsePublicHeader : reserved bits of the public flags must be set to 0")
+
+// ErrTruncatedHeader is returned by ParsePublicHeader when the data is shorter than the header described by the public flags.
+var ErrTruncatedHeader = errors.New("ParsePublicHeader : too little data for the header described by the public flags")
+
+// ErrInvalidHeaderField is returned by WritePublicHeader when the size of the Connection ID or of the Sequence Number is invalid.
+var ErrInvalidHeaderField = errors.New("QuicPacketHeader.WritePublicHeader : invalid Connection ID or Sequence Number size")
+
+// ErrHeaderBufferTooSmall is returned by WritePublicHeader when the buffer can't contain the serialized header.
+var ErrHeaderBufferTooSmall = errors.New("QuicPacketHeader.WritePublicHeader : data size too small to contain the serialized header")
+
+// QuicPacketHeader
+type QuicPacketHeader struct {
+	// Public flags
+	flagVersion     bool
+	flagPublicReset bool
+	flagNonce       bool
+	connIDByteSize  int
+	seqNumByteSize  int
+	// Public Fields
+	connId  QuicConnectionID
+	version QuicVersion
+	nonce   [QUIC_DIVERSIFICATION_NONCE_SIZE]byte
+	seqNum  QuicPacketSequenceNumber
+}
+
+// ParsePublicHeader parses the public header at the start of the data, and returns it with the number of bytes consumed.
+//
+// The consumed bytes are the associated data of the AEAD that protects the rest of the packet.
+func ParsePublicHeader(b []byte) (*QuicPacketHeader, int, error) {
+	var size int
+
+	if len(b) < 1 {
+		return nil, 0, ErrTruncatedHeader
+	}
+	pf := b[0]
+	if (pf & QUICMASK_RESERVED) != 0 {
+		return nil, 0, ErrReservedFlagBits
+	}
+	h := new(QuicPacketHeader)
+
+	// Public Reset packet: the 64-bit Connection ID only
+	if (pf & QUICFLAG_PUBLICRESET) == QUICFLAG_PUBLICRESET {
+		if len(b) < 9 {
+			return nil, 0, ErrTruncatedHeader
+		}
+		h.flagPublicReset = true
+		h.connIDByteSize = 8
+		h.connId = QuicConnectionID(binary.LittleEndian.Uint64(b[1:]))
+		return h, 9, nil
+	}
+
+	h.flagVersion = (pf & QUICFLAG_VERSION) == QUICFLAG_VERSION
+	h.flagNonce = (pf & QUICFLAG_DIVERSIFICATION_NONCE) == QUICFLAG_DIVERSIFICATION_NONCE
+	h.connIDByteSize = parsePublicheaderConnectionIdSize[(pf>>2)&0x0f]
+	h.seqNumByteSize = parsePublicheaderSequenceNumberSize[(pf>>2)&0x0f]
+	if len(b) < h.GetSerializedSize() {
+		return nil, 0, ErrTruncatedHeader
+	}
+
+	// Parse Connection ID
+	size = 1
+	switch h.connIDByteSize {
+	case 1:
+		h.connId = QuicConnectionID(b[size])
+	case 4:
+		h.connId = QuicConnectionID(binary.LittleEndian.Uint32(b[size:]))
+	case 8:
+		h.connId = QuicConnectionID(binary.LittleEndian.Uint64(b[size:]))
+	}
+	size += h.connIDByteSize
+	// Parse QUIC version if needed
+	if h.flagVersion {
+		h.version = QuicVersion(binary.LittleEndian.Uint32(b[size:]))
+		size += 4
+	}
+	// Parse Diversification Nonce if needed
+	if h.flagNonce {
+		copy(h.nonce[:], b[size:])
+		size += QUIC_DIVERSIFICATION_NONCE_SIZE
+	}
+	// Parse Sequence Number
+	switch h.seqNumByteSize {
+	case 1:
+		h.seqNum = QuicPacketSequenceNumber(b[size])
+	case 2:
+		h.seqNum = QuicPacketSequenceNumber(binary.LittleEndian.Uint16(b[size:]))
+	case 4:
+		h.seqNum = QuicPacketSequenceNumber(binary.LittleEndian.Uint32(b[size:]))
+	case 6:
+		h.seqNum = QuicPacketSequenceNumber(binary.LittleEndian.Uint32(b[size:])) +
+			(QuicPacketSequenceNumber(binary.LittleEndian.Uint16(b[size+4:])) << 32)
+	}
+	size += h.seqNumByteSize
+	return h, size, nil
+}
+
+// GetSerializedSize returns the size of the serialized header.
+func (this *QuicPacketHeader) GetSerializedSize() (size int) {
+	if this.flagPublicReset {
+		return 9
+	}
+	size = 1 + this.connIDByteSize + this.seqNumByteSize
+	if this.flagVersion {
+		size += 4
+	}
+	if this.flagNonce {
+		size += QUIC_DIVERSIFICATION_NONCE_SIZE
+	}
+	return
+}
+
+// WritePublicHeader serializes the header at the start of the data and returns the number of bytes written.
+func (this *QuicPacketHeader) WritePublicHeader(b []byte) (int, error) {
+	var pf byte
+	var size int
+
+	// Serialize Public Reset public header
+	if this.flagPublicReset {
+		if len(b) < 9 {
+			return 0, ErrHeaderBufferTooSmall
+		}
+		b[0] = QUICFLAG_PUBLICRESET | QUICFLAG_CONNID_64bit
+		binary.LittleEndian.PutUint64(b[1:], uint64(this.connId))
+		return 9, nil
+	}
+	if len(b) < this.GetSerializedSize() {
+		return 0, ErrHeaderBufferTooSmall
+	}
+
+	// Serialize Connection ID
+	size = 1
+	switch this.connIDByteSize {
+	case 0:
+		pf = QUICFLAG_CONNID_0bit
+	case 1:
+		pf = QUICFLAG_CONNID_8bit
+		b[size] = byte(this.connId)
+	case 4:
+		pf = QUICFLAG_CONNID_32bit
+		binary.LittleEndian.PutUint32(b[size:], uint32(this.connId))
+	case 8:
+		pf = QUICFLAG_CONNID_64bit
+		binary.LittleEndian.PutUint64(b[size:], uint64(this.connId))
+	default:
+		return 0, ErrInvalidHeaderField
+	}
+	size += this.connIDByteSize
+	// Serialize QUIC version if needed
+	if this.flagVersion {
+		pf |= QUICFLAG_VERSION
+		binary.LittleEndian.PutUint32(b[size:], uint32(this.version))
+		size += 4
+	}
+	// Serialize Diversification Nonce if needed
+	if this.flagNonce {
+		pf |= QUICFLAG_DIVERSIFICATION_NONCE
+		copy(b[size:], this.nonce[:])
+		size += QUIC_DIVERSIFICATION_NONCE_SIZE
+	}
+	// Serialize Sequence Number
+	switch this.seqNumByteSize {
+	case 1:
+		pf |= QUICFLAG_SEQNUM_8bit
+		b[size] = byte(this.seqNum)
+	case 2:
+		pf |= QUICFLAG_SEQNUM_16bit
+		binary.LittleEndian.PutUint16(b[size:], uint16(this.seqNum))
+	case 4:
+		pf |= QUICFLAG_SEQNUM_32bit
+		binary.LittleEndian.PutUint32(b[size:], uint32(this.seqNum))
+	case 6:
+		pf |= QUICFLAG_SEQNUM_48bit
+		binary.LittleEndian.PutUint32(b[size:], uint32(this.seqNum))
+		binary.LittleEndian.PutUint16(b[size+4:], uint16(this.seqNum>>32))
+	default:
+		return 0, ErrInvalidHeaderField
+	}
+	size += this.seqNumByteSize
+	b[0] = pf
+	return size, nil
+}
+
+// GetVersionFlag
+func (this *QuicPacketHeader) GetVersionFlag() bool {
+	return this.flagVersion
+}
+
+// SetVersionFlag
+func (this *QuicPacketHeader) SetVersionFlag(state bool) {
+	this.flagVersion = state
+}
+
+// GetVersion
+func (this *QuicPacketHeader) GetVersion() QuicVersion {
+	return this.version
+}
+
+// SetVersion
+func (this *QuicPacketHeader) SetVersion(version QuicVersion) {
+	this.version = version
+}
+
+// GetPublicResetFlag
+func (this *QuicPacketHeader) GetPublicResetFlag() bool {
+	return this.flagPublicReset
+}
+
+// SetPublicResetFlag
+func (this *QuicPacketHeader) SetPublicResetFlag(state bool) {
+	this.flagPublicReset = state
+}
+
+// GetDiversificationNonce returns the diversification nonce, or nil if the header doesn't contain one.
+func (this *QuicPacketHeader) GetDiversificationNonce() []byte {
+	if !this.flagNonce {
+		return nil
+	}
+	return this.nonce[:]
+}
+
+// SetDiversificationNonce sets the 32 bytes diversification nonce, a nil nonce removes it from the header.
+func (this *QuicPacketHeader) SetDiversificationNonce(nonce []byte) (err error) {
+	if nonce == nil {
+		this.flagNonce = false
+		return
+	}
+	if len(nonce) != QUIC_DIVERSIFICATION_NONCE_SIZE {
+		return errors.New("QuicPacketHeader.SetDiversificationNonce : nonce must be 32 bytes")
+	}
+	this.flagNonce = true
+	copy(this.nonce[:], nonce)
+	return
+}
+
+// GetConnectionID
+func (this *QuicPacketHeader) GetConnectionID() QuicConnectionID {
+	return this.connId
+}
+
+// SetConnectionID
+func (this *QuicPacketHeader) SetConnectionID(connID QuicConnectionID) {
+	this.connId = connID
+}
+
+// OmitConnectionID removes the Connection ID from the header, as negotiated with the TCID tag.
+func (this *QuicPacketHeader) OmitConnectionID() {
+	this.connId = 0
+	this.connIDByteSize = 0
+}
+
+// IsConnectionIDOmitted returns true if the header has no Connection ID.
+func (this *QuicPacketHeader) IsConnectionIDOmitted() bool {
+	return this.connIDByteSize == 0 && !this.flagPublicReset
+}
+
+// GetConnectionIdSize
+func (this *QuicPacketHeader) GetConnectionIdSize() int {
+	return this.connIDByteSize
+}
+
+// SetConnectionIdSize
+func (this *QuicPacketHeader) SetConnectionIdSize(size int) (err error) {
+	switch size {
+	case 0, 1, 4, 8:
+		this.connIDByteSize = size
+		return
+	}
+	return errors.New("QuicPacketHeader.SetConnectionIdSize : invalid size")
+}
+
+// GetSequenceNumber
+func (this *QuicPacketHeader) GetSequenceNumber() QuicPacketSequenceNumber {
+	return this.seqNum
+}
+
+// SetSequenceNumber
+func (this *QuicPacketHeader) SetSequenceNumber(seqNum QuicPacketSequenceNumber) {
+	this.seqNum = seqNum
+}
+
+// GetSequenceNumberSize
+func (this *QuicPacketHeader) GetSequenceNumberSize() int {
+	return this.seqNumByteSize
+}
+
+// SetSequenceNumberSize
+func (this *QuicPacketHeader) SetSequenceNumberSize(size int) (err error) {
+	switch size {
+	case 1, 2, 4, 6:
+		this.seqNumByteSize = size
+		return
+	}
+	return errors.New("QuicPacketHeader.SetSequenceNumberSize : invalid size")
+}
@@ -3,35 +3,7 @@ package protocol
 import "testing"
 import "bytes"
 
-/*
-
-     0        1        2        3        4            8
-+--------+--------+--------+--------+--------+---    ---+
-| Public |    Connection ID (0, 8, 32, or 64)    ...    | ->
-|Flags(8)|      (variable length)                       |
-+--------+--------+--------+--------+--------+---    ---+
-
-     9       10       11        12
-+--------+--------+--------+--------+
-|      Quic Version (32)            | ->
-|         (optional)                |
-+--------+--------+--------+--------+
-
-    13      14       15        16        17       18
-+--------+--------+--------+--------+--------+--------+
-|         Sequence Number (8, 16, 32, or 48)          |
-|                         (variable length)           |
-+--------+--------+--------+--------+--------+--------+
-
-
-Public flags:
-+---+---+---+---+---+---+---+---+
-| 0 | 0 | SeqNum| ConnID|Rst|Ver|
-+---+---+---+---+---+---+---+---+
-
-*/
-
-type testquicpublicheader struct {
+type testquicpacketheader struct {
 	data            []byte
 	flagPublicReset bool
 	flagVersion     bool
@@ -41,7 +13,7 @@ type testquicpublicheader struct {
 	positiveTest    bool
 }
 
-var tests_quicpublicheader = []testquicpublicheader{
+var tests_quicpacketheader = []testquicpacketheader{
 
 	// Tests[0-1] not enough data
 
@@ -138,66 +110,93 @@ var tests_quicpublicheader = []testquicpublicheader{
 		true, false, 0, 0x1122334455667788, 0, true},
 }
 
-func Test_QuicPublicHeader_ParseData(t *testing.T) {
-	var pub QuicPublicHeader
-
-	for i, v := range tests_quicpublicheader {
-		s, err := pub.ParseData(v.data)
-		if v.positiveTest {
-			if err != nil {
-				t.Errorf("ParseData = error %s in test n°%v", err, i)
-			}
-			if s != len(v.data) {
-				t.Errorf("ParseData = invalid parsed size in test n°%v with data[%v]%x", i, len(v.data), v.data)
-			}
-			if pub.GetPublicResetFlag() != v.flagPublicReset {
-				t.Errorf("ParseData = invalid Public reset flag in test n°%v with data[%v]%x", i, len(v.data), v.data)
-			}
-			if pub.GetVersionFlag() != v.flagVersion {
-				t.Errorf("ParseData = invalid Version flag in test n°%v with data[%v]%x", i, len(v.data), v.data)
+func Test_ParsePublicHeader(t *testing.T) {
+	for i, v := range tests_quicpacketheader {
+		h, s, err := ParsePublicHeader(v.data)
+		if !v.positiveTest {
+			if err != ErrTruncatedHeader || h != nil {
+				t.Errorf("ParsePublicHeader : ErrTruncatedHeader expected in test n°%v instead of %v", i, err)
 			}
-			if v.flagVersion {
-				if pub.GetVersion() != v.version {
-					t.Errorf("ParseData = invalid Version %x in test n°%v with data[%v]%x", pub.GetVersion(), i, len(v.data), v.data)
-				}
-			}
-			if pub.GetConnectionID() != v.connId {
-				t.Errorf("ParseData = invalid Connection ID %x in test n°%v with data[%v]%x", pub.GetConnectionID(), i, len(v.data), v.data)
-			}
-			if pub.GetSequenceNumber() != v.seqNum {
-				t.Errorf("ParseData = invalid Sequence Number %x in test n°%v with data[%v]%x", pub.GetSequenceNumber(), i, len(v.data), v.data)
-			}
-		} else if err == nil {
-			t.Errorf("ParseData = missing error in test n°%v with data[%v]%x", i, len(v.data), v.data)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ParsePublicHeader : error %s in test n°%v", err, i)
+		}
+		if s != len(v.data) {
+			t.Errorf("ParsePublicHeader : invalid parsed size %v in test n°%v", s, i)
+		}
+		if h.GetPublicResetFlag() != v.flagPublicReset || h.GetVersionFlag() != v.flagVersion || h.GetDiversificationNonce() != nil {
+			t.Errorf("ParsePublicHeader : invalid flags in test n°%v", i)
+		}
+		if v.flagVersion && h.GetVersion() != v.version {
+			t.Errorf("ParsePublicHeader : invalid Version %x in test n°%v", h.GetVersion(), i)
+		}
+		if h.GetConnectionID() != v.connId || h.GetSequenceNumber() != v.seqNum {
+			t.Errorf("ParsePublicHeader : invalid Connection ID %x or Sequence Number %x in test n°%v", h.GetConnectionID(), h.GetSequenceNumber(), i)
+		}
+
+		// Serialize back
+		data := make([]byte, h.GetSerializedSize())
+		if s, err = h.WritePublicHeader(data); err != nil || s != len(v.data) || !bytes.Equal(data, v.data) {
+			t.Errorf("QuicPacketHeader.WritePublicHeader : invalid serialized data %x (%v) in test n°%v", data[:s], err, i)
 		}
-		pub.Erase()
 	}
 }
 
-func Test_QuicPublicHeader_GetSerializedData(t *testing.T) {
-	var pub QuicPublicHeader
-
-	data := make([]byte, 19)
-	for i, v := range tests_quicpublicheader {
-		if v.positiveTest {
-			pub.SetPublicResetFlag(v.flagPublicReset)
-			pub.SetVersionFlag(v.flagVersion)
-			pub.SetVersion(v.version)
-			pub.SetConnectionID(v.connId)
-			pub.SetConnectionIdSize(parsePublicheaderConnectionIdSize[(v.data[0]>>2)&0x0f])
-			pub.SetSequenceNumber(v.seqNum)
-			pub.SetSequenceNumberSize(parsePublicheaderSequenceNumberSize[(v.data[0]>>2)&0x0f])
-			s, err := pub.GetSerializedData(data)
-			if err != nil {
-				t.Errorf("GetSerializedData = error %s while serialized data in test n°%v", err, i)
-			}
-			if s != len(v.data) {
-				t.Errorf("GetSerializedData = invalid serialized size in test n°%v with data[%v]%x", i, s, data[:s])
-			}
-			if !bytes.Equal(data[:s], v.data) {
-				t.Errorf("GetSerializedData = invalid serialized data in test n°%v with data[%v]%x", i, s, data[:s])
-			}
-			pub.Erase()
-		}
+func Test_ParsePublicHeader_DiversificationNonce(t *testing.T) {
+	nonce := make([]byte, QUIC_DIVERSIFICATION_NONCE_SIZE)
+	for i := range nonce {
+		nonce[i] = byte(i)
+	}
+	data := append([]byte{QUICFLAG_DIVERSIFICATION_NONCE | QUICFLAG_CONNID_64bit | QUICFLAG_SEQNUM_16bit, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11}, nonce...)
+	data = append(data, 0x0d, 0x0c)
+
+	h, s, err := ParsePublicHeader(append(data, 0xff, 0xff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != len(data) || s != 43 {
+		t.Errorf("ParsePublicHeader : invalid parsed size %v", s)
+	}
+	if !bytes.Equal(h.GetDiversificationNonce(), nonce) || h.GetConnectionID() != 0x1122334455667788 || h.GetSequenceNumber() != 0x0c0d {
+		t.Errorf("ParsePublicHeader : invalid Diversification Nonce, Connection ID or Sequence Number")
+	}
+
+	var w QuicPacketHeader
+	w.SetConnectionID(0x1122334455667788)
+	w.SetConnectionIdSize(8)
+	w.SetSequenceNumber(0x0c0d)
+	w.SetSequenceNumberSize(2)
+	if err = w.SetDiversificationNonce(nonce[:31]); err == nil {
+		t.Error("QuicPacketHeader.SetDiversificationNonce : 31 bytes nonce must be rejected")
+	}
+	w.SetDiversificationNonce(nonce)
+	out := make([]byte, 64)
+	if s, err = w.WritePublicHeader(out); err != nil || !bytes.Equal(out[:s], data) {
+		t.Errorf("QuicPacketHeader.WritePublicHeader : invalid serialized data %x (%v)", out[:s], err)
+	}
+	if _, err = w.WritePublicHeader(out[:42]); err != ErrHeaderBufferTooSmall {
+		t.Errorf("QuicPacketHeader.WritePublicHeader : ErrHeaderBufferTooSmall expected instead of %v", err)
+	}
+
+	// Truncated nonce
+	if _, _, err = ParsePublicHeader(data[:40]); err != ErrTruncatedHeader {
+		t.Errorf("ParsePublicHeader : ErrTruncatedHeader expected instead of %v", err)
+	}
+}
+
+func Test_ParsePublicHeader_ReservedBits(t *testing.T) {
+	if _, _, err := ParsePublicHeader([]byte{QUICMASK_RESERVED | QUICFLAG_SEQNUM_8bit, 0x0d}); err != ErrReservedFlagBits {
+		t.Errorf("ParsePublicHeader : ErrReservedFlagBits expected instead of %v", err)
+	}
+	if _, _, err := ParsePublicHeader([]byte{QUICMASK_RESERVED}); err != ErrReservedFlagBits {
+		t.Errorf("ParsePublicHeader : ErrReservedFlagBits expected before ErrTruncatedHeader instead of %v", err)
+	}
+
+	var h QuicPacketHeader
+	h.SetSequenceNumberSize(1)
+	h.connIDByteSize = 3
+	if _, err := h.WritePublicHeader(make([]byte, 16)); err != ErrInvalidHeaderField {
+		t.Errorf("QuicPacketHeader.WritePublicHeader : ErrInvalidHeaderField expected instead of %v", err)
 	}
 }
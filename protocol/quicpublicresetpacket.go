@@ -1,5 +1,6 @@
 package protocol
 
+import "crypto/subtle"
 import "encoding/binary"
 import "errors"
 
@@ -87,10 +88,14 @@ func (this *QuicPublicResetPacket) ParseData(data []byte) (size int, err error)
 		// Read uint32 offset
 		endOffsets[i] = uint32(binary.LittleEndian.Uint32(data[size:]))
 		size += 4
+		if i > 0 && endOffsets[i] < endOffsets[i-1] {
+			err = errors.New("QuicPublicResetPacket.ParseData : invalid Public Reset packet, tag value end offsets must be increasing")
+			return
+		}
 	}
 	// Ask for next data size
 	needMoreData += int(endOffsets[numEntries-1])
-	if l < needMoreData {
+	if l < needMoreData || needMoreData < size {
 		err = errors.New("QuicPublicResetPacket.ParseData : data size too small to contain Public Reset packet")
 		return
 	}
@@ -180,3 +185,55 @@ func (this *QuicPublicResetPacket) SetRejectedSequenceNumber(seqnum QuicPacketSe
 		this.msg.AddTagValue(TagRSEQ, this.buffer[8:16])
 	}
 }
+
+// PublicResetPacket is a complete Public Reset packet: the public header with the Public Reset flag and the 64-bit Connection ID,
+// followed by the PRST message with the RNON and RSEQ tag/value pairs.
+type PublicResetPacket struct {
+	ConnectionID           QuicConnectionID
+	RejectedSequenceNumber QuicPacketSequenceNumber
+	NonceProof             uint64
+}
+
+// BuildPublicReset returns the Public Reset packet sent by a server that has no state for the connection.
+func BuildPublicReset(connID QuicConnectionID, rejectedPN QuicPacketSequenceNumber, nonceProof uint64) []byte {
+	var reset QuicPublicResetPacket
+
+	reset.SetNonceProof(QuicPublicResetNonceProof(nonceProof))
+	reset.SetRejectedSequenceNumber(rejectedPN)
+	b := make([]byte, 9+reset.GetSerializedSize())
+	b[0] = QUICFLAG_PUBLICRESET | QUICFLAG_CONNID_64bit
+	binary.LittleEndian.PutUint64(b[1:], uint64(connID))
+	reset.GetSerializedData(b[9:])
+	return b
+}
+
+// ParsePublicReset parses a complete Public Reset packet, unknown tags of the PRST message are ignored.
+//
+// The packet is not authenticated: the client must check the nonce proof with VerifyNonceProof before closing the connection.
+func ParsePublicReset(b []byte) (*PublicResetPacket, error) {
+	var reset QuicPublicResetPacket
+
+	header, size, err := ParsePublicHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	if !header.GetPublicResetFlag() {
+		return nil, errors.New("ParsePublicReset : Public Reset flag required")
+	}
+	if _, err = reset.ParseData(b[size:]); err != nil {
+		return nil, err
+	}
+	return &PublicResetPacket{
+		ConnectionID:           header.GetConnectionID(),
+		RejectedSequenceNumber: reset.GetRejectedSequenceNumber(),
+		NonceProof:             uint64(reset.GetNonceProof())}, nil
+}
+
+// VerifyNonceProof returns true if the nonce proof of the packet is the one received from the server during the handshake.
+func (this *PublicResetPacket) VerifyNonceProof(nonceProof uint64) bool {
+	var a, b [8]byte
+
+	binary.LittleEndian.PutUint64(a[:], this.NonceProof)
+	binary.LittleEndian.PutUint64(b[:], nonceProof)
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
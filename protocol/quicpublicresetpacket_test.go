@@ -145,7 +145,7 @@ func Test_QuicPublicRestPacket_ParseData(t *testing.T) {
 				t.Errorf("QuicPublicRestPacket.ParseData : invalid rejected sequence number %x in test %x with data[%v]%x", reset.GetRejectedSequenceNumber(), i, len(v.data), v.data)
 			}
 		} else if err == nil {
-			t.Error("QuicPublicRestPacket.ParseData : missing error in test %x with data[%v]%x", i, len(v.data), v.data)
+			t.Errorf("QuicPublicRestPacket.ParseData : missing error in test %x with data[%v]%x", i, len(v.data), v.data)
 		}
 	}
 }
@@ -173,3 +173,58 @@ func Test_QuicPublicRestPacket_GetSerializedData(t *testing.T) {
 	}
 
 }
+
+func Test_PublicResetPacket(t *testing.T) {
+	b := BuildPublicReset(0x0102030405060708, 0x0a0b0c0daabbccdd, 0xcafebabecefedade)
+	data := append([]byte{0x0e, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01}, tests_quicpublicresetpacket[0].data...)
+	if !bytes.Equal(b, data) {
+		t.Errorf("BuildPublicReset : invalid packet %x", b)
+	}
+	reset, err := ParsePublicReset(b)
+	if err != nil {
+		t.Fatalf("ParsePublicReset : unexpected error %v", err)
+	}
+	if reset.ConnectionID != 0x0102030405060708 || reset.RejectedSequenceNumber != 0x0a0b0c0daabbccdd || reset.NonceProof != 0xcafebabecefedade {
+		t.Errorf("ParsePublicReset : invalid packet %+v", reset)
+	}
+	if !reset.VerifyNonceProof(0xcafebabecefedade) || reset.VerifyNonceProof(0xcafebabecefedadf) {
+		t.Error("PublicResetPacket.VerifyNonceProof : invalid nonce proof verification")
+	}
+
+	// Missing RNON
+	missing := append([]byte{0x0e, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01}, tests_quicpublicresetpacket[2].data...)
+	if _, err = ParsePublicReset(missing); err == nil {
+		t.Error("ParsePublicReset : Public Reset packet without RNON must be rejected")
+	}
+
+	// Extra unknown tags
+	extra := []byte{0x0e, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01,
+		0x50, 0x52, 0x53, 0x54, // Tag 'PRST'
+		0x04, 0x00, 0x00, 0x00, // Num entries (uint16) + 2 bytes of padding
+		0x43, 0x41, 0x44, 0x52, // Tag 'CADR'
+		0x02, 0x00, 0x00, 0x00, //     'CADR' offset
+		0x52, 0x4e, 0x4f, 0x4e, // Tag 'RNON'
+		0x0a, 0x00, 0x00, 0x00, //     'RNON' offset
+		0x52, 0x53, 0x45, 0x51, // Tag 'RSEQ'
+		0x12, 0x00, 0x00, 0x00, //     'RSEQ' offset
+		0x58, 0x58, 0x58, 0x58, // Tag 'XXXX'
+		0x15, 0x00, 0x00, 0x00, //     'XXXX' offset
+		0xaa, 0xbb, // CADR value
+		0xde, 0xda, 0xfe, 0xce, 0xbe, 0xba, 0xfe, 0xca, // RNON value
+		0xdd, 0xcc, 0xbb, 0xaa, 0x0d, 0x0c, 0x0b, 0x0a, // Rejected Sequence Number
+		0x01, 0x02, 0x03} // XXXX value
+	if reset, err = ParsePublicReset(extra); err != nil || reset.NonceProof != 0xcafebabecefedade || reset.RejectedSequenceNumber != 0x0a0b0c0daabbccdd {
+		t.Errorf("ParsePublicReset : unknown tags must be ignored %+v (%v)", reset, err)
+	}
+
+	// Decreasing tag value end offsets
+	extra[9+8+4] = 0x0b
+	if _, err = ParsePublicReset(extra); err == nil {
+		t.Error("ParsePublicReset : decreasing end offsets must be rejected")
+	}
+
+	// Not a Public Reset packet
+	if _, err = ParsePublicReset(append([]byte{0x0c, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0x01}, tests_quicpublicresetpacket[0].data...)); err == nil {
+		t.Error("ParsePublicReset : packet without the Public Reset flag must be rejected")
+	}
+}
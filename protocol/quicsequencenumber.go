@@ -0,0 +1,58 @@
+package protocol
+
+// QuicPacketSequenceNumber is the sequence number of a packet, sent truncated in the public header.
+type QuicPacketSequenceNumber uint64
+
+// MAX_SEQNUM is the largest packet sequence number, QUIC sequence numbers are 48-bit.
+const MAX_SEQNUM = QuicPacketSequenceNumber(1<<48 - 1)
+
+// TruncateSequenceNumber returns the number of bytes (1, 2, 4 or 6) needed to send the full sequence number, and its truncated value.
+//
+// The truncated value must be unambiguous for the receiver: the number of bytes is chosen so that the sequence number space
+// covers twice the distance between the full sequence number and the largest acknowledged sequence number.
+func TruncateSequenceNumber(full QuicPacketSequenceNumber, largestAcked QuicPacketSequenceNumber) (bytesNeeded int, truncated uint64) {
+	var unacked uint64
+
+	if full > largestAcked {
+		unacked = uint64(full - largestAcked)
+	} else {
+		unacked = 1
+	}
+	switch {
+	case unacked < 1<<7:
+		bytesNeeded = 1
+	case unacked < 1<<15:
+		bytesNeeded = 2
+	case unacked < 1<<31:
+		bytesNeeded = 4
+	default:
+		bytesNeeded = 6
+	}
+	truncated = uint64(full) & (1<<uint(bytesNeeded<<3) - 1)
+	return
+}
+
+// InferSequenceNumber returns the full sequence number closest to the next expected one (largestReceived + 1) whose low nbytes bytes are truncated.
+//
+// The candidates are the values of the expected sequence number epoch, the previous and the next epoch, where an epoch is the
+// range of sequence numbers sharing the same bytes above the nbytes low bytes. A candidate out of the 48-bit range is never returned.
+func InferSequenceNumber(truncated uint64, nbytes int, largestReceived QuicPacketSequenceNumber) QuicPacketSequenceNumber {
+	if nbytes < 1 || nbytes > 6 {
+		return QuicPacketSequenceNumber(truncated) & MAX_SEQNUM
+	}
+	win := uint64(1) << uint(nbytes<<3)
+	hwin := win >> 1
+	mask := win - 1
+	expected := uint64(largestReceived) + 1
+	candidate := (expected &^ mask) | (truncated & mask)
+
+	switch {
+	case candidate+hwin <= expected && candidate+win <= uint64(MAX_SEQNUM):
+		// Next epoch is closer
+		candidate += win
+	case candidate > expected+hwin && candidate >= win:
+		// Previous epoch is closer
+		candidate -= win
+	}
+	return QuicPacketSequenceNumber(candidate)
+}
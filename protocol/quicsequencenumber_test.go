@@ -0,0 +1,72 @@
+package protocol
+
+import "testing"
+
+var tests_truncatesequencenumber = []struct {
+	full         QuicPacketSequenceNumber
+	largestAcked QuicPacketSequenceNumber
+	bytesNeeded  int
+	truncated    uint64
+}{
+	{0, 0, 1, 0},
+	{1, 0, 1, 1},
+	{127, 0, 1, 127},
+	{128, 0, 2, 128},
+	{0x1234, 0x1200, 1, 0x34},
+	{0x12345, 0x12300, 1, 0x45},
+	{0x12345, 0x11345, 2, 0x2345},
+	{0x12345, 0x2345, 4, 0x12345},
+	{0x8000, 0, 4, 0x8000},
+	{0xabcdef12, 0xab000000, 4, 0xabcdef12},
+	{0x123480000000, 0x1234, 6, 0x123480000000},
+	{0x1000, 0x2000, 1, 0x00},
+	{MAX_SEQNUM, MAX_SEQNUM - 1, 1, 0xff},
+}
+
+func Test_TruncateSequenceNumber(t *testing.T) {
+	for i, v := range tests_truncatesequencenumber {
+		n, truncated := TruncateSequenceNumber(v.full, v.largestAcked)
+		if n != v.bytesNeeded || truncated != v.truncated {
+			t.Errorf("TruncateSequenceNumber : invalid result (%d, %x) for test %d", n, truncated, i)
+		}
+		// The receiver must recover the full sequence number
+		if v.full > v.largestAcked {
+			if full := InferSequenceNumber(truncated, n, v.largestAcked); full != v.full {
+				t.Errorf("TruncateSequenceNumber : inferred sequence number %x instead of %x for test %d", full, v.full, i)
+			}
+		}
+	}
+}
+
+var tests_infersequencenumber = []struct {
+	truncated       uint64
+	nbytes          int
+	largestReceived QuicPacketSequenceNumber
+	full            QuicPacketSequenceNumber
+}{
+	// Same epoch
+	{0x05, 1, 0x00, 0x05},
+	{0x34, 1, 0x1230, 0x1234},
+	// Truncated value far below the expected one : next epoch
+	{0x02, 1, 0x1fe, 0x202},
+	{0x9b32, 2, 0xa82f30ea, 0xa82f9b32},
+	{0x0001, 2, 0xfffe, 0x10001},
+	// Truncated value far above the expected one : previous epoch
+	{0xff, 1, 0x201, 0x1ff},
+	{0xfffe, 2, 0x10002, 0xfffe},
+	// No previous epoch below zero
+	{0xff, 1, 0x01, 0xff},
+	// No next epoch above the 48-bit range
+	{0x00, 1, MAX_SEQNUM - 1, MAX_SEQNUM - 0xff},
+	{0xfffffff0, 4, 0xfffffffffff0, 0xfffffffffff0},
+	// 6 bytes sequence numbers are not truncated
+	{0x123456789abc, 6, 0x10, 0x123456789abc},
+}
+
+func Test_InferSequenceNumber(t *testing.T) {
+	for i, v := range tests_infersequencenumber {
+		if full := InferSequenceNumber(v.truncated, v.nbytes, v.largestReceived); full != v.full {
+			t.Errorf("InferSequenceNumber : invalid sequence number %x instead of %x for test %d", full, v.full, i)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package protocol
+
+import "errors"
+
+// ErrTruncatedFrame is returned when the data is shorter than the frame described by its frame type and fields.
+var ErrTruncatedFrame = errors.New("ParseFrame : not enough data to parse the frame")
+
+// ErrInvalidFrameType is returned when a frame parser is called on data that starts with another frame type.
+var ErrInvalidFrameType = errors.New("ParseFrame : invalid frame type")
+
+// StreamFrame is a STREAM frame:
+//
+//	+--------+--------+--- ---+--------+--------+--- ---+--------+--------+--------+--- ---+--------+
+//	|Type (8)|   Stream ID (8-32)    |  Offset (0, 16-64)      |Data len (16,opt)|   Stream Data    |
+//	+--------+--------+--- ---+--------+--------+--- ---+--------+--------+--------+--- ---+--------+
+//
+// When the Data Length field is omitted, the stream data extends to the end of the packet and the frame must be the last one of the packet.
+type StreamFrame struct {
+	StreamID QuicStreamID
+	Offset   QuicByteOffset
+	Data     []byte
+	FIN      bool
+	// OmitDataLength serializes the frame without the Data Length field, for the last frame of a packet
+	OmitDataLength bool
+}
+
+// ParseStreamFrame parses the STREAM frame at the start of the data, and returns it with the number of bytes consumed.
+//
+// The Data field of the returned frame is a slice of the input data.
+func ParseStreamFrame(b []byte) (*StreamFrame, int, error) {
+	var size int
+
+	if len(b) < 1 {
+		return nil, 0, ErrTruncatedFrame
+	}
+	ft := b[0]
+	if (ft & QUICFRAMETYPE_STREAM_MASK) != QUICFRAMETYPE_STREAM {
+		return nil, 0, ErrInvalidFrameType
+	}
+	f := &StreamFrame{
+		FIN:            (ft & QUICFLAG_FIN) == QUICFLAG_FIN,
+		OmitDataLength: (ft & QUICFLAG_DATALENGTH) == 0}
+	streamIdSize := int(parseStreamIdSize[ft&0x1f])
+	offsetSize := int(parseByteOffsetSize[ft&0x1f])
+	size = 1 + streamIdSize + offsetSize
+	if !f.OmitDataLength {
+		size += 2
+	}
+	if len(b) < size {
+		return nil, 0, ErrTruncatedFrame
+	}
+
+	// Parse Stream ID (8-bit to 32-bit) and Byte Offset (0-bit to 64-bit)
+	size = 1
+	for i := 0; i < streamIdSize; i++ {
+		f.StreamID |= QuicStreamID(b[size]) << uint(i<<3)
+		size++
+	}
+	for i := 0; i < offsetSize; i++ {
+		f.Offset |= QuicByteOffset(b[size]) << uint(i<<3)
+		size++
+	}
+	// Parse Data Length (16-bit) or use the rest of the packet
+	l := len(b) - size
+	if !f.OmitDataLength {
+		l = int(b[size]) | int(b[size+1])<<8
+		size += 2
+		if len(b) < size+l {
+			return nil, 0, ErrTruncatedFrame
+		}
+	}
+	f.Data = b[size : size+l]
+	size += l
+	return f, size, nil
+}
+
+// streamIdByteSize returns the minimal number of bytes (1 to 4) of the Stream ID.
+func (this *StreamFrame) streamIdByteSize() int {
+	switch {
+	case this.StreamID < 1<<8:
+		return 1
+	case this.StreamID < 1<<16:
+		return 2
+	case this.StreamID < 1<<24:
+		return 3
+	}
+	return 4
+}
+
+// offsetByteSize returns the minimal number of bytes (0, 2 to 8) of the Byte Offset.
+func (this *StreamFrame) offsetByteSize() int {
+	if this.Offset == 0 {
+		return 0
+	}
+	n := 2
+	for n < 8 && this.Offset >= 1<<uint(n<<3) {
+		n++
+	}
+	return n
+}
+
+// GetSerializedSize returns the size of the serialized frame.
+func (this *StreamFrame) GetSerializedSize() int {
+	size := 1 + this.streamIdByteSize() + this.offsetByteSize() + len(this.Data)
+	if !this.OmitDataLength {
+		size += 2
+	}
+	return size
+}
+
+// Write serializes the frame at the start of the data with the minimal Stream ID and Byte Offset sizes, and returns the number of bytes written.
+func (this *StreamFrame) Write(b []byte) (int, error) {
+	var size int
+
+	if !this.OmitDataLength && len(this.Data) > 0xffff {
+		return 0, errors.New("StreamFrame.Write : data can't exceed 65535 bytes with a Data Length field")
+	}
+	if len(b) < this.GetSerializedSize() {
+		return 0, errors.New("StreamFrame.Write : data size too small to contain the serialized frame")
+	}
+	streamIdSize := this.streamIdByteSize()
+	offsetSize := this.offsetByteSize()
+
+	// Serialize frame type
+	ft := byte(QUICFRAMETYPE_STREAM) | byte(streamIdSize-1)
+	if offsetSize > 0 {
+		ft |= byte(offsetSize-1) << 2
+	}
+	if this.FIN {
+		ft |= QUICFLAG_FIN
+	}
+	if !this.OmitDataLength {
+		ft |= QUICFLAG_DATALENGTH
+	}
+	b[0] = ft
+	size = 1
+	// Serialize Stream ID, Byte Offset and Data Length
+	for i := 0; i < streamIdSize; i++ {
+		b[size] = byte(this.StreamID >> uint(i<<3))
+		size++
+	}
+	for i := 0; i < offsetSize; i++ {
+		b[size] = byte(this.Offset >> uint(i<<3))
+		size++
+	}
+	if !this.OmitDataLength {
+		b[size] = byte(len(this.Data))
+		b[size+1] = byte(len(this.Data) >> 8)
+		size += 2
+	}
+	// Serialize stream data
+	size += copy(b[size:], this.Data)
+	return size, nil
+}
@@ -0,0 +1,103 @@
+package protocol
+
+import "testing"
+import "bytes"
+
+var tests_streamframe = []struct {
+	frame StreamFrame
+	data  []byte
+}{
+	{StreamFrame{StreamID: 5, Data: []byte{0xaa, 0xbb}},
+		[]byte{0xa0, 0x05, 0x02, 0x00, 0xaa, 0xbb}},
+	{StreamFrame{StreamID: 5, FIN: true},
+		[]byte{0xe0, 0x05, 0x00, 0x00}},
+	{StreamFrame{StreamID: 0x0102, Offset: 0x10, Data: []byte{0xaa}},
+		[]byte{0xa5, 0x02, 0x01, 0x10, 0x00, 0x01, 0x00, 0xaa}},
+	{StreamFrame{StreamID: 0x010203, Offset: 0x010000, Data: []byte{0xaa}},
+		[]byte{0xaa, 0x03, 0x02, 0x01, 0x00, 0x00, 0x01, 0x01, 0x00, 0xaa}},
+	{StreamFrame{StreamID: 0x01020304, Offset: 0x0102030405060708, FIN: true, Data: []byte{0xaa}},
+		[]byte{0xff, 0x04, 0x03, 0x02, 0x01, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0x01, 0x00, 0xaa}},
+	{StreamFrame{StreamID: 3, Offset: 0x0100000000, Data: []byte{0xaa}},
+		[]byte{0xb0, 0x03, 0x00, 0x00, 0x00, 0x00, 0x01, 0x01, 0x00, 0xaa}},
+	// Last frame of the packet
+	{StreamFrame{StreamID: 5, Offset: 0x1234, Data: []byte{0xaa, 0xbb, 0xcc}, OmitDataLength: true},
+		[]byte{0x84, 0x05, 0x34, 0x12, 0xaa, 0xbb, 0xcc}},
+	{StreamFrame{StreamID: 5, FIN: true, OmitDataLength: true},
+		[]byte{0xc0, 0x05}},
+}
+
+func Test_StreamFrame(t *testing.T) {
+	for i, v := range tests_streamframe {
+		b := make([]byte, 32)
+		s, err := v.frame.Write(b)
+		if err != nil || s != v.frame.GetSerializedSize() || !bytes.Equal(b[:s], v.data) {
+			t.Errorf("StreamFrame.Write : invalid serialized data %x (%v) in test n°%v", b[:s], err, i)
+		}
+
+		f, s, err := ParseStreamFrame(v.data)
+		if err != nil || s != len(v.data) {
+			t.Fatalf("ParseStreamFrame : invalid parsed size %v (%v) in test n°%v", s, err, i)
+		}
+		if f.StreamID != v.frame.StreamID || f.Offset != v.frame.Offset || f.FIN != v.frame.FIN || f.OmitDataLength != v.frame.OmitDataLength || !bytes.Equal(f.Data, v.frame.Data) {
+			t.Errorf("ParseStreamFrame : invalid frame %+v in test n°%v", f, i)
+		}
+
+		// Truncated frames, the last frame form can't be truncated inside its data
+		l := len(v.data) - 1
+		if v.frame.OmitDataLength {
+			l = len(v.data) - len(v.frame.Data) - 1
+		}
+		if _, _, err = ParseStreamFrame(v.data[:l]); err != ErrTruncatedFrame {
+			t.Errorf("ParseStreamFrame : ErrTruncatedFrame expected in test n°%v instead of %v", i, err)
+		}
+	}
+}
+
+func Test_StreamFrame_Errors(t *testing.T) {
+	if _, _, err := ParseStreamFrame([]byte{QUICFRAMETYPE_PING}); err != ErrInvalidFrameType {
+		t.Errorf("ParseStreamFrame : ErrInvalidFrameType expected instead of %v", err)
+	}
+	if _, _, err := ParseStreamFrame(nil); err != ErrTruncatedFrame {
+		t.Errorf("ParseStreamFrame : ErrTruncatedFrame expected instead of %v", err)
+	}
+
+	f := StreamFrame{StreamID: 1, Data: make([]byte, 0x10000)}
+	if _, err := f.Write(make([]byte, 0x10010)); err == nil {
+		t.Error("StreamFrame.Write : data longer than 65535 bytes must be rejected with a Data Length field")
+	}
+	f.OmitDataLength = true
+	if _, err := f.Write(make([]byte, 0x10010)); err != nil {
+		t.Errorf("StreamFrame.Write : data longer than 65535 bytes must be accepted for the last frame : %v", err)
+	}
+	if _, err := f.Write(make([]byte, 0x10001)); err == nil {
+		t.Error("StreamFrame.Write : too small buffer must be rejected")
+	}
+}
+
+func Fuzz_ParseStreamFrame(f *testing.F) {
+	for _, v := range tests_streamframe {
+		f.Add(v.data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		frame, s, err := ParseStreamFrame(data)
+		if err != nil {
+			return
+		}
+		if s > len(data) {
+			t.Fatalf("ParseStreamFrame : parsed size %d greater than data size %d", s, len(data))
+		}
+		// The minimal serialization can't be longer than the parsed frame
+		if l := frame.GetSerializedSize(); l > s {
+			t.Fatalf("StreamFrame.GetSerializedSize : minimal size %d greater than parsed size %d", l, s)
+		}
+		out := make([]byte, s)
+		n, err := frame.Write(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, _, err := ParseStreamFrame(out[:n])
+		if err != nil || again.StreamID != frame.StreamID || again.Offset != frame.Offset || again.FIN != frame.FIN || !bytes.Equal(again.Data, frame.Data) {
+			t.Fatalf("ParseStreamFrame : round trip failure %+v versus %+v (%v)", again, frame, err)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package protocol
+
+import "errors"
+
+// QuicStreamID is the ID of a stream of the connection.
+type QuicStreamID uint32
+
+// Streams opened by the client have odd IDs and streams opened by the server have even IDs, the Stream ID 0 is the connection.
+const (
+	// QUIC_CRYPTO_STREAM_ID is the stream of the crypto handshake messages
+	QUIC_CRYPTO_STREAM_ID QuicStreamID = 1
+	// QUIC_HEADERS_STREAM_ID is the stream of the compressed headers of the SPDY/HTTP mapping
+	QUIC_HEADERS_STREAM_ID QuicStreamID = 3
+	// QUIC_MAX_STREAM_ID is the largest Stream ID
+	QUIC_MAX_STREAM_ID QuicStreamID = 1<<32 - 1
+)
+
+// ErrInvalidStreamID is returned when a Stream ID doesn't belong to the perspective that opens it.
+var ErrInvalidStreamID = errors.New("QuicStreamID : invalid Stream ID for the perspective")
+
+// ErrTooManyOpenStreams is returned when the peer opens a stream beyond the negotiated maximum number of streams (MSPC).
+var ErrTooManyOpenStreams = errors.New("PeerStreamIDs.Open : too many open streams")
+
+// IsClientInitiated returns true if the stream is opened by the client.
+func (this QuicStreamID) IsClientInitiated() bool {
+	return (this & 1) == 1
+}
+
+// IsInitiatedBy returns true if the stream can be opened by the perspective.
+func (this QuicStreamID) IsInitiatedBy(perspective Perspective) bool {
+	return this != 0 && this.IsClientInitiated() == (perspective == PERSPECTIVE_CLIENT)
+}
+
+// IsCryptoStream returns true for the crypto handshake stream.
+func (this QuicStreamID) IsCryptoStream() bool {
+	return this == QUIC_CRYPTO_STREAM_ID
+}
+
+// IsHeadersStream returns true for the headers stream of the SPDY/HTTP mapping.
+func (this QuicStreamID) IsHeadersStream() bool {
+	return this == QUIC_HEADERS_STREAM_ID
+}
+
+// NextStreamID returns the Stream ID that the perspective opens after the current one, or its first Stream ID if the current one is 0.
+func NextStreamID(current QuicStreamID, perspective Perspective) (QuicStreamID, error) {
+	if current == 0 {
+		if perspective == PERSPECTIVE_CLIENT {
+			return 1, nil
+		}
+		return 2, nil
+	}
+	if !current.IsInitiatedBy(perspective) {
+		return 0, ErrInvalidStreamID
+	}
+	if current > QUIC_MAX_STREAM_ID-2 {
+		return 0, errors.New("NextStreamID : no more Stream ID available")
+	}
+	return current + 2, nil
+}
+
+// PeerStreamIDs tracks the streams opened by the peer, and rejects the Stream IDs beyond the negotiated maximum number of streams.
+//
+// A peer can skip Stream IDs: the skipped streams are implicitly opened, and count in the open streams.
+// The crypto and headers streams are always open and don't count. A stream closed twice, by a RST_STREAM then its FIN,
+// releases a single slot: the open streams are tracked by Stream ID.
+type PeerStreamIDs struct {
+	peer       Perspective
+	largest    QuicStreamID
+	maxStreams int
+	open       map[QuicStreamID]struct{}
+}
+
+// NewPeerStreamIDs returns the PeerStreamIDs of the peer perspective, with the maximum number of open streams.
+func NewPeerStreamIDs(peer Perspective, maxStreams int) *PeerStreamIDs {
+	ids := &PeerStreamIDs{peer: peer, maxStreams: maxStreams, open: make(map[QuicStreamID]struct{})}
+	if peer == PERSPECTIVE_CLIENT {
+		ids.largest = QUIC_HEADERS_STREAM_ID
+	}
+	return ids
+}
+
+// SetMaxStreams changes the maximum number of open streams, the streams already open are kept.
+func (this *PeerStreamIDs) SetMaxStreams(maxStreams int) {
+	this.maxStreams = maxStreams
+}
+
+// MaxStreamID returns the largest Stream ID the peer can open now.
+func (this *PeerStreamIDs) MaxStreamID() QuicStreamID {
+	if len(this.open) >= this.maxStreams {
+		return this.largest
+	}
+	max := uint64(this.largest) + 2*uint64(this.maxStreams-len(this.open))
+	if max > uint64(QUIC_MAX_STREAM_ID) {
+		return QUIC_MAX_STREAM_ID
+	}
+	return QuicStreamID(max)
+}
+
+// LargestStreamID returns the largest Stream ID opened by the peer.
+func (this *PeerStreamIDs) LargestStreamID() QuicStreamID {
+	return this.largest
+}
+
+// Open returns the streams opened by a frame of the peer on the Stream ID: the Stream ID and the Stream IDs it skips.
+//
+// No stream is returned if the Stream ID is already opened, or has been skipped by a larger Stream ID.
+func (this *PeerStreamIDs) Open(id QuicStreamID) ([]QuicStreamID, error) {
+	if !id.IsInitiatedBy(this.peer) {
+		return nil, ErrInvalidStreamID
+	}
+	if id <= this.largest {
+		return nil, nil
+	}
+	if id > this.MaxStreamID() {
+		return nil, ErrTooManyOpenStreams
+	}
+	opened := make([]QuicStreamID, 0, (id-this.largest)/2)
+	for s := this.largest + 2; s <= id; s += 2 {
+		opened = append(opened, s)
+		this.open[s] = struct{}{}
+	}
+	this.largest = id
+	return opened, nil
+}
+
+// Close releases an open stream of the peer, so that the peer can open a new one. The streams not open are ignored.
+func (this *PeerStreamIDs) Close(id QuicStreamID) {
+	delete(this.open, id)
+}
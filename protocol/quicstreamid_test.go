@@ -0,0 +1,98 @@
+package protocol
+
+import "testing"
+import "reflect"
+
+var tests_nextstreamid = []struct {
+	current     QuicStreamID
+	perspective Perspective
+	next        QuicStreamID
+	err         bool
+}{
+	{0, PERSPECTIVE_CLIENT, 1, false},
+	{1, PERSPECTIVE_CLIENT, 3, false},
+	{5, PERSPECTIVE_CLIENT, 7, false},
+	{0, PERSPECTIVE_SERVER, 2, false},
+	{2, PERSPECTIVE_SERVER, 4, false},
+	{4, PERSPECTIVE_CLIENT, 0, true},
+	{5, PERSPECTIVE_SERVER, 0, true},
+	{QUIC_MAX_STREAM_ID - 2, PERSPECTIVE_CLIENT, QUIC_MAX_STREAM_ID, false},
+	{QUIC_MAX_STREAM_ID, PERSPECTIVE_CLIENT, 0, true},
+}
+
+func Test_NextStreamID(t *testing.T) {
+	for i, v := range tests_nextstreamid {
+		next, err := NextStreamID(v.current, v.perspective)
+		if next != v.next || (err != nil) != v.err {
+			t.Errorf("NextStreamID : invalid Stream ID %v (%v) in test n°%v", next, err, i)
+		}
+	}
+}
+
+func Test_QuicStreamID(t *testing.T) {
+	if !QuicStreamID(1).IsCryptoStream() || QuicStreamID(3).IsCryptoStream() {
+		t.Error("QuicStreamID.IsCryptoStream : Stream ID 1 only")
+	}
+	if !QuicStreamID(3).IsHeadersStream() || QuicStreamID(1).IsHeadersStream() {
+		t.Error("QuicStreamID.IsHeadersStream : Stream ID 3 only")
+	}
+	if !QuicStreamID(5).IsClientInitiated() || QuicStreamID(4).IsClientInitiated() {
+		t.Error("QuicStreamID.IsClientInitiated : odd Stream IDs only")
+	}
+	if QuicStreamID(0).IsInitiatedBy(PERSPECTIVE_CLIENT) || QuicStreamID(0).IsInitiatedBy(PERSPECTIVE_SERVER) {
+		t.Error("QuicStreamID.IsInitiatedBy : the Stream ID 0 is the connection")
+	}
+}
+
+func Test_PeerStreamIDs(t *testing.T) {
+	// Server side: the client opens the streams
+	ids := NewPeerStreamIDs(PERSPECTIVE_CLIENT, 4)
+	if ids.MaxStreamID() != 11 {
+		t.Errorf("PeerStreamIDs.MaxStreamID : 11 expected instead of %v", ids.MaxStreamID())
+	}
+	if opened, err := ids.Open(5); err != nil || !reflect.DeepEqual(opened, []QuicStreamID{5}) {
+		t.Errorf("PeerStreamIDs.Open : invalid opened streams %v (%v)", opened, err)
+	}
+	// Peer jumps from 5 to 11, implicitly opening 7 and 9
+	if opened, err := ids.Open(11); err != nil || !reflect.DeepEqual(opened, []QuicStreamID{7, 9, 11}) {
+		t.Errorf("PeerStreamIDs.Open : invalid opened streams %v (%v)", opened, err)
+	}
+	if opened, err := ids.Open(9); err != nil || opened != nil {
+		t.Errorf("PeerStreamIDs.Open : implicitly opened stream must not be opened twice %v (%v)", opened, err)
+	}
+	if _, err := ids.Open(13); err != ErrTooManyOpenStreams {
+		t.Errorf("PeerStreamIDs.Open : ErrTooManyOpenStreams expected instead of %v", err)
+	}
+	if _, err := ids.Open(12); err != ErrInvalidStreamID {
+		t.Errorf("PeerStreamIDs.Open : ErrInvalidStreamID expected instead of %v", err)
+	}
+	ids.Close(7)
+	ids.Close(QUIC_CRYPTO_STREAM_ID)
+	if opened, err := ids.Open(13); err != nil || !reflect.DeepEqual(opened, []QuicStreamID{13}) {
+		t.Errorf("PeerStreamIDs.Open : invalid opened streams %v (%v)", opened, err)
+	}
+	if _, err := ids.Open(15); err != ErrTooManyOpenStreams {
+		t.Errorf("PeerStreamIDs.Open : ErrTooManyOpenStreams expected instead of %v", err)
+	}
+	// A stream closed twice, by its RST_STREAM then its FIN, releases a single slot
+	ids.Close(9)
+	ids.Close(9)
+	if opened, err := ids.Open(15); err != nil || !reflect.DeepEqual(opened, []QuicStreamID{15}) {
+		t.Errorf("PeerStreamIDs.Open : invalid opened streams %v (%v)", opened, err)
+	}
+	if _, err := ids.Open(17); err != ErrTooManyOpenStreams {
+		t.Errorf("PeerStreamIDs.Open : ErrTooManyOpenStreams expected instead of %v after a double Close", err)
+	}
+
+	// Client side: the server opens the streams
+	ids = NewPeerStreamIDs(PERSPECTIVE_SERVER, 2)
+	if opened, err := ids.Open(4); err != nil || !reflect.DeepEqual(opened, []QuicStreamID{2, 4}) {
+		t.Errorf("PeerStreamIDs.Open : invalid opened streams %v (%v)", opened, err)
+	}
+	if _, err := ids.Open(6); err != ErrTooManyOpenStreams {
+		t.Errorf("PeerStreamIDs.Open : ErrTooManyOpenStreams expected instead of %v", err)
+	}
+	if _, err := ids.Open(5); err != ErrInvalidStreamID {
+		t.Errorf("PeerStreamIDs.Open : ErrInvalidStreamID expected instead of %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package protocol
+
+import "encoding/binary"
+import "errors"
+import "fmt"
+
+// QuicVersion is the version tag of the public header.
+type QuicVersion uint32
+
+// QUIC versions, the version tag is serialized in Little Endian as the ASCII string "Qxxx".
+const (
+	QUIC_VERSION_35 QuicVersion = ('Q') + ('0' << 8) + ('3' << 16) + ('5' << 24)
+	QUIC_VERSION_36 QuicVersion = ('Q') + ('0' << 8) + ('3' << 16) + ('6' << 24)
+	QUIC_VERSION_37 QuicVersion = ('Q') + ('0' << 8) + ('3' << 16) + ('7' << 24)
+	QUIC_VERSION_38 QuicVersion = ('Q') + ('0' << 8) + ('3' << 16) + ('8' << 24)
+	QUIC_VERSION_39 QuicVersion = ('Q') + ('0' << 8) + ('3' << 16) + ('9' << 24)
+	QUIC_VERSION_40 QuicVersion = ('Q') + ('0' << 8) + ('4' << 16) + ('0' << 24)
+	QUIC_VERSION_41 QuicVersion = ('Q') + ('0' << 8) + ('4' << 16) + ('1' << 24)
+	QUIC_VERSION_42 QuicVersion = ('Q') + ('0' << 8) + ('4' << 16) + ('2' << 24)
+	QUIC_VERSION_43 QuicVersion = ('Q') + ('0' << 8) + ('4' << 16) + ('3' << 24)
+)
+
+// ErrNoCommonVersion is returned by ChooseVersion when the peers don't share any QUIC version.
+var ErrNoCommonVersion = errors.New("ChooseVersion : no QUIC version supported by both peers")
+
+// ErrVersionDowngrade is returned by CheckVersionNegotiation when the version negotiation packet lists the version proposed by the client.
+var ErrVersionDowngrade = errors.New("CheckVersionNegotiation : the server supports the proposed version, the version negotiation packet must be ignored")
+
+// SupportedVersions returns the QUIC versions supported by this implementation, from the highest to the lowest.
+func SupportedVersions() []QuicVersion {
+	return []QuicVersion{QUIC_VERSION_43, QUIC_VERSION_42, QUIC_VERSION_41, QUIC_VERSION_40,
+		QUIC_VERSION_39, QUIC_VERSION_38, QUIC_VERSION_37, QUIC_VERSION_36, QUIC_VERSION_35}
+}
+
+// Number returns the decimal number of the "Qxxx" version tag, or -1 if the tag is not a Google QUIC version.
+func (this QuicVersion) Number() int {
+	var n int
+
+	if byte(this) != 'Q' {
+		return -1
+	}
+	for i := uint(1); i < 4; i++ {
+		d := byte(this >> (i << 3))
+		if d < '0' || d > '9' {
+			return -1
+		}
+		n = n*10 + int(d-'0')
+	}
+	return n
+}
+
+// String returns the "Qxxx" version tag, or the hexadecimal value of the tag if it is not a Google QUIC version.
+func (this QuicVersion) String() string {
+	if this.Number() < 0 {
+		return fmt.Sprintf("0x%08x", uint32(this))
+	}
+	return fmt.Sprintf("Q%03d", this.Number())
+}
+
+// ChooseVersion returns the highest QUIC version of our list that is also in their list, unknown versions are ignored.
+func ChooseVersion(ours, theirs []QuicVersion) (QuicVersion, error) {
+	var chosen QuicVersion
+
+	found := false
+	for _, v := range ours {
+		if v.Number() < 0 || (found && v.Number() <= chosen.Number()) {
+			continue
+		}
+		for _, w := range theirs {
+			if v == w {
+				chosen = v
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return 0, ErrNoCommonVersion
+	}
+	return chosen, nil
+}
+
+// CheckVersionNegotiation checks the versions of a version negotiation packet received by the client after proposing a version.
+//
+// A server only sends a version negotiation packet when it doesn't support the proposed version,
+// so a list that contains it is forged and must be ignored to prevent a downgrade to a weaker version.
+func CheckVersionNegotiation(proposed QuicVersion, offered []QuicVersion) error {
+	for _, v := range offered {
+		if v == proposed {
+			return ErrVersionDowngrade
+		}
+	}
+	return nil
+}
+
+// BuildVersionNegotiationPacket returns the version negotiation packet sent by a server:
+//
+//	+--------+--------+-- --+--------+--------+--------+--------+--------+-- --+
+//	|Flags(8)|  Connection ID (64)   |        Version 1 (32)     | Version 2 ...  |
+//	+--------+--------+-- --+--------+--------+--------+--------+--------+-- --+
+//
+// The public flags have the version bit and a 64-bit connection ID, there is no sequence number.
+func BuildVersionNegotiationPacket(connID QuicConnectionID, versions []QuicVersion) []byte {
+	b := make([]byte, 9+4*len(versions))
+	b[0] = QUICFLAG_VERSION | QUICFLAG_CONNID_64bit
+	binary.LittleEndian.PutUint64(b[1:], uint64(connID))
+	for i, v := range versions {
+		binary.LittleEndian.PutUint32(b[9+4*i:], uint32(v))
+	}
+	return b
+}
+
+// ParseVersionNegotiationPacket parses a version negotiation packet received by a client, and returns the connection ID and the versions.
+//
+// Unknown version tags are returned as they are.
+func ParseVersionNegotiationPacket(b []byte) (QuicConnectionID, []QuicVersion, error) {
+	var connID QuicConnectionID
+
+	if len(b) < 1 {
+		return 0, nil, ErrTruncatedHeader
+	}
+	pf := b[0]
+	if (pf & QUICMASK_RESERVED) != 0 {
+		return 0, nil, ErrReservedFlagBits
+	}
+	if (pf&QUICFLAG_VERSION) == 0 || (pf&QUICFLAG_PUBLICRESET) != 0 {
+		return 0, nil, errors.New("ParseVersionNegotiationPacket : not a version negotiation packet")
+	}
+	size := 1 + parsePublicheaderConnectionIdSize[(pf>>2)&0x0f]
+	if len(b) < size {
+		return 0, nil, ErrTruncatedHeader
+	}
+	switch size {
+	case 2:
+		connID = QuicConnectionID(b[1])
+	case 5:
+		connID = QuicConnectionID(binary.LittleEndian.Uint32(b[1:]))
+	case 9:
+		connID = QuicConnectionID(binary.LittleEndian.Uint64(b[1:]))
+	}
+	b = b[size:]
+	if len(b) == 0 || len(b)%4 != 0 {
+		return 0, nil, errors.New("ParseVersionNegotiationPacket : version list must be a non-empty list of 32-bit tags")
+	}
+	versions := make([]QuicVersion, len(b)/4)
+	for i := range versions {
+		versions[i] = QuicVersion(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return connID, versions, nil
+}
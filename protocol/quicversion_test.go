@@ -0,0 +1,76 @@
+package protocol
+
+import "testing"
+import "bytes"
+import "reflect"
+
+var tests_chooseversion = []struct {
+	ours    []QuicVersion
+	theirs  []QuicVersion
+	version QuicVersion
+	err     error
+}{
+	{SupportedVersions(), []QuicVersion{QUIC_VERSION_35}, QUIC_VERSION_35, nil},
+	{SupportedVersions(), []QuicVersion{QUIC_VERSION_37, QUIC_VERSION_39, QUIC_VERSION_36}, QUIC_VERSION_39, nil},
+	{[]QuicVersion{QUIC_VERSION_35, QUIC_VERSION_39}, SupportedVersions(), QUIC_VERSION_39, nil},
+	// Unknown tags interleaved with known ones
+	{SupportedVersions(), []QuicVersion{0x12345678, QUIC_VERSION_38, 'Q' + ('9' << 8) + ('9' << 16) + ('9' << 24), QUIC_VERSION_41, 0xfaceb00c}, QUIC_VERSION_41, nil},
+	{SupportedVersions(), []QuicVersion{0x12345678, 0xfaceb00c}, 0, ErrNoCommonVersion},
+	{SupportedVersions(), nil, 0, ErrNoCommonVersion},
+	{nil, SupportedVersions(), 0, ErrNoCommonVersion},
+}
+
+func Test_ChooseVersion(t *testing.T) {
+	for i, v := range tests_chooseversion {
+		version, err := ChooseVersion(v.ours, v.theirs)
+		if version != v.version || err != v.err {
+			t.Errorf("ChooseVersion : invalid version %v (%v) in test n°%v", version, err, i)
+		}
+	}
+}
+
+func Test_QuicVersion_String(t *testing.T) {
+	if s := QUIC_VERSION_43.String(); s != "Q043" {
+		t.Errorf("QuicVersion.String : invalid string %v", s)
+	}
+	if s := QuicVersion(0xfaceb00c).String(); s != "0xfaceb00c" {
+		t.Errorf("QuicVersion.String : invalid string %v", s)
+	}
+	if n := QUIC_VERSION_39.Number(); n != 39 {
+		t.Errorf("QuicVersion.Number : invalid number %v", n)
+	}
+}
+
+func Test_VersionNegotiationPacket(t *testing.T) {
+	versions := []QuicVersion{0x12345678, QUIC_VERSION_38, QUIC_VERSION_41, 0xfaceb00c}
+	b := BuildVersionNegotiationPacket(0x0102030405060708, versions)
+	data := []byte{0x0d, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01,
+		0x78, 0x56, 0x34, 0x12, 'Q', '0', '3', '8', 'Q', '0', '4', '1', 0x0c, 0xb0, 0xce, 0xfa}
+	if !bytes.Equal(b, data) {
+		t.Errorf("BuildVersionNegotiationPacket : invalid packet %x", b)
+	}
+
+	connID, parsed, err := ParseVersionNegotiationPacket(b)
+	if err != nil || connID != 0x0102030405060708 || !reflect.DeepEqual(parsed, versions) {
+		t.Errorf("ParseVersionNegotiationPacket : invalid packet %x %v (%v)", connID, parsed, err)
+	}
+	if v, err := ChooseVersion(SupportedVersions(), parsed); v != QUIC_VERSION_41 || err != nil {
+		t.Errorf("ChooseVersion : invalid version %v (%v)", v, err)
+	}
+
+	for _, l := range []int{0, 1, 8, 9, 10, 12} {
+		if _, _, err = ParseVersionNegotiationPacket(b[:l]); err == nil {
+			t.Errorf("ParseVersionNegotiationPacket : truncated packet of %v bytes must be rejected", l)
+		}
+	}
+	if _, _, err = ParseVersionNegotiationPacket([]byte{0x0c, 0, 0, 0, 0, 0, 0, 0, 0, 'Q', '0', '3', '8'}); err == nil {
+		t.Error("ParseVersionNegotiationPacket : packet without the version flag must be rejected")
+	}
+
+	if err = CheckVersionNegotiation(QUIC_VERSION_43, parsed); err != nil {
+		t.Errorf("CheckVersionNegotiation : unexpected error %v", err)
+	}
+	if err = CheckVersionNegotiation(QUIC_VERSION_38, parsed); err != ErrVersionDowngrade {
+		t.Errorf("CheckVersionNegotiation : ErrVersionDowngrade expected instead of %v", err)
+	}
+}
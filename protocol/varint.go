@@ -0,0 +1,87 @@
+package protocol
+
+import "io"
+import "errors"
+
+// QUIC variable-length integers: the two most significant bits of the first byte encode the length of the integer (1, 2, 4 or 8 bytes),
+// and the remaining bits encode the integer value in Big Endian order.
+//
+//	+------+--------+-------------+-----------------------+
+//	| 2MSB | Length | Usable Bits | Range                 |
+//	+------+--------+-------------+-----------------------+
+//	| 00   | 1      | 6           | 0-63                  |
+//	| 01   | 2      | 14          | 0-16383               |
+//	| 10   | 4      | 30          | 0-1073741823          |
+//	| 11   | 8      | 62          | 0-4611686018427387903 |
+//	+------+--------+-------------+-----------------------+
+
+// Maximum values of each variable-length integer encoding.
+const (
+	VARINT_MAX1 = 1<<6 - 1
+	VARINT_MAX2 = 1<<14 - 1
+	VARINT_MAX4 = 1<<30 - 1
+	VARINT_MAX8 = 1<<62 - 1
+)
+
+var errVarintTooLarge = errors.New("Varint : value can't be greater than 2^62-1")
+var errVarintNotMinimal = errors.New("ReadVarint : variable-length integer is not encoded with the minimal length")
+
+// VarintLen returns the number of bytes of the minimal encoding of v, or 0 if v is greater than 2^62-1.
+func VarintLen(v uint64) int {
+	switch {
+	case v <= VARINT_MAX1:
+		return 1
+	case v <= VARINT_MAX2:
+		return 2
+	case v <= VARINT_MAX4:
+		return 4
+	case v <= VARINT_MAX8:
+		return 8
+	}
+	return 0
+}
+
+// WriteVarint writes v with its minimal variable-length integer encoding, an error is returned if v is greater than 2^62-1.
+func WriteVarint(w io.ByteWriter, v uint64) error {
+	var l int
+
+	switch l = VarintLen(v); l {
+	case 0:
+		return errVarintTooLarge
+	case 2:
+		v |= 0x4000
+	case 4:
+		v |= 0x80000000
+	case 8:
+		v |= 0xc000000000000000
+	}
+	for i := l - 1; i >= 0; i-- {
+		if err := w.WriteByte(byte(v >> uint(i<<3))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadVarint reads a variable-length integer, an error is returned if the encoding is not the minimal one or if the data is truncated.
+func ReadVarint(r io.ByteReader) (uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	l := 1 << (b >> 6)
+	v := uint64(b & 0x3f)
+	for i := 1; i < l; i++ {
+		if b, err = r.ReadByte(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		v = (v << 8) | uint64(b)
+	}
+	if VarintLen(v) != l {
+		return 0, errVarintNotMinimal
+	}
+	return v, nil
+}
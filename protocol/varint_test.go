@@ -0,0 +1,102 @@
+package protocol
+
+import "testing"
+import "bytes"
+
+var tests_varint = []struct {
+	value   uint64
+	encoded []byte
+}{
+	{0, []byte{0x00}},
+	{37, []byte{0x25}},
+	{63, []byte{0x3f}},
+	{64, []byte{0x40, 0x40}},
+	{15293, []byte{0x7b, 0xbd}},
+	{16383, []byte{0x7f, 0xff}},
+	{16384, []byte{0x80, 0x00, 0x40, 0x00}},
+	{494878333, []byte{0x9d, 0x7f, 0x3e, 0x7d}},
+	{1073741823, []byte{0xbf, 0xff, 0xff, 0xff}},
+	{1073741824, []byte{0xc0, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x00}},
+	{151288809941952652, []byte{0xc2, 0x19, 0x7c, 0x5e, 0xff, 0x14, 0xe8, 0x8c}},
+	{VARINT_MAX8, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+}
+
+func Test_Varint(t *testing.T) {
+	for _, v := range tests_varint {
+		if VarintLen(v.value) != len(v.encoded) {
+			t.Errorf("VarintLen : invalid length %d for %d", VarintLen(v.value), v.value)
+		}
+
+		var buf bytes.Buffer
+		if err := WriteVarint(&buf, v.value); err != nil {
+			t.Fatalf("WriteVarint : %d : %v", v.value, err)
+		}
+		if !bytes.Equal(buf.Bytes(), v.encoded) {
+			t.Errorf("WriteVarint : invalid encoding %x for %d", buf.Bytes(), v.value)
+		}
+
+		value, err := ReadVarint(bytes.NewReader(v.encoded))
+		if err != nil || value != v.value {
+			t.Errorf("ReadVarint : invalid value %d or error %v for %x", value, err, v.encoded)
+		}
+
+		// Truncated encoding
+		if len(v.encoded) > 1 {
+			if _, err = ReadVarint(bytes.NewReader(v.encoded[:len(v.encoded)-1])); err == nil {
+				t.Errorf("ReadVarint : truncated encoding %x must be rejected", v.encoded[:len(v.encoded)-1])
+			}
+		}
+	}
+}
+
+func Test_Varint_Errors(t *testing.T) {
+	var buf bytes.Buffer
+
+	if VarintLen(VARINT_MAX8+1) != 0 {
+		t.Error("VarintLen : 0 expected for 2^62")
+	}
+	if err := WriteVarint(&buf, VARINT_MAX8+1); err == nil || buf.Len() != 0 {
+		t.Error("WriteVarint : 2^62 must be rejected")
+	}
+
+	// Non minimal encodings
+	for _, b := range [][]byte{
+		{0x40, 0x25},
+		{0x80, 0x00, 0x00, 0x25},
+		{0x80, 0x00, 0x3f, 0xff},
+		{0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x25},
+		{0xc0, 0x00, 0x00, 0x00, 0x3f, 0xff, 0xff, 0xff},
+	} {
+		if _, err := ReadVarint(bytes.NewReader(b)); err != errVarintNotMinimal {
+			t.Errorf("ReadVarint : non minimal encoding %x must be rejected", b)
+		}
+	}
+
+	if _, err := ReadVarint(bytes.NewReader(nil)); err == nil {
+		t.Error("ReadVarint : empty data must be rejected")
+	}
+}
+
+func Fuzz_Varint(f *testing.F) {
+	for _, v := range tests_varint {
+		f.Add(v.value)
+	}
+	f.Fuzz(func(t *testing.T, value uint64) {
+		var buf bytes.Buffer
+
+		err := WriteVarint(&buf, value)
+		if value > VARINT_MAX8 {
+			if err == nil {
+				t.Fatalf("WriteVarint : %d must be rejected", value)
+			}
+			return
+		}
+		if err != nil || buf.Len() != VarintLen(value) {
+			t.Fatalf("WriteVarint : invalid length %d or error %v for %d", buf.Len(), err, value)
+		}
+		decoded, err := ReadVarint(&buf)
+		if err != nil || decoded != value {
+			t.Fatalf("ReadVarint : round trip failure %d versus %d (%v)", decoded, value, err)
+		}
+	})
+}
@@ -1,178 +1,207 @@
 // Package quic provides a portable interface for network I/O with QUIC, a multiplexed stream transport over UDP.
 //
+// A client connects to a server with Dial, a server accepts the sessions of the clients with Listen:
+//
+//	session, err := quic.Dial("example.org:443", nil)
+//	stream, err := session.OpenStream()
+//
+//	listener, err := quic.Listen(pc, nil)
+//	session, err := listener.Accept()
+//	stream, err := session.AcceptStream(ctx)
+//
+// NewSession builds either end of a connection between two PacketConns, for the peer-to-peer applications and the tests.
+//
+// The blocking calls with a context return a protocol.ContextError when the context is done,
+// cancelling DialContext closes the session and the UDP socket of the dial.
+//
+// A PacketConn can be shared by a Listener and the sessions of DialPacketConn: the datagrams are demultiplexed by Connection ID,
+// and those of the unknown Connection IDs go to the Listener. Closing the Listener doesn't close the sessions dialed on the PacketConn.
+// The packets of the sessions that omit the Connection ID, see Config.TruncateConnectionID, are demultiplexed by the address of the peer.
+//
+// The Session and Stream methods are safe for concurrent use: a Stream can be read and written by different goroutines,
+// while the event loop of its session handles the packets.
+//
 // See https://www.chromium.org/quic
 package quic
 
+import "github.com/romain-jacotin/quic/handshake"
+import "github.com/romain-jacotin/quic/protocol"
+import "context"
+import "crypto/rand"
+import "errors"
 import "net"
-import "time"
-
-type QUICListener struct {
-}
-
-type QUICSession struct {
-}
-
-type StreamConn struct {
-}
-
-// ListenUDP listens for incoming UDP packets addressed to the local address laddr.
-// Net must be "udp", "udp4", or "udp6".
-// If laddr has a port of 0, ListenUDP will choose an available port.
-// The LocalAddr method of the returned QUICSession can be used to discover the port.
-// The returned connection's ReadFrom and WriteTo methods can be used to receive and send UDP packets with per-packet addressing.
-func ListenQUIC(net string, laddr *net.UDPAddr) (*QUICListener, error) {
-	return nil, nil
-}
-
-// AcceptQUIC accepts the next incoming new QUIC call and returns the new session.
-func (l *QUICListener) AcceptQUIC() (*QUICSession, error) {
-	return nil, nil
-}
-
-// Addr returns the listener's network address, a *UDPAddr.
-func (l *QUICListener) Addr() (a net.UDPAddr) {
-	return
-}
-
-// Close stops listening on the QUIC address.
-// Already Accepted sessions are not closed.
-func (l *QUICListener) Close() error {
-	return nil
-}
-
-// SetDeadline sets the deadline associated with the listener.
-// A zero time value disables the deadline.
-func (l *QUICListener) SetDeadline(t time.Time) error {
-	return nil
-}
-
-// DialQUIC connects to the remote address raddr on the network net, which must be "udp", "udp4", or "udp6".
-// If laddr is not nil, it is used as the local address for the connection.
-func DialQUIC(net string, laddr, raddr *net.UDPAddr) (*QUICSession, error) {
-	return nil, nil
-}
-
-// Close closes the session.
-func (s *QUICSession) Close() error {
-	return nil
-}
-
-// PublicReset closes immediatly the session.
-func (s *QUICSession) PublicReset() error {
-	return nil
-}
-
-// LocalAddr returns the local network address.
-func (s *QUICSession) LocalAddr() (l net.UDPAddr) {
-	return
-}
-
-// RemoteAddr returns the remote network address.
-func (s *QUICSession) RemoteAddr() (r net.UDPAddr) {
-	return
-}
+import "sync"
 
-// SetKeepAlive sets whether the QUIC session should send PING frames on the connection.
-func (s *QUICSession) SetKeepAlive(keepalive bool) error {
-	return nil
-}
-
-// SetKeepAlivePeriod sets period between QUIC PING frames.
-func (s *QUICSession) SetKeepAlivePeriod(d time.Duration) error {
-	return nil
-}
-
-// PING is a blocking function that send a PING frame and waits for the associated ACK
-func (s *QUICSession) Ping(keepalive bool) error {
-	return nil
-}
-
-// NewStrem creates and add a new Stream connection on the QUIC session.
-func (s *QUICSession) NewStream() (*StreamConn, error) {
-	return nil, nil
-}
-
-// AcceptStream accepts the next incoming stream and returns the new connection.
-func (s *QUICSession) AcceptStream() (*StreamConn, error) {
-	return nil, nil
-}
-
-// Close closes the connection.
-func (c *StreamConn) Close() error {
-	return nil
-}
-
-// CloseRead shuts down the reading side of the Stream connection.
-// Most callers should just use Close.
-func (c *StreamConn) CloseRead() error {
-	return nil
-}
-
-// CloseWrite shuts down the writing side of the Stream connection.
-// Most callers should just use Close.
-func (c *StreamConn) CloseWrite() error {
-	return nil
-}
-
-// Read implements the net.Conn Read method.
-// Read reads data from the Stream connection.
-// Read can be made to time out and return a Error with Timeout() == true
-// after a fixed time limit; see SetDeadline and SetReadDeadline.
-func (c *StreamConn) Read(b []byte) (int, error) {
-	return 0, nil
-}
-
-// Write implements the net.Conn Write method.
-// Write writes data to the Stream connection.
-// Write can be made to time out and return a Error with Timeout() == true
-// after a fixed time limit; see SetDeadline and SetWriteDeadline.
-func (c *StreamConn) Write(b []byte) (int, error) {
-	return 0, nil
-}
-
-// Write writes data to the Stream connection with Forward Error Correction (FEC).
-// Write can be made to time out and return a Error with Timeout() == true
-// after a fixed time limit; see SetDeadline and SetWriteDeadline.
-func (c *StreamConn) WriteFEC(b []byte) (int, error) {
-	return 0, nil
-}
-
-// Write writes important data to the Stream connection by sending duplicate QUIC packet with pacing.
-// Write can be made to time out and return a Error with Timeout() == true
-// after a fixed time limit; see SetDeadline and SetWriteDeadline.
-func (c *StreamConn) WriteDuplicate(b []byte) (int, error) {
-	return 0, nil
-}
-
-// SetDeadline implements the net.Conn SetDeadline method.
-func (c *StreamConn) SetDeadline(t time.Time) error {
-	return nil
-}
-
-// SetLinger sets the behavior of Close on a connection which still has data waiting to be sent or to be acknowledged.
+// Dial connects to the QUIC server at the address "host:port" from a new UDP socket, the socket is closed with the session.
 //
-// If sec < 0 (the default), the operating system finishes sending the data in the background.
+// Dial runs the version negotiation and the crypto handshake, and returns once the forward-secure keys are established,
+// or the initial keys if the config sets ReturnAtZeroRTT.
+func Dial(addr string, cfg *Config) (Session, error) {
+	return DialContext(context.Background(), addr, cfg)
+}
+
+// DialContext is Dial interrupted by the end of the context: the session and the UDP socket are closed.
+func DialContext(ctx context.Context, addr string, cfg *Config) (Session, error) {
+	remoteAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	return dial(ctx, pc, true, remoteAddr, host, cfg)
+}
+
+// DialPacketConn connects to the QUIC server at the remote address on the PacketConn, hostname is the server name sent in the CHLO.
 //
-// If sec == 0, the operating system discards any unsent or unacknowledged data.
+// The PacketConn can be shared with a Listener and other sessions, it is not closed with the session.
+// A session can't be dialed to the Listener of its own PacketConn: both ends would use the same Connection ID.
+// The PacketConn can be shared with other sessions of the server address, the config can't set TruncateConnectionID.
+func DialPacketConn(pc net.PacketConn, remoteAddr net.Addr, hostname string, cfg *Config) (Session, error) {
+	return DialPacketConnContext(context.Background(), pc, remoteAddr, hostname, cfg)
+}
+
+// DialPacketConnContext is DialPacketConn interrupted by the end of the context: the session is closed, but not the PacketConn.
+func DialPacketConnContext(ctx context.Context, pc net.PacketConn, remoteAddr net.Addr, hostname string, cfg *Config) (Session, error) {
+	return dial(ctx, pc, false, remoteAddr, hostname, cfg)
+}
+
+// dial runs the client session, and retries once with the version chosen after a version negotiation packet.
+// The session is closed if the context ends before the handshake.
+func dial(ctx context.Context, pc net.PacketConn, ownsConn bool, remoteAddr net.Addr, hostname string, cfg *Config) (Session, error) {
+	config := populateDefaults(cfg)
+	if err := config.Validate(); err != nil {
+		if ownsConn {
+			pc.Close()
+		}
+		return nil, err
+	}
+	if config.TruncateConnectionID && !ownsConn {
+		return nil, ErrInvalidConfig{Field: "TruncateConnectionID", Reason: "the PacketConn of DialPacketConn can be shared"}
+	}
+	mux := getPacketMux(pc, ownsConn, config.Clock)
+	defer mux.release()
+
+	connID, err := protocol.GenerateConnectionID(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	level := protocol.ENCRYPTION_FORWARD_SECURE
+	if config.ReturnAtZeroRTT {
+		level = protocol.ENCRYPTION_INITIAL
+	}
+	version := config.Versions[0]
+	for negotiated := false; ; negotiated = true {
+		conn := &muxConn{mux: mux, remote: remoteAddr, connID: connID, ecn: ecnCodepoint(config)}
+		s, err := newClientSession(conn, connID, version, config.Versions[0], hostname, config)
+		if err != nil {
+			return nil, err
+		}
+		if err = mux.addSession(connID, s); err != nil {
+			return nil, err
+		}
+		// The UDP socket of Dial has no other session
+		if config.TruncateConnectionID {
+			if err = mux.addTruncatedConn(conn); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		s.start()
+		if err = s.waitForEncryptionLevel(ctx, level); err == nil {
+			return s, nil
+		}
+		if _, ok := err.(protocol.ContextError); ok {
+			s.close(Error{ErrorCode: protocol.QUIC_PEER_GOING_AWAY, ReasonPhrase: "dial cancelled"})
+		}
+		<-s.runDone
+		verr, ok := err.(versionNegotiationError)
+		if !ok || negotiated {
+			return nil, err
+		}
+		if verr.err != nil {
+			return nil, verr.err
+		}
+		version = verr.version
+	}
+}
+
+// NewSession establishes a session of the perspective with the peer at the remote address on the PacketConn, without Dial or Listen.
+// The client runs the handshake like DialPacketConn with the Config.ServerName, the server waits for the CHLO of the remote address:
+// both return once the forward-secure keys are established, so both ends of a connection are built concurrently.
 //
-// If sec > 0, the data is sent in the background as with sec < 0.
-// On some operating systems after sec seconds have elapsed any remaining unsent data may be discarded.
-func (c *StreamConn) SetLinger(sec int) error {
-	return nil
-}
-
-// SetNoDelay controls whether the operating system should delay packet transmission in hopes of sending fewer packets (like TCP Nagle's algorithm).
-// The default is true (no delay), meaning that data is sent as soon as possible after a Write.
-func (c *StreamConn) SetNoDelay(noDelay bool) error {
-	return nil
-}
-
-// SetReadDeadline implements the net.Conn SetReadDeadline method.
-func (c *StreamConn) SetReadDeadline(t time.Time) error {
-	return nil
-}
-
-// SetWriteDeadline implements the net.Conn SetWriteDeadline method.
-func (c *StreamConn) SetWriteDeadline(t time.Time) error {
-	return nil
+// The PacketConn is not closed with the session. The server can't share it with a Listener until its handshake is complete.
+func NewSession(pc net.PacketConn, remote net.Addr, perspective protocol.Perspective, cfg *Config) (Session, error) {
+	return NewSessionContext(context.Background(), pc, remote, perspective, cfg)
+}
+
+// NewSessionContext is NewSession interrupted by the end of the context: the session is closed, but not the PacketConn.
+func NewSessionContext(ctx context.Context, pc net.PacketConn, remote net.Addr, perspective protocol.Perspective, cfg *Config) (Session, error) {
+	switch perspective {
+	case protocol.PERSPECTIVE_CLIENT:
+		var serverName string
+		if cfg != nil {
+			serverName = cfg.ServerName
+		}
+		return dial(ctx, pc, false, remote, serverName, cfg)
+	case protocol.PERSPECTIVE_SERVER:
+		l, err := listen(pc, cfg, remote)
+		if err != nil {
+			return nil, err
+		}
+		defer l.Close()
+		return l.acceptContext(ctx, "NewSession")
+	}
+	return nil, errors.New("NewSession : unknown perspective")
+}
+
+// Listen accepts the sessions of the clients on the PacketConn, the PacketConn can also be used by DialPacketConn.
+//
+// The Listener answers the unsupported versions with a version negotiation packet, and creates a session for each valid CHLO.
+func Listen(pc net.PacketConn, cfg *Config) (Listener, error) {
+	l, err := listen(pc, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// listen returns the listener of the PacketConn, that only accepts the sessions of the peer address if it is not nil.
+func listen(pc net.PacketConn, cfg *Config, peer net.Addr) (*listener, error) {
+	var err error
+
+	config := populateDefaults(cfg)
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.ServerConfig == nil {
+		if config.ServerConfig, err = handshake.NewServerConfig(DEFAULT_SERVER_CONFIG_LIFETIME); err != nil {
+			return nil, err
+		}
+	}
+	if config.PublicResetSecret == nil {
+		config.PublicResetSecret = make([]byte, 32)
+		if _, err = rand.Read(config.PublicResetSecret); err != nil {
+			return nil, err
+		}
+	}
+	l := &listener{
+		peer:                peer,
+		config:              config,
+		metrics:             &listenerMetrics{clock: config.Clock},
+		versionNegotiations: newRateLimiter(VERSION_NEGOTIATION_INTERVAL, 0),
+		publicResets:        newRateLimiter(config.PublicResetInterval, config.MaxPublicResetsPerSecond),
+		pending:             make(map[protocol.QuicConnectionID]*session)}
+	l.cond = sync.NewCond(&l.mutex)
+	l.mux = getPacketMux(pc, false, config.Clock)
+	if err = l.mux.setListener(l); err != nil {
+		l.mux.release()
+		return nil, err
+	}
+	return l, nil
 }
@@ -0,0 +1,1207 @@
+package quic
+
+import "github.com/romain-jacotin/quic/ackhandler"
+import "github.com/romain-jacotin/quic/crypto"
+import "github.com/romain-jacotin/quic/handshake"
+import "github.com/romain-jacotin/quic/internal/testutil"
+import "github.com/romain-jacotin/quic/protocol"
+import "bytes"
+import "context"
+import "encoding/binary"
+import "errors"
+import "io"
+import "io/ioutil"
+import "net"
+import "runtime"
+import "sync"
+import "testing"
+import "time"
+
+// listenUDP returns a PacketConn on a free port of the loopback interface.
+func listenUDP(t testing.TB) net.PacketConn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket : unexpected error %v", err)
+	}
+	return pc
+}
+
+// echoServer accepts the sessions of the listener and echoes their streams.
+func echoServer(l Listener) {
+	for {
+		s, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go echoSession(s)
+	}
+}
+
+// echoSession echoes the streams of the session until it is closed.
+func echoSession(s Session) {
+	for {
+		st, err := s.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			io.Copy(st, st)
+			st.Close()
+		}()
+	}
+}
+
+// checkEcho sends data on a new stream of the session and checks the echo.
+func checkEcho(t *testing.T, s Session, data string, n int) {
+	st, err := s.OpenStream()
+	if err != nil {
+		t.Fatalf("Session.OpenStream : unexpected error %v in test n°%v", err, n)
+	}
+	st.Write([]byte(data))
+	st.Close()
+	st.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if echo, err := ioutil.ReadAll(st); err != nil || string(echo) != data {
+		t.Errorf("Stream.Read : %q expected instead of %q (%v) in test n°%v", data, echo, err, n)
+	}
+}
+
+// newSimulatedSessions returns a client and a server session built by NewSession on two PacketConns of the simulated network,
+// with the test certificates in the configs of the client and of the server. The sessions and their PacketConns are closed
+// by closeSessions.
+//
+// The end-to-end tests of the sessions are built on it. Those of Dial, Listen and their PacketConn sharing, of the Listener
+// and of the Round Tripper of h2quic dial by address and stay on UDP; the tests of the session internals stay on the testConns
+// of newTestSessions, whose hooks drop, hold or mark the packets of sessions not started yet.
+func newSimulatedSessions(t *testing.T, network *testutil.SimulatedNetwork, clientConfig, serverConfig *Config) (client, server Session, closeSessions func()) {
+	return newPacketConnSessions(t, network.ListenPacket(), network.ListenPacket(), testClientConfig(t, clientConfig), testServerConfig(t, serverConfig))
+}
+
+// newPacketConnSessions returns a client and a server session built by NewSession on the PacketConns, with the configs as is
+// but the ServerName of the client. The sessions and the PacketConns are closed by closeSessions.
+func newPacketConnSessions(t *testing.T, clientPC, serverPC net.PacketConn, clientConfig, serverConfig *Config) (client, server Session, closeSessions func()) {
+	clientConfig.ServerName = "localhost"
+	accepted := make(chan error, 1)
+	go func() {
+		var err error
+		server, err = NewSession(serverPC, clientPC.LocalAddr(), protocol.PERSPECTIVE_SERVER, serverConfig)
+		accepted <- err
+	}()
+	client, err := NewSession(clientPC, serverPC.LocalAddr(), protocol.PERSPECTIVE_CLIENT, clientConfig)
+	if err != nil {
+		t.Fatalf("NewSession : unexpected error %v for the client", err)
+	}
+	if err = <-accepted; err != nil {
+		t.Fatalf("NewSession : unexpected error %v for the server", err)
+	}
+	return client, server, func() {
+		client.Close(nil)
+		server.Close(nil)
+		clientPC.Close()
+		serverPC.Close()
+	}
+}
+
+// newInstantNetwork returns a simulated network whose datagrams arrive at once: its clock doesn't need to run, the sessions
+// can run on the real clock.
+func newInstantNetwork() *testutil.SimulatedNetwork {
+	return testutil.NewSimulatedNetwork(testutil.NewClock(time.Now()), testutil.Link{}, 1)
+}
+
+// dialSimulated returns a session connected to an echo server on a simulated network whose endpoints send on the link,
+// with the losses of the seed. The sessions run on the simulated clock, until closeNetwork is called.
+func dialSimulated(t *testing.T, link testutil.Link, seed int64) (s Session, clock *testutil.Clock, network *testutil.SimulatedNetwork, closeNetwork func()) {
+	clock = testutil.NewClock(time.Now())
+	network = testutil.NewSimulatedNetwork(clock, link, seed)
+	stop := clock.Run(time.Millisecond)
+	s, server, closeSessions := newSimulatedSessions(t, network, &Config{Clock: clock}, &Config{Clock: clock})
+	go echoSession(server)
+	return s, clock, network, func() {
+		closeSessions()
+		stop()
+	}
+}
+
+// rebindingPacketConn is a PacketConn whose source port changes with rebind, like a client moving to another network:
+// the datagrams are sent from the newest UDP socket, and received on all of them.
+type rebindingPacketConn struct {
+	mutex     sync.Mutex
+	conns     []net.PacketConn
+	datagrams chan rebindingDatagram
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type rebindingDatagram struct {
+	data []byte
+	addr net.Addr
+}
+
+func newRebindingPacketConn(t *testing.T) *rebindingPacketConn {
+	c := &rebindingPacketConn{datagrams: make(chan rebindingDatagram, 256), done: make(chan struct{})}
+	c.rebind(t)
+	return c
+}
+
+// rebind sends the next datagrams from a new UDP socket.
+func (this *rebindingPacketConn) rebind(t *testing.T) {
+	pc := listenUDP(t)
+	this.mutex.Lock()
+	this.conns = append(this.conns, pc)
+	this.mutex.Unlock()
+	go func() {
+		for {
+			b := make([]byte, MAX_RECEIVE_PACKET_SIZE)
+			n, addr, err := pc.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			select {
+			case this.datagrams <- rebindingDatagram{data: b[:n], addr: addr}:
+			case <-this.done:
+				return
+			}
+		}
+	}()
+}
+
+func (this *rebindingPacketConn) current() net.PacketConn {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.conns[len(this.conns)-1]
+}
+
+func (this *rebindingPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case d := <-this.datagrams:
+		return copy(b, d.data), d.addr, nil
+	case <-this.done:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (this *rebindingPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return this.current().WriteTo(b, addr)
+}
+
+func (this *rebindingPacketConn) Close() error {
+	this.closeOnce.Do(func() {
+		close(this.done)
+		this.mutex.Lock()
+		for _, pc := range this.conns {
+			pc.Close()
+		}
+		this.mutex.Unlock()
+	})
+	return nil
+}
+
+func (this *rebindingPacketConn) LocalAddr() net.Addr {
+	return this.current().LocalAddr()
+}
+
+func (this *rebindingPacketConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (this *rebindingPacketConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (this *rebindingPacketConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// mtuPacketConn is a PacketConn on a path that drops the datagrams larger than mtu bytes.
+type mtuPacketConn struct {
+	net.PacketConn
+	mtu     int
+	mutex   sync.Mutex
+	largest int
+	dropped int
+}
+
+func (this *mtuPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	this.mutex.Lock()
+	if len(b) > this.mtu {
+		this.dropped++
+		this.mutex.Unlock()
+		return len(b), nil
+	}
+	if len(b) > this.largest {
+		this.largest = len(b)
+	}
+	this.mutex.Unlock()
+	return this.PacketConn.WriteTo(b, addr)
+}
+
+// stats returns the size of the largest datagram sent and the number of datagrams dropped.
+func (this *mtuPacketConn) stats() (int, int) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.largest, this.dropped
+}
+
+// Benchmark_StreamTransfer moves 1MB per stream over loopback with io.Copy at both ends, through the ReadFrom and WriteTo
+// of the streams: -benchtime 1024x moves 1GB. The client skips the verification of the self-signed certificate of the server.
+func Benchmark_StreamTransfer(b *testing.B) {
+	pc := listenUDP(b)
+	defer pc.Close()
+	l, err := Listen(pc, &Config{AllowInsecure: true})
+	if err != nil {
+		b.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+	received := make(chan int64)
+	go func() {
+		s, err := l.Accept()
+		if err != nil {
+			return
+		}
+		for {
+			st, err := s.AcceptStream(context.Background())
+			if err != nil {
+				return
+			}
+			n, _ := io.Copy(ioutil.Discard, st)
+			received <- n
+		}
+	}()
+	s, err := Dial(l.Addr().String(), &Config{InsecureSkipVerify: true, AllowInsecure: true})
+	if err != nil {
+		b.Fatalf("Dial : unexpected error %v", err)
+	}
+	defer s.Close(nil)
+
+	const size = 1 << 20
+	b.ReportAllocs()
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		st, err := s.OpenStream()
+		if err != nil {
+			b.Fatalf("Session.OpenStream : unexpected error %v", err)
+		}
+		if _, err = io.Copy(st, io.LimitReader(zeroReader{}, size)); err != nil {
+			b.Fatalf("Stream.ReadFrom : unexpected error %v", err)
+		}
+		st.Close()
+		if n := <-received; n != size {
+			b.Fatalf("Stream.WriteTo : %v bytes received instead of %v", n, size)
+		}
+	}
+}
+
+// zeroReader reads zeros forever.
+type zeroReader struct{}
+
+func (this zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func Test_Dial_Listen(t *testing.T) {
+	pc := listenUDP(t)
+	defer pc.Close()
+	l, err := Listen(pc, testServerConfig(t, nil))
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+	go echoServer(l)
+
+	var tests_dial = []*Config{nil, {ReturnAtZeroRTT: true}}
+	for i, cfg := range tests_dial {
+		s, err := Dial(l.Addr().String(), testClientConfig(t, cfg))
+		if err != nil {
+			t.Fatalf("Dial : unexpected error %v in test n°%v", err, i)
+		}
+		if s.RemoteAddr().String() != l.Addr().String() {
+			t.Errorf("Session.RemoteAddr : %v expected instead of %v in test n°%v", l.Addr(), s.RemoteAddr(), i)
+		}
+		checkEcho(t, s, "hello", i)
+		s.Close(nil)
+	}
+
+	// A Listener per PacketConn
+	if _, err = Listen(pc, nil); err == nil {
+		t.Errorf("Listen : error expected for a second Listener on the PacketConn")
+	}
+}
+
+func Test_NewSession(t *testing.T) {
+	clock := testutil.NewClock(time.Now())
+	network := testutil.NewSimulatedNetwork(clock, testutil.Link{Delay: 5 * time.Millisecond}, 1)
+	defer clock.Run(time.Millisecond)()
+	client, server, closeSessions := newSimulatedSessions(t, network, &Config{Clock: clock}, &Config{Clock: clock})
+	defer closeSessions()
+
+	// Both ends open the streams of their perspective
+	go echoSession(client)
+	go echoSession(server)
+	for i, s := range []Session{client, server} {
+		checkEcho(t, s, "hello", i)
+	}
+
+	// The server only accepts the CHLO of its remote address, until the end of its context
+	pc, peer, other := network.ListenPacket(), network.ListenPacket(), network.ListenPacket()
+	defer pc.Close()
+	defer peer.Close()
+	defer other.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	dialed := make(chan error, 1)
+	go func() {
+		_, err := DialPacketConnContext(ctx, other, pc.LocalAddr(), "localhost", testClientConfig(t, &Config{Clock: clock}))
+		dialed <- err
+	}()
+	s, err := NewSessionContext(ctx, pc, peer.LocalAddr(), protocol.PERSPECTIVE_SERVER, testServerConfig(t, &Config{Clock: clock}))
+	var cerr protocol.ContextError
+	if s != nil || !errors.As(err, &cerr) || cerr.Op != "NewSession" {
+		t.Errorf("NewSessionContext : ContextError expected instead of %v", err)
+	}
+	if err = <-dialed; err == nil {
+		t.Errorf("DialPacketConnContext : the server must ignore the CHLO of another address")
+	}
+
+	if _, err = NewSession(pc, peer.LocalAddr(), protocol.Perspective(0), nil); err == nil {
+		t.Errorf("NewSession : error expected for an unknown perspective")
+	}
+}
+
+func Test_Dial_SessionCache(t *testing.T) {
+	pc := listenUDP(t)
+	defer pc.Close()
+	serverConfig := testServerConfig(t, nil)
+	tokens, err := handshake.NewSourceAddressTokens(handshake.DEFAULT_SOURCE_ADDRESS_TOKEN_LIFETIME, true)
+	if err != nil {
+		t.Fatalf("NewSourceAddressTokens : unexpected error %v", err)
+	}
+	serverConfig.ServerConfig.(*handshake.ServerConfig).SetSourceAddressTokens(tokens)
+	l, err := Listen(pc, serverConfig)
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+	go echoServer(l)
+
+	// The second Dial sends the full CHLO at once with the server config of the first one: one round trip fewer
+	cfg := testClientConfig(t, &Config{SessionCache: handshake.NewLRUClientSessionCache(0), AllowZeroRTT: true})
+	for i, chlos := range []int{2, 1} {
+		s, err := Dial(l.Addr().String(), cfg)
+		if err != nil {
+			t.Fatalf("Dial : unexpected error %v in test n°%v", err, i)
+		}
+		if n := s.(*session).cryptoSetup.(*handshake.CryptoClient).GetClientHellosSent(); n != chlos {
+			t.Errorf("Dial : %v CHLO expected instead of %v in test n°%v", chlos, n, i)
+		}
+		checkEcho(t, s, "hello", i)
+		s.Close(nil)
+	}
+	if _, ok := cfg.SessionCache.Get("127.0.0.1"); !ok {
+		t.Errorf("ClientSessionCache.Get : state of the server expected")
+	}
+}
+
+var tests_insecure = []struct {
+	forceNull bool
+}{
+	{false},
+	{true},
+}
+
+func Test_Dial_Insecure(t *testing.T) {
+	for i, v := range tests_insecure {
+		// The server has the self-signed certificate of its generated server config, without test certificates
+		pc := listenUDP(t)
+		l, err := Listen(pc, &Config{ForceNullEncryption: v.forceNull, AllowInsecure: true})
+		if err != nil {
+			t.Fatalf("Listen : unexpected error %v in test n°%v", err, i)
+		}
+		go echoServer(l)
+		s, err := Dial(l.Addr().String(), &Config{InsecureSkipVerify: true, ForceNullEncryption: v.forceNull, AllowInsecure: true})
+		if err != nil {
+			t.Fatalf("Dial : unexpected error %v in test n°%v", err, i)
+		}
+		checkEcho(t, s, "hello", i)
+		if _, null := s.(*session).sealer.(*crypto.AEAD_NullFNV1A128); null != v.forceNull {
+			t.Errorf("Dial : NullAEAD %v expected for the forward-secure packets in test n°%v", v.forceNull, i)
+		}
+		s.Close(nil)
+		l.Close()
+		pc.Close()
+	}
+
+	// The certificate of the server is verified by default
+	pc := listenUDP(t)
+	defer pc.Close()
+	l, err := Listen(pc, nil)
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+	go echoServer(l)
+	var perr handshake.ErrProofInvalid
+	if _, err = Dial(l.Addr().String(), nil); !errors.As(err, &perr) {
+		t.Errorf("Dial : ErrProofInvalid expected instead of %v", err)
+	}
+}
+
+func Test_Dial_VersionNegotiation(t *testing.T) {
+	pc := listenUDP(t)
+	defer pc.Close()
+	l, err := Listen(pc, testServerConfig(t, &Config{Versions: []protocol.QuicVersion{protocol.QUIC_VERSION_39, protocol.QUIC_VERSION_37}}))
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+	go echoServer(l)
+
+	// The client proposes Q043, then chooses the highest common version
+	s, err := Dial(l.Addr().String(), testClientConfig(t, &Config{Versions: []protocol.QuicVersion{protocol.QUIC_VERSION_43, protocol.QUIC_VERSION_37, protocol.QUIC_VERSION_39}}))
+	if err != nil {
+		t.Fatalf("Dial : unexpected error %v", err)
+	}
+	if v := s.(*session).version; v != protocol.QUIC_VERSION_39 {
+		t.Errorf("Dial : version Q039 expected instead of %v", v)
+	}
+	checkEcho(t, s, "hello", 0)
+	s.Close(nil)
+
+	// No common version
+	if _, err = Dial(l.Addr().String(), &Config{Versions: []protocol.QuicVersion{protocol.QUIC_VERSION_43}}); err != protocol.ErrNoCommonVersion {
+		t.Errorf("Dial : ErrNoCommonVersion expected instead of %v", err)
+	}
+}
+
+func Test_Listen_SharedPacketConn(t *testing.T) {
+	var listeners [2]Listener
+
+	// Each PacketConn has a Listener and dials the Listener of the other one
+	pcs := [2]net.PacketConn{listenUDP(t), listenUDP(t)}
+	for i, pc := range pcs {
+		defer pc.Close()
+		l, err := Listen(pc, testServerConfig(t, nil))
+		if err != nil {
+			t.Fatalf("Listen : unexpected error %v in test n°%v", err, i)
+		}
+		listeners[i] = l
+		go echoServer(l)
+	}
+	var sessions [2]Session
+	for i, pc := range pcs {
+		s, err := DialPacketConn(pc, pcs[1-i].LocalAddr(), "localhost", testClientConfig(t, nil))
+		if err != nil {
+			t.Fatalf("DialPacketConn : unexpected error %v in test n°%v", err, i)
+		}
+		if s.LocalAddr().String() != pc.LocalAddr().String() {
+			t.Errorf("Session.LocalAddr : %v expected instead of %v in test n°%v", pc.LocalAddr(), s.LocalAddr(), i)
+		}
+		sessions[i] = s
+	}
+	for i, s := range sessions {
+		checkEcho(t, s, "hello", i)
+	}
+
+	// Closing the Listener doesn't close the sessions dialed on the PacketConn, nor the PacketConn
+	listeners[0].Close()
+	if _, err := listeners[0].Accept(); err != ErrListenerClosed {
+		t.Errorf("Listener.Accept : ErrListenerClosed expected instead of %v", err)
+	}
+	checkEcho(t, sessions[0], "still open", 0)
+	checkEcho(t, sessions[1], "still open", 1)
+
+	// The sessions are closed with the PacketConn
+	listeners[1].Close()
+	sessions[1].Close(nil)
+	pcs[0].Close()
+	accepted := make(chan error, 1)
+	go func() {
+		_, err := sessions[0].AcceptStream(context.Background())
+		accepted <- err
+	}()
+	select {
+	case err := <-accepted:
+		if err == nil {
+			t.Errorf("Session.AcceptStream : error expected after the PacketConn is closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Session.AcceptStream : the session must be closed with the PacketConn")
+	}
+}
+
+func Test_Listen_StatelessVersionNegotiation(t *testing.T) {
+	pc := listenUDP(t)
+	defer pc.Close()
+	clock := testutil.NewClock(time.Now())
+	l, err := Listen(pc, testServerConfig(t, &Config{Clock: clock}))
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+	client := listenUDP(t)
+	defer client.Close()
+	goroutines := runtime.NumGoroutine()
+
+	// Thousands of packets of an unsupported version, undersized or of a supported version without CHLO
+	var tests_packets = []struct {
+		version protocol.QuicVersion
+		size    int
+	}{
+		{0x0a0a0a0a, MIN_INITIAL_PACKET_SIZE},
+		{0x0a0a0a0a, MIN_INITIAL_PACKET_SIZE - 1},
+		{protocol.QUIC_VERSION_39, MIN_INITIAL_PACKET_SIZE},
+		{protocol.QUIC_VERSION_39, 100},
+	}
+	send := func(i int) {
+		v := tests_packets[i%len(tests_packets)]
+		b := make([]byte, v.size)
+		b[0] = protocol.QUICFLAG_VERSION | protocol.QUICFLAG_CONNID_64bit
+		binary.LittleEndian.PutUint64(b[1:], uint64(i))
+		binary.LittleEndian.PutUint32(b[9:], uint32(v.version))
+		if _, err = client.WriteTo(b, l.Addr()); err != nil {
+			t.Fatalf("PacketConn.WriteTo : unexpected error %v in test n°%v", err, i)
+		}
+	}
+	// The version negotiation packets are rate limited: one per VERSION_NEGOTIATION_INTERVAL
+	b := make([]byte, MAX_RECEIVE_PACKET_SIZE)
+	for j, packets := range []int{4000, 1} {
+		for i := 0; i < packets; i++ {
+			send(i)
+		}
+		replies := 0
+		for {
+			client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			n, _, err := client.ReadFrom(b)
+			if err != nil {
+				break
+			}
+			if b[0]&protocol.QUICFLAG_VERSION == 0 || n != len(protocol.BuildVersionNegotiationPacket(0, protocol.SupportedVersions())) {
+				t.Errorf("Listener : version negotiation packet expected instead of %x in test n°%v", b[:n], j)
+			}
+			replies++
+		}
+		if replies != 1 {
+			t.Errorf("Listener : 1 version negotiation packet expected instead of %v in test n°%v", replies, j)
+		}
+		clock.Advance(VERSION_NEGOTIATION_INTERVAL)
+	}
+
+	// No session nor goroutine is created
+	ln := l.(*listener)
+	ln.mux.mutex.Lock()
+	sessions := len(ln.mux.sessions)
+	ln.mux.mutex.Unlock()
+	ln.mutex.Lock()
+	pending := len(ln.pending)
+	ln.mutex.Unlock()
+	if sessions != 0 || pending != 0 {
+		t.Errorf("Listener : no session expected instead of %v sessions and %v pending", sessions, pending)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("Listener : %v goroutines expected instead of %v", goroutines, n)
+	}
+}
+
+func Test_Listen_PublicResetRateLimit(t *testing.T) {
+	pc := listenUDP(t)
+	defer pc.Close()
+	clock := testutil.NewClock(time.Now())
+	secret := []byte("0123456789abcdef")
+	l, err := Listen(pc, testServerConfig(t, &Config{Clock: clock, PublicResetSecret: secret, MaxPublicResetsPerSecond: 3}))
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+
+	// A flood of packets of unknown connections from 1 address, then from 8 addresses: one public reset per
+	// PublicResetInterval and per address, and MaxPublicResetsPerSecond in total. The packets too small for the amplification
+	// factor get none
+	var tests_floods = []struct {
+		sources  int
+		size     int
+		expected int
+	}{
+		{1, 16, 0},
+		{1, 17, 1},
+		{8, 17, 3},
+	}
+	b := make([]byte, MAX_RECEIVE_PACKET_SIZE)
+	for j, v := range tests_floods {
+		var clients []net.PacketConn
+		for i := 0; i < v.sources; i++ {
+			clients = append(clients, listenUDP(t))
+		}
+		for i := 0; i < 2000; i++ {
+			p := make([]byte, v.size)
+			p[0] = protocol.QUICFLAG_CONNID_64bit | protocol.QUICFLAG_SEQNUM_48bit
+			binary.LittleEndian.PutUint64(p[1:], uint64(i+1))
+			if _, err = clients[i%v.sources].WriteTo(p, l.Addr()); err != nil {
+				t.Fatalf("PacketConn.WriteTo : unexpected error %v in test n°%v", err, j)
+			}
+		}
+		replies := 0
+		for _, client := range clients {
+			for {
+				client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+				n, _, err := client.ReadFrom(b)
+				if err != nil {
+					break
+				}
+				reset, err := protocol.ParsePublicReset(b[:n])
+				if err != nil || !reset.VerifyNonceProof(publicResetNonceProof(secret, reset.ConnectionID)) {
+					t.Errorf("Listener : public reset expected instead of %x (%v) in test n°%v", b[:n], err, j)
+				}
+				replies++
+			}
+			client.Close()
+		}
+		if replies != v.expected {
+			t.Errorf("Listener : %v public resets expected instead of %v in test n°%v", v.expected, replies, j)
+		}
+		clock.Advance(time.Second)
+	}
+	if v := metricValues(l.Metrics())["quic_listener_public_resets_sent_total"]; v != 4 {
+		t.Errorf("Listener.Metrics : 4 public resets expected instead of %v", v)
+	}
+}
+
+func Test_Dial_ServerRestart(t *testing.T) {
+	pc := listenUDP(t)
+	addr := pc.LocalAddr().String()
+	secret := []byte("0123456789abcdef")
+	l, err := Listen(pc, testServerConfig(t, &Config{PublicResetSecret: secret}))
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	go echoServer(l)
+	var sessions [2]Session
+	for i := range sessions {
+		if sessions[i], err = Dial(addr, testClientConfig(t, nil)); err != nil {
+			t.Fatalf("Dial : unexpected error %v in test n°%v", err, i)
+		}
+		defer sessions[i].Close(nil)
+		checkEcho(t, sessions[i], "hello", i)
+	}
+
+	// restart starts a new process of the server on the same address, with the secret of the public resets
+	restart := func(secret []byte) (net.PacketConn, Listener) {
+		l.Close()
+		pc.Close()
+		if pc, err = net.ListenPacket("udp", addr); err != nil {
+			t.Fatalf("net.ListenPacket : unexpected error %v", err)
+		}
+		if l, err = Listen(pc, testServerConfig(t, &Config{PublicResetSecret: secret})); err != nil {
+			t.Fatalf("Listen : unexpected error %v", err)
+		}
+		go echoServer(l)
+		return pc, l
+	}
+
+	// The public reset of another secret is ignored
+	pc, l = restart([]byte("fedcba9876543210"))
+	stream, err := sessions[0].OpenStream()
+	if err != nil {
+		t.Fatalf("Session.OpenStream : unexpected error %v", err)
+	}
+	stream.Write([]byte("hello"))
+	time.Sleep(300 * time.Millisecond)
+	if _, err = sessions[0].OpenStream(); err != nil {
+		t.Errorf("Session.OpenStream : a public reset with an invalid nonce proof must be ignored instead of %v", err)
+	}
+
+	// The public reset of the same secret closes the session at its first packet, and the client dials again at once
+	pc, l = restart(secret)
+	defer pc.Close()
+	defer l.Close()
+	stream, err = sessions[1].OpenStream()
+	if err != nil {
+		t.Fatalf("Session.OpenStream : unexpected error %v", err)
+	}
+	start := time.Now()
+	stream.Write([]byte("hello"))
+	if _, err = stream.Read(make([]byte, 5)); !errors.Is(err, ErrPublicReset) {
+		t.Errorf("Stream.Read : ErrPublicReset expected instead of %v", err)
+	}
+	// Before the minimum retransmission timeout: the answer to the first packet
+	if d := time.Since(start); d > ackhandler.RTO_MIN {
+		t.Errorf("Session : closed by the public reset after %v", d)
+	}
+	s2, err := Dial(addr, testClientConfig(t, nil))
+	if err != nil {
+		t.Fatalf("Dial : unexpected error %v", err)
+	}
+	checkEcho(t, s2, "hello again", 0)
+	s2.Close(nil)
+}
+
+func Test_Dial_Migration(t *testing.T) {
+	pc := listenUDP(t)
+	defer pc.Close()
+	l, err := Listen(pc, testServerConfig(t, &Config{AllowMigration: true}))
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+	accepted := make(chan Session, 1)
+	go func() {
+		s, err := l.Accept()
+		if err != nil {
+			return
+		}
+		accepted <- s
+		st, err := s.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		io.Copy(st, st)
+		st.Close()
+	}()
+
+	client := newRebindingPacketConn(t)
+	defer client.Close()
+	s, err := DialPacketConn(client, l.Addr(), "localhost", testClientConfig(t, nil))
+	if err != nil {
+		t.Fatalf("DialPacketConn : unexpected error %v", err)
+	}
+	defer s.Close(nil)
+	server := <-accepted
+	if server.RemoteAddr().String() != client.LocalAddr().String() {
+		t.Errorf("Session.RemoteAddr : %v expected instead of %v", client.LocalAddr(), server.RemoteAddr())
+	}
+
+	// The client moves to another port in the middle of the transfer
+	st, err := s.OpenStream()
+	if err != nil {
+		t.Fatalf("Session.OpenStream : unexpected error %v", err)
+	}
+	data := make([]byte, 200*1024)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	go func() {
+		st.Write(data[:len(data)/2])
+		client.rebind(t)
+		st.Write(data[len(data)/2:])
+		st.Close()
+	}()
+	st.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if echo, err := ioutil.ReadAll(st); err != nil || !bytes.Equal(echo, data) {
+		t.Fatalf("Stream.Read : %v bytes echoed instead of %v (%v)", len(echo), len(data), err)
+	}
+
+	// The server follows the client to its new address
+	deadline := time.Now().Add(5 * time.Second)
+	for server.RemoteAddr().String() != client.LocalAddr().String() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Session.RemoteAddr : %v expected instead of %v", client.LocalAddr(), server.RemoteAddr())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_Session_PathMTUDiscovery(t *testing.T) {
+	var tests_mtu = []struct {
+		disable bool
+		size    int
+	}{
+		{false, 1400},
+		{true, MAX_PACKET_SIZE},
+	}
+	for i, v := range tests_mtu {
+		network := newInstantNetwork()
+		pc := &mtuPacketConn{PacketConn: network.ListenPacket(), mtu: 1400}
+		client := &mtuPacketConn{PacketConn: network.ListenPacket(), mtu: 1400}
+		s, server, closeSessions := newPacketConnSessions(t, client, pc, testClientConfig(t, &Config{DisableMTUDiscovery: v.disable}), testServerConfig(t, &Config{DisableMTUDiscovery: v.disable}))
+		go echoSession(server)
+
+		// The probes over 1400 bytes are lost, without harm to the transfer
+		st, err := s.OpenStream()
+		if err != nil {
+			t.Fatalf("Session.OpenStream : unexpected error %v in test n°%v", err, i)
+		}
+		data := make([]byte, 500*1024)
+		for j := range data {
+			data[j] = byte(j % 251)
+		}
+		go func() {
+			st.Write(data)
+			st.Close()
+		}()
+		st.SetReadDeadline(time.Now().Add(10 * time.Second))
+		if echo, err := ioutil.ReadAll(st); err != nil || !bytes.Equal(echo, data) {
+			t.Fatalf("Stream.Read : %v bytes echoed instead of %v (%v) in test n°%v", len(echo), len(data), err, i)
+		}
+		s.Close(nil)
+		if size := s.(*session).mtuDiscoverer.GetPacketSize(); size != v.size {
+			t.Errorf("mtuDiscoverer.GetPacketSize : %v bytes expected instead of %v in test n°%v", v.size, size, i)
+		}
+		largest, dropped := client.stats()
+		if largest != v.size || (dropped > 0) == v.disable {
+			t.Errorf("mtuPacketConn : largest datagram of %v bytes expected instead of %v, %v dropped in test n°%v", v.size, largest, dropped, i)
+		}
+		closeSessions()
+	}
+}
+
+func Test_DialContext_Cancel(t *testing.T) {
+	// The server never answers
+	pc := listenUDP(t)
+	defer pc.Close()
+	goroutines := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s, err := DialContext(ctx, pc.LocalAddr().String(), nil)
+	if s != nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("DialContext : context.DeadlineExceeded expected instead of %v", err)
+	}
+	if cerr, ok := err.(protocol.ContextError); !ok || cerr.Op != "DialContext" {
+		t.Errorf("DialContext : protocol.ContextError expected instead of %v", err)
+	}
+
+	// The goroutines of the session and of the UDP socket are gone
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > goroutines {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Errorf("DialContext : %v goroutines expected instead of %v\n%s", goroutines, runtime.NumGoroutine(), buf[:runtime.Stack(buf, true)])
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_Dial_HandshakeTimeout(t *testing.T) {
+	// The server never answers: the client gives up after its handshake timeout, before its idle timeout
+	clock := testutil.NewClock(time.Unix(1000, 0))
+	network := testutil.NewSimulatedNetwork(clock, testutil.Link{Delay: 5 * time.Millisecond}, 1)
+	server, client := network.ListenPacket(), network.ListenPacket()
+	defer server.Close()
+	defer client.Close()
+	stop := clock.Run(time.Millisecond)
+	defer stop()
+
+	config := testClientConfig(t, &Config{Clock: clock, HandshakeTimeout: 3 * time.Second})
+	s, err := DialPacketConn(client, server.LocalAddr(), "localhost", config)
+	var serr Error
+	if s != nil || !errors.Is(err, ErrHandshakeTimeout) || !errors.As(err, &serr) || serr.Remote {
+		t.Fatalf("DialPacketConn : ErrHandshakeTimeout expected instead of %v", err)
+	}
+	if elapsed := clock.Now().Sub(time.Unix(1000, 0)); elapsed < 3*time.Second || elapsed > 4*time.Second {
+		t.Errorf("DialPacketConn : handshake timeout after 3s expected instead of %v", elapsed)
+	}
+}
+
+func Test_Listen_HandshakeTimeout(t *testing.T) {
+	var wg sync.WaitGroup
+
+	// The packets of the server are lost: its sessions in handshake are closed after its handshake timeout,
+	// and the CHLOs of the other clients are dropped meanwhile
+	clock := testutil.NewClock(time.Unix(1000, 0))
+	network := testutil.NewSimulatedNetwork(clock, testutil.Link{Delay: 5 * time.Millisecond}, 1)
+	pc := network.ListenPacket()
+	defer pc.Close()
+	pc.SetLink(testutil.Link{Loss: 1})
+	stop := clock.Run(time.Millisecond)
+	defer stop()
+	l, err := Listen(pc, testServerConfig(t, &Config{Clock: clock, HandshakeTimeout: 2 * time.Second, MaxPendingSessions: 1}))
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+
+	const CLIENTS = 3
+	for i := 0; i < CLIENTS; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := network.ListenPacket()
+			defer client.Close()
+			config := testClientConfig(t, &Config{Clock: clock, HandshakeTimeout: 5 * time.Second})
+			if _, err := DialPacketConn(client, pc.LocalAddr(), "localhost", config); !errors.Is(err, ErrHandshakeTimeout) {
+				t.Errorf("DialPacketConn : ErrHandshakeTimeout expected instead of %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	values := metricValues(l.Metrics())
+	failures := values["quic_listener_handshake_failures_total{"+protocol.QUIC_HANDSHAKE_TIMEOUT.String()+"}"]
+	if failures == 0 {
+		t.Errorf("Listener : handshake timeouts expected after 2s")
+	}
+	if values["quic_listener_chlos_dropped_total"] == 0 {
+		t.Errorf("Listener : CHLOs dropped expected above MaxPendingSessions")
+	}
+	if values["quic_listener_handshakes_total"] != 0 {
+		t.Errorf("Listener : no handshake expected instead of %v", values["quic_listener_handshakes_total"])
+	}
+}
+
+func Test_Dial_InvalidCertificate(t *testing.T) {
+	pc := listenUDP(t)
+	defer pc.Close()
+	l, err := Listen(pc, testServerConfig(t, nil))
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+	go echoServer(l)
+
+	// The test CA isn't trusted by default, and the certificate isn't valid for another hostname
+	var tests_certificates = []struct {
+		hostname string
+		config   *Config
+	}{
+		{"localhost", nil},
+		{"example.org", testClientConfig(t, nil)},
+	}
+	for i, v := range tests_certificates {
+		pcClient := listenUDP(t)
+		s, err := DialPacketConn(pcClient, l.Addr(), v.hostname, v.config)
+		var perr handshake.ErrProofInvalid
+		if s != nil || !errors.As(err, &perr) {
+			t.Errorf("DialPacketConn : handshake.ErrProofInvalid expected instead of %v in test n°%v", err, i)
+		}
+		pcClient.Close()
+	}
+}
+
+// truncationPacketConn counts the datagrams of the server by port of the client, and those without Connection ID in each direction.
+type truncationPacketConn struct {
+	net.PacketConn
+	mutex     sync.Mutex
+	datagrams map[int]int
+	sent      map[int]int
+	received  map[int]int
+}
+
+func newTruncationPacketConn(t *testing.T) *truncationPacketConn {
+	return &truncationPacketConn{PacketConn: listenUDP(t), datagrams: make(map[int]int), sent: make(map[int]int), received: make(map[int]int)}
+}
+
+func (this *truncationPacketConn) count(b []byte, addr net.Addr, truncated map[int]int) {
+	port := addr.(*net.UDPAddr).Port
+	this.mutex.Lock()
+	this.datagrams[port]++
+	if len(b) > 0 && b[0]&(protocol.QUICFLAG_PUBLICRESET|protocol.QUICMASK_CONNID_SIZE) == protocol.QUICFLAG_CONNID_0bit {
+		truncated[port]++
+	}
+	this.mutex.Unlock()
+}
+
+func (this *truncationPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	this.count(b, addr, this.sent)
+	return this.PacketConn.WriteTo(b, addr)
+}
+
+func (this *truncationPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := this.PacketConn.ReadFrom(b)
+	if err == nil {
+		this.count(b[:n], addr, this.received)
+	}
+	return n, addr, err
+}
+
+// stats returns the number of datagrams exchanged with the port, and those sent and received without Connection ID.
+func (this *truncationPacketConn) stats(port int) (int, int, int) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.datagrams[port], this.sent[port], this.received[port]
+}
+
+func Test_Listen_TruncatedConnectionID(t *testing.T) {
+	pc := newTruncationPacketConn(t)
+	defer pc.Close()
+	l, err := Listen(pc, testServerConfig(t, &Config{TruncateConnectionID: true}))
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+	go echoServer(l)
+
+	// The truncated and full Connection ID sessions share the Listener: both endpoints omit the Connection ID if the client proposes it
+	var tests_truncate = []bool{true, false, true}
+	sessions := make([]Session, len(tests_truncate))
+	for i, truncate := range tests_truncate {
+		s, err := Dial(l.Addr().String(), testClientConfig(t, &Config{TruncateConnectionID: truncate}))
+		if err != nil {
+			t.Fatalf("Dial : unexpected error %v in test n°%v", err, i)
+		}
+		defer s.Close(nil)
+		sessions[i] = s
+	}
+	for i, s := range sessions {
+		checkEcho(t, s, "hello", i)
+	}
+	for i, truncate := range tests_truncate {
+		datagrams, sent, received := pc.stats(sessions[i].LocalAddr().(*net.UDPAddr).Port)
+		if datagrams == 0 || (sent > 0) != truncate || (received > 0) != truncate {
+			t.Errorf("Listener : %v datagrams with %v sent and %v received without Connection ID in test n°%v", datagrams, sent, received, i)
+		}
+	}
+
+	// The PacketConn of DialPacketConn can be shared with other sessions of the server address
+	shared := listenUDP(t)
+	defer shared.Close()
+	var cerr ErrInvalidConfig
+	config := testClientConfig(t, &Config{TruncateConnectionID: true})
+	if _, err = DialPacketConn(shared, l.Addr(), "localhost", config); !errors.As(err, &cerr) || cerr.Field != "TruncateConnectionID" {
+		t.Errorf("DialPacketConn : ErrInvalidConfig of TruncateConnectionID expected instead of %v", err)
+	}
+}
+
+// spoofedPacketConn is the PacketConn of a victim whose address is spoofed by an attacker: only the first datagram
+// reaches the server, the datagrams of the server are counted and dropped.
+type spoofedPacketConn struct {
+	net.PacketConn
+	mutex    sync.Mutex
+	sent     int
+	received int
+}
+
+func (this *spoofedPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.sent > 0 {
+		return len(b), nil
+	}
+	this.sent = len(b)
+	return this.PacketConn.WriteTo(b, addr)
+}
+
+func (this *spoofedPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := this.PacketConn.ReadFrom(b)
+		if err != nil {
+			return n, addr, err
+		}
+		this.mutex.Lock()
+		this.received += n
+		this.mutex.Unlock()
+	}
+}
+
+// stats returns the size of the datagram sent, and the bytes received.
+func (this *spoofedPacketConn) stats() (int, int) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.sent, this.received
+}
+
+func Test_Listen_AntiAmplification(t *testing.T) {
+	pc := listenUDP(t)
+	defer pc.Close()
+	l, err := Listen(pc, testServerConfig(t, &Config{IdleTimeout: time.Second}))
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+
+	// The CHLO of the attacker asks for the largest windows, the server answers until its idle timeout
+	victim := &spoofedPacketConn{PacketConn: listenUDP(t)}
+	defer victim.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2500*time.Millisecond)
+	defer cancel()
+	config := testClientConfig(t, &Config{StreamFlowControlWindow: 16 << 20, ConnectionFlowControlWindow: 24 << 20})
+	if _, err = DialPacketConnContext(ctx, victim, l.Addr(), "localhost", config); err == nil {
+		t.Fatalf("DialPacketConnContext : error expected")
+	}
+	sent, received := victim.stats()
+	if sent == 0 || received == 0 || received > AMPLIFICATION_FACTOR*sent {
+		t.Errorf("Listener : at most %v bytes expected for a CHLO of %v bytes instead of %v", AMPLIFICATION_FACTOR*sent, sent, received)
+	}
+}
+
+// metricValues returns the values of the metrics by name, with the label value in braces.
+func metricValues(metrics Metrics) map[string]float64 {
+	values := make(map[string]float64)
+	metrics.Each(func(m Metric) {
+		name := m.Name
+		if m.LabelName != "" {
+			name += "{" + m.LabelValue + "}"
+		}
+		values[name] = m.Value
+	})
+	return values
+}
+
+func Test_Listener_Metrics(t *testing.T) {
+	var wg sync.WaitGroup
+
+	clock := testutil.NewClock(time.Unix(1000, 0))
+	network := testutil.NewSimulatedNetwork(clock, testutil.Link{Delay: 5 * time.Millisecond}, 1)
+	pc := network.ListenPacket()
+	stop := clock.Run(time.Millisecond)
+	defer stop()
+	l, err := Listen(pc, testServerConfig(t, &Config{Clock: clock, Versions: []protocol.QuicVersion{protocol.QUIC_VERSION_39}}))
+	if err != nil {
+		t.Fatalf("Listen : unexpected error %v", err)
+	}
+	defer l.Close()
+	go echoServer(l)
+
+	// Clients proposing an unsupported version first, and a client that rejects the certificate of the server:
+	// all of them receive a version negotiation packet
+	const CLIENTS = 5
+	sessions := make([]Session, CLIENTS)
+	for i := 0; i < CLIENTS; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			config := testClientConfig(t, &Config{Clock: clock, Versions: []protocol.QuicVersion{protocol.QUIC_VERSION_43, protocol.QUIC_VERSION_39}})
+			s, err := DialPacketConn(network.ListenPacket(), pc.LocalAddr(), "localhost", config)
+			if err != nil {
+				t.Errorf("DialPacketConn : unexpected error %v in test n°%v", err, i)
+				return
+			}
+			checkEcho(t, s, "hello", i)
+			sessions[i] = s
+		}(i)
+	}
+	wg.Wait()
+	if _, err = DialPacketConn(network.ListenPacket(), pc.LocalAddr(), "example.org", testClientConfig(t, &Config{Clock: clock})); err == nil {
+		t.Fatal("DialPacketConn : handshake.ErrProofInvalid expected")
+	}
+
+	// The handshakes of the last second, until the sessions are closed
+	<-clock.After(time.Unix(1001, 0).Sub(clock.Now()))
+	values := metricValues(l.Metrics())
+	var tests_metrics = []struct {
+		name string
+		min  float64
+		max  float64
+	}{
+		{"quic_listener_active_connections", CLIENTS, CLIENTS},
+		{"quic_listener_handshakes_total", CLIENTS, CLIENTS},
+		{"quic_listener_handshakes_per_second", CLIENTS, CLIENTS},
+		{"quic_listener_handshake_failures_total{" + protocol.QUIC_PROOF_INVALID.String() + "}", 1, 1},
+		{"quic_listener_version_negotiation_packets_sent_total", CLIENTS + 1, CLIENTS + 1},
+		{"quic_listener_public_resets_sent_total", 0, 0},
+		{"quic_listener_chlos_dropped_total", 0, 0},
+		{"quic_listener_bytes_received_total", CLIENTS * handshake.CLIENT_HELLO_MINIMUM_SIZE, 100 * 1000},
+		{"quic_listener_bytes_sent_total", CLIENTS * handshake.CLIENT_HELLO_MINIMUM_SIZE, 100 * 1000},
+	}
+	for i, v := range tests_metrics {
+		if value, ok := values[v.name]; !ok || value < v.min || value > v.max {
+			t.Errorf("Listener.Metrics : %v in [%v, %v] expected instead of %v in test n°%v", v.name, v.min, v.max, value, i)
+		}
+	}
+	if len(values) != len(tests_metrics) {
+		t.Errorf("Listener.Metrics : %v metrics expected instead of %v", len(tests_metrics), values)
+	}
+
+	for _, s := range sessions {
+		if s != nil {
+			s.Close(nil)
+		}
+	}
+	for metricValues(l.Metrics())["quic_listener_active_connections"] != 0 {
+		if clock.Now().After(time.Unix(1010, 0)) {
+			t.Fatal("Listener.Metrics : the closed sessions must not be active")
+		}
+		<-clock.After(10 * time.Millisecond)
+	}
+}
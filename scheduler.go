@@ -0,0 +1,168 @@
+package quic
+
+import "github.com/romain-jacotin/quic/protocol"
+import "github.com/romain-jacotin/quic/stream"
+import "container/heap"
+
+// StreamScheduler orders the data streams that have data to send, the run goroutine of the session sends one STREAM frame
+// of the next stream at a time. The crypto stream and the control frames are sent first, then the headers stream, then
+// the data streams of the scheduler.
+//
+// A stream is scheduled once until Next returns it, the session schedules it again if it still has data to send after its frame.
+// The methods are called with the mutex of the session locked.
+type StreamScheduler interface {
+	// Schedule adds a stream with data to send, sent is the size of the STREAM frame just sent if the stream comes
+	// back from Next, 0 otherwise
+	Schedule(id protocol.QuicStreamID, priority int, sent int)
+	// Next removes and returns the next stream to send, false if no stream is scheduled
+	Next() (protocol.QuicStreamID, bool)
+}
+
+// NewWeightedScheduler returns the default StreamScheduler: the streams share the packets in proportion of their priority,
+// by start-time fair queuing on the bytes sent.
+func NewWeightedScheduler() StreamScheduler {
+	s := &weightedScheduler{}
+	s.queue.less = func(a, b *scheduledStream) bool {
+		return a.tag < b.tag || (a.tag == b.tag && a.seq < b.seq)
+	}
+	return s
+}
+
+// NewStrictPriorityScheduler returns a StreamScheduler that sends the streams of the highest priority first, those of
+// the same priority in round-robin.
+func NewStrictPriorityScheduler() StreamScheduler {
+	s := &strictPriorityScheduler{}
+	s.queue.less = func(a, b *scheduledStream) bool {
+		return a.priority > b.priority || (a.priority == b.priority && a.seq < b.seq)
+	}
+	return s
+}
+
+// NewFIFOScheduler returns a StreamScheduler that sends the streams in the order they have data to send, a stream
+// keeps the packets until it has nothing more to send.
+func NewFIFOScheduler() StreamScheduler {
+	s := &fifoScheduler{}
+	s.queue.less = func(a, b *scheduledStream) bool {
+		return a.seq < b.seq
+	}
+	return s
+}
+
+// scheduledStream is a stream in the queue of a scheduler.
+type scheduledStream struct {
+	id       protocol.QuicStreamID
+	priority int
+	// tag is the virtual start time of the weighted scheduler
+	tag uint64
+	// seq is the order of the scheduling
+	seq uint64
+}
+
+// streamQueue is a heap of the scheduled streams ordered by less.
+type streamQueue struct {
+	streams []scheduledStream
+	less    func(a, b *scheduledStream) bool
+	// last is the stream returned by pop, seq counts the streams pushed
+	last scheduledStream
+	seq  uint64
+}
+
+func (this *streamQueue) Len() int {
+	return len(this.streams)
+}
+
+func (this *streamQueue) Less(i, j int) bool {
+	return this.less(&this.streams[i], &this.streams[j])
+}
+
+func (this *streamQueue) Swap(i, j int) {
+	this.streams[i], this.streams[j] = this.streams[j], this.streams[i]
+}
+
+func (this *streamQueue) Push(x interface{}) {
+	this.streams = append(this.streams, x.(scheduledStream))
+}
+
+func (this *streamQueue) Pop() interface{} {
+	n := len(this.streams) - 1
+	s := this.streams[n]
+	this.streams = this.streams[:n]
+	return s
+}
+
+// push adds the stream to the queue, with the next sequence number if seq is 0.
+func (this *streamQueue) push(s scheduledStream) {
+	if s.seq == 0 {
+		this.seq++
+		s.seq = this.seq
+	}
+	heap.Push(this, s)
+}
+
+// pop removes and returns the first stream of the queue, false if the queue is empty.
+func (this *streamQueue) pop() (scheduledStream, bool) {
+	if len(this.streams) == 0 {
+		return scheduledStream{}, false
+	}
+	this.last = heap.Pop(this).(scheduledStream)
+	return this.last, true
+}
+
+// isBack returns true if the stream comes back from pop after a STREAM frame of sent bytes.
+func (this *streamQueue) isBack(id protocol.QuicStreamID, sent int) bool {
+	return sent > 0 && this.last.id == id && this.last.seq != 0
+}
+
+// weightedScheduler tags each stream with the virtual time it starts its next frame: a stream coming back after a frame
+// starts at the tag of its frame plus its size divided by its priority, a new stream at the virtual time of the last frame.
+type weightedScheduler struct {
+	queue streamQueue
+}
+
+func (this *weightedScheduler) Schedule(id protocol.QuicStreamID, priority int, sent int) {
+	if priority < 1 {
+		priority = 1
+	}
+	tag := this.queue.last.tag
+	if this.queue.isBack(id, sent) {
+		tag += uint64(sent) * stream.MAX_STREAM_PRIORITY / uint64(priority)
+	}
+	this.queue.push(scheduledStream{id: id, priority: priority, tag: tag})
+}
+
+func (this *weightedScheduler) Next() (protocol.QuicStreamID, bool) {
+	s, ok := this.queue.pop()
+	return s.id, ok
+}
+
+// strictPriorityScheduler orders the streams by priority, then by order of scheduling.
+type strictPriorityScheduler struct {
+	queue streamQueue
+}
+
+func (this *strictPriorityScheduler) Schedule(id protocol.QuicStreamID, priority int, sent int) {
+	this.queue.push(scheduledStream{id: id, priority: priority})
+}
+
+func (this *strictPriorityScheduler) Next() (protocol.QuicStreamID, bool) {
+	s, ok := this.queue.pop()
+	return s.id, ok
+}
+
+// fifoScheduler orders the streams by order of scheduling, a stream coming back keeps its place.
+type fifoScheduler struct {
+	queue streamQueue
+}
+
+func (this *fifoScheduler) Schedule(id protocol.QuicStreamID, priority int, sent int) {
+	s := scheduledStream{id: id, priority: priority}
+	if this.queue.isBack(id, sent) {
+		s.seq = this.queue.last.seq
+	}
+	this.queue.push(s)
+}
+
+func (this *fifoScheduler) Next() (protocol.QuicStreamID, bool) {
+	s, ok := this.queue.pop()
+	return s.id, ok
+}
@@ -0,0 +1,83 @@
+package quic
+
+import "github.com/romain-jacotin/quic/protocol"
+import "testing"
+
+// scheduleFrames schedules the streams with their priority, then sends frames of 1000 bytes: a stream stops once it has
+// sent its number of frames. It returns the order of the frames.
+func scheduleFrames(s StreamScheduler, priorities map[protocol.QuicStreamID]int, frames map[protocol.QuicStreamID]int,
+	order []protocol.QuicStreamID) []protocol.QuicStreamID {
+	var sent []protocol.QuicStreamID
+
+	for _, id := range order {
+		s.Schedule(id, priorities[id], 0)
+	}
+	for id, ok := s.Next(); ok; id, ok = s.Next() {
+		sent = append(sent, id)
+		if frames[id]--; frames[id] > 0 {
+			s.Schedule(id, priorities[id], 1000)
+		}
+	}
+	return sent
+}
+
+func Test_WeightedScheduler(t *testing.T) {
+	// The streams share the frames in proportion of their priority while both have data to send
+	priorities := map[protocol.QuicStreamID]int{5: 48, 7: 16}
+	sent := scheduleFrames(NewWeightedScheduler(), priorities, map[protocol.QuicStreamID]int{5: 300, 7: 300}, []protocol.QuicStreamID{5, 7})
+	count := map[protocol.QuicStreamID]int{}
+	for _, id := range sent[:200] {
+		count[id]++
+	}
+	if count[5] < 148 || count[5] > 152 || len(sent) != 600 {
+		t.Errorf("weightedScheduler : 150 and 50 frames expected instead of %v and %v", count[5], count[7])
+	}
+
+	// A new stream starts at the virtual time of the last frame, it doesn't catch up with the bytes sent before
+	s := NewWeightedScheduler()
+	s.Schedule(5, 16, 0)
+	for i := 0; i < 10; i++ {
+		id, _ := s.Next()
+		s.Schedule(id, 16, 1000)
+	}
+	s.Schedule(7, 16, 0)
+	var order []protocol.QuicStreamID
+	for i := 0; i < 4; i++ {
+		id, _ := s.Next()
+		order = append(order, id)
+		s.Schedule(id, 16, 1000)
+	}
+	if order[0] != 7 || order[1] != 5 || order[2] != 7 || order[3] != 5 {
+		t.Errorf("weightedScheduler : round-robin of the streams of the same priority expected instead of %v", order)
+	}
+}
+
+var tests_schedulers = []struct {
+	scheduler  func() StreamScheduler
+	priorities map[protocol.QuicStreamID]int
+	frames     map[protocol.QuicStreamID]int
+	expected   []protocol.QuicStreamID
+}{
+	{NewStrictPriorityScheduler, map[protocol.QuicStreamID]int{5: 2, 7: 1, 9: 2}, map[protocol.QuicStreamID]int{5: 2, 7: 2, 9: 3},
+		[]protocol.QuicStreamID{5, 9, 5, 9, 9, 7, 7}},
+	{NewFIFOScheduler, map[protocol.QuicStreamID]int{5: 1, 7: 200, 9: 1}, map[protocol.QuicStreamID]int{5: 2, 7: 2, 9: 3},
+		[]protocol.QuicStreamID{5, 5, 7, 7, 9, 9, 9}},
+	{NewWeightedScheduler, map[protocol.QuicStreamID]int{5: 16, 7: 16, 9: 16}, map[protocol.QuicStreamID]int{5: 2, 7: 2, 9: 3},
+		[]protocol.QuicStreamID{5, 7, 9, 5, 7, 9, 9}},
+}
+
+func Test_StreamSchedulers(t *testing.T) {
+	for i, v := range tests_schedulers {
+		sent := scheduleFrames(v.scheduler(), v.priorities, v.frames, []protocol.QuicStreamID{5, 7, 9})
+		if len(sent) != len(v.expected) {
+			t.Errorf("StreamScheduler : frames %v expected instead of %v in test n°%v", v.expected, sent, i)
+			continue
+		}
+		for j := range sent {
+			if sent[j] != v.expected[j] {
+				t.Errorf("StreamScheduler : frames %v expected instead of %v in test n°%v", v.expected, sent, i)
+				break
+			}
+		}
+	}
+}
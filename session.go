@@ -0,0 +1,1713 @@
+package quic
+
+import "github.com/romain-jacotin/quic/ackhandler"
+import "github.com/romain-jacotin/quic/congestion"
+import "github.com/romain-jacotin/quic/crypto"
+import "github.com/romain-jacotin/quic/flowcontrol"
+import "github.com/romain-jacotin/quic/handshake"
+import "github.com/romain-jacotin/quic/internal/bufferpool"
+import "github.com/romain-jacotin/quic/internal/packetconn"
+import "github.com/romain-jacotin/quic/protocol"
+import "github.com/romain-jacotin/quic/stream"
+import "context"
+import "errors"
+import "fmt"
+import "io"
+import "net"
+import "sync"
+import "time"
+
+const (
+	// DEFAULT_MAX_STREAMS is the maximum number of concurrent streams proposed in the handshake (MSPC),
+	// and the number of streams an endpoint can open before the negotiation
+	DEFAULT_MAX_STREAMS = handshake.DEFAULT_MAX_STREAMS
+	// MAX_PACKET_SIZE is the maximum size of the packets sent
+	MAX_PACKET_SIZE = congestion.MAX_SEGMENT_SIZE
+	// CONNECTION_ID_SIZE is the size of the Connection ID in the public header of the packets sent
+	CONNECTION_ID_SIZE = 8
+	// MAX_RECEIVED_PACKETS is the number of received packets waiting for the session, the next ones are dropped
+	MAX_RECEIVED_PACKETS = 256
+	// CONNECTION_CLOSE_LINGER is the number of retransmission timeouts the CONNECTION_CLOSE packet is sent again to the packets of the peer
+	CONNECTION_CLOSE_LINGER = 3
+	// MAX_UNDECRYPTABLE_PACKETS is the number of packets kept until the next keys during the handshake, the next ones are dropped
+	MAX_UNDECRYPTABLE_PACKETS = 10
+	// PATH_PROBE_TIMEOUT is the delay before a new PING is sent to a new address of the peer that hasn't acknowledged the previous one
+	PATH_PROBE_TIMEOUT = 500 * time.Millisecond
+	// MAX_PATH_PROBES is the number of PINGs sent to a new address of the peer before it is forgotten
+	MAX_PATH_PROBES = 3
+	// AMPLIFICATION_FACTOR bounds the bytes the server sends to the address of the client until it is validated,
+	// in multiple of the bytes received from there
+	AMPLIFICATION_FACTOR = 3
+)
+
+// HandshakeState is the progress of the crypto handshake of a session, it follows the encryption levels.
+type HandshakeState int
+
+const (
+	// HANDSHAKE_STARTED : no keys yet, only the handshake messages are sent
+	HANDSHAKE_STARTED HandshakeState = iota
+	// HANDSHAKE_ZERO_RTT : the initial keys protect the packets, their data can be replayed and isn't forward secure
+	HANDSHAKE_ZERO_RTT
+	// HANDSHAKE_FORWARD_SECURE : the forward-secure keys protect the packets
+	HANDSHAKE_FORWARD_SECURE
+)
+
+// The errors.Is targets of the Error of a closed session, and of the StreamResetError of a stream.
+var (
+	// ErrSessionClosed matches a session closed by Close without error
+	ErrSessionClosed = errors.New("Session : session closed")
+	// ErrIdleTimeout matches a session closed by the idle timeout, on either side
+	ErrIdleTimeout = errors.New("Session : idle timeout")
+	// ErrHandshakeTimeout matches a session closed before the end of the crypto handshake by its timeout, on either side
+	ErrHandshakeTimeout = errors.New("Session : handshake timeout")
+	// ErrStreamReset matches the stream.StreamResetError returned by a stream reset by either side
+	ErrStreamReset = stream.ErrStreamReset
+	// ErrPublicReset matches a client session closed by a public reset of the server, whose nonce proof is verified
+	ErrPublicReset = errors.New("Session : public reset")
+)
+
+// ErrNoApplicationProtocol fails the handshake of a server that supports none of the application protocols of the client,
+// the client receives it from the server: errors.Is matches both.
+var ErrNoApplicationProtocol error = handshake.ErrNoApplicationProtocol
+
+// ErrGoAway is returned by OpenStream after a GOAWAY frame sent or received: the streams already open keep working.
+var ErrGoAway = errors.New("Session.OpenStream : the session is going away")
+
+// ErrCloseTimeout is returned by CloseGracefully when streams are still open at the timeout.
+var ErrCloseTimeout = errors.New("Session.CloseGracefully : streams still open at the timeout")
+
+// Error is the error of a closed session, with the error code and the reason phrase of its CONNECTION_CLOSE frame:
+// received from the peer if Remote is true, sent otherwise. The Session and Stream methods return it once the session is closed.
+//
+// The local error that closed the session is returned by Unwrap, errors.Is matches ErrSessionClosed, ErrIdleTimeout,
+// ErrHandshakeTimeout and the handshake errors sent by the peer.
+type Error struct {
+	ErrorCode    protocol.QuicErrorCode
+	ReasonPhrase string
+	Remote       bool
+	err          error
+}
+
+func (this Error) Error() string {
+	reason := ""
+	if this.ReasonPhrase != "" {
+		reason = " (" + this.ReasonPhrase + ")"
+	}
+	if this.Remote {
+		return fmt.Sprintf("Session : closed by the peer with %v%s", this.ErrorCode, reason)
+	}
+	return fmt.Sprintf("Session : closed with %v%s", this.ErrorCode, reason)
+}
+
+// Unwrap returns the local error that closed the session, nil for a CONNECTION_CLOSE frame or a public reset received.
+func (this Error) Unwrap() error {
+	return this.err
+}
+
+// Is matches the sentinel errors of the error code, and the handshake error that the peer sent in the CONNECTION_CLOSE frame,
+// like ErrNoApplicationProtocol.
+func (this Error) Is(target error) bool {
+	switch target {
+	case ErrSessionClosed:
+		return this.ErrorCode == protocol.QUIC_NO_ERROR && !this.Remote
+	case ErrIdleTimeout:
+		return this.ErrorCode == protocol.QUIC_NETWORK_IDLE_TIMEOUT
+	case ErrHandshakeTimeout:
+		return this.ErrorCode == protocol.QUIC_HANDSHAKE_TIMEOUT
+	case ErrPublicReset:
+		return this.ErrorCode == protocol.QUIC_PUBLIC_RESET && this.Remote
+	}
+	e, ok := target.(handshake.ErrHandshakeFailed)
+	return ok && this.Remote && e.Code == this.ErrorCode && e.Error() == this.ReasonPhrase
+}
+
+// closeError returns the Error of the session closed by the error, the reason phrase of a local error is its message.
+// The version negotiation errors are returned as is, they close the session without CONNECTION_CLOSE frame.
+func closeError(err error) error {
+	switch e := err.(type) {
+	case nil:
+		return Error{ErrorCode: protocol.QUIC_NO_ERROR}
+	case Error:
+		return e
+	case versionNegotiationError:
+		return e
+	}
+	return Error{ErrorCode: errorCode(err), ReasonPhrase: err.Error(), err: err}
+}
+
+// Stream is a bidirectional QUIC stream of a Session, with half-close, reset and deadlines like net.Conn.
+type Stream interface {
+	io.ReadWriteCloser
+	// ReadContext is Read interrupted by the end of the context, with a protocol.ContextError
+	ReadContext(ctx context.Context, p []byte) (int, error)
+	// WriteContext is Write interrupted by the end of the context, with the number of bytes taken and a protocol.ContextError
+	WriteContext(ctx context.Context, p []byte) (int, error)
+	// TryWrite writes the data that the send buffer of the stream can take without blocking, with stream.ErrWouldBlock
+	// if it can't take all the data
+	TryWrite(p []byte) (int, error)
+	// GetStreamID returns the Stream ID
+	GetStreamID() protocol.QuicStreamID
+	// CloseRead discards the data received, the peer can still send until its FIN
+	CloseRead() error
+	// CloseWrite sends the FIN after the data written, Close is the same
+	CloseWrite() error
+	// Reset aborts both sides of the stream with a RST_STREAM frame
+	Reset(errorCode protocol.QuicErrorCode)
+	// CancelWrite aborts the write side with a RST_STREAM frame, the data not sent or not acknowledged is discarded:
+	// the data received until the RST_STREAM frame of the peer can still be read
+	CancelWrite(errorCode protocol.QuicErrorCode)
+	// CancelRead discards the data received and in flight, with a RST_STREAM frame that also aborts the write side
+	CancelRead(errorCode protocol.QuicErrorCode)
+	// SetPriority sets the priority of the stream in the StreamScheduler of the session, between 1 and stream.MAX_STREAM_PRIORITY:
+	// stream.DEFAULT_STREAM_PRIORITY by default
+	SetPriority(priority int)
+	// GetPriority returns the priority of the stream
+	GetPriority() int
+	SetDeadline(t time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// Session is a QUIC connection multiplexing streams, in the client or server perspective.
+//
+// The methods block until they complete, like net.Conn: there are no callbacks.
+// The blocking calls with a context return a protocol.ContextError when the context is done.
+type Session interface {
+	// OpenStream opens a new stream, it blocks while the streams opened reach the maximum number of streams of the peer
+	OpenStream() (Stream, error)
+	// OpenStreamSync is OpenStream interrupted by the end of the context
+	OpenStreamSync(ctx context.Context) (Stream, error)
+	// AcceptStream returns the next stream opened by the peer, it blocks until the peer opens one or the context is done
+	AcceptStream(ctx context.Context) (Stream, error)
+	// OpenConn opens a new stream as a net.Conn, its addresses are StreamAddrs
+	OpenConn() (net.Conn, error)
+	// AcceptConn returns the next stream opened by the peer as a net.Conn, its addresses are StreamAddrs
+	AcceptConn(ctx context.Context) (net.Conn, error)
+	// ConnectionID returns the Connection ID of the session
+	ConnectionID() protocol.QuicConnectionID
+	// LocalAddr returns the local network address
+	LocalAddr() net.Addr
+	// RemoteAddr returns the network address of the peer
+	RemoteAddr() net.Addr
+	// Close sends a CONNECTION_CLOSE frame with the error code of err (QUIC_NO_ERROR if nil), and aborts the streams
+	Close(err error) error
+	// CloseGracefully sends a GOAWAY frame, refuses the new streams of the peer and waits for the open streams to finish
+	// before the CONNECTION_CLOSE frame: the streams still open at the timeout are aborted
+	CloseGracefully(timeout time.Duration) error
+	// HandshakeState returns the progress of the crypto handshake, the sensitive data can wait for HANDSHAKE_FORWARD_SECURE
+	HandshakeState() HandshakeState
+	// Stats returns the statistics of the session, it can be called from any goroutine and after Close
+	Stats() Stats
+	// NegotiatedProtocol returns the application protocol selected by the server among the Config.NextProtos of the client,
+	// empty before the forward-secure keys or if the client or the server has no application protocol
+	NegotiatedProtocol() string
+	// NumActiveStreams returns the number of data streams opened by both endpoints and not finished yet: the streams of the peer
+	// waiting for AcceptStream are counted until they finish, those reset by the peer aren't, even while they keep their slot
+	// of MaxIncomingStreams
+	NumActiveStreams() int
+	// HeadersStream returns the stream reserved for the headers of the HTTP mapping (Stream ID 3), on both sides:
+	// it is opened by the first call or the first frame of the peer, and is not counted in the streams of the peer
+	HeadersStream() Stream
+}
+
+// connection is the path of the datagrams of a session.
+type connection interface {
+	Write(b []byte) error
+	// WriteBatch writes the datagrams to the peer in order, with as few system calls as possible
+	WriteBatch(bs [][]byte) error
+	// WriteTo writes a datagram to another address of the peer, to validate it
+	WriteTo(b []byte, addr net.Addr) error
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+	// SetRemoteAddr changes the address of the peer once the new path is validated
+	SetRemoteAddr(addr net.Addr)
+	Close() error
+}
+
+// cryptoSetup runs the crypto handshake on the crypto stream, and installs the keys of the session with OnKeys.
+type cryptoSetup interface {
+	Run() error
+}
+
+// versionNegotiationError closes a client session after a version negotiation packet, without CONNECTION_CLOSE frame:
+// the server has no state for the connection. Dial retries with the version chosen, err is set if there is none.
+type versionNegotiationError struct {
+	version protocol.QuicVersion
+	err     error
+}
+
+func (this versionNegotiationError) Error() string {
+	if this.err != nil {
+		return this.err.Error()
+	}
+	return fmt.Sprintf("Session : version %v negotiated with the server", this.version)
+}
+
+// receivedPacket is a datagram received for a session, with the ECN codepoint of its IP header.
+type receivedPacket struct {
+	data    []byte
+	remote  net.Addr
+	ecn     packetconn.ECN
+	rcvTime time.Time
+}
+
+// session implements Session.
+//
+// The run goroutine owns the packet packer and unpacker, the ack handlers and the congestion control: it handles the received packets,
+// demultiplexes the frames to the streams and sends the packets. The streams and the user calls reach it through the mutex protected state.
+//
+// Locking model:
+//   - The state owned by the run goroutine has no lock, no other goroutine touches it. The other goroutines hand their work over
+//     with the channels: receivedPackets from the read goroutine, keysChan from the crypto handshake, closeChan, and sendSignal
+//     once a frame or a stream to send is queued in the mutex protected state.
+//   - The mutex guards the streams, the queues of frames and streams to send, the encryption level and the close error.
+//     The user calls wait on the condition, broadcast when this state changes. The mutex is never held during an I/O.
+//   - Each stream and each flow controller has its own mutex. The lock order is session, stream, flow controller:
+//     a stream calls the session without its mutex held.
+//
+// The crypto handshake runs in its own goroutine on the crypto stream, and hands the keys over to the run goroutine.
+// The handshake messages are sealed with the keys of their encryption level (cryptoSealer), the other packets with the newest keys.
+// The packets that can't be opened yet during the handshake are kept until the next keys, like the 0-RTT packets received before the full CHLO.
+type session struct {
+	connID      protocol.QuicConnectionID
+	perspective protocol.Perspective
+	version     protocol.QuicVersion
+	config      *Config
+	conn        connection
+	cryptoSetup cryptoSetup
+	// dataLevel is the encryption level of the stream data: forward-secure for a client without AllowZeroRTT
+	dataLevel protocol.EncryptionLevel
+
+	// Owned by the run goroutine
+	packer                *protocol.PacketPacker
+	unpacker              *protocol.PacketUnpacker
+	sealer                protocol.PacketSealer
+	cryptoSealer          protocol.PacketSealer
+	cryptoLevel           protocol.EncryptionLevel
+	undecryptablePackets  []receivedPacket
+	handshakeComplete     bool
+	receivedFirstPacket   bool
+	receivedPacketTracker *ackhandler.ReceivedPacketTracker
+	sentPacketHandler     *ackhandler.SentPacketHandler
+	rttStats              *congestion.RTTStats
+	idleTimer             *idleTimer
+	// handshakeDeadline is the end of the handshake timeout, zero once the forward-secure keys are installed
+	handshakeDeadline  time.Time
+	mtuDiscoverer      *mtuDiscoverer
+	amplification      *amplificationLimit
+	connFlowController *flowcontrol.FlowController
+	cryptoStream       *stream.Stream
+
+	// publicResetNonceProof is the nonce proof of the public resets of the server, received in the SHLO and owned by the run goroutine
+	publicResetNonceProof uint64
+
+	// probeAddr is the new address of the peer being validated by the PING of probeSeqnum, owned by the run goroutine
+	probeAddr   net.Addr
+	probeSeqnum protocol.QuicPacketSequenceNumber
+	probeTime   time.Time
+	probeCount  int
+
+	// stats are the counters of Stats, startTime the creation of the session. zeroRTTSent is true once the client
+	// has sent stream data with initial keys not rejected yet, owned by the run goroutine
+	stats       sessionStats
+	startTime   time.Time
+	zeroRTTSent bool
+	// metrics are the counters of the Listener of a server session, nil for a client session
+	metrics *listenerMetrics
+
+	// tracer receives the events of the session if it is not nil, tracedWindow is the last congestion window traced
+	tracer       Tracer
+	tracedWindow int
+
+	// sendBatch are the packets recorded as sent but not written yet, sendData their datagrams, owned by the run goroutine
+	sendBatch []*protocol.PackedPacket
+	sendData  [][]byte
+
+	// Streams state, guarded by the mutex, the condition is broadcast when it changes
+	mutex           sync.Mutex
+	cond            *sync.Cond
+	encryptionLevel protocol.EncryptionLevel
+	streams         map[protocol.QuicStreamID]*stream.Stream
+	peerStreams     *protocol.PeerStreamIDs
+	lastStreamID    protocol.QuicStreamID
+	openStreams     int
+	maxOpenStreams  int
+	// streamSendWindow is the initial send window of the new streams, negotiated in the handshake
+	streamSendWindow protocol.QuicByteOffset
+	// negotiatedProtocol is the application protocol selected by the server
+	negotiatedProtocol string
+	acceptQueue        []*stream.Stream
+	// maxIncomingStreams is the negotiated limit of the streams of the peer, deferredResets are the RST_STREAM frames that
+	// answer the resets of the streams waiting in the accept queue while the queue is above half of the limit
+	maxIncomingStreams int
+	deferredResets     []protocol.Frame
+	goawayReceived     bool
+	goawaySent         bool
+	closeErr           error
+	controlFrames      []protocol.Frame
+	// scheduler orders the data streams with data to send, sendPending are the streams with data to send that queueFrames
+	// hasn't dropped yet: those of the scheduler, the one being sent, the crypto stream and the headers stream
+	scheduler   StreamScheduler
+	sendPending map[protocol.QuicStreamID]bool
+
+	receivedPackets chan receivedPacket
+	keysChan        chan handshake.Keys
+	sendSignal      chan struct{}
+	closeOnce       sync.Once
+	closeChan       chan error
+	runDone         chan struct{}
+}
+
+var _ Session = (*session)(nil)
+var _ stream.StreamSender = (*session)(nil)
+var _ handshake.KeyHandler = (*session)(nil)
+
+// newClientSession returns a client session running the crypto handshake with the server hostname, whose certificate is verified
+// with the RootCAs of the config unless InsecureSkipVerify, and resumed from the SessionCache. initialVersion is the version proposed before the version negotiation.
+func newClientSession(conn connection, connID protocol.QuicConnectionID, version, initialVersion protocol.QuicVersion, hostname string,
+	config *Config) (*session, error) {
+	this, err := newSession(conn, protocol.PERSPECTIVE_CLIENT, connID, version, config)
+	if err != nil {
+		return nil, err
+	}
+	verifier := handshake.NewProofVerifier(config.RootCAs)
+	if config.InsecureSkipVerify {
+		verifier = nil
+	}
+	cryptoClient := handshake.NewCryptoClient(this.cryptoStream, connID, hostname, version, initialVersion,
+		proposedParams(config), verifier, this)
+	cryptoClient.SetSessionCache(config.SessionCache)
+	cryptoClient.SetKeyLogWriter(config.KeyLogWriter)
+	cryptoClient.SetAEADs(config.AEADs)
+	this.cryptoSetup = cryptoClient
+	if !config.AllowZeroRTT {
+		this.dataLevel = protocol.ENCRYPTION_FORWARD_SECURE
+	}
+	return this, nil
+}
+
+// newServerSession returns a server session running the crypto handshake with the server config of the config.
+func newServerSession(conn connection, connID protocol.QuicConnectionID, version protocol.QuicVersion, config *Config) (*session, error) {
+	this, err := newSession(conn, protocol.PERSPECTIVE_SERVER, connID, version, config)
+	if err != nil {
+		return nil, err
+	}
+	// The client can verify the public resets of the Listener once the session is gone
+	params := proposedParams(config)
+	params.PublicResetNonceProof = publicResetNonceProof(config.PublicResetSecret, connID)
+	cryptoServer := handshake.NewCryptoServer(this.cryptoStream, connID, conn.RemoteAddr(), version, config.Versions, config.ServerConfig,
+		params, this)
+	cryptoServer.SetKeyLogWriter(config.KeyLogWriter)
+	this.cryptoSetup = cryptoServer
+	return this, nil
+}
+
+// proposedParams returns the transport parameters of the config proposed to the peer in the handshake.
+func proposedParams(config *Config) handshake.NegotiatedParams {
+	return handshake.NegotiatedParams{
+		IdleTimeout:                 config.IdleTimeout,
+		MaxStreams:                  uint32(config.maxIncomingStreams()),
+		StreamFlowControlWindow:     config.StreamFlowControlWindow,
+		ConnectionFlowControlWindow: config.ConnectionFlowControlWindow,
+		TruncateConnectionID:        config.TruncateConnectionID,
+		NextProtos:                  config.NextProtos}
+}
+
+// newSession returns the session of the perspective on the connection, the crypto setup and the goroutines are started by the caller.
+func newSession(conn connection, perspective protocol.Perspective, connID protocol.QuicConnectionID, version protocol.QuicVersion,
+	config *Config) (*session, error) {
+	null := crypto.NewAEAD_NullFNV1A128()
+	rttStats := congestion.NewRTTStats()
+	sendAlgorithm, err := congestion.NewSendAlgorithm(config.CongestionControl, rttStats)
+	if err != nil {
+		return nil, err
+	}
+	// The peer accepts at least the default number of streams before the negotiation
+	maxOpenStreams := config.MaxStreams
+	if maxOpenStreams > DEFAULT_MAX_STREAMS {
+		maxOpenStreams = DEFAULT_MAX_STREAMS
+	}
+	this := &session{
+		connID:                connID,
+		perspective:           perspective,
+		version:               version,
+		config:                config,
+		conn:                  conn,
+		dataLevel:             protocol.ENCRYPTION_INITIAL,
+		packer:                protocol.NewPacketPacker(connID, CONNECTION_ID_SIZE, MAX_PACKET_SIZE),
+		unpacker:              protocol.NewPacketUnpacker(null),
+		sealer:                null,
+		cryptoSealer:          null,
+		receivedPacketTracker: ackhandler.NewReceivedPacketTracker(),
+		sentPacketHandler:     ackhandler.NewSentPacketHandler(rttStats),
+		rttStats:              rttStats,
+		idleTimer:             newIdleTimer(config.IdleTimeout, config.KeepAlive, config.Clock.Now()),
+		startTime:             config.Clock.Now(),
+		handshakeDeadline:     config.Clock.Now().Add(config.HandshakeTimeout),
+		mtuDiscoverer:         newMTUDiscoverer(MAX_PACKET_SIZE, !config.DisableMTUDiscovery),
+		amplification:         newAmplificationLimit(perspective == protocol.PERSPECTIVE_CLIENT),
+		connFlowController: flowcontrol.NewConnectionFlowController(
+			config.ConnectionFlowControlWindow, flowcontrol.MAX_CONNECTION_RECEIVE_WINDOW, flowcontrol.INITIAL_CONNECTION_WINDOW, rttStats),
+		streams:            make(map[protocol.QuicStreamID]*stream.Stream),
+		peerStreams:        protocol.NewPeerStreamIDs(perspective.Opposite(), config.maxIncomingStreams()),
+		maxOpenStreams:     maxOpenStreams,
+		maxIncomingStreams: config.maxIncomingStreams(),
+		streamSendWindow:   flowcontrol.INITIAL_STREAM_WINDOW,
+		scheduler:          config.StreamScheduler(),
+		sendPending:        make(map[protocol.QuicStreamID]bool),
+		receivedPackets:    make(chan receivedPacket, MAX_RECEIVED_PACKETS),
+		keysChan:           make(chan handshake.Keys),
+		sendSignal:         make(chan struct{}, 1),
+		closeChan:          make(chan error, 1),
+		runDone:            make(chan struct{})}
+	this.cond = sync.NewCond(&this.mutex)
+	this.sentPacketHandler.SetSendAlgorithm(sendAlgorithm)
+	this.unpacker.SetReceivedPackets(this.receivedPacketTracker)
+	if config.Tracer != nil {
+		this.tracer = config.Tracer(connID, perspective)
+	}
+	this.sentPacketHandler.SetLossCallback(func(p *ackhandler.SentPacket) {
+		this.stats.packetsLost.Add(1)
+		if this.tracer != nil {
+			this.tracer.LostPacket(p.SequenceNumber, p.EncryptionLevel, p.Length)
+		}
+	})
+	if perspective == protocol.PERSPECTIVE_CLIENT {
+		// The client sends the version until the server answers, and the headers stream is reserved
+		this.packer.SetVersion(version)
+		this.lastStreamID = protocol.QUIC_HEADERS_STREAM_ID
+	}
+	// The crypto stream is not limited by the connection flow control, its window bounds the handshake data buffered to
+	// the size of the largest handshake message
+	this.cryptoStream = stream.NewStream(protocol.QUIC_CRYPTO_STREAM_ID, this, flowcontrol.NewStreamFlowController(protocol.QUIC_CRYPTO_STREAM_ID, nil,
+		flowcontrol.INITIAL_STREAM_WINDOW, protocol.MAX_HANDSHAKE_MESSAGE_SIZE, flowcontrol.INITIAL_STREAM_WINDOW, rttStats), config.Clock,
+		stream.DEFAULT_SEND_BUFFER_SIZE)
+	this.streams[protocol.QUIC_CRYPTO_STREAM_ID] = this.cryptoStream
+	return this, nil
+}
+
+// start starts the run goroutine and the crypto handshake.
+func (this *session) start() {
+	go this.run()
+	go this.runCryptoSetup()
+}
+
+// runCryptoSetup runs the crypto handshake, the session is closed if it fails.
+func (this *session) runCryptoSetup() {
+	if err := this.cryptoSetup.Run(); err != nil {
+		this.close(err)
+	}
+}
+
+// OnKeys hands the keys of the crypto handshake over to the run goroutine, and returns once they are installed.
+func (this *session) OnKeys(keys handshake.Keys) {
+	select {
+	case this.keysChan <- keys:
+	case <-this.runDone:
+	}
+}
+
+// waitForEncryptionLevel blocks until the keys of the encryption level are installed,
+// or returns the error that closed the session or the error of the context.
+func (this *session) waitForEncryptionLevel(ctx context.Context, level protocol.EncryptionLevel) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	defer this.broadcastOnDone(ctx)()
+	for this.encryptionLevel < level {
+		if this.closeErr != nil {
+			return this.closeErr
+		}
+		if err := ctx.Err(); err != nil {
+			return protocol.ContextError{Op: "DialContext", Err: err}
+		}
+		this.cond.Wait()
+	}
+	return nil
+}
+
+// broadcastOnDone wakes the goroutines waiting on the condition when the context is done, until the returned stop function is called.
+func (this *session) broadcastOnDone(ctx context.Context) (stop func() bool) {
+	return context.AfterFunc(ctx, func() {
+		this.mutex.Lock()
+		this.cond.Broadcast()
+		this.mutex.Unlock()
+	})
+}
+
+// HandshakeState returns the progress of the crypto handshake.
+func (this *session) HandshakeState() HandshakeState {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return HandshakeState(this.encryptionLevel)
+}
+
+// Stats returns the statistics of the session.
+func (this *session) Stats() Stats {
+	return this.stats.load()
+}
+
+// NegotiatedProtocol returns the application protocol of the session.
+func (this *session) NegotiatedProtocol() string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.negotiatedProtocol
+}
+
+// NumActiveStreams returns the number of data streams not finished, the streams finished in the accept queue are not counted.
+func (this *session) NumActiveStreams() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	n := 0
+	for id := range this.streams {
+		if !id.IsCryptoStream() && !id.IsHeadersStream() {
+			n++
+		}
+	}
+	return n
+}
+
+// ConnectionID returns the Connection ID of the session.
+func (this *session) ConnectionID() protocol.QuicConnectionID {
+	return this.connID
+}
+
+// LocalAddr returns the local network address.
+func (this *session) LocalAddr() net.Addr {
+	return this.conn.LocalAddr()
+}
+
+// RemoteAddr returns the network address of the peer.
+func (this *session) RemoteAddr() net.Addr {
+	return this.conn.RemoteAddr()
+}
+
+// OpenStream opens a new stream, it blocks while the streams opened reach the maximum number of streams of the peer.
+func (this *session) OpenStream() (Stream, error) {
+	return this.OpenStreamSync(context.Background())
+}
+
+// OpenStreamSync is OpenStream interrupted by the end of the context.
+func (this *session) OpenStreamSync(ctx context.Context) (Stream, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	defer this.broadcastOnDone(ctx)()
+	for {
+		if this.closeErr != nil {
+			return nil, this.closeErr
+		}
+		if this.goawayReceived || this.goawaySent {
+			return nil, ErrGoAway
+		}
+		if this.openStreams < this.maxOpenStreams {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, protocol.ContextError{Op: "Session.OpenStreamSync", Err: err}
+		}
+		this.cond.Wait()
+	}
+	id, err := protocol.NextStreamID(this.lastStreamID, this.perspective)
+	if err != nil {
+		return nil, err
+	}
+	this.lastStreamID = id
+	this.openStreams++
+	this.stats.streamsOpened.Add(1)
+	s := this.newStream(id)
+	this.streams[id] = s
+	return s, nil
+}
+
+// AcceptStream returns the next stream opened by the peer, it blocks until the peer opens one or the context is done.
+func (this *session) AcceptStream(ctx context.Context) (Stream, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	defer this.broadcastOnDone(ctx)()
+	for {
+		if this.closeErr != nil {
+			return nil, this.closeErr
+		}
+		if len(this.acceptQueue) > 0 {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, protocol.ContextError{Op: "Session.AcceptStream", Err: err}
+		}
+		this.cond.Wait()
+	}
+	s := this.acceptQueue[0]
+	this.acceptQueue = this.acceptQueue[1:]
+	this.stats.streamsAccepted.Add(1)
+	if len(this.deferredResets) > 0 && !this.isAcceptQueueFull() {
+		this.controlFrames = append(this.controlFrames, this.deferredResets...)
+		this.deferredResets = nil
+		signal(this.sendSignal)
+	}
+	return s, nil
+}
+
+// isAcceptQueueFull returns true while the accept queue holds half of the streams the peer can open, the mutex must be locked.
+func (this *session) isAcceptQueueFull() bool {
+	return len(this.acceptQueue) >= (this.maxIncomingStreams+1)/2
+}
+
+// isWaitingForAccept returns true if the stream is in the accept queue, the mutex must be locked.
+func (this *session) isWaitingForAccept(id protocol.QuicStreamID) bool {
+	for _, s := range this.acceptQueue {
+		if s.GetStreamID() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Close sends a CONNECTION_CLOSE frame with the error code of err (QUIC_NO_ERROR if nil), and aborts the streams.
+func (this *session) Close(err error) error {
+	this.close(err)
+	<-this.runDone
+	return nil
+}
+
+// close asks the run goroutine to close the session, a remote Error closes it without sending a CONNECTION_CLOSE frame.
+func (this *session) close(err error) {
+	this.closeOnce.Do(func() {
+		this.closeChan <- err
+	})
+}
+
+// CloseGracefully sends a GOAWAY frame, refuses the new streams of the peer and waits for the open streams to finish
+// before the CONNECTION_CLOSE frame. The streams still open at the timeout are aborted with QUIC_PEER_GOING_AWAY and ErrCloseTimeout is returned.
+func (this *session) CloseGracefully(timeout time.Duration) error {
+	expired := false
+	this.mutex.Lock()
+	if this.closeErr != nil {
+		err := this.closeErr
+		this.mutex.Unlock()
+		return err
+	}
+	if !this.goawaySent {
+		this.goawaySent = true
+		this.controlFrames = append(this.controlFrames, &protocol.GoawayFrame{
+			ErrorCode:        protocol.QUIC_PEER_GOING_AWAY,
+			LastGoodStreamID: this.peerStreams.LargestStreamID(),
+			ReasonPhrase:     "closing"})
+		signal(this.sendSignal)
+	}
+	timer := this.config.Clock.AfterFunc(timeout, func() {
+		this.mutex.Lock()
+		expired = true
+		this.cond.Broadcast()
+		this.mutex.Unlock()
+	})
+	defer timer.Stop()
+
+	// The crypto stream and the headers stream stay open
+	for len(this.streams) > this.reservedStreams() && !expired && this.closeErr == nil {
+		this.cond.Wait()
+	}
+	closeErr := this.closeErr
+	open := len(this.streams) > this.reservedStreams()
+	this.mutex.Unlock()
+	switch {
+	case closeErr != nil:
+		return closeErr
+	case open:
+		this.close(Error{ErrorCode: protocol.QUIC_PEER_GOING_AWAY, ReasonPhrase: "streams still open at the timeout"})
+		return ErrCloseTimeout
+	}
+	this.close(nil)
+	return nil
+}
+
+// HeadersStream returns the headers stream of the HTTP mapping.
+func (this *session) HeadersStream() Stream {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.headersStream()
+}
+
+// headersStream returns the headers stream, created on the first use, the mutex must be locked.
+func (this *session) headersStream() *stream.Stream {
+	s, ok := this.streams[protocol.QUIC_HEADERS_STREAM_ID]
+	if !ok {
+		s = this.newStream(protocol.QUIC_HEADERS_STREAM_ID)
+		this.streams[protocol.QUIC_HEADERS_STREAM_ID] = s
+		if this.closeErr != nil {
+			s.CloseWithError(this.closeErr)
+		}
+	}
+	return s
+}
+
+// reservedStreams returns the number of reserved streams in the streams: the crypto stream, and the headers stream once used.
+// The mutex must be locked.
+func (this *session) reservedStreams() int {
+	if _, ok := this.streams[protocol.QUIC_HEADERS_STREAM_ID]; ok {
+		return 2
+	}
+	return 1
+}
+
+// newStream returns a stream with a flow controller attached to the connection, the mutex must be locked.
+func (this *session) newStream(id protocol.QuicStreamID) *stream.Stream {
+	fc := flowcontrol.NewStreamFlowController(id, this.connFlowController,
+		this.config.StreamFlowControlWindow, flowcontrol.MAX_STREAM_RECEIVE_WINDOW, this.streamSendWindow, this.rttStats)
+	return stream.NewStream(id, this, fc, this.config.Clock, this.config.StreamSendBufferSize)
+}
+
+// QueueControlFrame queues a frame of a stream, sent by the run goroutine.
+//
+// The RST_STREAM frame that answers the reset of a stream waiting in a full accept queue is deferred: the peer doesn't
+// reuse the slot of the stream until AcceptStream drains the queue.
+func (this *session) QueueControlFrame(f protocol.Frame) {
+	this.mutex.Lock()
+	if rst, ok := f.(*protocol.RstStreamFrame); ok && this.isAcceptQueueFull() && this.isWaitingForAccept(rst.StreamID) {
+		this.deferredResets = append(this.deferredResets, f)
+		this.mutex.Unlock()
+		return
+	}
+	this.controlFrames = append(this.controlFrames, f)
+	this.mutex.Unlock()
+	signal(this.sendSignal)
+}
+
+// OnHasStreamData schedules the stream for sending, the run goroutine pops its frames in the order of the scheduler.
+func (this *session) OnHasStreamData(streamID protocol.QuicStreamID) {
+	this.mutex.Lock()
+	this.scheduleStream(streamID)
+	this.mutex.Unlock()
+	signal(this.sendSignal)
+}
+
+// OnStreamFinished wakes the run goroutine up, it forgets the stream.
+func (this *session) OnStreamFinished(streamID protocol.QuicStreamID) {
+	signal(this.sendSignal)
+}
+
+// scheduleStream adds the stream to the scheduler, the mutex must be locked.
+// The crypto stream and the headers stream are only marked pending, queueFrames sends them before the scheduler.
+func (this *session) scheduleStream(streamID protocol.QuicStreamID) {
+	s := this.streams[streamID]
+	if s == nil || this.sendPending[streamID] {
+		return
+	}
+	this.sendPending[streamID] = true
+	if !streamID.IsCryptoStream() && !streamID.IsHeadersStream() {
+		this.scheduler.Schedule(streamID, s.GetPriority(), 0)
+	}
+}
+
+// signal wakes the goroutine waiting on the channel, if any.
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// handleDatagram queues a datagram received for the session from the remote address, it is dropped if the queue is full.
+// The session owns the buffer of the datagram, it returns to the pool once the packet is processed.
+func (this *session) handleDatagram(data []byte, remote net.Addr, ecn packetconn.ECN, rcvTime time.Time) {
+	select {
+	case this.receivedPackets <- receivedPacket{data: data, remote: remote, ecn: ecn, rcvTime: rcvTime}:
+	default:
+		bufferpool.Put(data)
+	}
+}
+
+// run is the event loop of the session: received packets, sends and alarms, until the session is closed.
+func (this *session) run() {
+	defer close(this.runDone)
+	timer := this.config.Clock.NewTimer(time.Duration(congestion.INFINITE_DURATION))
+	defer timer.Stop()
+
+	for {
+		// The close request goes first
+		select {
+		case err := <-this.closeChan:
+			this.shutdown(err)
+			return
+		default:
+		}
+		select {
+		case err := <-this.closeChan:
+			this.shutdown(err)
+			return
+		case p := <-this.receivedPackets:
+			this.amplification.OnReceived(len(p.data))
+			if err := this.handlePacket(p); err != nil {
+				this.close(err)
+				continue
+			}
+		case keys := <-this.keysChan:
+			if err := this.installKeys(keys); err != nil {
+				this.close(err)
+				continue
+			}
+		case <-this.sendSignal:
+		case <-timer.Chan():
+			now := this.config.Clock.Now()
+			if !this.handshakeDeadline.IsZero() && !now.Before(this.handshakeDeadline) {
+				this.close(Error{ErrorCode: protocol.QUIC_HANDSHAKE_TIMEOUT,
+					ReasonPhrase: fmt.Sprintf("no forward-secure keys after %v", this.config.HandshakeTimeout)})
+				continue
+			}
+			if this.idleTimer.IsExpired(now) {
+				this.close(Error{ErrorCode: protocol.QUIC_NETWORK_IDLE_TIMEOUT,
+					ReasonPhrase: fmt.Sprintf("no activity for %v", this.idleTimer.GetTimeout())})
+				continue
+			}
+			if t := this.sentPacketHandler.GetAlarmTimeout(); !t.IsZero() && !now.Before(t) {
+				this.sentPacketHandler.OnAlarm(now)
+				this.updateMTUProbe(nil, now)
+			}
+			if t := this.getProbeAlarm(); !t.IsZero() && !now.Before(t) {
+				if err := this.sendProbe(now); err != nil {
+					this.close(err)
+					continue
+				}
+			}
+		}
+		now := this.config.Clock.Now()
+		if this.idleTimer.ShouldSendPing(now) {
+			this.packer.QueueControlFrame(&protocol.PingFrame{})
+		}
+		if err := this.sendPackets(now); err != nil {
+			this.close(err)
+			continue
+		}
+		this.removeFinishedStreams()
+		this.updateStats()
+		this.traceCongestionWindow()
+		this.resetTimer(timer, now)
+	}
+}
+
+// updateStats updates the RTT and the congestion window of the Stats.
+func (this *session) updateStats() {
+	this.stats.smoothedRTT.Store(int64(this.rttStats.SmoothedRTT()))
+	this.stats.minRTT.Store(int64(this.rttStats.MinRTT()))
+	this.stats.congestionWindow.Store(int64(this.sentPacketHandler.GetCongestionWindow()))
+}
+
+// traceCongestionWindow traces the congestion window when it changes.
+func (this *session) traceCongestionWindow() {
+	if this.tracer == nil {
+		return
+	}
+	if cwnd := this.sentPacketHandler.GetCongestionWindow(); cwnd != this.tracedWindow {
+		this.tracedWindow = cwnd
+		this.tracer.UpdatedCongestionWindow(cwnd, this.sentPacketHandler.BytesInFlight())
+	}
+}
+
+// resetTimer sets the timer to the next alarm: delayed ACK, loss recovery, keep-alive, idle timeout, handshake timeout,
+// path probe or end of the pacing delay.
+func (this *session) resetTimer(timer protocol.Timer, now time.Time) {
+	next := now.Add(time.Duration(congestion.INFINITE_DURATION) / 2)
+	for _, t := range []time.Time{this.receivedPacketTracker.GetAlarmTimeout(), this.sentPacketHandler.GetAlarmTimeout(),
+		this.idleTimer.GetAlarmTimeout(), this.handshakeDeadline, this.getProbeAlarm()} {
+		if !t.IsZero() && t.Before(next) {
+			next = t
+		}
+	}
+	if d := this.sentPacketHandler.TimeUntilSend(now); d > 0 && d < time.Duration(congestion.INFINITE_DURATION) && now.Add(d).Before(next) {
+		next = now.Add(d)
+	}
+	if !timer.Stop() {
+		select {
+		case <-timer.Chan():
+		default:
+		}
+	}
+	timer.Reset(next.Sub(now))
+}
+
+// installKeys protects the next packets with the keys, and opens the received packets with them and the packets kept until then.
+//
+// New initial keys replace those of a rejected full CHLO: the server can't open the 0-RTT packets, their frames are sent again.
+// With ForceNullEncryption the encryption levels change as usual, but the packets stay protected by the NullAEAD.
+func (this *session) installKeys(keys handshake.Keys) error {
+	if this.config.ForceNullEncryption {
+		keys.Sealer, keys.Opener = crypto.NewAEAD_NullFNV1A128(), crypto.NewAEAD_NullFNV1A128()
+	}
+	if keys.Level == protocol.ENCRYPTION_INITIAL && this.encryptionLevel == protocol.ENCRYPTION_INITIAL {
+		this.sentPacketHandler.RetransmitPackets(protocol.ENCRYPTION_INITIAL)
+		this.zeroRTTSent = false
+	}
+	this.unpacker.SetOpener(keys.Level, keys.Opener)
+	replaced := this.sealer
+	this.sealer = keys.Sealer
+	if this.tracer != nil {
+		this.tracer.UpdatedKeys(keys.Level)
+	}
+	switch {
+	case this.perspective == protocol.PERSPECTIVE_SERVER && keys.Level == protocol.ENCRYPTION_INITIAL:
+		// The SHLO is sealed with the initial keys, the client needs the diversification nonce to open it.
+		// The full CHLO has a valid source-address token: the client has received the REJ at its address
+		this.cryptoSealer = keys.Sealer
+		this.amplification.Validate()
+		this.cryptoLevel = keys.Level
+		this.packer.SetDiversificationNonce(keys.DiversificationNonce)
+	case this.perspective == protocol.PERSPECTIVE_CLIENT && keys.Level == protocol.ENCRYPTION_FORWARD_SECURE:
+		// The server has received the full CHLO
+		this.handshakeComplete = true
+	}
+	// The replaced sealer is closed unless the handshake messages are still sealed with it
+	if replaced != this.sealer && replaced != this.cryptoSealer {
+		closeAEAD(replaced)
+	}
+	this.packer.SetEncryptionLevels(keys.Level, this.cryptoLevel)
+
+	// The stream data waits for the keys of its encryption level
+	var streams []*stream.Stream
+	this.mutex.Lock()
+	this.encryptionLevel = keys.Level
+	if keys.Level == protocol.ENCRYPTION_FORWARD_SECURE {
+		// The negotiated parameters replace those used before the negotiation
+		this.maxOpenStreams = int(keys.Params.MaxStreams)
+		this.maxIncomingStreams = int(keys.Params.MaxStreams)
+		this.peerStreams.SetMaxStreams(int(keys.Params.MaxStreams))
+		this.streamSendWindow = keys.Params.StreamFlowControlWindow
+		this.negotiatedProtocol = keys.Params.NegotiatedProtocol
+		for id, s := range this.streams {
+			if id != protocol.QUIC_CRYPTO_STREAM_ID {
+				streams = append(streams, s)
+			}
+		}
+	}
+	for id, s := range this.streams {
+		if s.HasDataToSend() {
+			this.scheduleStream(id)
+		}
+	}
+	this.cond.Broadcast()
+	this.mutex.Unlock()
+
+	if keys.Level == protocol.ENCRYPTION_FORWARD_SECURE {
+		this.stats.handshakeDuration.Store(int64(this.config.Clock.Now().Sub(this.startTime)))
+		this.handshakeDeadline = time.Time{}
+		if this.zeroRTTSent {
+			this.stats.zeroRTTAccepted.Store(true)
+		}
+		this.idleTimer.SetTimeout(keys.Params.IdleTimeout)
+		this.publicResetNonceProof = keys.Params.PublicResetNonceProof
+		if keys.Params.TruncateConnectionID {
+			this.packer.SetConnectionIDSize(0)
+		}
+		// The send windows of the peer are the initial windows of the streams opened before the negotiation
+		for _, s := range streams {
+			s.HandleWindowUpdateFrame(&protocol.WindowUpdateFrame{StreamID: s.GetStreamID(), ByteOffset: keys.Params.StreamFlowControlWindow})
+		}
+		if this.connFlowController.UpdateSendWindow(keys.Params.ConnectionFlowControlWindow) {
+			this.onConnectionWindowUpdate()
+		}
+	}
+
+	packets := this.undecryptablePackets
+	this.undecryptablePackets = nil
+	for _, p := range packets {
+		if err := this.handlePacket(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handlePacket opens a received packet and handles its frames, the packets that fail to parse or open are dropped and counted
+// in Stats.PacketsDropped: a datagram of garbage from the address of the peer doesn't close the connection. A malformed frame
+// of a packet opened closes the connection with the error code of its frame type.
+// The undecryptable packets are kept until the next keys during the handshake, and dropped after. The duplicates are dropped
+// before they are opened.
+//
+// The unencrypted packets can be forged by anybody on the path: those with a malformed frame or with stream data are dropped
+// and counted too, before and after the initial keys. The trailing bytes after a packet are ignored by the unpacker, up to
+// protocol.MAX_TRAILING_BYTES.
+func (this *session) handlePacket(p receivedPacket) error {
+	if this.perspective == protocol.PERSPECTIVE_CLIENT && len(p.data) > 0 {
+		switch p.data[0] & (protocol.QUICFLAG_VERSION | protocol.QUICFLAG_PUBLICRESET) {
+		case protocol.QUICFLAG_VERSION:
+			defer bufferpool.Put(p.data)
+			return this.handleVersionNegotiation(p.data)
+		case protocol.QUICFLAG_PUBLICRESET:
+			defer bufferpool.Put(p.data)
+			return this.handlePublicReset(p.data)
+		}
+	}
+	packet, err := this.unpacker.Unpack(p.data)
+	if err == protocol.ErrDecryptionFailed && !this.handshakeComplete && len(this.undecryptablePackets) < MAX_UNDECRYPTABLE_PACKETS {
+		this.undecryptablePackets = append(this.undecryptablePackets, p)
+		return nil
+	}
+	size := len(p.data)
+	bufferpool.Put(p.data)
+	if err != nil {
+		// The malformed frame of a packet opened is a connection error
+		if _, ok := err.(protocol.ErrInvalidFrame); ok {
+			return err
+		}
+		if err != protocol.ErrDuplicatePacket {
+			this.stats.packetsDropped.Add(1)
+		}
+		return nil
+	}
+	// The streams retain the buffer of their data
+	defer packet.Release()
+	if packet.EncryptionLevel == protocol.ENCRYPTION_UNENCRYPTED && hasStreamData(packet.Frames) {
+		this.stats.packetsDropped.Add(1)
+		return nil
+	}
+	this.receivedFirstPacket = true
+	if this.perspective == protocol.PERSPECTIVE_CLIENT {
+		// The server has received a packet with the version
+		this.packer.OmitVersion()
+	} else if packet.EncryptionLevel == protocol.ENCRYPTION_FORWARD_SECURE {
+		// The client has received the SHLO
+		this.handshakeComplete = true
+	}
+	retransmittable := protocol.IsRetransmittable(packet.Frames)
+	err = this.receivedPacketTracker.ReceivedPacket(packet.SequenceNumber, p.rcvTime, retransmittable)
+	if err == ackhandler.ErrDuplicatePacket {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if this.tracer != nil {
+		this.tracer.ReceivedPacket(packet.SequenceNumber, packet.EncryptionLevel, size, packet.Frames)
+	}
+	if retransmittable {
+		this.idleTimer.OnActivity(p.rcvTime)
+	}
+	// Google QUIC has no ECN feedback: the marks of the packets of the peer are a congestion signal for the session too
+	this.stats.packetsReceived.Add(1)
+	this.stats.bytesReceived.Add(uint64(size))
+	if this.metrics != nil {
+		this.metrics.bytesReceived.Add(uint64(size))
+	}
+	this.stats.ecnCounts[p.ecn].Add(1)
+	if this.perspective == protocol.PERSPECTIVE_SERVER && packet.EncryptionLevel == protocol.ENCRYPTION_INITIAL && hasStreamData(packet.Frames) {
+		this.stats.zeroRTTAccepted.Store(true)
+	}
+	if p.ecn == packetconn.ECN_CE {
+		this.sentPacketHandler.OnCongestionExperienced()
+	}
+	for _, f := range packet.Frames {
+		if err = this.handleFrame(f, packet, p.rcvTime); err != nil {
+			return err
+		}
+	}
+	return this.handlePeerAddress(p, packet)
+}
+
+// handlePeerAddress validates a new address of the peer with a PING packet, the session moves to the new path
+// once the PING is acknowledged from there. Meanwhile the packets of the old address are still accepted.
+//
+// Only a forward-secure packet starts the validation, with Config.AllowMigration.
+func (this *session) handlePeerAddress(p receivedPacket, packet *protocol.UnpackedPacket) error {
+	if !this.config.AllowMigration || p.remote == nil || packet.EncryptionLevel != protocol.ENCRYPTION_FORWARD_SECURE ||
+		p.remote.String() == this.conn.RemoteAddr().String() {
+		return nil
+	}
+	if this.probeAddr != nil && p.remote.String() == this.probeAddr.String() {
+		if acksPacket(packet.Frames, this.probeSeqnum) {
+			this.migrate()
+		}
+		return nil
+	}
+	this.probeAddr, this.probeCount = p.remote, 0
+	return this.sendProbe(p.rcvTime)
+}
+
+// sendProbe sends a PING packet to the address being validated, it is sent again every PATH_PROBE_TIMEOUT
+// as the PING can be lost or reordered. The address is forgotten after MAX_PATH_PROBES unacknowledged PINGs.
+func (this *session) sendProbe(now time.Time) error {
+	if this.probeCount >= MAX_PATH_PROBES {
+		this.probeAddr = nil
+		return nil
+	}
+	this.packer.QueueControlFrame(&protocol.PingFrame{})
+	probe, err := this.packer.PackPacket(this.sealer)
+	if probe == nil || err != nil {
+		return err
+	}
+	defer probe.Release()
+	// The new path may not work
+	this.conn.WriteTo(probe.Data, this.probeAddr)
+	this.probeSeqnum, this.probeTime = probe.SequenceNumber, now
+	this.probeCount++
+	return this.onPacketSent(probe, now)
+}
+
+// getProbeAlarm returns the time of the next PING to the address being validated, or zero if there is none.
+func (this *session) getProbeAlarm() time.Time {
+	if this.probeAddr == nil {
+		return time.Time{}
+	}
+	return this.probeTime.Add(PATH_PROBE_TIMEOUT)
+}
+
+// migrate moves the session to the validated address of the peer, the congestion control and the RTT estimation start again.
+func (this *session) migrate() {
+	this.conn.SetRemoteAddr(this.probeAddr)
+	this.probeAddr = nil
+	this.rttStats.Reset()
+	// The path MTU is searched again on the new path
+	this.mtuDiscoverer = newMTUDiscoverer(MAX_PACKET_SIZE, !this.config.DisableMTUDiscovery)
+	this.packer.SetMaxPacketSize(MAX_PACKET_SIZE)
+	if sendAlgorithm, err := congestion.NewSendAlgorithm(this.config.CongestionControl, this.rttStats); err == nil {
+		this.sentPacketHandler.SetSendAlgorithm(sendAlgorithm)
+	}
+}
+
+// acksPacket returns true if an ACK frame of the frames acknowledges the packet.
+func acksPacket(frames []protocol.Frame, seqnum protocol.QuicPacketSequenceNumber) bool {
+	for _, f := range frames {
+		if ack, ok := f.(*protocol.AckFrame); ok && ack.AcksPacket(seqnum) {
+			return true
+		}
+	}
+	return false
+}
+
+// handlePublicReset closes the client session with ErrPublicReset if the public reset has the nonce proof received in the SHLO,
+// the server has no state for the connection. The other public resets are dropped: anyone can send them.
+func (this *session) handlePublicReset(b []byte) error {
+	reset, err := protocol.ParsePublicReset(b)
+	if err != nil || this.publicResetNonceProof == 0 || reset.ConnectionID != this.connID || !reset.VerifyNonceProof(this.publicResetNonceProof) {
+		this.stats.packetsDropped.Add(1)
+		return nil
+	}
+	return Error{ErrorCode: protocol.QUIC_PUBLIC_RESET, ReasonPhrase: "public reset", Remote: true}
+}
+
+// handleVersionNegotiation closes the client session with a versionNegotiationError if the server doesn't support its version.
+// The packet is ignored after the first packet of the server, or if it lists the version of the session.
+func (this *session) handleVersionNegotiation(b []byte) error {
+	if this.receivedFirstPacket {
+		this.stats.packetsDropped.Add(1)
+		return nil
+	}
+	connID, versions, err := protocol.ParseVersionNegotiationPacket(b)
+	if err != nil || connID != this.connID || protocol.CheckVersionNegotiation(this.version, versions) != nil {
+		this.stats.packetsDropped.Add(1)
+		return nil
+	}
+	version, err := protocol.ChooseVersion(this.config.Versions, versions)
+	return versionNegotiationError{version: version, err: err}
+}
+
+// hasStreamData returns true if the frames carry data of a stream other than the crypto stream, forbidden in unencrypted packets.
+func hasStreamData(frames []protocol.Frame) bool {
+	for _, f := range frames {
+		switch frame := f.(type) {
+		case *protocol.StreamFrame:
+			if !frame.StreamID.IsCryptoStream() {
+				return true
+			}
+		case *protocol.RstStreamFrame:
+			if !frame.StreamID.IsCryptoStream() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleFrame delivers a frame of the packet to the stream, the ack handlers or the session.
+// The streams retain the buffer of the packet for the data of the STREAM frames.
+func (this *session) handleFrame(f protocol.Frame, packet *protocol.UnpackedPacket, rcvTime time.Time) error {
+	seqnum := packet.SequenceNumber
+	switch frame := f.(type) {
+	case *protocol.StreamFrame:
+		s, err := this.getOrOpenStream(frame.StreamID)
+		if s == nil || err != nil {
+			return err
+		}
+		return frameError(protocol.QUIC_INVALID_STREAM_DATA, s.HandleStreamFrameBuffer(frame, packet.GetBuffer()))
+	case *protocol.AckFrame:
+		largestAcked := this.sentPacketHandler.GetLargestAcked()
+		acked, err := this.sentPacketHandler.ReceivedAck(frame, rcvTime)
+		if err != nil {
+			return Error{ErrorCode: protocol.QUIC_INVALID_ACK_DATA, ReasonPhrase: err.Error()}
+		}
+		// The largest packet newly acknowledged is an RTT sample
+		if this.tracer != nil && frame.LargestAcked > largestAcked && len(acked) > 0 && acked[len(acked)-1].SequenceNumber == frame.LargestAcked {
+			this.tracer.UpdatedRTT(this.rttStats.LatestRTT(), this.rttStats.SmoothedRTT(), this.rttStats.MinRTT(), this.rttStats.MeanDeviation())
+		}
+		this.packer.SetLargestAcked(this.sentPacketHandler.GetLargestAcked())
+		this.updateMTUProbe(acked, rcvTime)
+	case *protocol.StopWaitingFrame:
+		// The least unacked packet is at most the packet of the frame
+		if frame.LeastUnackedDelta >= seqnum {
+			return Error{ErrorCode: protocol.QUIC_INVALID_STOP_WAITING_DATA,
+				ReasonPhrase: fmt.Sprintf("least unacked delta %d in packet %d", frame.LeastUnackedDelta, seqnum)}
+		}
+		this.receivedPacketTracker.IgnoreBelow(frame.GetLeastUnacked(seqnum))
+	case *protocol.WindowUpdateFrame:
+		if frame.StreamID == 0 {
+			if this.connFlowController.UpdateSendWindow(frame.ByteOffset) {
+				this.onConnectionWindowUpdate()
+			}
+			return nil
+		}
+		s, err := this.getOrOpenStream(frame.StreamID)
+		if s == nil || err != nil {
+			return err
+		}
+		s.HandleWindowUpdateFrame(frame)
+	case *protocol.RstStreamFrame:
+		if frame.StreamID.IsCryptoStream() {
+			return Error{ErrorCode: protocol.QUIC_INVALID_RST_STREAM_DATA, ReasonPhrase: "RST_STREAM frame of the crypto stream"}
+		}
+		s, err := this.getOrOpenStream(frame.StreamID)
+		if s == nil || err != nil {
+			return err
+		}
+		return frameError(protocol.QUIC_INVALID_RST_STREAM_DATA, s.HandleRstStreamFrame(frame))
+	case *protocol.ConnectionCloseFrame:
+		return Error{ErrorCode: frame.ErrorCode, ReasonPhrase: frame.ReasonPhrase, Remote: true}
+	case *protocol.GoawayFrame:
+		// The last stream accepted by the peer is one of ours
+		if frame.LastGoodStreamID != 0 && !frame.LastGoodStreamID.IsInitiatedBy(this.perspective) {
+			return Error{ErrorCode: protocol.QUIC_INVALID_GOAWAY_DATA,
+				ReasonPhrase: fmt.Sprintf("last good stream %d not initiated by the receiver", frame.LastGoodStreamID)}
+		}
+		this.mutex.Lock()
+		this.goawayReceived = true
+		this.cond.Broadcast()
+		this.mutex.Unlock()
+	}
+	return nil
+}
+
+// frameError returns the error of a stream frame with the error code of the CONNECTION_CLOSE frame, unless the error
+// has its own error code like a flow control violation.
+func frameError(code protocol.QuicErrorCode, err error) error {
+	if _, ok := err.(interface{ ErrorCode() protocol.QuicErrorCode }); err == nil || ok {
+		return err
+	}
+	return Error{ErrorCode: code, ReasonPhrase: err.Error(), err: err}
+}
+
+// getOrOpenStream returns the stream of a received frame, and opens the streams of the peer up to the Stream ID.
+// A nil stream is returned for the closed streams, their frames are ignored.
+// The streams opened after the GOAWAY frame are refused with a RST_STREAM frame.
+func (this *session) getOrOpenStream(id protocol.QuicStreamID) (*stream.Stream, error) {
+	var refused []*stream.Stream
+
+	// The RST_STREAM frames are queued after the mutex is unlocked
+	defer func() {
+		for _, s := range refused {
+			s.Reset(protocol.QUIC_PEER_GOING_AWAY)
+		}
+	}()
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if s, ok := this.streams[id]; ok || this.closeErr != nil {
+		return s, nil
+	}
+	if id.IsHeadersStream() {
+		return this.headersStream(), nil
+	}
+	if id.IsInitiatedBy(this.perspective) {
+		if id > this.lastStreamID {
+			return nil, Error{ErrorCode: protocol.QUIC_INVALID_STREAM_ID, ReasonPhrase: fmt.Sprintf("stream %d not opened", id)}
+		}
+		return nil, nil
+	}
+	opened, err := this.peerStreams.Open(id)
+	switch err {
+	case nil:
+	case protocol.ErrTooManyOpenStreams:
+		return nil, Error{ErrorCode: protocol.QUIC_TOO_MANY_OPEN_STREAMS, ReasonPhrase: err.Error()}
+	default:
+		return nil, Error{ErrorCode: protocol.QUIC_INVALID_STREAM_ID, ReasonPhrase: err.Error()}
+	}
+	for _, sid := range opened {
+		s := this.newStream(sid)
+		this.streams[sid] = s
+		if this.goawaySent {
+			refused = append(refused, s)
+			continue
+		}
+		this.acceptQueue = append(this.acceptQueue, s)
+	}
+	if len(opened) > 0 {
+		this.cond.Broadcast()
+	}
+	return this.streams[id], nil
+}
+
+// onConnectionWindowUpdate resumes the streams blocked by the connection flow control window.
+func (this *session) onConnectionWindowUpdate() {
+	this.mutex.Lock()
+	streams := make([]*stream.Stream, 0, len(this.streams))
+	for _, s := range this.streams {
+		streams = append(streams, s)
+	}
+	this.mutex.Unlock()
+	for _, s := range streams {
+		s.OnConnectionWindowUpdate()
+	}
+}
+
+// sendPackets sends the pending frames while the congestion control allows it, the ACK frames are sent anyway.
+func (this *session) sendPackets(now time.Time) error {
+	err := this.packPackets(now)
+	if flushErr := this.flushPackets(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// packPackets packs the packets allowed by the congestion control and the amplification limit, they are written by batches.
+func (this *session) packPackets(now time.Time) error {
+	if err := this.sendMTUProbe(now); err != nil {
+		return err
+	}
+	for {
+		if !this.amplification.CanSend(MAX_PACKET_SIZE) {
+			return nil
+		}
+		if this.sentPacketHandler.TimeUntilSend(now) > 0 {
+			this.queueAckFrame(now)
+			p, err := this.packer.PackAckPacket(this.sealer)
+			if p == nil || err != nil {
+				return err
+			}
+			return this.sendPacket(p, now)
+		}
+		if !this.packer.HasPendingFrames() && !this.packer.HasPendingCryptoFrames() {
+			this.queueFrames(now)
+		}
+		if this.packer.HasPendingCryptoFrames() {
+			p, err := this.packer.PackCryptoPacket(this.cryptoSealer)
+			if err != nil {
+				return err
+			}
+			if err = this.sendPacket(p, now); err != nil {
+				return err
+			}
+			continue
+		}
+		this.queueAckFrame(now)
+		p, err := this.packer.PackPacket(this.sealer)
+		if p == nil || err != nil {
+			return err
+		}
+		if err = this.sendPacket(p, now); err != nil {
+			return err
+		}
+	}
+}
+
+// sendMTUProbe sends the next probe of the path MTU discovery once the handshake is complete, if the congestion control allows it.
+// A probe that can't be written is lost.
+func (this *session) sendMTUProbe(now time.Time) error {
+	if !this.handshakeComplete || this.encryptionLevel != protocol.ENCRYPTION_FORWARD_SECURE ||
+		this.sentPacketHandler.TimeUntilSend(now) > 0 || !this.mtuDiscoverer.ShouldSendProbe(now) {
+		return nil
+	}
+	size := this.mtuDiscoverer.GetProbeSize()
+	p, err := this.packer.PackMTUProbePacket(this.sealer, size)
+	if err != nil {
+		return err
+	}
+	defer p.Release()
+	this.mtuDiscoverer.OnProbeSent(p.SequenceNumber, size)
+	if err = this.conn.Write(p.Data); err != nil {
+		this.mtuDiscoverer.OnProbeLost(now)
+		return nil
+	}
+	return this.onPacketSent(p, now)
+}
+
+// updateMTUProbe grows the packets to the size of the MTU probe once it is acknowledged, or searches below it once it is lost.
+func (this *session) updateMTUProbe(acked []*ackhandler.SentPacket, now time.Time) {
+	seqnum, probing := this.mtuDiscoverer.GetProbe()
+	if !probing {
+		return
+	}
+	for _, p := range acked {
+		if p.SequenceNumber == seqnum {
+			this.mtuDiscoverer.OnProbeAcked(now)
+			this.packer.SetMaxPacketSize(this.mtuDiscoverer.GetPacketSize())
+			return
+		}
+	}
+	if !this.sentPacketHandler.IsInFlight(seqnum) {
+		this.mtuDiscoverer.OnProbeLost(now)
+	}
+}
+
+// queueAckFrame queues the ACK frame of the received packets when it is due.
+func (this *session) queueAckFrame(now time.Time) {
+	if this.receivedPacketTracker.ShouldSendAck(now) {
+		if f := this.receivedPacketTracker.BuildAckFrame(now); f != nil {
+			this.packer.QueueAckFrame(f, this.sentPacketHandler.GetLeastUnacked())
+		}
+	}
+}
+
+// queueFrames queues the frames of the next packet: retransmissions, control frames, then the stream data in the order of
+// the StreamScheduler.
+// The handshake messages are not retransmitted once the peer has received them, nor the data of the streams reset.
+func (this *session) queueFrames(now time.Time) {
+	for _, f := range this.sentPacketHandler.DequeueRetransmissions() {
+		if sf, ok := f.(*protocol.StreamFrame); ok {
+			if (sf.StreamID.IsCryptoStream() && this.handshakeComplete) || this.isWriteAborted(sf.StreamID) {
+				continue
+			}
+			this.packer.QueueStreamFrame(sf)
+		} else {
+			this.packer.QueueControlFrame(f)
+		}
+		this.stats.retransmissions.Add(1)
+	}
+	this.mutex.Lock()
+	frames := this.controlFrames
+	this.controlFrames = nil
+	this.mutex.Unlock()
+	for _, f := range frames {
+		this.packer.QueueControlFrame(f)
+	}
+	if f := this.connFlowController.GetWindowUpdate(now); f != nil {
+		this.packer.QueueControlFrame(f)
+	}
+
+	// The crypto stream, then the headers stream, then one STREAM frame per data stream and per turn, up to a packet of data
+	budget := this.mtuDiscoverer.GetPacketSize()
+	for _, id := range []protocol.QuicStreamID{protocol.QUIC_CRYPTO_STREAM_ID, protocol.QUIC_HEADERS_STREAM_ID} {
+		for budget > 0 {
+			this.mutex.Lock()
+			pending := this.sendPending[id]
+			this.mutex.Unlock()
+			if !pending {
+				break
+			}
+			sent := this.queueStreamFrame(id, budget)
+			if sent == 0 {
+				break
+			}
+			budget -= sent
+		}
+	}
+	for budget > 0 {
+		this.mutex.Lock()
+		id, ok := this.scheduler.Next()
+		this.mutex.Unlock()
+		if !ok {
+			break
+		}
+		budget -= this.queueStreamFrame(id, budget)
+	}
+	if this.connFlowController.SendWindowSize() == 0 {
+		if f := this.connFlowController.GetBlockedFrame(); f != nil {
+			this.packer.QueueControlFrame(f)
+		}
+	}
+}
+
+// isWriteAborted returns true if the stream has sent a RST_STREAM frame, its data is not retransmitted.
+func (this *session) isWriteAborted(id protocol.QuicStreamID) bool {
+	this.mutex.Lock()
+	s := this.streams[id]
+	this.mutex.Unlock()
+	return s != nil && s.IsWriteAborted()
+}
+
+// queueStreamFrame queues a STREAM frame of the pending stream within the budget, and returns its size, 0 if none.
+// The stream is scheduled again while it has data to send, the data streams wait for the encryption level of the data.
+func (this *session) queueStreamFrame(id protocol.QuicStreamID, budget int) int {
+	this.mutex.Lock()
+	s := this.streams[id]
+	waiting := this.encryptionLevel < this.dataLevel
+	this.mutex.Unlock()
+	var f *protocol.StreamFrame
+	if s != nil && (!waiting || id.IsCryptoStream()) {
+		f = s.PopStreamFrame(budget)
+	}
+	size := 0
+	if f != nil {
+		this.packer.QueueStreamFrame(f)
+		size = f.GetSerializedSize()
+	}
+	// The stream is still pending if it has data to send, checked with the mutex locked so that OnHasStreamData isn't lost
+	this.mutex.Lock()
+	switch {
+	case f == nil || !s.HasDataToSend():
+		delete(this.sendPending, id)
+	case !id.IsCryptoStream() && !id.IsHeadersStream():
+		this.scheduler.Schedule(id, s.GetPriority(), size)
+	}
+	this.mutex.Unlock()
+	return size
+}
+
+// sendPacket records a packet for the loss recovery, and queues it in the batch written by flushPackets.
+func (this *session) sendPacket(p *protocol.PackedPacket, now time.Time) error {
+	if err := this.onPacketSent(p, now); err != nil {
+		p.Release()
+		return err
+	}
+	this.sendBatch = append(this.sendBatch, p)
+	if len(this.sendBatch) >= packetconn.BATCH_SIZE {
+		return this.flushPackets()
+	}
+	return nil
+}
+
+// flushPackets writes the packets of the batch on the connection, and releases them.
+func (this *session) flushPackets() error {
+	if len(this.sendBatch) == 0 {
+		return nil
+	}
+	for _, p := range this.sendBatch {
+		this.sendData = append(this.sendData, p.Data)
+	}
+	err := this.conn.WriteBatch(this.sendData)
+	for i, p := range this.sendBatch {
+		p.Release()
+		this.sendBatch[i], this.sendData[i] = nil, nil
+	}
+	this.sendBatch, this.sendData = this.sendBatch[:0], this.sendData[:0]
+	return err
+}
+
+// onPacketSent records a packet written on the connection for the loss recovery.
+func (this *session) onPacketSent(p *protocol.PackedPacket, now time.Time) error {
+	if this.tracer != nil {
+		this.tracer.SentPacket(p.SequenceNumber, p.EncryptionLevel, len(p.Data), p.Frames)
+	}
+	this.amplification.OnSent(len(p.Data))
+	this.stats.packetsSent.Add(1)
+	this.stats.bytesSent.Add(uint64(len(p.Data)))
+	if this.metrics != nil {
+		this.metrics.bytesSent.Add(uint64(len(p.Data)))
+	}
+	if this.perspective == protocol.PERSPECTIVE_CLIENT && p.EncryptionLevel == protocol.ENCRYPTION_INITIAL && hasStreamData(p.Frames) {
+		this.zeroRTTSent = true
+	}
+	if p.Retransmittable {
+		this.idleTimer.OnActivity(now)
+	}
+	return this.sentPacketHandler.SentPacket(&ackhandler.SentPacket{
+		SequenceNumber:  p.SequenceNumber,
+		Frames:          p.Frames,
+		Length:          len(p.Data),
+		SentTime:        now,
+		EncryptionLevel: p.EncryptionLevel,
+		Retransmittable: p.Retransmittable,
+		MTUProbe:        p.MTUProbe})
+}
+
+// removeFinishedStreams forgets the streams done in both directions, and frees their slot for a new stream.
+func (this *session) removeFinishedStreams() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	freed := false
+	for id, s := range this.streams {
+		if id.IsCryptoStream() || id.IsHeadersStream() || !s.IsFinished() {
+			continue
+		}
+		delete(this.streams, id)
+		if id.IsInitiatedBy(this.perspective) {
+			this.openStreams--
+		} else {
+			this.peerStreams.Close(id)
+		}
+		freed = true
+	}
+	if freed {
+		this.cond.Broadcast()
+	}
+}
+
+// shutdown sends the CONNECTION_CLOSE frame of a local error, closes the connection and aborts the streams.
+// There is no CONNECTION_CLOSE frame after a version negotiation packet.
+//
+// Once the peer has sent packets, the connection lingers: the peer may not receive the CONNECTION_CLOSE frame.
+func (this *session) shutdown(err error) {
+	var closePacket []byte
+
+	closeErr := closeError(err)
+	if cerr, ok := closeErr.(Error); ok && !cerr.Remote {
+		this.packer.QueueControlFrame(&protocol.ConnectionCloseFrame{ErrorCode: cerr.ErrorCode, ReasonPhrase: cerr.ReasonPhrase})
+		for this.packer.HasPendingFrames() {
+			p, perr := this.packer.PackPacket(this.sealer)
+			if p == nil || perr != nil || !this.amplification.CanSend(len(p.Data)) {
+				break
+			}
+			if this.tracer != nil {
+				this.tracer.SentPacket(p.SequenceNumber, p.EncryptionLevel, len(p.Data), p.Frames)
+			}
+			this.amplification.OnSent(len(p.Data))
+			this.conn.Write(p.Data)
+			closePacket = p.Data
+		}
+	}
+	if this.tracer != nil {
+		this.tracer.ClosedConnection(err)
+	}
+	if closePacket != nil && this.receivedFirstPacket {
+		go this.linger(closePacket, CONNECTION_CLOSE_LINGER*this.sentPacketHandler.GetRetransmissionTimeout())
+	} else {
+		this.conn.Close()
+	}
+
+	// The last packet is sealed, linger only sends it again: the key material is zeroed
+	closeAEAD(this.sealer)
+	if this.cryptoSealer != this.sealer {
+		closeAEAD(this.cryptoSealer)
+	}
+	this.unpacker.Close()
+
+	this.mutex.Lock()
+	this.closeErr = closeErr
+	for _, s := range this.streams {
+		s.CloseWithError(closeErr)
+	}
+	this.cond.Broadcast()
+	this.mutex.Unlock()
+}
+
+// closeAEAD zeroes the key material of a sealer no longer used, if it has any.
+func closeAEAD(sealer protocol.PacketSealer) {
+	if c, ok := sealer.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// linger sends the CONNECTION_CLOSE packet again to the packets of the peer until the duration elapses, then closes the connection.
+// It answers the 1st, 2nd, 4th, 8th... packet only: two endpoints closing at once stop answering each other.
+func (this *session) linger(closePacket []byte, d time.Duration) {
+	timer := this.config.Clock.NewTimer(d)
+	defer timer.Stop()
+	defer this.conn.Close()
+	for n := 1; ; n++ {
+		select {
+		case p := <-this.receivedPackets:
+			this.amplification.OnReceived(len(p.data))
+			if n&(n-1) == 0 && this.amplification.CanSend(len(closePacket)) {
+				this.amplification.OnSent(len(closePacket))
+				this.conn.Write(closePacket)
+			}
+		case <-timer.Chan():
+			return
+		}
+	}
+}
+
+// errorCode returns the error code of the CONNECTION_CLOSE frame sent for the error.
+func errorCode(err error) protocol.QuicErrorCode {
+	switch e := err.(type) {
+	case nil:
+		return protocol.QUIC_NO_ERROR
+	case Error:
+		return e.ErrorCode
+	case interface{ ErrorCode() protocol.QuicErrorCode }:
+		return e.ErrorCode()
+	}
+	return protocol.QUIC_INTERNAL_ERROR
+}
@@ -0,0 +1,1499 @@
+package quic
+
+import "github.com/romain-jacotin/quic/congestion"
+import "github.com/romain-jacotin/quic/crypto"
+import "github.com/romain-jacotin/quic/handshake"
+import "github.com/romain-jacotin/quic/internal/packetconn"
+import "github.com/romain-jacotin/quic/internal/testutil"
+import "github.com/romain-jacotin/quic/protocol"
+import "github.com/romain-jacotin/quic/stream"
+import "bytes"
+import "context"
+import "crypto/tls"
+import "crypto/x509"
+import "errors"
+import "io"
+import "io/ioutil"
+import "math/rand"
+import "net"
+import "os"
+import "sync"
+import "testing"
+import "time"
+
+// testConn is an in-memory connection delivering the datagrams to the peer session, it drops the packets chosen by the drop function
+// and holds the packets chosen by the hold function until release.
+type testConn struct {
+	mutex  sync.Mutex
+	local  net.Addr
+	remote net.Addr
+	peer   *session
+	sent   int
+	drop   func(n int) bool
+	hold   func(b []byte) bool
+	held   [][]byte
+	closed bool
+	// ecn is the ECN codepoint of the datagrams delivered to the peer
+	ecn packetconn.ECN
+}
+
+func (this *testConn) Write(b []byte) error {
+	return this.WriteTo(b, nil)
+}
+
+func (this *testConn) WriteBatch(bs [][]byte) error {
+	for _, b := range bs {
+		if err := this.WriteTo(b, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTo delivers the datagram to the peer session, whatever the address.
+func (this *testConn) WriteTo(b []byte, addr net.Addr) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.closed {
+		return errors.New("testConn.Write : connection closed")
+	}
+	this.sent++
+	if this.peer == nil || (this.drop != nil && this.drop(this.sent)) {
+		return nil
+	}
+	data := make([]byte, len(b))
+	copy(data, b)
+	if this.hold != nil && this.hold(data) {
+		this.held = append(this.held, data)
+		return nil
+	}
+	this.peer.handleDatagram(data, this.local, this.ecn, this.peer.config.Clock.Now())
+	return nil
+}
+
+// release delivers the held packets, and stops holding packets.
+func (this *testConn) release() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, data := range this.held {
+		this.peer.handleDatagram(data, this.local, this.ecn, this.peer.config.Clock.Now())
+	}
+	this.held, this.hold = nil, nil
+}
+
+func (this *testConn) LocalAddr() net.Addr {
+	return this.local
+}
+
+func (this *testConn) RemoteAddr() net.Addr {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.remote
+}
+
+func (this *testConn) SetRemoteAddr(addr net.Addr) {
+	this.mutex.Lock()
+	this.remote = addr
+	this.mutex.Unlock()
+}
+
+func (this *testConn) Close() error {
+	this.mutex.Lock()
+	this.closed = true
+	this.mutex.Unlock()
+	return nil
+}
+
+// testServerConfig returns the config with a server config whose certificate of localhost is signed by the test CA
+// of the testdata directory, unless it has one.
+func testServerConfig(t testing.TB, config *Config) *Config {
+	if config != nil && config.ServerConfig != nil {
+		return populateDefaults(config)
+	}
+	cert, err := tls.LoadX509KeyPair("testdata/cert.pem", "testdata/cert.key")
+	if err != nil {
+		t.Fatalf("tls.LoadX509KeyPair : unexpected error %v", err)
+	}
+	sc, err := handshake.NewServerConfig(time.Hour)
+	if err != nil {
+		t.Fatalf("NewServerConfig : unexpected error %v", err)
+	}
+	if err = sc.SetCertificate(cert); err != nil {
+		t.Fatalf("ServerConfig.SetCertificate : unexpected error %v", err)
+	}
+	c := populateDefaults(config)
+	c.ServerConfig = sc
+	return c
+}
+
+// testClientConfig returns the config trusting the test CA of the testdata directory.
+func testClientConfig(t testing.TB, config *Config) *Config {
+	ca, err := os.ReadFile("testdata/ca.pem")
+	if err != nil {
+		t.Fatalf("os.ReadFile : unexpected error %v", err)
+	}
+	c := populateDefaults(config)
+	c.RootCAs = x509.NewCertPool()
+	c.RootCAs.AppendCertsFromPEM(ca)
+	return c
+}
+
+// newTestSessions returns a client and a server session connected by testConns, with the maximum number of streams of each endpoint.
+// They are returned once the crypto handshake is complete.
+func newTestSessions(t *testing.T, maxStreams int, drop func(n int) bool) (*session, *session) {
+	return newTestSessionsWithConfig(t, maxStreams, drop, nil, nil)
+}
+
+// newTestSessionsWithConfig is newTestSessions with the configs of the client and of the server.
+func newTestSessionsWithConfig(t *testing.T, maxStreams int, drop func(n int) bool, clientConfig, serverConfig *Config) (*session, *session) {
+	client, server := connectTestSessions(t, maxStreams, drop, clientConfig, serverConfig)
+	client.start()
+	server.start()
+	for _, s := range []*session{client, server} {
+		if err := s.waitForEncryptionLevel(context.Background(), protocol.ENCRYPTION_FORWARD_SECURE); err != nil {
+			t.Fatalf("Session : crypto handshake failed with %v", err)
+		}
+	}
+	return client, server
+}
+
+// connectTestSessions returns a client and a server session connected by testConns, not started.
+// The maximum number of streams replaces the one of the configs, unless it is 0.
+func connectTestSessions(t *testing.T, maxStreams int, drop func(n int) bool, clientConfig, serverConfig *Config) (*session, *session) {
+	clientConfig = testClientConfig(t, clientConfig)
+	serverConfig = testServerConfig(t, serverConfig)
+	if maxStreams > 0 {
+		clientConfig.MaxStreams, serverConfig.MaxStreams = maxStreams, maxStreams
+	}
+	clientAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000}
+	serverAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 443}
+	clientConn := &testConn{local: clientAddr, remote: serverAddr, drop: drop}
+	serverConn := &testConn{local: serverAddr, remote: clientAddr, drop: drop}
+	client, err := newClientSession(clientConn, 0x1234, protocol.QUIC_VERSION_39, protocol.QUIC_VERSION_39, "localhost", clientConfig)
+	if err != nil {
+		t.Fatalf("newClientSession : unexpected error %v", err)
+	}
+	server, err := newServerSession(serverConn, 0x1234, protocol.QUIC_VERSION_39, serverConfig)
+	if err != nil {
+		t.Fatalf("newServerSession : unexpected error %v", err)
+	}
+	clientConn.peer = server
+	serverConn.peer = client
+	return client, server
+}
+
+func Test_Session_OpenAcceptStream(t *testing.T) {
+	client, server := newTestSessions(t, DEFAULT_MAX_STREAMS, nil)
+	defer client.Close(nil)
+	defer server.Close(nil)
+
+	if client.ConnectionID() != 0x1234 || server.ConnectionID() != 0x1234 {
+		t.Errorf("Session.ConnectionID : invalid Connection ID %x %x", client.ConnectionID(), server.ConnectionID())
+	}
+	if client.LocalAddr().String() != server.RemoteAddr().String() || client.RemoteAddr().String() != server.LocalAddr().String() {
+		t.Errorf("Session.LocalAddr : invalid addresses %v %v", client.LocalAddr(), server.RemoteAddr())
+	}
+
+	// Both perspectives open and accept streams
+	for i, endpoints := range [][2]*session{{client, server}, {server, client}} {
+		opener, accepter := endpoints[0], endpoints[1]
+		s, err := opener.OpenStream()
+		if err != nil {
+			t.Fatalf("Session.OpenStream : unexpected error %v in test n°%v", err, i)
+		}
+		if _, err = s.Write([]byte("hello")); err != nil {
+			t.Fatalf("Stream.Write : unexpected error %v in test n°%v", err, i)
+		}
+		s.Close()
+		a, err := accepter.AcceptStream(context.Background())
+		if err != nil {
+			t.Fatalf("Session.AcceptStream : unexpected error %v in test n°%v", err, i)
+		}
+		if a.GetStreamID() != s.GetStreamID() {
+			t.Errorf("Session.AcceptStream : stream %v accepted instead of %v in test n°%v", a.GetStreamID(), s.GetStreamID(), i)
+		}
+		if data, err := ioutil.ReadAll(a); err != nil || string(data) != "hello" {
+			t.Errorf("Stream.Read : 'hello' expected instead of %q (%v) in test n°%v", data, err, i)
+		}
+	}
+}
+
+func Test_Session_StreamIDs(t *testing.T) {
+	client, server := newTestSessions(t, DEFAULT_MAX_STREAMS, nil)
+	defer client.Close(nil)
+	defer server.Close(nil)
+
+	// The crypto and headers streams are reserved
+	for i, expected := range []protocol.QuicStreamID{5, 7, 9} {
+		if s, err := client.OpenStream(); err != nil || s.GetStreamID() != expected {
+			t.Errorf("Session.OpenStream : client stream %v expected in test n°%v", expected, i)
+		}
+	}
+	for i, expected := range []protocol.QuicStreamID{2, 4, 6} {
+		if s, err := server.OpenStream(); err != nil || s.GetStreamID() != expected {
+			t.Errorf("Session.OpenStream : server stream %v expected in test n°%v", expected, i)
+		}
+	}
+}
+
+func Test_Session_HeadersStream(t *testing.T) {
+	client, server := newTestSessions(t, DEFAULT_MAX_STREAMS, nil)
+	defer client.Close(nil)
+
+	// The headers stream works both ways, opened by the first frame of the peer
+	h := client.HeadersStream()
+	if h.GetStreamID() != protocol.QUIC_HEADERS_STREAM_ID || client.HeadersStream() != h {
+		t.Errorf("Session.HeadersStream : the same stream %v expected instead of %v", protocol.QUIC_HEADERS_STREAM_ID, h.GetStreamID())
+	}
+	if _, err := h.Write([]byte("request")); err != nil {
+		t.Fatalf("Stream.Write : unexpected error %v", err)
+	}
+	b := make([]byte, 7)
+	if _, err := io.ReadFull(server.HeadersStream(), b); err != nil || string(b) != "request" {
+		t.Errorf("Stream.Read : 'request' expected instead of %q (%v)", b, err)
+	}
+	server.HeadersStream().Write([]byte("response"))
+	b = make([]byte, 8)
+	if _, err := io.ReadFull(h, b); err != nil || string(b) != "response" {
+		t.Errorf("Stream.Read : 'response' expected instead of %q (%v)", b, err)
+	}
+
+	// It is not accepted as a stream of the peer, and doesn't delay the graceful close
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if s, err := server.AcceptStream(ctx); err == nil {
+		t.Errorf("Session.AcceptStream : no stream expected instead of %v", s.GetStreamID())
+	}
+	if err := server.CloseGracefully(5 * time.Second); err != nil {
+		t.Errorf("Session.CloseGracefully : unexpected error %v", err)
+	}
+	if _, err := server.HeadersStream().Read(b); err == nil {
+		t.Error("Stream.Read : error expected on the headers stream of a closed session")
+	}
+}
+
+func Test_Session_NegotiatedProtocol(t *testing.T) {
+	client, server := newTestSessionsWithConfig(t, DEFAULT_MAX_STREAMS, nil, &Config{NextProtos: []string{"h2", "hq"}},
+		&Config{NextProtos: []string{"hq", "h2"}})
+	defer client.Close(nil)
+	defer server.Close(nil)
+	if client.NegotiatedProtocol() != "hq" || server.NegotiatedProtocol() != "hq" {
+		t.Errorf("Session.NegotiatedProtocol : 'hq' expected instead of %q and %q", client.NegotiatedProtocol(), server.NegotiatedProtocol())
+	}
+
+	// The server fails the handshake without common application protocol, the client receives the error
+	client, server = connectTestSessions(t, DEFAULT_MAX_STREAMS, nil, &Config{NextProtos: []string{"h2"}}, &Config{NextProtos: []string{"hq"}})
+	client.start()
+	server.start()
+	defer client.Close(nil)
+	defer server.Close(nil)
+	for i, s := range []*session{server, client} {
+		if err := s.waitForEncryptionLevel(context.Background(), protocol.ENCRYPTION_FORWARD_SECURE); !errors.Is(err, ErrNoApplicationProtocol) {
+			t.Errorf("Session : ErrNoApplicationProtocol expected instead of %v in test n°%v", err, i)
+		}
+	}
+}
+
+func Test_Session_TransferData(t *testing.T) {
+	var wg sync.WaitGroup
+
+	// 5% of the packets are lost, 1% are reordered
+	s, _, network, closeNetwork := dialSimulated(t, testutil.Link{Delay: 10 * time.Millisecond, Jitter: 2 * time.Millisecond, Loss: 0.05, Reorder: 0.01}, 7)
+	defer closeNetwork()
+
+	data := make([]byte, 200*1024)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	// Echo on several streams
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			st, err := s.OpenStream()
+			if err != nil {
+				t.Errorf("Session.OpenStream : unexpected error %v in test n°%v", err, i)
+				return
+			}
+			go func() {
+				st.Write(data)
+				st.Close()
+			}()
+			st.SetReadDeadline(time.Now().Add(20 * time.Second))
+			echo, err := ioutil.ReadAll(st)
+			if err != nil || !bytes.Equal(echo, data) {
+				t.Errorf("Stream.Read : %v bytes echoed instead of %v (%v) in test n°%v", len(echo), len(data), err, i)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if stats := network.Stats(); stats.Lost == 0 || stats.Reordered == 0 {
+		t.Errorf("SimulatedNetwork : packets lost and reordered expected instead of %+v", stats)
+	}
+}
+
+func Test_Session_Stats(t *testing.T) {
+	// 5% of the packets are lost, on a RTT of 20 ms
+	s, _, network, closeNetwork := dialSimulated(t, testutil.Link{Delay: 10 * time.Millisecond, Loss: 0.05}, 3)
+	defer closeNetwork()
+
+	st, err := s.OpenStream()
+	if err != nil {
+		t.Fatalf("Session.OpenStream : unexpected error %v", err)
+	}
+	data := make([]byte, 100*1024)
+	go func() {
+		st.Write(data)
+		st.Close()
+	}()
+	st.SetReadDeadline(time.Now().Add(20 * time.Second))
+	if echo, err := ioutil.ReadAll(st); err != nil || !bytes.Equal(echo, data) {
+		t.Fatalf("Stream.Read : %v bytes echoed instead of %v (%v)", len(echo), len(data), err)
+	}
+	s.Close(nil)
+
+	// The data and its echo with the overhead of the headers, the ACKs, the handshake, the MTU probes and the retransmissions
+	stats := s.Stats()
+	if stats.BytesSent < uint64(len(data)) || stats.BytesSent > uint64(len(data))*3/2 {
+		t.Errorf("Session.Stats : %v bytes sent for %v bytes of data", stats.BytesSent, len(data))
+	}
+	if stats.BytesReceived < uint64(len(data)) || stats.BytesReceived > uint64(len(data))*3/2 {
+		t.Errorf("Session.Stats : %v bytes received for %v bytes of data", stats.BytesReceived, len(data))
+	}
+	if stats.PacketsSent == 0 || stats.PacketsReceived == 0 || stats.PacketsSent+stats.PacketsReceived > uint64(network.Stats().Sent) {
+		t.Errorf("Session.Stats : %v packets sent and %v received for %v datagrams", stats.PacketsSent, stats.PacketsReceived, network.Stats().Sent)
+	}
+	if stats.PacketsLost == 0 || stats.Retransmissions == 0 {
+		t.Errorf("Session.Stats : packets lost and retransmitted expected instead of %v and %v", stats.PacketsLost, stats.Retransmissions)
+	}
+	if stats.MinRTT < 20*time.Millisecond || stats.SmoothedRTT < stats.MinRTT || stats.CongestionWindow == 0 {
+		t.Errorf("Session.Stats : RTT of 20 ms expected instead of %v and %v, with a congestion window of %v",
+			stats.MinRTT, stats.SmoothedRTT, stats.CongestionWindow)
+	}
+	// The inchoate CHLO is rejected, then the full CHLO is answered by the SHLO
+	if stats.StreamsOpened != 1 || stats.StreamsAccepted != 0 || stats.HandshakeDuration < 40*time.Millisecond || stats.ZeroRTTAccepted ||
+		stats.PacketsDropped != 0 {
+		t.Errorf("Session.Stats : unexpected %+v", stats)
+	}
+}
+
+func Test_Session_Pacing(t *testing.T) {
+	// A link of 1 MB/s whose queue holds 50 ms
+	const BANDWIDTH = 1000 * 1000
+	s, clock, network, closeNetwork := dialSimulated(t, testutil.Link{Delay: 20 * time.Millisecond, Bandwidth: BANDWIDTH, QueueSize: BANDWIDTH / 20}, 1)
+	defer closeNetwork()
+
+	st, err := s.OpenStream()
+	if err != nil {
+		t.Fatalf("Session.OpenStream : unexpected error %v", err)
+	}
+	data := make([]byte, 1024*1024)
+	start := clock.Now()
+	go func() {
+		st.Write(data)
+		st.Close()
+	}()
+	st.SetReadDeadline(time.Now().Add(20 * time.Second))
+	if echo, err := ioutil.ReadAll(st); err != nil || !bytes.Equal(echo, data) {
+		t.Fatalf("Stream.Read : %v bytes echoed instead of %v (%v)", len(echo), len(data), err)
+	}
+
+	// The transfer uses most of the bandwidth, the paced packets rarely overflow the queue
+	elapsed := clock.Now().Sub(start)
+	if ideal := time.Duration(len(data)) * time.Second / BANDWIDTH; elapsed < ideal || elapsed > 2*ideal {
+		t.Errorf("Session : transfer of %v instead of %v to %v", elapsed, ideal, 2*ideal)
+	}
+	if stats := network.Stats(); stats.Dropped > stats.Sent/20 {
+		t.Errorf("SimulatedNetwork : %v packets of %v dropped by the queue", stats.Dropped, stats.Sent)
+	}
+}
+
+func Test_Session_StreamPriority(t *testing.T) {
+	// Two uploads share a link of 1 MB/s whose queue drops no packet, the high priority one gets most of the bandwidth
+	// within the flow control windows: it ends about when it would alone, the other one when both would with a fair share
+	const BANDWIDTH = 1000 * 1000
+	clock := testutil.NewClock(time.Now())
+	network := testutil.NewSimulatedNetwork(clock, testutil.Link{Delay: 20 * time.Millisecond, Bandwidth: BANDWIDTH, QueueSize: BANDWIDTH}, 1)
+	defer clock.Run(time.Millisecond)()
+	windows := &Config{Clock: clock, StreamFlowControlWindow: 1 << 20, ConnectionFlowControlWindow: 4 << 20}
+	s, server, closeSessions := newSimulatedSessions(t, network, windows, windows)
+	defer closeSessions()
+
+	// The server reads the uploads and records when they end
+	data := make([]byte, 256*1024)
+	start := clock.Now()
+	var mutex sync.Mutex
+	elapsed := make(map[protocol.QuicStreamID]time.Duration)
+	done := make(chan struct{}, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			st, err := server.AcceptStream(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				if b, err := io.ReadAll(st); err != nil || len(b) != len(data) {
+					t.Errorf("Stream.Read : %v bytes received instead of %v (%v)", len(b), len(data), err)
+				}
+				mutex.Lock()
+				elapsed[st.GetStreamID()] = clock.Now().Sub(start)
+				mutex.Unlock()
+				done <- struct{}{}
+			}()
+		}
+	}()
+	var ids [2]protocol.QuicStreamID
+	for i, priority := range []int{1, stream.MAX_STREAM_PRIORITY} {
+		st, err := s.OpenStream()
+		if err != nil {
+			t.Fatalf("Session.OpenStream : unexpected error %v", err)
+		}
+		st.SetPriority(priority)
+		ids[i] = st.GetStreamID()
+		go func() {
+			st.Write(data)
+			st.Close()
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(20 * time.Second):
+			t.Fatalf("Session : uploads not received")
+		}
+	}
+	mutex.Lock()
+	low, high := elapsed[ids[0]], elapsed[ids[1]]
+	mutex.Unlock()
+	if high > low*2/3 {
+		t.Errorf("Session : the high priority stream finished after %v, the low priority one after %v", high, low)
+	}
+}
+
+func Test_Session_CancelStream(t *testing.T) {
+	// The connection windows hold the data not read of the three streams
+	windows := &Config{StreamFlowControlWindow: 256 * 1024, ConnectionFlowControlWindow: 4 << 20}
+	client, server := newTestSessionsWithConfig(t, DEFAULT_MAX_STREAMS, nil, windows, windows)
+	defer client.Close(nil)
+	defer server.Close(nil)
+
+	// The client cancels the write side of a large upload, the server cancels the read side of another one,
+	// while a third upload goes on
+	large := make([]byte, 8<<20)
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	var writes [3]chan error
+	var streams [3]Stream
+	for i, p := range [][]byte{large, large, data} {
+		st, err := client.OpenStream()
+		if err != nil {
+			t.Fatalf("Session.OpenStream : unexpected error %v", err)
+		}
+		streams[i] = st
+		writes[i] = make(chan error, 1)
+		go func() {
+			_, err := st.Write(p)
+			st.Close()
+			writes[i] <- err
+		}()
+	}
+	accepted := make(map[protocol.QuicStreamID]Stream)
+	for len(accepted) < 3 {
+		st, err := server.AcceptStream(context.Background())
+		if err != nil {
+			t.Fatalf("Session.AcceptStream : unexpected error %v", err)
+		}
+		accepted[st.GetStreamID()] = st
+	}
+	for _, st := range accepted {
+		st.SetReadDeadline(time.Now().Add(10 * time.Second))
+	}
+	cancelWrite, cancelRead := accepted[streams[0].GetStreamID()], accepted[streams[1].GetStreamID()]
+	for _, st := range []Stream{cancelWrite, cancelRead} {
+		if _, err := io.ReadFull(st, make([]byte, 64*1024)); err != nil {
+			t.Fatalf("Stream.Read : unexpected error %v", err)
+		}
+	}
+	streams[0].CancelWrite(protocol.QUIC_CONNECTION_CANCELLED)
+	cancelRead.CancelRead(protocol.QUIC_CONNECTION_CANCELLED)
+
+	var resetErr stream.StreamResetError
+	if err := <-writes[0]; !errors.As(err, &resetErr) || resetErr.Remote {
+		t.Errorf("Stream.CancelWrite : local StreamResetError expected instead of %v", err)
+	}
+	if _, err := io.Copy(ioutil.Discard, cancelWrite); !errors.As(err, &resetErr) || !resetErr.Remote {
+		t.Errorf("Stream.Read : StreamResetError of the peer expected instead of %v", err)
+	}
+	if err := <-writes[1]; !errors.As(err, &resetErr) || !resetErr.Remote || resetErr.ErrorCode != protocol.QUIC_CONNECTION_CANCELLED {
+		t.Errorf("Stream.Write : StreamResetError of the peer expected after CancelRead instead of %v", err)
+	}
+	b, err := ioutil.ReadAll(accepted[streams[2].GetStreamID()])
+	if err != nil || !bytes.Equal(b, data) || <-writes[2] != nil {
+		t.Errorf("Stream.Read : %v bytes expected on the other stream instead of %v (%v)", len(data), len(b), err)
+	}
+	accepted[streams[2].GetStreamID()].Close()
+	streams[2].SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err = ioutil.ReadAll(streams[2]); err != nil {
+		t.Errorf("Stream.Read : FIN expected on the other stream instead of %v", err)
+	}
+
+	// Both sessions forget the streams reset once they know the final offsets, and the connection flow control of both
+	// sides agrees on the data sent, all consumed
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		client.mutex.Lock()
+		server.mutex.Lock()
+		n := len(client.streams) + len(server.streams)
+		server.mutex.Unlock()
+		client.mutex.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Session : %v streams left instead of the crypto streams", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i, endpoints := range [][2]*session{{client, server}, {server, client}} {
+		sent, received := endpoints[0].connFlowController.GetBytesSent(), endpoints[1].connFlowController.GetHighestReceived()
+		if read := endpoints[1].connFlowController.GetBytesRead(); sent != received || read != received {
+			t.Errorf("FlowController : %v bytes sent, %v received and %v read in test n°%v", sent, received, read, i)
+		}
+	}
+}
+
+func Test_Session_NegotiatedParams(t *testing.T) {
+	// The smallest maximum number of streams limits both endpoints
+	var tests_params = []struct {
+		client   int
+		server   int
+		expected int
+	}{
+		{10, 200, 10},
+		{200, 10, 10},
+		{150, 150, 150},
+	}
+	for i, v := range tests_params {
+		client, server := newTestSessionsWithConfig(t, 0, nil, &Config{MaxStreams: v.client}, &Config{MaxStreams: v.server})
+		for _, s := range []*session{client, server} {
+			s.mutex.Lock()
+			max, maxID, largest := s.maxOpenStreams, s.peerStreams.MaxStreamID(), s.peerStreams.LargestStreamID()
+			s.mutex.Unlock()
+			if max != v.expected {
+				t.Errorf("Session : %v streams expected instead of %v in test n°%v", v.expected, max, i)
+			}
+			if maxID != largest+protocol.QuicStreamID(2*v.expected) {
+				t.Errorf("Session : the peer can open %v streams in test n°%v", int(maxID-largest)/2, i)
+			}
+		}
+		client.Close(nil)
+		server.Close(nil)
+	}
+}
+
+func Test_Session_MaxStreams(t *testing.T) {
+	client, server := newTestSessions(t, 2, nil)
+	defer client.Close(nil)
+	defer server.Close(nil)
+
+	streams := make([]Stream, 2)
+	for i := range streams {
+		s, err := client.OpenStream()
+		if err != nil {
+			t.Fatalf("Session.OpenStream : unexpected error %v in test n°%v", err, i)
+		}
+		s.Write([]byte{byte(i)})
+		streams[i] = s
+	}
+
+	// The third stream waits for a free slot
+	opened := make(chan Stream, 1)
+	go func() {
+		s, err := client.OpenStream()
+		if err != nil {
+			t.Errorf("Session.OpenStream : unexpected error %v", err)
+		}
+		opened <- s
+	}()
+	select {
+	case <-opened:
+		t.Fatalf("Session.OpenStream : must wait for a free stream slot")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The first stream is closed in both directions
+	streams[0].Close()
+	a, err := server.AcceptStream(context.Background())
+	if err != nil {
+		t.Fatalf("Session.AcceptStream : unexpected error %v", err)
+	}
+	if data, err := ioutil.ReadAll(a); err != nil || len(data) != 1 {
+		t.Errorf("Stream.Read : 1 byte expected instead of %v (%v)", len(data), err)
+	}
+	a.Close()
+	if _, err := ioutil.ReadAll(streams[0]); err != nil {
+		t.Errorf("Stream.Read : unexpected error %v", err)
+	}
+	select {
+	case s := <-opened:
+		if s == nil || s.GetStreamID() != 9 {
+			t.Errorf("Session.OpenStream : stream 9 expected")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Session.OpenStream : a stream slot must be freed")
+	}
+}
+
+func Test_Session_MaxIncomingStreams(t *testing.T) {
+	// The MaxIncomingStreams of the server is the MSPC, a client that ignores it closes the connection
+	client, server := newTestSessionsWithConfig(t, 0, nil, nil, &Config{MaxIncomingStreams: 2})
+	defer server.Close(nil)
+	client.mutex.Lock()
+	max := client.maxOpenStreams
+	client.maxOpenStreams = 10
+	client.mutex.Unlock()
+	if max != 2 {
+		t.Errorf("Session : the MSPC must be MaxIncomingStreams instead of %v", max)
+	}
+	for i := 0; i < 3; i++ {
+		s, err := client.OpenStream()
+		if err != nil {
+			t.Fatalf("Session.OpenStream : unexpected error %v in test n°%v", err, i)
+		}
+		s.Write([]byte{byte(i)})
+	}
+	if n := client.NumActiveStreams(); n != 3 {
+		t.Errorf("Session.NumActiveStreams : 3 streams expected instead of %v", n)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var cerr Error
+	if _, err := client.AcceptStream(ctx); !errors.As(err, &cerr) || !cerr.Remote || cerr.ErrorCode != protocol.QUIC_TOO_MANY_OPEN_STREAMS {
+		t.Errorf("Session : QUIC_TOO_MANY_OPEN_STREAMS expected instead of %v", err)
+	}
+	client.Close(nil)
+
+	// The streams reset before AcceptStream keep their slot until the accept queue is drained below half of the limit
+	client, server = newTestSessionsWithConfig(t, 0, nil, nil, &Config{MaxIncomingStreams: 4})
+	defer client.Close(nil)
+	defer server.Close(nil)
+	streams := make([]Stream, 4)
+	for i := range streams {
+		s, err := client.OpenStream()
+		if err != nil {
+			t.Fatalf("Session.OpenStream : unexpected error %v in test n°%v", err, i)
+		}
+		s.Write([]byte{byte(i)})
+		streams[i] = s
+	}
+	for deadline := time.Now().Add(5 * time.Second); server.NumActiveStreams() < 4 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	for _, s := range streams {
+		s.Reset(protocol.QUIC_CONNECTION_CANCELLED)
+	}
+	opened := make(chan Stream, 1)
+	go func() {
+		s, _ := client.OpenStreamSync(ctx)
+		opened <- s
+	}()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-opened:
+			t.Fatalf("Session.OpenStream : the slots must be kept until the accept queue is drained in test n°%v", i)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if n := server.NumActiveStreams(); n != 0 {
+			t.Errorf("Session.NumActiveStreams : the streams reset are finished instead of %v in test n°%v", n, i)
+		}
+		if _, err := server.AcceptStream(ctx); err != nil {
+			t.Fatalf("Session.AcceptStream : unexpected error %v in test n°%v", err, i)
+		}
+	}
+	if s := <-opened; s == nil {
+		t.Errorf("Session.OpenStream : a stream slot must be freed once the accept queue is drained")
+	}
+}
+
+func Test_Session_Close(t *testing.T) {
+	client, server := newTestSessions(t, DEFAULT_MAX_STREAMS, nil)
+	defer server.Close(nil)
+
+	s, err := client.OpenStream()
+	if err != nil {
+		t.Fatalf("Session.OpenStream : unexpected error %v", err)
+	}
+	s.Write([]byte("x"))
+	a, err := server.AcceptStream(context.Background())
+	if err != nil {
+		t.Fatalf("Session.AcceptStream : unexpected error %v", err)
+	}
+
+	// Pending calls of the peer return the CONNECTION_CLOSE error
+	accepted := make(chan error, 1)
+	go func() {
+		_, err := server.AcceptStream(context.Background())
+		accepted <- err
+	}()
+	client.Close(Error{ErrorCode: protocol.QUIC_PEER_GOING_AWAY, ReasonPhrase: "bye"})
+
+	select {
+	case err = <-accepted:
+		var cerr Error
+		if !errors.As(err, &cerr) || !cerr.Remote || cerr.ErrorCode != protocol.QUIC_PEER_GOING_AWAY || cerr.ReasonPhrase != "bye" {
+			t.Errorf("Session.AcceptStream : remote CONNECTION_CLOSE expected instead of %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Session.AcceptStream : must return after the CONNECTION_CLOSE")
+	}
+	a.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = ioutil.ReadAll(a); err == nil {
+		t.Errorf("Stream.Read : the stream must be aborted")
+	}
+
+	// Local calls after Close return the local Error
+	var cerr Error
+	if _, err = client.OpenStream(); !errors.As(err, &cerr) || cerr.Remote || cerr.ErrorCode != protocol.QUIC_PEER_GOING_AWAY {
+		t.Errorf("Session.OpenStream : local Error expected after Close instead of %v", err)
+	}
+	if _, err = s.Write([]byte("x")); !errors.As(err, &cerr) || cerr.Remote {
+		t.Errorf("Stream.Write : local Error expected after Close instead of %v", err)
+	}
+	if errorCode(nil) != protocol.QUIC_NO_ERROR || errorCode(errors.New("x")) != protocol.QUIC_INTERNAL_ERROR {
+		t.Errorf("errorCode : invalid error codes")
+	}
+
+	// The key material is zeroed once the session is closed
+	<-client.runDone
+	if _, err = client.sealer.Seal(1, make([]byte, 64), nil, []byte("x")); err != crypto.ErrCipherClosed {
+		t.Errorf("AEAD.Seal : ErrCipherClosed expected after Close instead of %v", err)
+	}
+}
+
+var tests_closeerrors = []struct {
+	err      error
+	target   error
+	expected bool
+}{
+	{nil, ErrSessionClosed, true},
+	{Error{ErrorCode: protocol.QUIC_NO_ERROR, Remote: true}, ErrSessionClosed, false},
+	{Error{ErrorCode: protocol.QUIC_NETWORK_IDLE_TIMEOUT}, ErrIdleTimeout, true},
+	{Error{ErrorCode: protocol.QUIC_NETWORK_IDLE_TIMEOUT, Remote: true}, ErrIdleTimeout, true},
+	{Error{ErrorCode: protocol.QUIC_HANDSHAKE_TIMEOUT}, ErrHandshakeTimeout, true},
+	{Error{ErrorCode: protocol.QUIC_HANDSHAKE_TIMEOUT}, ErrIdleTimeout, false},
+	{handshake.ErrNoApplicationProtocol, ErrNoApplicationProtocol, true},
+	{Error{ErrorCode: protocol.QUIC_CRYPTO_MESSAGE_PARAMETER_NO_OVERLAP, ReasonPhrase: "no common AEAD", Remote: true}, ErrNoApplicationProtocol, false},
+	{io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, true},
+	{stream.StreamResetError{StreamID: 5, ErrorCode: protocol.QUIC_CONNECTION_CANCELLED}, ErrStreamReset, true},
+}
+
+func Test_Session_CloseError(t *testing.T) {
+	for i, v := range tests_closeerrors {
+		err := closeError(v.err)
+		if _, ok := err.(Error); !ok {
+			t.Errorf("closeError : Error expected instead of %T in test n°%v", err, i)
+		}
+		if errors.Is(err, v.target) != v.expected {
+			t.Errorf("errors.Is : %v expected for %v and %v in test n°%v", v.expected, err, v.target, i)
+		}
+	}
+}
+
+// rawFrame is a frame of arbitrary bytes, to send malformed frames.
+type rawFrame []byte
+
+func (this rawFrame) GetSerializedSize() int {
+	return len(this)
+}
+
+func (this rawFrame) Write(b []byte) (int, error) {
+	return copy(b, this), nil
+}
+
+var tests_malformedframes = []struct {
+	frames []protocol.Frame
+	code   protocol.QuicErrorCode
+}{
+	{[]protocol.Frame{rawFrame{0x1f}}, protocol.QUIC_INVALID_FRAME_DATA},
+	{[]protocol.Frame{rawFrame{0xa0, 0x05, 0xff, 0xff}}, protocol.QUIC_INVALID_STREAM_DATA},
+	{[]protocol.Frame{rawFrame{0x50, 0x01, 0x00, 0x00, 0x01, 0x00}}, protocol.QUIC_INVALID_ACK_DATA},
+	{[]protocol.Frame{rawFrame{0x40, 0x01, 0x00, 0x00, 0x01, 0x00, 0x40, 0x01, 0x00, 0x00, 0x01, 0x00}}, protocol.QUIC_INVALID_ACK_DATA},
+	{[]protocol.Frame{rawFrame{0x02, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff}}, protocol.QUIC_INVALID_CONNECTION_CLOSE_DATA},
+	{[]protocol.Frame{rawFrame{0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xff}}, protocol.QUIC_INVALID_GOAWAY_DATA},
+	{[]protocol.Frame{&protocol.AckFrame{LargestAcked: 1000, Ranges: []protocol.AckRange{{Smallest: 1000, Largest: 1000}}}}, protocol.QUIC_INVALID_ACK_DATA},
+	{[]protocol.Frame{&protocol.StreamFrame{StreamID: 5, Data: []byte("abc"), FIN: true},
+		&protocol.StreamFrame{StreamID: 5, Offset: 10, Data: []byte("x")}}, protocol.QUIC_INVALID_STREAM_DATA},
+	{[]protocol.Frame{&protocol.RstStreamFrame{StreamID: protocol.QUIC_CRYPTO_STREAM_ID}}, protocol.QUIC_INVALID_RST_STREAM_DATA},
+	{[]protocol.Frame{&protocol.StreamFrame{StreamID: 5, Data: make([]byte, 10)},
+		&protocol.RstStreamFrame{StreamID: 5, ByteOffset: 5}}, protocol.QUIC_INVALID_RST_STREAM_DATA},
+	{[]protocol.Frame{&protocol.GoawayFrame{LastGoodStreamID: 5}}, protocol.QUIC_INVALID_GOAWAY_DATA},
+}
+
+func Test_Session_MalformedFrames(t *testing.T) {
+	for i, v := range tests_malformedframes {
+		client, server := newTestSessions(t, DEFAULT_MAX_STREAMS, nil)
+
+		// The pending call of the client returns the CONNECTION_CLOSE of the server
+		accepted := make(chan error, 1)
+		go func() {
+			_, err := client.AcceptStream(context.Background())
+			accepted <- err
+		}()
+		for _, f := range v.frames {
+			client.QueueControlFrame(f)
+		}
+		var cerr Error
+		select {
+		case err := <-accepted:
+			if !errors.As(err, &cerr) || !cerr.Remote || cerr.ErrorCode != v.code {
+				t.Errorf("Session.AcceptStream : remote CONNECTION_CLOSE with %v expected instead of %v in test n°%v", v.code, err, i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Session.AcceptStream : must return after the CONNECTION_CLOSE in test n°%v", i)
+		}
+		<-server.runDone
+		if _, err := server.OpenStream(); !errors.As(err, &cerr) || cerr.Remote || cerr.ErrorCode != v.code {
+			t.Errorf("Session.OpenStream : local Error with %v expected instead of %v in test n°%v", v.code, err, i)
+		}
+		client.Close(nil)
+	}
+}
+
+func Test_Session_Context(t *testing.T) {
+	client, server := newTestSessions(t, 1, nil)
+	defer client.Close(nil)
+	defer server.Close(nil)
+
+	// AcceptStream waits until the end of the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := server.AcceptStream(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Session.AcceptStream : context.DeadlineExceeded expected instead of %v", err)
+	} else if cerr, ok := err.(protocol.ContextError); !ok || !cerr.Timeout() {
+		t.Errorf("Session.AcceptStream : protocol.ContextError expected instead of %v", err)
+	}
+
+	// OpenStreamSync waits for a free stream slot until the context is cancelled
+	if _, err := client.OpenStreamSync(context.Background()); err != nil {
+		t.Fatalf("Session.OpenStreamSync : unexpected error %v", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	opened := make(chan error, 1)
+	go func() {
+		_, err := client.OpenStreamSync(ctx)
+		opened <- err
+	}()
+	time.AfterFunc(50*time.Millisecond, cancel)
+	select {
+	case err := <-opened:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Session.OpenStreamSync : context.Canceled expected instead of %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Session.OpenStreamSync : must return when the context is cancelled")
+	}
+}
+
+func Test_Session_IdleTimeout(t *testing.T) {
+	var tests_idle = []struct {
+		client    *Config
+		server    *Config
+		keepAlive bool
+	}{
+		// The smallest idle timeout closes both sessions
+		{&Config{IdleTimeout: time.Second}, &Config{IdleTimeout: time.Minute}, false},
+		{&Config{IdleTimeout: time.Minute}, &Config{IdleTimeout: time.Second}, false},
+		// The keep-alive PING keeps both sessions open
+		{&Config{IdleTimeout: time.Second, KeepAlive: true}, &Config{IdleTimeout: time.Minute}, true},
+	}
+	for i, v := range tests_idle {
+		clock := testutil.NewClock(time.Now())
+		v.client.Clock, v.server.Clock = clock, clock
+		client, server := newTestSessionsWithConfig(t, DEFAULT_MAX_STREAMS, nil, v.client, v.server)
+		stop := clock.Run(10 * time.Millisecond)
+		for _, s := range []*session{client, server} {
+			select {
+			case <-s.runDone:
+				if v.keepAlive {
+					t.Errorf("Session : the keep-alive must prevent the idle timeout in test n°%v", i)
+				} else if !errors.Is(s.closeErr, ErrIdleTimeout) {
+					t.Errorf("Session : ErrIdleTimeout expected instead of %v in test n°%v", s.closeErr, i)
+				}
+			case <-clock.After(2500 * time.Millisecond):
+				if !v.keepAlive {
+					t.Errorf("Session : the idle timeout must close the session in test n°%v", i)
+				}
+			}
+		}
+		stop()
+		client.Close(nil)
+		server.Close(nil)
+	}
+}
+
+func Test_Session_CloseGracefully(t *testing.T) {
+	var tests_graceful = []struct {
+		timeout time.Duration
+		finish  time.Duration
+		err     error
+	}{
+		// The stream finishes just before the timeout
+		{400 * time.Millisecond, 200 * time.Millisecond, nil},
+		// The stream finishes just after the timeout
+		{200 * time.Millisecond, 400 * time.Millisecond, ErrCloseTimeout},
+	}
+	for i, v := range tests_graceful {
+		clock := testutil.NewClock(time.Now())
+		client, server := newTestSessionsWithConfig(t, DEFAULT_MAX_STREAMS, nil, &Config{Clock: clock}, &Config{Clock: clock})
+		stop := clock.Run(time.Millisecond)
+		s, err := client.OpenStream()
+		if err != nil {
+			t.Fatalf("Session.OpenStream : unexpected error %v in test n°%v", err, i)
+		}
+		s.Write([]byte("a"))
+		a, err := server.AcceptStream(context.Background())
+		if err != nil {
+			t.Fatalf("Session.AcceptStream : unexpected error %v in test n°%v", err, i)
+		}
+
+		closed := make(chan error, 1)
+		start := clock.Now()
+		go func() {
+			closed <- client.CloseGracefully(v.timeout)
+		}()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			server.mutex.Lock()
+			goaway := server.goawayReceived
+			server.mutex.Unlock()
+			if goaway {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Session.CloseGracefully : GOAWAY expected in test n°%v", i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		// The peer can't open new streams, but the open stream keeps working
+		if _, err = server.OpenStream(); err != ErrGoAway {
+			t.Errorf("Session.OpenStream : ErrGoAway expected instead of %v in test n°%v", err, i)
+		}
+		if _, err = client.OpenStream(); err != ErrGoAway {
+			t.Errorf("Session.OpenStream : ErrGoAway expected instead of %v in test n°%v", err, i)
+		}
+		<-clock.After(v.finish - clock.Now().Sub(start))
+		a.Write([]byte("b"))
+		a.Close()
+		s.SetReadDeadline(time.Now().Add(5 * time.Second))
+		data, err := ioutil.ReadAll(s)
+		s.Close()
+		if v.err == nil && (err != nil || string(data) != "b") {
+			t.Errorf("Stream.Read : \"b\" expected instead of %q (%v) in test n°%v", data, err, i)
+		}
+		if v.err != nil && err == nil {
+			t.Errorf("Stream.Read : the stream must be aborted after the timeout in test n°%v", i)
+		}
+
+		select {
+		case err = <-closed:
+			if err != v.err {
+				t.Errorf("Session.CloseGracefully : %v expected instead of %v in test n°%v", v.err, err, i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Session.CloseGracefully : must return in test n°%v", i)
+		}
+
+		// The peer is closed by the CONNECTION_CLOSE frame
+		select {
+		case <-server.runDone:
+			if cerr, ok := server.closeErr.(Error); !ok || !cerr.Remote {
+				t.Errorf("Session : remote CONNECTION_CLOSE expected instead of %v in test n°%v", server.closeErr, i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Session : the peer must be closed in test n°%v", i)
+		}
+		stop()
+	}
+}
+
+func Test_Session_CloseLinger(t *testing.T) {
+	clock := testutil.NewClock(time.Now())
+	client, server := newTestSessionsWithConfig(t, DEFAULT_MAX_STREAMS, nil, &Config{Clock: clock}, &Config{Clock: clock})
+	defer server.Close(nil)
+	conn := client.conn.(*testConn)
+
+	// Without streams, CloseGracefully closes the session at once
+	if err := client.CloseGracefully(time.Minute); err != nil {
+		t.Fatalf("Session.CloseGracefully : unexpected error %v", err)
+	}
+	<-client.runDone
+
+	// The CONNECTION_CLOSE packet is sent again to the late packets of the peer, to the 1st, 2nd, 4th... only
+	conn.mutex.Lock()
+	sent := conn.sent
+	conn.mutex.Unlock()
+	var tests_linger = []struct {
+		advance time.Duration
+		resent  bool
+		closed  bool
+	}{
+		{0, true, false},
+		{CONNECTION_CLOSE_LINGER*client.sentPacketHandler.GetRetransmissionTimeout() - time.Millisecond, true, false},
+		{time.Millisecond, true, true},
+	}
+	for i, v := range tests_linger {
+		clock.Advance(v.advance)
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			conn.mutex.Lock()
+			resent, closed := conn.sent > sent, conn.closed
+			conn.mutex.Unlock()
+			if resent == v.resent && closed == v.closed {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Session : CONNECTION_CLOSE sent again %v and connection closed %v expected in test n°%v", v.resent, v.closed, i)
+			}
+			client.handleDatagram([]byte("late packet"), nil, packetconn.ECN_NOT_ECT, clock.Now())
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func Test_Session_ZeroRTT(t *testing.T) {
+	// A first connection gives the server config, the source-address token and the certificates to cache
+	serverConfig := testServerConfig(t, nil)
+	client, server := newTestSessionsWithConfig(t, DEFAULT_MAX_STREAMS, nil, nil, serverConfig)
+	cached := client.cryptoSetup.(*handshake.CryptoClient).GetSessionState()
+	client.Close(nil)
+	server.Close(nil)
+
+	// The 0-RTT data is accepted with the full CHLO, or sent again with the keys of the second full CHLO after the REJ
+	// of an invalid source-address token
+	var tests_zerortt = []struct {
+		stk   []byte
+		chlos int
+	}{
+		{cached.SourceAddressToken, 1},
+		{make([]byte, len(cached.SourceAddressToken)), 2},
+	}
+	for i, v := range tests_zerortt {
+		client, server := connectTestSessions(t, DEFAULT_MAX_STREAMS, nil, &Config{AllowZeroRTT: true}, serverConfig)
+		cryptoClient := client.cryptoSetup.(*handshake.CryptoClient)
+		state := *cached
+		state.SourceAddressToken = v.stk
+		cryptoClient.SetSessionState(&state)
+		if state := client.HandshakeState(); state != HANDSHAKE_STARTED {
+			t.Errorf("Session.HandshakeState : HANDSHAKE_STARTED expected instead of %v in test n°%v", state, i)
+		}
+		client.start()
+		server.start()
+		s, err := client.OpenStream()
+		if err != nil {
+			t.Fatalf("Session.OpenStream : unexpected error %v in test n°%v", err, i)
+		}
+		s.Write([]byte("0-RTT data"))
+		s.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		a, err := server.AcceptStream(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("Session.AcceptStream : unexpected error %v in test n°%v", err, i)
+		}
+		if data, err := ioutil.ReadAll(a); err != nil || string(data) != "0-RTT data" {
+			t.Errorf("Stream.Read : '0-RTT data' expected instead of %q (%v) in test n°%v", data, err, i)
+		}
+		if err = client.waitForEncryptionLevel(context.Background(), protocol.ENCRYPTION_FORWARD_SECURE); err != nil {
+			t.Fatalf("Session : crypto handshake failed with %v in test n°%v", err, i)
+		}
+		if n := cryptoClient.GetClientHellosSent(); n != v.chlos {
+			t.Errorf("CryptoClient : %v CHLO expected instead of %v in test n°%v", v.chlos, n, i)
+		}
+		if state := client.HandshakeState(); state != HANDSHAKE_FORWARD_SECURE {
+			t.Errorf("Session.HandshakeState : HANDSHAKE_FORWARD_SECURE expected instead of %v in test n°%v", state, i)
+		}
+		client.Close(nil)
+		server.Close(nil)
+	}
+}
+
+func Test_Session_DiversificationNonce(t *testing.T) {
+	// The initial packets of the server carry the diversification nonce, they are delivered after the forward-secure data
+	client, server := connectTestSessions(t, DEFAULT_MAX_STREAMS, nil, nil, nil)
+	defer client.Close(nil)
+	defer server.Close(nil)
+	serverConn := server.conn.(*testConn)
+	serverConn.hold = func(b []byte) bool {
+		return b[0]&protocol.QUICFLAG_DIVERSIFICATION_NONCE != 0
+	}
+	client.start()
+	server.start()
+	if err := server.waitForEncryptionLevel(context.Background(), protocol.ENCRYPTION_FORWARD_SECURE); err != nil {
+		t.Fatalf("Session : crypto handshake failed with %v", err)
+	}
+	s, err := server.OpenStream()
+	if err != nil {
+		t.Fatalf("Session.OpenStream : unexpected error %v", err)
+	}
+	s.Write([]byte("before the nonce"))
+	s.Close()
+
+	// The client can't open the data packets before the nonce
+	time.Sleep(50 * time.Millisecond)
+	if state := client.HandshakeState(); state == HANDSHAKE_FORWARD_SECURE {
+		t.Errorf("Session.HandshakeState : the client can't have the forward-secure keys before the SHLO")
+	}
+	serverConn.mutex.Lock()
+	held := len(serverConn.held)
+	serverConn.mutex.Unlock()
+	if held == 0 {
+		t.Fatalf("testConn : the packets of the SHLO must carry the diversification nonce")
+	}
+
+	// The buffered data packets are opened once the SHLO is received
+	serverConn.release()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	a, err := client.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("Session.AcceptStream : unexpected error %v", err)
+	}
+	if data, err := ioutil.ReadAll(a); err != nil || string(data) != "before the nonce" {
+		t.Errorf("Stream.Read : 'before the nonce' expected instead of %q (%v)", data, err)
+	}
+}
+
+// receivedTracer records the sequence numbers of the packets opened by the session.
+type receivedTracer struct {
+	mutex    sync.Mutex
+	received []protocol.QuicPacketSequenceNumber
+}
+
+func (this *receivedTracer) SentPacket(seqnum protocol.QuicPacketSequenceNumber, level protocol.EncryptionLevel, size int, frames []protocol.Frame) {
+}
+
+func (this *receivedTracer) ReceivedPacket(seqnum protocol.QuicPacketSequenceNumber, level protocol.EncryptionLevel, size int, frames []protocol.Frame) {
+	this.mutex.Lock()
+	this.received = append(this.received, seqnum)
+	this.mutex.Unlock()
+}
+
+func (this *receivedTracer) LostPacket(seqnum protocol.QuicPacketSequenceNumber, level protocol.EncryptionLevel, size int) {
+}
+
+func (this *receivedTracer) UpdatedCongestionWindow(congestionWindow, bytesInFlight int) {
+}
+
+func (this *receivedTracer) UpdatedRTT(latest, smoothed, min, meanDeviation time.Duration) {
+}
+
+func (this *receivedTracer) UpdatedKeys(level protocol.EncryptionLevel) {
+}
+
+func (this *receivedTracer) ClosedConnection(err error) {
+}
+
+func Test_Session_ReplayedPackets(t *testing.T) {
+	tracer := new(receivedTracer)
+	serverConfig := &Config{Tracer: func(protocol.QuicConnectionID, protocol.Perspective) Tracer { return tracer }}
+	client, server := connectTestSessions(t, DEFAULT_MAX_STREAMS, nil, nil, serverConfig)
+	defer client.Close(nil)
+	defer server.Close(nil)
+
+	// The datagrams of the client are captured from the CHLO of the null AEAD on
+	var captured [][]byte
+	clientConn := client.conn.(*testConn)
+	clientConn.hold = func(b []byte) bool {
+		captured = append(captured, append([]byte(nil), b...))
+		return false
+	}
+	client.start()
+	server.start()
+	if err := client.waitForEncryptionLevel(context.Background(), protocol.ENCRYPTION_FORWARD_SECURE); err != nil {
+		t.Fatalf("Session : crypto handshake failed with %v", err)
+	}
+	for i, data := range []string{"hello", "again"} {
+		s, err := client.OpenStream()
+		if err != nil {
+			t.Fatalf("Session.OpenStream : unexpected error %v in test n°%v", err, i)
+		}
+		s.Write([]byte(data))
+		s.Close()
+		a, err := server.AcceptStream(context.Background())
+		if err != nil || a.GetStreamID() != s.GetStreamID() {
+			t.Fatalf("Session.AcceptStream : stream %v expected (%v) in test n°%v", s.GetStreamID(), err, i)
+		}
+		if received, err := ioutil.ReadAll(a); err != nil || string(received) != data {
+			t.Errorf("Stream.Read : %q expected instead of %q (%v) in test n°%v", data, received, err, i)
+		}
+		if i > 0 {
+			continue
+		}
+
+		// The replayed datagrams are dropped before the next stream
+		clientConn.mutex.Lock()
+		clientConn.hold = nil
+		replayed := captured
+		clientConn.mutex.Unlock()
+		for _, b := range replayed {
+			server.handleDatagram(b, clientConn.local, packetconn.ECN_NOT_ECT, server.config.Clock.Now())
+		}
+	}
+
+	// Each packet is opened once: the ACK frames don't list a replayed packet a second time
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+	opened := make(map[protocol.QuicPacketSequenceNumber]bool)
+	for _, seqnum := range tracer.received {
+		if opened[seqnum] {
+			t.Errorf("Session : packet %v opened twice", seqnum)
+		}
+		opened[seqnum] = true
+	}
+	if len(captured) == 0 {
+		t.Errorf("testConn : no datagram captured")
+	}
+}
+
+func Test_Session_GarbageDatagrams(t *testing.T) {
+	client, server := newTestSessions(t, DEFAULT_MAX_STREAMS, nil)
+	defer client.Close(nil)
+	defer server.Close(nil)
+
+	// During the transfer, each datagram is preceded by a bit-flipped copy, a truncated copy, a copy followed by trailing bytes
+	// and random garbage behind its Connection ID, in both directions: the copy followed by trailing bytes is opened in place
+	// of the datagram, the others are dropped
+	for i, s := range []*session{client, server} {
+		conn := s.conn.(*testConn)
+		peer := conn.peer
+		random := rand.New(rand.NewSource(int64(i)))
+		conn.mutex.Lock()
+		conn.hold = func(b []byte) bool {
+			flipped := append([]byte(nil), b...)
+			flipped[random.Intn(len(b))] ^= 1 << uint(random.Intn(8))
+			garbage := make([]byte, random.Intn(1200))
+			random.Read(garbage)
+			trailing := make([]byte, 1+random.Intn(protocol.MAX_TRAILING_BYTES))
+			random.Read(trailing)
+			trailing = append(append([]byte(nil), b...), trailing...)
+			for _, d := range [][]byte{flipped, append([]byte(nil), b[:len(b)/2]...), trailing, append(append([]byte(nil), b[:9]...), garbage...)} {
+				peer.handleDatagram(d, conn.local, packetconn.ECN_NOT_ECT, peer.config.Clock.Now())
+			}
+			return false
+		}
+		conn.mutex.Unlock()
+	}
+
+	data := make([]byte, 256*1024)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	st, err := client.OpenStream()
+	if err != nil {
+		t.Fatalf("Session.OpenStream : unexpected error %v", err)
+	}
+	go func() {
+		st.Write(data)
+		st.Close()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	a, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("Session.AcceptStream : unexpected error %v", err)
+	}
+	a.SetReadDeadline(time.Now().Add(20 * time.Second))
+	if received, err := ioutil.ReadAll(a); err != nil || !bytes.Equal(received, data) {
+		t.Fatalf("Stream.Read : %v bytes received instead of %v (%v)", len(received), len(data), err)
+	}
+
+	// The datagrams are dropped without closing the sessions
+	for i, s := range []*session{client, server} {
+		if dropped := s.Stats().PacketsDropped; dropped == 0 {
+			t.Errorf("Session.Stats : dropped packets expected in test n°%v", i)
+		}
+		if _, err := s.OpenStream(); err != nil {
+			t.Errorf("Session.OpenStream : unexpected error %v in test n°%v", err, i)
+		}
+	}
+}
+
+func Test_Session_ForgedUnencryptedPackets(t *testing.T) {
+	// The packets of the server are held from its first packet, the client stays unencrypted, or from the SHLO, the client
+	// stays at the initial keys
+	var tests_forged = []struct {
+		level protocol.EncryptionLevel
+		hold  func(b []byte) bool
+	}{
+		{protocol.ENCRYPTION_UNENCRYPTED, func(b []byte) bool { return true }},
+		{protocol.ENCRYPTION_INITIAL, func(b []byte) bool { return b[0]&protocol.QUICFLAG_DIVERSIFICATION_NONCE != 0 }},
+	}
+	for i, v := range tests_forged {
+		client, server := connectTestSessions(t, DEFAULT_MAX_STREAMS, nil, nil, nil)
+		conn := server.conn.(*testConn)
+		holding := false
+		conn.hold = func(b []byte) bool {
+			holding = holding || v.hold(b)
+			return holding
+		}
+		client.start()
+		server.start()
+		if err := client.waitForEncryptionLevel(context.Background(), v.level); err != nil {
+			t.Fatalf("Session : crypto handshake failed with %v in test n°%v", err, i)
+		}
+
+		// Unencrypted packets of a malformed frame and of stream data, after the sequence numbers of the REJ
+		packer := protocol.NewPacketPacker(0x1234, CONNECTION_ID_SIZE, MAX_PACKET_SIZE)
+		null := crypto.NewAEAD_NullFNV1A128()
+		for j := 0; j < 16; j++ {
+			packer.QueueControlFrame(&protocol.PingFrame{})
+			packer.PackPacket(null)
+		}
+		for _, f := range []protocol.Frame{rawFrame{0x1f}, &protocol.StreamFrame{StreamID: 2, Data: []byte("forged")}} {
+			packer.QueueControlFrame(f)
+			p, err := packer.PackPacket(null)
+			if err != nil {
+				t.Fatalf("PacketPacker.PackPacket : unexpected error %v in test n°%v", err, i)
+			}
+			client.handleDatagram(append([]byte(nil), p.Data...), conn.local, packetconn.ECN_NOT_ECT, time.Now())
+		}
+
+		// They are dropped, the handshake completes once the packets of the server are released
+		conn.release()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := client.waitForEncryptionLevel(ctx, protocol.ENCRYPTION_FORWARD_SECURE); err != nil {
+			t.Fatalf("Session : crypto handshake failed with %v after the forged packets in test n°%v", err, i)
+		}
+		cancel()
+		if dropped := client.Stats().PacketsDropped; dropped != 2 {
+			t.Errorf("Session.Stats : 2 dropped packets expected instead of %v in test n°%v", dropped, i)
+		}
+		client.Close(nil)
+		server.Close(nil)
+	}
+}
+
+var tests_ecn = []struct {
+	ecn     packetconn.ECN
+	reduced bool
+}{
+	{packetconn.ECN_NOT_ECT, false},
+	{packetconn.ECN_ECT0, false},
+	{packetconn.ECN_CE, true},
+}
+
+func Test_Session_ECN(t *testing.T) {
+	for i, v := range tests_ecn {
+		// The packets of the client reach the server with the ECN codepoint
+		client, server := connectTestSessions(t, DEFAULT_MAX_STREAMS, nil, nil, nil)
+		client.conn.(*testConn).ecn = v.ecn
+		client.start()
+		server.start()
+		s, err := client.OpenStream()
+		if err != nil {
+			t.Fatalf("Session.OpenStream : unexpected error %v in test n°%v", err, i)
+		}
+		s.Write([]byte("hello"))
+		s.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		a, err := server.AcceptStream(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("Session.AcceptStream : unexpected error %v in test n°%v", err, i)
+		}
+		a.Write([]byte("world"))
+		a.Close()
+		if b, err := ioutil.ReadAll(s); err != nil || string(b) != "world" {
+			t.Fatalf("Stream.Read : %q received (%v) in test n°%v", b, err, i)
+		}
+		client.Close(nil)
+		server.Close(nil)
+
+		// The marks are counted, and the Congestion Experienced marks reduce the congestion window
+		if server.Stats().ECNCounts[v.ecn] == 0 {
+			t.Errorf("Session : the packets received with ECN %v are not counted in test n°%v", v.ecn, i)
+		}
+		cwnd := server.sentPacketHandler.GetCongestionWindow()
+		if reduced := cwnd < congestion.INITIAL_CONGESTION_WINDOW*congestion.MAX_SEGMENT_SIZE; reduced != v.reduced {
+			t.Errorf("Session : congestion window of %v bytes in test n°%v", cwnd, i)
+		}
+	}
+}
+
+func Test_Session_ConcurrentStreams(t *testing.T) {
+	// 100 streams are read and written concurrently, some packets are lost: the retransmissions and the flow control run while the streams are read and written
+	var mutex sync.Mutex
+	sent := 0
+	drop := func(n int) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		sent++
+		return sent%50 == 0
+	}
+	client, server := newTestSessions(t, 100, drop)
+	defer client.Close(nil)
+	defer server.Close(nil)
+	go func() {
+		for {
+			s, err := server.AcceptStream(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(s, s)
+				s.Close()
+			}()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s, err := client.OpenStream()
+			if err != nil {
+				t.Errorf("Session.OpenStream : unexpected error %v in test n°%v", err, i)
+				return
+			}
+			s.SetDeadline(time.Now().Add(30 * time.Second))
+			data := make([]byte, 20000+i*100)
+			for j := range data {
+				data[j] = byte(i + j)
+			}
+			// One stream out of ten is reset halfway
+			reset := i%10 == 9
+			go func() {
+				for j := 0; j < len(data); j += 1000 + i {
+					if reset && j > len(data)/2 {
+						s.Reset(protocol.QUIC_PEER_GOING_AWAY)
+						return
+					}
+					end := j + 1000 + i
+					if end > len(data) {
+						end = len(data)
+					}
+					if _, err := s.Write(data[j:end]); err != nil {
+						t.Errorf("Stream.Write : unexpected error %v in test n°%v", err, i)
+						return
+					}
+				}
+				s.Close()
+			}()
+			echo, err := ioutil.ReadAll(s)
+			if reset && err == nil {
+				t.Errorf("Stream.Read : error expected after the reset in test n°%v", i)
+			}
+			if !reset && (err != nil || !bytes.Equal(echo, data)) {
+				t.Errorf("Stream.Read : %v bytes echoed instead of %v (%v) in test n°%v", len(echo), len(data), err, i)
+			}
+			client.HandshakeState()
+			client.RemoteAddr()
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,78 @@
+package quic
+
+import "sync/atomic"
+import "time"
+
+// Stats are the statistics of a Session since its creation.
+type Stats struct {
+	// PacketsSent and BytesSent count the packets written on the connection, with their headers
+	PacketsSent uint64
+	BytesSent   uint64
+	// PacketsReceived and BytesReceived count the packets opened, the duplicates and the undecryptable packets excepted
+	PacketsReceived uint64
+	BytesReceived   uint64
+	// PacketsDropped counts the datagrams of the session dropped because they can't be parsed, opened or verified:
+	// garbage, truncated or corrupted packets, and forged public resets or version negotiation packets. They don't close the session
+	PacketsDropped uint64
+	// PacketsLost counts the packets declared lost by the loss recovery
+	PacketsLost uint64
+	// Retransmissions counts the frames of the lost packets sent again
+	Retransmissions uint64
+	// SmoothedRTT and MinRTT are the RTT estimations of the loss recovery, zero before the first RTT sample
+	SmoothedRTT time.Duration
+	MinRTT      time.Duration
+	// CongestionWindow is the congestion window in bytes
+	CongestionWindow int
+	// StreamsOpened counts the streams opened by OpenStream, StreamsAccepted those returned by AcceptStream
+	StreamsOpened   uint64
+	StreamsAccepted uint64
+	// HandshakeDuration is the time from the creation of the session to the forward-secure keys, zero until then
+	HandshakeDuration time.Duration
+	// ZeroRTTAccepted is true once the stream data sent with the initial keys of the client is opened by the server:
+	// the client knows it at the forward-secure keys, when the server has not rejected its full CHLO
+	ZeroRTTAccepted bool
+	// ECNCounts count the packets received by ECN codepoint: Not-ECT, ECT(1), ECT(0) and CE
+	ECNCounts [4]uint64
+}
+
+// sessionStats are the counters of Stats: the run goroutine updates them, Session.Stats reads them from any goroutine.
+type sessionStats struct {
+	packetsSent       atomic.Uint64
+	bytesSent         atomic.Uint64
+	packetsReceived   atomic.Uint64
+	bytesReceived     atomic.Uint64
+	packetsDropped    atomic.Uint64
+	packetsLost       atomic.Uint64
+	retransmissions   atomic.Uint64
+	smoothedRTT       atomic.Int64
+	minRTT            atomic.Int64
+	congestionWindow  atomic.Int64
+	streamsOpened     atomic.Uint64
+	streamsAccepted   atomic.Uint64
+	handshakeDuration atomic.Int64
+	zeroRTTAccepted   atomic.Bool
+	ecnCounts         [4]atomic.Uint64
+}
+
+// load returns the Stats of the counters.
+func (this *sessionStats) load() Stats {
+	stats := Stats{
+		PacketsSent:       this.packetsSent.Load(),
+		BytesSent:         this.bytesSent.Load(),
+		PacketsReceived:   this.packetsReceived.Load(),
+		BytesReceived:     this.bytesReceived.Load(),
+		PacketsDropped:    this.packetsDropped.Load(),
+		PacketsLost:       this.packetsLost.Load(),
+		Retransmissions:   this.retransmissions.Load(),
+		SmoothedRTT:       time.Duration(this.smoothedRTT.Load()),
+		MinRTT:            time.Duration(this.minRTT.Load()),
+		CongestionWindow:  int(this.congestionWindow.Load()),
+		StreamsOpened:     this.streamsOpened.Load(),
+		StreamsAccepted:   this.streamsAccepted.Load(),
+		HandshakeDuration: time.Duration(this.handshakeDuration.Load()),
+		ZeroRTTAccepted:   this.zeroRTTAccepted.Load()}
+	for i := range this.ecnCounts {
+		stats.ECNCounts[i] = this.ecnCounts[i].Load()
+	}
+	return stats
+}
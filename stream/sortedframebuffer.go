@@ -0,0 +1,232 @@
+package stream
+
+import "github.com/romain-jacotin/quic/internal/bufferpool"
+import "github.com/romain-jacotin/quic/protocol"
+import "errors"
+
+// ErrDataAfterFIN is returned by Push when stream data goes beyond the final offset of the stream.
+var ErrDataAfterFIN = errors.New("SortedFrameBuffer.Push : stream data beyond the FIN offset")
+
+// ErrFINOffsetChanged is returned by Push when a FIN announces a final offset different from the previous one, or below the data received.
+var ErrFINOffsetChanged = errors.New("SortedFrameBuffer.Push : inconsistent FIN offset")
+
+// minRetainedChunkSize is the size of the smallest chunk that retains the packet buffer of its data, the smaller ones
+// are copied: the packet buffers retained hold less than 3 times the bytes buffered.
+const minRetainedChunkSize = 512
+
+// bufferedChunk is a contiguous part of the stream data waiting to be read, in the packet buffer retained if not nil.
+type bufferedChunk struct {
+	offset protocol.QuicByteOffset
+	data   []byte
+	buffer *bufferpool.Buffer
+}
+
+func (this *bufferedChunk) end() protocol.QuicByteOffset {
+	return this.offset + protocol.QuicByteOffset(len(this.data))
+}
+
+// SortedFrameBuffer reassembles the stream data of the STREAM frames received out of order and overlapping.
+//
+// The chunks are sorted by offset and never overlap: only the bytes not already buffered or read are kept, so the retransmissions
+// are not counted twice and the buffered bytes are bounded by the highest offset received, itself bounded by the flow control window.
+// The chunks of PushBuffer stay in the packet buffer of their data until they are read.
+type SortedFrameBuffer struct {
+	chunks        []bufferedChunk
+	readPosition  protocol.QuicByteOffset
+	highestOffset protocol.QuicByteOffset
+	bufferedBytes int
+	finOffset     protocol.QuicByteOffset
+	finReceived   bool
+}
+
+// NewSortedFrameBuffer returns an empty SortedFrameBuffer at the offset 0.
+func NewSortedFrameBuffer() *SortedFrameBuffer {
+	return new(SortedFrameBuffer)
+}
+
+// Push buffers the stream data at the offset, with the FIN flag of the frame. The data is copied.
+func (this *SortedFrameBuffer) Push(offset protocol.QuicByteOffset, data []byte, fin bool) error {
+	return this.PushBuffer(offset, data, fin, nil)
+}
+
+// PushBuffer buffers the stream data at the offset like Push, the data being in the pooled buffer of its packet if not nil:
+// the chunks of the data retain the buffer instead of copying it.
+func (this *SortedFrameBuffer) PushBuffer(offset protocol.QuicByteOffset, data []byte, fin bool, buffer *bufferpool.Buffer) error {
+	end := offset + protocol.QuicByteOffset(len(data))
+	if fin {
+		if (this.finReceived && end != this.finOffset) || end < this.highestOffset {
+			return ErrFINOffsetChanged
+		}
+		this.finReceived = true
+		this.finOffset = end
+	} else if this.finReceived && end > this.finOffset {
+		return ErrDataAfterFIN
+	}
+	if end > this.highestOffset {
+		this.highestOffset = end
+	}
+
+	cursor := offset
+	if cursor < this.readPosition {
+		cursor = this.readPosition
+	}
+	// The data in order goes after the last chunk
+	if n := len(this.chunks); n == 0 || this.chunks[n-1].end() <= cursor {
+		if cursor < end {
+			this.chunks = append(this.chunks, this.newChunk(offset, data, buffer, cursor, end))
+		}
+		return nil
+	}
+
+	// Insert the gaps between the buffered chunks covered by the data
+	chunks := make([]bufferedChunk, 0, len(this.chunks)+1)
+	for _, c := range this.chunks {
+		if cursor < end && cursor < c.offset {
+			chunks = append(chunks, this.newChunk(offset, data, buffer, cursor, minOffset(end, c.offset)))
+		}
+		if c.end() > cursor {
+			cursor = c.end()
+		}
+		chunks = append(chunks, c)
+	}
+	if cursor < end {
+		chunks = append(chunks, this.newChunk(offset, data, buffer, cursor, end))
+	}
+	this.chunks = chunks
+	return nil
+}
+
+// newChunk returns the chunk of the part [from, to) of the data at the offset, it retains the buffer of the data or copies it.
+func (this *SortedFrameBuffer) newChunk(offset protocol.QuicByteOffset, data []byte, buffer *bufferpool.Buffer,
+	from, to protocol.QuicByteOffset) bufferedChunk {
+	c := bufferedChunk{offset: from, data: data[from-offset : to-offset : to-offset]}
+	if buffer != nil && len(c.data) >= minRetainedChunkSize {
+		buffer.Retain()
+		c.buffer = buffer
+	} else {
+		c.data = append([]byte(nil), c.data...)
+	}
+	this.bufferedBytes += len(c.data)
+	return c
+}
+
+func minOffset(a, b protocol.QuicByteOffset) protocol.QuicByteOffset {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Read copies the contiguous stream data at the read position into p, and returns the number of bytes copied,
+// and true when the read position reaches the FIN offset.
+func (this *SortedFrameBuffer) Read(p []byte) (int, bool) {
+	n := 0
+	for n < len(p) && len(this.chunks) > 0 && this.chunks[0].offset == this.readPosition {
+		m := copy(p[n:], this.chunks[0].data)
+		this.Skip(m)
+		n += m
+	}
+	return n, this.atFIN()
+}
+
+// Peek returns the first chunk of data at the read position without consuming it, or nil, with its packet buffer retained
+// if the data is pooled: the data stays valid until the caller releases the buffer.
+func (this *SortedFrameBuffer) Peek() ([]byte, *bufferpool.Buffer) {
+	if len(this.chunks) == 0 || this.chunks[0].offset != this.readPosition {
+		return nil, nil
+	}
+	c := &this.chunks[0]
+	if c.buffer != nil {
+		c.buffer.Retain()
+	}
+	return c.data, c.buffer
+}
+
+// Skip consumes n bytes of the contiguous data at the read position, the chunks consumed release their packet buffer.
+func (this *SortedFrameBuffer) Skip(n int) {
+	for n > 0 && len(this.chunks) > 0 && this.chunks[0].offset == this.readPosition {
+		c := &this.chunks[0]
+		m := len(c.data)
+		if m > n {
+			m = n
+		}
+		c.data = c.data[m:]
+		c.offset += protocol.QuicByteOffset(m)
+		this.readPosition += protocol.QuicByteOffset(m)
+		this.bufferedBytes -= m
+		n -= m
+		// The chunks are shifted to keep the array of the slice
+		if len(c.data) == 0 {
+			c.buffer.Release()
+			last := copy(this.chunks, this.chunks[1:])
+			this.chunks[last] = bufferedChunk{}
+			this.chunks = this.chunks[:last]
+		}
+	}
+}
+
+// contiguousBytes returns the number of bytes of contiguous data at the read position.
+func (this *SortedFrameBuffer) contiguousBytes() int {
+	n := 0
+	for _, c := range this.chunks {
+		if c.offset != this.readPosition+protocol.QuicByteOffset(n) {
+			break
+		}
+		n += len(c.data)
+	}
+	return n
+}
+
+// Pop returns a copy of the next contiguous stream data at the read position, or nil if the data at the read position is missing,
+// and true when the read position reaches the FIN offset.
+func (this *SortedFrameBuffer) Pop() ([]byte, bool) {
+	var data []byte
+
+	if n := this.contiguousBytes(); n > 0 {
+		data = make([]byte, n)
+		this.Read(data)
+	}
+	return data, this.atFIN()
+}
+
+// Discard consumes the contiguous stream data at the read position without reading it, and returns the number of bytes
+// discarded, and true when the read position reaches the FIN offset.
+func (this *SortedFrameBuffer) Discard() (int, bool) {
+	n := this.contiguousBytes()
+	this.Skip(n)
+	return n, this.atFIN()
+}
+
+// Release drops the buffered data and releases its packet buffers, when the stream data won't be read.
+func (this *SortedFrameBuffer) Release() {
+	for i := range this.chunks {
+		this.chunks[i].buffer.Release()
+	}
+	this.chunks = nil
+	this.bufferedBytes = 0
+}
+
+// atFIN returns true when the read position reaches the FIN offset.
+func (this *SortedFrameBuffer) atFIN() bool {
+	return this.finReceived && this.readPosition == this.finOffset
+}
+
+// HasData returns true if Pop returns data or the FIN.
+func (this *SortedFrameBuffer) HasData() bool {
+	return (len(this.chunks) > 0 && this.chunks[0].offset == this.readPosition) || this.atFIN()
+}
+
+// GetReadPosition returns the offset of the next stream data delivered by Pop.
+func (this *SortedFrameBuffer) GetReadPosition() protocol.QuicByteOffset {
+	return this.readPosition
+}
+
+// GetBufferedBytes returns the number of bytes buffered and not popped.
+func (this *SortedFrameBuffer) GetBufferedBytes() int {
+	return this.bufferedBytes
+}
+
+// GetFINOffset returns the final offset of the stream, and false if the FIN is not received.
+func (this *SortedFrameBuffer) GetFINOffset() (protocol.QuicByteOffset, bool) {
+	return this.finOffset, this.finReceived
+}
@@ -0,0 +1,261 @@
+package stream
+
+import "github.com/romain-jacotin/quic/internal/bufferpool"
+import "github.com/romain-jacotin/quic/protocol"
+import "bytes"
+import "math/rand"
+import "testing"
+
+// testStreamData returns the stream data where each byte is its offset.
+func testStreamData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	return data
+}
+
+type testPush struct {
+	offset int
+	size   int
+	fin    bool
+}
+
+var tests_sortedframebuffer = []struct {
+	pushes   []testPush
+	popped   int // contiguous bytes popped after the pushes
+	buffered int // bytes still buffered
+	fin      bool
+}{
+	// In order
+	{[]testPush{{0, 10, false}, {10, 10, true}}, 20, 0, true},
+	// Out of order with a gap
+	{[]testPush{{10, 10, false}, {30, 10, false}}, 0, 20, false},
+	{[]testPush{{10, 10, false}, {0, 10, false}, {30, 10, false}}, 20, 10, false},
+	// Overlapping frames
+	{[]testPush{{0, 10, false}, {5, 10, false}, {12, 10, false}}, 22, 0, false},
+	{[]testPush{{5, 10, false}, {0, 10, false}}, 15, 0, false},
+	// Frame entirely contained in a buffered one, and frame covering several buffered ones
+	{[]testPush{{10, 20, false}, {15, 5, false}}, 0, 20, false},
+	{[]testPush{{10, 5, false}, {20, 5, false}, {5, 30, false}}, 0, 30, false},
+	// Duplicate retransmissions
+	{[]testPush{{10, 10, false}, {10, 10, false}, {10, 10, false}}, 0, 10, false},
+	// FIN before earlier data
+	{[]testPush{{20, 10, true}, {0, 10, false}}, 10, 10, false},
+	{[]testPush{{20, 10, true}, {0, 10, false}, {10, 10, false}}, 30, 0, true},
+	// Empty FIN frame
+	{[]testPush{{0, 10, false}, {10, 0, true}}, 10, 0, true},
+	{[]testPush{{0, 0, true}}, 0, 0, true},
+}
+
+func Test_SortedFrameBuffer(t *testing.T) {
+	data := testStreamData(64)
+	for i, v := range tests_sortedframebuffer {
+		b := NewSortedFrameBuffer()
+		for _, p := range v.pushes {
+			if err := b.Push(protocol.QuicByteOffset(p.offset), data[p.offset:p.offset+p.size], p.fin); err != nil {
+				t.Fatalf("SortedFrameBuffer.Push : unexpected error %v in test n°%v", err, i)
+			}
+		}
+		var popped []byte
+		fin := false
+		for b.HasData() {
+			var d []byte
+			d, fin = b.Pop()
+			popped = append(popped, d...)
+			if fin {
+				break
+			}
+		}
+		if len(popped) != v.popped || !bytes.Equal(popped, data[:v.popped]) || b.GetBufferedBytes() != v.buffered || fin != v.fin {
+			t.Errorf("SortedFrameBuffer.Pop : %v bytes popped, %v buffered and FIN %v in test n°%v", len(popped), b.GetBufferedBytes(), fin, i)
+		}
+	}
+}
+
+func Test_SortedFrameBuffer_Errors(t *testing.T) {
+	data := testStreamData(64)
+	b := NewSortedFrameBuffer()
+	b.Push(0, data[:10], false)
+	b.Push(20, data[20:30], true)
+	if err := b.Push(25, data[25:35], false); err != ErrDataAfterFIN {
+		t.Errorf("SortedFrameBuffer.Push : ErrDataAfterFIN expected instead of %v", err)
+	}
+	if err := b.Push(20, data[20:25], true); err != ErrFINOffsetChanged {
+		t.Errorf("SortedFrameBuffer.Push : ErrFINOffsetChanged expected instead of %v", err)
+	}
+	if err := b.Push(20, data[20:30], true); err != nil {
+		t.Errorf("SortedFrameBuffer.Push : retransmission of the FIN frame must be accepted : %v", err)
+	}
+	b = NewSortedFrameBuffer()
+	b.Push(20, data[20:30], false)
+	if err := b.Push(0, data[:10], true); err != ErrFINOffsetChanged {
+		t.Errorf("SortedFrameBuffer.Push : FIN below the data received must be rejected instead of %v", err)
+	}
+
+	// Data already read is ignored
+	b = NewSortedFrameBuffer()
+	b.Push(0, data[:10], false)
+	b.Pop()
+	b.Push(0, data[:15], false)
+	if d, _ := b.Pop(); !bytes.Equal(d, data[10:15]) || b.GetReadPosition() != 15 {
+		t.Errorf("SortedFrameBuffer.Pop : data from offset 10 expected instead of %v", d)
+	}
+
+	// The data is copied
+	frame := []byte{1, 2, 3}
+	b.Push(15, frame, false)
+	frame[0] = 0xff
+	if d, _ := b.Pop(); !bytes.Equal(d, []byte{1, 2, 3}) {
+		t.Error("SortedFrameBuffer.Push : the data must be copied")
+	}
+}
+
+// Test_SortedFrameBuffer_Permutations pushes random overlapping frames in random orders:
+// the popped data is the stream, and the buffered bytes never exceed the distinct bytes received.
+func Test_SortedFrameBuffer_Permutations(t *testing.T) {
+	data := testStreamData(1000)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		var frames []testPush
+		for offset := 0; offset < len(data); {
+			size := 1 + r.Intn(50)
+			if offset+size > len(data) {
+				size = len(data) - offset
+			}
+			frames = append(frames, testPush{offset, size, offset+size == len(data)})
+			offset += size - r.Intn(size) // overlap with the next frame
+		}
+		// Retransmissions
+		for j := r.Intn(10); j > 0; j-- {
+			frames = append(frames, frames[r.Intn(len(frames))])
+		}
+		b := NewSortedFrameBuffer()
+		received := make([]bool, len(data))
+		var popped []byte
+		fin := false
+		for _, k := range r.Perm(len(frames)) {
+			f := frames[k]
+			if err := b.Push(protocol.QuicByteOffset(f.offset), data[f.offset:f.offset+f.size], f.fin); err != nil {
+				t.Fatalf("SortedFrameBuffer.Push : unexpected error %v in test n°%v", err, i)
+			}
+			for j := f.offset; j < f.offset+f.size; j++ {
+				received[j] = true
+			}
+			distinct := 0
+			for j := len(popped); j < len(data); j++ {
+				if received[j] {
+					distinct++
+				}
+			}
+			if b.GetBufferedBytes() != distinct {
+				t.Fatalf("SortedFrameBuffer.GetBufferedBytes : %v instead of %v in test n°%v", b.GetBufferedBytes(), distinct, i)
+			}
+			if r.Intn(2) == 0 {
+				d, f := b.Pop()
+				popped = append(popped, d...)
+				fin = fin || f
+			}
+		}
+		for !fin {
+			d, f := b.Pop()
+			if d == nil && !f {
+				t.Fatalf("SortedFrameBuffer.Pop : missing data at offset %v in test n°%v", b.GetReadPosition(), i)
+			}
+			popped = append(popped, d...)
+			fin = f
+		}
+		if !bytes.Equal(popped, data) {
+			t.Errorf("SortedFrameBuffer.Pop : invalid reassembled data in test n°%v", i)
+		}
+	}
+}
+
+// pushPooled pushes the frame of the data at the offset from a pooled buffer, released after the push like a packet.
+func pushPooled(b *SortedFrameBuffer, offset int, data []byte, fin bool) (*bufferpool.Buffer, error) {
+	buffer := bufferpool.GetBuffer(len(data))
+	copy(buffer.Data, data)
+	err := b.PushBuffer(protocol.QuicByteOffset(offset), buffer.Data, fin, buffer)
+	buffer.Release()
+	return buffer, err
+}
+
+func Test_SortedFrameBuffer_PushBuffer(t *testing.T) {
+	data := testStreamData(2000)
+
+	// The large chunks retain their packet buffer until they are read, the small chunks are copied
+	b := NewSortedFrameBuffer()
+	large, _ := pushPooled(b, 100, data[100:1300], false)
+	small, _ := pushPooled(b, 0, data[:100], false)
+	if large.Data == nil || small.Data != nil || b.GetBufferedBytes() != 1300 {
+		t.Errorf("SortedFrameBuffer.PushBuffer : retained buffers %v and %v", large.Data != nil, small.Data != nil)
+	}
+	p := make([]byte, 700)
+	if n, fin := b.Read(p); n != 700 || fin || !bytes.Equal(p, data[:700]) || large.Data == nil {
+		t.Errorf("SortedFrameBuffer.Read : %v bytes read", n)
+	}
+	if n, _ := b.Read(p); n != 600 || !bytes.Equal(p[:n], data[700:1300]) || large.Data != nil || b.GetBufferedBytes() != 0 {
+		t.Errorf("SortedFrameBuffer.Read : the buffer must be released once its chunk is read")
+	}
+
+	// Peek retains the buffer for the caller, Skip consumes the data, Release drops the rest
+	b = NewSortedFrameBuffer()
+	large, _ = pushPooled(b, 0, data[:1200], false)
+	pushPooled(b, 1200, data[1200:2000], true)
+	d, buffer := b.Peek()
+	b.Skip(1200)
+	if buffer != large || !bytes.Equal(d, data[:1200]) || b.GetReadPosition() != 1200 || large.Data == nil {
+		t.Errorf("SortedFrameBuffer.Peek : the data must stay valid until the buffer is released")
+	}
+	buffer.Release()
+	if large.Data != nil {
+		t.Errorf("SortedFrameBuffer.Skip : the buffer must be released once its chunk is consumed")
+	}
+	d, buffer = b.Peek()
+	buffer.Release()
+	b.Release()
+	if buffer.Data != nil || len(d) != 800 || b.HasData() || b.GetBufferedBytes() != 0 {
+		t.Errorf("SortedFrameBuffer.Release : the buffered data must be dropped")
+	}
+
+	// Frames of several packets, overlapping, reordered and read with random sizes: a buffer released too early is reused
+	// by the next frame and corrupts the data
+	data = testStreamData(100000)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		var frames []testPush
+		for offset := 0; offset < len(data); {
+			size := 1 + r.Intn(bufferpool.BUFFER_SIZE)
+			if offset+size > len(data) {
+				size = len(data) - offset
+			}
+			frames = append(frames, testPush{offset, size, offset+size == len(data)})
+			offset += size - r.Intn(size/4+1)
+		}
+		b := NewSortedFrameBuffer()
+		var read []byte
+		fin := false
+		for _, k := range r.Perm(len(frames)) {
+			f := frames[k]
+			if _, err := pushPooled(b, f.offset, data[f.offset:f.offset+f.size], f.fin); err != nil {
+				t.Fatalf("SortedFrameBuffer.PushBuffer : unexpected error %v in test n°%v", err, i)
+			}
+			p := make([]byte, r.Intn(4000))
+			n, end := b.Read(p)
+			read = append(read, p[:n]...)
+			fin = fin || end
+		}
+		for !fin {
+			p := make([]byte, 4000)
+			n, f := b.Read(p)
+			if n == 0 && !f {
+				t.Fatalf("SortedFrameBuffer.Read : missing data at offset %v in test n°%v", b.GetReadPosition(), i)
+			}
+			read = append(read, p[:n]...)
+			fin = f
+		}
+		if !bytes.Equal(read, data) {
+			t.Errorf("SortedFrameBuffer.Read : invalid reassembled data in test n°%v", i)
+		}
+	}
+}
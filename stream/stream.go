@@ -0,0 +1,773 @@
+package stream
+
+import "github.com/romain-jacotin/quic/flowcontrol"
+import "github.com/romain-jacotin/quic/internal/bufferpool"
+import "github.com/romain-jacotin/quic/protocol"
+import "context"
+import "errors"
+import "fmt"
+import "io"
+import "os"
+import "sync"
+import "time"
+
+const (
+	// DEFAULT_STREAM_PRIORITY is the priority of a new stream
+	DEFAULT_STREAM_PRIORITY = 16
+	// MAX_STREAM_PRIORITY is the largest priority of a stream, the priorities are between 1 and MAX_STREAM_PRIORITY
+	MAX_STREAM_PRIORITY = 256
+	// DEFAULT_SEND_BUFFER_SIZE is the default size of the send buffer of a stream, Write blocks once it is full
+	DEFAULT_SEND_BUFFER_SIZE = 1 << 20
+)
+
+// ErrWriteClosed is returned by Write after Close or CloseWrite.
+var ErrWriteClosed = errors.New("Stream.Write : write side of the stream closed")
+
+// ErrWouldBlock is returned by TryWrite when the send buffer of the stream can't take all the data.
+var ErrWouldBlock = errors.New("Stream.TryWrite : send buffer full")
+
+// ErrReadClosed is returned by Read after CloseRead.
+var ErrReadClosed = errors.New("Stream.Read : read side of the stream closed")
+
+// ErrInvalidFinalOffset is returned by HandleRstStreamFrame when the final offset of the peer is below the data received.
+var ErrInvalidFinalOffset = errors.New("Stream.HandleRstStreamFrame : final offset below the data received")
+
+// ErrStreamReset matches the StreamResetError of any stream with errors.Is.
+var ErrStreamReset = errors.New("Stream : stream reset")
+
+// StreamResetError is returned by Read and Write after a RST_STREAM frame, sent by the peer if Remote is true, or by Reset.
+type StreamResetError struct {
+	StreamID  protocol.QuicStreamID
+	ErrorCode protocol.QuicErrorCode
+	Remote    bool
+}
+
+func (this StreamResetError) Error() string {
+	if this.Remote {
+		return fmt.Sprintf("Stream : stream %d reset by the peer with %v", this.StreamID, this.ErrorCode)
+	}
+	return fmt.Sprintf("Stream : stream %d reset with %v", this.StreamID, this.ErrorCode)
+}
+
+// Is returns true for ErrStreamReset.
+func (this StreamResetError) Is(target error) bool {
+	return target == ErrStreamReset
+}
+
+// StreamSender is the interface of the session used by a Stream to send its frames.
+type StreamSender interface {
+	// QueueControlFrame queues a RST_STREAM, WINDOW_UPDATE or BLOCKED frame of the stream, or the WINDOW_UPDATE frame of the connection
+	QueueControlFrame(f protocol.Frame)
+	// OnHasStreamData is called when the stream has data or a FIN to send, the session calls PopStreamFrame
+	OnHasStreamData(streamID protocol.QuicStreamID)
+	// OnStreamFinished is called when the reader finishes a stream whose FIN is sent, the session can forget the stream
+	OnStreamFinished(streamID protocol.QuicStreamID)
+}
+
+// Stream is a QUIC stream implementing io.ReadWriteCloser, with half-close, reset and deadlines like net.Conn.
+//
+// The session delivers the received frames with the Handle methods, and pulls the stream data to send with PopStreamFrame.
+// Write copies the data in the send buffer of the stream, and blocks while the buffer is full: the session empties it
+// within the stream and connection flow control windows, and keeps the frames sent until they are acknowledged.
+type Stream struct {
+	mutex          sync.Mutex
+	streamID       protocol.QuicStreamID
+	sender         StreamSender
+	flowController *flowcontrol.FlowController
+	clock          protocol.Clock
+	priority       int
+
+	// Read side
+	frameBuffer  *SortedFrameBuffer
+	finRead      bool
+	readClosed   bool
+	readDeadline time.Time
+	readSignal   chan struct{}
+	// resetErr aborts both sides of the stream, finalReceived is true once the FIN or the RST_STREAM frame of the peer
+	// has given the final offset of the data received
+	resetErr      error
+	resetReceived bool
+	finalReceived bool
+	connClosed    bool
+
+	// Write side, dataForWrite is the send buffer of the data not sent yet, writeErr aborts the write side only
+	writeErr       error
+	writeOffset    protocol.QuicByteOffset
+	dataForWrite   []byte
+	sendBufferSize int
+	readingFrom    bool
+	writeClosed    bool
+	finSent        bool
+	resetSent      bool
+	writeDeadline  time.Time
+	writeSignal    chan struct{}
+}
+
+var _ io.ReadWriteCloser = (*Stream)(nil)
+var _ io.WriterTo = (*Stream)(nil)
+var _ io.ReaderFrom = (*Stream)(nil)
+
+// NewStream returns an open Stream using the flow controller of the stream, attached to the connection flow controller,
+// whose send buffer holds sendBufferSize bytes. The clock gives the time of the flow control window updates, the deadlines
+// are times of the time package.
+func NewStream(streamID protocol.QuicStreamID, sender StreamSender, flowController *flowcontrol.FlowController, clock protocol.Clock,
+	sendBufferSize int) *Stream {
+	return &Stream{
+		streamID:       streamID,
+		sender:         sender,
+		flowController: flowController,
+		clock:          clock,
+		sendBufferSize: sendBufferSize,
+		priority:       DEFAULT_STREAM_PRIORITY,
+		frameBuffer:    NewSortedFrameBuffer(),
+		readSignal:     make(chan struct{}, 1),
+		writeSignal:    make(chan struct{}, 1)}
+}
+
+// GetStreamID returns the Stream ID.
+func (this *Stream) GetStreamID() protocol.QuicStreamID {
+	return this.streamID
+}
+
+// SetPriority sets the weight of the stream in the scheduling of the session, clamped between 1 and MAX_STREAM_PRIORITY:
+// the streams with data to send share the packets in proportion of their priority by default.
+func (this *Stream) SetPriority(priority int) {
+	if priority < 1 {
+		priority = 1
+	} else if priority > MAX_STREAM_PRIORITY {
+		priority = MAX_STREAM_PRIORITY
+	}
+	this.mutex.Lock()
+	this.priority = priority
+	this.mutex.Unlock()
+}
+
+// GetPriority returns the priority of the stream, DEFAULT_STREAM_PRIORITY unless SetPriority changed it.
+func (this *Stream) GetPriority() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.priority
+}
+
+// signal wakes the goroutine blocked on the channel, if any.
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks until the signal, the deadline or the end of the context, and returns the error that stopped the wait.
+func wait(ctx context.Context, op string, c chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-c:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-ctx.Done():
+		return protocol.ContextError{Op: op, Err: ctx.Err()}
+	}
+}
+
+// Read reads the stream data in order, it blocks until data, the FIN (io.EOF), a reset or the read deadline.
+// The data is copied into p from the packets received.
+func (this *Stream) Read(p []byte) (int, error) {
+	return this.ReadContext(context.Background(), p)
+}
+
+// ReadContext is Read interrupted by the end of the context, with a protocol.ContextError.
+func (this *Stream) ReadContext(ctx context.Context, p []byte) (int, error) {
+	for {
+		this.mutex.Lock()
+		if err := this.readError(); err != nil {
+			this.mutex.Unlock()
+			return 0, err
+		}
+		if len(p) == 0 {
+			this.mutex.Unlock()
+			return 0, nil
+		}
+		n, fin := this.frameBuffer.Read(p)
+		if n > 0 || fin {
+			return n, this.consumed(n, fin)
+		}
+		deadline := this.readDeadline
+		this.mutex.Unlock()
+		if err := wait(ctx, "Stream.Read", this.readSignal, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// WriteTo writes the stream data to w until the FIN, a reset or an error of w, without copy: w writes the data from the packets
+// received. It blocks like Read, and must not be called concurrently with Read. io.Copy uses it.
+func (this *Stream) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+
+	for {
+		this.mutex.Lock()
+		if err := this.readError(); err != nil {
+			this.mutex.Unlock()
+			if err == io.EOF {
+				err = nil
+			}
+			return written, err
+		}
+		data, buffer := this.frameBuffer.Peek()
+		if len(data) == 0 {
+			if this.frameBuffer.atFIN() {
+				this.consumed(0, true)
+				return written, nil
+			}
+			deadline := this.readDeadline
+			this.mutex.Unlock()
+			if err := wait(context.Background(), "Stream.WriteTo", this.readSignal, deadline); err != nil {
+				return written, err
+			}
+			continue
+		}
+		frameBuffer := this.frameBuffer
+		this.mutex.Unlock()
+
+		n, werr := w.Write(data)
+		buffer.Release()
+		written += int64(n)
+		this.mutex.Lock()
+		// A reset or CloseRead has dropped the data meanwhile
+		if this.frameBuffer != frameBuffer || this.resetErr != nil || this.readClosed {
+			this.mutex.Unlock()
+		} else {
+			frameBuffer.Skip(n)
+			this.consumed(n, frameBuffer.atFIN())
+		}
+		if werr != nil {
+			return written, werr
+		}
+	}
+}
+
+// readError returns the error of a Read on the stream, the mutex must be locked: io.EOF once the FIN is read.
+func (this *Stream) readError() error {
+	if this.readClosed {
+		return ErrReadClosed
+	}
+	if this.resetErr != nil {
+		return this.resetErr
+	}
+	if this.finRead {
+		return io.EOF
+	}
+	return nil
+}
+
+// consumed counts the n bytes read by the flow control, and marks the FIN read if fin is true, the mutex must be locked
+// and is unlocked. It returns the error of the Read that reaches the FIN without data: io.EOF.
+func (this *Stream) consumed(n int, fin bool) error {
+	var updates []protocol.Frame
+	if n > 0 {
+		updates = this.addBytesRead(n)
+	}
+	finished := false
+	if fin && !this.finRead {
+		this.finRead = true
+		finished = this.finSent || this.resetSent
+	}
+	this.mutex.Unlock()
+	for _, f := range updates {
+		this.sender.QueueControlFrame(f)
+	}
+	if finished {
+		this.sender.OnStreamFinished(this.streamID)
+	}
+	if n == 0 && fin {
+		return io.EOF
+	}
+	return nil
+}
+
+// addBytesRead counts the data consumed, and returns the WINDOW_UPDATE frames to send for the stream and for the connection:
+// the connection window can need an update while the stream window doesn't. The mutex must be locked.
+func (this *Stream) addBytesRead(n int) []protocol.Frame {
+	var updates []protocol.Frame
+
+	now := this.clock.Now()
+	this.flowController.AddBytesRead(protocol.QuicByteOffset(n))
+	if f := this.flowController.GetWindowUpdate(now); f != nil {
+		updates = append(updates, f)
+	}
+	if f := this.flowController.GetConnectionWindowUpdate(now); f != nil {
+		updates = append(updates, f)
+	}
+	return updates
+}
+
+// Write writes the data on the stream, it blocks until the send buffer has taken all the data, a reset or the write deadline.
+// After a write deadline, the number of bytes taken by the send buffer is returned with os.ErrDeadlineExceeded.
+// A CloseWrite during the Write sends the FIN after the data taken, the Write returns ErrWriteClosed.
+func (this *Stream) Write(p []byte) (int, error) {
+	return this.WriteContext(context.Background(), p)
+}
+
+// WriteContext is Write interrupted by the end of the context: the number of bytes taken is returned with a protocol.ContextError.
+func (this *Stream) WriteContext(ctx context.Context, p []byte) (int, error) {
+	n := 0
+	for {
+		this.mutex.Lock()
+		if err := this.writeError(); err != nil {
+			this.mutex.Unlock()
+			return n, err
+		}
+		taken := this.bufferData(p[n:])
+		n += taken
+		deadline := this.writeDeadline
+		this.mutex.Unlock()
+		if taken > 0 {
+			this.sender.OnHasStreamData(this.streamID)
+		}
+		if n == len(p) {
+			return n, nil
+		}
+		if err := wait(ctx, "Stream.Write", this.writeSignal, deadline); err != nil {
+			return n, err
+		}
+	}
+}
+
+// TryWrite writes the data that the send buffer can take without blocking, it returns ErrWouldBlock if it can't take
+// all the data: the rest can be written once the session has sent some of the buffer.
+func (this *Stream) TryWrite(p []byte) (int, error) {
+	this.mutex.Lock()
+	if err := this.writeError(); err != nil {
+		this.mutex.Unlock()
+		return 0, err
+	}
+	n := this.bufferData(p)
+	this.mutex.Unlock()
+	if n > 0 {
+		this.sender.OnHasStreamData(this.streamID)
+	}
+	if n < len(p) {
+		return n, ErrWouldBlock
+	}
+	return n, nil
+}
+
+// ReadFrom writes the data of r on the stream until io.EOF, like Write, without copy: r reads the data into the send buffer
+// of the stream. It must not be called concurrently with Write. io.Copy uses it.
+func (this *Stream) ReadFrom(r io.Reader) (int64, error) {
+	var read int64
+
+	this.mutex.Lock()
+	this.readingFrom = true
+	this.mutex.Unlock()
+	defer func() {
+		this.mutex.Lock()
+		this.readingFrom = false
+		this.mutex.Unlock()
+	}()
+	for {
+		this.mutex.Lock()
+		if err := this.writeError(); err != nil {
+			this.mutex.Unlock()
+			return read, err
+		}
+		tail := this.sendBufferTail()
+		deadline := this.writeDeadline
+		this.mutex.Unlock()
+		if len(tail) == 0 {
+			if err := wait(context.Background(), "Stream.ReadFrom", this.writeSignal, deadline); err != nil {
+				return read, err
+			}
+			continue
+		}
+
+		n, rerr := r.Read(tail)
+		if n > 0 {
+			this.mutex.Lock()
+			err := this.writeError()
+			if err == nil {
+				this.appendTail(tail[:n])
+			}
+			this.mutex.Unlock()
+			if err != nil {
+				return read, err
+			}
+			read += int64(n)
+			this.sender.OnHasStreamData(this.streamID)
+		}
+		if rerr == io.EOF {
+			return read, nil
+		}
+		if rerr != nil {
+			return read, rerr
+		}
+	}
+}
+
+// sendBufferTail returns the free space of the send buffer after its data, in its capacity, the mutex must be locked.
+// The send buffer is reallocated when less than half of its free space is in its capacity: PopStreamFrame keeps the empty
+// send buffer of ReadFrom, the free space after it is still used.
+func (this *Stream) sendBufferTail() []byte {
+	size := len(this.dataForWrite)
+	free := this.sendBufferSize - size
+	if free <= 0 {
+		return nil
+	}
+	if cap(this.dataForWrite)-size < free/2 {
+		b := make([]byte, size, this.sendBufferSize)
+		copy(b, this.dataForWrite)
+		this.dataForWrite = b
+	}
+	if cap(this.dataForWrite)-size < free {
+		free = cap(this.dataForWrite) - size
+	}
+	return this.dataForWrite[size : size+free]
+}
+
+// appendTail adds the data read in the tail of sendBufferTail to the send buffer, the mutex must be locked: the data
+// is already in place unless the send buffer has been emptied or reallocated meanwhile.
+func (this *Stream) appendTail(data []byte) {
+	size := len(this.dataForWrite)
+	if cap(this.dataForWrite) > size && &this.dataForWrite[:size+1][size] == &data[0] {
+		this.dataForWrite = this.dataForWrite[:size+len(data)]
+		return
+	}
+	this.dataForWrite = append(this.dataForWrite, data...)
+}
+
+// bufferData copies the data that fits in the send buffer, and returns the number of bytes taken, the mutex must be locked.
+func (this *Stream) bufferData(p []byte) int {
+	n := this.sendBufferSize - len(this.dataForWrite)
+	if n <= 0 {
+		return 0
+	}
+	if n > len(p) {
+		n = len(p)
+	}
+	this.dataForWrite = append(this.dataForWrite, p[:n]...)
+	return n
+}
+
+// writeError returns the error of a Write on the stream, the mutex must be locked: the first of the aborts of the write side
+// and of the whole stream, writeErr being set only before resetErr.
+func (this *Stream) writeError() error {
+	if this.writeErr != nil {
+		return this.writeErr
+	}
+	if this.resetErr != nil {
+		return this.resetErr
+	}
+	if this.writeClosed {
+		return ErrWriteClosed
+	}
+	return nil
+}
+
+// Close closes the write side of the stream: the FIN is sent after the data written.
+func (this *Stream) Close() error {
+	return this.CloseWrite()
+}
+
+// CloseWrite closes the write side of the stream: the FIN is sent after the data written.
+func (this *Stream) CloseWrite() error {
+	this.mutex.Lock()
+	if this.writeClosed || this.resetErr != nil || this.writeErr != nil {
+		this.mutex.Unlock()
+		return nil
+	}
+	this.writeClosed = true
+	this.mutex.Unlock()
+	signal(this.writeSignal)
+	this.sender.OnHasStreamData(this.streamID)
+	return nil
+}
+
+// CloseRead closes the read side of the stream: the data received is discarded, and still consumes the flow control windows.
+func (this *Stream) CloseRead() error {
+	this.mutex.Lock()
+	if this.readClosed {
+		this.mutex.Unlock()
+		return nil
+	}
+	finished := this.finSent && !this.finRead
+	this.readClosed = true
+	updates := this.discardReceivedData()
+	this.mutex.Unlock()
+	signal(this.readSignal)
+	for _, f := range updates {
+		this.sender.QueueControlFrame(f)
+	}
+	if finished {
+		this.sender.OnStreamFinished(this.streamID)
+	}
+	return nil
+}
+
+// discardReceivedData consumes the data received after CloseRead, and returns the WINDOW_UPDATE frames to send, the mutex must be locked.
+func (this *Stream) discardReceivedData() []protocol.Frame {
+	n, fin := this.frameBuffer.Discard()
+	if fin {
+		this.finRead = true
+	}
+	if n == 0 {
+		return nil
+	}
+	return this.addBytesRead(n)
+}
+
+// Reset aborts both sides of the stream, and sends a RST_STREAM frame with the error code.
+func (this *Stream) Reset(errorCode protocol.QuicErrorCode) {
+	this.reset(errorCode, true)
+}
+
+// CancelWrite aborts the write side of the stream with a RST_STREAM frame of the error code: the data not sent yet is
+// discarded, and the data sent is not retransmitted. The data received until the RST_STREAM frame that the peer sends
+// in answer can still be read.
+func (this *Stream) CancelWrite(errorCode protocol.QuicErrorCode) {
+	this.reset(errorCode, false)
+}
+
+// CancelRead aborts the read side of the stream: the data received and the data still in flight are discarded.
+// Google QUIC has no other frame than RST_STREAM to stop the peer, and it also ends the write side: CancelRead is Reset.
+func (this *Stream) CancelRead(errorCode protocol.QuicErrorCode) {
+	this.reset(errorCode, true)
+}
+
+// reset sends the RST_STREAM frame of the error code once, and aborts the write side, or both sides if read is true.
+// The data discarded by the read side is counted as consumed, so that the connection receive window doesn't shrink.
+func (this *Stream) reset(errorCode protocol.QuicErrorCode, read bool) {
+	this.mutex.Lock()
+	err := StreamResetError{StreamID: this.streamID, ErrorCode: errorCode}
+	if read {
+		if this.resetErr == nil {
+			this.resetErr = err
+		}
+		this.frameBuffer.Release()
+		this.frameBuffer = NewSortedFrameBuffer()
+		this.flowController.DiscardUnread()
+	} else if this.writeErr == nil && this.resetErr == nil {
+		this.writeErr = err
+	}
+	this.dataForWrite = nil
+	var f *protocol.RstStreamFrame
+	if !this.resetSent {
+		this.resetSent = true
+		f = &protocol.RstStreamFrame{StreamID: this.streamID, ByteOffset: this.writeOffset, ErrorCode: errorCode}
+	}
+	this.mutex.Unlock()
+	signal(this.readSignal)
+	signal(this.writeSignal)
+	if f != nil {
+		this.sender.QueueControlFrame(f)
+	}
+}
+
+// CloseWithError aborts both sides of the stream without sending any frame, when the connection is closed.
+// The pending and future Read and Write calls return the error.
+func (this *Stream) CloseWithError(err error) {
+	this.mutex.Lock()
+	if this.resetErr == nil {
+		this.resetErr = err
+	}
+	this.connClosed = true
+	this.frameBuffer.Release()
+	this.dataForWrite = nil
+	this.mutex.Unlock()
+	signal(this.readSignal)
+	signal(this.writeSignal)
+}
+
+// SetDeadline sets the read and write deadlines, the zero time means no deadline.
+func (this *Stream) SetDeadline(t time.Time) error {
+	this.SetReadDeadline(t)
+	return this.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline of the pending and future Read calls, the zero time means no deadline.
+func (this *Stream) SetReadDeadline(t time.Time) error {
+	this.mutex.Lock()
+	this.readDeadline = t
+	this.mutex.Unlock()
+	signal(this.readSignal)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline of the pending and future Write calls, the zero time means no deadline.
+func (this *Stream) SetWriteDeadline(t time.Time) error {
+	this.mutex.Lock()
+	this.writeDeadline = t
+	this.mutex.Unlock()
+	signal(this.writeSignal)
+	return nil
+}
+
+// HandleStreamFrame buffers the data of a STREAM frame received, a flow control violation is a connection error.
+func (this *Stream) HandleStreamFrame(f *protocol.StreamFrame) error {
+	return this.HandleStreamFrameBuffer(f, nil)
+}
+
+// HandleStreamFrameBuffer is HandleStreamFrame for a frame whose data is in the pooled buffer of its packet, if not nil:
+// the stream retains the buffer until the data is read, instead of copying the data.
+func (this *Stream) HandleStreamFrameBuffer(f *protocol.StreamFrame, buffer *bufferpool.Buffer) error {
+	end := f.Offset + protocol.QuicByteOffset(len(f.Data))
+	if err := this.flowController.UpdateHighestReceived(end); err != nil {
+		return err
+	}
+	this.mutex.Lock()
+	if this.resetReceived {
+		this.mutex.Unlock()
+		return nil
+	}
+	// The data of an aborted read side is consumed at once
+	if this.resetErr != nil {
+		this.finalReceived = this.finalReceived || f.FIN
+		this.flowController.DiscardUnread()
+		this.mutex.Unlock()
+		return nil
+	}
+	if err := this.frameBuffer.PushBuffer(f.Offset, f.Data, f.FIN, buffer); err != nil {
+		this.mutex.Unlock()
+		return err
+	}
+	this.finalReceived = this.finalReceived || f.FIN
+	var updates []protocol.Frame
+	if this.readClosed {
+		updates = this.discardReceivedData()
+	}
+	this.mutex.Unlock()
+	signal(this.readSignal)
+	for _, f := range updates {
+		this.sender.QueueControlFrame(f)
+	}
+	return nil
+}
+
+// HandleRstStreamFrame aborts the stream with the error code of the peer, the final offset is counted by the flow control
+// and the data not read is consumed. The stream answers with its own RST_STREAM frame of the same error code, unless it
+// has already sent its FIN or a RST_STREAM frame: the peer learns the final offset of the data it has received.
+func (this *Stream) HandleRstStreamFrame(f *protocol.RstStreamFrame) error {
+	if f.ByteOffset < this.flowController.GetHighestReceived() {
+		return ErrInvalidFinalOffset
+	}
+	if err := this.flowController.UpdateHighestReceived(f.ByteOffset); err != nil {
+		return err
+	}
+	this.mutex.Lock()
+	if this.resetReceived {
+		this.mutex.Unlock()
+		return nil
+	}
+	this.resetReceived = true
+	this.finalReceived = true
+	if this.resetErr == nil {
+		this.resetErr = StreamResetError{StreamID: this.streamID, ErrorCode: f.ErrorCode, Remote: true}
+	}
+	this.frameBuffer.Release()
+	this.frameBuffer = NewSortedFrameBuffer()
+	this.dataForWrite = nil
+	this.flowController.DiscardUnread()
+	var answer *protocol.RstStreamFrame
+	if !this.resetSent && !this.finSent {
+		this.resetSent = true
+		answer = &protocol.RstStreamFrame{StreamID: this.streamID, ByteOffset: this.writeOffset, ErrorCode: f.ErrorCode}
+	}
+	this.mutex.Unlock()
+	signal(this.readSignal)
+	signal(this.writeSignal)
+	if answer != nil {
+		this.sender.QueueControlFrame(answer)
+	}
+	return nil
+}
+
+// HandleWindowUpdateFrame grows the send window of the stream, and resumes the pending Write.
+func (this *Stream) HandleWindowUpdateFrame(f *protocol.WindowUpdateFrame) {
+	if this.flowController.UpdateSendWindow(f.ByteOffset) {
+		this.OnConnectionWindowUpdate()
+	}
+}
+
+// OnConnectionWindowUpdate resumes the pending Write blocked by the connection flow control window.
+func (this *Stream) OnConnectionWindowUpdate() {
+	if this.HasDataToSend() {
+		this.sender.OnHasStreamData(this.streamID)
+	}
+}
+
+// HasDataToSend returns true if the stream has data or a FIN to send.
+func (this *Stream) HasDataToSend() bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.resetErr == nil && this.writeErr == nil && (len(this.dataForWrite) > 0 || (this.writeClosed && !this.finSent))
+}
+
+// PopStreamFrame returns the next STREAM frame to send with at most maxDataSize bytes of data, limited by the flow control windows,
+// or nil if there is nothing to send. A BLOCKED frame is queued when the stream flow control window is exhausted.
+func (this *Stream) PopStreamFrame(maxDataSize int) *protocol.StreamFrame {
+	this.mutex.Lock()
+	if this.resetErr != nil || this.writeErr != nil || (len(this.dataForWrite) == 0 && (!this.writeClosed || this.finSent)) {
+		this.mutex.Unlock()
+		return nil
+	}
+	n := len(this.dataForWrite)
+	if n > maxDataSize {
+		n = maxDataSize
+	}
+	if window := this.flowController.SendWindowSize(); protocol.QuicByteOffset(n) > window {
+		n = int(window)
+	}
+	if n == 0 && len(this.dataForWrite) > 0 {
+		blocked := this.flowController.GetBlockedFrame()
+		this.mutex.Unlock()
+		if blocked != nil {
+			this.sender.QueueControlFrame(blocked)
+		}
+		return nil
+	}
+	f := &protocol.StreamFrame{StreamID: this.streamID, Offset: this.writeOffset, Data: make([]byte, n)}
+	copy(f.Data, this.dataForWrite)
+	this.dataForWrite = this.dataForWrite[n:]
+	this.writeOffset += protocol.QuicByteOffset(n)
+	this.flowController.AddBytesSent(protocol.QuicByteOffset(n))
+	if len(this.dataForWrite) == 0 {
+		if !this.readingFrom {
+			this.dataForWrite = nil
+		}
+		if this.writeClosed {
+			f.FIN = true
+			this.finSent = true
+		}
+	}
+	this.mutex.Unlock()
+	signal(this.writeSignal)
+	return f
+}
+
+// IsFinished returns true when both sides of the stream are done, the session can forget the stream.
+// An aborted read side waits for the final offset of the peer, so that the connection flow control counts all its data.
+func (this *Stream) IsFinished() bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.connClosed {
+		return true
+	}
+	return (this.finSent || this.resetSent) && (this.finRead || (this.resetErr != nil && this.finalReceived))
+}
+
+// IsWriteAborted returns true once the stream has sent a RST_STREAM frame: its data is not retransmitted.
+func (this *Stream) IsWriteAborted() bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.resetSent
+}
@@ -0,0 +1,634 @@
+package stream
+
+import "github.com/romain-jacotin/quic/flowcontrol"
+import "github.com/romain-jacotin/quic/internal/bufferpool"
+import "github.com/romain-jacotin/quic/protocol"
+import "bytes"
+import "context"
+import "errors"
+import "io"
+import "io/ioutil"
+import "net"
+import "os"
+import "sync"
+import "testing"
+import "time"
+
+// testStreamSender records the control frames and the streams with data to send.
+type testStreamSender struct {
+	mutex    sync.Mutex
+	frames   []protocol.Frame
+	hasData  chan protocol.QuicStreamID
+	finished chan protocol.QuicStreamID
+}
+
+func newTestStreamSender() *testStreamSender {
+	return &testStreamSender{hasData: make(chan protocol.QuicStreamID, 100), finished: make(chan protocol.QuicStreamID, 100)}
+}
+
+func (this *testStreamSender) QueueControlFrame(f protocol.Frame) {
+	this.mutex.Lock()
+	this.frames = append(this.frames, f)
+	this.mutex.Unlock()
+}
+
+func (this *testStreamSender) OnHasStreamData(streamID protocol.QuicStreamID) {
+	this.hasData <- streamID
+}
+
+func (this *testStreamSender) OnStreamFinished(streamID protocol.QuicStreamID) {
+	this.finished <- streamID
+}
+
+func (this *testStreamSender) getFrames() []protocol.Frame {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	frames := this.frames
+	this.frames = nil
+	return frames
+}
+
+// newTestStream returns a stream with the receive and send windows of the stream, and large connection windows.
+func newTestStream(receiveWindow, sendWindow protocol.QuicByteOffset) (*Stream, *testStreamSender) {
+	sender := newTestStreamSender()
+	connection := flowcontrol.NewConnectionFlowController(1<<20, 1<<20, 1<<20, nil)
+	fc := flowcontrol.NewStreamFlowController(5, connection, receiveWindow, receiveWindow, sendWindow, nil)
+	return NewStream(5, sender, fc, protocol.RealClock, DEFAULT_SEND_BUFFER_SIZE), sender
+}
+
+// popAll pops the STREAM frames of the stream until the FIN or nothing is left to send.
+func popAll(s *Stream, maxDataSize int) []*protocol.StreamFrame {
+	var frames []*protocol.StreamFrame
+
+	for f := s.PopStreamFrame(maxDataSize); f != nil; f = s.PopStreamFrame(maxDataSize) {
+		frames = append(frames, f)
+		if f.FIN {
+			break
+		}
+	}
+	return frames
+}
+
+func Test_Stream_Read(t *testing.T) {
+	s, _ := newTestStream(1000, 1000)
+	data := testStreamData(30)
+
+	// Blocking Read woken by the frames, delivered in order
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Offset: 10, Data: data[10:30], FIN: true})
+		time.Sleep(10 * time.Millisecond)
+		s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Data: data[:10]})
+	}()
+	b, err := io.ReadAll(s)
+	if err != nil || !bytes.Equal(b, data) {
+		t.Errorf("Stream.Read : invalid data %v (%v)", b, err)
+	}
+	if n, err := s.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Errorf("Stream.Read : io.EOF expected after the FIN instead of %v", err)
+	}
+}
+
+func Test_Stream_Write(t *testing.T) {
+	s, sender := newTestStream(1000, 1000)
+	data := testStreamData(25)
+
+	done := make(chan error)
+	go func() {
+		n, err := s.Write(data)
+		if err == nil && n != len(data) {
+			err = io.ErrShortWrite
+		}
+		if err == nil {
+			err = s.Close()
+		}
+		done <- err
+	}()
+	// The Write returns once the send buffer has taken the data, the FIN is sent with the last data
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	<-sender.hasData
+	frames := popAll(s, 10)
+	var written []byte
+	for i, f := range frames {
+		if f.Offset != protocol.QuicByteOffset(len(written)) || f.FIN != (i == len(frames)-1) {
+			t.Errorf("Stream.PopStreamFrame : invalid frame %+v in test n°%v", f, i)
+		}
+		written = append(written, f.Data...)
+	}
+	if !bytes.Equal(written, data) || len(frames) != 3 || s.HasDataToSend() {
+		t.Errorf("Stream.PopStreamFrame : invalid data written in %v frames", len(frames))
+	}
+	if _, err := s.Write(data); err != ErrWriteClosed {
+		t.Errorf("Stream.Write : ErrWriteClosed expected instead of %v", err)
+	}
+}
+
+func Test_Stream_FlowControl(t *testing.T) {
+	// The Write is blocked by a send buffer of 10 bytes and a send window of 10 bytes
+	s, sender := newTestStream(100, 10)
+	s.sendBufferSize = 10
+	data := testStreamData(25)
+
+	done := make(chan int)
+	go func() {
+		n, _ := s.Write(data)
+		done <- n
+	}()
+	<-sender.hasData
+	if f := s.PopStreamFrame(100); f == nil || len(f.Data) != 10 {
+		t.Fatalf("Stream.PopStreamFrame : 10 bytes expected in the send window instead of %v", f)
+	}
+	// The send buffer takes the next 10 bytes
+	<-sender.hasData
+	if f := s.PopStreamFrame(100); f != nil {
+		t.Errorf("Stream.PopStreamFrame : the send window is exhausted, nil expected instead of %v", f)
+	}
+	if frames := sender.getFrames(); len(frames) != 1 || frames[0].(*protocol.BlockedFrame).StreamID != 5 {
+		t.Errorf("Stream.PopStreamFrame : BLOCKED frame expected instead of %v", frames)
+	}
+	select {
+	case n := <-done:
+		t.Errorf("Stream.Write : blocked Write expected instead of %v bytes", n)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Resumed by the WINDOW_UPDATE frame
+	s.HandleWindowUpdateFrame(&protocol.WindowUpdateFrame{StreamID: 5, ByteOffset: 100})
+	if id := <-sender.hasData; id != 5 {
+		t.Errorf("Stream.HandleWindowUpdateFrame : stream 5 expected to have data instead of %v", id)
+	}
+	if f := s.PopStreamFrame(100); f == nil || len(f.Data) != 10 || f.Offset != 10 {
+		t.Errorf("Stream.PopStreamFrame : 10 bytes of the send buffer expected instead of %v", f)
+	}
+	<-sender.hasData
+	if f := s.PopStreamFrame(100); f == nil || len(f.Data) != 5 || f.Offset != 20 {
+		t.Errorf("Stream.PopStreamFrame : remaining 5 bytes expected instead of %v", f)
+	}
+	if n := <-done; n != 25 {
+		t.Errorf("Stream.Write : 25 bytes expected instead of %v", n)
+	}
+
+	// Receive side: violation of our window and WINDOW_UPDATE after half of the window is read
+	err := s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Data: make([]byte, 101)})
+	if e, ok := err.(flowcontrol.ErrFlowControlViolation); !ok || e.ErrorCode() != protocol.QUIC_FLOW_CONTROL_RECEIVED_TOO_MUCH_DATA {
+		t.Errorf("Stream.HandleStreamFrame : flow control violation expected instead of %v", err)
+	}
+	s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Data: make([]byte, 60)})
+	s.Read(make([]byte, 60))
+	if frames := sender.getFrames(); len(frames) != 1 || frames[0].(*protocol.WindowUpdateFrame).ByteOffset != 160 {
+		t.Errorf("Stream.Read : WINDOW_UPDATE frame at offset 160 expected instead of %v", frames)
+	}
+
+	// The connection window is updated by the reads even when the stream window doesn't need an update
+	connection := flowcontrol.NewConnectionFlowController(100, 100, 1<<20, nil)
+	s = NewStream(7, sender, flowcontrol.NewStreamFlowController(7, connection, 1000, 1000, 1<<20, nil), protocol.RealClock, DEFAULT_SEND_BUFFER_SIZE)
+	s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 7, Data: make([]byte, 60)})
+	s.Read(make([]byte, 60))
+	if frames := sender.getFrames(); len(frames) != 1 || frames[0].(*protocol.WindowUpdateFrame).StreamID != 0 {
+		t.Errorf("Stream.Read : WINDOW_UPDATE frame of the connection expected instead of %v", frames)
+	}
+}
+
+func Test_Stream_Deadlines(t *testing.T) {
+	s, sender := newTestStream(100, 10)
+	s.sendBufferSize = 10
+
+	// Write deadline: partial write, the send buffer takes 10 bytes again once the first 10 bytes are sent
+	s.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	done := make(chan error)
+	var n int
+	go func() {
+		var err error
+		n, err = s.Write(make([]byte, 25))
+		done <- err
+	}()
+	<-sender.hasData
+	s.PopStreamFrame(100)
+	err := <-done
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() || n != 20 {
+		t.Errorf("Stream.Write : timeout after 20 bytes expected instead of %v bytes (%v)", n, err)
+	}
+
+	// Read deadline in the past
+	s.SetReadDeadline(time.Now().Add(-time.Second))
+	if _, err = s.Read(make([]byte, 10)); err != os.ErrDeadlineExceeded {
+		t.Errorf("Stream.Read : os.ErrDeadlineExceeded expected instead of %v", err)
+	}
+
+	// Deadline set during a blocked Read
+	s.SetReadDeadline(time.Time{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.SetReadDeadline(time.Now())
+	}()
+	if _, err = s.Read(make([]byte, 10)); err != os.ErrDeadlineExceeded {
+		t.Errorf("Stream.Read : os.ErrDeadlineExceeded expected for the pending Read instead of %v", err)
+	}
+}
+
+func Test_Stream_Context(t *testing.T) {
+	s, sender := newTestStream(100, 10)
+	s.sendBufferSize = 10
+
+	// Cancelled Write: partial write
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	var n int
+	go func() {
+		var err error
+		n, err = s.WriteContext(ctx, make([]byte, 25))
+		done <- err
+	}()
+	<-sender.hasData
+	s.PopStreamFrame(100)
+	<-sender.hasData
+	cancel()
+	err := <-done
+	if ce, ok := err.(protocol.ContextError); !ok || ce.Err != context.Canceled || n != 20 {
+		t.Errorf("Stream.WriteContext : cancellation after 20 bytes expected instead of %v bytes (%v)", n, err)
+	}
+
+	// Read until the deadline of the context
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = s.ReadContext(ctx, make([]byte, 10))
+	if ce, ok := err.(protocol.ContextError); !ok || !ce.Timeout() || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stream.ReadContext : deadline of the context expected instead of %v", err)
+	}
+
+	// The data already received is read with a done context
+	s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Data: []byte("abc")})
+	if n, err = s.ReadContext(ctx, make([]byte, 10)); n != 3 || err != nil {
+		t.Errorf("Stream.ReadContext : 3 bytes expected instead of %v (%v)", n, err)
+	}
+}
+
+func Test_Stream_Reset(t *testing.T) {
+	// Reset by the peer: the pending Read returns its error code, and the stream answers with its final offset
+	s, sender := newTestStream(100, 100)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.HandleRstStreamFrame(&protocol.RstStreamFrame{StreamID: 5, ByteOffset: 10, ErrorCode: protocol.QUIC_PEER_GOING_AWAY})
+	}()
+	_, err := s.Read(make([]byte, 10))
+	if e, ok := err.(StreamResetError); !ok || !e.Remote || e.ErrorCode != protocol.QUIC_PEER_GOING_AWAY {
+		t.Errorf("Stream.Read : StreamResetError of the peer expected instead of %v", err)
+	}
+	if _, err = s.Write([]byte{1}); err == nil || !s.IsFinished() {
+		t.Error("Stream.Write : error expected after RST_STREAM")
+	}
+	if frames := sender.getFrames(); len(frames) != 1 ||
+		*frames[0].(*protocol.RstStreamFrame) != (protocol.RstStreamFrame{StreamID: 5, ErrorCode: protocol.QUIC_PEER_GOING_AWAY}) {
+		t.Errorf("Stream.HandleRstStreamFrame : RST_STREAM frame in answer expected instead of %v", frames)
+	}
+
+	// Local reset
+	s, sender = newTestStream(100, 100)
+	s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Data: []byte{1, 2, 3}})
+	go s.Write(make([]byte, 20))
+	<-sender.hasData
+	s.PopStreamFrame(8)
+	s.Reset(protocol.QUIC_PEER_GOING_AWAY)
+	frames := sender.getFrames()
+	if len(frames) != 1 || *frames[0].(*protocol.RstStreamFrame) != (protocol.RstStreamFrame{StreamID: 5, ByteOffset: 8, ErrorCode: protocol.QUIC_PEER_GOING_AWAY}) {
+		t.Errorf("Stream.Reset : RST_STREAM frame at offset 8 expected instead of %v", frames)
+	}
+	if _, err = s.Read(make([]byte, 10)); err == nil || s.PopStreamFrame(100) != nil {
+		t.Error("Stream.Reset : both sides of the stream must be aborted")
+	}
+	// The stream waits for the final offset of the peer, without answer to its RST_STREAM frame
+	if s.IsFinished() {
+		t.Error("Stream.IsFinished : the final offset of the peer is expected after Reset")
+	}
+	if err = s.HandleRstStreamFrame(&protocol.RstStreamFrame{StreamID: 5, ByteOffset: 2}); err != ErrInvalidFinalOffset || s.IsFinished() {
+		t.Errorf("Stream.HandleRstStreamFrame : ErrInvalidFinalOffset expected below the data received instead of %v", err)
+	}
+	s.HandleRstStreamFrame(&protocol.RstStreamFrame{StreamID: 5, ByteOffset: 3, ErrorCode: protocol.QUIC_PEER_GOING_AWAY})
+	if frames = sender.getFrames(); len(frames) != 0 || !s.IsFinished() {
+		t.Errorf("Stream.HandleRstStreamFrame : finished stream without answer expected instead of %v", frames)
+	}
+	// Connection closed: the pending Write returns the error, without frame
+	s, sender = newTestStream(100, 100)
+	s.sendBufferSize = 10
+	closeErr := errors.New("connection closed")
+	go func() {
+		<-sender.hasData
+		s.CloseWithError(closeErr)
+	}()
+	if _, err = s.Write(make([]byte, 20)); err != closeErr || len(sender.getFrames()) != 0 || !s.IsFinished() {
+		t.Errorf("Stream.CloseWithError : connection error expected instead of %v", err)
+	}
+}
+
+func Test_Stream_Cancel(t *testing.T) {
+	connection := flowcontrol.NewConnectionFlowController(1000, 1000, 1000, nil)
+	newStream := func() (*Stream, *testStreamSender) {
+		sender := newTestStreamSender()
+		return NewStream(5, sender, flowcontrol.NewStreamFlowController(5, connection, 100, 100, 100, nil), protocol.RealClock, 10), sender
+	}
+
+	// CancelWrite: the pending Write returns the error, the data received can be read until the answer of the peer
+	s, sender := newStream()
+	done := make(chan error)
+	go func() {
+		_, err := s.Write(make([]byte, 25))
+		done <- err
+	}()
+	<-sender.hasData
+	s.PopStreamFrame(8)
+	s.CancelWrite(protocol.QUIC_CONNECTION_CANCELLED)
+	if err := <-done; !errors.Is(err, ErrStreamReset) || s.HasDataToSend() || !s.IsWriteAborted() {
+		t.Errorf("Stream.CancelWrite : StreamResetError expected instead of %v", err)
+	}
+	frames := sender.getFrames()
+	if len(frames) != 1 || *frames[0].(*protocol.RstStreamFrame) != (protocol.RstStreamFrame{StreamID: 5, ByteOffset: 8, ErrorCode: protocol.QUIC_CONNECTION_CANCELLED}) {
+		t.Errorf("Stream.CancelWrite : RST_STREAM frame at offset 8 expected instead of %v", frames)
+	}
+	s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Data: []byte{1, 2, 3}})
+	if n, err := s.Read(make([]byte, 10)); n != 3 || err != nil || s.IsFinished() {
+		t.Errorf("Stream.Read : 3 bytes expected after CancelWrite instead of %v (%v)", n, err)
+	}
+	s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Offset: 3, Data: []byte{4, 5}})
+	s.HandleRstStreamFrame(&protocol.RstStreamFrame{StreamID: 5, ByteOffset: 20, ErrorCode: protocol.QUIC_CONNECTION_CANCELLED})
+	if len(sender.getFrames()) != 0 || !s.IsFinished() {
+		t.Error("Stream.HandleRstStreamFrame : finished stream without answer expected after CancelWrite")
+	}
+	var resetErr StreamResetError
+	if _, err := s.Write([]byte{1}); !errors.As(err, &resetErr) || resetErr.Remote {
+		t.Errorf("Stream.Write : local StreamResetError of CancelWrite expected after the reset of the peer instead of %v", err)
+	}
+
+	// CancelRead: the data received and in flight is consumed, and a RST_STREAM frame aborts the write side
+	s, sender = newStream()
+	s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Data: make([]byte, 30)})
+	s.Read(make([]byte, 10))
+	s.CancelRead(protocol.QUIC_CONNECTION_CANCELLED)
+	if _, err := s.Read(make([]byte, 10)); !errors.Is(err, ErrStreamReset) {
+		t.Errorf("Stream.Read : StreamResetError expected after CancelRead instead of %v", err)
+	}
+	if _, err := s.Write([]byte{1}); !errors.Is(err, ErrStreamReset) {
+		t.Errorf("Stream.Write : StreamResetError expected after CancelRead instead of %v", err)
+	}
+	s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Offset: 30, Data: make([]byte, 20), FIN: true})
+	if frames = sender.getFrames(); len(frames) != 1 || frames[0].(*protocol.RstStreamFrame).ErrorCode != protocol.QUIC_CONNECTION_CANCELLED || !s.IsFinished() {
+		t.Errorf("Stream.CancelRead : RST_STREAM frame and finished stream expected instead of %v", frames)
+	}
+
+	// The connection has consumed all the data received on both streams
+	if connection.GetBytesRead() != 70 || connection.GetHighestReceived() != 70 {
+		t.Errorf("Stream.CancelRead : 70 bytes consumed expected instead of %v of %v", connection.GetBytesRead(), connection.GetHighestReceived())
+	}
+}
+
+func Test_Stream_HalfClose(t *testing.T) {
+	s, sender := newTestStream(100, 100)
+
+	// CloseRead: the data is discarded and consumes the window
+	s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Data: make([]byte, 30)})
+	s.CloseRead()
+	if _, err := s.Read(make([]byte, 10)); err != ErrReadClosed {
+		t.Errorf("Stream.Read : ErrReadClosed expected instead of %v", err)
+	}
+	s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Offset: 30, Data: make([]byte, 30), FIN: true})
+	if frames := sender.getFrames(); len(frames) != 1 || frames[0].(*protocol.WindowUpdateFrame).ByteOffset != 160 {
+		t.Errorf("Stream.CloseRead : WINDOW_UPDATE frame at offset 160 expected instead of %v", frames)
+	}
+
+	// The write side is still open
+	go s.Write([]byte{1, 2, 3})
+	<-sender.hasData
+	if f := s.PopStreamFrame(100); f == nil || len(f.Data) != 3 || s.IsFinished() {
+		t.Errorf("Stream.Write : write side must be open after CloseRead, frame %v", f)
+	}
+	s.CloseWrite()
+	if f := s.PopStreamFrame(100); f == nil || !f.FIN || len(f.Data) != 0 || f.Offset != 3 || !s.IsFinished() {
+		t.Errorf("Stream.CloseWrite : empty FIN frame expected instead of %v", f)
+	}
+	if len(sender.finished) != 0 {
+		t.Error("Stream.PopStreamFrame : the session finishes the stream itself")
+	}
+
+	// The reader finishes a stream whose FIN is sent: the session is notified
+	for i, closeRead := range []bool{false, true} {
+		s, sender := newTestStream(100, 100)
+		s.CloseWrite()
+		<-sender.hasData
+		s.PopStreamFrame(100)
+		s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Data: []byte{1}, FIN: true})
+		if closeRead {
+			s.CloseRead()
+		} else {
+			io.ReadAll(s)
+		}
+		if len(sender.finished) != 1 || !s.IsFinished() {
+			t.Errorf("StreamSender.OnStreamFinished : %v notifications in test n°%v", len(sender.finished), i)
+		}
+	}
+}
+
+func Test_Stream_TryWrite(t *testing.T) {
+	s, sender := newTestStream(100, 100)
+	s.sendBufferSize = 10
+
+	// The send buffer takes what fits without blocking
+	if n, err := s.TryWrite(testStreamData(25)); n != 10 || err != ErrWouldBlock {
+		t.Errorf("Stream.TryWrite : 10 bytes and ErrWouldBlock expected instead of %v (%v)", n, err)
+	}
+	if n, err := s.TryWrite([]byte{1}); n != 0 || err != ErrWouldBlock {
+		t.Errorf("Stream.TryWrite : full send buffer expected instead of %v (%v)", n, err)
+	}
+	<-sender.hasData
+	if f := s.PopStreamFrame(4); f == nil || len(f.Data) != 4 {
+		t.Fatalf("Stream.PopStreamFrame : 4 bytes expected instead of %v", f)
+	}
+	if n, err := s.TryWrite([]byte{1, 2, 3}); n != 3 || err != nil {
+		t.Errorf("Stream.TryWrite : 3 bytes expected instead of %v (%v)", n, err)
+	}
+	if f := s.PopStreamFrame(100); f == nil || len(f.Data) != 9 || f.Offset != 4 {
+		t.Errorf("Stream.PopStreamFrame : 9 bytes at offset 4 expected instead of %v", f)
+	}
+
+	// The errors of Write
+	s.CloseWrite()
+	if _, err := s.TryWrite([]byte{1}); err != ErrWriteClosed {
+		t.Errorf("Stream.TryWrite : ErrWriteClosed expected instead of %v", err)
+	}
+}
+
+// shortWriter accepts at most max bytes, then fails.
+type shortWriter struct {
+	bytes.Buffer
+	max int
+}
+
+func (this *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > this.max-this.Len() {
+		n, _ := this.Buffer.Write(p[:this.max-this.Len()])
+		return n, io.ErrShortWrite
+	}
+	return this.Buffer.Write(p)
+}
+
+func Test_Stream_WriteTo(t *testing.T) {
+	s, sender := newTestStream(1<<20, 1000)
+	data := testStreamData(10000)
+
+	// The data of the packets goes to the writer until the FIN
+	go func() {
+		for offset := len(data) - 1200; offset > -1200; offset -= 1200 {
+			start := offset
+			if start < 0 {
+				start = 0
+			}
+			buffer := bufferpool.GetBuffer(offset + 1200 - start)
+			copy(buffer.Data, data[start:])
+			s.HandleStreamFrameBuffer(&protocol.StreamFrame{StreamID: 5, Offset: protocol.QuicByteOffset(start), Data: buffer.Data,
+				FIN: start+len(buffer.Data) == len(data)}, buffer)
+			buffer.Release()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	var out bytes.Buffer
+	if n, err := io.Copy(&out, s); n != int64(len(data)) || err != nil || !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("Stream.WriteTo : %v bytes written with error %v", n, err)
+	}
+	if n, err := s.WriteTo(&out); n != 0 || err != nil {
+		t.Errorf("Stream.WriteTo : nothing expected after the FIN instead of %v bytes and %v", n, err)
+	}
+	if s.flowController.GetHighestReceived() != protocol.QuicByteOffset(len(data)) || len(sender.getFrames()) != 0 {
+		t.Errorf("Stream.WriteTo : the data written must be consumed")
+	}
+
+	// The data not taken by the writer can still be read
+	s, _ = newTestStream(1000, 1000)
+	s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Data: data[:100], FIN: true})
+	w := &shortWriter{max: 40}
+	if n, err := s.WriteTo(w); n != 40 || err != io.ErrShortWrite {
+		t.Errorf("Stream.WriteTo : 40 bytes and io.ErrShortWrite expected instead of %v and %v", n, err)
+	}
+	if rest, err := ioutil.ReadAll(s); err != nil || !bytes.Equal(rest, data[40:100]) {
+		t.Errorf("Stream.Read : the rest of the data expected after WriteTo instead of %v bytes and %v", len(rest), err)
+	}
+
+	// A reset ends the WriteTo
+	s, _ = newTestStream(1000, 1000)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.HandleRstStreamFrame(&protocol.RstStreamFrame{StreamID: 5, ErrorCode: protocol.QUIC_PEER_GOING_AWAY})
+	}()
+	if _, err := s.WriteTo(&out); !errors.Is(err, ErrStreamReset) {
+		t.Errorf("Stream.WriteTo : StreamResetError expected instead of %v", err)
+	}
+}
+
+func Test_Stream_ReadFrom(t *testing.T) {
+	sender := newTestStreamSender()
+	connection := flowcontrol.NewConnectionFlowController(1<<20, 1<<20, 1<<20, nil)
+	fc := flowcontrol.NewStreamFlowController(5, connection, 1<<20, 1<<20, 1<<20, nil)
+	s := NewStream(5, sender, fc, protocol.RealClock, 4096)
+	data := testStreamData(200000)
+
+	// The reader fills the send buffer while the frames are sent
+	sent := make(chan []byte)
+	go func() {
+		var out []byte
+		for len(out) < len(data) {
+			select {
+			case <-sender.hasData:
+			case <-time.After(time.Millisecond):
+			}
+			for f := s.PopStreamFrame(1000); f != nil; f = s.PopStreamFrame(1000) {
+				out = append(out, f.Data...)
+			}
+		}
+		sent <- out
+	}()
+	if n, err := io.Copy(s, bytes.NewReader(data)); n != int64(len(data)) || err != nil {
+		t.Errorf("Stream.ReadFrom : %v bytes read with error %v", n, err)
+	}
+	if out := <-sent; !bytes.Equal(out, data) {
+		t.Errorf("Stream.ReadFrom : invalid data sent")
+	}
+	s.CloseWrite()
+	if n, err := s.ReadFrom(bytes.NewReader(data)); n != 0 || err != ErrWriteClosed {
+		t.Errorf("Stream.ReadFrom : ErrWriteClosed expected instead of %v bytes and %v", n, err)
+	}
+}
+
+func Test_Stream_HandshakeMessage(t *testing.T) {
+	s, _ := newTestStream(1<<16, 1000)
+	rej := protocol.NewHandshakeMessage(protocol.TagREJ)
+	rej.SetTag(protocol.TagSCFG, testStreamData(300))
+	rej.SetTag(protocol.TagSTK, testStreamData(60))
+	rej.SetTag(protocol.TagCRT, testStreamData(6000))
+	data := rej.Serialize()
+
+	// The REJ is split into five packets received out of order, the message is read once all its data is received
+	read := make(chan []byte, 1)
+	go func() {
+		msg, err := protocol.ReadHandshakeMessage(s)
+		if err != nil {
+			read <- nil
+			return
+		}
+		read <- msg.Serialize()
+	}()
+	size := (len(data) + 4) / 5
+	for i, k := range []int{3, 0, 4, 1, 2} {
+		end := (k + 1) * size
+		if end > len(data) {
+			end = len(data)
+		}
+		s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Offset: protocol.QuicByteOffset(k * size), Data: data[k*size : end]})
+		if i < 4 {
+			time.Sleep(5 * time.Millisecond)
+			select {
+			case <-read:
+				t.Fatalf("ReadHandshakeMessage : message read before its packet %v", i+1)
+			default:
+			}
+		}
+	}
+	select {
+	case b := <-read:
+		if !bytes.Equal(b, data) {
+			t.Errorf("ReadHandshakeMessage : invalid REJ read from the five packets")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("ReadHandshakeMessage : REJ not read")
+	}
+
+	// A message larger than MAX_HANDSHAKE_MESSAGE_SIZE is rejected once its header is received
+	offset := protocol.QuicByteOffset(len(data))
+	rej.SetTag(protocol.TagCRT, make([]byte, protocol.MAX_HANDSHAKE_MESSAGE_SIZE))
+	s.HandleStreamFrame(&protocol.StreamFrame{StreamID: 5, Offset: offset, Data: rej.Serialize()[:32]})
+	if _, err := protocol.ReadHandshakeMessage(s); err != protocol.ErrHandshakeMessageTooLarge {
+		t.Errorf("ReadHandshakeMessage : ErrHandshakeMessageTooLarge expected instead of %v", err)
+	}
+}
+
+var tests_priorities = []struct {
+	priority int
+	expected int
+}{
+	{1, 1},
+	{200, 200},
+	{0, 1},
+	{-5, 1},
+	{MAX_STREAM_PRIORITY + 1, MAX_STREAM_PRIORITY},
+}
+
+func Test_Stream_Priority(t *testing.T) {
+	s, _ := newTestStream(100, 100)
+	if p := s.GetPriority(); p != DEFAULT_STREAM_PRIORITY {
+		t.Errorf("Stream.GetPriority : %v expected instead of %v", DEFAULT_STREAM_PRIORITY, p)
+	}
+	for i, v := range tests_priorities {
+		s.SetPriority(v.priority)
+		if p := s.GetPriority(); p != v.expected {
+			t.Errorf("Stream.SetPriority : %v expected instead of %v in test n°%v", v.expected, p, i)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package quic
+
+import "github.com/romain-jacotin/quic/protocol"
+import "encoding/json"
+import "io"
+import "sync"
+import "time"
+
+// Tracer receives the events of a session, one at a time from the goroutine of the session: a slow Tracer slows the session.
+// The frames are only valid during the call.
+type Tracer interface {
+	// SentPacket is called for each packet written on the connection
+	SentPacket(seqnum protocol.QuicPacketSequenceNumber, level protocol.EncryptionLevel, size int, frames []protocol.Frame)
+	// ReceivedPacket is called for each packet opened, the duplicates excepted
+	ReceivedPacket(seqnum protocol.QuicPacketSequenceNumber, level protocol.EncryptionLevel, size int, frames []protocol.Frame)
+	// LostPacket is called for each packet declared lost by the loss recovery
+	LostPacket(seqnum protocol.QuicPacketSequenceNumber, level protocol.EncryptionLevel, size int)
+	// UpdatedCongestionWindow is called when the congestion window changes
+	UpdatedCongestionWindow(congestionWindow, bytesInFlight int)
+	// UpdatedRTT is called with the RTT statistics after each RTT sample
+	UpdatedRTT(latest, smoothed, min, meanDeviation time.Duration)
+	// UpdatedKeys is called when the packets are protected with the keys of a new encryption level
+	UpdatedKeys(level protocol.EncryptionLevel)
+	// ClosedConnection is called once with the error closing the session, nil for a Close without error
+	ClosedConnection(err error)
+}
+
+// NewJSONTracer returns a Config.Tracer writing the events of the sessions in the qlog JSON-SEQ format: one JSON record per line.
+// The records of a session have its Connection ID as group_id, and the milliseconds since its creation as time.
+func NewJSONTracer(w io.Writer) func(connID protocol.QuicConnectionID, perspective protocol.Perspective) Tracer {
+	mutex := new(sync.Mutex)
+	return func(connID protocol.QuicConnectionID, perspective protocol.Perspective) Tracer {
+		this := &jsonTracer{w: w, mutex: mutex, connID: connID.String(), start: time.Now()}
+		this.write("connectivity:connection_started", map[string]interface{}{
+			"vantage_point":  perspective.String(),
+			"reference_time": this.start.UnixNano() / int64(time.Millisecond)})
+		return this
+	}
+}
+
+// jsonTracer writes the records of a session, the mutex is shared by the sessions of the writer.
+type jsonTracer struct {
+	w      io.Writer
+	mutex  *sync.Mutex
+	connID string
+	start  time.Time
+}
+
+// jsonRecord is a qlog record.
+type jsonRecord struct {
+	Time    float64     `json:"time"`
+	GroupID string      `json:"group_id"`
+	Name    string      `json:"name"`
+	Data    interface{} `json:"data"`
+}
+
+// write writes a record of the session, the write errors are ignored.
+func (this *jsonTracer) write(name string, data interface{}) {
+	b, err := json.Marshal(jsonRecord{
+		Time:    float64(time.Since(this.start)) / float64(time.Millisecond),
+		GroupID: this.connID,
+		Name:    name,
+		Data:    data})
+	if err != nil {
+		return
+	}
+	this.mutex.Lock()
+	this.w.Write(append(b, '\n'))
+	this.mutex.Unlock()
+}
+
+func (this *jsonTracer) SentPacket(seqnum protocol.QuicPacketSequenceNumber, level protocol.EncryptionLevel, size int, frames []protocol.Frame) {
+	this.write("transport:packet_sent", packetJSON(seqnum, level, size, frames))
+}
+
+func (this *jsonTracer) ReceivedPacket(seqnum protocol.QuicPacketSequenceNumber, level protocol.EncryptionLevel, size int, frames []protocol.Frame) {
+	this.write("transport:packet_received", packetJSON(seqnum, level, size, frames))
+}
+
+func (this *jsonTracer) LostPacket(seqnum protocol.QuicPacketSequenceNumber, level protocol.EncryptionLevel, size int) {
+	this.write("recovery:packet_lost", packetJSON(seqnum, level, size, nil))
+}
+
+func (this *jsonTracer) UpdatedCongestionWindow(congestionWindow, bytesInFlight int) {
+	this.write("recovery:metrics_updated", map[string]interface{}{"congestion_window": congestionWindow, "bytes_in_flight": bytesInFlight})
+}
+
+func (this *jsonTracer) UpdatedRTT(latest, smoothed, min, meanDeviation time.Duration) {
+	this.write("recovery:metrics_updated", map[string]interface{}{
+		"latest_rtt":   milliseconds(latest),
+		"smoothed_rtt": milliseconds(smoothed),
+		"min_rtt":      milliseconds(min),
+		"rtt_variance": milliseconds(meanDeviation)})
+}
+
+func (this *jsonTracer) UpdatedKeys(level protocol.EncryptionLevel) {
+	this.write("security:key_updated", map[string]interface{}{"key_type": level.String()})
+}
+
+func (this *jsonTracer) ClosedConnection(err error) {
+	data := map[string]interface{}{"error_code": errorCode(err).String()}
+	if err != nil {
+		data["reason"] = err.Error()
+	}
+	this.write("connectivity:connection_closed", data)
+}
+
+// milliseconds returns the duration in milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// packetJSON returns the data of a packet record, without frames if they are nil.
+func packetJSON(seqnum protocol.QuicPacketSequenceNumber, level protocol.EncryptionLevel, size int, frames []protocol.Frame) map[string]interface{} {
+	data := map[string]interface{}{
+		"header": map[string]interface{}{"packet_number": seqnum, "encryption_level": level.String()},
+		"raw":    map[string]interface{}{"length": size}}
+	if frames != nil {
+		list := make([]map[string]interface{}, 0, len(frames))
+		for _, f := range frames {
+			list = append(list, frameJSON(f))
+		}
+		data["frames"] = list
+	}
+	return data
+}
+
+// frameJSON returns the qlog description of a frame.
+func frameJSON(f protocol.Frame) map[string]interface{} {
+	switch frame := f.(type) {
+	case *protocol.StreamFrame:
+		return map[string]interface{}{"frame_type": "stream", "stream_id": frame.StreamID, "offset": frame.Offset,
+			"length": len(frame.Data), "fin": frame.FIN}
+	case *protocol.AckFrame:
+		ranges := make([][2]protocol.QuicPacketSequenceNumber, 0, len(frame.Ranges))
+		for _, r := range frame.Ranges {
+			ranges = append(ranges, [2]protocol.QuicPacketSequenceNumber{r.Smallest, r.Largest})
+		}
+		return map[string]interface{}{"frame_type": "ack", "largest_acked": frame.LargestAcked, "ack_delay": milliseconds(frame.AckDelay),
+			"acked_ranges": ranges}
+	case *protocol.StopWaitingFrame:
+		return map[string]interface{}{"frame_type": "stop_waiting", "least_unacked_delta": frame.LeastUnackedDelta}
+	case *protocol.WindowUpdateFrame:
+		return map[string]interface{}{"frame_type": "window_update", "stream_id": frame.StreamID, "byte_offset": frame.ByteOffset}
+	case *protocol.BlockedFrame:
+		return map[string]interface{}{"frame_type": "blocked", "stream_id": frame.StreamID}
+	case *protocol.RstStreamFrame:
+		return map[string]interface{}{"frame_type": "rst_stream", "stream_id": frame.StreamID, "byte_offset": frame.ByteOffset,
+			"error_code": frame.ErrorCode.String()}
+	case *protocol.ConnectionCloseFrame:
+		return map[string]interface{}{"frame_type": "connection_close", "error_code": frame.ErrorCode.String(), "reason": frame.ReasonPhrase}
+	case *protocol.GoawayFrame:
+		return map[string]interface{}{"frame_type": "goaway", "error_code": frame.ErrorCode.String(),
+			"last_good_stream_id": frame.LastGoodStreamID, "reason": frame.ReasonPhrase}
+	case *protocol.PingFrame:
+		return map[string]interface{}{"frame_type": "ping"}
+	case *protocol.PaddingFrame:
+		return map[string]interface{}{"frame_type": "padding", "length": frame.Size}
+	}
+	return map[string]interface{}{"frame_type": "unknown"}
+}
@@ -0,0 +1,100 @@
+package quic
+
+import "github.com/romain-jacotin/quic/protocol"
+import "bytes"
+import "context"
+import "encoding/json"
+import "io"
+import "sync"
+import "testing"
+
+// syncBuffer is a bytes.Buffer written by several goroutines.
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (this *syncBuffer) Write(b []byte) (int, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.buf.Write(b)
+}
+
+func (this *syncBuffer) Bytes() []byte {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return append([]byte(nil), this.buf.Bytes()...)
+}
+
+// qlogRecord is a record of the JSON tracer.
+type qlogRecord struct {
+	GroupID string `json:"group_id"`
+	Name    string `json:"name"`
+	Data    struct {
+		Frames []struct {
+			FrameType string                `json:"frame_type"`
+			StreamID  protocol.QuicStreamID `json:"stream_id"`
+		} `json:"frames"`
+		SmoothedRTT float64 `json:"smoothed_rtt"`
+		ErrorCode   string  `json:"error_code"`
+	} `json:"data"`
+}
+
+// hasFrame returns true if the record has a frame of the type, of a stream other than the crypto stream for the STREAM frames.
+func (this *qlogRecord) hasFrame(frameType string) bool {
+	for _, f := range this.Data.Frames {
+		if f.FrameType == frameType && (frameType != "stream" || !f.StreamID.IsCryptoStream()) {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_Session_Tracer(t *testing.T) {
+	var buf syncBuffer
+
+	client, server, closeSessions := newSimulatedSessions(t, newInstantNetwork(), &Config{Tracer: NewJSONTracer(&buf)}, nil)
+	defer closeSessions()
+	go func() {
+		s, err := server.AcceptStream(context.Background())
+		if err == nil {
+			io.Copy(s, s)
+			s.Close()
+		}
+	}()
+	checkEcho(t, client, "hello", 0)
+	client.Close(nil)
+
+	// The handshake, then the stream data, its ACK and the close
+	var tests_events = []struct {
+		name  string
+		match func(r *qlogRecord) bool
+	}{
+		{"connectivity:connection_started", nil},
+		{"security:key_updated", nil},
+		{"transport:packet_sent", func(r *qlogRecord) bool { return r.hasFrame("stream") }},
+		{"transport:packet_received", func(r *qlogRecord) bool { return r.hasFrame("ack") }},
+		{"recovery:metrics_updated", func(r *qlogRecord) bool { return r.Data.SmoothedRTT > 0 }},
+		{"connectivity:connection_closed", func(r *qlogRecord) bool { return r.Data.ErrorCode == protocol.QUIC_NO_ERROR.String() }},
+	}
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	n := 0
+	for _, line := range lines {
+		var r qlogRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			t.Fatalf("NewJSONTracer : invalid record %s (%v)", line, err)
+		}
+		if r.GroupID != client.ConnectionID().String() {
+			t.Errorf("NewJSONTracer : group_id %v expected instead of %v", client.ConnectionID(), r.GroupID)
+		}
+		if n < len(tests_events) && r.Name == tests_events[n].name && (tests_events[n].match == nil || tests_events[n].match(&r)) {
+			n++
+		}
+	}
+	if n < len(tests_events) {
+		t.Errorf("NewJSONTracer : event %v not found in order in %v records", tests_events[n].name, len(lines))
+	}
+	if last := lines[len(lines)-1]; !bytes.Contains(last, []byte("connectivity:connection_closed")) {
+		t.Errorf("NewJSONTracer : the last record must be the close instead of %s", last)
+	}
+}